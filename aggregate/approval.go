@@ -0,0 +1,86 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// ApprovalFunctionID 审批节点虚拟function的id，所有审批节点共用
+var ApprovalFunctionID = value_object.NewNameBasedUUID("bloc.approval_function")
+
+// ApprovalSetting 人工审批节点的配置：运行到此节点时暂停并通知审批人，
+// 审批人通过后才继续运行下游节点。等待审批的时长使用节点的TimeoutInSeconds
+type ApprovalSetting struct {
+	Approvers []*Approver
+	OnReject  value_object.ApprovalFallback // 为空时使flow运行失败
+	OnTimeout value_object.ApprovalFallback // 为空时使flow运行失败
+}
+
+// Approver 审批人及其接收审批通知的渠道，Channel为空时不发送通知
+type Approver struct {
+	UserID  value_object.UUID
+	Channel value_object.NotifyChannel
+	Target  string
+}
+
+func (aS *ApprovalSetting) CheckValid() error {
+	if len(aS.Approvers) == 0 {
+		return errors.New("approval node must have at least one approver")
+	}
+	userIDs := make(map[value_object.UUID]bool, len(aS.Approvers))
+	for _, approver := range aS.Approvers {
+		if approver.UserID.IsNil() {
+			return errors.New("approver's user_id cannot be blank")
+		}
+		if userIDs[approver.UserID] {
+			return fmt.Errorf("duplicate approver: %s", approver.UserID)
+		}
+		userIDs[approver.UserID] = true
+		if approver.Channel == "" {
+			continue
+		}
+		if err := checkNotifyTarget(approver.Channel, approver.Target); err != nil {
+			return fmt.Errorf("approver(%s)'s notify setting not valid: %v", approver.UserID, err)
+		}
+	}
+	if aS.OnReject != "" && !aS.OnReject.IsValid() {
+		return fmt.Errorf("on_reject「%s」not valid", aS.OnReject)
+	}
+	if aS.OnTimeout != "" && !aS.OnTimeout.IsValid() {
+		return fmt.Errorf("on_timeout「%s」not valid", aS.OnTimeout)
+	}
+	return nil
+}
+
+// IsApprover 用户是否是此节点的审批人
+func (aS *ApprovalSetting) IsApprover(userID value_object.UUID) bool {
+	for _, approver := range aS.Approvers {
+		if approver.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Fallback 审批被拒绝(timeout为false)或超时未审批时对flow运行的处理
+func (aS *ApprovalSetting) Fallback(timeout bool) value_object.ApprovalFallback {
+	fallback := aS.OnReject
+	if timeout {
+		fallback = aS.OnTimeout
+	}
+	if fallback == "" {
+		return value_object.ApprovalFailRun
+	}
+	return fallback
+}
+
+// VirtualFunction 审批节点没有对应的function，对外表现为没有ipt和opt的function
+func (aS *ApprovalSetting) VirtualFunction() *Function {
+	return &Function{
+		ID:          ApprovalFunctionID,
+		Name:        "approval",
+		Description: "manual approval",
+	}
+}
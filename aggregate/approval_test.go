@@ -0,0 +1,74 @@
+package aggregate
+
+import (
+	"testing"
+
+	"github.com/fBloc/bloc-server/value_object"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestApprovalSettingCheckValid(t *testing.T) {
+	userID := value_object.NewUUID()
+
+	Convey("valid", t, func() {
+		So((&ApprovalSetting{
+			Approvers: []*Approver{{UserID: userID}}}).CheckValid(), ShouldBeNil)
+		So((&ApprovalSetting{
+			Approvers: []*Approver{{
+				UserID:  userID,
+				Channel: value_object.EmailChannel,
+				Target:  "approver@bloc.com"}},
+			OnReject:  value_object.ApprovalInterceptRun,
+			OnTimeout: value_object.ApprovalFailRun}).CheckValid(), ShouldBeNil)
+	})
+
+	Convey("invalid", t, func() {
+		So((&ApprovalSetting{}).CheckValid(), ShouldNotBeNil)
+		So((&ApprovalSetting{
+			Approvers: []*Approver{{}}}).CheckValid(), ShouldNotBeNil)
+		So((&ApprovalSetting{
+			Approvers: []*Approver{{UserID: userID}, {UserID: userID}}}).CheckValid(), ShouldNotBeNil)
+		So((&ApprovalSetting{
+			Approvers: []*Approver{{
+				UserID:  userID,
+				Channel: value_object.EmailChannel,
+				Target:  "not an email"}}}).CheckValid(), ShouldNotBeNil)
+		So((&ApprovalSetting{
+			Approvers: []*Approver{{UserID: userID}},
+			OnReject:  "ignore"}).CheckValid(), ShouldNotBeNil)
+	})
+}
+
+func TestApprovalSetting(t *testing.T) {
+	userID := value_object.NewUUID()
+	approval := &ApprovalSetting{
+		Approvers: []*Approver{{UserID: userID}},
+		OnTimeout: value_object.ApprovalInterceptRun}
+
+	Convey("IsApprover", t, func() {
+		So(approval.IsApprover(userID), ShouldBeTrue)
+		So(approval.IsApprover(value_object.NewUUID()), ShouldBeFalse)
+	})
+
+	Convey("Fallback", t, func() {
+		So(approval.Fallback(false), ShouldEqual, value_object.ApprovalFailRun)
+		So(approval.Fallback(true), ShouldEqual, value_object.ApprovalInterceptRun)
+	})
+
+	Convey("VirtualFunction", t, func() {
+		function := approval.VirtualFunction()
+		So(function.IsZero(), ShouldBeFalse)
+		So(function.ID, ShouldEqual, ApprovalFunctionID)
+		So(len(function.Ipts), ShouldEqual, 0)
+	})
+}
+
+func TestFunctionRunRecordIsWaitingApproval(t *testing.T) {
+	Convey("IsWaitingApproval", t, func() {
+		record := &FunctionRunRecord{ID: value_object.NewUUID(), WaitingApproval: true}
+		So(record.IsWaitingApproval(), ShouldBeTrue)
+
+		record.TimeoutCanceled = true
+		So(record.IsWaitingApproval(), ShouldBeFalse)
+	})
+}
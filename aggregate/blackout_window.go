@@ -0,0 +1,122 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const blackoutClockLayout = "15:04"
+
+// BlackoutWindow 禁止运行的周期性时段，如每周六00:00～06:00。
+// End早于Start时表示跨越零点，如22:00～02:00，此时Weekdays指的是开始那天。
+// 保存及加载时需调用CheckValid，其会缓存解析后的时刻及时区供Contains使用
+type BlackoutWindow struct {
+	Weekdays []time.Weekday // 为空表示每天
+	Start    string         // 格式为15:04
+	End      string         // 格式为15:04
+	Timezone string         // IANA时区名，为空表示服务器本地时区
+
+	start, end time.Duration
+	loc        *time.Location // 为nil表示还未通过校验
+}
+
+func parseBlackoutClock(clock string) (time.Duration, error) {
+	t, err := time.Parse(blackoutClockLayout, clock)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (bW *BlackoutWindow) location() (*time.Location, error) {
+	if bW.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(bW.Timezone)
+}
+
+// CheckValid 校验通过时缓存解析后的开始/结束时刻及时区
+func (bW *BlackoutWindow) CheckValid() error {
+	start, err := parseBlackoutClock(bW.Start)
+	if err != nil {
+		return fmt.Errorf("start「%s」must be format of HH:MM", bW.Start)
+	}
+	end, err := parseBlackoutClock(bW.End)
+	if err != nil {
+		return fmt.Errorf("end「%s」must be format of HH:MM", bW.End)
+	}
+	if start == end {
+		return errors.New("start and end cannot be the same")
+	}
+	for _, weekday := range bW.Weekdays {
+		if weekday < time.Sunday || weekday > time.Saturday {
+			return fmt.Errorf("weekday「%d」not valid, must in 0(Sunday)~6(Saturday)", weekday)
+		}
+	}
+	loc, err := bW.location()
+	if err != nil {
+		return fmt.Errorf("timezone「%s」not valid", bW.Timezone)
+	}
+	bW.start, bW.end, bW.loc = start, end, loc
+	return nil
+}
+
+func (bW *BlackoutWindow) onWeekday(weekday time.Weekday) bool {
+	if len(bW.Weekdays) == 0 {
+		return true
+	}
+	for _, w := range bW.Weekdays {
+		if w == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains 某个时间点是否处于此禁止运行时段内，无效或未经CheckValid的时段不包含任何时间
+func (bW *BlackoutWindow) Contains(t time.Time) bool {
+	if bW.loc == nil {
+		return false
+	}
+	loc, start, end := bW.loc, bW.start, bW.end
+
+	t = t.In(loc)
+	dayStart := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	clock := t.Sub(dayStart)
+	if start < end {
+		return bW.onWeekday(t.Weekday()) && clock >= start && clock < end
+	}
+	// 跨越零点的：开始当天的start之后，或者开始后一天的end之前
+	if clock >= start && bW.onWeekday(t.Weekday()) {
+		return true
+	}
+	return clock < end && bW.onWeekday(dayStart.AddDate(0, 0, -1).Weekday())
+}
+
+func (bW *BlackoutWindow) String() string {
+	weekdays := "every day"
+	if len(bW.Weekdays) > 0 {
+		names := make([]string, 0, len(bW.Weekdays))
+		for _, weekday := range bW.Weekdays {
+			names = append(names, weekday.String()[:3])
+		}
+		weekdays = strings.Join(names, ",")
+	}
+	resp := fmt.Sprintf("%s %s-%s", weekdays, bW.Start, bW.End)
+	if bW.Timezone != "" {
+		resp += " " + bW.Timezone
+	}
+	return resp
+}
+
+// MatchedBlackoutWindow 返回包含某个时间点的禁止运行时段，没有时返回nil
+func MatchedBlackoutWindow(windows []*BlackoutWindow, t time.Time) *BlackoutWindow {
+	for _, window := range windows {
+		if window.Contains(t) {
+			return window
+		}
+	}
+	return nil
+}
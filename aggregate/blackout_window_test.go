@@ -0,0 +1,85 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBlackoutWindowCheckValid(t *testing.T) {
+	Convey("valid", t, func() {
+		So((&BlackoutWindow{Start: "00:00", End: "06:00"}).CheckValid(), ShouldBeNil)
+		So((&BlackoutWindow{
+			Weekdays: []time.Weekday{time.Saturday, time.Sunday},
+			Start:    "22:00", End: "02:00",
+			Timezone: "Asia/Shanghai"}).CheckValid(), ShouldBeNil)
+	})
+
+	Convey("invalid", t, func() {
+		So((&BlackoutWindow{Start: "0:00:00", End: "06:00"}).CheckValid(), ShouldNotBeNil)
+		So((&BlackoutWindow{Start: "00:00", End: "24:00"}).CheckValid(), ShouldNotBeNil)
+		So((&BlackoutWindow{Start: "06:00", End: "06:00"}).CheckValid(), ShouldNotBeNil)
+		So((&BlackoutWindow{
+			Weekdays: []time.Weekday{7},
+			Start:    "00:00", End: "06:00"}).CheckValid(), ShouldNotBeNil)
+		So((&BlackoutWindow{
+			Start: "00:00", End: "06:00",
+			Timezone: "Not/Exist"}).CheckValid(), ShouldNotBeNil)
+	})
+}
+
+// checkedWindow 经过CheckValid的时段，Contains只对校验过的时段生效
+func checkedWindow(bW *BlackoutWindow) *BlackoutWindow {
+	bW.CheckValid()
+	return bW
+}
+
+func TestBlackoutWindowContains(t *testing.T) {
+	// 2022-01-01为周六
+	Convey("same day window", t, func() {
+		window := checkedWindow(&BlackoutWindow{
+			Weekdays: []time.Weekday{time.Saturday},
+			Start:    "00:00", End: "06:00"})
+		So(window.Contains(time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local)), ShouldBeTrue)
+		So(window.Contains(time.Date(2022, 1, 1, 5, 59, 0, 0, time.Local)), ShouldBeTrue)
+		So(window.Contains(time.Date(2022, 1, 1, 6, 0, 0, 0, time.Local)), ShouldBeFalse)
+		So(window.Contains(time.Date(2022, 1, 2, 1, 0, 0, 0, time.Local)), ShouldBeFalse)
+	})
+
+	Convey("every day", t, func() {
+		window := checkedWindow(&BlackoutWindow{Start: "12:00", End: "13:00"})
+		for day := 1; day <= 7; day++ {
+			So(window.Contains(time.Date(2022, 1, day, 12, 30, 0, 0, time.Local)), ShouldBeTrue)
+		}
+	})
+
+	Convey("cross midnight window belongs to start day", t, func() {
+		window := checkedWindow(&BlackoutWindow{
+			Weekdays: []time.Weekday{time.Saturday},
+			Start:    "22:00", End: "02:00"})
+		So(window.Contains(time.Date(2022, 1, 1, 23, 0, 0, 0, time.Local)), ShouldBeTrue)
+		So(window.Contains(time.Date(2022, 1, 2, 1, 0, 0, 0, time.Local)), ShouldBeTrue)
+		So(window.Contains(time.Date(2022, 1, 2, 2, 0, 0, 0, time.Local)), ShouldBeFalse)
+		So(window.Contains(time.Date(2022, 1, 1, 1, 0, 0, 0, time.Local)), ShouldBeFalse)
+		So(window.Contains(time.Date(2022, 1, 2, 23, 0, 0, 0, time.Local)), ShouldBeFalse)
+	})
+
+	Convey("timezone", t, func() {
+		window := checkedWindow(&BlackoutWindow{Start: "00:00", End: "06:00", Timezone: "Asia/Shanghai"})
+		So(window.Contains(time.Date(2022, 1, 1, 18, 0, 0, 0, time.UTC)), ShouldBeTrue)
+		So(window.Contains(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)), ShouldBeFalse)
+	})
+
+	Convey("invalid window contains nothing", t, func() {
+		window := checkedWindow(&BlackoutWindow{Start: "bad", End: "06:00"})
+		So(window.Contains(time.Date(2022, 1, 1, 1, 0, 0, 0, time.Local)), ShouldBeFalse)
+	})
+
+	Convey("window not checked contains nothing", t, func() {
+		window := &BlackoutWindow{Start: "00:00", End: "06:00"}
+		So(window.Contains(time.Date(2022, 1, 1, 1, 0, 0, 0, time.Local)), ShouldBeFalse)
+		So(window.CheckValid(), ShouldBeNil)
+		So(window.Contains(time.Date(2022, 1, 1, 1, 0, 0, 0, time.Local)), ShouldBeTrue)
+	})
+}
@@ -1,12 +1,19 @@
 package aggregate
 
 import (
+	"errors"
 	"fmt"
+	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/fBloc/bloc-server/config"
 	"github.com/fBloc/bloc-server/internal/crontab"
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/pkg/json_schema"
+	"github.com/fBloc/bloc-server/pkg/opt"
+	"github.com/fBloc/bloc-server/pkg/transform"
 	"github.com/fBloc/bloc-server/pkg/value_type"
 	"github.com/fBloc/bloc-server/value_object"
 )
@@ -19,7 +26,287 @@ type IptComponentConfig struct {
 	Value interface{}
 	// 当且仅当为connection时才会有此
 	FlowFunctionID string
-	Key            string
+	// connection时为上游opt的key；flow_param时为绑定的flow参数名
+	Key string
+	// 仅connection时可配置，对上游opt的值执行转换表达式后再作为输入，见 pkg/transform
+	Transform string
+}
+
+// BranchCondition 连向下游节点的边上的条件，上游节点的opt满足条件时才会运行此下游节点
+type BranchCondition struct {
+	OptKey   string
+	Operator value_object.ConditionOperator
+	Value    interface{}
+}
+
+// CheckValid 检测条件是否能够作用于上游function的opt上
+func (bC *BranchCondition) CheckValid(upstreamFunction *Function) error {
+	if !bC.Operator.IsValid() {
+		return fmt.Errorf("condition operator「%s」not valid", bC.Operator)
+	}
+	if upstreamFunction.IsZero() {
+		return errors.New("condition must set on function node")
+	}
+	for _, optItem := range upstreamFunction.Opts {
+		if optItem.Key != bC.OptKey {
+			continue
+		}
+		if optItem.IsArray {
+			return fmt.Errorf("condition not support array opt「%s」", bC.OptKey)
+		}
+		if bC.Operator.NeedOrdering() && !optItem.ValueType.Comparable() {
+			return fmt.Errorf(
+				"opt「%s」is %s type, not support operator「%s」",
+				bC.OptKey, optItem.ValueType, bC.Operator)
+		}
+		// 条件值只能是单个值，不能比较的(如数组)视为无效
+		_, compareErr := value_type.Compare(optItem.ValueType, bC.Value, bC.Value)
+		if compareErr != nil || !value_type.CheckValueTypeValueValid(optItem.ValueType, bC.Value) {
+			return fmt.Errorf(
+				"condition value %v not match opt「%s」's value type %s",
+				bC.Value, bC.OptKey, optItem.ValueType)
+		}
+		return nil
+	}
+	return fmt.Errorf("opt「%s」not exist in function「%s」", bC.OptKey, upstreamFunction.Name)
+}
+
+// Match 上游节点的opt值是否满足条件
+func (bC *BranchCondition) Match(
+	optValueType value_type.ValueType, optValue interface{},
+) (bool, error) {
+	compareResult, err := value_type.Compare(optValueType, optValue, bC.Value)
+	if err != nil {
+		return false, err
+	}
+	return bC.Operator.Satisfied(compareResult), nil
+}
+
+// MapSetting 对数组输入逐元素运行（map）的配置
+// 此ipt的值需为数组，每个元素单独运行一次，各次运行的opt再按顺序汇总为数组opt供下游使用
+type MapSetting struct {
+	IptIndex       int // 按此ipt的值逐元素展开运行
+	MaxConcurrency int // 同时运行的最大数目，<=0表示不限制
+}
+
+// Concurrency 同时运行的数目，total为总的元素数目
+func (mS *MapSetting) Concurrency(total int) int {
+	if mS.MaxConcurrency <= 0 || mS.MaxConcurrency > total {
+		return total
+	}
+	return mS.MaxConcurrency
+}
+
+// defaultRetryIntervalInSecond 没有配置重试间隔时默认的等待秒数
+const defaultRetryIntervalInSecond = 3
+
+// RetryPolicy 节点运行失败后的重试策略，配置后替代flow整体的重试配置
+type RetryPolicy struct {
+	MaxAttempts      uint16 // 包含首次运行在内最多运行的次数
+	Backoff          value_object.RetryBackoff
+	IntervalInSecond uint16 // 第一次重试前等待的秒数，之后按照Backoff增长
+	MaxDelayInSecond uint16 // 等待时长的上限，0表示不限制
+}
+
+func (rP *RetryPolicy) CheckValid() error {
+	if rP.MaxAttempts == 0 {
+		return errors.New("max attempts must be greater than 0")
+	}
+	if !rP.Backoff.IsValid() {
+		return fmt.Errorf("retry backoff「%s」not valid", rP.Backoff)
+	}
+	if rP.MaxDelayInSecond > 0 && rP.MaxDelayInSecond < rP.IntervalInSecond {
+		return errors.New("max delay cannot be less than interval")
+	}
+	return nil
+}
+
+// ShouldRetry 已运行attempted次都失败后是否还需要重试
+func (rP *RetryPolicy) ShouldRetry(attempted int) bool {
+	return attempted < int(rP.MaxAttempts)
+}
+
+// Delay 第attempt次运行失败后到下一次重试需等待的时长
+func (rP *RetryPolicy) Delay(attempt int) time.Duration {
+	interval := time.Duration(rP.IntervalInSecond) * time.Second
+	if interval <= 0 {
+		interval = defaultRetryIntervalInSecond * time.Second
+	}
+	maxDelay := time.Duration(rP.MaxDelayInSecond) * time.Second
+
+	delay := interval
+	if rP.Backoff != value_object.FixedBackoff {
+		for i := 1; i < attempt; i++ {
+			delay *= 2
+			if maxDelay > 0 && delay >= maxDelay {
+				break
+			}
+			if delay >= 24*time.Hour { // 防止溢出
+				break
+			}
+		}
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	if rP.Backoff == value_object.JitterBackoff && delay > interval {
+		delay = interval + time.Duration(rand.Int63n(int64(delay-interval)+1))
+	}
+	return delay
+}
+
+// SubFlowSetting 子flow节点的配置：运行到此节点时触发另一个已上线的flow运行并等待其完成
+// 子flow中末端节点（没有下游的节点）的opt作为此节点的opt
+type SubFlowSetting struct {
+	FlowOriginID value_object.UUID
+	IptTargets   []SubFlowIptTarget // 与此节点的ParamIpts一一对应
+}
+
+// SubFlowIptTarget 此节点的ipt传入到子flow的哪个节点的哪个参数
+type SubFlowIptTarget struct {
+	FlowFunctionID string
+	IptIndex       int
+	ComponentIndex int
+}
+
+// AssembleFunction 装配子flow各节点的function（含嵌套的子flow）并生成此子flow节点的虚拟function
+// parentFlowOriginID 为此节点所在flow的origin_id，用于防止flow直接或间接地引用自身
+func (sFS *SubFlowSetting) AssembleFunction(
+	parentFlowOriginID value_object.UUID,
+	getFunction func(functionID value_object.UUID) *Function,
+	getOnlineFlow func(originID value_object.UUID) (*Flow, error),
+) (*Function, error) {
+	return sFS.assembleFunction(
+		map[value_object.UUID]bool{parentFlowOriginID: true},
+		getFunction, getOnlineFlow)
+}
+
+func (sFS *SubFlowSetting) assembleFunction(
+	referencedOriginIDs map[value_object.UUID]bool,
+	getFunction func(functionID value_object.UUID) *Function,
+	getOnlineFlow func(originID value_object.UUID) (*Flow, error),
+) (*Function, error) {
+	if referencedOriginIDs[sFS.FlowOriginID] {
+		return nil, fmt.Errorf("sub flow(origin_id: %s) references itself", sFS.FlowOriginID)
+	}
+	subFlow, err := getOnlineFlow(sFS.FlowOriginID)
+	if err != nil {
+		return nil, err
+	}
+	if subFlow.IsZero() {
+		return nil, fmt.Errorf("no online flow of origin_id: %s", sFS.FlowOriginID)
+	}
+
+	referencedOriginIDs[sFS.FlowOriginID] = true
+	defer delete(referencedOriginIDs, sFS.FlowOriginID)
+	for _, flowFuncID := range subFlow.LinedFlowFunctionIDs() {
+		flowFunc := subFlow.FlowFunctionIDMapFlowFunction[flowFuncID]
+		if flowFunc.Approval != nil {
+			flowFunc.Function = flowFunc.Approval.VirtualFunction()
+			continue
+		}
+		if flowFunc.SubFlow != nil {
+			function, err := flowFunc.SubFlow.assembleFunction(
+				referencedOriginIDs, getFunction, getOnlineFlow)
+			if err != nil {
+				return nil, err
+			}
+			flowFunc.Function = function
+			continue
+		}
+		function := getFunction(flowFunc.FunctionID)
+		if function.IsZero() {
+			return nil, fmt.Errorf(
+				"sub flow「%s」's function node「%s」cannot find corresponding function",
+				subFlow.Name, flowFunc.Name())
+		}
+		flowFunc.Function = function
+	}
+	return sFS.VirtualFunction(subFlow)
+}
+
+// VirtualFunction 子flow节点对外表现为一个function：
+// ipt为IptTargets指向的子flow节点的参数，opt为子flow末端节点的opt（同名的以排序靠后的节点为准）
+// subFlow的各节点需已装配好function
+func (sFS *SubFlowSetting) VirtualFunction(subFlow *Flow) (*Function, error) {
+	if subFlow.IsZero() {
+		return nil, errors.New("sub flow not exist")
+	}
+	function := &Function{
+		ID:          subFlow.ID,
+		Name:        subFlow.Name,
+		Description: "sub flow",
+		Ipts:        make(ipt.IptSlice, 0, len(sFS.IptTargets)),
+		Opts:        make([]*opt.Opt, 0, 2),
+	}
+	for index, target := range sFS.IptTargets {
+		targetFlowFunc, ok := subFlow.FlowFunctionIDMapFlowFunction[target.FlowFunctionID]
+		if !ok || targetFlowFunc.Function.IsZero() {
+			return nil, fmt.Errorf(
+				"the %dth ipt's target flow_function(%s) not found in sub flow",
+				index, target.FlowFunctionID)
+		}
+		targetIpts := targetFlowFunc.Function.Ipts
+		if target.IptIndex < 0 || target.IptIndex >= len(targetIpts) {
+			return nil, fmt.Errorf("the %dth ipt's target ipt index %d out of range", index, target.IptIndex)
+		}
+		targetIpt := targetIpts[target.IptIndex]
+		if target.ComponentIndex < 0 || target.ComponentIndex >= len(targetIpt.Components) {
+			return nil, fmt.Errorf(
+				"the %dth ipt's target component index %d out of range", index, target.ComponentIndex)
+		}
+		component := *targetIpt.Components[target.ComponentIndex]
+		function.Ipts = append(function.Ipts, &ipt.Ipt{
+			Key:        targetIpt.Key,
+			Display:    targetIpt.Display,
+			Must:       targetIpt.Must,
+			Components: []*ipt.IptComponent{&component},
+		})
+	}
+
+	optKeyMapIndex := make(map[string]int)
+	for _, leafID := range subFlow.LeafFlowFunctionIDs() {
+		leaf := subFlow.FlowFunctionIDMapFlowFunction[leafID]
+		if leaf.Function.IsZero() {
+			return nil, fmt.Errorf("sub flow's leaf flow_function(%s) have no function", leafID)
+		}
+		for _, optItem := range leaf.Function.Opts {
+			leafOpt := *optItem
+			if leaf.Map != nil { // map节点的opt汇总后都是数组
+				leafOpt.IsArray = true
+			}
+			if index, ok := optKeyMapIndex[leafOpt.Key]; ok {
+				function.Opts[index] = &leafOpt
+				continue
+			}
+			optKeyMapIndex[leafOpt.Key] = len(function.Opts)
+			function.Opts = append(function.Opts, &leafOpt)
+		}
+	}
+	return function, nil
+}
+
+// OverideIptParams 将此节点的ipt值按照IptTargets转换为子flow运行时的覆盖参数
+func (sFS *SubFlowSetting) OverideIptParams(
+	ipts [][]interface{},
+) map[string][][]interface{} {
+	params := make(map[string][][]interface{})
+	for index, target := range sFS.IptTargets {
+		if index >= len(ipts) || len(ipts[index]) == 0 || ipts[index][0] == nil {
+			continue
+		}
+		param := params[target.FlowFunctionID]
+		for len(param) <= target.IptIndex {
+			param = append(param, []interface{}{})
+		}
+		// 没有覆盖值的位置为nil，运行时会使用子flow自身的配置
+		for len(param[target.IptIndex]) <= target.ComponentIndex {
+			param[target.IptIndex] = append(param[target.IptIndex], nil)
+		}
+		param[target.IptIndex][target.ComponentIndex] = ipts[index][0]
+		params[target.FlowFunctionID] = param
+	}
+	return params
 }
 
 type FlowFunction struct {
@@ -29,7 +316,13 @@ type FlowFunction struct {
 	Position                  interface{}
 	UpstreamFlowFunctionIDs   []string
 	DownstreamFlowFunctionIDs []string
-	ParamIpts                 [][]IptComponentConfig // 第一层对应一个ipt，第二层对应ipt内的component
+	DownstreamConditions      map[string]*BranchCondition // 下游flow_function_id -> 条件. 没有配置条件的下游无条件运行
+	Map                       *MapSetting                 // 不为nil时表示以map模式运行
+	SubFlow                   *SubFlowSetting             // 不为nil时表示此节点运行另一个flow，此时没有FunctionID
+	Approval                  *ApprovalSetting            // 不为nil时表示此节点为人工审批节点，此时没有FunctionID
+	RetryPolicy               *RetryPolicy                // 不为nil时以此作为节点的重试策略，否则使用flow整体的重试配置
+	TimeoutInSeconds          uint32                      // 节点单次运行的超时时长，0表示不限制（仍受flow整体超时的限制）
+	ParamIpts                 [][]IptComponentConfig      // 第一层对应一个ipt，第二层对应ipt内的component
 	findAllUpstreamIDOnce     sync.Once
 	allUpstreamIDsMap         map[string]struct{}
 }
@@ -49,25 +342,29 @@ func (flowFunc *FlowFunction) AllUpstreamFlowFunctionIDsMap(flowFuncIDMapFlowFun
 	if flowFunc.allUpstreamIDsMap != nil {
 		return flowFunc.allUpstreamIDsMap
 	}
-	var upIDs []string
-	var iterFunc func(thisFlowFunc *FlowFunction, upIDs *[]string)
-	iterFunc = func(thisFlowFunc *FlowFunction, upIDs *[]string) {
+	// 已访问过的节点不再重复访问，避免配置有环或者上游节点不存在时无限递归
+	upIDsMap := make(map[string]struct{})
+	var iterFunc func(thisFlowFunc *FlowFunction)
+	iterFunc = func(thisFlowFunc *FlowFunction) {
 		for _, upstreamFlowFuncID := range thisFlowFunc.UpstreamFlowFunctionIDs {
 			if upstreamFlowFuncID == config.FlowFunctionStartID {
-				return
+				continue
+			}
+			if _, ok := upIDsMap[upstreamFlowFuncID]; ok {
+				continue
 			}
-			*upIDs = append(*upIDs, upstreamFlowFuncID)
-			iterFunc(flowFuncIDMapFlowFunction[upstreamFlowFuncID], upIDs)
+			upstreamFlowFunc, ok := flowFuncIDMapFlowFunction[upstreamFlowFuncID]
+			if !ok {
+				continue
+			}
+			upIDsMap[upstreamFlowFuncID] = struct{}{}
+			iterFunc(upstreamFlowFunc)
 		}
 	}
 
 	flowFunc.findAllUpstreamIDOnce.Do(
 		func() {
-			iterFunc(flowFunc, &upIDs)
-			upIDsMap := make(map[string]struct{}, len(upIDs))
-			for _, i := range upIDs {
-				upIDsMap[i] = struct{}{}
-			}
+			iterFunc(flowFunc)
 			flowFunc.allUpstreamIDsMap = upIDsMap
 		})
 	return flowFunc.allUpstreamIDsMap
@@ -95,6 +392,9 @@ func (flowFunc *FlowFunction) CheckWhetherParamValidIsValid(
 			componentParamConfig := flowFunc.ParamIpts[iptIndex][componentIndex]
 			valueValid := value_type.CheckValueTypeValueValid(
 				componentParamConfig.ValueType, componentVal)
+			if component := flowFunc.Function.IptComponent(iptIndex, componentIndex); component != nil {
+				valueValid = valueValid && component.ValueAllowed(componentVal)
+			}
 			if !valueValid {
 				return false, fmt.Errorf(
 					"user_ipt value type wrong",
@@ -110,10 +410,33 @@ func (flowFunc *FlowFunction) CheckValid(
 	thisFlowFuncID string,
 	flowFuncIDMapFlowFunction map[string]*FlowFunction,
 ) (bool, error) {
-	// 节点上游id必须是在数据里的（防止前端传过来的数据不对）
+	if err := flowFunc.checkEdgesValid(flowFuncIDMapFlowFunction); err != nil {
+		return false, err
+	}
+	if err := flowFunc.checkSettingValid(thisFlowFuncID, flowFuncIDMapFlowFunction); err != nil {
+		return false, err
+	}
+
+	// 检测输入参数的类型是否正确
+	for iptIndex, iptParamConfig := range flowFunc.ParamIpts { // 对应到ipt
+		for componentIndex := range iptParamConfig { // 对应到component
+			_, err := flowFunc.checkIptComponentValid(
+				iptIndex, componentIndex, thisFlowFuncID, flowFuncIDMapFlowFunction)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// checkEdgesValid 节点上下游id必须是在数据里的（防止前端传过来的数据不对）
+func (flowFunc *FlowFunction) checkEdgesValid(
+	flowFuncIDMapFlowFunction map[string]*FlowFunction,
+) error {
 	for _, funcID := range flowFunc.UpstreamFlowFunctionIDs {
 		if _, ok := flowFuncIDMapFlowFunction[funcID]; !ok {
-			return false, fmt.Errorf(
+			return fmt.Errorf(
 				`「%s」节点填写的上游节点flow_function_id(%s)无效
 				-没有找到对应的flow_function_id`,
 				flowFunc.Name(), funcID)
@@ -123,99 +446,300 @@ func (flowFunc *FlowFunction) CheckValid(
 	// 节点下游id必须是在数据里的（防止前端传过来的数据不对）
 	for _, funcID := range flowFunc.DownstreamFlowFunctionIDs {
 		if _, ok := flowFuncIDMapFlowFunction[funcID]; !ok {
-			return false, fmt.Errorf(
+			return fmt.Errorf(
 				`「%s」节点填写的下游节点flow_function_id(%s)无效
 				-没有找到对应的flow_function_id`,
 				flowFunc.Name(), funcID)
 		}
 	}
+	return nil
+}
+
+// checkSettingValid 检测节点自身的配置：分支条件、重试策略、map、子flow及人工审批等
+func (flowFunc *FlowFunction) checkSettingValid(
+	thisFlowFuncID string,
+	flowFuncIDMapFlowFunction map[string]*FlowFunction,
+) error {
+	// 分支条件只能配置在下游边上，且需要与此节点的opt类型匹配
+	for downFlowFuncID, condition := range flowFunc.DownstreamConditions {
+		isDownstream := false
+		for _, i := range flowFunc.DownstreamFlowFunctionIDs {
+			if i == downFlowFuncID {
+				isDownstream = true
+				break
+			}
+		}
+		if !isDownstream {
+			return fmt.Errorf(
+				"「%s」节点配置的分支条件对应的flow_function_id(%s)不是其下游节点",
+				flowFunc.Name(), downFlowFuncID)
+		}
+		if thisFlowFuncID == config.FlowFunctionStartID {
+			return errors.New("开始节点不支持配置分支条件")
+		}
+		if flowFunc.Map != nil { // map节点的opt汇总后都是数组，不能作为条件
+			return fmt.Errorf("「%s」节点是map模式，不支持配置分支条件", flowFunc.Name())
+		}
+		if flowFunc.SubFlow != nil {
+			return fmt.Errorf("「%s」节点是子flow，不支持配置分支条件", flowFunc.Name())
+		}
+		if flowFunc.Approval != nil {
+			return fmt.Errorf("「%s」节点是人工审批节点，不支持配置分支条件", flowFunc.Name())
+		}
+		if err := condition.CheckValid(flowFunc.Function); err != nil {
+			return fmt.Errorf(
+				"「%s」节点到下游节点(%s)的分支条件无效: %v",
+				flowFunc.Name(), downFlowFuncID, err)
+		}
+	}
 
 	// 开始节点的特殊情况
 	if thisFlowFuncID == config.FlowFunctionStartID {
 		if len(flowFunc.DownstreamFlowFunctionIDs) == 0 && len(flowFuncIDMapFlowFunction) > 1 {
-			return false, fmt.Errorf(
+			return fmt.Errorf(
 				"start function says no downstreams, but get all %d function",
 				len(flowFuncIDMapFlowFunction))
 		}
-		return true, nil
+		return nil
 	}
 
 	// 下面开始都是非开始节点才需要做的检测
 
+	if flowFunc.RetryPolicy != nil {
+		if err := flowFunc.RetryPolicy.CheckValid(); err != nil {
+			return fmt.Errorf("「%s」节点的重试策略无效: %v", flowFunc.Name(), err)
+		}
+	}
+
 	// 所有节点都应该要有输入节点
 	if len(flowFunc.UpstreamFlowFunctionIDs) <= 0 {
-		return false, fmt.Errorf(
+		return fmt.Errorf(
 			"「%s」节点没有上游节点 - 不允许",
 			flowFunc.Name())
 	}
 
-	// 检测输入参数的类型是否正确
-	for iptIndex, iptParamConfig := range flowFunc.ParamIpts { // 对应到ipt
-		for componentIndex, componentParamConfig := range iptParamConfig { // 对应到component
-			if flowFunc.Function.IsZero() {
-				return false, fmt.Errorf(
-					"not set function to flow_function: %s, cannot check whether ipt param is valid",
-					thisFlowFuncID)
-			}
+	// map模式下被展开的ipt只能是连接到上游数组opt的单个component
+	if flowFunc.Map != nil {
+		if err := flowFunc.checkMapSettingValid(flowFuncIDMapFlowFunction); err != nil {
+			return fmt.Errorf("「%s」节点的map配置无效: %v", flowFunc.Name(), err)
+		}
+	}
 
-			// 若是必填参数、但没有配置参数
-			if componentParamConfig.Blank && flowFunc.Function.Ipts[iptIndex].Must {
-				return false, fmt.Errorf(
-					"「%s」节点第%d个ipt下的第%d个component要求必填，但是没填",
-					flowFunc.Name(),
-					iptIndex, componentIndex)
+	// 子flow节点的每个ipt对应到子flow中的一个参数
+	if flowFunc.SubFlow != nil {
+		if flowFunc.Map != nil {
+			return fmt.Errorf("「%s」节点是子flow，不支持map模式", flowFunc.Name())
+		}
+		if len(flowFunc.SubFlow.IptTargets) != len(flowFunc.ParamIpts) {
+			return fmt.Errorf(
+				"「%s」节点的ipt数目(%d)与子flow的参数映射数目(%d)不一致",
+				flowFunc.Name(), len(flowFunc.ParamIpts), len(flowFunc.SubFlow.IptTargets))
+		}
+		for iptIndex, iptParamConfig := range flowFunc.ParamIpts {
+			if len(iptParamConfig) != 1 {
+				return fmt.Errorf(
+					"「%s」节点是子flow，第%d个ipt只能有一个component", flowFunc.Name(), iptIndex)
 			}
+		}
+	}
 
-			if componentParamConfig.IptWay == value_object.Connection { // 配置的参数输入方式是链接
-				// connection写的节点ID是否存在
-				if _, ok := flowFuncIDMapFlowFunction[componentParamConfig.FlowFunctionID]; !ok {
-					return false, fmt.Errorf(
-						`「%s」节点第%d个ipt下的第%d个component输入的上游flow_function节点id(%s)无效
-						-没有此flow_function_id的上游节点`,
-						flowFunc.Name(),
-						iptIndex, componentIndex, componentParamConfig.FlowFunctionID,
-					)
-				}
+	// 人工审批节点只等待审批，没有ipt
+	if flowFunc.Approval != nil {
+		if flowFunc.Map != nil || flowFunc.SubFlow != nil {
+			return fmt.Errorf("「%s」节点是人工审批节点，不支持map模式及子flow", flowFunc.Name())
+		}
+		if len(flowFunc.ParamIpts) > 0 {
+			return fmt.Errorf("「%s」节点是人工审批节点，不能配置ipt", flowFunc.Name())
+		}
+		if err := flowFunc.Approval.CheckValid(); err != nil {
+			return fmt.Errorf("「%s」节点的审批配置无效: %v", flowFunc.Name(), err)
+		}
+	}
+	return nil
+}
 
-				// 2. connection写的节点ID需要是此节点的上游
-				// 注意：可以不是直接上游！
-				allUpStreamsMap := flowFunc.AllUpstreamFlowFunctionIDsMap(flowFuncIDMapFlowFunction)
-				if _, ok := allUpStreamsMap[componentParamConfig.FlowFunctionID]; !ok {
-					return false, fmt.Errorf(
-						`「%s」节点第%d个ipt下的第%d个component输入的上游flow_function节点id(%s)无效
-						-此flow_function_id对应的节点不是直接上游节点、不能作为输入`,
-						flowFunc.Name(),
-						iptIndex, componentIndex, componentParamConfig.FlowFunctionID,
-					)
-				}
+// checkIptComponentValid 检测一个component的输入配置，无效时同时返回对应的问题类型
+func (flowFunc *FlowFunction) checkIptComponentValid(
+	iptIndex, componentIndex int,
+	thisFlowFuncID string,
+	flowFuncIDMapFlowFunction map[string]*FlowFunction,
+) (ValidationIssueCode, error) {
+	componentParamConfig := flowFunc.ParamIpts[iptIndex][componentIndex]
+	if flowFunc.Function.IsZero() {
+		return MissingFunctionIssue, fmt.Errorf(
+			"not set function to flow_function: %s, cannot check whether ipt param is valid",
+			thisFlowFuncID)
+	}
+	if iptIndex >= len(flowFunc.Function.Ipts) {
+		return InvalidConfigIssue, fmt.Errorf(
+			"「%s」节点配置了第%d个ipt，但function只有%d个ipt",
+			flowFunc.Name(), iptIndex, len(flowFunc.Function.Ipts))
+	}
+
+	// 若是必填参数、但没有配置参数
+	if componentParamConfig.Blank && flowFunc.Function.Ipts[iptIndex].Must {
+		return MissingRequiredIptIssue, fmt.Errorf(
+			"「%s」节点第%d个ipt下的第%d个component要求必填，但是没填",
+			flowFunc.Name(),
+			iptIndex, componentIndex)
+	}
+
+	if componentParamConfig.IptWay == value_object.Connection { // 配置的参数输入方式是链接
+		// connection写的节点ID是否存在
+		if _, ok := flowFuncIDMapFlowFunction[componentParamConfig.FlowFunctionID]; !ok {
+			return InvalidConnectionIssue, fmt.Errorf(
+				`「%s」节点第%d个ipt下的第%d个component输入的上游flow_function节点id(%s)无效
+				-没有此flow_function_id的上游节点`,
+				flowFunc.Name(),
+				iptIndex, componentIndex, componentParamConfig.FlowFunctionID,
+			)
+		}
+
+		// 2. connection写的节点ID需要是此节点的上游
+		// 注意：可以不是直接上游！
+		allUpStreamsMap := flowFunc.AllUpstreamFlowFunctionIDsMap(flowFuncIDMapFlowFunction)
+		if _, ok := allUpStreamsMap[componentParamConfig.FlowFunctionID]; !ok {
+			return InvalidConnectionIssue, fmt.Errorf(
+				`「%s」节点第%d个ipt下的第%d个component输入的上游flow_function节点id(%s)无效
+				-此flow_function_id对应的节点不是直接上游节点、不能作为输入`,
+				flowFunc.Name(),
+				iptIndex, componentIndex, componentParamConfig.FlowFunctionID,
+			)
+		}
 
-				// 3. 检查对应出参的类型是不是和此参数的输入要求类型一致
-				iptNode := flowFuncIDMapFlowFunction[componentParamConfig.FlowFunctionID]
-				for _, optItem := range iptNode.Function.Opts {
-					if optItem.Key != componentParamConfig.Key {
-						continue
-					}
-					if optItem.ValueType != componentParamConfig.ValueType {
-						return false, fmt.Errorf(
-							`「%s」节点第%d个ipt下的第%d个component输入的上游flow_function节点id(%s)无效
-							-此flow_function_id对应的节点不是直接上游节点、不能作为输入`,
-							flowFunc.Name(),
-							iptIndex, componentIndex, componentParamConfig.FlowFunctionID)
-					}
+		// 3. 检查对应出参的类型是不是和此参数的输入要求类型一致
+		iptNode := flowFuncIDMapFlowFunction[componentParamConfig.FlowFunctionID]
+		if iptNode.Function.IsZero() {
+			return MissingFunctionIssue, fmt.Errorf(
+				"「%s」节点第%d个ipt下的第%d个component连接的上游节点(%s)没有对应的function",
+				flowFunc.Name(), iptIndex, componentIndex, componentParamConfig.FlowFunctionID)
+		}
+		for _, optItem := range iptNode.Function.Opts {
+			if optItem.Key != componentParamConfig.Key {
+				continue
+			}
+			// 配置了转换表达式时，检查表达式的输出类型而不是上游opt的类型
+			if componentParamConfig.Transform != "" {
+				err := checkTransformValid(
+					componentParamConfig, optItem, iptNode.Map != nil,
+					flowFunc.Function.IptComponent(iptIndex, componentIndex))
+				if err != nil {
+					return TypeMismatchIssue, fmt.Errorf(
+						"「%s」节点第%d个ipt下的第%d个component的transform无效: %w",
+						flowFunc.Name(), iptIndex, componentIndex, err)
 				}
-			} else if componentParamConfig.IptWay == value_object.UserIpt { // 配置的参数输入方式是用户输入的值
-				valueValid := value_type.CheckValueTypeValueValid(
-					componentParamConfig.ValueType, componentParamConfig.Value)
-				if !valueValid {
-					return false, fmt.Errorf(
-						"user_ipt value type wrong. ipt_index: %d, component_idex: %d, needed_value_type: %s, get_value: %v",
-						iptIndex, componentIndex, componentParamConfig.ValueType, componentParamConfig.Value,
-					)
+				continue
+			}
+			if !value_type.Connectable(optItem.ValueType, componentParamConfig.ValueType) {
+				return TypeMismatchIssue, fmt.Errorf(
+					`「%s」节点第%d个ipt下的第%d个component输入的上游flow_function节点id(%s)无效
+					-此flow_function_id对应的节点不是直接上游节点、不能作为输入`,
+					flowFunc.Name(),
+					iptIndex, componentIndex, componentParamConfig.FlowFunctionID)
+			}
+			// 上游opt与此参数都声明了json schema时，需要兼容
+			if component := flowFunc.Function.IptComponent(iptIndex, componentIndex); component != nil {
+				err := json_schema.CheckCompatible(optItem.JsonSchema, component.JsonSchema)
+				if err != nil {
+					return TypeMismatchIssue, fmt.Errorf(
+						"「%s」节点第%d个ipt下的第%d个component的json schema与上游opt「%s」的不兼容: %w",
+						flowFunc.Name(), iptIndex, componentIndex, optItem.Key, err)
 				}
 			}
 		}
+	} else if componentParamConfig.Transform != "" {
+		return InvalidConfigIssue, fmt.Errorf(
+			"「%s」节点第%d个ipt下的第%d个component不是connection、不能配置transform",
+			flowFunc.Name(), iptIndex, componentIndex)
 	}
-	return true, nil
+	if componentParamConfig.IptWay == value_object.UserIpt { // 配置的参数输入方式是用户输入的值
+		valueValid := value_type.CheckValueTypeValueValid(
+			componentParamConfig.ValueType, componentParamConfig.Value)
+		if !valueValid {
+			return TypeMismatchIssue, fmt.Errorf(
+				"user_ipt value type wrong. ipt_index: %d, component_idex: %d, needed_value_type: %s, get_value: %v",
+				iptIndex, componentIndex, componentParamConfig.ValueType, componentParamConfig.Value,
+			)
+		}
+		if component := flowFunc.Function.IptComponent(iptIndex, componentIndex); component != nil {
+			// enum类型的值需要在function声明的可选值内
+			if !component.ValueAllowed(componentParamConfig.Value) {
+				return InvalidValueIssue, fmt.Errorf(
+					"user_ipt value not allowed. ipt_index: %d, component_idex: %d, allowed_values: %v, get_value: %v",
+					iptIndex, componentIndex, component.AllowedValues, componentParamConfig.Value,
+				)
+			}
+			// json类型的值需要满足function声明的json schema
+			if err := component.ValidateJsonSchema(componentParamConfig.Value); err != nil {
+				return InvalidValueIssue, fmt.Errorf(
+					"user_ipt value not match json schema. ipt_index: %d, component_idex: %d: %w",
+					iptIndex, componentIndex, err)
+			}
+		}
+	} else if componentParamConfig.IptWay == value_object.FlowParam { // 配置的参数输入方式是绑定flow参数
+		if componentParamConfig.Key == "" {
+			return InvalidConfigIssue, fmt.Errorf(
+				"flow_param name missing. ipt_index: %d, component_idex: %d",
+				iptIndex, componentIndex,
+			)
+		}
+	}
+	return "", nil
+}
+
+func (flowFunc *FlowFunction) checkMapSettingValid(
+	flowFuncIDMapFlowFunction map[string]*FlowFunction,
+) error {
+	iptIndex := flowFunc.Map.IptIndex
+	if iptIndex < 0 || iptIndex >= len(flowFunc.ParamIpts) {
+		return fmt.Errorf("ipt index %d out of range", iptIndex)
+	}
+	if len(flowFunc.ParamIpts[iptIndex]) != 1 {
+		return fmt.Errorf("the %dth ipt should have only one component", iptIndex)
+	}
+	componentConfig := flowFunc.ParamIpts[iptIndex][0]
+	if componentConfig.IptWay != value_object.Connection {
+		return fmt.Errorf("the %dth ipt should be connected to upstream opt", iptIndex)
+	}
+	upstreamFlowFunc, ok := flowFuncIDMapFlowFunction[componentConfig.FlowFunctionID]
+	if !ok || upstreamFlowFunc.Function.IsZero() {
+		return fmt.Errorf("the %dth ipt's upstream function not found", iptIndex)
+	}
+	if upstreamFlowFunc.Map != nil { // map节点的opt汇总后都是数组
+		return nil
+	}
+	if !upstreamFlowFunc.Function.OptKeyMapIsArray()[componentConfig.Key] {
+		return fmt.Errorf("the %dth ipt's upstream opt「%s」is not array", iptIndex, componentConfig.Key)
+	}
+	return nil
+}
+
+// checkTransformValid 静态检查connection上的转换表达式，其输出类型需要能连接到此component
+func checkTransformValid(
+	componentConfig IptComponentConfig, optItem *opt.Opt,
+	upstreamIsMap bool, component *ipt.IptComponent,
+) error {
+	output, err := transform.Check(
+		componentConfig.Transform,
+		transform.Type{
+			ValueType:  optItem.ValueType,
+			IsArray:    optItem.IsArray || upstreamIsMap, // map节点的opt汇总后都是数组
+			JsonSchema: optItem.JsonSchema,
+		})
+	if err != nil {
+		return err
+	}
+	if !output.Known() { // 无法静态推断的，留到运行时检查
+		return nil
+	}
+	if !value_type.Connectable(output.ValueType, componentConfig.ValueType) {
+		return fmt.Errorf(
+			"output type %s cannot connect to %s", output, componentConfig.ValueType)
+	}
+	if component != nil && output.IsArray && !component.AllowMulti {
+		return fmt.Errorf("output type %s is array but component not allow multi", output)
+	}
+	return nil
 }
 
 type Flow struct {
@@ -233,14 +757,33 @@ type Flow struct {
 	FlowFunctionIDMapFlowFunction map[string]*FlowFunction
 	// 是否允许正在运行时再次运行
 	AllowParallelRun bool
+	// 允许并行运行时最多同时运行的数量，0表示不限制
+	MaxConcurrentRuns uint16
+	// 运行数达到上限时，新运行与正在运行冲突的处理方式
+	RunConflictStrategy value_object.RunConflictStrategy
 	// 运行触发
 	Crontab           *crontab.CrontabRepresent
 	TriggerKey        string
 	AllowTriggerByKey bool
+	// crontab计划时间被错过时的处理方式，及fire_all时最多补发的次数
+	CrontabMisfirePolicy  value_object.CrontabMisfirePolicy
+	CrontabMisfireMaxRuns uint16
+	// 最近一次已处理(触发或按策略放弃)的crontab计划时间
+	CrontabLastFiredTime time.Time
 	// 重试策略
 	TimeoutInSeconds      uint32
 	RetryAmount           uint16
 	RetryIntervalInSecond uint16
+	// 运行结束后的通知
+	NotificationRules []*NotificationRule
+	// 暂停后crontab、trigger_key及手动触发的运行都会被跳过，但保留其配置
+	Paused bool
+	// 禁止运行的时段，其间触发的运行会被跳过
+	BlackoutWindows []*BlackoutWindow
+	// 依赖的上游flow，任一上游运行结束且满足条件时触发此flow运行
+	Dependencies []*FlowDependency
+	// flow级别的输入参数，节点的component可以以flow_param方式绑定
+	Params []*FlowParam
 	// 用于权限
 	ReadUserIDs             []value_object.UUID
 	WriteUserIDs            []value_object.UUID
@@ -256,34 +799,277 @@ func (flow *Flow) IsZero() bool {
 	return flow.ID.IsNil()
 }
 
+// ConcurrencyLimit 最多同时运行的数量：不允许并行运行时为1；
+// 允许并行运行时为MaxConcurrentRuns，返回0表示不限制
+func (flow *Flow) ConcurrencyLimit() int {
+	if flow.IsZero() {
+		return 0
+	}
+	if !flow.AllowParallelRun {
+		return 1
+	}
+	return int(flow.MaxConcurrentRuns)
+}
+
+// MisfirePolicy 未设置时同以前的行为一样，放弃错过的
+func (flow *Flow) MisfirePolicy() value_object.CrontabMisfirePolicy {
+	if flow.IsZero() || !flow.CrontabMisfirePolicy.IsValid() {
+		return value_object.MisfireSkip
+	}
+	return flow.CrontabMisfirePolicy
+}
+
+// CrontabTimesToFire 返回now时需要触发的crontab计划时间(升序)，错过的按照错过策略取舍，
+// skippedAmount为按策略放弃的错过次数；
+// lastDue为本次处理到的最新计划时间，需在触发后记录为CrontabLastFiredTime，为零值表示没有到期的
+func (flow *Flow) CrontabTimesToFire(
+	now time.Time,
+) (toFire []time.Time, skippedAmount int, lastDue time.Time) {
+	if flow.IsZero() || !flow.Crontab.IsValid() {
+		return nil, 0, time.Time{}
+	}
+
+	after := flow.CrontabLastFiredTime
+	if after.IsZero() { // 还未触发过的，只看最近一个检查间隔内的
+		after = now.Add(-config.CrontabWatchInterval)
+	}
+	if earliest := now.Add(-config.CrontabMisfireMaxLookback); after.Before(earliest) {
+		after = earliest
+	}
+	dueTimes := flow.Crontab.FireTimesBetween(after, now)
+	if len(dueTimes) == 0 {
+		return nil, 0, time.Time{}
+	}
+
+	misfireDeadline := now.Add(-config.CrontabMisfireThreshold)
+	missedAmount := 0
+	for missedAmount < len(dueTimes) && dueTimes[missedAmount].Before(misfireDeadline) {
+		missedAmount++
+	}
+	keepAmount := 0
+	switch flow.MisfirePolicy() {
+	case value_object.MisfireFireOnce:
+		keepAmount = 1
+	case value_object.MisfireFireAll:
+		keepAmount = int(flow.CrontabMisfireMaxRuns)
+		if keepAmount == 0 {
+			keepAmount = config.CrontabMisfireDefaultMaxRuns
+		}
+	}
+	if keepAmount > missedAmount {
+		keepAmount = missedAmount
+	}
+	return dueTimes[missedAmount-keepAmount:], missedAmount - keepAmount, dueTimes[len(dueTimes)-1]
+}
+
+// RunBlockedReason 在t时触发的运行是否需要被跳过，返回跳过的原因，为空表示可以运行。
+// globalBlackoutWindows为对全部flow生效的禁止运行时段
+func (flow *Flow) RunBlockedReason(
+	t time.Time, globalBlackoutWindows []*BlackoutWindow,
+) string {
+	if flow.IsZero() {
+		return ""
+	}
+	if flow.Paused {
+		return "flow is paused"
+	}
+	if window := MatchedBlackoutWindow(flow.BlackoutWindows, t); window != nil {
+		return fmt.Sprintf("in flow's blackout window: %s", window)
+	}
+	if window := MatchedBlackoutWindow(globalBlackoutWindows, t); window != nil {
+		return fmt.Sprintf("in global blackout window: %s", window)
+	}
+	return ""
+}
+
+// ConflictStrategy 未设置时同以前的行为一样，放弃新的运行
+func (flow *Flow) ConflictStrategy() value_object.RunConflictStrategy {
+	if flow.IsZero() || !flow.RunConflictStrategy.IsValid() {
+		return value_object.DropNewRun
+	}
+	return flow.RunConflictStrategy
+}
+
+// LinedFlowFunctionIDs 连入运行流程（从开始节点能到达）的节点，不包括开始节点
+// 按拓扑序返回，有环时按从开始节点广度优先的顺序返回
 func (flow *Flow) LinedFlowFunctionIDs() []string {
-	if flow == nil {
-		return []string{}
+	graph := flow.Graph()
+	ids, err := graph.TopologicalOrder()
+	if err != nil {
+		ids = graph.Reachable()
+	}
+
+	lined := make([]string, 0, len(ids))
+	for _, flowFuncID := range ids {
+		if flowFuncID != config.FlowFunctionStartID {
+			lined = append(lined, flowFuncID)
+		}
 	}
-	if len(flow.FlowFunctionIDMapFlowFunction[config.FlowFunctionStartID].DownstreamFlowFunctionIDs) == 0 {
-		return []string{}
+	return lined
+}
+
+// LeafFlowFunctionIDs 运行流程中没有下游的节点，按id排序
+func (flow *Flow) LeafFlowFunctionIDs() []string {
+	leafIDs := make([]string, 0, 2)
+	for _, flowFuncID := range flow.LinedFlowFunctionIDs() {
+		if len(flow.FlowFunctionIDMapFlowFunction[flowFuncID].DownstreamFlowFunctionIDs) == 0 {
+			leafIDs = append(leafIDs, flowFuncID)
+		}
 	}
+	sort.Strings(leafIDs)
+	return leafIDs
+}
 
-	ids := make([]string, 0, len(flow.FlowFunctionIDMapFlowFunction)-1)
-	var getNodeDownstreamFlowFunctionIDs func(flowFuncID string, flowFuncIDSlice *[]string)
-	getNodeDownstreamFlowFunctionIDs = func(
-		flowFuncID string, flowFuncIDSlice *[]string,
-	) {
-		flowFunc, ok := flow.FlowFunctionIDMapFlowFunction[flowFuncID]
+// LeafOpt 一次运行中作为flow整体输出的某个opt，由成功运行的末端节点产生
+type LeafOpt struct {
+	FunctionRunRecord *FunctionRunRecord
+	ObjectStorageKey  string
+}
+
+// LeafOpts 收集一次运行中成功运行的末端节点的opt（同名的以排序靠后的节点为准），
+// 被分支条件跳过/被拦截的末端节点没有运行记录，不会被收集
+func (flow *Flow) LeafOpts(
+	flowRunIns *FlowRunRecord,
+	getRunRecord func(id value_object.UUID) (*FunctionRunRecord, error),
+) (map[string]LeafOpt, error) {
+	optKeyMapLeafOpt := make(map[string]LeafOpt)
+	for _, leafID := range flow.LeafFlowFunctionIDs() {
+		funcRunRecordID, ok := flowRunIns.FlowFuncIDMapFuncRunRecordID[leafID]
 		if !ok {
-			return
+			continue
 		}
-		if flowFuncID != config.FlowFunctionStartID {
-			(*flowFuncIDSlice) = append((*flowFuncIDSlice), flowFuncID)
+		leafRecord, err := getRunRecord(funcRunRecordID)
+		if err != nil {
+			return nil, err
+		}
+		if !leafRecord.Finished() || !leafRecord.Suc {
+			continue
+		}
+		for optKey, ossKey := range leafRecord.Opt {
+			ossKeyStr, ok := ossKey.(string)
+			if !ok {
+				continue
+			}
+			optKeyMapLeafOpt[optKey] = LeafOpt{
+				FunctionRunRecord: leafRecord, ObjectStorageKey: ossKeyStr}
+		}
+	}
+	return optKeyMapLeafOpt, nil
+}
+
+// FlowFunctionSkipped 判断某个节点在一次运行中是否被跳过（不需要运行）。
+// 当连向此节点的所有上游边都没有被选中时即为跳过，上游边没有被选中的情况有：
+// 上游节点被跳过、上游节点拦截了其下的运行、上游节点的分支条件没有满足。
+// getRunRecord 返回某个flow_function在此次运行中的运行记录，没有运行记录时返回nil
+func (flow *Flow) FlowFunctionSkipped(
+	flowFunctionID string,
+	getRunRecord func(flowFunctionID string) *FunctionRunRecord,
+) bool {
+	if flow.IsZero() {
+		return false
+	}
+	skippedCache := make(map[string]bool)
+
+	var skipped func(flowFunctionID string) bool
+	skipped = func(flowFunctionID string) bool {
+		if flowFunctionID == config.FlowFunctionStartID {
+			return false
+		}
+		if result, ok := skippedCache[flowFunctionID]; ok {
+			return result
+		}
+		// 先假定为未跳过，防止数据异常时出现环导致无限递归
+		skippedCache[flowFunctionID] = false
+
+		flowFunc, ok := flow.FlowFunctionIDMapFlowFunction[flowFunctionID]
+		if !ok {
+			return false
+		}
+		for _, upID := range flowFunc.UpstreamFlowFunctionIDs {
+			if upID == config.FlowFunctionStartID {
+				return false
+			}
+			upRecord := getRunRecord(upID)
+			if upRecord.IsZero() {
+				if skipped(upID) {
+					continue
+				}
+				return false // 上游还未运行
+			}
+			if !upRecord.Finished() {
+				return false
+			}
+			if upRecord.InterceptBelowFunctionRun || upRecord.SkippedDownstream(flowFunctionID) {
+				continue
+			}
+			return false
+		}
+		skippedCache[flowFunctionID] = true
+		return true
+	}
+	return skipped(flowFunctionID)
+}
+
+// RerunFlowFunctionIDs 从失败处重新运行时需要发布运行的节点
+// 即自身没有沿用的成功记录、且所有上游都是开始节点/已沿用成功记录/被跳过的节点，并且至少有一条连向其的边被选中
+// getSucceededRecord 返回沿用的原运行中某个节点的成功记录，没有时返回nil
+func (flow *Flow) RerunFlowFunctionIDs(
+	getSucceededRecord func(flowFunctionID string) *FunctionRunRecord,
+) []string {
+	ids := make([]string, 0, 2)
+	for _, flowFuncID := range flow.LinedFlowFunctionIDs() {
+		if !getSucceededRecord(flowFuncID).IsZero() {
+			continue
+		}
+
+		allUpstreamSucceeded, selected := true, false
+		for _, upID := range flow.FlowFunctionIDMapFlowFunction[flowFuncID].UpstreamFlowFunctionIDs {
+			if upID == config.FlowFunctionStartID {
+				selected = true
+				continue
+			}
+			upRecord := getSucceededRecord(upID)
+			if upRecord.IsZero() {
+				if flow.FlowFunctionSkipped(upID, getSucceededRecord) { // 上游被分支条件跳过
+					continue
+				}
+				allUpstreamSucceeded = false
+				break
+			}
+			if !upRecord.InterceptBelowFunctionRun && !upRecord.SkippedDownstream(flowFuncID) {
+				selected = true
+			}
 		}
-		for _, downstreamFlowFuncID := range flowFunc.DownstreamFlowFunctionIDs {
-			getNodeDownstreamFlowFunctionIDs(downstreamFlowFuncID, flowFuncIDSlice)
+		if allUpstreamSucceeded && selected {
+			ids = append(ids, flowFuncID)
 		}
 	}
-	getNodeDownstreamFlowFunctionIDs(config.FlowFunctionStartID, &ids)
+	sort.Strings(ids)
 	return ids
 }
 
+// RetryDelay 节点运行失败后是否需要重试及重试前需等待的时长
+// 节点配置了重试策略的，按此节点已运行的次数计算；否则使用flow整体的重试配置，按整个运行记录已重试的次数计算
+func (flow *Flow) RetryDelay(
+	flowFunctionID string,
+	funcRunRecord *FunctionRunRecord,
+	flowRunRecord *FlowRunRecord,
+) (retry bool, delay time.Duration) {
+	flowFunction, ok := flow.FlowFunctionIDMapFlowFunction[flowFunctionID]
+	if ok && flowFunction.RetryPolicy != nil {
+		attempted := funcRunRecord.AttemptedAmount() + 1 // 包含刚失败的这次
+		if !flowFunction.RetryPolicy.ShouldRetry(attempted) {
+			return false, 0
+		}
+		return true, flowFunction.RetryPolicy.Delay(attempted)
+	}
+
+	if !flow.HaveRetryStrategy() || flowRunRecord.RetriedAmount >= flow.RetryAmount {
+		return false, 0
+	}
+	return true, time.Duration(flow.RetryIntervalInSecond) * time.Second
+}
+
 func (flow *Flow) HaveRetryStrategy() bool {
 	if flow.IsZero() {
 		return false
@@ -0,0 +1,179 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// FlowDependency 依赖触发：上游flow运行结束且满足触发条件时，触发此flow运行
+type FlowDependency struct {
+	UpstreamFlowOriginID value_object.UUID
+	On                   []value_object.DependencyTriggerOn
+	OptMappings          []DependencyOptMapping // 为空时不向此flow传递参数
+}
+
+// DependencyOptMapping 上游flow末端节点的某个opt作为此flow哪个节点的哪个参数的覆盖值
+type DependencyOptMapping struct {
+	OptKey         string
+	FlowFunctionID string
+	IptIndex       int
+	ComponentIndex int
+}
+
+// CheckValid flow为配置此依赖的下游flow
+func (fD *FlowDependency) CheckValid(flow *Flow) error {
+	if fD.UpstreamFlowOriginID.IsNil() {
+		return errors.New("upstream_flow_origin_id cannot be blank")
+	}
+	if fD.UpstreamFlowOriginID == flow.OriginID {
+		return errors.New("flow cannot depend on itself")
+	}
+	if len(fD.On) == 0 {
+		return errors.New("must have at least one trigger condition")
+	}
+	for _, on := range fD.On {
+		if !on.IsValid() {
+			return fmt.Errorf("trigger condition「%s」not valid", on)
+		}
+	}
+	for index, mapping := range fD.OptMappings {
+		if mapping.OptKey == "" {
+			return fmt.Errorf("the %dth opt mapping's opt_key cannot be blank", index)
+		}
+		flowFunc, ok := flow.FlowFunctionIDMapFlowFunction[mapping.FlowFunctionID]
+		if !ok {
+			return fmt.Errorf(
+				"the %dth opt mapping's flow_function(%s) not found in flow", index, mapping.FlowFunctionID)
+		}
+		if mapping.IptIndex < 0 || mapping.IptIndex >= len(flowFunc.ParamIpts) {
+			return fmt.Errorf("the %dth opt mapping's ipt index %d out of range", index, mapping.IptIndex)
+		}
+		if mapping.ComponentIndex < 0 ||
+			mapping.ComponentIndex >= len(flowFunc.ParamIpts[mapping.IptIndex]) {
+			return fmt.Errorf(
+				"the %dth opt mapping's component index %d out of range", index, mapping.ComponentIndex)
+		}
+	}
+	return nil
+}
+
+// Triggered 上游flow以upstreamStatus结束时是否需要触发此flow
+func (fD *FlowDependency) Triggered(upstreamStatus value_object.RunState) bool {
+	for _, on := range fD.On {
+		if on.Matched(upstreamStatus) {
+			return true
+		}
+	}
+	return false
+}
+
+// OverideIptParams 将上游flow的opt按照OptMappings转换为此flow运行时的覆盖参数
+func (fD *FlowDependency) OverideIptParams(
+	optKeyMapValue map[string]interface{},
+) map[string][][]interface{} {
+	if len(fD.OptMappings) == 0 {
+		return nil
+	}
+	params := make(map[string][][]interface{})
+	for _, mapping := range fD.OptMappings {
+		value, ok := optKeyMapValue[mapping.OptKey]
+		if !ok || value == nil {
+			continue
+		}
+		param := params[mapping.FlowFunctionID]
+		for len(param) <= mapping.IptIndex {
+			param = append(param, []interface{}{})
+		}
+		// 没有覆盖值的位置为nil，运行时会使用节点自身的配置
+		for len(param[mapping.IptIndex]) <= mapping.ComponentIndex {
+			param[mapping.IptIndex] = append(param[mapping.IptIndex], nil)
+		}
+		param[mapping.IptIndex][mapping.ComponentIndex] = value
+		params[mapping.FlowFunctionID] = param
+	}
+	return params
+}
+
+// MatchedDependency 上游flow(upstreamFlowOriginID)以upstreamStatus结束时满足的依赖，没有时返回nil
+func (flow *Flow) MatchedDependency(
+	upstreamFlowOriginID value_object.UUID, upstreamStatus value_object.RunState,
+) *FlowDependency {
+	if flow.IsZero() {
+		return nil
+	}
+	for _, dependency := range flow.Dependencies {
+		if dependency.UpstreamFlowOriginID == upstreamFlowOriginID &&
+			dependency.Triggered(upstreamStatus) {
+			return dependency
+		}
+	}
+	return nil
+}
+
+// CheckDependencies 检查要设置到此flow的依赖是否有效：上游flow需已上线，且flow之间的依赖不能成环
+func (flow *Flow) CheckDependencies(
+	dependencies []*FlowDependency,
+	getOnlineFlow func(originID value_object.UUID) (*Flow, error),
+) error {
+	upstreamOriginIDs := make(map[value_object.UUID]bool, len(dependencies))
+	for _, dependency := range dependencies {
+		if err := dependency.CheckValid(flow); err != nil {
+			return err
+		}
+		if upstreamOriginIDs[dependency.UpstreamFlowOriginID] {
+			return fmt.Errorf(
+				"upstream flow(origin_id: %s) depended more than once", dependency.UpstreamFlowOriginID)
+		}
+		upstreamOriginIDs[dependency.UpstreamFlowOriginID] = true
+
+		upstreamFlow, err := getOnlineFlow(dependency.UpstreamFlowOriginID)
+		if err != nil {
+			return err
+		}
+		if upstreamFlow.IsZero() {
+			return fmt.Errorf("no online flow of origin_id: %s", dependency.UpstreamFlowOriginID)
+		}
+		cycled, err := upstreamFlow.dependsOn(
+			flow.OriginID, map[value_object.UUID]bool{}, getOnlineFlow)
+		if err != nil {
+			return err
+		}
+		if cycled {
+			return fmt.Errorf(
+				"upstream flow「%s」directly or indirectly depends on this flow, dependencies cannot be cycled",
+				upstreamFlow.Name)
+		}
+	}
+	return nil
+}
+
+// dependsOn 此flow是否直接或间接地依赖了originID对应的flow
+func (flow *Flow) dependsOn(
+	originID value_object.UUID,
+	visited map[value_object.UUID]bool,
+	getOnlineFlow func(originID value_object.UUID) (*Flow, error),
+) (bool, error) {
+	visited[flow.OriginID] = true
+	for _, dependency := range flow.Dependencies {
+		if dependency.UpstreamFlowOriginID == originID {
+			return true, nil
+		}
+		if visited[dependency.UpstreamFlowOriginID] {
+			continue
+		}
+		upstreamFlow, err := getOnlineFlow(dependency.UpstreamFlowOriginID)
+		if err != nil {
+			return false, err
+		}
+		if upstreamFlow.IsZero() { // 上游已下线的依赖不会再被触发
+			continue
+		}
+		cycled, err := upstreamFlow.dependsOn(originID, visited, getOnlineFlow)
+		if err != nil || cycled {
+			return cycled, err
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,139 @@
+package aggregate
+
+import (
+	"testing"
+
+	"github.com/fBloc/bloc-server/value_object"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newDependencyTestFlow(dependencies ...*FlowDependency) *Flow {
+	return &Flow{
+		ID:       value_object.NewUUID(),
+		OriginID: value_object.NewUUID(),
+		FlowFunctionIDMapFlowFunction: map[string]*FlowFunction{
+			"f1": {ParamIpts: [][]IptComponentConfig{{{}, {}}}},
+		},
+		Dependencies: dependencies,
+	}
+}
+
+func TestFlowDependencyCheckValid(t *testing.T) {
+	flowIns := newDependencyTestFlow()
+
+	Convey("valid", t, func() {
+		dependency := &FlowDependency{
+			UpstreamFlowOriginID: value_object.NewUUID(),
+			On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnSuc},
+			OptMappings: []DependencyOptMapping{
+				{OptKey: "result", FlowFunctionID: "f1", IptIndex: 0, ComponentIndex: 1}},
+		}
+		So(dependency.CheckValid(flowIns), ShouldBeNil)
+	})
+
+	Convey("invalid", t, func() {
+		So((&FlowDependency{
+			On: []value_object.DependencyTriggerOn{value_object.DependencyOnSuc},
+		}).CheckValid(flowIns), ShouldNotBeNil)
+		So((&FlowDependency{
+			UpstreamFlowOriginID: flowIns.OriginID,
+			On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnSuc},
+		}).CheckValid(flowIns), ShouldNotBeNil)
+		So((&FlowDependency{
+			UpstreamFlowOriginID: value_object.NewUUID(),
+		}).CheckValid(flowIns), ShouldNotBeNil)
+		So((&FlowDependency{
+			UpstreamFlowOriginID: value_object.NewUUID(),
+			On:                   []value_object.DependencyTriggerOn{"unknown"},
+		}).CheckValid(flowIns), ShouldNotBeNil)
+		So((&FlowDependency{
+			UpstreamFlowOriginID: value_object.NewUUID(),
+			On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnSuc},
+			OptMappings:          []DependencyOptMapping{{OptKey: "result", FlowFunctionID: "f2"}},
+		}).CheckValid(flowIns), ShouldNotBeNil)
+		So((&FlowDependency{
+			UpstreamFlowOriginID: value_object.NewUUID(),
+			On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnSuc},
+			OptMappings: []DependencyOptMapping{
+				{OptKey: "result", FlowFunctionID: "f1", ComponentIndex: 2}},
+		}).CheckValid(flowIns), ShouldNotBeNil)
+	})
+}
+
+func TestFlowDependencyTrigger(t *testing.T) {
+	upstreamOriginID := value_object.NewUUID()
+	flowIns := newDependencyTestFlow(&FlowDependency{
+		UpstreamFlowOriginID: upstreamOriginID,
+		On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnSuc},
+		OptMappings: []DependencyOptMapping{
+			{OptKey: "result", FlowFunctionID: "f1", IptIndex: 0, ComponentIndex: 1}},
+	})
+
+	Convey("matched dependency", t, func() {
+		So(flowIns.MatchedDependency(upstreamOriginID, value_object.Suc), ShouldNotBeNil)
+		So(flowIns.MatchedDependency(upstreamOriginID, value_object.InterceptedCancel), ShouldNotBeNil)
+		So(flowIns.MatchedDependency(upstreamOriginID, value_object.Fail), ShouldBeNil)
+		So(flowIns.MatchedDependency(upstreamOriginID, value_object.UserCanceled), ShouldBeNil)
+		So(flowIns.MatchedDependency(value_object.NewUUID(), value_object.Suc), ShouldBeNil)
+	})
+
+	Convey("overide ipt params", t, func() {
+		params := flowIns.Dependencies[0].OverideIptParams(map[string]interface{}{"result": 3.0})
+		So(params, ShouldResemble, map[string][][]interface{}{"f1": {{nil, 3.0}}})
+
+		params = flowIns.Dependencies[0].OverideIptParams(map[string]interface{}{"other": 3.0})
+		So(len(params), ShouldEqual, 0)
+	})
+}
+
+func TestFlowCheckDependencies(t *testing.T) {
+	flowA := newDependencyTestFlow()
+	flowB := newDependencyTestFlow(&FlowDependency{
+		UpstreamFlowOriginID: flowA.OriginID,
+		On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnSuc}})
+	flowC := newDependencyTestFlow(&FlowDependency{
+		UpstreamFlowOriginID: flowB.OriginID,
+		On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnFail}})
+	originIDMapFlow := map[value_object.UUID]*Flow{
+		flowA.OriginID: flowA, flowB.OriginID: flowB, flowC.OriginID: flowC}
+	getOnlineFlow := func(originID value_object.UUID) (*Flow, error) {
+		return originIDMapFlow[originID], nil
+	}
+
+	Convey("no cycle", t, func() {
+		err := flowC.CheckDependencies(flowC.Dependencies, getOnlineFlow)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("direct cycle", t, func() {
+		err := flowA.CheckDependencies([]*FlowDependency{{
+			UpstreamFlowOriginID: flowB.OriginID,
+			On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnSuc}},
+		}, getOnlineFlow)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("indirect cycle", t, func() {
+		err := flowA.CheckDependencies([]*FlowDependency{{
+			UpstreamFlowOriginID: flowC.OriginID,
+			On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnSuc}},
+		}, getOnlineFlow)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("upstream not online", t, func() {
+		err := flowA.CheckDependencies([]*FlowDependency{{
+			UpstreamFlowOriginID: value_object.NewUUID(),
+			On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnSuc}},
+		}, getOnlineFlow)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("duplicated upstream", t, func() {
+		dependency := &FlowDependency{
+			UpstreamFlowOriginID: flowA.OriginID,
+			On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnSuc}}
+		err := flowC.CheckDependencies([]*FlowDependency{dependency, dependency}, getOnlineFlow)
+		So(err, ShouldNotBeNil)
+	})
+}
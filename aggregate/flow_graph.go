@@ -0,0 +1,239 @@
+package aggregate
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fBloc/bloc-server/config"
+)
+
+// CycleError flow中的节点沿下游连线形成了环，Path为首尾相同的节点id路径
+type CycleError struct {
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return "flow functions form a cycle: " + strings.Join(e.Path, " -> ")
+}
+
+// FlowGraph 由flow中节点的下游连线构成的有向图，连向不存在节点的连线被忽略
+type FlowGraph struct {
+	flowFuncIDs []string // 按id排序，保证遍历结果稳定
+	nodes       map[string]bool
+	downstreams map[string][]string
+}
+
+// Graph 以当前节点配置生成有向图，节点配置变更后需要重新生成
+func (flow *Flow) Graph() *FlowGraph {
+	graph := &FlowGraph{nodes: make(map[string]bool), downstreams: make(map[string][]string)}
+	if flow == nil {
+		return graph
+	}
+	for flowFuncID, flowFunc := range flow.FlowFunctionIDMapFlowFunction {
+		graph.flowFuncIDs = append(graph.flowFuncIDs, flowFuncID)
+		graph.nodes[flowFuncID] = true
+		seen := make(map[string]bool, len(flowFunc.DownstreamFlowFunctionIDs))
+		for _, downID := range flowFunc.DownstreamFlowFunctionIDs {
+			if _, ok := flow.FlowFunctionIDMapFlowFunction[downID]; !ok || seen[downID] {
+				continue
+			}
+			seen[downID] = true
+			graph.downstreams[flowFuncID] = append(graph.downstreams[flowFuncID], downID)
+		}
+	}
+	sort.Strings(graph.flowFuncIDs)
+	return graph
+}
+
+// Cycles 图中所有的环，每个环以首尾相同的节点id路径返回
+func (g *FlowGraph) Cycles() [][]string {
+	return g.cyclesFrom(g.flowFuncIDs)
+}
+
+// cyclesFrom 从给定的节点出发沿下游连线深度优先遍历找出遇到的环
+func (g *FlowGraph) cyclesFrom(roots []string) [][]string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(g.flowFuncIDs))
+	var path []string
+	var cycles [][]string
+	var visit func(flowFuncID string)
+	visit = func(flowFuncID string) {
+		state[flowFuncID] = visiting
+		path = append(path, flowFuncID)
+		for _, downID := range g.downstreams[flowFuncID] {
+			switch state[downID] {
+			case unvisited:
+				visit(downID)
+			case visiting:
+				for i := len(path) - 1; i >= 0; i-- {
+					if path[i] == downID {
+						cycles = append(cycles, append(append([]string{}, path[i:]...), downID))
+						break
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[flowFuncID] = visited
+	}
+	for _, flowFuncID := range roots {
+		if g.nodes[flowFuncID] && state[flowFuncID] == unvisited {
+			visit(flowFuncID)
+		}
+	}
+	return cycles
+}
+
+// Reachable 从开始节点沿下游连线能到达的节点（包括开始节点），按广度优先的顺序
+func (g *FlowGraph) Reachable() []string {
+	if !g.nodes[config.FlowFunctionStartID] {
+		return []string{}
+	}
+	reached := map[string]bool{config.FlowFunctionStartID: true}
+	ids := []string{config.FlowFunctionStartID}
+	for i := 0; i < len(ids); i++ {
+		for _, downID := range g.downstreams[ids[i]] {
+			if !reached[downID] {
+				reached[downID] = true
+				ids = append(ids, downID)
+			}
+		}
+	}
+	return ids
+}
+
+// TopologicalOrder 从开始节点能到达的节点（包括开始节点）的拓扑序，同时可运行的节点按id排序
+// 能到达的节点中存在环时返回*CycleError
+func (g *FlowGraph) TopologicalOrder() ([]string, error) {
+	if cycles := g.cyclesFrom([]string{config.FlowFunctionStartID}); len(cycles) > 0 {
+		return nil, &CycleError{Path: cycles[0]}
+	}
+
+	reachable := g.Reachable()
+	inDegree := make(map[string]int, len(reachable))
+	for _, flowFuncID := range reachable {
+		for _, downID := range g.downstreams[flowFuncID] {
+			inDegree[downID]++
+		}
+	}
+	order := make([]string, 0, len(reachable))
+	ready := make([]string, 0, len(reachable))
+	for _, flowFuncID := range reachable {
+		if inDegree[flowFuncID] == 0 {
+			ready = append(ready, flowFuncID)
+		}
+	}
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		flowFuncID := ready[0]
+		ready = ready[1:]
+		order = append(order, flowFuncID)
+		for _, downID := range g.downstreams[flowFuncID] {
+			inDegree[downID]--
+			if inDegree[downID] == 0 {
+				ready = append(ready, downID)
+			}
+		}
+	}
+	return order, nil
+}
+
+// Depths 节点所在的深度：开始节点为0，其余节点为从开始节点到其的最长路径的边数
+// 即节点最早可以在第几层运行
+func (g *FlowGraph) Depths() (map[string]int, error) {
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+	depths := make(map[string]int, len(order))
+	for _, flowFuncID := range order {
+		depths[flowFuncID] = 0
+	}
+	for _, flowFuncID := range order {
+		for _, downID := range g.downstreams[flowFuncID] {
+			if depths[flowFuncID]+1 > depths[downID] {
+				depths[downID] = depths[flowFuncID] + 1
+			}
+		}
+	}
+	return depths, nil
+}
+
+// Levels 按深度分层的节点，第0层只有开始节点，每层内按id排序
+func (g *FlowGraph) Levels() ([][]string, error) {
+	depths, err := g.Depths()
+	if err != nil {
+		return nil, err
+	}
+	levels := make([][]string, 0)
+	for flowFuncID, depth := range depths {
+		for len(levels) <= depth {
+			levels = append(levels, []string{})
+		}
+		levels[depth] = append(levels[depth], flowFuncID)
+	}
+	for _, level := range levels {
+		sort.Strings(level)
+	}
+	return levels, nil
+}
+
+// CriticalPath 以各节点的耗时为权重，从开始节点出发耗时最长的路径及其总耗时
+// 路径中不包含开始节点，durations中没有的节点耗时视为0
+func (g *FlowGraph) CriticalPath(
+	durations map[string]time.Duration,
+) ([]string, time.Duration, error) {
+	order, err := g.TopologicalOrder()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// 到达每个节点（包括其自身耗时）的最长耗时及此路径上的前一个节点
+	costs := make(map[string]time.Duration, len(order))
+	previous := make(map[string]string, len(order))
+	var end string
+	for _, flowFuncID := range order {
+		if flowFuncID != config.FlowFunctionStartID {
+			costs[flowFuncID] += durations[flowFuncID]
+		}
+		if end == "" || costs[flowFuncID] > costs[end] {
+			end = flowFuncID
+		}
+		for _, downID := range g.downstreams[flowFuncID] {
+			if _, ok := previous[downID]; !ok || costs[flowFuncID] > costs[downID] {
+				costs[downID] = costs[flowFuncID]
+				previous[downID] = flowFuncID
+			}
+		}
+	}
+
+	path := make([]string, 0)
+	for flowFuncID := end; flowFuncID != "" && flowFuncID != config.FlowFunctionStartID; flowFuncID = previous[flowFuncID] {
+		path = append([]string{flowFuncID}, path...)
+	}
+	return path, costs[end], nil
+}
+
+// FlowFunctionAverageDurations 根据历史运行记录计算各节点的平均耗时
+// 只统计有开始及结束时间的记录，map模式的子记录由其父记录统计
+func FlowFunctionAverageDurations(records []*FunctionRunRecord) map[string]time.Duration {
+	totals := make(map[string]time.Duration)
+	counts := make(map[string]int64)
+	for _, record := range records {
+		if record.IsZero() || record.IsMapChild() || record.Start.IsZero() || record.End.IsZero() {
+			continue
+		}
+		totals[record.FlowFunctionID] += record.End.Sub(record.Start)
+		counts[record.FlowFunctionID]++
+	}
+	averages := make(map[string]time.Duration, len(totals))
+	for flowFuncID, total := range totals {
+		averages[flowFuncID] = total / time.Duration(counts[flowFuncID])
+	}
+	return averages
+}
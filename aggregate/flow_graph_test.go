@@ -0,0 +1,136 @@
+package aggregate
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/value_object"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newGraphTestFlow start -> a -> (b | c) -> d，以及没有连入的e
+func newGraphTestFlow() *Flow {
+	return &Flow{
+		ID: value_object.NewUUID(),
+		FlowFunctionIDMapFlowFunction: map[string]*FlowFunction{
+			config.FlowFunctionStartID: {DownstreamFlowFunctionIDs: []string{"a"}},
+			"a": {
+				UpstreamFlowFunctionIDs:   []string{config.FlowFunctionStartID},
+				DownstreamFlowFunctionIDs: []string{"b", "c"},
+			},
+			"b": {UpstreamFlowFunctionIDs: []string{"a"}, DownstreamFlowFunctionIDs: []string{"d"}},
+			"c": {UpstreamFlowFunctionIDs: []string{"a"}, DownstreamFlowFunctionIDs: []string{"d"}},
+			"d": {UpstreamFlowFunctionIDs: []string{"b", "c"}},
+			"e": {},
+		},
+	}
+}
+
+func TestFlowGraph(t *testing.T) {
+	Convey("diamond", t, func() {
+		flow := newGraphTestFlow()
+		graph := flow.Graph()
+		So(graph.Cycles(), ShouldBeEmpty)
+
+		order, err := graph.TopologicalOrder()
+		So(err, ShouldBeNil)
+		So(order, ShouldResemble, []string{config.FlowFunctionStartID, "a", "b", "c", "d"})
+		So(flow.LinedFlowFunctionIDs(), ShouldResemble, []string{"a", "b", "c", "d"})
+		So(flow.LeafFlowFunctionIDs(), ShouldResemble, []string{"d"})
+
+		depths, err := graph.Depths()
+		So(err, ShouldBeNil)
+		So(depths, ShouldResemble, map[string]int{
+			config.FlowFunctionStartID: 0, "a": 1, "b": 2, "c": 2, "d": 3})
+		levels, err := graph.Levels()
+		So(err, ShouldBeNil)
+		So(levels, ShouldResemble, [][]string{
+			{config.FlowFunctionStartID}, {"a"}, {"b", "c"}, {"d"}})
+	})
+
+	Convey("depth is the longest path", t, func() {
+		flow := newGraphTestFlow()
+		// a直接连向d，d的深度仍由a -> b -> d决定
+		flow.FlowFunctionIDMapFlowFunction["a"].DownstreamFlowFunctionIDs = []string{"b", "c", "d"}
+		depths, err := flow.Graph().Depths()
+		So(err, ShouldBeNil)
+		So(depths["d"], ShouldEqual, 3)
+	})
+
+	Convey("critical path", t, func() {
+		graph := newGraphTestFlow().Graph()
+		path, duration, err := graph.CriticalPath(map[string]time.Duration{
+			"a": time.Second, "b": time.Second, "c": 3 * time.Second, "d": time.Second})
+		So(err, ShouldBeNil)
+		So(path, ShouldResemble, []string{"a", "c", "d"})
+		So(duration, ShouldEqual, 5*time.Second)
+
+		path, duration, err = graph.CriticalPath(nil)
+		So(err, ShouldBeNil)
+		So(duration, ShouldEqual, 0)
+		So(path, ShouldBeEmpty)
+	})
+
+	Convey("cycle", t, func() {
+		flow := newGraphTestFlow()
+		flow.FlowFunctionIDMapFlowFunction["d"].DownstreamFlowFunctionIDs = []string{"a"}
+		flow.FlowFunctionIDMapFlowFunction["a"].UpstreamFlowFunctionIDs = []string{
+			config.FlowFunctionStartID, "d"}
+		graph := flow.Graph()
+		So(graph.Cycles(), ShouldResemble, [][]string{{"a", "b", "d", "a"}})
+
+		_, err := graph.TopologicalOrder()
+		var cycleErr *CycleError
+		So(errors.As(err, &cycleErr), ShouldBeTrue)
+		So(cycleErr.Path, ShouldResemble, []string{"a", "b", "d", "a"})
+		_, err = graph.Depths()
+		So(err, ShouldNotBeNil)
+		_, _, err = graph.CriticalPath(nil)
+		So(err, ShouldNotBeNil)
+
+		// 有环时不会无限递归
+		So(flow.LinedFlowFunctionIDs(), ShouldResemble, []string{"a", "b", "c", "d"})
+		So(flow.FlowFunctionIDMapFlowFunction["a"].AllUpstreamFlowFunctionIDsMap(
+			flow.FlowFunctionIDMapFlowFunction), ShouldContainKey, "b")
+	})
+
+	Convey("cycle not reachable from start", t, func() {
+		flow := newGraphTestFlow()
+		flow.FlowFunctionIDMapFlowFunction["e"].DownstreamFlowFunctionIDs = []string{"e"}
+		graph := flow.Graph()
+		So(graph.Cycles(), ShouldResemble, [][]string{{"e", "e"}})
+		_, err := graph.TopologicalOrder()
+		So(err, ShouldBeNil)
+	})
+
+	Convey("missing start", t, func() {
+		flow := &Flow{FlowFunctionIDMapFlowFunction: map[string]*FlowFunction{"a": {}}}
+		So(flow.LinedFlowFunctionIDs(), ShouldBeEmpty)
+	})
+}
+
+func TestFlowFunctionAverageDurations(t *testing.T) {
+	now := time.Now()
+	record := func(flowFunctionID string, duration time.Duration) *FunctionRunRecord {
+		return &FunctionRunRecord{
+			ID:             value_object.NewUUID(),
+			FlowFunctionID: flowFunctionID,
+			Start:          now,
+			End:            now.Add(duration),
+		}
+	}
+
+	Convey("average", t, func() {
+		notFinished := record("b", time.Second)
+		notFinished.End = time.Time{}
+		mapChild := record("a", time.Hour)
+		mapChild.MapParentID = value_object.NewUUID()
+
+		averages := FlowFunctionAverageDurations([]*FunctionRunRecord{
+			record("a", time.Second), record("a", 3*time.Second), notFinished, mapChild, nil})
+		So(averages, ShouldResemble, map[string]time.Duration{"a": 2 * time.Second})
+	})
+}
@@ -0,0 +1,62 @@
+package aggregate
+
+import (
+	"time"
+
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// FlowLock 限制并发运行数的flow(以origin_id区分)的分布式锁，持有者为正在运行的flow运行记录。
+// 最大并发运行数为N的flow有N个槽位(Slot 0~N-1)，每个槽位一把锁。
+// 锁有过期时间，需持有期间不断续期；Version在每次被获取时递增，
+// 续期、释放都以获取时的版本做条件更新，避免锁过期后被重新获取时旧的持有者误操作锁。
+// 持有者记录获取到的版本(FlowRunRecord.FlowLockVersion)，开始运行、发布function运行、
+// 成功/失败等状态变更前需以此版本确认仍持有锁，已被取代或锁已过期的运行不能再推进
+type FlowLock struct {
+	FlowOriginID value_object.UUID
+	Slot         int
+	HolderID     value_object.UUID // 持有锁的flow_run_record_id，释放后为空
+	Version      uint64
+	ExpireTime   time.Time
+}
+
+func (fL *FlowLock) IsZero() bool {
+	if fL == nil {
+		return true
+	}
+	return fL.FlowOriginID.IsNil()
+}
+
+// IsHeldAt 在某个时间点是否被持有中
+func (fL *FlowLock) IsHeldAt(t time.Time) bool {
+	if fL.IsZero() {
+		return false
+	}
+	return !fL.HolderID.IsNil() && fL.ExpireTime.After(t)
+}
+
+// IsHeldBy 是否正被某个flow运行记录持有中
+func (fL *FlowLock) IsHeldBy(flowRunRecordID value_object.UUID) bool {
+	return fL.IsHeldAt(time.Now()) && fL.HolderID == flowRunRecordID
+}
+
+// IsHeldByVersion 在某个时间点是否仍被某个flow运行记录以某个版本持有中
+func (fL *FlowLock) IsHeldByVersion(
+	flowRunRecordID value_object.UUID, version uint64, t time.Time,
+) bool {
+	return fL.IsHeldAt(t) && fL.HolderID == flowRunRecordID && fL.Version == version
+}
+
+// FlowRunHoldsLock flow运行记录是否仍以其获取时的版本持有其中某个槽位的锁。
+// 没有获取过锁的运行(flow未限制并发运行数、或在限制前已开始运行)不做校验
+func FlowRunHoldsLock(locks []*FlowLock, flowRunIns *FlowRunRecord, t time.Time) bool {
+	if flowRunIns.FlowLockVersion == 0 {
+		return true
+	}
+	for _, lock := range locks {
+		if lock.IsHeldByVersion(flowRunIns.ID, flowRunIns.FlowLockVersion, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/value_object"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFlowLock(t *testing.T) {
+	holderID := value_object.NewUUID()
+	now := time.Now()
+
+	Convey("zero", t, func() {
+		var nilLock *FlowLock = nil
+		So(nilLock.IsZero(), ShouldBeTrue)
+		So(nilLock.IsHeldAt(now), ShouldBeFalse)
+		So(nilLock.IsHeldBy(holderID), ShouldBeFalse)
+	})
+
+	Convey("held", t, func() {
+		lock := FlowLock{
+			FlowOriginID: value_object.NewUUID(),
+			HolderID:     holderID,
+			Version:      1,
+			ExpireTime:   now.Add(time.Minute)}
+		So(lock.IsHeldAt(now), ShouldBeTrue)
+		So(lock.IsHeldBy(holderID), ShouldBeTrue)
+		So(lock.IsHeldBy(value_object.NewUUID()), ShouldBeFalse)
+
+		Convey("expired", func() {
+			So(lock.IsHeldAt(now.Add(2*time.Minute)), ShouldBeFalse)
+		})
+
+		Convey("released", func() {
+			lock.HolderID = value_object.NillUUID
+			So(lock.IsHeldAt(now), ShouldBeFalse)
+		})
+	})
+	Convey("held by version", t, func() {
+		flowRunIns := &FlowRunRecord{ID: holderID, FlowLockVersion: 2}
+		lock := &FlowLock{
+			FlowOriginID: value_object.NewUUID(),
+			HolderID:     holderID,
+			Version:      2,
+			ExpireTime:   now.Add(time.Minute)}
+		So(lock.IsHeldByVersion(holderID, 2, now), ShouldBeTrue)
+		So(FlowRunHoldsLock([]*FlowLock{lock}, flowRunIns, now), ShouldBeTrue)
+
+		Convey("expired", func() {
+			So(FlowRunHoldsLock([]*FlowLock{lock}, flowRunIns, now.Add(2*time.Minute)), ShouldBeFalse)
+		})
+
+		Convey("reacquired with newer version", func() {
+			lock.Version = 3
+			So(FlowRunHoldsLock([]*FlowLock{lock}, flowRunIns, now), ShouldBeFalse)
+		})
+
+		Convey("taken by other holder", func() {
+			lock.HolderID = value_object.NewUUID()
+			So(FlowRunHoldsLock([]*FlowLock{lock}, flowRunIns, now), ShouldBeFalse)
+		})
+
+		Convey("run never acquired lock", func() {
+			So(FlowRunHoldsLock(nil, &FlowRunRecord{ID: holderID}, now), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,184 @@
+package aggregate
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/fBloc/bloc-server/pkg/value_type"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+var flowParamNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// FlowParam flow级别的具名输入参数，节点的component可以以flow_param方式绑定到此参数
+// 触发运行时以 {name: value} 提供参数值，没有提供的使用默认值
+type FlowParam struct {
+	Name         string
+	Description  string
+	ValueType    value_type.ValueType
+	Required     bool        // 没有默认值时，触发运行必须提供此参数的值
+	DefaultValue interface{} // nil表示没有默认值
+}
+
+func (fP *FlowParam) CheckValid() error {
+	if !flowParamNameRegexp.MatchString(fP.Name) {
+		return fmt.Errorf("param name「%s」not valid, only letters, digits and underscore allowed", fP.Name)
+	}
+	if !fP.ValueType.IsValid() {
+		return fmt.Errorf("param「%s」value type「%s」not valid", fP.Name, fP.ValueType)
+	}
+	if fP.DefaultValue != nil && !value_type.CheckValueTypeValueValid(fP.ValueType, fP.DefaultValue) {
+		return fmt.Errorf(
+			"param「%s」default value %v not match value type %s",
+			fP.Name, fP.DefaultValue, fP.ValueType)
+	}
+	return nil
+}
+
+// ParamByName 获取名为name的flow参数，不存在时返回nil
+func (flow *Flow) ParamByName(name string) *FlowParam {
+	for _, param := range flow.Params {
+		if param.Name == name {
+			return param
+		}
+	}
+	return nil
+}
+
+// CheckParamsValid 检测flow参数的定义，及运行流程内的节点对flow参数的绑定是否有效
+func (flow *Flow) CheckParamsValid() error {
+	names := make(map[string]struct{}, len(flow.Params))
+	for _, param := range flow.Params {
+		if err := param.CheckValid(); err != nil {
+			return err
+		}
+		if _, ok := names[param.Name]; ok {
+			return fmt.Errorf("duplicate param name「%s」", param.Name)
+		}
+		names[param.Name] = struct{}{}
+	}
+
+	for _, flowFuncID := range flow.LinedFlowFunctionIDs() {
+		flowFunc := flow.FlowFunctionIDMapFlowFunction[flowFuncID]
+		for iptIndex, iptParamConfig := range flowFunc.ParamIpts {
+			for componentIndex, componentParamConfig := range iptParamConfig {
+				if componentParamConfig.IptWay != value_object.FlowParam {
+					continue
+				}
+				param := flow.ParamByName(componentParamConfig.Key)
+				if param == nil {
+					return fmt.Errorf(
+						"「%s」节点第%d个ipt下的第%d个component绑定的flow参数「%s」不存在",
+						flowFunc.Name(), iptIndex, componentIndex, componentParamConfig.Key)
+				}
+				// 以function声明的component类型为准，而不是草稿中记录的类型
+				component := flowFunc.Function.IptComponent(iptIndex, componentIndex)
+				if component == nil {
+					continue
+				}
+				if !value_type.Connectable(param.ValueType, component.ValueType) {
+					return fmt.Errorf(
+						"「%s」节点第%d个ipt下的第%d个component需要%s类型，绑定的flow参数「%s」是%s类型",
+						flowFunc.Name(), iptIndex, componentIndex,
+						component.ValueType, param.Name, param.ValueType)
+				}
+				// enum类型的component，参数的默认值需要在其可选值内
+				if param.DefaultValue != nil && !component.ValueAllowed(param.DefaultValue) {
+					return fmt.Errorf(
+						"「%s」节点第%d个ipt下的第%d个component的可选值为%v，绑定的flow参数「%s」的默认值%v不在其中",
+						flowFunc.Name(), iptIndex, componentIndex,
+						component.AllowedValues, param.Name, param.DefaultValue)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ResolveParams 检测触发运行时提供的参数值，并补充上没有提供值的参数的默认值，得到此次运行的参数值
+// 参数值还需要满足绑定的component的可选值及json schema，需要先将节点对应的function赋值到FlowFunction.Function
+func (flow *Flow) ResolveParams(values map[string]interface{}) (map[string]interface{}, error) {
+	for name, value := range values {
+		param := flow.ParamByName(name)
+		if param == nil {
+			return nil, fmt.Errorf("flow have no param「%s」", name)
+		}
+		if !value_type.CheckValueTypeValueValid(param.ValueType, value) {
+			return nil, fmt.Errorf(
+				"param「%s」value %v not match value type %s", name, value, param.ValueType)
+		}
+	}
+
+	if len(flow.Params) == 0 {
+		return nil, nil
+	}
+	resolved := make(map[string]interface{}, len(flow.Params))
+	var missed []string
+	for _, param := range flow.Params {
+		if value, ok := values[param.Name]; ok && value != nil {
+			resolved[param.Name] = value
+			continue
+		}
+		if param.DefaultValue != nil {
+			resolved[param.Name] = param.DefaultValue
+			continue
+		}
+		if param.Required {
+			missed = append(missed, param.Name)
+		}
+	}
+	if len(missed) > 0 {
+		return nil, fmt.Errorf("lack required params: %v", missed)
+	}
+	for _, param := range flow.Params {
+		if value, ok := resolved[param.Name]; ok {
+			if err := flow.checkParamValueAllowed(param.Name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// checkParamValueAllowed 参数值是否满足运行流程内绑定了此参数的各component的可选值及json schema
+func (flow *Flow) checkParamValueAllowed(name string, value interface{}) error {
+	for _, flowFuncID := range flow.LinedFlowFunctionIDs() {
+		flowFunc := flow.FlowFunctionIDMapFlowFunction[flowFuncID]
+		for iptIndex, iptParamConfig := range flowFunc.ParamIpts {
+			for componentIndex, componentParamConfig := range iptParamConfig {
+				if componentParamConfig.IptWay != value_object.FlowParam ||
+					componentParamConfig.Key != name {
+					continue
+				}
+				component := flowFunc.Function.IptComponent(iptIndex, componentIndex)
+				if component == nil {
+					continue
+				}
+				if !component.ValueAllowed(value) {
+					return fmt.Errorf(
+						"param「%s」value %v not in「%s」节点第%d个ipt下的第%d个component的可选值%v内",
+						name, value, flowFunc.Name(), iptIndex, componentIndex, component.AllowedValues)
+				}
+				if err := component.ValidateJsonSchema(value); err != nil {
+					return fmt.Errorf(
+						"param「%s」value not match「%s」节点第%d个ipt下的第%d个component的json schema: %w",
+						name, flowFunc.Name(), iptIndex, componentIndex, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ParamValue 运行时节点绑定的flow参数的值，此次运行没有提供的使用参数的默认值
+// (如crontab、依赖触发等没有经过ResolveParams的运行)
+func (flow *Flow) ParamValue(name string, runParams map[string]interface{}) interface{} {
+	if value, ok := runParams[name]; ok {
+		return value
+	}
+	param := flow.ParamByName(name)
+	if param == nil {
+		return nil
+	}
+	return param.DefaultValue
+}
@@ -0,0 +1,194 @@
+package aggregate
+
+import (
+	"testing"
+
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+	"github.com/fBloc/bloc-server/value_object"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newParamTestFlow 节点的function声明的component类型与草稿中记录的一致
+func newParamTestFlow(component IptComponentConfig, params ...*FlowParam) *Flow {
+	return newParamTestFlowWithComponent(
+		component, &ipt.IptComponent{ValueType: component.ValueType}, params...)
+}
+
+func newParamTestFlowWithComponent(
+	component IptComponentConfig, declared *ipt.IptComponent, params ...*FlowParam,
+) *Flow {
+	return &Flow{
+		ID:       value_object.NewUUID(),
+		OriginID: value_object.NewUUID(),
+		FlowFunctionIDMapFlowFunction: map[string]*FlowFunction{
+			config.FlowFunctionStartID: {DownstreamFlowFunctionIDs: []string{"f1"}},
+			"f1": {
+				UpstreamFlowFunctionIDs: []string{config.FlowFunctionStartID},
+				ParamIpts:               [][]IptComponentConfig{{component}},
+				Function: &Function{
+					Ipts: ipt.IptSlice{{Components: []*ipt.IptComponent{declared}}}},
+			},
+		},
+		Params: params,
+	}
+}
+
+func TestFlowParamCheckValid(t *testing.T) {
+	Convey("valid", t, func() {
+		So((&FlowParam{Name: "amount", ValueType: value_type.IntValueType}).CheckValid(), ShouldBeNil)
+		So((&FlowParam{
+			Name: "_date_from", ValueType: value_type.StringValueType,
+			DefaultValue: "2022-01-01"}).CheckValid(), ShouldBeNil)
+	})
+
+	Convey("invalid", t, func() {
+		So((&FlowParam{Name: "", ValueType: value_type.IntValueType}).CheckValid(), ShouldNotBeNil)
+		So((&FlowParam{Name: "1st", ValueType: value_type.IntValueType}).CheckValid(), ShouldNotBeNil)
+		So((&FlowParam{Name: "a.b", ValueType: value_type.IntValueType}).CheckValid(), ShouldNotBeNil)
+		So((&FlowParam{Name: "amount", ValueType: "decimal"}).CheckValid(), ShouldNotBeNil)
+		So((&FlowParam{
+			Name: "amount", ValueType: value_type.IntValueType,
+			DefaultValue: "ten"}).CheckValid(), ShouldNotBeNil)
+	})
+}
+
+func TestFlowCheckParamsValid(t *testing.T) {
+	bind := IptComponentConfig{
+		IptWay: value_object.FlowParam, ValueType: value_type.IntValueType, Key: "amount"}
+
+	Convey("valid", t, func() {
+		flowIns := newParamTestFlow(bind,
+			&FlowParam{Name: "amount", ValueType: value_type.IntValueType})
+		So(flowIns.CheckParamsValid(), ShouldBeNil)
+	})
+
+	Convey("duplicate name", t, func() {
+		flowIns := newParamTestFlow(bind,
+			&FlowParam{Name: "amount", ValueType: value_type.IntValueType},
+			&FlowParam{Name: "amount", ValueType: value_type.IntValueType})
+		So(flowIns.CheckParamsValid(), ShouldNotBeNil)
+	})
+
+	Convey("bind to not exist param", t, func() {
+		flowIns := newParamTestFlow(bind,
+			&FlowParam{Name: "count", ValueType: value_type.IntValueType})
+		So(flowIns.CheckParamsValid(), ShouldNotBeNil)
+	})
+
+	Convey("bind to param of other value type", t, func() {
+		flowIns := newParamTestFlow(bind,
+			&FlowParam{Name: "amount", ValueType: value_type.StringValueType})
+		So(flowIns.CheckParamsValid(), ShouldNotBeNil)
+	})
+
+	Convey("value type declared by function wins over draft", t, func() {
+		flowIns := newParamTestFlowWithComponent(bind,
+			&ipt.IptComponent{ValueType: value_type.StringValueType},
+			&FlowParam{Name: "amount", ValueType: value_type.IntValueType})
+		So(flowIns.CheckParamsValid(), ShouldNotBeNil)
+
+		flowIns = newParamTestFlowWithComponent(bind,
+			&ipt.IptComponent{ValueType: value_type.StringValueType},
+			&FlowParam{Name: "amount", ValueType: value_type.StringValueType})
+		So(flowIns.CheckParamsValid(), ShouldBeNil)
+	})
+
+	Convey("bind to enum component", t, func() {
+		enumComponent := &ipt.IptComponent{
+			ValueType: value_type.EnumValueType, AllowedValues: []interface{}{"kg", "g"}}
+		flowIns := newParamTestFlowWithComponent(bind, enumComponent,
+			&FlowParam{Name: "amount", ValueType: value_type.StringValueType, DefaultValue: "kg"})
+		So(flowIns.CheckParamsValid(), ShouldBeNil)
+
+		flowIns = newParamTestFlowWithComponent(bind, enumComponent,
+			&FlowParam{Name: "amount", ValueType: value_type.StringValueType, DefaultValue: "lb"})
+		So(flowIns.CheckParamsValid(), ShouldNotBeNil)
+	})
+}
+
+func TestFlowResolveParams(t *testing.T) {
+	flowIns := newParamTestFlow(IptComponentConfig{},
+		&FlowParam{Name: "amount", ValueType: value_type.IntValueType, Required: true},
+		&FlowParam{Name: "unit", ValueType: value_type.StringValueType, DefaultValue: "kg"},
+		&FlowParam{Name: "note", ValueType: value_type.StringValueType})
+
+	Convey("fill default value", t, func() {
+		params, err := flowIns.ResolveParams(map[string]interface{}{"amount": 10})
+		So(err, ShouldBeNil)
+		So(params, ShouldResemble, map[string]interface{}{"amount": 10, "unit": "kg"})
+	})
+
+	Convey("provided value override default value", t, func() {
+		params, err := flowIns.ResolveParams(map[string]interface{}{"amount": 10, "unit": "g"})
+		So(err, ShouldBeNil)
+		So(params["unit"], ShouldEqual, "g")
+	})
+
+	Convey("lack required param", t, func() {
+		_, err := flowIns.ResolveParams(nil)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("unknown param", t, func() {
+		_, err := flowIns.ResolveParams(map[string]interface{}{"amount": 10, "price": 1})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("wrong value type", t, func() {
+		_, err := flowIns.ResolveParams(map[string]interface{}{"amount": "ten"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("flow without params", t, func() {
+		params, err := (&Flow{}).ResolveParams(nil)
+		So(err, ShouldBeNil)
+		So(params, ShouldBeNil)
+	})
+}
+
+func TestFlowResolveParamsBoundComponent(t *testing.T) {
+	Convey("value not in bound enum component's allowed values", t, func() {
+		flowIns := newParamTestFlowWithComponent(
+			IptComponentConfig{IptWay: value_object.FlowParam, Key: "unit"},
+			&ipt.IptComponent{
+				ValueType: value_type.EnumValueType, AllowedValues: []interface{}{"kg", "g"}},
+			&FlowParam{Name: "unit", ValueType: value_type.StringValueType, DefaultValue: "kg"})
+
+		params, err := flowIns.ResolveParams(map[string]interface{}{"unit": "g"})
+		So(err, ShouldBeNil)
+		So(params["unit"], ShouldEqual, "g")
+
+		_, err = flowIns.ResolveParams(map[string]interface{}{"unit": "lb"})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("value not match bound json component's schema", t, func() {
+		flowIns := newParamTestFlowWithComponent(
+			IptComponentConfig{IptWay: value_object.FlowParam, Key: "filter"},
+			&ipt.IptComponent{
+				ValueType:  value_type.JsonValueType,
+				JsonSchema: []byte(`{"type": "object", "required": ["name"]}`)},
+			&FlowParam{Name: "filter", ValueType: value_type.JsonValueType})
+
+		_, err := flowIns.ResolveParams(
+			map[string]interface{}{"filter": map[string]interface{}{"name": "bloc"}})
+		So(err, ShouldBeNil)
+
+		_, err = flowIns.ResolveParams(
+			map[string]interface{}{"filter": map[string]interface{}{"age": 1}})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestFlowParamValue(t *testing.T) {
+	flowIns := newParamTestFlow(IptComponentConfig{},
+		&FlowParam{Name: "unit", ValueType: value_type.StringValueType, DefaultValue: "kg"})
+
+	Convey("ParamValue", t, func() {
+		So(flowIns.ParamValue("unit", map[string]interface{}{"unit": "g"}), ShouldEqual, "g")
+		So(flowIns.ParamValue("unit", nil), ShouldEqual, "kg")
+		So(flowIns.ParamValue("not_exist", nil), ShouldBeNil)
+	})
+}
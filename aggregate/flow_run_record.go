@@ -2,6 +2,7 @@ package aggregate
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -33,6 +34,14 @@ type FlowRunRecord struct {
 	CancelUserID                 value_object.UUID
 	TraceID                      string
 	OverideIptParams             map[string][][]interface{}
+	// 从失败处重新运行时对应的原运行记录
+	RerunFromRecordID value_object.UUID
+	// 依赖触发时对应的上游flow的运行记录
+	UpstreamFlowRunRecordID value_object.UUID
+	// 此次运行的flow参数值(已补充默认值)
+	Params map[string]interface{}
+	// 限制了并发运行数的flow，运行获取到的槽位锁的版本
+	FlowLockVersion uint64
 }
 
 func newFromFlow(ctx context.Context, f *Flow) *FlowRunRecord {
@@ -90,6 +99,60 @@ func NewCrontabTriggeredRunRecord(ctx context.Context, f *Flow) *FlowRunRecord {
 	return rR
 }
 
+// NewDependencyTriggeredFlowRunRecord 上游flow运行结束后依赖触发的运行记录
+func NewDependencyTriggeredFlowRunRecord(
+	ctx context.Context, f *Flow,
+	upstream *FlowRunRecord, params map[string][][]interface{},
+) *FlowRunRecord {
+	rR := newFromFlow(ctx, f)
+	rR.TriggerType = value_object.Dependency
+	rR.UpstreamFlowRunRecordID = upstream.ID
+	rR.OverideIptParams = params
+	return rR
+}
+
+// NewArrangementTriggeredFlowRunRecord 由父flow中的子flow节点触发的运行记录
+// flowFunctionID 为父flow中此子flow节点的flow_function_id
+func NewArrangementTriggeredFlowRunRecord(
+	ctx context.Context, f *Flow,
+	parent *FlowRunRecord, flowFunctionID string,
+	params map[string][][]interface{},
+) *FlowRunRecord {
+	rR := newFromFlow(ctx, f)
+	rR.TriggerSource = value_object.ArrangementTriggerSource
+	rR.TriggerType = parent.TriggerType
+	rR.TriggerKey = parent.TriggerKey
+	rR.TriggerUserID = parent.TriggerUserID
+	rR.ArrangementID = parent.FlowID
+	rR.ArrangementFlowID = flowFunctionID
+	rR.ArrangementRunRecordID = parent.ID.String()
+	rR.OverideIptParams = params
+	return rR
+}
+
+// NewRerunFlowRunRecord 从失败的运行记录的失败处重新运行
+// 沿用原运行记录的flow版本及覆盖参数，原运行中成功的节点不再运行
+func NewRerunFlowRunRecord(
+	ctx context.Context, f *Flow,
+	failedRecord *FlowRunRecord, triggerUser *User,
+) (*FlowRunRecord, error) {
+	if !failedRecord.CanRerunFromFailure() {
+		return nil, fmt.Errorf(
+			"flow_run_record: %s is not finished with failure", failedRecord.ID.String())
+	}
+	if f.ID != failedRecord.FlowID {
+		return nil, errors.New("flow not match the flow_run_record")
+	}
+	rR, err := NewUserTriggeredFlowRunRecord(ctx, f, triggerUser)
+	if err != nil {
+		return nil, err
+	}
+	rR.OverideIptParams = failedRecord.OverideIptParams
+	rR.Params = failedRecord.Params
+	rR.RerunFromRecordID = failedRecord.ID
+	return rR, nil
+}
+
 func (task *FlowRunRecord) IsZero() bool {
 	if task == nil {
 		return true
@@ -100,3 +163,28 @@ func (task *FlowRunRecord) IsZero() bool {
 func (task *FlowRunRecord) Finished() bool {
 	return !task.EndTime.IsZero()
 }
+
+// CanRerunFromFailure 只有已结束且未成功的运行记录才能从失败处重新运行
+func (task *FlowRunRecord) CanRerunFromFailure() bool {
+	if task.IsZero() {
+		return false
+	}
+	return task.Status.IsRunFinished() && task.Status != value_object.Suc
+}
+
+// IsRerun 是否是从另一次运行的失败处重新运行的
+func (task *FlowRunRecord) IsRerun() bool {
+	if task.IsZero() {
+		return false
+	}
+	return !task.RerunFromRecordID.IsNil()
+}
+
+// IsArrangementTriggered 是否是由父flow中的子flow节点触发运行的
+func (task *FlowRunRecord) IsArrangementTriggered() bool {
+	if task.IsZero() {
+		return false
+	}
+	return task.TriggerSource == value_object.ArrangementTriggerSource &&
+		task.ArrangementRunRecordID != ""
+}
@@ -39,3 +39,49 @@ func TestFlowRunRecordNewCrontabTriggeredRunRecord(t *testing.T) {
 		So(flowRunRecord.IsZero(), ShouldBeFalse)
 	})
 }
+
+func TestFlowRunRecordNewArrangementTriggeredRunRecord(t *testing.T) {
+	Convey("NewArrangementTriggeredFlowRunRecord", t, func() {
+		parent := NewCrontabTriggeredRunRecord(context.TODO(), &fakeFlow)
+		So(parent.IsArrangementTriggered(), ShouldBeFalse)
+
+		params := map[string][][]interface{}{secondFlowFunctionID: {{1}}}
+		child := NewArrangementTriggeredFlowRunRecord(
+			context.TODO(), &fakeFlow, parent, thirdFlowFunctionID, params)
+		So(child.IsArrangementTriggered(), ShouldBeTrue)
+		So(child.TriggerType, ShouldEqual, value_object.Crontab)
+		So(child.ArrangementID, ShouldEqual, parent.FlowID)
+		So(child.ArrangementFlowID, ShouldEqual, thirdFlowFunctionID)
+		So(child.ArrangementRunRecordID, ShouldEqual, parent.ID.String())
+		So(child.OverideIptParams, ShouldResemble, params)
+	})
+}
+
+func TestFlowRunRecordNewRerunFlowRunRecord(t *testing.T) {
+	executer := User{ID: value_object.NewUUID()}
+	fakeFlow.ExecuteUserIDs = []value_object.UUID{executer.ID}
+
+	Convey("not finished with failure", t, func() {
+		failed := NewCrontabTriggeredRunRecord(context.TODO(), &fakeFlow)
+		So(failed.CanRerunFromFailure(), ShouldBeFalse)
+		_, err := NewRerunFlowRunRecord(context.TODO(), &fakeFlow, failed, &executer)
+		So(err, ShouldNotBeNil)
+
+		failed.Status = value_object.Suc
+		So(failed.CanRerunFromFailure(), ShouldBeFalse)
+	})
+
+	Convey("NewRerunFlowRunRecord", t, func() {
+		failed := NewCrontabTriggeredRunRecord(context.TODO(), &fakeFlow)
+		failed.Status = value_object.Fail
+		failed.OverideIptParams = map[string][][]interface{}{secondFlowFunctionID: {{1}}}
+		So(failed.CanRerunFromFailure(), ShouldBeTrue)
+
+		rerun, err := NewRerunFlowRunRecord(context.TODO(), &fakeFlow, failed, &executer)
+		So(err, ShouldBeNil)
+		So(rerun.IsRerun(), ShouldBeTrue)
+		So(failed.IsRerun(), ShouldBeFalse)
+		So(rerun.RerunFromRecordID, ShouldEqual, failed.ID)
+		So(rerun.OverideIptParams, ShouldResemble, failed.OverideIptParams)
+	})
+}
@@ -1,10 +1,15 @@
 package aggregate
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/internal/crontab"
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/pkg/json_schema"
 	"github.com/fBloc/bloc-server/pkg/value_type"
 	"github.com/fBloc/bloc-server/value_object"
 	. "github.com/smartystreets/goconvey/convey"
@@ -472,6 +477,172 @@ func TestCheckFlowValid(t *testing.T) {
 	})
 }
 
+func TestCheckEnumIptValid(t *testing.T) {
+	enumFunction := Function{
+		ID:   value_object.NewUUID(),
+		Name: "enum",
+		Ipts: ipt.IptSlice{
+			{
+				Key:  "size",
+				Must: true,
+				Components: []*ipt.IptComponent{
+					{
+						ValueType:       value_type.EnumValueType,
+						FormControlType: value_object.SelectFormControl,
+						AllowedValues:   []interface{}{"small", "large"},
+					},
+				},
+			},
+		},
+	}
+	newFlowFunction := func(value interface{}) *FlowFunction {
+		return &FlowFunction{
+			FunctionID:              enumFunction.ID,
+			Function:                &enumFunction,
+			Note:                    "enum",
+			UpstreamFlowFunctionIDs: []string{config.FlowFunctionStartID},
+			ParamIpts: [][]IptComponentConfig{
+				{
+					{
+						IptWay:    value_object.UserIpt,
+						ValueType: value_type.EnumValueType,
+						Value:     value,
+					},
+				},
+			},
+		}
+	}
+
+	Convey("allowed enum value", t, func() {
+		valid, err := newFlowFunction("small").CheckValid(
+			secondFlowFunctionID, validFlowFunctionIDMapFlowFunction)
+		So(err, ShouldBeNil)
+		So(valid, ShouldBeTrue)
+	})
+
+	Convey("not allowed enum value", t, func() {
+		valid, err := newFlowFunction("medium").CheckValid(
+			secondFlowFunctionID, validFlowFunctionIDMapFlowFunction)
+		So(err, ShouldNotBeNil)
+		So(valid, ShouldBeFalse)
+	})
+}
+
+func TestCheckJsonSchemaIptValid(t *testing.T) {
+	jsonFunction := Function{
+		ID:   value_object.NewUUID(),
+		Name: "json",
+		Ipts: ipt.IptSlice{
+			{
+				Key:  "person",
+				Must: true,
+				Components: []*ipt.IptComponent{
+					{
+						ValueType:       value_type.JsonValueType,
+						FormControlType: value_object.JsonFormControl,
+						JsonSchema:      []byte(`{"type": "object", "required": ["name"]}`),
+					},
+				},
+			},
+		},
+	}
+	newFlowFunction := func(value interface{}) *FlowFunction {
+		return &FlowFunction{
+			FunctionID:              jsonFunction.ID,
+			Function:                &jsonFunction,
+			Note:                    "json",
+			UpstreamFlowFunctionIDs: []string{config.FlowFunctionStartID},
+			ParamIpts: [][]IptComponentConfig{
+				{
+					{
+						IptWay:    value_object.UserIpt,
+						ValueType: value_type.JsonValueType,
+						Value:     value,
+					},
+				},
+			},
+		}
+	}
+
+	Convey("match json schema", t, func() {
+		valid, err := newFlowFunction(`{"name": "bloc"}`).CheckValid(
+			secondFlowFunctionID, validFlowFunctionIDMapFlowFunction)
+		So(err, ShouldBeNil)
+		So(valid, ShouldBeTrue)
+	})
+
+	Convey("not match json schema", t, func() {
+		valid, err := newFlowFunction(`{"age": 1}`).CheckValid(
+			secondFlowFunctionID, validFlowFunctionIDMapFlowFunction)
+		So(valid, ShouldBeFalse)
+		var schemaErrs json_schema.ValidationErrors
+		So(errors.As(err, &schemaErrs), ShouldBeTrue)
+		So(schemaErrs[0].Pointer, ShouldEqual, "/name")
+	})
+}
+
+func TestCheckTransformValid(t *testing.T) {
+	newFlowFunction := func(iptWay value_object.FunctionParamIptType, key, transform string) *FlowFunction {
+		return &FlowFunction{
+			FunctionID:              functionMultiply.ID,
+			Function:                &functionMultiply,
+			Note:                    "multiply",
+			UpstreamFlowFunctionIDs: []string{secondFlowFunctionID},
+			ParamIpts: [][]IptComponentConfig{
+				{
+					{
+						IptWay:         iptWay,
+						ValueType:      value_type.IntValueType,
+						Value:          1,
+						FlowFunctionID: secondFlowFunctionID,
+						Key:            key,
+						Transform:      transform,
+					},
+				},
+				{
+					{
+						IptWay:    value_object.UserIpt,
+						ValueType: value_type.IntValueType,
+						Value:     10,
+					},
+				},
+			},
+		}
+	}
+
+	Convey("transform output connectable", t, func() {
+		for _, expr := range []string{"to_int", "len", "to_string | to_int"} {
+			valid, err := newFlowFunction(value_object.Connection, "describe", expr).CheckValid(
+				thirdFlowFunctionID, validFlowFunctionIDMapFlowFunction)
+			So(err, ShouldBeNil)
+			So(valid, ShouldBeTrue)
+		}
+	})
+
+	Convey("transform output not connectable", t, func() {
+		valid, err := newFlowFunction(value_object.Connection, "sum", "to_string").CheckValid(
+			thirdFlowFunctionID, validFlowFunctionIDMapFlowFunction)
+		So(err, ShouldNotBeNil)
+		So(valid, ShouldBeFalse)
+	})
+
+	Convey("transform invalid", t, func() {
+		for _, expr := range []string{"$.a", "not_exist_func", "first"} {
+			valid, err := newFlowFunction(value_object.Connection, "sum", expr).CheckValid(
+				thirdFlowFunctionID, validFlowFunctionIDMapFlowFunction)
+			So(err, ShouldNotBeNil)
+			So(valid, ShouldBeFalse)
+		}
+	})
+
+	Convey("transform only for connection", t, func() {
+		valid, err := newFlowFunction(value_object.UserIpt, "", "to_int").CheckValid(
+			thirdFlowFunctionID, validFlowFunctionIDMapFlowFunction)
+		So(err, ShouldNotBeNil)
+		So(valid, ShouldBeFalse)
+	})
+}
+
 func TestFlowIsZero(t *testing.T) {
 	Convey("should be zero", t, func() {
 		var flow *Flow = nil
@@ -483,6 +654,125 @@ func TestFlowIsZero(t *testing.T) {
 	})
 }
 
+func TestFlowConflictStrategy(t *testing.T) {
+	Convey("default drop", t, func() {
+		var nilFlow *Flow = nil
+		So(nilFlow.ConflictStrategy(), ShouldEqual, value_object.DropNewRun)
+		So((&Flow{ID: value_object.NewUUID()}).ConflictStrategy(), ShouldEqual, value_object.DropNewRun)
+		So((&Flow{
+			ID:                  value_object.NewUUID(),
+			RunConflictStrategy: "unknown",
+		}).ConflictStrategy(), ShouldEqual, value_object.DropNewRun)
+	})
+
+	Convey("setted", t, func() {
+		So((&Flow{
+			ID:                  value_object.NewUUID(),
+			RunConflictStrategy: value_object.QueueNewRun,
+		}).ConflictStrategy(), ShouldEqual, value_object.QueueNewRun)
+	})
+}
+
+func TestFlowConcurrencyLimit(t *testing.T) {
+	Convey("concurrency limit", t, func() {
+		var nilFlow *Flow = nil
+		So(nilFlow.ConcurrencyLimit(), ShouldEqual, 0)
+		So((&Flow{
+			ID:                value_object.NewUUID(),
+			MaxConcurrentRuns: 3,
+		}).ConcurrencyLimit(), ShouldEqual, 1)
+		So((&Flow{
+			ID:               value_object.NewUUID(),
+			AllowParallelRun: true,
+		}).ConcurrencyLimit(), ShouldEqual, 0)
+		So((&Flow{
+			ID:                value_object.NewUUID(),
+			AllowParallelRun:  true,
+			MaxConcurrentRuns: 3,
+		}).ConcurrencyLimit(), ShouldEqual, 3)
+	})
+}
+
+func TestFlowRunBlockedReason(t *testing.T) {
+	inWindow := time.Date(2022, 1, 1, 1, 0, 0, 0, time.Local)
+	outWindow := time.Date(2022, 1, 1, 10, 0, 0, 0, time.Local)
+	windows := []*BlackoutWindow{checkedWindow(&BlackoutWindow{Start: "00:00", End: "06:00"})}
+
+	Convey("paused", t, func() {
+		flowIns := &Flow{ID: value_object.NewUUID(), Paused: true}
+		So(flowIns.RunBlockedReason(outWindow, nil), ShouldNotBeBlank)
+	})
+
+	Convey("flow's blackout window", t, func() {
+		flowIns := &Flow{ID: value_object.NewUUID(), BlackoutWindows: windows}
+		So(flowIns.RunBlockedReason(inWindow, nil), ShouldContainSubstring, "flow's")
+		So(flowIns.RunBlockedReason(outWindow, nil), ShouldBeBlank)
+	})
+
+	Convey("global blackout window", t, func() {
+		flowIns := &Flow{ID: value_object.NewUUID()}
+		So(flowIns.RunBlockedReason(inWindow, windows), ShouldContainSubstring, "global")
+		So(flowIns.RunBlockedReason(outWindow, windows), ShouldBeBlank)
+		So(flowIns.RunBlockedReason(inWindow, nil), ShouldBeBlank)
+	})
+}
+
+func TestFlowCrontabTimesToFire(t *testing.T) {
+	now := time.Date(2022, 1, 1, 10, 0, 30, 0, time.Local)
+	flowIns := &Flow{
+		ID:                   value_object.NewUUID(),
+		Crontab:              crontab.BuildCrontab("* * * * *"),
+		CrontabLastFiredTime: now.Add(-10 * time.Minute),
+	}
+
+	Convey("never fired only check latest interval", t, func() {
+		f := *flowIns
+		f.CrontabLastFiredTime = time.Time{}
+		toFire, skipped, lastDue := f.CrontabTimesToFire(now)
+		So(toFire, ShouldResemble, []time.Time{now.Truncate(time.Minute)})
+		So(skipped, ShouldEqual, 0)
+		So(lastDue, ShouldEqual, now.Truncate(time.Minute))
+	})
+
+	Convey("skip missed by default", t, func() {
+		toFire, skipped, lastDue := flowIns.CrontabTimesToFire(now)
+		// 阈值内的不算错过
+		So(len(toFire), ShouldEqual, 2)
+		So(skipped, ShouldEqual, 8)
+		So(lastDue, ShouldEqual, now.Truncate(time.Minute))
+	})
+
+	Convey("fire once", t, func() {
+		f := *flowIns
+		f.CrontabMisfirePolicy = value_object.MisfireFireOnce
+		toFire, skipped, _ := f.CrontabTimesToFire(now)
+		So(len(toFire), ShouldEqual, 3)
+		So(skipped, ShouldEqual, 7)
+	})
+
+	Convey("fire all up to N", t, func() {
+		f := *flowIns
+		f.CrontabMisfirePolicy = value_object.MisfireFireAll
+		f.CrontabMisfireMaxRuns = 5
+		toFire, skipped, _ := f.CrontabTimesToFire(now)
+		So(len(toFire), ShouldEqual, 7)
+		So(skipped, ShouldEqual, 3)
+
+		f.CrontabMisfireMaxRuns = 0
+		toFire, skipped, _ = f.CrontabTimesToFire(now)
+		So(len(toFire), ShouldEqual, 10)
+		So(skipped, ShouldEqual, 0)
+	})
+
+	Convey("no due time", t, func() {
+		f := *flowIns
+		f.CrontabLastFiredTime = now.Truncate(time.Minute)
+		toFire, _, lastDue := f.CrontabTimesToFire(now)
+		So(toFire, ShouldBeEmpty)
+		So(lastDue.IsZero(), ShouldBeTrue)
+	})
+}
+
 func TestFlowHaveRetryStrategy(t *testing.T) {
 	Convey("retry strategy", t, func() {
 		var nilFlow *Flow = nil
@@ -558,3 +848,478 @@ func TestPermission(t *testing.T) {
 		So(fakeFlow.UserCanAssignPermission(&superUser), ShouldBeTrue)
 	})
 }
+
+func TestBranchCondition(t *testing.T) {
+	Convey("check valid", t, func() {
+		So((&BranchCondition{
+			OptKey: "sum", Operator: value_object.GtOperator, Value: 10,
+		}).CheckValid(&functionAdd), ShouldBeNil)
+		So((&BranchCondition{
+			OptKey: "describe", Operator: value_object.EqualOperator, Value: "ok",
+		}).CheckValid(&functionAdd), ShouldBeNil)
+
+		So((&BranchCondition{
+			OptKey: "sum", Operator: "~", Value: 10,
+		}).CheckValid(&functionAdd), ShouldNotBeNil)
+		So((&BranchCondition{
+			OptKey: "not_exist", Operator: value_object.EqualOperator, Value: 10,
+		}).CheckValid(&functionAdd), ShouldNotBeNil)
+		So((&BranchCondition{
+			OptKey: "sum", Operator: value_object.EqualOperator, Value: "ok",
+		}).CheckValid(&functionAdd), ShouldNotBeNil)
+		So((&BranchCondition{
+			OptKey: "describe", Operator: value_object.GtOperator, Value: "ok",
+		}).CheckValid(&functionAdd), ShouldNotBeNil)
+		So((&BranchCondition{
+			OptKey: "sum", Operator: value_object.GtOperator, Value: 10.5,
+		}).CheckValid(&functionAdd), ShouldNotBeNil)
+	})
+
+	Convey("match", t, func() {
+		condition := BranchCondition{OptKey: "sum", Operator: value_object.GtOperator, Value: 10}
+		matched, err := condition.Match(value_type.IntValueType, 11)
+		So(err, ShouldBeNil)
+		So(matched, ShouldBeTrue)
+		matched, err = condition.Match(value_type.IntValueType, float64(10)) // json反序列化出的数字
+		So(err, ShouldBeNil)
+		So(matched, ShouldBeFalse)
+
+		condition = BranchCondition{OptKey: "describe", Operator: value_object.EqualOperator, Value: "ok"}
+		matched, err = condition.Match(value_type.StringValueType, "ok")
+		So(err, ShouldBeNil)
+		So(matched, ShouldBeTrue)
+	})
+
+	Convey("flow function check", t, func() {
+		flowFunctionIDMapFlowFunction := map[string]*FlowFunction{
+			config.FlowFunctionStartID: {
+				FunctionID:                value_object.NillUUID,
+				Note:                      "start node",
+				UpstreamFlowFunctionIDs:   []string{},
+				DownstreamFlowFunctionIDs: []string{secondFlowFunctionID},
+				ParamIpts:                 [][]IptComponentConfig{},
+			},
+			secondFlowFunctionID: {
+				FunctionID:                functionAdd.ID,
+				Function:                  &functionAdd,
+				Note:                      "add",
+				UpstreamFlowFunctionIDs:   []string{config.FlowFunctionStartID},
+				DownstreamFlowFunctionIDs: []string{thirdFlowFunctionID},
+				DownstreamConditions: map[string]*BranchCondition{
+					thirdFlowFunctionID: {OptKey: "sum", Operator: value_object.GtOperator, Value: "10"},
+				},
+				ParamIpts: validFlowFunctionIDMapFlowFunction[secondFlowFunctionID].ParamIpts,
+			},
+			thirdFlowFunctionID: validFlowFunctionIDMapFlowFunction[thirdFlowFunctionID],
+		}
+		valid, err := flowFunctionIDMapFlowFunction[secondFlowFunctionID].CheckValid(
+			secondFlowFunctionID, flowFunctionIDMapFlowFunction)
+		So(err, ShouldNotBeNil)
+		So(valid, ShouldBeFalse)
+
+		flowFunctionIDMapFlowFunction[secondFlowFunctionID].DownstreamConditions = map[string]*BranchCondition{
+			thirdFlowFunctionID: {OptKey: "sum", Operator: value_object.GtOperator, Value: 10},
+		}
+		valid, err = flowFunctionIDMapFlowFunction[secondFlowFunctionID].CheckValid(
+			secondFlowFunctionID, flowFunctionIDMapFlowFunction)
+		So(err, ShouldBeNil)
+		So(valid, ShouldBeTrue)
+
+		flowFunctionIDMapFlowFunction[config.FlowFunctionStartID].DownstreamConditions = map[string]*BranchCondition{
+			secondFlowFunctionID: {OptKey: "sum", Operator: value_object.GtOperator, Value: 10},
+		}
+		valid, err = flowFunctionIDMapFlowFunction[config.FlowFunctionStartID].CheckValid(
+			config.FlowFunctionStartID, flowFunctionIDMapFlowFunction)
+		So(err, ShouldNotBeNil)
+		So(valid, ShouldBeFalse)
+	})
+}
+
+func TestFlowFunctionSkipped(t *testing.T) {
+	// start -> a -> (b | c) -> d
+	a, b, c, d := "a", "b", "c", "d"
+	flow := Flow{
+		ID: value_object.NewUUID(),
+		FlowFunctionIDMapFlowFunction: map[string]*FlowFunction{
+			config.FlowFunctionStartID: {DownstreamFlowFunctionIDs: []string{a}},
+			a: {
+				UpstreamFlowFunctionIDs:   []string{config.FlowFunctionStartID},
+				DownstreamFlowFunctionIDs: []string{b, c},
+			},
+			b: {UpstreamFlowFunctionIDs: []string{a}, DownstreamFlowFunctionIDs: []string{d}},
+			c: {UpstreamFlowFunctionIDs: []string{a}, DownstreamFlowFunctionIDs: []string{d}},
+			d: {UpstreamFlowFunctionIDs: []string{b, c}},
+		},
+	}
+	finishedRecord := func(skipped ...string) *FunctionRunRecord {
+		return &FunctionRunRecord{
+			ID:                               value_object.NewUUID(),
+			Start:                            time.Now(),
+			End:                              time.Now(),
+			SkippedDownstreamFlowFunctionIDs: skipped,
+		}
+	}
+
+	Convey("not skipped before upstream finished", t, func() {
+		records := map[string]*FunctionRunRecord{}
+		getRecord := func(id string) *FunctionRunRecord { return records[id] }
+		So(flow.FlowFunctionSkipped(a, getRecord), ShouldBeFalse)
+		So(flow.FlowFunctionSkipped(b, getRecord), ShouldBeFalse)
+		So(flow.FlowFunctionSkipped(d, getRecord), ShouldBeFalse)
+	})
+
+	Convey("branch not matched", t, func() {
+		records := map[string]*FunctionRunRecord{a: finishedRecord(c)}
+		getRecord := func(id string) *FunctionRunRecord { return records[id] }
+		So(flow.FlowFunctionSkipped(b, getRecord), ShouldBeFalse)
+		So(flow.FlowFunctionSkipped(c, getRecord), ShouldBeTrue)
+		// d 还有b分支能到达
+		So(flow.FlowFunctionSkipped(d, getRecord), ShouldBeFalse)
+	})
+
+	Convey("all branches not matched", t, func() {
+		records := map[string]*FunctionRunRecord{a: finishedRecord(b, c)}
+		getRecord := func(id string) *FunctionRunRecord { return records[id] }
+		So(flow.FlowFunctionSkipped(b, getRecord), ShouldBeTrue)
+		So(flow.FlowFunctionSkipped(c, getRecord), ShouldBeTrue)
+		So(flow.FlowFunctionSkipped(d, getRecord), ShouldBeTrue)
+	})
+}
+
+func TestRerunFlowFunctionIDs(t *testing.T) {
+	// start -> a -> (b | c) -> d
+	a, b, c, d := "a", "b", "c", "d"
+	flow := Flow{
+		ID: value_object.NewUUID(),
+		FlowFunctionIDMapFlowFunction: map[string]*FlowFunction{
+			config.FlowFunctionStartID: {DownstreamFlowFunctionIDs: []string{a}},
+			a: {
+				UpstreamFlowFunctionIDs:   []string{config.FlowFunctionStartID},
+				DownstreamFlowFunctionIDs: []string{b, c},
+			},
+			b: {UpstreamFlowFunctionIDs: []string{a}, DownstreamFlowFunctionIDs: []string{d}},
+			c: {UpstreamFlowFunctionIDs: []string{a}, DownstreamFlowFunctionIDs: []string{d}},
+			d: {UpstreamFlowFunctionIDs: []string{b, c}},
+		},
+	}
+	sucRecord := func(skipped ...string) *FunctionRunRecord {
+		return &FunctionRunRecord{
+			ID:                               value_object.NewUUID(),
+			Start:                            time.Now(),
+			End:                              time.Now(),
+			Suc:                              true,
+			SkippedDownstreamFlowFunctionIDs: skipped,
+		}
+	}
+
+	Convey("nothing succeeded", t, func() {
+		records := map[string]*FunctionRunRecord{}
+		getRecord := func(id string) *FunctionRunRecord { return records[id] }
+		So(flow.RerunFlowFunctionIDs(getRecord), ShouldResemble, []string{a})
+	})
+
+	Convey("failed in the middle", t, func() {
+		records := map[string]*FunctionRunRecord{a: sucRecord(), b: sucRecord()}
+		getRecord := func(id string) *FunctionRunRecord { return records[id] }
+		So(flow.RerunFlowFunctionIDs(getRecord), ShouldResemble, []string{c})
+	})
+
+	Convey("branch skipped upstream", t, func() {
+		records := map[string]*FunctionRunRecord{a: sucRecord(c), b: sucRecord()}
+		getRecord := func(id string) *FunctionRunRecord { return records[id] }
+		So(flow.RerunFlowFunctionIDs(getRecord), ShouldResemble, []string{d})
+	})
+
+	Convey("intercepted", t, func() {
+		intercepted := sucRecord()
+		intercepted.InterceptBelowFunctionRun = true
+		records := map[string]*FunctionRunRecord{a: intercepted}
+		getRecord := func(id string) *FunctionRunRecord { return records[id] }
+		So(flow.RerunFlowFunctionIDs(getRecord), ShouldBeEmpty)
+	})
+}
+
+func TestMapSetting(t *testing.T) {
+	Convey("concurrency", t, func() {
+		So((&MapSetting{}).Concurrency(5), ShouldEqual, 5)
+		So((&MapSetting{MaxConcurrency: 2}).Concurrency(5), ShouldEqual, 2)
+		So((&MapSetting{MaxConcurrency: 10}).Concurrency(5), ShouldEqual, 5)
+	})
+
+	Convey("check valid", t, func() {
+		copyFlowFunction := func(flowFunc *FlowFunction) *FlowFunction {
+			return &FlowFunction{
+				FunctionID:                flowFunc.FunctionID,
+				Function:                  flowFunc.Function,
+				Note:                      flowFunc.Note,
+				UpstreamFlowFunctionIDs:   flowFunc.UpstreamFlowFunctionIDs,
+				DownstreamFlowFunctionIDs: flowFunc.DownstreamFlowFunctionIDs,
+				ParamIpts:                 flowFunc.ParamIpts,
+			}
+		}
+		multiplyFlowFunc := copyFlowFunction(validFlowFunctionIDMapFlowFunction[thirdFlowFunctionID])
+		flowFunctionIDMapFlowFunction := map[string]*FlowFunction{
+			config.FlowFunctionStartID: validFlowFunctionIDMapFlowFunction[config.FlowFunctionStartID],
+			secondFlowFunctionID:       validFlowFunctionIDMapFlowFunction[secondFlowFunctionID],
+			thirdFlowFunctionID:        multiplyFlowFunc,
+		}
+
+		// 上游的sum不是数组
+		multiplyFlowFunc.Map = &MapSetting{IptIndex: 0}
+		valid, err := multiplyFlowFunc.CheckValid(thirdFlowFunctionID, flowFunctionIDMapFlowFunction)
+		So(err, ShouldNotBeNil)
+		So(valid, ShouldBeFalse)
+
+		// 不是连接上游opt的ipt
+		multiplyFlowFunc.Map = &MapSetting{IptIndex: 1}
+		valid, err = multiplyFlowFunc.CheckValid(thirdFlowFunctionID, flowFunctionIDMapFlowFunction)
+		So(err, ShouldNotBeNil)
+		So(valid, ShouldBeFalse)
+
+		multiplyFlowFunc.Map = &MapSetting{IptIndex: 5}
+		valid, err = multiplyFlowFunc.CheckValid(thirdFlowFunctionID, flowFunctionIDMapFlowFunction)
+		So(err, ShouldNotBeNil)
+		So(valid, ShouldBeFalse)
+
+		// 上游也是map节点时，其opt汇总后都是数组
+		addFlowFunc := copyFlowFunction(validFlowFunctionIDMapFlowFunction[secondFlowFunctionID])
+		addFlowFunc.Map = &MapSetting{}
+		flowFunctionIDMapFlowFunction[secondFlowFunctionID] = addFlowFunc
+		multiplyFlowFunc.Map = &MapSetting{IptIndex: 0, MaxConcurrency: 2}
+		valid, err = multiplyFlowFunc.CheckValid(thirdFlowFunctionID, flowFunctionIDMapFlowFunction)
+		So(err, ShouldBeNil)
+		So(valid, ShouldBeTrue)
+	})
+}
+
+func TestRetryPolicy(t *testing.T) {
+	Convey("check valid", t, func() {
+		So((&RetryPolicy{MaxAttempts: 3, Backoff: value_object.FixedBackoff}).CheckValid(), ShouldBeNil)
+		So((&RetryPolicy{Backoff: value_object.FixedBackoff}).CheckValid(), ShouldNotBeNil)
+		So((&RetryPolicy{MaxAttempts: 3, Backoff: "linear"}).CheckValid(), ShouldNotBeNil)
+		So((&RetryPolicy{
+			MaxAttempts: 3, Backoff: value_object.ExponentialBackoff,
+			IntervalInSecond: 10, MaxDelayInSecond: 5}).CheckValid(), ShouldNotBeNil)
+	})
+
+	Convey("should retry", t, func() {
+		policy := RetryPolicy{MaxAttempts: 3, Backoff: value_object.FixedBackoff}
+		So(policy.ShouldRetry(1), ShouldBeTrue)
+		So(policy.ShouldRetry(2), ShouldBeTrue)
+		So(policy.ShouldRetry(3), ShouldBeFalse)
+	})
+
+	Convey("delay", t, func() {
+		fixed := RetryPolicy{MaxAttempts: 5, Backoff: value_object.FixedBackoff, IntervalInSecond: 2}
+		So(fixed.Delay(1), ShouldEqual, 2*time.Second)
+		So(fixed.Delay(4), ShouldEqual, 2*time.Second)
+
+		exponential := RetryPolicy{
+			MaxAttempts: 5, Backoff: value_object.ExponentialBackoff,
+			IntervalInSecond: 2, MaxDelayInSecond: 10}
+		So(exponential.Delay(1), ShouldEqual, 2*time.Second)
+		So(exponential.Delay(2), ShouldEqual, 4*time.Second)
+		So(exponential.Delay(3), ShouldEqual, 8*time.Second)
+		So(exponential.Delay(4), ShouldEqual, 10*time.Second)
+		So(exponential.Delay(60000), ShouldEqual, 10*time.Second)
+
+		jitter := RetryPolicy{MaxAttempts: 5, Backoff: value_object.JitterBackoff, IntervalInSecond: 2}
+		for i := 0; i < 20; i++ {
+			So(jitter.Delay(3), ShouldBeBetweenOrEqual, 2*time.Second, 8*time.Second)
+		}
+
+		So((&RetryPolicy{Backoff: value_object.FixedBackoff}).Delay(1),
+			ShouldEqual, defaultRetryIntervalInSecond*time.Second)
+	})
+
+	Convey("retry delay of flow", t, func() {
+		flow := Flow{
+			ID:                    value_object.NewUUID(),
+			RetryAmount:           1,
+			RetryIntervalInSecond: 5,
+			FlowFunctionIDMapFlowFunction: map[string]*FlowFunction{
+				"a": {},
+				"b": {RetryPolicy: &RetryPolicy{
+					MaxAttempts: 2, Backoff: value_object.FixedBackoff, IntervalInSecond: 1}},
+			},
+		}
+		flowRunRecord := &FlowRunRecord{ID: value_object.NewUUID()}
+		funcRunRecord := &FunctionRunRecord{ID: value_object.NewUUID()}
+
+		// 没有节点级别的配置时使用flow整体的配置
+		retry, delay := flow.RetryDelay("a", funcRunRecord, flowRunRecord)
+		So(retry, ShouldBeTrue)
+		So(delay, ShouldEqual, 5*time.Second)
+		flowRunRecord.RetriedAmount = 1
+		retry, _ = flow.RetryDelay("a", funcRunRecord, flowRunRecord)
+		So(retry, ShouldBeFalse)
+
+		// 节点级别的配置按此节点已运行的次数计算
+		retry, delay = flow.RetryDelay("b", funcRunRecord, flowRunRecord)
+		So(retry, ShouldBeTrue)
+		So(delay, ShouldEqual, time.Second)
+		funcRunRecord.Attempts = []FunctionRunAttempt{{ErrorMsg: "first failed"}}
+		retry, _ = flow.RetryDelay("b", funcRunRecord, flowRunRecord)
+		So(retry, ShouldBeFalse)
+	})
+}
+
+func TestSubFlowSetting(t *testing.T) {
+	newSubFlow := func() *Flow {
+		return &Flow{
+			ID:       value_object.NewUUID(),
+			Name:     "add then multiply",
+			OriginID: value_object.NewUUID(),
+			FlowFunctionIDMapFlowFunction: map[string]*FlowFunction{
+				config.FlowFunctionStartID: {
+					DownstreamFlowFunctionIDs: []string{secondFlowFunctionID},
+				},
+				secondFlowFunctionID: {
+					FunctionID:                functionAdd.ID,
+					UpstreamFlowFunctionIDs:   []string{config.FlowFunctionStartID},
+					DownstreamFlowFunctionIDs: []string{thirdFlowFunctionID},
+				},
+				thirdFlowFunctionID: {
+					FunctionID:              functionMultiply.ID,
+					UpstreamFlowFunctionIDs: []string{secondFlowFunctionID},
+				},
+			},
+		}
+	}
+	getFunction := func(functionID value_object.UUID) *Function {
+		switch functionID {
+		case functionAdd.ID:
+			return &functionAdd
+		case functionMultiply.ID:
+			return &functionMultiply
+		}
+		return nil
+	}
+	subFlow := newSubFlow()
+	getOnlineFlow := func(originID value_object.UUID) (*Flow, error) {
+		if originID == subFlow.OriginID {
+			return subFlow, nil
+		}
+		return nil, nil
+	}
+	setting := &SubFlowSetting{
+		FlowOriginID: subFlow.OriginID,
+		IptTargets: []SubFlowIptTarget{
+			{FlowFunctionID: secondFlowFunctionID, IptIndex: 0, ComponentIndex: 0},
+			{FlowFunctionID: thirdFlowFunctionID, IptIndex: 1, ComponentIndex: 0},
+		},
+	}
+
+	Convey("leaf flow functions", t, func() {
+		So(subFlow.LeafFlowFunctionIDs(), ShouldResemble, []string{thirdFlowFunctionID})
+	})
+
+	Convey("assemble function", t, func() {
+		function, err := setting.AssembleFunction(value_object.NewUUID(), getFunction, getOnlineFlow)
+		So(err, ShouldBeNil)
+		So(function.ID, ShouldEqual, subFlow.ID)
+		So(len(function.Ipts), ShouldEqual, 2)
+		So(function.Ipts[0].Key, ShouldEqual, "to_add_ints")
+		So(function.Ipts[1].Key, ShouldEqual, "multiplicand")
+		So(len(function.Opts), ShouldEqual, 1)
+		So(function.Opts[0].Key, ShouldEqual, "result")
+
+		// 子flow不能引用其所在的flow
+		_, err = setting.AssembleFunction(subFlow.OriginID, getFunction, getOnlineFlow)
+		So(err, ShouldNotBeNil)
+
+		// 子flow没有上线
+		_, err = (&SubFlowSetting{FlowOriginID: value_object.NewUUID()}).AssembleFunction(
+			value_object.NewUUID(), getFunction, getOnlineFlow)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("ipt target out of range", t, func() {
+		_, err := (&SubFlowSetting{
+			FlowOriginID: subFlow.OriginID,
+			IptTargets: []SubFlowIptTarget{
+				{FlowFunctionID: thirdFlowFunctionID, IptIndex: 2},
+			},
+		}).AssembleFunction(value_object.NewUUID(), getFunction, getOnlineFlow)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("overide ipt params", t, func() {
+		params := setting.OverideIptParams([][]interface{}{{[]int{1, 2}}, {3}})
+		So(params[secondFlowFunctionID], ShouldResemble, [][]interface{}{{[]int{1, 2}}})
+		So(params[thirdFlowFunctionID], ShouldResemble, [][]interface{}{{}, {3}})
+
+		params = setting.OverideIptParams([][]interface{}{{nil}, {3}})
+		So(params, ShouldNotContainKey, secondFlowFunctionID)
+	})
+
+	Convey("check valid", t, func() {
+		function, err := setting.AssembleFunction(value_object.NewUUID(), getFunction, getOnlineFlow)
+		So(err, ShouldBeNil)
+		subFlowFuncID := value_object.NewUUID().String()
+		subFlowFunc := &FlowFunction{
+			Function:                function,
+			SubFlow:                 setting,
+			UpstreamFlowFunctionIDs: []string{config.FlowFunctionStartID},
+			ParamIpts: [][]IptComponentConfig{
+				{{IptWay: value_object.UserIpt, ValueType: value_type.IntValueType, Value: []int{1, 2}}},
+				{{IptWay: value_object.UserIpt, ValueType: value_type.IntValueType, Value: 3}},
+			},
+		}
+		flowFunctionIDMapFlowFunction := map[string]*FlowFunction{
+			config.FlowFunctionStartID: {DownstreamFlowFunctionIDs: []string{subFlowFuncID}},
+			subFlowFuncID:              subFlowFunc,
+		}
+		valid, err := subFlowFunc.CheckValid(subFlowFuncID, flowFunctionIDMapFlowFunction)
+		So(err, ShouldBeNil)
+		So(valid, ShouldBeTrue)
+
+		subFlowFunc.ParamIpts = subFlowFunc.ParamIpts[:1]
+		valid, err = subFlowFunc.CheckValid(subFlowFuncID, flowFunctionIDMapFlowFunction)
+		So(err, ShouldNotBeNil)
+		So(valid, ShouldBeFalse)
+	})
+}
+
+func TestFlowLeafOpts(t *testing.T) {
+	// start -> a, start -> b, start -> c: a、b、c都是末端节点
+	flow := &Flow{
+		FlowFunctionIDMapFlowFunction: map[string]*FlowFunction{
+			config.FlowFunctionStartID: {DownstreamFlowFunctionIDs: []string{"a", "b", "c"}},
+			"a":                        {UpstreamFlowFunctionIDs: []string{config.FlowFunctionStartID}},
+			"b":                        {UpstreamFlowFunctionIDs: []string{config.FlowFunctionStartID}},
+			"c":                        {UpstreamFlowFunctionIDs: []string{config.FlowFunctionStartID}},
+		},
+	}
+	finished := time.Now()
+	records := map[value_object.UUID]*FunctionRunRecord{}
+	newRecord := func(suc bool, opt map[string]interface{}) value_object.UUID {
+		record := &FunctionRunRecord{ID: value_object.NewUUID(), End: finished, Suc: suc, Opt: opt}
+		records[record.ID] = record
+		return record.ID
+	}
+	flowRunIns := &FlowRunRecord{FlowFuncIDMapFuncRunRecordID: map[string]value_object.UUID{
+		"a": newRecord(true, map[string]interface{}{"result": "a_result", "only_a": "a_only"}),
+		"b": newRecord(true, map[string]interface{}{"result": "b_result", "only_a": 1}),
+		"c": newRecord(false, map[string]interface{}{"result": "c_result"}),
+	}}
+	getRunRecord := func(id value_object.UUID) (*FunctionRunRecord, error) {
+		return records[id], nil
+	}
+
+	Convey("later leaf wins, failed leaf ignored", t, func() {
+		leafOpts, err := flow.LeafOpts(flowRunIns, getRunRecord)
+		So(err, ShouldBeNil)
+		So(len(leafOpts), ShouldEqual, 2)
+		So(leafOpts["result"].ObjectStorageKey, ShouldEqual, "b_result")
+		So(leafOpts["result"].FunctionRunRecord.ID, ShouldEqual, flowRunIns.FlowFuncIDMapFuncRunRecordID["b"])
+		// 不是对象存储key的值不会覆盖前面的节点
+		So(leafOpts["only_a"].ObjectStorageKey, ShouldEqual, "a_only")
+	})
+
+	Convey("leaf without run record", t, func() {
+		leafOpts, err := flow.LeafOpts(&FlowRunRecord{}, getRunRecord)
+		So(err, ShouldBeNil)
+		So(leafOpts, ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,288 @@
+package aggregate
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// ValidationSeverity 校验问题的严重程度，存在error级别的问题时不允许发布
+type ValidationSeverity string
+
+const (
+	ErrorSeverity   ValidationSeverity = "error"
+	WarningSeverity ValidationSeverity = "warning"
+	InfoSeverity    ValidationSeverity = "info"
+)
+
+// ValidationIssueCode 校验问题的类型
+type ValidationIssueCode string
+
+const (
+	MissingStartIssue       ValidationIssueCode = "missing_start"
+	EmptyFlowIssue          ValidationIssueCode = "empty_flow"
+	DanglingEdgeIssue       ValidationIssueCode = "dangling_edge"
+	CycleIssue              ValidationIssueCode = "cycle"
+	UnreachableNodeIssue    ValidationIssueCode = "unreachable_node"
+	MissingFunctionIssue    ValidationIssueCode = "missing_function"
+	DeadFunctionIssue       ValidationIssueCode = "dead_function"
+	InvalidConfigIssue      ValidationIssueCode = "invalid_config"
+	InvalidConnectionIssue  ValidationIssueCode = "invalid_connection"
+	TypeMismatchIssue       ValidationIssueCode = "type_mismatch"
+	MissingRequiredIptIssue ValidationIssueCode = "missing_required_ipt"
+	InvalidValueIssue       ValidationIssueCode = "invalid_value"
+	InvalidParamIssue       ValidationIssueCode = "invalid_param"
+	UnusedOptIssue          ValidationIssueCode = "unused_opt"
+	InvalidDependencyIssue  ValidationIssueCode = "invalid_dependency"
+)
+
+// ValidationIssue 静态校验flow发现的一个问题
+// 不针对某个节点时FlowFunctionID为空，不针对某个component时IptIndex、ComponentIndex为-1
+type ValidationIssue struct {
+	Code           ValidationIssueCode
+	Severity       ValidationSeverity
+	FlowFunctionID string
+	IptIndex       int
+	ComponentIndex int
+	Message        string
+	Err            error // 原始错误，如不满足json schema时可以通过errors.As取出结构化的详情
+}
+
+func newNodeIssue(
+	code ValidationIssueCode, severity ValidationSeverity,
+	flowFunctionID string, err error,
+) *ValidationIssue {
+	return &ValidationIssue{
+		Code:           code,
+		Severity:       severity,
+		FlowFunctionID: flowFunctionID,
+		IptIndex:       -1,
+		ComponentIndex: -1,
+		Message:        err.Error(),
+		Err:            err}
+}
+
+type ValidationIssues []*ValidationIssue
+
+func (issues ValidationIssues) HasError() bool {
+	return issues.FirstError() != nil
+}
+
+// FirstError 第一个error级别的问题，没有时返回nil
+func (issues ValidationIssues) FirstError() *ValidationIssue {
+	for _, issue := range issues {
+		if issue.Severity == ErrorSeverity {
+			return issue
+		}
+	}
+	return nil
+}
+
+// Validate 静态校验整个flow，遍历所有节点并返回发现的全部问题，而不是遇到第一个问题就返回
+// 调用前需要将各节点对应的function赋值到FlowFunction.Function
+func (flow *Flow) Validate(now time.Time) ValidationIssues {
+	issues := make(ValidationIssues, 0)
+	if flow.IsZero() {
+		return issues
+	}
+
+	startFlowFunc, ok := flow.FlowFunctionIDMapFlowFunction[config.FlowFunctionStartID]
+	if !ok {
+		return append(issues, newNodeIssue(
+			MissingStartIssue, ErrorSeverity, "", fmt.Errorf("miss start function")))
+	}
+	if len(startFlowFunc.DownstreamFlowFunctionIDs) <= 0 {
+		issues = append(issues, newNodeIssue(
+			EmptyFlowIssue, ErrorSeverity, config.FlowFunctionStartID,
+			fmt.Errorf("not allowed create flow without function")))
+	}
+
+	flowFuncIDs := make([]string, 0, len(flow.FlowFunctionIDMapFlowFunction))
+	for flowFuncID := range flow.FlowFunctionIDMapFlowFunction {
+		flowFuncIDs = append(flowFuncIDs, flowFuncID)
+	}
+	sort.Strings(flowFuncIDs)
+
+	graph := flow.Graph()
+	reachable := make(map[string]bool, len(flowFuncIDs))
+	for _, flowFuncID := range graph.Reachable() {
+		reachable[flowFuncID] = true
+	}
+	// 没有连入运行流程的节点不会运行，其上的连线问题只作为warning，不阻止发布
+	severityOf := func(flowFuncID string) ValidationSeverity {
+		if reachable[flowFuncID] {
+			return ErrorSeverity
+		}
+		return WarningSeverity
+	}
+
+	// 连线：两端的节点都需要存在，且上下游两边的记录需要一致
+	danglingFlowFuncIDs := make(map[string]bool)
+	for _, flowFuncID := range flowFuncIDs {
+		for _, err := range flow.danglingEdges(flowFuncID) {
+			danglingFlowFuncIDs[flowFuncID] = true
+			issues = append(issues, newNodeIssue(
+				DanglingEdgeIssue, severityOf(flowFuncID), flowFuncID, err))
+		}
+	}
+
+	// 环上的节点要么都能从开始节点到达，要么都不能
+	for _, cycle := range graph.Cycles() {
+		issues = append(issues, newNodeIssue(
+			CycleIssue, severityOf(cycle[0]), cycle[0], &CycleError{Path: cycle}))
+	}
+
+	// 没有连入运行流程的节点不需要做后续检查
+	for _, flowFuncID := range flowFuncIDs {
+		if !reachable[flowFuncID] {
+			issues = append(issues, newNodeIssue(
+				UnreachableNodeIssue, WarningSeverity, flowFuncID,
+				fmt.Errorf("「%s」节点没有连入运行流程，不会运行",
+					flow.FlowFunctionIDMapFlowFunction[flowFuncID].Name())))
+		}
+	}
+
+	usedOpts := flow.usedOpts(reachable)
+	for _, flowFuncID := range flowFuncIDs {
+		if !reachable[flowFuncID] {
+			continue
+		}
+		flowFunc := flow.FlowFunctionIDMapFlowFunction[flowFuncID]
+		if flowFuncID != config.FlowFunctionStartID {
+			if flowFunc.Function.IsZero() {
+				issues = append(issues, newNodeIssue(
+					MissingFunctionIssue, ErrorSeverity, flowFuncID,
+					fmt.Errorf("「%s」节点的function_id: %s 没有找到对应的function",
+						flowFunc.Name(), flowFunc.FunctionID)))
+				continue
+			}
+			if flowFunc.SubFlow == nil && flowFunc.Approval == nil &&
+				now.Sub(flowFunc.Function.LastAliveTime) > config.FunctionReportTimeout {
+				issues = append(issues, newNodeIssue(
+					DeadFunctionIssue, WarningSeverity, flowFuncID,
+					fmt.Errorf("「%s」节点的function已经没有心跳，最后存活时间: %s",
+						flowFunc.Name(), flowFunc.Function.LastAliveTime.Format(time.RFC3339))))
+			}
+		}
+
+		// 开始节点没有下游的情况上面已经作为empty_flow报告过了
+		emptyStart := flowFuncID == config.FlowFunctionStartID && len(flowFunc.DownstreamFlowFunctionIDs) == 0
+		if !danglingFlowFuncIDs[flowFuncID] && !emptyStart {
+			err := flowFunc.checkSettingValid(flowFuncID, flow.FlowFunctionIDMapFlowFunction)
+			if err != nil {
+				issues = append(issues, newNodeIssue(InvalidConfigIssue, ErrorSeverity, flowFuncID, err))
+			}
+		}
+
+		for iptIndex, iptParamConfig := range flowFunc.ParamIpts {
+			for componentIndex := range iptParamConfig {
+				code, err := flowFunc.checkIptComponentValid(
+					iptIndex, componentIndex, flowFuncID, flow.FlowFunctionIDMapFlowFunction)
+				if err != nil {
+					issue := newNodeIssue(code, ErrorSeverity, flowFuncID, err)
+					issue.IptIndex, issue.ComponentIndex = iptIndex, componentIndex
+					issues = append(issues, issue)
+				}
+			}
+		}
+
+		// 有下游节点、但没有被任何下游使用的opt
+		if len(flowFunc.DownstreamFlowFunctionIDs) > 0 && flowFunc.Function != nil {
+			for _, optItem := range flowFunc.Function.Opts {
+				if !usedOpts[flowFuncID][optItem.Key] {
+					issues = append(issues, newNodeIssue(
+						UnusedOptIssue, InfoSeverity, flowFuncID,
+						fmt.Errorf("「%s」节点的opt「%s」没有被下游使用", flowFunc.Name(), optItem.Key)))
+				}
+			}
+		}
+	}
+
+	if err := flow.CheckParamsValid(); err != nil {
+		issues = append(issues, newNodeIssue(InvalidParamIssue, ErrorSeverity, "", err))
+	}
+	return issues
+}
+
+// ValidateDependencies 检查已设置的依赖在此flow上是否仍然有效，如opt_mappings指向的节点已被删除
+func (flow *Flow) ValidateDependencies(dependencies []*FlowDependency) ValidationIssues {
+	issues := make(ValidationIssues, 0)
+	for _, dependency := range dependencies {
+		if err := dependency.CheckValid(flow); err != nil {
+			issues = append(issues, newNodeIssue(
+				InvalidDependencyIssue, ErrorSeverity, "",
+				fmt.Errorf("dependency on upstream flow(origin_id: %s) not valid: %v",
+					dependency.UpstreamFlowOriginID, err)))
+		}
+	}
+	return issues
+}
+
+// danglingEdges 节点上的无效连线：另一端节点不存在、或者另一端没有记录此连线
+func (flow *Flow) danglingEdges(flowFuncID string) []error {
+	var errs []error
+	flowFunc := flow.FlowFunctionIDMapFlowFunction[flowFuncID]
+	for _, upID := range flowFunc.UpstreamFlowFunctionIDs {
+		upFlowFunc, ok := flow.FlowFunctionIDMapFlowFunction[upID]
+		if !ok {
+			errs = append(errs, fmt.Errorf(
+				"「%s」节点填写的上游节点flow_function_id(%s)无效-没有找到对应的flow_function_id",
+				flowFunc.Name(), upID))
+		} else if !containsString(upFlowFunc.DownstreamFlowFunctionIDs, flowFuncID) {
+			errs = append(errs, fmt.Errorf(
+				"「%s」节点填写的上游节点(%s)的下游节点中没有此节点", flowFunc.Name(), upID))
+		}
+	}
+	for _, downID := range flowFunc.DownstreamFlowFunctionIDs {
+		downFlowFunc, ok := flow.FlowFunctionIDMapFlowFunction[downID]
+		if !ok {
+			errs = append(errs, fmt.Errorf(
+				"「%s」节点填写的下游节点flow_function_id(%s)无效-没有找到对应的flow_function_id",
+				flowFunc.Name(), downID))
+		} else if !containsString(downFlowFunc.UpstreamFlowFunctionIDs, flowFuncID) {
+			errs = append(errs, fmt.Errorf(
+				"「%s」节点填写的下游节点(%s)的上游节点中没有此节点", flowFunc.Name(), downID))
+		}
+	}
+	return errs
+}
+
+// usedOpts 被使用到的opt：flow_function_id -> opt key
+// 被下游节点的ipt连接、或者作为分支条件的都视为被使用
+func (flow *Flow) usedOpts(reachable map[string]bool) map[string]map[string]bool {
+	used := make(map[string]map[string]bool)
+	use := func(flowFuncID, optKey string) {
+		if _, ok := used[flowFuncID]; !ok {
+			used[flowFuncID] = make(map[string]bool)
+		}
+		used[flowFuncID][optKey] = true
+	}
+	for flowFuncID := range reachable {
+		flowFunc := flow.FlowFunctionIDMapFlowFunction[flowFuncID]
+		for _, iptParamConfig := range flowFunc.ParamIpts {
+			for _, componentParamConfig := range iptParamConfig {
+				if componentParamConfig.IptWay == value_object.Connection {
+					use(componentParamConfig.FlowFunctionID, componentParamConfig.Key)
+				}
+			}
+		}
+		for _, condition := range flowFunc.DownstreamConditions {
+			if condition != nil {
+				use(flowFuncID, condition.OptKey)
+			}
+		}
+	}
+	return used
+}
+
+func containsString(items []string, target string) bool {
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+	"github.com/fBloc/bloc-server/value_object"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newValidationTestFlow 开始节点 -> add -> multiply，multiply的第一个ipt连接add的sum
+func newValidationTestFlow(aliveTime time.Time) *Flow {
+	add, multiply := functionAdd, functionMultiply
+	add.LastAliveTime, multiply.LastAliveTime = aliveTime, aliveTime
+	return &Flow{
+		ID: value_object.NewUUID(),
+		FlowFunctionIDMapFlowFunction: map[string]*FlowFunction{
+			config.FlowFunctionStartID: {
+				Note:                      "start node",
+				DownstreamFlowFunctionIDs: []string{"add"},
+			},
+			"add": {
+				FunctionID:                add.ID,
+				Function:                  &add,
+				UpstreamFlowFunctionIDs:   []string{config.FlowFunctionStartID},
+				DownstreamFlowFunctionIDs: []string{"multiply"},
+				ParamIpts: [][]IptComponentConfig{
+					{{IptWay: value_object.UserIpt, ValueType: value_type.IntValueType, Value: 1}},
+				},
+			},
+			"multiply": {
+				FunctionID:              multiply.ID,
+				Function:                &multiply,
+				UpstreamFlowFunctionIDs: []string{"add"},
+				ParamIpts: [][]IptComponentConfig{
+					{{IptWay: value_object.Connection, ValueType: value_type.IntValueType,
+						FlowFunctionID: "add", Key: "sum"}},
+					{{IptWay: value_object.UserIpt, ValueType: value_type.IntValueType, Value: 10}},
+				},
+			},
+		},
+	}
+}
+
+func issueCodes(issues ValidationIssues) map[ValidationIssueCode]ValidationSeverity {
+	codes := make(map[ValidationIssueCode]ValidationSeverity)
+	for _, issue := range issues {
+		codes[issue.Code] = issue.Severity
+	}
+	return codes
+}
+
+func TestFlowValidate(t *testing.T) {
+	now := time.Now()
+
+	Convey("valid flow", t, func() {
+		issues := newValidationTestFlow(now).Validate(now)
+		So(issues.HasError(), ShouldBeFalse)
+		So(len(issues), ShouldEqual, 1)
+		So(issues[0].Code, ShouldEqual, UnusedOptIssue)
+		So(issues[0].Severity, ShouldEqual, InfoSeverity)
+		So(issues[0].FlowFunctionID, ShouldEqual, "add")
+	})
+
+	Convey("dead function", t, func() {
+		issues := newValidationTestFlow(now.Add(-time.Hour)).Validate(now)
+		So(issues.HasError(), ShouldBeFalse)
+		So(issueCodes(issues)[DeadFunctionIssue], ShouldEqual, WarningSeverity)
+	})
+
+	Convey("empty flow", t, func() {
+		flow := &Flow{
+			ID: value_object.NewUUID(),
+			FlowFunctionIDMapFlowFunction: map[string]*FlowFunction{
+				config.FlowFunctionStartID: {Note: "start node"},
+			},
+		}
+		issues := flow.Validate(now)
+		So(len(issues), ShouldEqual, 1)
+		So(issues.FirstError().Code, ShouldEqual, EmptyFlowIssue)
+	})
+
+	Convey("report all issues", t, func() {
+		flow := newValidationTestFlow(now)
+		add := flow.FlowFunctionIDMapFlowFunction["add"]
+		multiply := flow.FlowFunctionIDMapFlowFunction["multiply"]
+		// multiply -> add 成环，且连向了不存在的节点
+		multiply.DownstreamFlowFunctionIDs = []string{"add", "not_exist"}
+		add.UpstreamFlowFunctionIDs = append(add.UpstreamFlowFunctionIDs, "multiply")
+		// 必填的ipt没有填、连接的opt类型不匹配
+		add.ParamIpts[0][0] = IptComponentConfig{Blank: true}
+		multiply.ParamIpts[0][0].Key = "describe"
+		// 没有连入运行流程的节点
+		flow.FlowFunctionIDMapFlowFunction["isolated"] = &FlowFunction{Note: "isolated"}
+
+		issues := flow.Validate(now)
+		So(issues.HasError(), ShouldBeTrue)
+		codes := issueCodes(issues)
+		So(codes[CycleIssue], ShouldEqual, ErrorSeverity)
+		So(codes[DanglingEdgeIssue], ShouldEqual, ErrorSeverity)
+		So(codes[MissingRequiredIptIssue], ShouldEqual, ErrorSeverity)
+		So(codes[TypeMismatchIssue], ShouldEqual, ErrorSeverity)
+		So(codes[UnreachableNodeIssue], ShouldEqual, WarningSeverity)
+
+		for _, issue := range issues {
+			if issue.Code == TypeMismatchIssue {
+				So(issue.FlowFunctionID, ShouldEqual, "multiply")
+				So(issue.IptIndex, ShouldEqual, 0)
+				So(issue.ComponentIndex, ShouldEqual, 0)
+			}
+			if issue.Code == CycleIssue {
+				So(issue.Message, ShouldContainSubstring, "add -> multiply -> add")
+			}
+		}
+	})
+
+	Convey("edge issues on unreachable nodes are warnings", t, func() {
+		flow := newValidationTestFlow(now)
+		// 没有连入运行流程的两个节点互相成环，且连向了不存在的节点
+		flow.FlowFunctionIDMapFlowFunction["isolated_a"] = &FlowFunction{
+			Note:                      "isolated_a",
+			UpstreamFlowFunctionIDs:   []string{"isolated_b"},
+			DownstreamFlowFunctionIDs: []string{"isolated_b", "not_exist"}}
+		flow.FlowFunctionIDMapFlowFunction["isolated_b"] = &FlowFunction{
+			Note:                      "isolated_b",
+			UpstreamFlowFunctionIDs:   []string{"isolated_a"},
+			DownstreamFlowFunctionIDs: []string{"isolated_a"}}
+
+		issues := flow.Validate(now)
+		So(issues.HasError(), ShouldBeFalse)
+		codes := issueCodes(issues)
+		So(codes[CycleIssue], ShouldEqual, WarningSeverity)
+		So(codes[DanglingEdgeIssue], ShouldEqual, WarningSeverity)
+		So(codes[UnreachableNodeIssue], ShouldEqual, WarningSeverity)
+	})
+
+	Convey("missing function", t, func() {
+		flow := newValidationTestFlow(now)
+		flow.FlowFunctionIDMapFlowFunction["add"].Function = nil
+		issues := flow.Validate(now)
+		So(issueCodes(issues)[MissingFunctionIssue], ShouldEqual, ErrorSeverity)
+	})
+}
+
+func TestFlowValidateDependencies(t *testing.T) {
+	dependency := &FlowDependency{
+		UpstreamFlowOriginID: value_object.NewUUID(),
+		On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnSuc},
+		OptMappings: []DependencyOptMapping{
+			{OptKey: "result", FlowFunctionID: "multiply", IptIndex: 1, ComponentIndex: 0}},
+	}
+
+	Convey("mapping node exists", t, func() {
+		flow := newValidationTestFlow(time.Now())
+		So(len(flow.ValidateDependencies([]*FlowDependency{dependency})), ShouldEqual, 0)
+	})
+
+	Convey("mapping node removed from draft", t, func() {
+		flow := newValidationTestFlow(time.Now())
+		delete(flow.FlowFunctionIDMapFlowFunction, "multiply")
+		issues := flow.ValidateDependencies([]*FlowDependency{dependency})
+		So(issues.HasError(), ShouldBeTrue)
+		So(issues[0].Code, ShouldEqual, InvalidDependencyIssue)
+	})
+}
@@ -100,3 +100,15 @@ func (f *Function) OptKeyMapIsArray() map[string]bool {
 	}
 	return keyMapIsArray
 }
+
+// IptComponent 第iptIndex个ipt下的第componentIndex个component，不存在时返回nil
+func (f *Function) IptComponent(iptIndex, componentIndex int) *ipt.IptComponent {
+	if f == nil || iptIndex < 0 || iptIndex >= len(f.Ipts) {
+		return nil
+	}
+	components := f.Ipts[iptIndex].Components
+	if componentIndex < 0 || componentIndex >= len(components) {
+		return nil
+	}
+	return components[componentIndex]
+}
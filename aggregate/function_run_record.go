@@ -31,6 +31,7 @@ type FunctionRunRecord struct {
 	Suc                       bool
 	InterceptBelowFunctionRun bool
 	Canceled                  bool
+	TimeoutCanceled           bool // 运行超过了截止时间被取消，重试时设置新的截止时间/重新开始运行会将其重置
 	Description               string
 	ErrorMsg                  string
 	Ipts                      [][]interface{}    // 实际调用user implement function的时候，根据用户前端输入的匹配规则/值，获取到实际值填充进此字段，作为参数传递给函数
@@ -44,6 +45,67 @@ type FunctionRunRecord struct {
 	ProgressMilestones        []string
 	ProgressMilestoneIndex    *int
 	TraceID                   string
+
+	// 由于分支条件不满足而没有运行的下游flow_function_id
+	SkippedDownstreamFlowFunctionIDs []string
+
+	// map模式下逐元素运行的子记录，记录其所属的父记录及对应的元素下标
+	MapParentID value_object.UUID
+	MapIndex    int
+	// map模式的父记录下已成功完成的子记录下标，用于多个副本并发上报时原子地判断是否全部完成
+	MapFinishedIndexes []int
+
+	// 每次运行（含重试）的结果，按运行的先后排列
+	Attempts []FunctionRunAttempt
+
+	// 人工审批节点：是否在等待审批，及做出审批的用户
+	WaitingApproval bool
+	ApprovalUserID  value_object.UUID
+}
+
+// FunctionRunAttempt 节点的一次运行
+type FunctionRunAttempt struct {
+	Start     time.Time
+	End       time.Time
+	Suc       bool
+	ErrorMsg  string
+	Retryable bool // 失败时是否可以重试，由客户端上报
+}
+
+// NewMapChildFunctionRunRecord 为map模式的父记录创建运行第index个元素的子记录
+func NewMapChildFunctionRunRecord(
+	parent *FunctionRunRecord, index int, ipts [][]interface{},
+) *FunctionRunRecord {
+	return &FunctionRunRecord{
+		ID:                   value_object.NewUUID(),
+		FlowID:               parent.FlowID,
+		FlowOriginID:         parent.FlowOriginID,
+		ArrangementFlowID:    parent.ArrangementFlowID,
+		FunctionID:           parent.FunctionID,
+		FlowFunctionID:       parent.FlowFunctionID,
+		FlowRunRecordID:      parent.FlowRunRecordID,
+		Trigger:              time.Now(),
+		ShouldBeCanceledAt:   parent.ShouldBeCanceledAt,
+		Ipts:                 ipts,
+		ProgressMilestones:   parent.ProgressMilestones,
+		FunctionProviderName: parent.FunctionProviderName,
+		TraceID:              parent.TraceID,
+		MapParentID:          parent.ID,
+		MapIndex:             index,
+	}
+}
+
+// NewRerunCopiedFunctionRunRecord 从失败处重新运行时，将原运行中成功的记录复制到新的运行中
+// opt对应的对象存储key需由调用方复制对象后重新设置
+func NewRerunCopiedFunctionRunRecord(
+	succeeded *FunctionRunRecord, flowRunRecordIns *FlowRunRecord,
+) *FunctionRunRecord {
+	copied := *succeeded
+	copied.ID = value_object.NewUUID()
+	copied.FlowRunRecordID = flowRunRecordIns.ID
+	copied.TraceID = flowRunRecordIns.TraceID
+	copied.Opt = make(map[string]interface{}, len(succeeded.Opt))
+	return &copied
 }
 
 func NewFunctionRunRecordFromFlowDriven(
@@ -84,6 +146,35 @@ func (bh *FunctionRunRecord) UsedSeconds() float64 {
 	return end.Sub(bh.Start).Seconds()
 }
 
+// AttemptedAmount 已经运行完成的次数
+func (bh *FunctionRunRecord) AttemptedAmount() int {
+	if bh.IsZero() {
+		return 0
+	}
+	return len(bh.Attempts)
+}
+
+// FinishAttempt 以此次运行的结果生成运行记录
+func (bh *FunctionRunRecord) FinishAttempt(
+	suc bool, errorMsg string, retryable bool,
+) FunctionRunAttempt {
+	return FunctionRunAttempt{
+		Start:     bh.Start,
+		End:       time.Now(),
+		Suc:       suc,
+		ErrorMsg:  errorMsg,
+		Retryable: !suc && retryable,
+	}
+}
+
+// DeadlineExceeded 是否已经超过了运行的截止时间
+func (bh *FunctionRunRecord) DeadlineExceeded(now time.Time) bool {
+	if bh.IsZero() || bh.ShouldBeCanceledAt.IsZero() {
+		return false
+	}
+	return !bh.Finished() && now.After(bh.ShouldBeCanceledAt)
+}
+
 func (bh *FunctionRunRecord) Failed() bool {
 	if bh.IsZero() {
 		return false
@@ -94,6 +185,22 @@ func (bh *FunctionRunRecord) Failed() bool {
 	return !bh.Suc
 }
 
+// IsWaitingApproval 人工审批节点还在等待审批（没有被审批/超时/结束）
+func (bh *FunctionRunRecord) IsWaitingApproval() bool {
+	if bh.IsZero() {
+		return false
+	}
+	return bh.WaitingApproval && !bh.TimeoutCanceled && !bh.Finished()
+}
+
+// IsMapChild 是否是map模式下逐元素运行的子记录
+func (bh *FunctionRunRecord) IsMapChild() bool {
+	if bh.IsZero() {
+		return false
+	}
+	return !bh.MapParentID.IsNil()
+}
+
 func (bh *FunctionRunRecord) Finished() bool {
 	if bh.IsZero() {
 		return false
@@ -104,6 +211,19 @@ func (bh *FunctionRunRecord) Finished() bool {
 	return true
 }
 
+// SkippedDownstream 此次运行是否因分支条件不满足而跳过了某个下游节点
+func (bh *FunctionRunRecord) SkippedDownstream(flowFunctionID string) bool {
+	if bh.IsZero() {
+		return false
+	}
+	for _, i := range bh.SkippedDownstreamFlowFunctionIDs {
+		if i == flowFunctionID {
+			return true
+		}
+	}
+	return false
+}
+
 func (bh *FunctionRunRecord) SetStart() {
 	if bh.IsZero() {
 		return
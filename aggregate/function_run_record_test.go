@@ -3,6 +3,7 @@ package aggregate
 import (
 	"context"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -53,3 +54,65 @@ func TestFunctionRunRecord(t *testing.T) {
 		So(functionRunRecord.Suc, ShouldEqual, false)
 	})
 }
+
+func TestMapChildFunctionRunRecord(t *testing.T) {
+	flowRunRecord := NewCrontabTriggeredRunRecord(context.TODO(), &fakeFlow)
+	parent := NewFunctionRunRecordFromFlowDriven(
+		context.TODO(), functionAdd, *flowRunRecord, secondFlowFunctionID)
+
+	Convey("map child", t, func() {
+		child := NewMapChildFunctionRunRecord(parent, 2, [][]interface{}{{1}})
+		So(parent.IsMapChild(), ShouldBeFalse)
+		So(child.IsMapChild(), ShouldBeTrue)
+		So(child.MapParentID, ShouldEqual, parent.ID)
+		So(child.MapIndex, ShouldEqual, 2)
+		So(child.ID, ShouldNotEqual, parent.ID)
+		So(child.FlowFunctionID, ShouldEqual, parent.FlowFunctionID)
+		So(child.FlowRunRecordID, ShouldEqual, parent.FlowRunRecordID)
+	})
+}
+
+func TestFunctionRunAttempt(t *testing.T) {
+	flowRunRecord := NewCrontabTriggeredRunRecord(context.TODO(), &fakeFlow)
+	functionRunRecord := NewFunctionRunRecordFromFlowDriven(
+		context.TODO(), functionAdd, *flowRunRecord, secondFlowFunctionID)
+
+	Convey("finish attempt", t, func() {
+		So(functionRunRecord.AttemptedAmount(), ShouldEqual, 0)
+		functionRunRecord.SetStart()
+
+		failed := functionRunRecord.FinishAttempt(false, "failed", true)
+		So(failed.Suc, ShouldBeFalse)
+		So(failed.Retryable, ShouldBeTrue)
+		So(failed.ErrorMsg, ShouldEqual, "failed")
+		So(failed.Start, ShouldEqual, functionRunRecord.Start)
+
+		suc := functionRunRecord.FinishAttempt(true, "", true)
+		So(suc.Retryable, ShouldBeFalse)
+
+		functionRunRecord.Attempts = append(functionRunRecord.Attempts, failed, suc)
+		So(functionRunRecord.AttemptedAmount(), ShouldEqual, 2)
+	})
+}
+
+func TestFunctionRunRecordDeadlineExceeded(t *testing.T) {
+	flowRunRecord := NewCrontabTriggeredRunRecord(context.TODO(), &fakeFlow)
+	functionRunRecord := NewFunctionRunRecordFromFlowDriven(
+		context.TODO(), functionAdd, *flowRunRecord, secondFlowFunctionID)
+	now := time.Now()
+
+	Convey("no deadline", t, func() {
+		So(functionRunRecord.DeadlineExceeded(now), ShouldBeFalse)
+	})
+
+	Convey("deadline", t, func() {
+		functionRunRecord.ShouldBeCanceledAt = now.Add(time.Minute)
+		So(functionRunRecord.DeadlineExceeded(now), ShouldBeFalse)
+		So(functionRunRecord.DeadlineExceeded(now.Add(2*time.Minute)), ShouldBeTrue)
+	})
+
+	Convey("finished record never exceed", t, func() {
+		functionRunRecord.End = now
+		So(functionRunRecord.DeadlineExceeded(now.Add(2*time.Minute)), ShouldBeFalse)
+	})
+}
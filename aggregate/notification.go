@@ -0,0 +1,170 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// NotificationRule flow运行结束后，满足条件时通过某个渠道发送通知
+type NotificationRule struct {
+	Triggers         []value_object.NotifyTrigger
+	LongRunInMinutes uint32 // 配合NotifyOnLongRun，运行时长超过此分钟数时通知
+	Channel          value_object.NotifyChannel
+	Target           string // email渠道为收件地址，其他渠道为接收请求的地址
+	Secret           string // 签名用的密钥，为空时不签名
+}
+
+func (nR *NotificationRule) CheckValid() error {
+	if len(nR.Triggers) == 0 {
+		return errors.New("notification rule must have at least one trigger")
+	}
+	for _, trigger := range nR.Triggers {
+		if !trigger.IsValid() {
+			return fmt.Errorf("notify trigger「%s」not valid", trigger)
+		}
+		if trigger == value_object.NotifyOnLongRun && nR.LongRunInMinutes == 0 {
+			return errors.New("long_run trigger must set long_run_in_minutes")
+		}
+	}
+	return checkNotifyTarget(nR.Channel, nR.Target)
+}
+
+// checkNotifyTarget 检测渠道是否有效及接收方是否符合渠道的要求
+func checkNotifyTarget(channel value_object.NotifyChannel, target string) error {
+	if !channel.IsValid() {
+		return fmt.Errorf("notify channel「%s」not valid", channel)
+	}
+	if channel == value_object.EmailChannel {
+		if _, err := mail.ParseAddress(target); err != nil {
+			return fmt.Errorf("target「%s」is not a valid email address", target)
+		}
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("target「%s」is not a valid http url", target)
+	}
+	return nil
+}
+
+// MatchedTriggers 已结束的flow运行记录满足了此规则的哪些触发条件
+func (nR *NotificationRule) MatchedTriggers(
+	flowRunRecord *FlowRunRecord,
+) []value_object.NotifyTrigger {
+	if !flowRunRecord.Finished() {
+		return nil
+	}
+	matched := make([]value_object.NotifyTrigger, 0, len(nR.Triggers))
+	for _, trigger := range nR.Triggers {
+		var hit bool
+		switch trigger {
+		case value_object.NotifyOnSuc:
+			hit = flowRunRecord.Status == value_object.Suc ||
+				flowRunRecord.Status == value_object.InterceptedCancel
+		case value_object.NotifyOnFail:
+			hit = flowRunRecord.Status == value_object.Fail
+		case value_object.NotifyOnTimeoutCancel:
+			hit = flowRunRecord.Status == value_object.TimeoutCanceled
+		case value_object.NotifyOnLongRun:
+			hit = !flowRunRecord.StartTime.IsZero() &&
+				flowRunRecord.EndTime.Sub(flowRunRecord.StartTime) >
+					time.Duration(nR.LongRunInMinutes)*time.Minute
+		}
+		if hit {
+			matched = append(matched, trigger)
+		}
+	}
+	return matched
+}
+
+// NotificationDelivery 一条通知的投递，失败时会重试，记录每次投递的结果
+type NotificationDelivery struct {
+	ID              value_object.UUID
+	FlowID          value_object.UUID
+	FlowOriginID    value_object.UUID
+	FlowRunRecordID value_object.UUID
+	Triggers        []value_object.NotifyTrigger
+	Channel         value_object.NotifyChannel
+	Target          string
+	Secret          string
+	CreateTime      time.Time
+	FinishTime      time.Time // 投递成功或放弃重试的时间
+	Suc             bool
+	Attempts        []NotificationDeliveryAttempt
+
+	// flow运行结束的通知对应flow中第几条通知规则，与FlowRunRecordID一起唯一确定一条通知
+	RuleIndex int
+
+	// 人工审批节点通知审批人时，对应等待审批的节点运行记录
+	FunctionRunRecordID value_object.UUID
+}
+
+// NotificationDeliveryAttempt 一次投递的结果
+type NotificationDeliveryAttempt struct {
+	Time     time.Time
+	Suc      bool
+	ErrorMsg string
+}
+
+func NewNotificationDelivery(
+	flowRunRecord *FlowRunRecord,
+	ruleIndex int,
+	rule *NotificationRule,
+	triggers []value_object.NotifyTrigger,
+) *NotificationDelivery {
+	return &NotificationDelivery{
+		ID:              value_object.NewUUID(),
+		FlowID:          flowRunRecord.FlowID,
+		FlowOriginID:    flowRunRecord.FlowOriginID,
+		FlowRunRecordID: flowRunRecord.ID,
+		Triggers:        triggers,
+		Channel:         rule.Channel,
+		Target:          rule.Target,
+		Secret:          rule.Secret,
+		CreateTime:      time.Now(),
+		RuleIndex:       ruleIndex,
+	}
+}
+
+// NewApprovalNotificationDelivery 通知审批人有等待其审批的节点
+func NewApprovalNotificationDelivery(
+	funcRunRecord *FunctionRunRecord, approver *Approver,
+) *NotificationDelivery {
+	return &NotificationDelivery{
+		ID:                  value_object.NewUUID(),
+		FlowID:              funcRunRecord.FlowID,
+		FlowOriginID:        funcRunRecord.FlowOriginID,
+		FlowRunRecordID:     funcRunRecord.FlowRunRecordID,
+		Triggers:            []value_object.NotifyTrigger{value_object.NotifyOnWaitingApproval},
+		Channel:             approver.Channel,
+		Target:              approver.Target,
+		CreateTime:          time.Now(),
+		FunctionRunRecordID: funcRunRecord.ID,
+	}
+}
+
+func (nD *NotificationDelivery) IsZero() bool {
+	if nD == nil {
+		return true
+	}
+	return nD.ID.IsNil()
+}
+
+func (nD *NotificationDelivery) Finished() bool {
+	if nD.IsZero() {
+		return false
+	}
+	return !nD.FinishTime.IsZero()
+}
+
+func (nD *NotificationDelivery) AttemptedAmount() int {
+	if nD.IsZero() {
+		return 0
+	}
+	return len(nD.Attempts)
+}
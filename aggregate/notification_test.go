@@ -0,0 +1,90 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/value_object"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNotificationRuleCheckValid(t *testing.T) {
+	Convey("valid", t, func() {
+		rule := NotificationRule{
+			Triggers: []value_object.NotifyTrigger{value_object.NotifyOnFail},
+			Channel:  value_object.WebhookChannel,
+			Target:   "https://example.com/hook"}
+		So(rule.CheckValid(), ShouldBeNil)
+
+		rule = NotificationRule{
+			Triggers: []value_object.NotifyTrigger{value_object.NotifyOnSuc},
+			Channel:  value_object.EmailChannel,
+			Target:   "ops@example.com"}
+		So(rule.CheckValid(), ShouldBeNil)
+	})
+
+	Convey("invalid", t, func() {
+		So((&NotificationRule{
+			Channel: value_object.WebhookChannel,
+			Target:  "https://example.com/hook"}).CheckValid(), ShouldNotBeNil)
+		So((&NotificationRule{
+			Triggers: []value_object.NotifyTrigger{"unknown"},
+			Channel:  value_object.WebhookChannel,
+			Target:   "https://example.com/hook"}).CheckValid(), ShouldNotBeNil)
+		So((&NotificationRule{
+			Triggers: []value_object.NotifyTrigger{value_object.NotifyOnLongRun},
+			Channel:  value_object.WebhookChannel,
+			Target:   "https://example.com/hook"}).CheckValid(), ShouldNotBeNil)
+		So((&NotificationRule{
+			Triggers: []value_object.NotifyTrigger{value_object.NotifyOnFail},
+			Channel:  "pigeon",
+			Target:   "https://example.com/hook"}).CheckValid(), ShouldNotBeNil)
+		So((&NotificationRule{
+			Triggers: []value_object.NotifyTrigger{value_object.NotifyOnFail},
+			Channel:  value_object.SlackChannel,
+			Target:   "ftp://example.com"}).CheckValid(), ShouldNotBeNil)
+		So((&NotificationRule{
+			Triggers: []value_object.NotifyTrigger{value_object.NotifyOnFail},
+			Channel:  value_object.EmailChannel,
+			Target:   "not an email"}).CheckValid(), ShouldNotBeNil)
+	})
+}
+
+func TestNotificationRuleMatchedTriggers(t *testing.T) {
+	rule := NotificationRule{
+		Triggers: []value_object.NotifyTrigger{
+			value_object.NotifyOnFail, value_object.NotifyOnLongRun},
+		LongRunInMinutes: 10,
+		Channel:          value_object.WebhookChannel,
+		Target:           "https://example.com/hook"}
+	now := time.Now()
+
+	Convey("not finished match nothing", t, func() {
+		So(rule.MatchedTriggers(&FlowRunRecord{
+			Status: value_object.Running}), ShouldBeEmpty)
+	})
+
+	Convey("fail & long run", t, func() {
+		matched := rule.MatchedTriggers(&FlowRunRecord{
+			Status:    value_object.Fail,
+			StartTime: now.Add(-time.Hour),
+			EndTime:   now})
+		So(matched, ShouldResemble, []value_object.NotifyTrigger{
+			value_object.NotifyOnFail, value_object.NotifyOnLongRun})
+	})
+
+	Convey("suc in time", t, func() {
+		So(rule.MatchedTriggers(&FlowRunRecord{
+			Status:    value_object.Suc,
+			StartTime: now.Add(-time.Minute),
+			EndTime:   now}), ShouldBeEmpty)
+	})
+
+	Convey("intercepted counts as suc", t, func() {
+		sucRule := NotificationRule{
+			Triggers: []value_object.NotifyTrigger{value_object.NotifyOnSuc}}
+		So(sucRule.MatchedTriggers(&FlowRunRecord{
+			Status:  value_object.InterceptedCancel,
+			EndTime: now}), ShouldHaveLength, 1)
+	})
+}
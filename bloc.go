@@ -7,27 +7,51 @@ import (
 	"github.com/fBloc/bloc-server/aggregate"
 	"github.com/fBloc/bloc-server/config"
 	"github.com/fBloc/bloc-server/event"
+	memory_futureEventStorage "github.com/fBloc/bloc-server/event/memory_event_storage"
 	mongo_futureEventStorage "github.com/fBloc/bloc-server/event/mongo_event_storage"
 	"github.com/fBloc/bloc-server/infrastructure/log"
 	"github.com/fBloc/bloc-server/infrastructure/log_collect_backend"
 	influx_logBackend "github.com/fBloc/bloc-server/infrastructure/log_collect_backend/influxdb"
+	memory_logBackend "github.com/fBloc/bloc-server/infrastructure/log_collect_backend/memory"
 	"github.com/fBloc/bloc-server/infrastructure/mq"
+	memory_mq "github.com/fBloc/bloc-server/infrastructure/mq/memory"
+	"github.com/fBloc/bloc-server/infrastructure/notifier"
+	"github.com/fBloc/bloc-server/infrastructure/notifier/dingtalk"
+	"github.com/fBloc/bloc-server/infrastructure/notifier/email"
+	"github.com/fBloc/bloc-server/infrastructure/notifier/slack"
+	"github.com/fBloc/bloc-server/infrastructure/notifier/webhook"
 	"github.com/fBloc/bloc-server/infrastructure/object_storage"
+	memoryOS "github.com/fBloc/bloc-server/infrastructure/object_storage/memory"
 	minioInf "github.com/fBloc/bloc-server/infrastructure/object_storage/minio"
 	"github.com/fBloc/bloc-server/internal/conns/influxdb"
 	"github.com/fBloc/bloc-server/internal/conns/minio"
 	"github.com/fBloc/bloc-server/internal/conns/mongodb"
 	"github.com/fBloc/bloc-server/internal/util"
+	"github.com/fBloc/bloc-server/pkg/builtin_function"
 	flow_repository "github.com/fBloc/bloc-server/repository/flow"
+	memory_flow "github.com/fBloc/bloc-server/repository/flow/memory"
 	mongo_flow "github.com/fBloc/bloc-server/repository/flow/mongo"
+	flowLock_repository "github.com/fBloc/bloc-server/repository/flow_lock"
+	memory_flowLock "github.com/fBloc/bloc-server/repository/flow_lock/memory"
+	mongo_flowLock "github.com/fBloc/bloc-server/repository/flow_lock/mongo"
 	flowRunRecord_repository "github.com/fBloc/bloc-server/repository/flow_run_record"
+	memory_flowRunRecord "github.com/fBloc/bloc-server/repository/flow_run_record/memory"
 	mongo_flowRunRecord "github.com/fBloc/bloc-server/repository/flow_run_record/mongo"
+	notify_flowRunRecord "github.com/fBloc/bloc-server/repository/flow_run_record/notify"
 	function_repository "github.com/fBloc/bloc-server/repository/function"
+	memory_func "github.com/fBloc/bloc-server/repository/function/memory"
 	mongo_func "github.com/fBloc/bloc-server/repository/function/mongo"
 	function_execute_heartbeat_repository "github.com/fBloc/bloc-server/repository/function_execute_heartbeat"
+	memory_funcRunHBeat "github.com/fBloc/bloc-server/repository/function_execute_heartbeat/memory"
 	mongo_funcRunHBeat "github.com/fBloc/bloc-server/repository/function_execute_heartbeat/mongo"
 	funcRunRec_repository "github.com/fBloc/bloc-server/repository/function_run_record"
+	memory_funcRunRecord "github.com/fBloc/bloc-server/repository/function_run_record/memory"
 	mongo_funcRunRecord "github.com/fBloc/bloc-server/repository/function_run_record/mongo"
+	notify_funcRunRecord "github.com/fBloc/bloc-server/repository/function_run_record/notify"
+	notificationDelivery_repository "github.com/fBloc/bloc-server/repository/notification_delivery"
+	memory_notificationDelivery "github.com/fBloc/bloc-server/repository/notification_delivery/memory"
+	mongo_notificationDelivery "github.com/fBloc/bloc-server/repository/notification_delivery/mongo"
+	memory_user "github.com/fBloc/bloc-server/repository/user/memory"
 	mongo_user "github.com/fBloc/bloc-server/repository/user/mongo"
 	"github.com/fBloc/bloc-server/value_object"
 
@@ -81,6 +105,12 @@ type ConfigBuilder struct {
 	minioConf       *minio.MinioConfig
 	InfluxDBConf    *influxdb.InfluxDBConfig
 	LogConf         *LogConfig
+	SmtpConf        *email.SmtpConfig
+	InMemory        bool // 所有依赖均使用进程内实现，无需外部中间件，仅适用于单进程的开发、测试
+	// 对全部flow生效的禁止运行时段
+	BlackoutWindows []*aggregate.BlackoutWindow
+	// 内置http_request function可以访问的地址范围，为空时不允许访问内网地址
+	BuiltinHttpRequestAccess *builtin_function.HttpRequestAccessPolicy
 }
 
 func (confbder *ConfigBuilder) SetDefaultUser(name, password string) *ConfigBuilder {
@@ -159,6 +189,59 @@ func (confbder *ConfigBuilder) SetLogConfig(maxKeepDays int) *ConfigBuilder {
 	return confbder
 }
 
+// SetSmtpConfig 设置后flow的通知规则才能使用email渠道
+func (confbder *ConfigBuilder) SetSmtpConfig(
+	host string, port int, user, password, from string,
+) *ConfigBuilder {
+	confbder.SmtpConf = &email.SmtpConfig{
+		Host:     host,
+		Port:     port,
+		User:     user,
+		Password: password,
+		From:     from}
+	return confbder
+}
+
+// AddBlackoutWindow 添加对全部flow生效的禁止运行时段，期间触发的运行都会被跳过。
+// weekdays为空表示每天，end早于start表示跨越零点，timezone为空表示服务器本地时区
+func (confbder *ConfigBuilder) AddBlackoutWindow(
+	weekdays []time.Weekday, start, end, timezone string,
+) *ConfigBuilder {
+	window := &aggregate.BlackoutWindow{
+		Weekdays: weekdays,
+		Start:    start,
+		End:      end,
+		Timezone: timezone}
+	if err := window.CheckValid(); err != nil {
+		panic(fmt.Sprintf("blackout window not valid: %v", err))
+	}
+	confbder.BlackoutWindows = append(confbder.BlackoutWindows, window)
+	return confbder
+}
+
+// SetBuiltinHttpRequestAccess 设置内置http_request function可以访问的地址范围。
+// 默认不允许访问回环、链路本地及内网地址，allowHosts中的除外；denyHosts中的一律不允许访问。
+// 元素可以是host名、ip或CIDR
+func (confbder *ConfigBuilder) SetBuiltinHttpRequestAccess(
+	allowHosts, denyHosts []string,
+) *ConfigBuilder {
+	policy := &builtin_function.HttpRequestAccessPolicy{
+		AllowHosts: allowHosts,
+		DenyHosts:  denyHosts}
+	if err := policy.CheckValid(); err != nil {
+		panic(fmt.Sprintf("builtin http request access not valid: %v", err))
+	}
+	confbder.BuiltinHttpRequestAccess = policy
+	return confbder
+}
+
+// SetInMemory 使用进程内的mq、对象存储、日志及repository实现，
+// 设置后不再需要rabbit、mongo、minio、influxdb的配置
+func (confbder *ConfigBuilder) SetInMemory() *ConfigBuilder {
+	confbder.InMemory = true
+	return confbder
+}
+
 // BuildUp 对于必须要输入的做输入检查 & 有效性检查
 func (congbder *ConfigBuilder) BuildUp() {
 	var err error
@@ -174,6 +257,18 @@ func (congbder *ConfigBuilder) BuildUp() {
 	// HttpServerConf http server 地址配置。
 	// 不用检查，有问题的话直接失败就是了
 
+	// LogConf
+	if congbder.LogConf.IsNil() {
+		congbder.LogConf = &LogConfig{
+			MaxKeepDays: config.DefaultLogKeepDays,
+		}
+	}
+
+	// 进程内模式不依赖外部中间件，无需检查
+	if congbder.InMemory {
+		return
+	}
+
 	// RabbitConf。需要检查输入的配置能够建立有效的链接
 	if congbder.RabbitConf.IsNil() {
 		panic("must set rabbit config")
@@ -206,13 +301,6 @@ func (congbder *ConfigBuilder) BuildUp() {
 	if err != nil {
 		panic(err)
 	}
-
-	// LogConf
-	if congbder.LogConf.IsNil() {
-		congbder.LogConf = &LogConfig{
-			MaxKeepDays: config.DefaultLogKeepDays,
-		}
-	}
 }
 
 type BlocApp struct {
@@ -227,9 +315,14 @@ type BlocApp struct {
 	functionExecuteHBeatRepository function_execute_heartbeat_repository.FunctionExecuteHeartbeatRepository
 	functionRunRecordRepository    funcRunRec_repository.FunctionRunRecordRepository
 	flowRunRecordRepository        flowRunRecord_repository.FlowRunRecordRepository
+	notificationDeliveryRepository notificationDelivery_repository.NotificationDeliveryRepository
+	flowLockRepository             flowLock_repository.FlowLockRepository
+	notifiers                      map[value_object.NotifyChannel]notifier.Notifier
 	eventMQ                        mq.MsgQueue
 	futureEventStorage             event.FuturePubEventStorage
 	consumerObjectStorage          object_storage.ObjectStorage
+	memoryLogBackEnd               log_collect_backend.LogBackEnd
+	memoryLogBackEndOnce           sync.Once
 	sync.Mutex
 }
 
@@ -263,7 +356,28 @@ func (bA *BlocApp) HttpListener() net.Listener {
 		bA.configBuilder.HttpServerConf.Port)
 }
 
+// GlobalBlackoutWindows 对全部flow生效的禁止运行时段
+func (bA *BlocApp) GlobalBlackoutWindows() []*aggregate.BlackoutWindow {
+	if bA.configBuilder == nil {
+		return nil
+	}
+	return bA.configBuilder.BlackoutWindows
+}
+
+func (bA *BlocApp) inMemory() bool {
+	return bA.configBuilder != nil && bA.configBuilder.InMemory
+}
+
 func (bA *BlocApp) GetOrCreateLogBackEnd() (log_collect_backend.LogBackEnd, error) {
+	// 进程内模式下日志需在同一实例中才能被查询到。
+	// 此方法会在持有bA锁时被调用，故不能再使用bA的锁
+	if bA.inMemory() {
+		bA.memoryLogBackEndOnce.Do(func() {
+			bA.memoryLogBackEnd = memory_logBackend.New()
+		})
+		return bA.memoryLogBackEnd, nil
+	}
+
 	influxConn, err := influxdb.Connect(bA.configBuilder.InfluxDBConf)
 	if err != nil {
 		return nil, err
@@ -324,6 +438,11 @@ func (bA *BlocApp) GetOrCreateUserRepository() user_repository.UserRepository {
 		return bA.userRepository
 	}
 
+	if bA.inMemory() {
+		bA.userRepository = memory_user.New()
+		return bA.userRepository
+	}
+
 	ur, err := mongo_user.New(
 		context.Background(),
 		bA.configBuilder.mongoConf,
@@ -344,6 +463,11 @@ func (bA *BlocApp) GetOrCreateFlowRepository() flow_repository.FlowRepository {
 		return bA.flowRepository
 	}
 
+	if bA.inMemory() {
+		bA.flowRepository = memory_flow.New()
+		return bA.flowRepository
+	}
+
 	fr, err := mongo_flow.New(
 		context.Background(),
 		bA.configBuilder.mongoConf,
@@ -364,6 +488,11 @@ func (bA *BlocApp) GetOrCreateFunctionRepository() function_repository.FunctionR
 		return bA.functionRepository
 	}
 
+	if bA.inMemory() {
+		bA.functionRepository = memory_func.New()
+		return bA.functionRepository
+	}
+
 	fR, err := mongo_func.New(
 		context.Background(),
 		bA.configBuilder.mongoConf,
@@ -384,6 +513,12 @@ func (bA *BlocApp) GetOrCreateFunctionRunRecordRepository() funcRunRec_repositor
 		return bA.functionRunRecordRepository
 	}
 
+	// 节点的开始/结束/进度变化需要推送，使用notify包装
+	if bA.inMemory() {
+		bA.functionRunRecordRepository = notify_funcRunRecord.New(memory_funcRunRecord.New())
+		return bA.functionRunRecordRepository
+	}
+
 	fR, err := mongo_funcRunRecord.New(
 		context.Background(),
 		bA.configBuilder.mongoConf,
@@ -393,7 +528,7 @@ func (bA *BlocApp) GetOrCreateFunctionRunRecordRepository() funcRunRec_repositor
 		panic(err)
 	}
 
-	bA.functionRunRecordRepository = fR
+	bA.functionRunRecordRepository = notify_funcRunRecord.New(fR)
 	return bA.functionRunRecordRepository
 }
 
@@ -404,6 +539,12 @@ func (bA *BlocApp) GetOrCreateFlowRunRecordRepository() flowRunRecord_repository
 		return bA.flowRunRecordRepository
 	}
 
+	// flow运行的状态变化需要推送，使用notify包装
+	if bA.inMemory() {
+		bA.flowRunRecordRepository = notify_flowRunRecord.New(memory_flowRunRecord.New())
+		return bA.flowRunRecordRepository
+	}
+
 	fR, err := mongo_flowRunRecord.New(
 		context.Background(),
 		bA.configBuilder.mongoConf,
@@ -413,10 +554,87 @@ func (bA *BlocApp) GetOrCreateFlowRunRecordRepository() flowRunRecord_repository
 		panic(err)
 	}
 
-	bA.flowRunRecordRepository = fR
+	bA.flowRunRecordRepository = notify_flowRunRecord.New(fR)
 	return bA.flowRunRecordRepository
 }
 
+func (bA *BlocApp) GetOrCreateNotificationDeliveryRepository() notificationDelivery_repository.NotificationDeliveryRepository {
+	bA.Lock()
+	defer bA.Unlock()
+	if bA.notificationDeliveryRepository != nil {
+		return bA.notificationDeliveryRepository
+	}
+
+	if bA.inMemory() {
+		bA.notificationDeliveryRepository = memory_notificationDelivery.New()
+		return bA.notificationDeliveryRepository
+	}
+
+	nR, err := mongo_notificationDelivery.New(
+		context.Background(),
+		bA.configBuilder.mongoConf,
+		mongo_notificationDelivery.DefaultCollectionName,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	bA.notificationDeliveryRepository = nR
+	return bA.notificationDeliveryRepository
+}
+
+func (bA *BlocApp) GetOrCreateFlowLockRepository() flowLock_repository.FlowLockRepository {
+	bA.Lock()
+	defer bA.Unlock()
+	if bA.flowLockRepository != nil {
+		return bA.flowLockRepository
+	}
+
+	if bA.inMemory() {
+		bA.flowLockRepository = memory_flowLock.New()
+		return bA.flowLockRepository
+	}
+
+	fLR, err := mongo_flowLock.New(
+		context.Background(),
+		bA.configBuilder.mongoConf,
+		mongo_flowLock.DefaultCollectionName,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	bA.flowLockRepository = fLR
+	return bA.flowLockRepository
+}
+
+// SetNotifier 替换/新增某个渠道的通知发送实现，需在Run之前调用
+func (bA *BlocApp) SetNotifier(channel value_object.NotifyChannel, n notifier.Notifier) {
+	bA.GetOrCreateNotifiers()
+	bA.Lock()
+	defer bA.Unlock()
+	bA.notifiers[channel] = n
+}
+
+func (bA *BlocApp) GetOrCreateNotifiers() map[value_object.NotifyChannel]notifier.Notifier {
+	bA.Lock()
+	defer bA.Unlock()
+	if bA.notifiers != nil {
+		return bA.notifiers
+	}
+
+	bA.notifiers = map[value_object.NotifyChannel]notifier.Notifier{
+		value_object.WebhookChannel:  webhook.New(config.NotificationDeliverTimeout),
+		value_object.SlackChannel:    slack.New(config.NotificationDeliverTimeout),
+		value_object.DingTalkChannel: dingtalk.New(config.NotificationDeliverTimeout),
+	}
+	// 未配置smtp时email渠道的通知投递会直接失败
+	if bA.configBuilder != nil && !bA.configBuilder.SmtpConf.IsNil() {
+		bA.notifiers[value_object.EmailChannel] = email.New(bA.configBuilder.SmtpConf)
+	}
+	return bA.notifiers
+}
+
 func (bA *BlocApp) GetOrCreateFuncRunHBeatRepository() function_execute_heartbeat_repository.FunctionExecuteHeartbeatRepository {
 	bA.Lock()
 	defer bA.Unlock()
@@ -424,6 +642,11 @@ func (bA *BlocApp) GetOrCreateFuncRunHBeatRepository() function_execute_heartbea
 		return bA.functionExecuteHBeatRepository
 	}
 
+	if bA.inMemory() {
+		bA.functionExecuteHBeatRepository = memory_funcRunHBeat.New()
+		return bA.functionExecuteHBeatRepository
+	}
+
 	fR, err := mongo_funcRunHBeat.New(
 		context.Background(),
 		bA.configBuilder.mongoConf,
@@ -444,6 +667,11 @@ func (bA *BlocApp) GetOrCreateEventMQ() mq.MsgQueue {
 		return bA.eventMQ
 	}
 
+	if bA.inMemory() {
+		bA.eventMQ = memory_mq.New()
+		return bA.eventMQ
+	}
+
 	rabbitMQ, err := rabbit.Connect(bA.configBuilder.RabbitConf)
 	if err != nil {
 		panic(err)
@@ -461,6 +689,11 @@ func (bA *BlocApp) GetOrCreateFutureEventStorage() event.FuturePubEventStorage {
 		return bA.futureEventStorage
 	}
 
+	if bA.inMemory() {
+		bA.futureEventStorage = memory_futureEventStorage.New()
+		return bA.futureEventStorage
+	}
+
 	mongoStorage, err := mongo_futureEventStorage.New(
 		context.Background(),
 		bA.configBuilder.mongoConf,
@@ -480,6 +713,11 @@ func (bA *BlocApp) GetOrCreateConsumerObjectStorage() object_storage.ObjectStora
 		return bA.consumerObjectStorage
 	}
 
+	if bA.inMemory() {
+		bA.consumerObjectStorage = memoryOS.New()
+		return bA.consumerObjectStorage
+	}
+
 	minioOS, err := minioInf.New(bA.configBuilder.minioConf)
 	if err != nil {
 		panic(err)
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log"
+
+	"github.com/fBloc/bloc-server"
+	flags "github.com/jessevdk/go-flags"
+)
+
+// 单进程运行http server与scheduler，所有依赖均使用进程内实现，
+// 无需启动rabbitMQ、mongo、minio、influxdb。数据在进程退出后即丢失，仅适用于开发、调试
+type Options struct {
+	AppName      string `long:"app_name" description:"the name of this app" required:"false" default:"dev"`
+	ServerHost   string `long:"server_host" description:"server listern ip" required:"false"`
+	ServerPort   int    `long:"server_port" description:"server listern port" required:"false"`
+	UserName     string `long:"user_name" description:"admin user name" required:"false"`
+	UserPassword string `long:"user_password" description:"admin user password" required:"false"`
+}
+
+func main() {
+	var opts Options
+	parser := flags.NewParser(&opts, flags.Default)
+	_, err := parser.Parse()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	blocApp := &bloc.BlocApp{Name: opts.AppName}
+
+	serverHost := opts.ServerHost
+	if serverHost == "" {
+		serverHost = "localhost"
+	}
+	serverPort := opts.ServerPort
+	if serverPort == 0 {
+		serverPort = 8080
+	}
+
+	blocApp.GetConfigBuilder().
+		SetInMemory().
+		SetDefaultUser(opts.UserName, opts.UserPassword).
+		SetHttpServer(
+			serverHost, serverPort).
+		BuildUp()
+
+	blocApp.Run()
+}
@@ -9,4 +9,32 @@ const (
 	FlowFunctionStartID    = "0"
 	FunctionReportInterval = time.Second * 30 // this interval is register function interval, not heartbeat interval
 	FunctionReportTimeout  = 3 * FunctionReportInterval
+
+	FutureEventDispatchInterval  = time.Second // 检查未来事件是否到期的间隔
+	FutureEventDispatchBatchSize = 1000        // 每轮最多发布的到期事件数，避免一轮占用过久
+
+	FunctionRunTimeoutCheckInterval = 5 * time.Second // 检查function运行是否超过截止时间的间隔
+
+	RunStatusStreamHeartbeatInterval = 15 * time.Second // 推送运行状态的长连接发送心跳的间隔，防止被代理断开
+
+	NotificationDeliverTimeout       = 10 * time.Second // 单次投递通知的超时时长
+	NotificationDeliverMaxAttempts   = 5                // 通知最多投递的次数（含首次）
+	NotificationDeliverRetryInterval = 10 * time.Second // 通知首次重试前等待的时长，之后每次翻倍
+
+	BuiltinHttpRequestTimeout      = 30 * time.Second // 内置http_request function单次请求的超时时长
+	BuiltinHttpRequestMaxBodyBytes = 10 << 20         // 内置http_request function最多读取的响应体字节数，超出视为运行失败
+
+	FlowLockTTL           = time.Minute      // 不允许并行运行的flow的锁的有效期，持有期间由watcher续期
+	FlowLockWatchInterval = 20 * time.Second // 续期/释放flow锁及唤起排队运行的间隔，需小于FlowLockTTL
+
+	CrontabWatchInterval         = time.Minute     // 检查crontab flow是否需要触发的最长间隔，有更早到期的计划时间时提前检查
+	CrontabMisfireThreshold      = 2 * time.Minute // 计划时间距今超过此时长还未触发的，才视为错过
+	CrontabMisfireMaxLookback    = 24 * time.Hour  // 最多往前追溯此时长内错过的计划时间
+	CrontabMisfireDefaultMaxRuns = 10              // fire_all策略未设置最多补发次数时的默认值
+
+	CrontabPreviewDefaultAmount    = 10                 // 预览crontab接下来的计划时间时默认返回的个数
+	CrontabPreviewMaxAmount        = 100                // 预览crontab接下来的计划时间时最多返回的个数
+	CrontabCalendarDefaultWindow   = 24 * time.Hour     // 计划日历未指定结束时间时查看的时长
+	CrontabCalendarMaxWindow       = 7 * 24 * time.Hour // 计划日历最多查看的时长
+	CrontabCalendarMaxTimesPerFlow = 1000               // 计划日历中每个flow最多列出的计划时间个数，按小时的统计不受限制
 )
@@ -1,6 +1,11 @@
 package bloc
 
+import "github.com/fBloc/bloc-server/event"
+
 func (blocApp *BlocApp) RunScheduler() {
+	// 运行记录的状态变化都会发布事件，需在各个consumer/watcher使用仓库之前注入
+	event.InjectMq(blocApp.GetOrCreateEventMQ())
+
 	// 监听发布flow运行任务消息的consumer
 	go blocApp.FlowTaskStartConsumer()
 
@@ -10,6 +15,27 @@ func (blocApp *BlocApp) RunScheduler() {
 	//监听是否有运行中途因为各项原因退出了的function，触发其重新运行
 	go blocApp.RePubDeadRuns()
 
+	// 检查运行超时的function
+	go blocApp.FunctionRunTimeoutWatcher()
+
+	// flow运行结束后按照通知规则创建通知
+	go blocApp.FlowTaskFinishedConsumer()
+
+	// flow运行结束后触发依赖了它的下游flow
+	go blocApp.FlowDependencyTriggerConsumer()
+
+	// 投递通知，失败时重试
+	go blocApp.NotificationDeliverConsumer()
+
+	// 不允许并行运行的flow，运行结束后释放锁并唤起排队中的运行
+	go blocApp.FlowLockReleaseConsumer()
+
+	// 续期/释放不允许并行运行的flow的锁
+	go blocApp.FlowLockWatcher()
+
 	// crontab watcher
 	go blocApp.CrontabWatcher()
+
+	// 发布到期的未来事件（重试、延迟检查等）
+	go blocApp.FutureEventDispatcher()
 }
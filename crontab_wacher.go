@@ -1,75 +1,143 @@
 package bloc
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/config"
 	"github.com/fBloc/bloc-server/event"
 	"github.com/fBloc/bloc-server/value_object"
 )
 
-// CrontabWatcher 分钟接别的观测配置了crontab的flow并进行发起
+// CrontabWatcher 观测配置了crontab的flow并进行发起。
+// 启动时先处理一次，按照flow的错过策略补发停机期间错过的计划时间；
+// 之后睡眠到最早的下一个计划时间(支持秒级)，最长睡眠CrontabWatchInterval以加载修改了的配置
 func (blocApp *BlocApp) CrontabWatcher() {
+	now := time.Now()
+	for {
+		wakeAt := now.Add(config.CrontabWatchInterval)
+		nextDue := blocApp.fireCrontabFlows(now)
+		if !nextDue.IsZero() && nextDue.Before(wakeAt) {
+			wakeAt = nextDue
+		}
+		time.Sleep(time.Until(wakeAt))
+		now = time.Now()
+	}
+}
+
+// fireCrontabFlows 发布now时到期的crontab flow运行，返回最早的下一个计划时间
+func (blocApp *BlocApp) fireCrontabFlows(now time.Time) (nextDue time.Time) {
 	flowRepo := blocApp.GetOrCreateFlowRepository()
-	flowRunRecordRepo := blocApp.GetOrCreateFlowRunRecordRepository()
 	logger := blocApp.GetOrCreateScheduleLogger()
 
-	ticker := time.NewTicker(time.Minute)
-	defer ticker.Stop()
-	for range ticker.C {
-		crontabFlows, err := flowRepo.FilterCrontabFlows()
-		if err != nil {
-			logger.Errorf(
-				map[string]string{},
-				"Error on filter crontab flows: %s", err.Error())
-			continue
+	crontabFlows, err := flowRepo.FilterCrontabFlows()
+	if err != nil {
+		logger.Errorf(
+			map[string]string{},
+			"Error on filter crontab flows: %s", err.Error())
+		return
+	}
+
+	for _, flowIns := range crontabFlows {
+		if next := flowIns.Crontab.Next(now); !next.IsZero() &&
+			(nextDue.IsZero() || next.Before(nextDue)) {
+			nextDue = next
 		}
 
-		now := time.Now()
-		for _, flowIns := range crontabFlows {
-			// ToEnhance 池化，避免要发布的太多、一下子起的goroutine太多。（优先级-低）
-			go func(flowIns aggregate.Flow, crontabTrigTime time.Time) {
-				// 时间若不符合crontab规则，则不发布运行任务
-				if !flowIns.Crontab.TimeMatched(now) {
-					logger.Infof(
-						map[string]string{},
-						"flow: %s's crontab config: %s not match the time: %s",
-						flowIns.Name, flowIns.Crontab.CrontabStr, now.Format(time.RFC3339))
-					return
-				}
+		// ToEnhance 池化，避免要发布的太多、一下子起的goroutine太多。（优先级-低）
+		go func(flowIns aggregate.Flow) {
+			toFire, skippedAmount, lastDue := flowIns.CrontabTimesToFire(now)
+			if lastDue.IsZero() { // 时间若不符合crontab规则，则不发布运行任务
+				return
+			}
+			logTags := map[string]string{
+				string(value_object.SpanID): value_object.NewSpanID(),
+				"business":                  "crontab publish flow to run",
+				"flow_id":                   flowIns.ID.String()}
+			if skippedAmount > 0 {
+				logger.Infof(logTags,
+					"flow:%s's crontab config: %s skipped %d missed time with misfire policy %s",
+					flowIns.Name, flowIns.Crontab.CrontabStr, skippedAmount, flowIns.MisfirePolicy())
+			}
 
-				traceID := value_object.NewTraceID()
-				spanID := value_object.NewSpanID()
-				logTags := map[string]string{
-					string(value_object.TraceID): traceID,
-					string(value_object.SpanID):  spanID,
-					"business":                   "crontab publish flow to run",
-					"flow_id":                    flowIns.ID.String()}
-				logger.Infof(
-					logTags,
-					"flow:%s's crontab config: %s match time: %s",
-					flowIns.Name, flowIns.Crontab.CrontabStr, now.Format(time.RFC3339))
+			for _, crontabTrigTime := range toFire {
+				blocApp.fireCrontabFlow(&flowIns, crontabTrigTime)
+			}
 
-				// 符合就发布运行任务
-				ctx := value_object.SetTraceIDToContext(traceID)
-				flowRunRecord := aggregate.NewCrontabTriggeredRunRecord(ctx, &flowIns)
-				created, err := flowRunRecordRepo.CrontabFindOrCreate(flowRunRecord, crontabTrigTime)
-				if err != nil {
-					logger.Errorf(logTags, "create flow_run_record failed: %v", err)
-					return
-				}
-				if !created { // 创建失败、表示存在同crontab_flag创建的文档，不能重复发布
-					logger.Infof(logTags, "already created")
-					return
-				}
+			// 多个调度同时处理时，通过CrontabFindOrCreate保证同一计划时间只会发布一次
+			err := flowRepo.PatchCrontabLastFiredTime(flowIns.ID, lastDue)
+			if err != nil {
+				logger.Errorf(logTags, "save crontab last fired time failed: %v", err)
+			}
+		}(flowIns)
+	}
+	return nextDue
+}
 
-				err = event.PubEvent(&event.FlowToRun{FlowRunRecordID: flowRunRecord.ID})
-				if err != nil {
-					logger.Errorf(logTags, "pub flow to run event failed: %v", err)
-				} else {
-					logger.Infof(logTags, "suc pub flow_run_record. id: %s", flowRunRecord.ID.String())
-				}
-			}(flowIns, now)
+// fireCrontabFlow 发布flow在某个crontab计划时间的运行
+func (blocApp *BlocApp) fireCrontabFlow(
+	flowIns *aggregate.Flow, crontabTrigTime time.Time,
+) {
+	flowRunRecordRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+	logger := blocApp.GetOrCreateScheduleLogger()
+
+	traceID := value_object.NewTraceID()
+	spanID := value_object.NewSpanID()
+	logTags := map[string]string{
+		string(value_object.TraceID): traceID,
+		string(value_object.SpanID):  spanID,
+		"business":                   "crontab publish flow to run",
+		"flow_id":                    flowIns.ID.String()}
+	logger.Infof(
+		logTags,
+		"flow:%s's crontab config: %s match time: %s",
+		flowIns.Name, flowIns.Crontab.CrontabStr, crontabTrigTime.Format(time.RFC3339))
+
+	// 符合就发布运行任务
+	ctx := value_object.SetTraceIDToContext(traceID)
+	flowRunRecord := aggregate.NewCrontabTriggeredRunRecord(ctx, flowIns)
+	// crontab触发不提供参数值，flow参数全部使用默认值
+	params, paramsErr := flowIns.ResolveParams(nil)
+	flowRunRecord.Params = params
+	created, err := flowRunRecordRepo.CrontabFindOrCreate(flowRunRecord, crontabTrigTime)
+	if err != nil {
+		logger.Errorf(logTags, "create flow_run_record failed: %v", err)
+		return
+	}
+	if !created { // 创建失败、表示存在同crontab_flag创建的文档，不能重复发布
+		logger.Infof(logTags, "already created")
+		return
+	}
+	// 存在必填且没有默认值的参数时无法运行，直接失败而不是以空值运行
+	if paramsErr != nil {
+		logger.Warningf(logTags, "params not valid: %v", paramsErr)
+		blocApp.failUnfinishedFlowRun(
+			logger, logTags, flowRunRecord.ID, fmt.Sprintf("params not valid: %v", paramsErr))
+		return
+	}
+
+	// 暂停或处于禁止运行时段的，记录为跳过以便在运行历史中查看
+	if reason := flowIns.RunBlockedReason(
+		crontabTrigTime, blocApp.GlobalBlackoutWindows(),
+	); reason != "" {
+		logger.Infof(logTags, "skip run: %s", reason)
+		err = flowRunRecordRepo.ScheduleSkipped(flowRunRecord.ID, reason)
+		if err != nil {
+			logger.Errorf(logTags, "save flow_run_record schedule skipped failed: %v", err)
+			return
+		}
+		err = event.PubEvent(&event.FlowRunFinished{FlowRunRecordID: flowRunRecord.ID})
+		if err != nil {
+			logger.Errorf(logTags, "pub flow run finished event failed: %v", err)
 		}
+		return
+	}
+
+	err = event.PubEvent(&event.FlowToRun{FlowRunRecordID: flowRunRecord.ID})
+	if err != nil {
+		logger.Errorf(logTags, "pub flow to run event failed: %v", err)
+	} else {
+		logger.Infof(logTags, "suc pub flow_run_record. id: %s", flowRunRecord.ID.String())
 	}
 }
@@ -0,0 +1,47 @@
+package bloc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/event"
+	mq_memory "github.com/fBloc/bloc-server/infrastructure/mq/memory"
+	"github.com/fBloc/bloc-server/internal/crontab"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+	"github.com/fBloc/bloc-server/value_object"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFireCrontabFlowParams(t *testing.T) {
+	event.InjectMq(mq_memory.New())
+
+	newCrontabFlow := func(param *aggregate.FlowParam) *aggregate.Flow {
+		return &aggregate.Flow{
+			ID:       value_object.NewUUID(),
+			OriginID: value_object.NewUUID(),
+			Crontab:  &crontab.CrontabRepresent{CrontabStr: "* * * * *"},
+			Params:   []*aggregate.FlowParam{param}}
+	}
+	fire := func(flowIns *aggregate.Flow) *aggregate.FlowRunRecord {
+		blocApp := newInMemoryBlocApp()
+		blocApp.fireCrontabFlow(flowIns, time.Now())
+		flowRunIns, _ := blocApp.GetOrCreateFlowRunRecordRepository().GetLatestByFlowID(flowIns.ID)
+		return flowRunIns
+	}
+
+	Convey("params resolved by default value", t, func() {
+		flowRunIns := fire(newCrontabFlow(&aggregate.FlowParam{
+			Name: "unit", ValueType: value_type.StringValueType, DefaultValue: "kg"}))
+		So(flowRunIns.Params, ShouldResemble, map[string]interface{}{"unit": "kg"})
+		So(flowRunIns.Finished(), ShouldBeFalse)
+	})
+
+	Convey("required param without default value fails the run", t, func() {
+		flowRunIns := fire(newCrontabFlow(&aggregate.FlowParam{
+			Name: "amount", ValueType: value_type.IntValueType, Required: true}))
+		So(flowRunIns.Status, ShouldEqual, value_object.Fail)
+		So(flowRunIns.ErrorMsg, ShouldContainSubstring, "amount")
+	})
+}
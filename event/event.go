@@ -1,6 +1,7 @@
 package event
 
 import (
+	"reflect"
 	"time"
 
 	"github.com/fBloc/bloc-server/infrastructure/mq"
@@ -87,16 +88,42 @@ func ListenEvent(
 	if err != nil {
 		return errors.Wrap(err, "pull event failed")
 	}
+	unmarshalEvents(event, msgByteChan, respEventChan)
+	return nil
+}
+
+// ListenBroadcastEvent 监听某项事件，与ListenEvent不同的是每个调用的进程都会收到全部的事件
+// 用于需要在每个进程内分发的场景（如推送到本进程持有的连接），进程退出后其监听不会残留
+func ListenBroadcastEvent(
+	event DomainEvent,
+	respEventChan chan DomainEvent,
+) error {
+	if driver.mqIns == nil {
+		panic(needInitialMqInsAsEventChannelError)
+	}
 
+	msgByteChan := make(chan []byte)
+	err := driver.mqIns.PullBroadcast(event.Topic(), msgByteChan)
+	if err != nil {
+		return errors.Wrap(err, "pull broadcast event failed")
+	}
+	unmarshalEvents(event, msgByteChan, respEventChan)
+	return nil
+}
+
+// unmarshalEvents 每条消息解析到新的实例中，避免接收方还在使用时被下一条消息覆盖
+func unmarshalEvents(
+	event DomainEvent, msgByteChan chan []byte, respEventChan chan DomainEvent,
+) {
+	eventType := reflect.TypeOf(event).Elem()
 	go func() {
 		for msgByte := range msgByteChan {
-			err = event.Unmarshal(msgByte)
+			receivedEvent := reflect.New(eventType).Interface().(DomainEvent)
+			err := receivedEvent.Unmarshal(msgByte)
 			if err != nil {
 				panic(err)
 			}
-			respEventChan <- event
+			respEventChan <- receivedEvent
 		}
 	}()
-
-	return nil
 }
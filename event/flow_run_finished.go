@@ -3,6 +3,7 @@ package event
 import (
 	"encoding/json"
 
+	"github.com/fBloc/bloc-server/infrastructure/log"
 	"github.com/fBloc/bloc-server/value_object"
 )
 
@@ -32,3 +33,14 @@ func (event *FlowRunFinished) Unmarshal(data []byte) error {
 func (event *FlowRunFinished) Identity() string {
 	return event.FlowRunRecordID.String()
 }
+
+// PubFlowRunFinished flow运行记录进入终态(成功/失败/取消等)后发布运行完成事件，发布失败只记录日志
+func PubFlowRunFinished(
+	logger *log.Logger, logTags map[string]string,
+	flowRunRecordID value_object.UUID,
+) {
+	err := PubEvent(&FlowRunFinished{FlowRunRecordID: flowRunRecordID})
+	if err != nil {
+		logger.Errorf(logTags, "pub flow run finished event failed: %v", err)
+	}
+}
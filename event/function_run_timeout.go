@@ -0,0 +1,35 @@
+package event
+
+import (
+	"encoding/json"
+
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+func init() {
+	var _ DomainEvent = &FunctionRunTimeout{}
+}
+
+// FunctionRunTimeout function运行超过了截止时间，已被标记为超时取消
+type FunctionRunTimeout struct {
+	FunctionRunRecordID value_object.UUID
+}
+
+func (event *FunctionRunTimeout) Topic() string {
+	return "function_run_timeout"
+}
+
+// Marshal .
+func (event *FunctionRunTimeout) Marshal() ([]byte, error) {
+	return json.Marshal(event)
+}
+
+// Unmarshal .
+func (event *FunctionRunTimeout) Unmarshal(data []byte) error {
+	return json.Unmarshal(data, event)
+}
+
+// Identity
+func (event *FunctionRunTimeout) Identity() string {
+	return event.FunctionRunRecordID.String()
+}
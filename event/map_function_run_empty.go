@@ -0,0 +1,35 @@
+package event
+
+import (
+	"encoding/json"
+
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+func init() {
+	var _ DomainEvent = &MapFunctionRunEmpty{}
+}
+
+// MapFunctionRunEmpty map模式节点被展开的数组为空，没有子记录需要运行，父记录直接以空数组作为opt完成
+type MapFunctionRunEmpty struct {
+	FunctionRunRecordID value_object.UUID
+}
+
+func (event *MapFunctionRunEmpty) Topic() string {
+	return "map_function_run_empty"
+}
+
+// Marshal .
+func (event *MapFunctionRunEmpty) Marshal() ([]byte, error) {
+	return json.Marshal(event)
+}
+
+// Unmarshal .
+func (event *MapFunctionRunEmpty) Unmarshal(data []byte) error {
+	return json.Unmarshal(data, event)
+}
+
+// Identity
+func (event *MapFunctionRunEmpty) Identity() string {
+	return event.FunctionRunRecordID.String()
+}
@@ -0,0 +1,126 @@
+package memory_event_storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fBloc/bloc-server/event"
+)
+
+func init() {
+	var _ event.FuturePubEventStorage = &MemoryEventStorage{}
+}
+
+// MemoryEventStorage 事件按照(pub_time, record_time)升序保存
+type MemoryEventStorage struct {
+	events []*event.FutureEvent
+	sync.Mutex
+}
+
+func New() *MemoryEventStorage {
+	return &MemoryEventStorage{}
+}
+
+func (m *MemoryEventStorage) insert(futureEvent *event.FutureEvent) {
+	m.Lock()
+	defer m.Unlock()
+	index := sort.Search(len(m.events), func(i int) bool {
+		e := m.events[i]
+		if !e.PubTime.Equal(futureEvent.PubTime) {
+			return e.PubTime.After(futureEvent.PubTime)
+		}
+		return e.RecordTime.After(futureEvent.RecordTime)
+	})
+	m.events = append(m.events, nil)
+	copy(m.events[index+1:], m.events[index:])
+	m.events[index] = futureEvent
+}
+
+func (m *MemoryEventStorage) Add(
+	e event.DomainEvent, pubTime time.Time,
+) error {
+	eventData, err := e.Marshal()
+	if err != nil {
+		return err
+	}
+	m.insert(&event.FutureEvent{
+		Tag:        e.Topic(),
+		Data:       eventData,
+		PubTime:    pubTime,
+		RecordTime: time.Now(),
+	})
+	return nil
+}
+
+func (m *MemoryEventStorage) AddRaw(futureEvent *event.FutureEvent) error {
+	if futureEvent.IsZero() {
+		return nil
+	}
+	e := *futureEvent
+	if e.RecordTime.IsZero() {
+		e.RecordTime = time.Now()
+	}
+	m.insert(&e)
+	return nil
+}
+
+// countBeforeATime 需在持有锁时调用
+func (m *MemoryEventStorage) countBeforeATime(theTime time.Time) int {
+	return sort.Search(len(m.events), func(i int) bool {
+		return m.events[i].PubTime.After(theTime)
+	})
+}
+
+func (m *MemoryEventStorage) pop(index int) *event.FutureEvent {
+	e := m.events[index]
+	m.events = append(m.events[:index], m.events[index+1:]...)
+	return e
+}
+
+// PopLatestBeforeATime 发布特定时间之前的最晚的一条记录
+func (m *MemoryEventStorage) PopLatestBeforeATime(
+	theTime time.Time,
+) (tag string, data []byte, err error) {
+	m.Lock()
+	defer m.Unlock()
+	count := m.countBeforeATime(theTime)
+	if count == 0 {
+		return
+	}
+	e := m.pop(count - 1)
+	return e.Tag, e.Data, nil
+}
+
+// PopEarliestAfterATime 发布特定时间之后的最早的一条记录
+func (m *MemoryEventStorage) PopEarliestAfterATime(
+	theTime time.Time,
+) (tag string, data []byte, err error) {
+	m.Lock()
+	defer m.Unlock()
+	index := sort.Search(len(m.events), func(i int) bool {
+		return !m.events[i].PubTime.Before(theTime)
+	})
+	if index >= len(m.events) {
+		return
+	}
+	e := m.pop(index)
+	return e.Tag, e.Data, nil
+}
+
+func (m *MemoryEventStorage) PopEarliestBeforeATime(
+	theTime time.Time,
+) (*event.FutureEvent, error) {
+	m.Lock()
+	defer m.Unlock()
+	if m.countBeforeATime(theTime) == 0 {
+		return nil, nil
+	}
+	return m.pop(0), nil
+}
+
+func (m *MemoryEventStorage) CountBeforeATime(theTime time.Time) (int64, error) {
+	m.Lock()
+	defer m.Unlock()
+	return int64(m.countBeforeATime(theTime)), nil
+}
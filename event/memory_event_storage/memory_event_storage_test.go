@@ -0,0 +1,51 @@
+package memory_event_storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/event"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryEventStorage(t *testing.T) {
+	now := time.Now()
+	m := New()
+	for _, i := range []struct {
+		tag     string
+		pubTime time.Time
+	}{
+		{"later", now.Add(time.Minute)},
+		{"second", now.Add(-time.Second)},
+		{"first", now.Add(-time.Minute)},
+		{"third", now},
+	} {
+		m.AddRaw(&event.FutureEvent{Tag: i.tag, PubTime: i.pubTime})
+	}
+
+	Convey("count before", t, func() {
+		count, err := m.CountBeforeATime(now)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 3)
+	})
+
+	Convey("pop earliest before in order", t, func() {
+		for _, expect := range []string{"first", "second", "third"} {
+			e, err := m.PopEarliestBeforeATime(now)
+			So(err, ShouldBeNil)
+			So(e.Tag, ShouldEqual, expect)
+		}
+		e, err := m.PopEarliestBeforeATime(now)
+		So(err, ShouldBeNil)
+		So(e.IsZero(), ShouldBeTrue)
+	})
+
+	Convey("pop earliest after", t, func() {
+		tag, _, err := m.PopEarliestAfterATime(now)
+		So(err, ShouldBeNil)
+		So(tag, ShouldEqual, "later")
+
+		count, _ := m.CountBeforeATime(now.Add(time.Hour))
+		So(count, ShouldEqual, 0)
+	})
+}
@@ -7,6 +7,9 @@ import (
 	"github.com/fBloc/bloc-server/event"
 	"github.com/fBloc/bloc-server/internal/conns/mongodb"
 	"github.com/fBloc/bloc-server/internal/filter_options"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func init() {
@@ -29,6 +32,15 @@ func New(
 	if err != nil {
 		return nil, err
 	}
+
+	// 没有索引时每次拉取到期事件都会全表扫描
+	err = collection.CreateIndex([]mongo.IndexModel{
+		{Keys: bson.D{{Key: "pub_time", Value: 1}, {Key: "record_time", Value: 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return &MongoEventStorage{mongoCollection: collection}, nil
 }
 
@@ -36,7 +48,7 @@ type mongoFutureEvent struct {
 	Tag        string    `bson:"event_tag"`
 	EventData  []byte    `bson:"event_data"`
 	PubTime    time.Time `bson:"pub_time"`
-	recordTime time.Time `bson:"record_time"`
+	RecordTime time.Time `bson:"record_time"`
 }
 
 func NewFromEvent(
@@ -52,11 +64,23 @@ func NewFromEvent(
 		Tag:        e.Topic(),
 		EventData:  eventData,
 		PubTime:    pubTime,
-		recordTime: time.Now(),
+		RecordTime: time.Now(),
 	}
 	return &resp, nil
 }
 
+func (m mongoFutureEvent) ToFutureEvent() *event.FutureEvent {
+	if m.Tag == "" {
+		return nil
+	}
+	return &event.FutureEvent{
+		Tag:        m.Tag,
+		Data:       m.EventData,
+		PubTime:    m.PubTime,
+		RecordTime: m.RecordTime,
+	}
+}
+
 func (m *MongoEventStorage) Add(
 	event event.DomainEvent, pubTime time.Time,
 ) error {
@@ -69,6 +93,24 @@ func (m *MongoEventStorage) Add(
 	return err
 }
 
+func (m *MongoEventStorage) AddRaw(futureEvent *event.FutureEvent) error {
+	if futureEvent.IsZero() {
+		return nil
+	}
+	recordTime := futureEvent.RecordTime
+	if recordTime.IsZero() {
+		recordTime = time.Now()
+	}
+
+	_, err := m.mongoCollection.InsertOne(mongoFutureEvent{
+		Tag:        futureEvent.Tag,
+		EventData:  futureEvent.Data,
+		PubTime:    futureEvent.PubTime,
+		RecordTime: recordTime,
+	})
+	return err
+}
+
 // PopLatestBeforeATime 发布特定时间之前的最晚的一条记录
 func (m *MongoEventStorage) PopLatestBeforeATime(
 	theTime time.Time,
@@ -102,3 +144,23 @@ func (m *MongoEventStorage) PopEarliestAfterATime(
 	data = resp.EventData
 	return
 }
+
+// PopEarliestBeforeATime 弹出到期事件中最早的一条。
+// 利用FindOneAndDelete的原子性，多个scheduler副本同时拉取时同一事件只会被一个副本拿到
+func (m *MongoEventStorage) PopEarliestBeforeATime(
+	theTime time.Time,
+) (*event.FutureEvent, error) {
+	var resp mongoFutureEvent
+	err := m.mongoCollection.FindOneAndDelete(
+		mongodb.NewFilter().AddLte("pub_time", theTime),
+		&filter_options.FilterOption{SortAscFields: []string{"pub_time", "record_time"}},
+		&resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.ToFutureEvent(), nil
+}
+
+func (m *MongoEventStorage) CountBeforeATime(theTime time.Time) (int64, error) {
+	return m.mongoCollection.Count(mongodb.NewFilter().AddLte("pub_time", theTime))
+}
@@ -0,0 +1,35 @@
+package event
+
+import (
+	"encoding/json"
+
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+func init() {
+	var _ DomainEvent = &NotificationToDeliver{}
+}
+
+// NotificationToDeliver 需要投递（含重试）的通知
+type NotificationToDeliver struct {
+	NotificationDeliveryID value_object.UUID
+}
+
+func (event *NotificationToDeliver) Topic() string {
+	return "notification_to_deliver"
+}
+
+// Marshal .
+func (event *NotificationToDeliver) Marshal() ([]byte, error) {
+	return json.Marshal(event)
+}
+
+// Unmarshal .
+func (event *NotificationToDeliver) Unmarshal(data []byte) error {
+	return json.Unmarshal(data, event)
+}
+
+// Identity
+func (event *NotificationToDeliver) Identity() string {
+	return event.NotificationDeliveryID.String()
+}
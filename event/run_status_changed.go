@@ -0,0 +1,61 @@
+package event
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+func init() {
+	var _ DomainEvent = &RunStatusChanged{}
+}
+
+// RunStatusChangeKind 运行状态变化的类型
+type RunStatusChangeKind string
+
+const (
+	FlowRunStatusChange       RunStatusChangeKind = "flow_run_status"
+	FunctionRunStartChange    RunStatusChangeKind = "function_run_start"
+	FunctionRunFinishChange   RunStatusChangeKind = "function_run_finish"
+	FunctionRunProgressChange RunStatusChangeKind = "function_run_progress"
+)
+
+// RunStatusChanged flow运行/其中的function运行的状态发生了变化，用于向前端等推送
+type RunStatusChanged struct {
+	Kind                RunStatusChangeKind   `json:"kind"`
+	FlowID              value_object.UUID     `json:"flow_id"`
+	FlowOriginID        value_object.UUID     `json:"flow_origin_id"`
+	FlowRunRecordID     value_object.UUID     `json:"flow_run_record_id"`
+	FunctionRunRecordID value_object.UUID     `json:"function_run_record_id"` // flow运行的状态变化时为空
+	FlowFunctionID      string                `json:"flow_function_id"`
+	Status              value_object.RunState `json:"status"`
+	ErrorMsg            string                `json:"error_msg"`
+	Progress            float32               `json:"progress"`
+	ProgressMsg         string                `json:"progress_msg"`
+	Time                time.Time             `json:"time"`
+}
+
+func (event *RunStatusChanged) Topic() string {
+	return "run_status_changed"
+}
+
+// Marshal .
+func (event *RunStatusChanged) Marshal() ([]byte, error) {
+	return json.Marshal(event)
+}
+
+// Unmarshal .
+func (event *RunStatusChanged) Unmarshal(data []byte) error {
+	return json.Unmarshal(data, event)
+}
+
+// Identity
+func (event *RunStatusChanged) Identity() string {
+	return event.FlowRunRecordID.String()
+}
+
+// IsFlowRunFinished 是否是flow运行进入了终态
+func (event *RunStatusChanged) IsFlowRunFinished() bool {
+	return event.Kind == FlowRunStatusChange && event.Status.IsRunFinished()
+}
@@ -2,8 +2,37 @@ package event
 
 import "time"
 
+// FutureEvent 存储中等待到点发布的事件
+type FutureEvent struct {
+	Tag        string
+	Data       []byte
+	PubTime    time.Time
+	RecordTime time.Time
+}
+
+func (fe *FutureEvent) IsZero() bool {
+	if fe == nil {
+		return true
+	}
+	return fe.Tag == ""
+}
+
+// Lag 事件实际发布时间相对于预期发布时间的延迟
+func (fe *FutureEvent) Lag(now time.Time) time.Duration {
+	if fe.IsZero() || now.Before(fe.PubTime) {
+		return 0
+	}
+	return now.Sub(fe.PubTime)
+}
+
 type FuturePubEventStorage interface {
 	Add(event DomainEvent, pubTime time.Time) error
+	// AddRaw 将已弹出但未能成功发布的事件原样放回
+	AddRaw(futureEvent *FutureEvent) error
 	PopLatestBeforeATime(theTime time.Time) (tag string, data []byte, err error)
 	PopEarliestAfterATime(theTime time.Time) (tag string, data []byte, err error)
+	// PopEarliestBeforeATime 弹出发布时间不晚于theTime的事件中最早的一条，没有则返回nil
+	PopEarliestBeforeATime(theTime time.Time) (*FutureEvent, error)
+	// CountBeforeATime 发布时间不晚于theTime的事件数目，即积压量
+	CountBeforeATime(theTime time.Time) (int64, error)
 }
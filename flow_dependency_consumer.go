@@ -0,0 +1,173 @@
+package bloc
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// FlowDependencyTriggerConsumer 监听flow运行结束事件，触发依赖了此flow且满足触发条件的下游flow运行
+func (blocApp *BlocApp) FlowDependencyTriggerConsumer() {
+	event.InjectMq(blocApp.GetOrCreateEventMQ())
+	logger := blocApp.GetOrCreateScheduleLogger()
+	flowRepo := blocApp.GetOrCreateFlowRepository()
+	flowRunRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+
+	flowRunFinishedEventChan := make(chan event.DomainEvent)
+	err := event.ListenEvent(
+		&event.FlowRunFinished{}, "flow_dependency_trigger_consumer",
+		flowRunFinishedEventChan)
+	if err != nil {
+		panic(err)
+	}
+
+	for flowRunFinishedEvent := range flowRunFinishedEventChan {
+		flowRunRecordStr := flowRunFinishedEvent.Identity()
+		logTags := map[string]string{
+			string(value_object.SpanID): value_object.NewSpanID(),
+			"business":                  "flow dependency trigger consumer",
+			"flow_run_record_id":        flowRunRecordStr}
+
+		flowRunRecordUuid, err := value_object.ParseToUUID(flowRunRecordStr)
+		if err != nil {
+			logger.Errorf(logTags,
+				"cannot parse identity:%s to uuid! error:%v", flowRunRecordStr, err)
+			continue
+		}
+		upstreamRunIns, err := flowRunRepo.GetByID(flowRunRecordUuid)
+		if err != nil || upstreamRunIns.IsZero() {
+			logger.Errorf(logTags, "flow_run_record_id find no record!")
+			continue
+		}
+		logTags[string(value_object.TraceID)] = upstreamRunIns.TraceID
+		if !upstreamRunIns.Finished() {
+			logger.Warningf(logTags, "flow_run_record not finished. breakout")
+			continue
+		}
+		// 作为子flow运行的只是父flow的一个节点，不触发依赖
+		if upstreamRunIns.TriggerSource == value_object.ArrangementTriggerSource {
+			continue
+		}
+
+		dependentFlows, err := flowRepo.FilterDependentFlows(upstreamRunIns.FlowOriginID)
+		if err != nil {
+			logger.Errorf(logTags, "filter dependent flows failed: %v", err)
+			continue
+		}
+
+		var upstreamOpts map[string]interface{}
+		for _, flowIns := range dependentFlows {
+			dependency := flowIns.MatchedDependency(upstreamRunIns.FlowOriginID, upstreamRunIns.Status)
+			if dependency == nil {
+				continue
+			}
+			if len(dependency.OptMappings) > 0 && upstreamOpts == nil {
+				upstreamOpts, err = blocApp.collectFlowRunOpts(upstreamRunIns)
+				if err != nil {
+					logger.Errorf(logTags, "collect upstream flow's opts failed: %v", err)
+					upstreamOpts = map[string]interface{}{}
+				}
+			}
+			blocApp.fireDependentFlow(&flowIns, upstreamRunIns, dependency.OverideIptParams(upstreamOpts))
+		}
+	}
+}
+
+// fireDependentFlow 发布依赖触发的flow运行，同一上游运行记录只会触发一次
+func (blocApp *BlocApp) fireDependentFlow(
+	flowIns *aggregate.Flow,
+	upstreamRunIns *aggregate.FlowRunRecord,
+	params map[string][][]interface{},
+) {
+	flowRunRecordRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+	logger := blocApp.GetOrCreateScheduleLogger()
+
+	traceID := value_object.NewTraceID()
+	logTags := map[string]string{
+		string(value_object.TraceID):  traceID,
+		string(value_object.SpanID):   value_object.NewSpanID(),
+		"business":                    "dependency publish flow to run",
+		"flow_id":                     flowIns.ID.String(),
+		"upstream_flow_run_record_id": upstreamRunIns.ID.String()}
+
+	ctx := value_object.SetTraceIDToContext(traceID)
+	flowRunRecord := aggregate.NewDependencyTriggeredFlowRunRecord(ctx, flowIns, upstreamRunIns, params)
+	// 依赖触发不提供flow参数值，全部使用默认值
+	flowParams, paramsErr := flowIns.ResolveParams(nil)
+	flowRunRecord.Params = flowParams
+	created, err := flowRunRecordRepo.DependencyFindOrCreate(flowRunRecord)
+	if err != nil {
+		logger.Errorf(logTags, "create flow_run_record failed: %v", err)
+		return
+	}
+	if !created { // 运行完成事件可能被发布多次，已经触发过的不能重复发布
+		logger.Infof(logTags, "already created")
+		return
+	}
+	// 存在必填且没有默认值的参数时无法运行，直接失败而不是以空值运行
+	if paramsErr != nil {
+		logger.Warningf(logTags, "params not valid: %v", paramsErr)
+		blocApp.failUnfinishedFlowRun(
+			logger, logTags, flowRunRecord.ID, fmt.Sprintf("params not valid: %v", paramsErr))
+		return
+	}
+
+	if reason := flowIns.RunBlockedReason(
+		flowRunRecord.TriggerTime, blocApp.GlobalBlackoutWindows(),
+	); reason != "" {
+		logger.Infof(logTags, "skip run: %s", reason)
+		err = flowRunRecordRepo.ScheduleSkipped(flowRunRecord.ID, reason)
+		if err != nil {
+			logger.Errorf(logTags, "save flow_run_record schedule skipped failed: %v", err)
+			return
+		}
+		event.PubFlowRunFinished(logger, logTags, flowRunRecord.ID)
+		return
+	}
+
+	err = event.PubEvent(&event.FlowToRun{FlowRunRecordID: flowRunRecord.ID})
+	if err != nil {
+		logger.Errorf(logTags, "pub flow to run event failed: %v", err)
+	} else {
+		logger.Infof(logTags, "suc pub flow_run_record. id: %s", flowRunRecord.ID.String())
+	}
+}
+
+// collectFlowRunOpts 收集flow运行记录中成功运行的末端节点的opt值（同名的以排序靠后的节点为准）
+func (blocApp *BlocApp) collectFlowRunOpts(
+	flowRunIns *aggregate.FlowRunRecord,
+) (map[string]interface{}, error) {
+	flowIns, err := blocApp.GetOrCreateFlowRepository().GetByID(flowRunIns.FlowID)
+	if err != nil {
+		return nil, err
+	}
+	if flowIns.IsZero() {
+		return nil, fmt.Errorf("flow(%s) not exist", flowRunIns.FlowID.String())
+	}
+	leafOpts, err := flowIns.LeafOpts(
+		flowRunIns, blocApp.GetOrCreateFunctionRunRecordRepository().GetByID)
+	if err != nil {
+		return nil, err
+	}
+	objectStorage := blocApp.GetOrCreateConsumerObjectStorage()
+
+	optKeyMapValue := make(map[string]interface{}, len(leafOpts))
+	for optKey, leafOpt := range leafOpts {
+		isKeyExist, data, err := objectStorage.Get(leafOpt.ObjectStorageKey)
+		if err != nil {
+			return nil, err
+		}
+		if !isKeyExist {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		optKeyMapValue[optKey] = value
+	}
+	return optKeyMapValue, nil
+}
@@ -0,0 +1,556 @@
+package bloc
+
+import (
+	"sort"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/infrastructure/log"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// heldFlowLock 被运行中的记录持有的锁
+type heldFlowLock struct {
+	lock   *aggregate.FlowLock
+	holder *aggregate.FlowRunRecord
+}
+
+// collectHeldFlowLocks 获取flow限制范围内的槽位中，被运行中的记录持有的锁；
+// 持有者已结束但锁还未释放(未及时处理其完成事件)的，顺带释放
+func (blocApp *BlocApp) collectHeldFlowLocks(
+	logger *log.Logger, logTags map[string]string,
+	flowOriginID value_object.UUID, limit int,
+) (alreadyHeldBy map[value_object.UUID]bool, held []heldFlowLock, err error) {
+	flowLockRepo := blocApp.GetOrCreateFlowLockRepository()
+	flowRunRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+
+	locks, err := flowLockRepo.FilterByFlowOriginID(flowOriginID)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	alreadyHeldBy = make(map[value_object.UUID]bool, len(locks))
+	held = make([]heldFlowLock, 0, len(locks))
+	for _, lock := range locks {
+		if lock.Slot >= limit || !lock.IsHeldAt(now) {
+			continue
+		}
+		holderIns, err := flowRunRepo.GetByID(lock.HolderID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if holderIns.IsZero() || holderIns.Finished() {
+			_, err = flowLockRepo.Release(lock)
+			if err != nil {
+				logger.Errorf(logTags, "release flow lock of finished holder failed: %v", err)
+				return nil, nil, err
+			}
+			continue
+		}
+		alreadyHeldBy[lock.HolderID] = true
+		held = append(held, heldFlowLock{lock: lock, holder: holderIns})
+	}
+	return alreadyHeldBy, held, nil
+}
+
+// acquireFreeFlowSlot 尝试获取flow的一个空闲槽位
+func (blocApp *BlocApp) acquireFreeFlowSlot(
+	logger *log.Logger, logTags map[string]string,
+	flowRunIns *aggregate.FlowRunRecord, limit int, held []heldFlowLock,
+) bool {
+	flowLockRepo := blocApp.GetOrCreateFlowLockRepository()
+	heldSlots := make(map[int]bool, len(held))
+	for _, h := range held {
+		heldSlots[h.lock.Slot] = true
+	}
+	for slot := 0; slot < limit; slot++ {
+		if heldSlots[slot] {
+			continue
+		}
+		lock, acquired, err := flowLockRepo.Acquire(
+			flowRunIns.FlowOriginID, slot, flowRunIns.ID, config.FlowLockTTL)
+		if err != nil {
+			logger.Errorf(logTags, "acquire flow lock of slot %d failed: %v", slot, err)
+			return false
+		}
+		if !acquired {
+			continue
+		}
+		logger.Infof(logTags,
+			"acquired flow lock of slot %d with version %d", slot, lock.Version)
+		// 记录获取到的版本，之后的状态变更以此确认仍持有锁
+		err = blocApp.GetOrCreateFlowRunRecordRepository().SaveFlowLockVersion(
+			flowRunIns.ID, lock.Version)
+		if err != nil {
+			logger.Errorf(logTags, "save flow lock version failed: %v", err)
+			if _, err := flowLockRepo.Release(lock); err != nil {
+				logger.Errorf(logTags, "release flow lock failed: %v", err)
+			}
+			return false
+		}
+		flowRunIns.FlowLockVersion = lock.Version
+		return true
+	}
+	return false
+}
+
+// ensureFlowRunHoldsLock 运行推进状态(开始运行、发布function运行)前确认仍以获取时的版本持有锁，
+// 已失去锁的运行不再推进，还未结束的使其失败
+func (blocApp *BlocApp) ensureFlowRunHoldsLock(
+	logger *log.Logger, logTags map[string]string,
+	flowRunIns *aggregate.FlowRunRecord,
+) bool {
+	if flowRunIns.FlowLockVersion == 0 { // 没有获取过锁的运行
+		return true
+	}
+	locks, err := blocApp.GetOrCreateFlowLockRepository().FilterByFlowOriginID(flowRunIns.FlowOriginID)
+	if err != nil {
+		logger.Errorf(logTags, "filter flow locks failed: %v", err)
+		return false
+	}
+	if aggregate.FlowRunHoldsLock(locks, flowRunIns, time.Now()) {
+		return true
+	}
+	logger.Warningf(logTags,
+		"lost flow lock of version %d. stop advancing", flowRunIns.FlowLockVersion)
+	blocApp.failUnfinishedFlowRun(logger, logTags, flowRunIns.ID, "lost flow lock")
+	return false
+}
+
+// failUnfinishedFlowRun 使还未结束的运行失败（已被取代等已结束的不做处理）
+func (blocApp *BlocApp) failUnfinishedFlowRun(
+	logger *log.Logger, logTags map[string]string,
+	flowRunRecordID value_object.UUID, errorMsg string,
+) {
+	flowRunRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+	flowRunIns, err := flowRunRepo.GetByID(flowRunRecordID)
+	if err != nil {
+		logger.Errorf(logTags, "get flow_run_record failed: %v", err)
+		return
+	}
+	if flowRunIns.IsZero() || flowRunIns.Finished() {
+		return
+	}
+	err = flowRunRepo.Fail(flowRunRecordID, errorMsg)
+	if err != nil {
+		logger.Errorf(logTags, "save flow_run_record fail failed: %v", err)
+		return
+	}
+	event.PubFlowRunFinished(logger, logTags, flowRunRecordID)
+}
+
+// acquireFlowLock 限制了并发运行数的flow在运行前获取一个槽位的锁，
+// 没有空闲槽位时按照flow配置的冲突处理方式处理此次运行，返回此次运行是否可以继续
+func (blocApp *BlocApp) acquireFlowLock(
+	logger *log.Logger, logTags map[string]string,
+	flowIns *aggregate.Flow, flowRunIns *aggregate.FlowRunRecord,
+) bool {
+	flowLockRepo := blocApp.GetOrCreateFlowLockRepository()
+	flowRunRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+	limit := flowIns.ConcurrencyLimit()
+
+	alreadyHeldBy, held, err := blocApp.collectHeldFlowLocks(
+		logger, logTags, flowRunIns.FlowOriginID, limit)
+	if err != nil {
+		logger.Errorf(logTags, "collect held flow locks failed: %v", err)
+		return false
+	}
+	if alreadyHeldBy[flowRunIns.ID] { // 重复收到的运行事件
+		return true
+	}
+	if blocApp.acquireFreeFlowSlot(logger, logTags, flowRunIns, limit, held) {
+		return true
+	}
+
+	switch flowIns.ConflictStrategy() {
+	case value_object.QueueNewRun:
+		err = flowRunRepo.InQueue(flowRunIns.ID)
+		if err != nil {
+			logger.Errorf(logTags, "save flow_run_record in queue failed: %v", err)
+		} else {
+			logger.Infof(logTags, "in queue because reached max concurrent runs")
+		}
+		return false
+	case value_object.KeepLatestPending:
+		err = flowRunRepo.InQueue(flowRunIns.ID)
+		if err != nil {
+			logger.Errorf(logTags, "save flow_run_record in queue failed: %v", err)
+			return false
+		}
+		logger.Infof(logTags, "in queue because reached max concurrent runs")
+		blocApp.dropStalePendingFlowRuns(logger, logTags, flowRunIns)
+		return false
+	case value_object.ReplaceOldRun:
+		if len(held) > 0 {
+			// 取代最早开始运行的
+			sort.Slice(held, func(i, j int) bool {
+				return held[i].holder.StartTime.Before(held[j].holder.StartTime)
+			})
+			oldest := held[0]
+			// 先以获取时的版本释放锁，释放成功才说明其仍是此槽位的持有者，避免取代了已不持有锁的运行
+			released, err := flowLockRepo.Release(oldest.lock)
+			if err != nil {
+				logger.Errorf(logTags, "release flow lock of replaced holder failed: %v", err)
+				return false
+			}
+			if released {
+				err = blocApp.cancelReplacedFlowRun(logger, logTags, oldest.holder.ID, flowRunIns.ID)
+				if err != nil {
+					logger.Errorf(logTags, "cancel replaced flow_run_record failed: %v", err)
+					return false
+				}
+				logger.Infof(logTags, "replaced running flow_run_record %s", oldest.holder.ID.String())
+			}
+			if blocApp.acquireFreeFlowSlot(logger, logTags, flowRunIns, limit, held[1:]) {
+				return true
+			}
+		}
+		// 释放后被其他运行抢先获取了，排队等待而不是丢弃
+		err = flowRunRepo.InQueue(flowRunIns.ID)
+		if err != nil {
+			logger.Errorf(logTags, "save flow_run_record in queue failed: %v", err)
+		}
+		return false
+	default:
+		logger.Infof(logTags, "won't run because reached max concurrent runs")
+		err = flowRunRepo.NotAllowedParallelRun(flowRunIns.ID)
+		if err != nil {
+			logger.Errorf(logTags, "save flowRunRepo.NotAllowedParallelRun failed: %v", err)
+		} else {
+			event.PubFlowRunFinished(logger, logTags, flowRunIns.ID)
+		}
+		return false
+	}
+}
+
+// cancelReplacedFlowRun 取消被取代的运行：还未结束的function运行标记为取消，
+// 由其中的子flow节点触发的、还未结束的子flow运行递归取消
+func (blocApp *BlocApp) cancelReplacedFlowRun(
+	logger *log.Logger, logTags map[string]string,
+	replacedID, byFlowRunRecordID value_object.UUID,
+) error {
+	flowRunRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+	funcRunRecordRepo := blocApp.GetOrCreateFunctionRunRecordRepository()
+
+	err := flowRunRepo.ReplacedCancel(replacedID, byFlowRunRecordID)
+	if err != nil {
+		return err
+	}
+	event.PubFlowRunFinished(logger, logTags, replacedID)
+
+	funcRunRecords, err := funcRunRecordRepo.FilterByFlowRunRecordID(replacedID)
+	if err != nil {
+		return err
+	}
+	for _, i := range funcRunRecords {
+		if i.Finished() {
+			continue
+		}
+		err = funcRunRecordRepo.SaveCancel(i.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	notFinishedStatus := make([]interface{}, 0, len(value_object.NotFinishedRunStatus()))
+	for _, i := range value_object.NotFinishedRunStatus() {
+		notFinishedStatus = append(notFinishedStatus, i)
+	}
+	subFlowRuns, err := flowRunRepo.Filter(
+		*value_object.NewRepositoryFilter().
+			AddEqual("arrangement_task_id", replacedID.String()).
+			AddIn("status", notFinishedStatus),
+		*value_object.NewRepositoryFilterOption())
+	if err != nil {
+		return err
+	}
+	for _, i := range subFlowRuns {
+		err = blocApp.cancelReplacedFlowRun(logger, logTags, i.ID, byFlowRunRecordID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropStalePendingFlowRuns 只保留最新的排队运行，放弃同一flow之前排队的运行
+func (blocApp *BlocApp) dropStalePendingFlowRuns(
+	logger *log.Logger, logTags map[string]string,
+	latestFlowRunIns *aggregate.FlowRunRecord,
+) {
+	flowRunRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+	queued, err := flowRunRepo.Filter(
+		*value_object.NewRepositoryFilter().
+			AddEqual("flow_origin_id", latestFlowRunIns.FlowOriginID).
+			AddEqual("status", value_object.InQueue),
+		*value_object.NewRepositoryFilterOption())
+	if err != nil {
+		logger.Errorf(logTags, "filter in queue flow_run_record failed: %v", err)
+		return
+	}
+	for _, flowRunIns := range queued {
+		if flowRunIns.ID == latestFlowRunIns.ID {
+			continue
+		}
+		// 先通过条件出队占有此排队运行，避免与同时发生的出队唤起冲突
+		dequeued, err := flowRunRepo.Dequeue(flowRunIns.ID)
+		if err != nil {
+			logger.Errorf(logTags, "dequeue flow_run_record failed: %v", err)
+			continue
+		}
+		if !dequeued {
+			continue
+		}
+		err = flowRunRepo.NotAllowedParallelRun(flowRunIns.ID)
+		if err != nil {
+			logger.Errorf(logTags, "save flowRunRepo.NotAllowedParallelRun failed: %v", err)
+			continue
+		}
+		logger.Infof(logTags,
+			"dropped stale pending flow_run_record %s", flowRunIns.ID.String())
+		event.PubFlowRunFinished(logger, logTags, flowRunIns.ID)
+	}
+}
+
+// releaseFlowLockAndDequeue 运行结束后释放其持有的锁，并按空闲槽位数唤起此flow最早排队的运行
+func (blocApp *BlocApp) releaseFlowLockAndDequeue(
+	logger *log.Logger, logTags map[string]string,
+	flowRunIns *aggregate.FlowRunRecord,
+) {
+	flowLockRepo := blocApp.GetOrCreateFlowLockRepository()
+	locks, err := flowLockRepo.FilterByFlowOriginID(flowRunIns.FlowOriginID)
+	if err != nil {
+		logger.Errorf(logTags, "filter flow locks failed: %v", err)
+		return
+	}
+	for _, lock := range locks {
+		if lock.HolderID != flowRunIns.ID {
+			continue
+		}
+		released, err := flowLockRepo.Release(lock)
+		if err != nil {
+			logger.Errorf(logTags, "release flow lock failed: %v", err)
+			return
+		}
+		if released {
+			logger.Infof(logTags, "released flow lock of slot %d", lock.Slot)
+		}
+	}
+
+	blocApp.dequeueFlowRuns(logger, logTags, flowRunIns.FlowID, flowRunIns.FlowOriginID)
+}
+
+// dequeueFlowRuns 按照flow的空闲槽位数唤起其最早排队的运行
+func (blocApp *BlocApp) dequeueFlowRuns(
+	logger *log.Logger, logTags map[string]string,
+	flowID, flowOriginID value_object.UUID,
+) {
+	flowIns, err := blocApp.GetOrCreateFlowRepository().GetByID(flowID)
+	if err != nil {
+		logger.Errorf(logTags, "get flow failed: %v", err)
+		return
+	}
+	filterOption := value_object.NewRepositoryFilterOption()
+	filterOption.SetAsc()
+	// 不再限制并发运行数(如配置被修改)时唤起全部排队的运行
+	if limit := flowIns.ConcurrencyLimit(); limit > 0 {
+		_, held, err := blocApp.collectHeldFlowLocks(logger, logTags, flowOriginID, limit)
+		if err != nil {
+			logger.Errorf(logTags, "collect held flow locks failed: %v", err)
+			return
+		}
+		freeSlotAmount := limit - len(held)
+		if freeSlotAmount <= 0 {
+			return
+		}
+		filterOption.SetLimit(freeSlotAmount)
+	}
+
+	flowRunRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+	queued, err := flowRunRepo.Filter(
+		*value_object.NewRepositoryFilter().
+			AddEqual("flow_origin_id", flowOriginID).
+			AddEqual("status", value_object.InQueue),
+		*filterOption)
+	if err != nil {
+		logger.Errorf(logTags, "filter in queue flow_run_record failed: %v", err)
+		return
+	}
+	for _, flowRunIns := range queued {
+		// 出队是条件更新，保证同一条排队的运行只会被一方唤起
+		dequeued, err := flowRunRepo.Dequeue(flowRunIns.ID)
+		if err != nil {
+			logger.Errorf(logTags, "dequeue flow_run_record failed: %v", err)
+			continue
+		}
+		if !dequeued {
+			continue
+		}
+		err = event.PubEvent(&event.FlowToRun{FlowRunRecordID: flowRunIns.ID})
+		if err != nil {
+			logger.Errorf(logTags, "pub dequeued flow to run event failed: %v", err)
+			continue
+		}
+		logger.Infof(logTags, "dequeued flow_run_record %s", flowRunIns.ID.String())
+	}
+}
+
+// FlowLockReleaseConsumer flow运行结束后释放其持有的并发运行锁
+func (blocApp *BlocApp) FlowLockReleaseConsumer() {
+	event.InjectMq(blocApp.GetOrCreateEventMQ())
+	logger := blocApp.GetOrCreateScheduleLogger()
+	flowRunRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+
+	flowRunFinishedEventChan := make(chan event.DomainEvent)
+	err := event.ListenEvent(
+		&event.FlowRunFinished{}, "flow_lock_release_consumer",
+		flowRunFinishedEventChan)
+	if err != nil {
+		panic(err)
+	}
+
+	for flowRunFinishedEvent := range flowRunFinishedEventChan {
+		flowRunRecordStr := flowRunFinishedEvent.Identity()
+		logTags := map[string]string{
+			string(value_object.SpanID): value_object.NewSpanID(),
+			"business":                  "flow lock release consumer",
+			"flow_run_record_id":        flowRunRecordStr}
+
+		flowRunRecordUuid, err := value_object.ParseToUUID(flowRunRecordStr)
+		if err != nil {
+			logger.Errorf(logTags,
+				"cannot parse identity:%s to uuid! error:%v", flowRunRecordStr, err)
+			continue
+		}
+		flowRunIns, err := flowRunRepo.GetByID(flowRunRecordUuid)
+		if err != nil || flowRunIns.IsZero() {
+			logger.Errorf(logTags, "flow_run_record_id find no record!")
+			continue
+		}
+		logTags[string(value_object.TraceID)] = flowRunIns.TraceID
+
+		blocApp.releaseFlowLockAndDequeue(logger, logTags, flowRunIns)
+	}
+}
+
+// flowLockHolderAlive 持有者是否还在推进：有还未结束的function运行(运行中、等待重试、等待审批、等待子flow运行)，
+// 或距开始运行/最近一个function运行结束不超过锁的有效期
+func (blocApp *BlocApp) flowLockHolderAlive(
+	holderIns *aggregate.FlowRunRecord, now time.Time,
+) (bool, error) {
+	funcRunRecords, err := blocApp.GetOrCreateFunctionRunRecordRepository().
+		FilterByFlowRunRecordID(holderIns.ID)
+	if err != nil {
+		return false, err
+	}
+	lastActiveTime := holderIns.StartTime
+	for _, i := range funcRunRecords {
+		if !i.Finished() {
+			return true, nil
+		}
+		if i.End.After(lastActiveTime) {
+			lastActiveTime = i.End
+		}
+	}
+	return now.Sub(lastActiveTime) < config.FlowLockTTL, nil
+}
+
+// watchHeldFlowLocks 为还在推进的持有者续期锁；释放已结束持有者的锁；
+// 没有进展的持有者不再续期，其锁过期后释放槽位并使其失败
+func (blocApp *BlocApp) watchHeldFlowLocks(
+	logger *log.Logger, logTags map[string]string, now time.Time,
+) {
+	flowLockRepo := blocApp.GetOrCreateFlowLockRepository()
+	flowRunRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+
+	heldLocks, err := flowLockRepo.FilterHeld()
+	if err != nil {
+		logger.Errorf(logTags, "filter held flow locks failed: %v", err)
+		return
+	}
+	for _, lock := range heldLocks {
+		holderIns, err := flowRunRepo.GetByID(lock.HolderID)
+		if err != nil {
+			logger.Errorf(logTags, "get lock holder flow_run_record failed: %v", err)
+			continue
+		}
+		if holderIns.IsZero() || holderIns.Finished() {
+			_, err = flowLockRepo.Release(lock)
+			if err != nil {
+				logger.Errorf(logTags, "release flow lock failed: %v", err)
+			}
+			continue
+		}
+
+		alive, err := blocApp.flowLockHolderAlive(holderIns, now)
+		if err != nil {
+			logger.Errorf(logTags, "check lock holder alive failed: %v", err)
+			continue
+		}
+		if alive {
+			renewed, err := flowLockRepo.Renew(lock, config.FlowLockTTL)
+			if err != nil {
+				logger.Errorf(logTags, "renew flow lock failed: %v", err)
+			} else if !renewed {
+				logger.Warningf(logTags,
+					"renew flow lock of flow_run_record %s failed: lost the lock",
+					lock.HolderID.String())
+			}
+			continue
+		}
+		if lock.IsHeldAt(now) {
+			logger.Warningf(logTags,
+				"flow_run_record %s made no progress, stop renewing its flow lock",
+				lock.HolderID.String())
+			continue
+		}
+		released, err := flowLockRepo.Release(lock)
+		if err != nil {
+			logger.Errorf(logTags, "release expired flow lock failed: %v", err)
+			continue
+		}
+		if released {
+			logger.Warningf(logTags,
+				"released expired flow lock of stalled flow_run_record %s", lock.HolderID.String())
+			blocApp.failUnfinishedFlowRun(
+				logger, logTags, lock.HolderID, "flow lock expired without progress")
+		}
+	}
+}
+
+// FlowLockWatcher 维护被持有的锁(见watchHeldFlowLocks)；
+// 唤起有空闲槽位却还在排队中的运行(排队与释放同时发生时可能错过唤起)
+func (blocApp *BlocApp) FlowLockWatcher() {
+	event.InjectMq(blocApp.GetOrCreateEventMQ())
+	logger := blocApp.GetOrCreateScheduleLogger()
+	flowRunRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+
+	ticker := time.NewTicker(config.FlowLockWatchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		logTags := map[string]string{
+			string(value_object.SpanID): value_object.NewSpanID(),
+			"business":                  "flow lock watcher"}
+
+		blocApp.watchHeldFlowLocks(logger, logTags, time.Now())
+
+		queued, err := flowRunRepo.Filter(
+			*value_object.NewRepositoryFilter().AddEqual("status", value_object.InQueue),
+			*value_object.NewRepositoryFilterOption())
+		if err != nil {
+			logger.Errorf(logTags, "filter in queue flow_run_record failed: %v", err)
+			continue
+		}
+		checkedFlowOriginIDs := make(map[value_object.UUID]struct{}, len(queued))
+		for _, flowRunIns := range queued {
+			if _, ok := checkedFlowOriginIDs[flowRunIns.FlowOriginID]; ok {
+				continue
+			}
+			checkedFlowOriginIDs[flowRunIns.FlowOriginID] = struct{}{}
+			blocApp.dequeueFlowRuns(
+				logger, logTags, flowRunIns.FlowID, flowRunIns.FlowOriginID)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package bloc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/infrastructure/log"
+	log_memory "github.com/fBloc/bloc-server/infrastructure/log_collect_backend/memory"
+	mq_memory "github.com/fBloc/bloc-server/infrastructure/mq/memory"
+	"github.com/fBloc/bloc-server/value_object"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newInMemoryBlocApp() *BlocApp {
+	blocApp := NewBlocApp("test")
+	blocApp.configBuilder = (&ConfigBuilder{}).SetInMemory()
+	return blocApp
+}
+
+// createLockHolder 创建运行中的flow运行记录并为其获取flow的槽位锁
+func createLockHolder(
+	blocApp *BlocApp, startTime time.Time, ttl time.Duration,
+) (*aggregate.FlowRunRecord, *aggregate.FlowLock) {
+	holder := &aggregate.FlowRunRecord{
+		ID:           value_object.NewUUID(),
+		FlowOriginID: value_object.NewUUID(),
+		Status:       value_object.Running,
+		StartTime:    startTime}
+	blocApp.GetOrCreateFlowRunRecordRepository().Create(holder)
+	lock, _, _ := blocApp.GetOrCreateFlowLockRepository().Acquire(
+		holder.FlowOriginID, 0, holder.ID, ttl)
+	holder.FlowLockVersion = lock.Version
+	blocApp.GetOrCreateFlowRunRecordRepository().SaveFlowLockVersion(holder.ID, lock.Version)
+	return holder, lock
+}
+
+func getFlowLock(blocApp *BlocApp, flowOriginID value_object.UUID) *aggregate.FlowLock {
+	locks, _ := blocApp.GetOrCreateFlowLockRepository().FilterByFlowOriginID(flowOriginID)
+	return locks[0]
+}
+
+func TestWatchHeldFlowLocks(t *testing.T) {
+	event.InjectMq(mq_memory.New())
+	logger := log.New("test", log_memory.New())
+
+	Convey("holder with running function is renewed", t, func() {
+		blocApp := newInMemoryBlocApp()
+		holder, lock := createLockHolder(blocApp, time.Now().Add(-time.Hour), config.FlowLockTTL)
+		blocApp.GetOrCreateFunctionRunRecordRepository().Create(&aggregate.FunctionRunRecord{
+			ID: value_object.NewUUID(), FlowRunRecordID: holder.ID, Start: time.Now()})
+
+		blocApp.watchHeldFlowLocks(logger, map[string]string{}, time.Now())
+		So(getFlowLock(blocApp, holder.FlowOriginID).ExpireTime.After(lock.ExpireTime), ShouldBeTrue)
+	})
+
+	Convey("stalled holder is not renewed", t, func() {
+		blocApp := newInMemoryBlocApp()
+		holder, lock := createLockHolder(blocApp, time.Now().Add(-time.Hour), config.FlowLockTTL)
+
+		blocApp.watchHeldFlowLocks(logger, map[string]string{}, time.Now())
+		So(getFlowLock(blocApp, holder.FlowOriginID).ExpireTime, ShouldEqual, lock.ExpireTime)
+		holderIns, _ := blocApp.GetOrCreateFlowRunRecordRepository().GetByID(holder.ID)
+		So(holderIns.Finished(), ShouldBeFalse)
+
+		Convey("and is failed once its lock expired", func() {
+			blocApp.watchHeldFlowLocks(
+				logger, map[string]string{}, time.Now().Add(2*config.FlowLockTTL))
+			So(getFlowLock(blocApp, holder.FlowOriginID).HolderID.IsNil(), ShouldBeTrue)
+			holderIns, _ := blocApp.GetOrCreateFlowRunRecordRepository().GetByID(holder.ID)
+			So(holderIns.Status, ShouldEqual, value_object.Fail)
+		})
+	})
+}
+
+func TestEnsureFlowRunHoldsLock(t *testing.T) {
+	event.InjectMq(mq_memory.New())
+	logger := log.New("test", log_memory.New())
+
+	Convey("holds", t, func() {
+		blocApp := newInMemoryBlocApp()
+		holder, _ := createLockHolder(blocApp, time.Now(), config.FlowLockTTL)
+		So(blocApp.ensureFlowRunHoldsLock(logger, map[string]string{}, holder), ShouldBeTrue)
+	})
+
+	Convey("lock taken by other run", t, func() {
+		blocApp := newInMemoryBlocApp()
+		holder, _ := createLockHolder(blocApp, time.Now(), -time.Second)
+		blocApp.GetOrCreateFlowLockRepository().Acquire(
+			holder.FlowOriginID, 0, value_object.NewUUID(), config.FlowLockTTL)
+
+		So(blocApp.ensureFlowRunHoldsLock(logger, map[string]string{}, holder), ShouldBeFalse)
+		holderIns, _ := blocApp.GetOrCreateFlowRunRecordRepository().GetByID(holder.ID)
+		So(holderIns.Status, ShouldEqual, value_object.Fail)
+	})
+}
+
+func TestCancelReplacedFlowRun(t *testing.T) {
+	event.InjectMq(mq_memory.New())
+	logger := log.New("test", log_memory.New())
+
+	Convey("running function runs and sub flow runs are canceled", t, func() {
+		blocApp := newInMemoryBlocApp()
+		flowRunRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+		funcRunRecordRepo := blocApp.GetOrCreateFunctionRunRecordRepository()
+		replaced, _ := createLockHolder(blocApp, time.Now(), config.FlowLockTTL)
+		running := &aggregate.FunctionRunRecord{
+			ID: value_object.NewUUID(), FlowRunRecordID: replaced.ID, Start: time.Now()}
+		funcRunRecordRepo.Create(running)
+		subFlowRun := &aggregate.FlowRunRecord{
+			ID:                     value_object.NewUUID(),
+			ArrangementRunRecordID: replaced.ID.String(),
+			Status:                 value_object.Running}
+		flowRunRepo.Create(subFlowRun)
+		subFlowFunctionRun := &aggregate.FunctionRunRecord{
+			ID: value_object.NewUUID(), FlowRunRecordID: subFlowRun.ID, Start: time.Now()}
+		funcRunRecordRepo.Create(subFlowFunctionRun)
+
+		byID := value_object.NewUUID()
+		err := blocApp.cancelReplacedFlowRun(logger, map[string]string{}, replaced.ID, byID)
+		So(err, ShouldBeNil)
+
+		for _, id := range []value_object.UUID{replaced.ID, subFlowRun.ID} {
+			flowRunIns, _ := flowRunRepo.GetByID(id)
+			So(flowRunIns.Status, ShouldEqual, value_object.ReplacedCancel)
+			So(flowRunIns.Canceled, ShouldBeTrue)
+		}
+		for _, id := range []value_object.UUID{running.ID, subFlowFunctionRun.ID} {
+			funcRunIns, _ := funcRunRecordRepo.GetByID(id)
+			So(funcRunIns.Finished(), ShouldBeTrue)
+			So(funcRunIns.Canceled, ShouldBeTrue)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package bloc
+
+import (
+	"fmt"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// rerunFromFailure 从失败处重新运行：
+// 复制原运行中成功的function_run_record（及其opt在对象存储中的数据）到此次运行，只发布失败的及未运行的节点
+// 返回的finished为true表示没有需要再运行的节点
+func (blocApp *BlocApp) rerunFromFailure(
+	flowIns *aggregate.Flow, flowRunIns *aggregate.FlowRunRecord,
+) (finished bool, err error) {
+	flowRunRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+	funcRunRecordRepo := blocApp.GetOrCreateFunctionRunRecordRepository()
+	objectStorage := blocApp.GetOrCreateConsumerObjectStorage()
+
+	failedRunIns, err := flowRunRepo.GetByID(flowRunIns.RerunFromRecordID)
+	if err != nil {
+		return false, err
+	}
+	if failedRunIns.IsZero() {
+		return false, fmt.Errorf(
+			"rerun from flow_run_record(%s) not exist", flowRunIns.RerunFromRecordID.String())
+	}
+
+	flowFuncIDMapFuncRunRecordID := make(map[string]value_object.UUID)
+	flowFuncIDMapCopiedRecord := make(map[string]*aggregate.FunctionRunRecord)
+	for flowFunctionID, funcRunRecordID := range failedRunIns.FlowFuncIDMapFuncRunRecordID {
+		succeeded, err := funcRunRecordRepo.GetByID(funcRunRecordID)
+		if err != nil {
+			return false, err
+		}
+		if !succeeded.Finished() || !succeeded.Suc {
+			continue
+		}
+
+		copied := aggregate.NewRerunCopiedFunctionRunRecord(succeeded, flowRunIns)
+		for optKey, ossKey := range succeeded.Opt {
+			ossKeyStr, ok := ossKey.(string)
+			if !ok {
+				continue
+			}
+			exist, data, err := objectStorage.Get(ossKeyStr)
+			if err != nil {
+				return false, err
+			}
+			if !exist {
+				return false, fmt.Errorf(
+					"opt「%s」of flow_function(%s) not exist in object storage", optKey, flowFunctionID)
+			}
+			copiedKey := copied.ID.String() + "_" + optKey
+			err = objectStorage.Set(copiedKey, data)
+			if err != nil {
+				return false, err
+			}
+			copied.Opt[optKey] = copiedKey
+		}
+		err = funcRunRecordRepo.Create(copied)
+		if err != nil {
+			return false, err
+		}
+		flowFuncIDMapFuncRunRecordID[flowFunctionID] = copied.ID
+		flowFuncIDMapCopiedRecord[flowFunctionID] = copied
+	}
+
+	toRunFlowFunctionIDs := flowIns.RerunFlowFunctionIDs(
+		func(flowFunctionID string) *aggregate.FunctionRunRecord {
+			return flowFuncIDMapCopiedRecord[flowFunctionID]
+		})
+	toRunRecords := make([]*aggregate.FunctionRunRecord, 0, len(toRunFlowFunctionIDs))
+	traceCtx := value_object.SetTraceIDToContext(flowRunIns.TraceID)
+	for _, flowFunctionID := range toRunFlowFunctionIDs {
+		flowFunction := flowIns.FlowFunctionIDMapFlowFunction[flowFunctionID]
+		functionIns := blocApp.GetFunctionByRepoID(flowFunction.FunctionID)
+		if flowFunction.SubFlow != nil || flowFunction.Approval != nil {
+			functionIns = &aggregate.Function{Name: flowFunction.Name()}
+		} else if functionIns.IsZero() {
+			return false, fmt.Errorf("find no function of flow_function(%s)", flowFunctionID)
+		}
+		record := aggregate.NewFunctionRunRecordFromFlowDriven(
+			traceCtx, *functionIns, *flowRunIns, flowFunctionID)
+		err = funcRunRecordRepo.Create(record)
+		if err != nil {
+			return false, err
+		}
+		flowFuncIDMapFuncRunRecordID[flowFunctionID] = record.ID
+		toRunRecords = append(toRunRecords, record)
+	}
+
+	// 先保存全部的节点记录再发布，发布的节点运行时需要从中找到上游的记录
+	flowRunIns.FlowFuncIDMapFuncRunRecordID = flowFuncIDMapFuncRunRecordID
+	err = flowRunRepo.PatchFlowFuncIDMapFuncRunRecordID(flowRunIns.ID, flowFuncIDMapFuncRunRecordID)
+	if err != nil {
+		return false, err
+	}
+	err = flowRunRepo.Start(flowRunIns.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, record := range toRunRecords {
+		err = event.PubEvent(&event.FunctionToRun{FunctionRunRecordID: record.ID})
+		if err != nil {
+			return false, err
+		}
+	}
+	return len(toRunRecords) == 0, nil
+}
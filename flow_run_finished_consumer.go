@@ -2,17 +2,27 @@ package bloc
 
 import (
 	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/services/notification"
 	"github.com/fBloc/bloc-server/value_object"
 )
 
-// FlowTaskFinishedConsumer receive flow run finished event
+// FlowTaskFinishedConsumer receive flow run finished event,
+// 按照flow的通知规则创建需要投递的通知并发布投递事件
 func (blocApp *BlocApp) FlowTaskFinishedConsumer() {
 	event.InjectMq(blocApp.GetOrCreateEventMQ())
 	logger := blocApp.GetOrCreateScheduleLogger()
+	flowRepo := blocApp.GetOrCreateFlowRepository()
 	flowRunRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+	notificationService, err := notification.NewService(
+		notification.WithLogger(logger),
+		notification.WithNotificationDeliveryRepository(
+			blocApp.GetOrCreateNotificationDeliveryRepository()))
+	if err != nil {
+		panic(err)
+	}
 
 	flowRunFinishedEventChan := make(chan event.DomainEvent)
-	err := event.ListenEvent(
+	err = event.ListenEvent(
 		&event.FlowRunFinished{}, "flow_run_finished_consumer",
 		flowRunFinishedEventChan)
 	if err != nil {
@@ -37,18 +47,38 @@ func (blocApp *BlocApp) FlowTaskFinishedConsumer() {
 			continue
 		}
 		flowRunIns, err := flowRunRepo.GetByID(flowRunRecordUuid)
-		if err != nil {
+		if err != nil || flowRunIns.IsZero() {
 			logger.Errorf(logTag, "flow_run_record_id find no record!")
 			continue
 		}
 		logTag[string(value_object.TraceID)] = flowRunIns.TraceID
+		if !flowRunIns.Finished() {
+			logger.Warningf(logTag, "flow_run_record not finished. breakout")
+			continue
+		}
 
-		// 更新此flow_run_record的状态为成功
-		err = flowRunRepo.Suc(flowRunIns.ID)
+		flowIns, err := flowRepo.GetByID(flowRunIns.FlowID)
+		if err != nil || flowIns.IsZero() {
+			logger.Errorf(logTag, "find flow by id failed: %v", err)
+			continue
+		}
+		if len(flowIns.NotificationRules) == 0 {
+			continue
+		}
+
+		// 同一运行记录的完成事件可能被发布多次，只会创建还未创建的通知
+		deliveries, err := notificationService.CreateDeliveries(flowIns, flowRunIns)
 		if err != nil {
-			logger.Errorf(logTag, "save suc of flowRunRecord failed: %v", err)
-		} else {
-			logger.Infof(logTag, "finished")
+			logger.Errorf(logTag, "create notification_delivery failed: %v", err)
+		}
+		for _, delivery := range deliveries {
+			err = event.PubEvent(&event.NotificationToDeliver{NotificationDeliveryID: delivery.ID})
+			if err != nil {
+				logger.Errorf(logTag,
+					"pub notification to deliver event failed. notification_delivery_id: %s, error: %v",
+					delivery.ID.String(), err)
+			}
 		}
+		logger.Infof(logTag, "created %d notification deliveries", len(deliveries))
 	}
 }
@@ -57,6 +57,10 @@ func (blocApp *BlocApp) FlowTaskStartConsumer() {
 			logger.Errorf(logTags, "flow already finished. actual should not into here!")
 			continue
 		}
+		if flowRunIns.Status == value_object.Running {
+			logger.Warningf(logTags, "flow already running. breakout")
+			continue
+		}
 
 		flowIns, err := flowRepo.GetByID(flowRunIns.FlowID)
 		if err != nil {
@@ -65,23 +69,21 @@ func (blocApp *BlocApp) FlowTaskStartConsumer() {
 			continue
 		}
 		logTags["flow_id"] = flowRunIns.FlowID.String()
-		if !flowIns.AllowParallelRun { // 若不允许同时运行，需要进行检测是不是有正在运行的
-			// TODO 这里存在高并发的时候还是会并行运行的情况，后续需要处理
-			isRunning, err := flowRunRepo.IsHaveRunningTask(
-				flowIns.ID, flowRunRecordUuid)
+		// 有环的flow无法按照上下游关系运行
+		if _, err := flowIns.Graph().TopologicalOrder(); err != nil {
+			logger.Errorf(logTags, "flow cannot be scheduled: %v", err)
+			err = flowRunRepo.Fail(flowRunIns.ID, err.Error())
 			if err != nil {
-				logger.Errorf(logTags,
-					"filter running flow records error: %v", err)
-				continue
-			}
-			if isRunning {
-				logger.Infof(logTags, "won't run because not allowed parallel run")
-				err = flowRunRepo.NotAllowedParallelRun(flowRunIns.ID)
-				if err != nil {
-					logger.Errorf(logTags, "save flowRunRepo.NotAllowedParallelRun failed: %v", err)
-				}
-				continue
+				logger.Errorf(logTags, "save flow_run_record fail failed: %v", err)
+			} else {
+				event.PubFlowRunFinished(logger, logTags, flowRunIns.ID)
 			}
+			continue
+		}
+		// 限制了并发运行数的，需要获取flow一个槽位的锁，运行结束后释放
+		if flowIns.ConcurrencyLimit() > 0 &&
+			!blocApp.acquireFlowLock(logger, logTags, flowIns, flowRunIns) {
+			continue
 		}
 
 		// 检测其下的functions的心跳是否存在过期的，如果存在就直接不要发布保存失败就是了
@@ -96,6 +98,14 @@ func (blocApp *BlocApp) FlowTaskStartConsumer() {
 				continue
 			}
 			flowFunc := flowIns.FlowFunctionIDMapFlowFunction[flowFunctionID]
+			if flowFunc.SubFlow != nil { // 子flow节点没有对应的function，其内的function在子flow运行时检测
+				checkAllFuncAliveMutex.Done()
+				continue
+			}
+			if flowFunc.Approval != nil { // 人工审批节点没有对应的function
+				checkAllFuncAliveMutex.Done()
+				continue
+			}
 			go func(
 				functionID value_object.UUID,
 				wg *sync.WaitGroup,
@@ -124,11 +134,39 @@ func (blocApp *BlocApp) FlowTaskStartConsumer() {
 			err = flowRunRepo.FunctionDead(flowRunIns.ID, errorMsg)
 			if err != nil {
 				logger.Errorf(logTags, "save flowRunRepo.FunctionDead failed: %v", err)
+			} else {
+				event.PubFlowRunFinished(logger, logTags, flowRunIns.ID)
 			}
 			continue
 		}
 		logger.Infof(logTags, "all downs functions are alive")
 
+		if !blocApp.ensureFlowRunHoldsLock(logger, logTags, flowRunIns) {
+			continue
+		}
+
+		if flowRunIns.IsRerun() {
+			// 从失败处重新运行，沿用原运行中成功的节点
+			logTags["rerun_from_record_id"] = flowRunIns.RerunFromRecordID.String()
+			finished, err := blocApp.rerunFromFailure(flowIns, flowRunIns)
+			if err != nil {
+				logger.Errorf(logTags, "rerun from failure failed: %v", err)
+				err = flowRunRepo.Fail(flowRunIns.ID, "rerun from failure failed: "+err.Error())
+			} else if finished {
+				logger.Infof(logTags, "no flow_function need to rerun")
+				err = flowRunRepo.Suc(flowRunIns.ID)
+			} else {
+				logger.Infof(logTags, "finished(rerun from failure)")
+				continue
+			}
+			if err != nil {
+				logger.Errorf(logTags, "save flow_run_record finished status failed: %v", err)
+			} else {
+				event.PubFlowRunFinished(logger, logTags, flowRunIns.ID)
+			}
+			continue
+		}
+
 		// 发布flow下的“第一层”functions任务
 		// ToEnhance 目前第一层的发布在这里，而后续的发布在client api，这种重复不好。应当解决
 		firstLayerDownstreamFlowFunctionIDS := flowIns.FlowFunctionIDMapFlowFunction[config.FlowFunctionStartID].DownstreamFlowFunctionIDs
@@ -142,7 +180,9 @@ func (blocApp *BlocApp) FlowTaskStartConsumer() {
 			flowFunction := flowIns.FlowFunctionIDMapFlowFunction[flowFunctionID]
 			functionIns := blocApp.GetFunctionByRepoID(flowFunction.FunctionID)
 			pubFuncLogTags["downstream function_id"] = flowFunction.FunctionID.String()
-			if functionIns.IsZero() {
+			if flowFunction.SubFlow != nil || flowFunction.Approval != nil {
+				functionIns = &aggregate.Function{Name: flowFunction.Name()}
+			} else if functionIns.IsZero() {
 				// TODO 处理function注册的心跳过期问题
 				logger.Errorf(pubFuncLogTags, "find no function from blocApp")
 				goto PubFailed
@@ -177,6 +217,9 @@ func (blocApp *BlocApp) FlowTaskStartConsumer() {
 				err.Error())
 			goto PubFailed
 		}
+		if !blocApp.ensureFlowRunHoldsLock(logger, logTags, flowRunIns) {
+			continue
+		}
 		err = flowRunRepo.Start(flowRunIns.ID)
 		if err != nil {
 			logger.Errorf(logTags,
@@ -192,6 +235,7 @@ func (blocApp *BlocApp) FlowTaskStartConsumer() {
 				"flowRunRecord save failed(due to pub flow's first lay functions failed) failed: %v", err.Error())
 		} else {
 			logger.Infof(logTags, "finished(fail)")
+			event.PubFlowRunFinished(logger, logTags, flowRunIns.ID)
 		}
 	}
 }
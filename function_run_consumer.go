@@ -5,9 +5,19 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/fBloc/bloc-server/aggregate"
 	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/infrastructure/object_storage"
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/pkg/transform"
 	"github.com/fBloc/bloc-server/pkg/value_type"
+	"github.com/fBloc/bloc-server/repository/flow"
+	"github.com/fBloc/bloc-server/repository/flow_run_record"
+	"github.com/fBloc/bloc-server/repository/function_run_record"
+	"github.com/fBloc/bloc-server/repository/notification_delivery"
 	"github.com/fBloc/bloc-server/value_object"
+
+	"github.com/spf13/cast"
 )
 
 // FunctionRunConsumer 接收到要运行的function，主要有以下预操作：
@@ -22,6 +32,7 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 	flowRepo := blocApp.GetOrCreateFlowRepository()
 	objectStorage := blocApp.GetOrCreateConsumerObjectStorage()
 	flowRunRecordRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+	notificationDeliveryRepo := blocApp.GetOrCreateNotificationDeliveryRepository()
 
 	funcToRunEventChan := make(chan event.DomainEvent)
 	err := event.ListenEvent(
@@ -66,6 +77,18 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 			logger.Warningf(logTags, "should not pub already started function!")
 			continue
 		}
+		if functionRecordIns.IsMapChild() {
+			// map模式的子记录在父记录展开时已经装配好了ipt，直接发布运行
+			err = event.PubEvent(&event.ClientRunFunction{
+				FunctionRunRecordID: funcRunRecordUuid,
+				ClientName:          functionRecordIns.FunctionProviderName})
+			if err != nil {
+				logger.Errorf(logTags, "pub map child ClientRunFunction event failed: %v", err)
+			} else {
+				logger.Infof(logTags, "pub map child function to run event suc")
+			}
+			continue
+		}
 
 		flowIns, err := flowRepo.GetByID(functionRecordIns.FlowID)
 		logTags["flow_id"] = functionRecordIns.FlowID.String()
@@ -80,6 +103,14 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 			logger.Errorf(logTags, "get flow_run_record_ins failed: %v", err)
 			continue
 		}
+		// 失去了flow槽位锁的运行不再发布function运行
+		if !blocApp.ensureFlowRunHoldsLock(logger, logTags, flowRunRecordIns) {
+			err = funcRunRecordRepo.SaveCancel(funcRunRecordUuid)
+			if err != nil {
+				logger.Errorf(logTags, "funcRunRecord save cancel failed: %v", err)
+			}
+			continue
+		}
 		flowFuncIDMapFuncRunRecordID := flowRunRecordIns.FlowFuncIDMapFuncRunRecordID
 		if flowFuncIDMapFuncRunRecordID == nil {
 			flowFuncIDMapFuncRunRecordID = make(map[string]value_object.UUID)
@@ -90,9 +121,29 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 		// 需确保所有上游节点都已经运行完成了
 		upstreamAllSucFinished := true
 		upstreamFunctionIntercepted := false
+		// upstreamSkipped 上游节点在此次运行中是否因分支条件被跳过
+		upstreamSkipped := func(flowFunctionID string) bool {
+			if _, ok := flowFuncIDMapFuncRunRecordID[flowFunctionID]; ok {
+				return false
+			}
+			return flowIns.FlowFunctionSkipped(
+				flowFunctionID,
+				func(flowFunctionID string) *aggregate.FunctionRunRecord {
+					funcRunRecordID, ok := flowFuncIDMapFuncRunRecordID[flowFunctionID]
+					if !ok {
+						return nil
+					}
+					record, _ := funcRunRecordRepo.GetByID(funcRunRecordID)
+					return record
+				})
+		}
 		if len(flowFunction.UpstreamFlowFunctionIDs) > 1 { // 在只有一个上游节点的情况下，不需要检测
 			for _, i := range flowFunction.UpstreamFlowFunctionIDs {
 				upstreamFunctionRunRecordID, ok := flowRunRecordIns.FlowFuncIDMapFuncRunRecordID[i]
+				if !ok && upstreamSkipped(i) {
+					// 上游节点因分支条件被跳过，不需要等待
+					continue
+				}
 				if !ok { // 不存在表示没有运行完
 					logger.Warningf(logTags,
 						"upstream function not run finished. upstream flow_function_id: %s", i)
@@ -130,6 +181,10 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 					upstreamFunctionIntercepted = true
 					break
 				}
+				if upstreamFunctionRunRecordIns.SkippedDownstream(functionRecordIns.FlowFunctionID) {
+					// 此上游节点到本节点的分支条件没有满足，其余上游节点会发布此节点
+					continue
+				}
 			}
 		}
 		if !upstreamAllSucFinished {
@@ -142,10 +197,38 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 			err := flowRunRecordRepo.Intercepted(flowRunRecordIns.ID, "TODO")
 			if err != nil {
 				logger.Errorf(logTags, "save flow run finished : %v", err)
+			} else {
+				event.PubFlowRunFinished(logger, logTags, flowRunRecordIns.ID)
 			}
 		}
 
-		functionIns := blocApp.GetFunctionByRepoID(functionRecordIns.FunctionID)
+		var functionIns *aggregate.Function
+		if flowFunction.Approval != nil {
+			functionIns = flowFunction.Approval.VirtualFunction()
+		} else if flowFunction.SubFlow != nil {
+			// 子flow节点没有对应的function，以子flow生成的虚拟function装配输入参数
+			functionIns, err = flowFunction.SubFlow.AssembleFunction(
+				flowIns.OriginID, blocApp.GetFunctionByRepoID, flowRepo.GetOnlineByOriginID)
+			if err != nil {
+				logger.Errorf(logTags, "assemble sub flow function failed: %v", err)
+				err := funcRunRecordRepo.SaveFail(
+					functionRecordIns.ID, "assemble sub flow failed: "+err.Error())
+				if err != nil {
+					logger.Errorf(logTags, "funcRunRecord save fail failed: %v", err)
+				}
+				err = flowRunRecordRepo.Fail(
+					flowRunRecordIns.ID,
+					fmt.Sprintf("assemble sub flow node-%s failed", flowFunction.Name()))
+				if err != nil {
+					logger.Errorf(logTags, "persist flow_run_record fail: %v", err)
+				} else {
+					event.PubFlowRunFinished(logger, logTags, flowRunRecordIns.ID)
+				}
+				continue
+			}
+		} else {
+			functionIns = blocApp.GetFunctionByRepoID(functionRecordIns.FunctionID)
+		}
 		if functionIns.IsZero() {
 			logger.Errorf(logTags, "get function by id match no record")
 			continue
@@ -155,6 +238,7 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 		// 装配输入参数到function_run_record实例【从flowFunction中配置的输入参数的来源（manual/connection）获得】
 		// 如果是被覆盖参数方式触发运行的，优先使用传入的覆盖参数
 		functionRecordIns.Ipts = make([][]interface{}, len(flowFunction.ParamIpts))
+		var iptSchemaErr error // 第一个不满足json schema的输入
 		for paramIndex, paramIpt := range flowFunction.ParamIpts {
 			functionRecordIns.Ipts[paramIndex] = make([]interface{}, len(paramIpt))
 			for componentIndex, componentIpt := range paramIpt {
@@ -162,7 +246,9 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 				customSetted := false
 				if _, ok := flowRunRecordIns.OverideIptParams[functionRecordIns.FlowFunctionID]; ok {
 					customeParam := flowRunRecordIns.OverideIptParams[functionRecordIns.FlowFunctionID]
-					if len(customeParam)-1 >= paramIndex && len(customeParam[paramIndex])-1 >= componentIndex {
+					// 覆盖参数中为nil的位置只是占位，使用节点自身的配置
+					if len(customeParam)-1 >= paramIndex && len(customeParam[paramIndex])-1 >= componentIndex &&
+						customeParam[paramIndex][componentIndex] != nil {
 						value = customeParam[paramIndex][componentIndex]
 						customSetted = true
 					}
@@ -171,7 +257,10 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 				if !customSetted {
 					if componentIpt.IptWay == value_object.UserIpt {
 						value = componentIpt.Value
-					} else if componentIpt.IptWay == value_object.Connection {
+					} else if componentIpt.IptWay == value_object.FlowParam {
+						value = flowIns.ParamValue(componentIpt.Key, flowRunRecordIns.Params)
+					} else if componentIpt.IptWay == value_object.Connection &&
+						!upstreamSkipped(componentIpt.FlowFunctionID) { // 被分支条件跳过的上游视为未提供此参数
 						// 找到上游对应节点的运行记录并从其opt中取出要的数据
 						upstreamFuncRunRecordID := flowFuncIDMapFuncRunRecordID[componentIpt.FlowFunctionID]
 						upstreamFuncRunRecordIns, err := funcRunRecordRepo.GetByID(upstreamFuncRunRecordID)
@@ -236,6 +325,25 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 							continue
 						}
 						json.Unmarshal(tmp, &value)
+
+						// 配置了转换表达式的，转换后再作为输入
+						if componentIpt.Transform != "" {
+							transformed, err := transform.Apply(componentIpt.Transform, value)
+							if err != nil {
+								logger.Errorf(logTags,
+									"apply transform %s on upstream opt failed: %v",
+									componentIpt.Transform, err)
+								functionRecordIns.Ipts[paramIndex][componentIndex] = "not valid from transform"
+
+								err := funcRunRecordRepo.SaveFail(functionRecordIns.ID,
+									"ipt value transform failed: "+err.Error())
+								if err != nil {
+									logger.Errorf(logTags, "funcRunRecord save fail failed: %v", err)
+								}
+								continue
+							}
+							value = transformed
+						}
 					}
 				}
 
@@ -245,6 +353,9 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 				} else {
 					// 有效性检查
 					dataValid := value_type.CheckValueTypeValueValid(componentIpt.ValueType, value)
+					if component := functionIns.IptComponent(paramIndex, componentIndex); component != nil {
+						dataValid = dataValid && component.ValueAllowed(value) // enum类型需要在可选值内
+					}
 					if !dataValid {
 						functionRecordIns.Ipts[paramIndex][componentIndex] = "not valid"
 
@@ -258,6 +369,12 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 						functionRecordIns.Ipts[paramIndex][componentIndex] = "not valid"
 						continue
 					}
+					if component := functionIns.IptComponent(paramIndex, componentIndex); component != nil && iptSchemaErr == nil {
+						if err := component.ValidateJsonSchema(value); err != nil {
+							iptSchemaErr = fmt.Errorf(
+								"ipt_index: %d, component_index: %d, %w", paramIndex, componentIndex, err)
+						}
+					}
 				}
 				functionRecordIns.Ipts[paramIndex][componentIndex] = value
 				functionIns.Ipts[paramIndex].Components[componentIndex].Value = value
@@ -277,6 +394,8 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 			)
 			if err != nil {
 				logger.Errorf(logTags, "persist flow_run_record fail: %v", err)
+			} else {
+				event.PubFlowRunFinished(logger, logTags, flowRunRecordIns.ID)
 			}
 			continue
 		}
@@ -290,33 +409,149 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 			continue
 		}
 
-		// > 装配IPT已成功，处理flow设置的超时问题
+		// 输入不满足function声明的json schema，不下发运行、也不重试
+		if iptSchemaErr != nil {
+			logger.Warningf(logTags, "ipt not match json schema: %v", iptSchemaErr)
+			err := funcRunRecordRepo.SaveFail(
+				functionRecordIns.ID, "ipt value not match json schema. "+iptSchemaErr.Error())
+			if err != nil {
+				logger.Errorf(logTags, "funcRunRecord save fail failed: %v", err)
+			}
+			err = flowRunRecordRepo.Fail(
+				flowRunRecordIns.ID,
+				fmt.Sprintf("function-%s's ipt not match json schema", functionIns.Name))
+			if err != nil {
+				logger.Errorf(logTags, "persist flow_run_record fail: %v", err)
+			} else {
+				event.PubFlowRunFinished(logger, logTags, flowRunRecordIns.ID)
+			}
+			continue
+		}
+
+		// > 装配IPT已成功，处理超时问题：节点自身的超时与flow整体剩余的时长取较早者作为截止时间
+		var deadline time.Time
+		if flowFunction.TimeoutInSeconds > 0 {
+			deadline = time.Now().Add(time.Duration(flowFunction.TimeoutInSeconds) * time.Second)
+		}
 		if flowIns.TimeoutInSeconds > 0 { // 设置了整体运行的超时时长
 			thisFlowTaskAllFunctionTasks, err := funcRunRecordRepo.FilterByFlowRunRecordID(flowRunRecordIns.ID)
 			var thisFlowTaskUsedSeconds float64
-			if err != nil {
+			if err == nil {
 				for _, i := range thisFlowTaskAllFunctionTasks {
-					if !i.End.IsZero() {
+					if !i.Start.IsZero() && !i.End.IsZero() {
 						thisFlowTaskUsedSeconds += i.End.Sub(i.Start).Seconds()
 					}
 				}
+			} else {
+				logger.Errorf(logTags,
+					"get function_run_records of flow_run_record failed: %v", err)
 			}
-			leftSeconds := flowIns.TimeoutInSeconds - uint32(thisFlowTaskUsedSeconds)
-			if leftSeconds > 0 { // 未超时
-				err = funcRunRecordRepo.SetTimeout(funcRunRecordUuid,
-					time.Now().Add(time.Duration(leftSeconds)*time.Second))
-				if err != nil {
-					logger.Errorf(logTags,
-						"set timeout for function_run_record failed: %v", err)
-				}
-			} else { // 已超时
+			if thisFlowTaskUsedSeconds >= float64(flowIns.TimeoutInSeconds) { // 已超时
 				logger.Infof(logTags,
 					"func run record id %s timeout canceled", functionRunRecordIDStr)
 				funcRunRecordRepo.SaveCancel(funcRunRecordUuid)
-				flowRunRecordRepo.TimeoutCancel(flowRunRecordIns.ID)
+				err = flowRunRecordRepo.TimeoutCancel(flowRunRecordIns.ID)
+				if err != nil {
+					logger.Errorf(logTags, "persist flow_run_record timeout cancel: %v", err)
+				} else {
+					event.PubFlowRunFinished(logger, logTags, flowRunRecordIns.ID)
+				}
+				continue
+			}
+			leftSeconds := float64(flowIns.TimeoutInSeconds) - thisFlowTaskUsedSeconds
+			flowDeadline := time.Now().Add(time.Duration(leftSeconds * float64(time.Second)))
+			if deadline.IsZero() || flowDeadline.Before(deadline) {
+				deadline = flowDeadline
+			}
+		}
+		if !deadline.IsZero() {
+			err = funcRunRecordRepo.SetTimeout(funcRunRecordUuid, deadline)
+			if err != nil {
+				logger.Errorf(logTags,
+					"set timeout for function_run_record failed: %v", err)
+			}
+			// map模式展开的子记录沿用父记录的截止时间
+			functionRecordIns.ShouldBeCanceledAt = deadline
+		}
+		if flowFunction.Map != nil {
+			// map模式下此记录作为父记录，逐元素创建子记录运行，子记录全部完成后汇总opt
+			childAmount, err := expandMapFunctionRun(
+				functionRecordIns, flowFunction.Map, functionIns.Ipts,
+				funcRunRecordRepo, objectStorage)
+			if err != nil {
+				logger.Errorf(logTags, "expand map function run failed: %v", err)
+				err := funcRunRecordRepo.SaveFail(
+					functionRecordIns.ID, "expand map function run failed: "+err.Error())
+				if err != nil {
+					logger.Errorf(logTags, "funcRunRecord save fail failed: %v", err)
+				}
+				err = flowRunRecordRepo.Fail(
+					flowRunRecordIns.ID,
+					fmt.Sprintf("expand map function-%s run failed", functionIns.Name))
+				if err != nil {
+					logger.Errorf(logTags, "persist flow_run_record fail: %v", err)
+				} else {
+					event.PubFlowRunFinished(logger, logTags, flowRunRecordIns.ID)
+				}
+				continue
+			}
+			logger.Infof(logTags, "expanded to %d map child function run", childAmount)
+			continue
+		}
+
+		if flowFunction.Approval != nil {
+			// 人工审批节点暂停运行并通知审批人，审批通过/拒绝/超时后才继续
+			err = waitForApproval(
+				functionRecordIns, flowFunction.Approval,
+				funcRunRecordRepo, flowRunRecordRepo, notificationDeliveryRepo)
+			if err != nil {
+				logger.Errorf(logTags, "wait for approval failed: %v", err)
+				err := funcRunRecordRepo.SaveFail(
+					functionRecordIns.ID, "wait for approval failed: "+err.Error())
+				if err != nil {
+					logger.Errorf(logTags, "funcRunRecord save fail failed: %v", err)
+				}
+				err = flowRunRecordRepo.Fail(
+					flowRunRecordIns.ID,
+					fmt.Sprintf("approval node-%s wait for approval failed", flowFunction.Name()))
+				if err != nil {
+					logger.Errorf(logTags, "persist flow_run_record fail: %v", err)
+				} else {
+					event.PubFlowRunFinished(logger, logTags, flowRunRecordIns.ID)
+				}
+				continue
+			}
+			logger.Infof(logTags, "waiting for approval")
+			continue
+		}
+
+		if flowFunction.SubFlow != nil {
+			// 子flow节点触发子flow运行，子flow运行完成后此节点才完成
+			childFlowRunRecord, err := startSubFlowRun(
+				functionRecordIns, flowRunRecordIns, flowFunction.SubFlow, functionIns.ID,
+				flowRepo, flowRunRecordRepo, funcRunRecordRepo)
+			if err != nil {
+				logger.Errorf(logTags, "start sub flow run failed: %v", err)
+				err := funcRunRecordRepo.SaveFail(
+					functionRecordIns.ID, "start sub flow run failed: "+err.Error())
+				if err != nil {
+					logger.Errorf(logTags, "funcRunRecord save fail failed: %v", err)
+				}
+				err = flowRunRecordRepo.Fail(
+					flowRunRecordIns.ID,
+					fmt.Sprintf("start sub flow node-%s run failed", flowFunction.Name()))
+				if err != nil {
+					logger.Errorf(logTags, "persist flow_run_record fail: %v", err)
+				} else {
+					event.PubFlowRunFinished(logger, logTags, flowRunRecordIns.ID)
+				}
 				continue
 			}
+			logger.Infof(logTags,
+				"pub sub flow to run suc. sub flow_run_record_id: %s", childFlowRunRecord.ID.String())
+			continue
 		}
+
 		// 发布运行任务到具体的function provider
 		err = event.PubEvent(&event.ClientRunFunction{
 			FunctionRunRecordID: funcRunRecordUuid,
@@ -328,3 +563,133 @@ func (blocApp *BlocApp) FunctionRunConsumer() {
 		}
 	}
 }
+
+// waitForApproval 将人工审批节点及其flow运行标记为等待审批，并通知设置了通知渠道的审批人
+func waitForApproval(
+	functionRecordIns *aggregate.FunctionRunRecord,
+	approval *aggregate.ApprovalSetting,
+	funcRunRecordRepo function_run_record.FunctionRunRecordRepository,
+	flowRunRecordRepo flow_run_record.FlowRunRecordRepository,
+	notificationDeliveryRepo notification_delivery.NotificationDeliveryRepository,
+) error {
+	err := funcRunRecordRepo.SaveWaitingApproval(functionRecordIns.ID)
+	if err != nil {
+		return err
+	}
+	err = flowRunRecordRepo.WaitingApproval(functionRecordIns.FlowRunRecordID)
+	if err != nil {
+		return err
+	}
+	for _, approver := range approval.Approvers {
+		if approver.Channel == "" {
+			continue
+		}
+		delivery := aggregate.NewApprovalNotificationDelivery(functionRecordIns, approver)
+		err = notificationDeliveryRepo.Create(delivery)
+		if err != nil {
+			return err
+		}
+		err = event.PubEvent(&event.NotificationToDeliver{NotificationDeliveryID: delivery.ID})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startSubFlowRun 以此子flow节点的输入作为覆盖参数创建子flow的运行记录并发布运行
+func startSubFlowRun(
+	functionRecordIns *aggregate.FunctionRunRecord,
+	flowRunRecordIns *aggregate.FlowRunRecord,
+	subFlowSetting *aggregate.SubFlowSetting,
+	subFlowID value_object.UUID,
+	flowRepo flow.FlowRepository,
+	flowRunRecordRepo flow_run_record.FlowRunRecordRepository,
+	funcRunRecordRepo function_run_record.FunctionRunRecordRepository,
+) (*aggregate.FlowRunRecord, error) {
+	subFlow, err := flowRepo.GetByID(subFlowID)
+	if err != nil {
+		return nil, err
+	}
+	if subFlow.IsZero() {
+		return nil, fmt.Errorf("sub flow(%s) not exist", subFlowID.String())
+	}
+
+	childFlowRunRecord := aggregate.NewArrangementTriggeredFlowRunRecord(
+		value_object.SetTraceIDToContext(flowRunRecordIns.TraceID),
+		subFlow, flowRunRecordIns, functionRecordIns.FlowFunctionID,
+		subFlowSetting.OverideIptParams(functionRecordIns.Ipts))
+	err = flowRunRecordRepo.Create(childFlowRunRecord)
+	if err != nil {
+		return nil, err
+	}
+	err = funcRunRecordRepo.SaveStart(functionRecordIns.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = event.PubEvent(&event.FlowToRun{FlowRunRecordID: childFlowRunRecord.ID})
+	if err != nil {
+		return nil, err
+	}
+	return childFlowRunRecord, nil
+}
+
+// expandMapFunctionRun 将map模式的父记录按照被展开ipt的每个元素创建子记录，并发布最多并发数目的子记录运行
+// 其余的子记录在前面的子记录运行完成后依次发布
+func expandMapFunctionRun(
+	parent *aggregate.FunctionRunRecord,
+	mapSetting *aggregate.MapSetting,
+	iptConfig ipt.IptSlice,
+	funcRunRecordRepo function_run_record.FunctionRunRecordRepository,
+	objectStorage object_storage.ObjectStorage,
+) (int, error) {
+	if mapSetting.IptIndex >= len(parent.Ipts) || len(parent.Ipts[mapSetting.IptIndex]) == 0 {
+		return 0, fmt.Errorf("map ipt index %d out of range", mapSetting.IptIndex)
+	}
+	items, err := cast.ToSliceE(parent.Ipts[mapSetting.IptIndex][0])
+	if err != nil {
+		return 0, fmt.Errorf("map ipt value is not array: %v", err)
+	}
+	if len(items) == 0 {
+		// 没有需要运行的子记录，父记录直接以空数组作为opt成功完成并继续运行下游
+		err = funcRunRecordRepo.SaveStart(parent.ID)
+		if err != nil {
+			return 0, err
+		}
+		return 0, event.PubEvent(&event.MapFunctionRunEmpty{FunctionRunRecordID: parent.ID})
+	}
+
+	children := make([]*aggregate.FunctionRunRecord, 0, len(items))
+	for index, item := range items {
+		childIpts := make([][]interface{}, len(parent.Ipts))
+		for i, param := range parent.Ipts {
+			childIpts[i] = append([]interface{}{}, param...)
+		}
+		childIpts[mapSetting.IptIndex][0] = item
+
+		child := aggregate.NewMapChildFunctionRunRecord(parent, index, childIpts)
+		err = funcRunRecordRepo.Create(child)
+		if err != nil {
+			return 0, err
+		}
+		err = funcRunRecordRepo.SaveIptBrief(child.ID, iptConfig, childIpts, objectStorage)
+		if err != nil {
+			return 0, err
+		}
+		children = append(children, child)
+	}
+
+	// 父记录不会实际运行，标记为已开始防止被重复展开
+	err = funcRunRecordRepo.SaveStart(parent.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, child := range children[:mapSetting.Concurrency(len(children))] {
+		err = event.PubEvent(&event.FunctionToRun{FunctionRunRecordID: child.ID})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(children), nil
+}
@@ -0,0 +1,59 @@
+package bloc
+
+import (
+	"time"
+
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// FunctionRunTimeoutWatcher 找到超过截止时间还未完成的function运行记录，标记为超时取消
+// 客户端通过取消检测接口得知需要停止运行；重试或失败的处理由监听超时事件的一方按照重试策略进行
+func (blocApp *BlocApp) FunctionRunTimeoutWatcher() {
+	event.InjectMq(blocApp.GetOrCreateEventMQ())
+	event.InjectFutureEventStorageImplement(blocApp.GetOrCreateFutureEventStorage())
+
+	logger := blocApp.GetOrCreateScheduleLogger()
+	funcRunRecordRepo := blocApp.GetOrCreateFunctionRunRecordRepository()
+
+	ticker := time.NewTicker(config.FunctionRunTimeoutCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		timeouts, err := funcRunRecordRepo.FilterDeadlineExceeded(time.Now())
+		if err != nil {
+			logger.Errorf(
+				map[string]string{"business": "function run timeout watcher"},
+				"filter deadline exceeded function_run_record failed: %v", err)
+			continue
+		}
+
+		for _, funcRunRecord := range timeouts {
+			logTags := map[string]string{
+				string(value_object.SpanID):  value_object.NewSpanID(),
+				string(value_object.TraceID): funcRunRecord.TraceID,
+				"business":                   "function run timeout watcher",
+				"function_run_record_id":     funcRunRecord.ID.String(),
+				"flow_run_record_id":         funcRunRecord.FlowRunRecordID.String(),
+			}
+
+			// 利用条件更新的原子性保证多个watcher不会重复处理
+			marked, err := funcRunRecordRepo.SaveTimeoutCancel(funcRunRecord.ID)
+			if err != nil {
+				logger.Errorf(logTags, "save function_run_record timeout cancel failed: %v", err)
+				continue
+			}
+			if !marked {
+				logger.Infof(logTags, "already handled. breakout")
+				continue
+			}
+			logger.Infof(logTags,
+				"timeout canceled. deadline: %s", funcRunRecord.ShouldBeCanceledAt.Format(time.RFC3339))
+
+			err = event.PubEvent(&event.FunctionRunTimeout{FunctionRunRecordID: funcRunRecord.ID})
+			if err != nil {
+				logger.Errorf(logTags, "pub function run timeout event failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package bloc
+
+import (
+	"time"
+
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/infrastructure/log"
+	"github.com/fBloc/bloc-server/infrastructure/mq"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// FutureEventDispatcher 将到期的未来事件从存储中取出并发布到消息队列
+// 多副本安全：每条事件通过存储的原子弹出（FindOneAndDelete）保证只被一个副本发布
+func (blocApp *BlocApp) FutureEventDispatcher() {
+	event.InjectMq(blocApp.GetOrCreateEventMQ())
+	event.InjectFutureEventStorageImplement(blocApp.GetOrCreateFutureEventStorage())
+
+	logger := blocApp.GetOrCreateScheduleLogger()
+	futureEventStorage := blocApp.GetOrCreateFutureEventStorage()
+	eventMQ := blocApp.GetOrCreateEventMQ()
+
+	ticker := time.NewTicker(config.FutureEventDispatchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		logTags := map[string]string{
+			string(value_object.SpanID): value_object.NewSpanID(),
+			"business":                  "future event dispatcher"}
+		dispatchDueFutureEvents(logger, logTags, futureEventStorage, eventMQ, time.Now())
+	}
+}
+
+// futureEventDispatchRound 一轮分发的结果
+type futureEventDispatchRound struct {
+	backlog          int64
+	dispatchedAmount int
+	putBackAmount    int
+	outOfOrderAmount int
+	maxLag           time.Duration
+}
+
+// dispatchDueFutureEvents 按发布时间从早到晚发布now之前到期的事件，每轮最多发布FutureEventDispatchBatchSize条。
+// 事件先弹出再发布，发布失败时放回存储等待下一轮重试；
+// 弹出后、发布或放回完成前进程退出的，此事件会丢失（至多一次）
+func dispatchDueFutureEvents(
+	logger *log.Logger, logTags map[string]string,
+	futureEventStorage event.FuturePubEventStorage, eventMQ mq.MsgQueue,
+	now time.Time,
+) (round futureEventDispatchRound) {
+	backlog, err := futureEventStorage.CountBeforeATime(now)
+	if err != nil {
+		logger.Errorf(logTags, "count due future events failed: %v", err)
+		return
+	}
+	if backlog <= 0 {
+		return
+	}
+	round.backlog = backlog
+
+	var lastPubTime time.Time
+	for round.dispatchedAmount < config.FutureEventDispatchBatchSize {
+		futureEvent, err := futureEventStorage.PopEarliestBeforeATime(now)
+		if err != nil {
+			logger.Errorf(logTags, "pop due future event failed: %v", err)
+			break
+		}
+		if futureEvent.IsZero() { // 已取完（或被其他副本取走）
+			break
+		}
+
+		if lag := futureEvent.Lag(time.Now()); lag > round.maxLag {
+			round.maxLag = lag
+		}
+		if futureEvent.PubTime.Before(lastPubTime) {
+			round.outOfOrderAmount++
+		} else {
+			lastPubTime = futureEvent.PubTime
+		}
+
+		err = eventMQ.Pub(futureEvent.Tag, futureEvent.Data)
+		if err != nil {
+			logger.Errorf(logTags,
+				"pub future event to mq failed, topic: %s, error: %v", futureEvent.Tag, err)
+			// 发布失败放回存储，等待下一轮重试
+			if err := futureEventStorage.AddRaw(futureEvent); err != nil {
+				logger.Errorf(logTags,
+					"put back future event failed, event lost. topic: %s, data: %s, error: %v",
+					futureEvent.Tag, string(futureEvent.Data), err)
+			} else {
+				round.putBackAmount++
+			}
+			break
+		}
+		round.dispatchedAmount++
+	}
+
+	logger.Infof(logTags,
+		"future event dispatch round finished. backlog: %d, dispatched: %d, put back: %d, out of order: %d, max lag: %s",
+		round.backlog, round.dispatchedAmount, round.putBackAmount, round.outOfOrderAmount, round.maxLag)
+	return round
+}
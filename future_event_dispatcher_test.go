@@ -0,0 +1,94 @@
+package bloc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/event/memory_event_storage"
+	"github.com/fBloc/bloc-server/infrastructure/log"
+	log_memory "github.com/fBloc/bloc-server/infrastructure/log_collect_backend/memory"
+	mq_memory "github.com/fBloc/bloc-server/infrastructure/mq/memory"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// failPubMQ 发布指定topic时失败，其余的交给内存mq
+type failPubMQ struct {
+	*mq_memory.MemoryMQ
+	failTopic string
+}
+
+func (f *failPubMQ) Pub(topic string, data []byte) error {
+	if topic == f.failTopic {
+		return errors.New("fake pub failed")
+	}
+	return f.MemoryMQ.Pub(topic, data)
+}
+
+func receiveAll(c chan []byte) []string {
+	received := make([]string, 0)
+	for {
+		select {
+		case msg := <-c:
+			received = append(received, string(msg))
+		case <-time.After(100 * time.Millisecond):
+			return received
+		}
+	}
+}
+
+func TestDispatchDueFutureEvents(t *testing.T) {
+	logger := log.New("test", log_memory.New())
+	now := time.Now()
+
+	Convey("only due events are dispatched, earliest first", t, func() {
+		storage := memory_event_storage.New()
+		eventMQ := mq_memory.New()
+		msgChan := make(chan []byte, 10)
+		So(eventMQ.Pull("future", "dispatcher_test", msgChan), ShouldBeNil)
+		for _, i := range []struct {
+			data    string
+			pubTime time.Time
+		}{
+			{"not_due", now.Add(time.Minute)},
+			{"second", now.Add(-time.Second)},
+			{"first", now.Add(-time.Minute)},
+		} {
+			storage.AddRaw(&event.FutureEvent{Tag: "future", Data: []byte(i.data), PubTime: i.pubTime})
+		}
+
+		round := dispatchDueFutureEvents(logger, map[string]string{}, storage, eventMQ, now)
+		So(round.backlog, ShouldEqual, 2)
+		So(round.dispatchedAmount, ShouldEqual, 2)
+		So(round.outOfOrderAmount, ShouldEqual, 0)
+		So(receiveAll(msgChan), ShouldResemble, []string{"first", "second"})
+
+		left, _ := storage.CountBeforeATime(now.Add(time.Hour))
+		So(left, ShouldEqual, 1)
+	})
+
+	Convey("event failed to publish is put back", t, func() {
+		storage := memory_event_storage.New()
+		eventMQ := &failPubMQ{MemoryMQ: mq_memory.New(), failTopic: "broken"}
+		storage.AddRaw(&event.FutureEvent{Tag: "broken", Data: []byte("x"), PubTime: now.Add(-time.Second)})
+
+		round := dispatchDueFutureEvents(logger, map[string]string{}, storage, eventMQ, now)
+		So(round.dispatchedAmount, ShouldEqual, 0)
+		So(round.putBackAmount, ShouldEqual, 1)
+
+		putBack, err := storage.PopEarliestBeforeATime(now)
+		So(err, ShouldBeNil)
+		So(putBack.Tag, ShouldEqual, "broken")
+		So(string(putBack.Data), ShouldEqual, "x")
+	})
+
+	Convey("nothing due", t, func() {
+		storage := memory_event_storage.New()
+		storage.AddRaw(&event.FutureEvent{Tag: "future", PubTime: now.Add(time.Minute)})
+		round := dispatchDueFutureEvents(logger, map[string]string{}, storage, mq_memory.New(), now)
+		So(round.backlog, ShouldEqual, 0)
+		So(round.dispatchedAmount, ShouldEqual, 0)
+	})
+}
@@ -13,13 +13,17 @@ import (
 	"github.com/fBloc/bloc-server/interfaces/web/function_run_record"
 	"github.com/fBloc/bloc-server/interfaces/web/log_data"
 	"github.com/fBloc/bloc-server/interfaces/web/middleware"
+	"github.com/fBloc/bloc-server/interfaces/web/notification_delivery"
 	"github.com/fBloc/bloc-server/interfaces/web/object_storage"
 	"github.com/fBloc/bloc-server/interfaces/web/user"
+	"github.com/fBloc/bloc-server/internal/event_bus"
+	"github.com/fBloc/bloc-server/pkg/builtin_function"
 	flow_service "github.com/fBloc/bloc-server/services/flow"
 	flowRunRecord_service "github.com/fBloc/bloc-server/services/flow_run_record"
 	function_service "github.com/fBloc/bloc-server/services/function"
 	heartbeat_service "github.com/fBloc/bloc-server/services/function_execute_heartbeat"
 	functionRunRecord_service "github.com/fBloc/bloc-server/services/function_run_record"
+	notification_service "github.com/fBloc/bloc-server/services/notification"
 	user_service "github.com/fBloc/bloc-server/services/user"
 	user_cache "github.com/fBloc/bloc-server/services/user_cache"
 
@@ -32,6 +36,7 @@ func (blocApp *BlocApp) RunHttpServer() {
 
 	httpLogger := blocApp.GetOrCreateHttpLogger()
 	event.InjectMq(blocApp.GetOrCreateEventMQ())
+	event.InjectFutureEventStorageImplement(blocApp.GetOrCreateFutureEventStorage())
 
 	uCacheService, err := user_cache.NewUserCacheService(
 		user_cache.WithLogger(httpLogger),
@@ -152,6 +157,7 @@ func (blocApp *BlocApp) RunHttpServer() {
 				blocApp.GetOrCreateFlowRunRecordRepository(),
 			),
 			flow_service.WithUserCacheService(uCacheService),
+			flow_service.WithGlobalBlackoutWindows(blocApp.GlobalBlackoutWindows()),
 		)
 		if err != nil {
 			panic(err)
@@ -172,6 +178,7 @@ func (blocApp *BlocApp) RunHttpServer() {
 			router.GET(basicPath, middleware.WithTrace(middleware.LoginAuth(flow.FilterDraftByName)))
 			router.GET(basicPath+"/get_by_origin_id/:origin_id", middleware.WithTrace(middleware.LoginAuth(flow.GetDraftByOriginID)))
 			router.GET(basicPath+"/commit_by_id/:id", middleware.WithTrace(middleware.LoginAuth(flow.PubDraft)))
+			router.GET(basicPath+"/validate_by_id/:id", middleware.WithTrace(middleware.LoginAuth(flow.ValidateDraft)))
 
 			router.GET(basicPath+"/get_or_create_for_flow_by_origin_id/:origin_id",
 				middleware.WithTrace(middleware.LoginAuth(flow.GetOrCreateDraftForCertainFlowByOriginID)))
@@ -190,6 +197,7 @@ func (blocApp *BlocApp) RunHttpServer() {
 			basicPath := "/api/v1/flow"
 			router.GET(basicPath, middleware.WithTrace(middleware.LoginAuth(flow.FilterFlow)))
 			router.GET(basicPath+"/get_by_id/:id", middleware.WithTrace(middleware.LoginAuth(flow.GetFlowByID)))
+			router.GET(basicPath+"/graph_by_id/:id", middleware.WithTrace(middleware.LoginAuth(flow.GetFlowGraphByID)))
 			router.GET(basicPath+"/get_by_flow_run_record_id/:flow_run_record_id", middleware.WithTrace(middleware.LoginAuth(flow.GetFlowByCertainFlowRunRecord)))
 			router.GET(basicPath+"/get_latestonline_by_origin_id/:origin_id", middleware.WithTrace(middleware.LoginAuth(flow.GetFlowByOriginID)))
 			router.PATCH(basicPath+"/set_execute_control_attributes", middleware.WithTrace(middleware.LoginAuth(flow.SetExecuteControlAttributes)))
@@ -201,9 +209,17 @@ func (blocApp *BlocApp) RunHttpServer() {
 			basicPath := "/api/v1/flow"
 			router.GET(basicPath+"/run/by_origin_id/:origin_id", middleware.WithTrace(middleware.LoginAuth(flow.Run)))
 			router.GET(basicPath+"/run/by_trigger_key/:trigger_key", middleware.WithTrace(flow.RunByTriggerKey))
+			// POST的请求体为{name: value}形式的flow参数值
+			router.POST(basicPath+"/run/by_origin_id/:origin_id", middleware.WithTrace(middleware.LoginAuth(flow.Run)))
+			router.POST(basicPath+"/run/by_trigger_key/:trigger_key", middleware.WithTrace(flow.RunByTriggerKey))
 			router.POST(basicPath+"/run/by_trigger_key_with_param_overide/:trigger_key",
 				middleware.WithTrace(flow.RunByTriggerKeyWithParamOverride))
 			router.GET(basicPath+"/cancel_run/by_origin_id/:origin_id", middleware.WithTrace(middleware.LoginAuth(flow.CancelRun)))
+			router.GET(basicPath+"/run_queue/by_origin_id/:origin_id", middleware.WithTrace(middleware.LoginAuth(flow.RunQueue)))
+			router.GET(basicPath+"/schedule/next_fire_times", middleware.WithTrace(middleware.LoginAuth(flow.NextFireTimes)))
+			router.GET(basicPath+"/schedule/calendar", middleware.WithTrace(middleware.LoginAuth(flow.ScheduleCalendar)))
+			router.GET(basicPath+"/run/rerun_from_failure/:flow_run_record_id",
+				middleware.WithTrace(middleware.LoginAuth(flow.RerunFromFailure)))
 		}
 
 		{
@@ -228,10 +244,35 @@ func (blocApp *BlocApp) RunHttpServer() {
 			panic(err)
 		}
 		flow_run_record.InjectFlowRunRecordService(flowRunRecordService)
+		flow_run_record.InjectRunStatusBus(event_bus.New(event_bus.DefaultSubscriberBufferSize))
+
+		// 将运行状态变化分发给本进程内的推送连接
+		go flow_run_record.RunStatusChangedConsumer()
 
 		// router
 		basicPath := "/api/v1/flow_run_record"
 		router.GET(basicPath, middleware.WithTrace(middleware.LoginAuth(flow_run_record.Filter)))
+		router.GET(basicPath+"/stream/:id", middleware.WithTrace(middleware.LoginAuth(flow_run_record.StreamByID)))
+		router.GET(basicPath+"/stream_by_flow_origin_id/:flow_origin_id", middleware.WithTrace(middleware.LoginAuth(flow_run_record.StreamByFlowOriginID)))
+	}
+
+	// notification_delivery
+	{
+		// initial relied services
+		notificationService, err := notification_service.NewService(
+			notification_service.WithLogger(httpLogger),
+			notification_service.WithNotificationDeliveryRepository(
+				blocApp.GetOrCreateNotificationDeliveryRepository()),
+		)
+		if err != nil {
+			panic(err)
+		}
+		notification_delivery.InjectNotificationService(notificationService)
+
+		// router
+		basicPath := "/api/v1/notification_delivery"
+		router.GET(basicPath, middleware.WithTrace(middleware.LoginAuth(notification_delivery.Filter)))
+		router.GET(basicPath+"/get_by_id/:id", middleware.WithTrace(middleware.LoginAuth(notification_delivery.Get)))
 	}
 
 	// object storage
@@ -314,6 +355,8 @@ func (blocApp *BlocApp) RunHttpServer() {
 			flowRunRecord_service.WithFlowRunRecordRepository(
 				blocApp.GetOrCreateFlowRunRecordRepository()),
 			flowRunRecord_service.WithUserCacheService(uCacheService),
+			flowRunRecord_service.WithFlowLockRepository(
+				blocApp.GetOrCreateFlowLockRepository()),
 		)
 		if err != nil {
 			panic(err)
@@ -336,6 +379,20 @@ func (blocApp *BlocApp) RunHttpServer() {
 		}
 		client.InjectHeartbeatService(executeHeartBeatService)
 
+		// 子flow运行完成后完成父flow中对应的子flow节点，依赖上面注入的各项service
+		go client.SubFlowRunFinishedConsumer()
+		// 节点运行超时后按照重试策略重试或失败
+		go client.FunctionRunTimeoutConsumer()
+		// map模式节点被展开的数组为空时直接以空数组完成
+		go client.MapFunctionRunEmptyConsumer()
+		// 注册并运行由bloc-server自身运行的内置function
+		builtin_function.InjectHttpRequestAccessPolicy(blocApp.configBuilder.BuiltinHttpRequestAccess)
+		go client.BuiltinFunctionConsumer()
+
+		// 审批人审批等待审批的人工审批节点，审批后驱动flow继续运行
+		router.POST("/api/v1/function_run_record/decide_approval",
+			middleware.WithTrace(middleware.LoginAuth(client.DecideApproval)))
+
 		basicPath := "/api/v1/client"
 		{
 			router.POST(basicPath+"/register_functions", middleware.WithTrace(client.RegisterFunctions))
@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fBloc/bloc-server/infrastructure/log_collect_backend"
+	"github.com/fBloc/bloc-server/internal/timestamp"
+)
+
+func init() {
+	var _ log_collect_backend.LogBackEnd = &MemoryLogBackendRepository{}
+}
+
+type logEntry struct {
+	tagMap  map[string]string
+	data    string
+	logTime time.Time
+}
+
+// MemoryLogBackendRepository 返回的数据格式与influxdb实现保持一致
+type MemoryLogBackendRepository struct {
+	logNameMapEntries map[string][]logEntry
+	sync.RWMutex
+}
+
+func New() *MemoryLogBackendRepository {
+	return &MemoryLogBackendRepository{
+		logNameMapEntries: make(map[string][]logEntry),
+	}
+}
+
+func (mlb *MemoryLogBackendRepository) Write(
+	logName string, tagMap map[string]string, data string,
+	logTime time.Time,
+) error {
+	tags := make(map[string]string, len(tagMap))
+	for k, v := range tagMap {
+		tags[k] = v
+	}
+
+	mlb.Lock()
+	defer mlb.Unlock()
+	mlb.logNameMapEntries[logName] = append(
+		mlb.logNameMapEntries[logName],
+		logEntry{tagMap: tags, data: data, logTime: logTime})
+	return nil
+}
+
+func (mlb *MemoryLogBackendRepository) Fetch(
+	logName string, tagFilterMap map[string]string, start, end time.Time,
+) ([]interface{}, error) {
+	mlb.RLock()
+	entries := make([]logEntry, 0, len(mlb.logNameMapEntries[logName]))
+	for _, entry := range mlb.logNameMapEntries[logName] {
+		if !start.IsZero() && entry.logTime.Before(start) {
+			continue
+		}
+		if !end.IsZero() && entry.logTime.After(end) {
+			continue
+		}
+		matched := true
+		for k, v := range tagFilterMap {
+			if entry.tagMap[k] != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			entries = append(entries, entry)
+		}
+	}
+	mlb.RUnlock()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].logTime.Before(entries[j].logTime)
+	})
+
+	ret := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		tmp := map[string]interface{}{
+			"time": timestamp.NewTimeStampFromTime(entry.logTime),
+			"data": entry.data,
+		}
+		for k, v := range entry.tagMap {
+			tmp[k] = v
+		}
+		ret = append(ret, tmp)
+	}
+	return ret, nil
+}
+
+func (mlb *MemoryLogBackendRepository) FetchAll(
+	logName string, tagFilterMap map[string]string,
+) ([]interface{}, error) {
+	return mlb.Fetch(logName, tagFilterMap, time.Time{}, time.Now())
+}
+
+func (mlb *MemoryLogBackendRepository) ForceFlush() error {
+	return nil
+}
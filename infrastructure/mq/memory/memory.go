@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/fBloc/bloc-server/infrastructure/mq"
+)
+
+func init() {
+	var _ mq.MsgQueue = &MemoryMQ{}
+}
+
+// queue 同rabbit中的queue，同一queue的多个拉取者竞争消费
+type queue struct {
+	bindingKeys map[string]struct{}
+	msgs        [][]byte
+	cond        *sync.Cond
+}
+
+// MemoryMQ 进程内的topic exchange实现，仅用于单进程运行（开发、测试）
+type MemoryMQ struct {
+	queues         map[string]*queue
+	broadcastCount int // 用于生成PullBroadcast的队列名
+	sync.Mutex
+}
+
+func New() *MemoryMQ {
+	return &MemoryMQ{queues: make(map[string]*queue)}
+}
+
+// topicMatch 按照rabbit topic exchange的规则匹配routing key:
+// "*" 匹配一个单词，"#" 匹配零个或多个单词
+func topicMatch(bindingKey, routingKey string) bool {
+	return matchWords(strings.Split(bindingKey, "."), strings.Split(routingKey, "."))
+}
+
+func matchWords(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if matchWords(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && matchWords(pattern[1:], words[1:])
+	}
+	return len(words) > 0 && pattern[0] == words[0] && matchWords(pattern[1:], words[1:])
+}
+
+func (m *MemoryMQ) Pub(topic string, data []byte) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, q := range m.queues {
+		for bindingKey := range q.bindingKeys {
+			if !topicMatch(bindingKey, topic) {
+				continue
+			}
+			q.cond.L.Lock()
+			q.msgs = append(q.msgs, data)
+			q.cond.L.Unlock()
+			q.cond.Signal()
+			break
+		}
+	}
+	return nil
+}
+
+func (m *MemoryMQ) Pull(
+	topic, pullerTag string,
+	respMsgByteChan chan []byte,
+) error {
+	m.Lock()
+	q, ok := m.queues[pullerTag]
+	if !ok {
+		q = &queue{
+			bindingKeys: make(map[string]struct{}),
+			cond:        sync.NewCond(&sync.Mutex{}),
+		}
+		m.queues[pullerTag] = q
+	}
+	q.bindingKeys[topic] = struct{}{}
+	m.Unlock()
+
+	go func() {
+		for {
+			q.cond.L.Lock()
+			for len(q.msgs) == 0 {
+				q.cond.Wait()
+			}
+			msg := q.msgs[0]
+			q.msgs = q.msgs[1:]
+			q.cond.L.Unlock()
+			respMsgByteChan <- msg
+		}
+	}()
+	return nil
+}
+
+func (m *MemoryMQ) PullBroadcast(
+	topic string,
+	respMsgByteChan chan []byte,
+) error {
+	m.Lock()
+	m.broadcastCount++
+	queueName := fmt.Sprintf("broadcast.%d", m.broadcastCount)
+	m.Unlock()
+	return m.Pull(topic, queueName, respMsgByteChan)
+}
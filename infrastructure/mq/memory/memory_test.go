@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTopicMatch(t *testing.T) {
+	Convey("exact", t, func() {
+		So(topicMatch("flow_run_finished", "flow_run_finished"), ShouldBeTrue)
+		So(topicMatch("flow_run_finished", "flow_to_run"), ShouldBeFalse)
+	})
+
+	Convey("wildcard", t, func() {
+		So(topicMatch("function_client_run_consumer.*", "function_client_run_consumer.go"), ShouldBeTrue)
+		So(topicMatch("function_client_run_consumer.*", "function_client_run_consumer"), ShouldBeFalse)
+		So(topicMatch("function_client_run_consumer.#", "function_client_run_consumer"), ShouldBeTrue)
+		So(topicMatch("#", "a.b.c"), ShouldBeTrue)
+	})
+}
+
+func receive(c chan []byte) string {
+	select {
+	case msg := <-c:
+		return string(msg)
+	case <-time.After(time.Second):
+		return ""
+	}
+}
+
+func TestPubPull(t *testing.T) {
+	m := New()
+
+	Convey("fan out to different queues", t, func() {
+		aChan, bChan := make(chan []byte), make(chan []byte)
+		So(m.Pull("topic", "queue_a", aChan), ShouldBeNil)
+		So(m.Pull("topic", "queue_b", bChan), ShouldBeNil)
+
+		So(m.Pub("topic", []byte("hello")), ShouldBeNil)
+		So(receive(aChan), ShouldEqual, "hello")
+		So(receive(bChan), ShouldEqual, "hello")
+	})
+
+	Convey("consumers of same queue compete", t, func() {
+		c1, c2 := make(chan []byte, 1), make(chan []byte, 1)
+		So(m.Pull("compete", "queue_c", c1), ShouldBeNil)
+		So(m.Pull("compete", "queue_c", c2), ShouldBeNil)
+
+		So(m.Pub("compete", []byte("only once")), ShouldBeNil)
+		time.Sleep(50 * time.Millisecond)
+		So(len(c1)+len(c2), ShouldEqual, 1)
+	})
+
+	Convey("every broadcast puller receives all msgs", t, func() {
+		c1, c2 := make(chan []byte), make(chan []byte)
+		So(m.PullBroadcast("broadcast", c1), ShouldBeNil)
+		So(m.PullBroadcast("broadcast", c2), ShouldBeNil)
+
+		So(m.Pub("broadcast", []byte("to all")), ShouldBeNil)
+		So(receive(c1), ShouldEqual, "to all")
+		So(receive(c2), ShouldEqual, "to all")
+	})
+
+	Convey("msg published before pull is dropped", t, func() {
+		So(m.Pub("nobody_listen", []byte("lost")), ShouldBeNil)
+		c := make(chan []byte)
+		So(m.Pull("nobody_listen", "queue_d", c), ShouldBeNil)
+		So(receive(c), ShouldEqual, "")
+	})
+}
@@ -3,4 +3,6 @@ package mq
 type MsgQueue interface {
 	Pub(topic string, data []byte) error
 	Pull(topic, pullerTag string, respMsgByteChan chan []byte) error
+	// PullBroadcast 每次调用各自收到全部的消息，队列只属于当前进程，进程退出后不会残留
+	PullBroadcast(topic string, respMsgByteChan chan []byte) error
 }
@@ -49,3 +49,10 @@ func (rmq *RabbitChannel) Pull(
 ) error {
 	return rmq.conRabbitChannel.Pull(topicExchangeName, topic, pullerTag, true, respMsgByteChan)
 }
+
+func (rmq *RabbitChannel) PullBroadcast(
+	topic string,
+	respMsgByteChan chan []byte,
+) error {
+	return rmq.conRabbitChannel.PullExclusive(topicExchangeName, topic, respMsgByteChan)
+}
@@ -0,0 +1,98 @@
+package dingtalk
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/fBloc/bloc-server/infrastructure/notifier"
+)
+
+func init() {
+	var _ notifier.Notifier = &DingTalk{}
+}
+
+// DingTalk 通过钉钉群机器人发送通知，target为机器人的webhook地址，
+// 机器人开启了加签时secret为其密钥
+type DingTalk struct {
+	client *http.Client
+}
+
+func New(timeout time.Duration) *DingTalk {
+	return &DingTalk{client: &http.Client{Timeout: timeout}}
+}
+
+// Sign 钉钉机器人的加签方式：base64(hmac_sha256(secret, timestamp + "\n" + secret))
+func Sign(secret string, timestampInMs int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestampInMs, 10) + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signedURL(target, secret string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+	query := u.Query()
+	query.Set("timestamp", strconv.FormatInt(timestamp, 10))
+	query.Set("sign", Sign(secret, timestamp))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func (d *DingTalk) Notify(
+	ctx context.Context, target, secret string, msg notifier.Message,
+) error {
+	if secret != "" {
+		var err error
+		target, err = signedURL(target, secret)
+		if err != nil {
+			return err
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": msg.Title + "\n" + msg.Text},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("dingtalk resp status code: %d", resp.StatusCode)
+	}
+	// 钉钉在http状态码为200时通过errcode表示是否成功
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return err
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("dingtalk errcode: %d, errmsg: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package dingtalk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/infrastructure/notifier"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDingTalk(t *testing.T) {
+	var receivedSign string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedSign = r.URL.Query().Get("sign")
+		if r.URL.Query().Get("access_token") == "wrong" {
+			w.Write([]byte(`{"errcode":300001,"errmsg":"token is not exist"}`))
+			return
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+
+	d := New(time.Second)
+	msg := notifier.Message{Title: "title", Text: "text"}
+
+	Convey("signed when have secret", t, func() {
+		err := d.Notify(context.TODO(), server.URL+"?access_token=right", "secret", msg)
+		So(err, ShouldBeNil)
+		So(receivedSign, ShouldNotBeBlank)
+
+		err = d.Notify(context.TODO(), server.URL+"?access_token=right", "", msg)
+		So(err, ShouldBeNil)
+		So(receivedSign, ShouldBeBlank)
+	})
+
+	Convey("errcode not 0 is error", t, func() {
+		err := d.Notify(context.TODO(), server.URL+"?access_token=wrong", "", msg)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("sign", t, func() {
+		So(Sign("secret", 1), ShouldEqual, Sign("secret", 1))
+		So(Sign("secret", 1), ShouldNotEqual, Sign("secret", 2))
+	})
+}
@@ -0,0 +1,67 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/fBloc/bloc-server/infrastructure/notifier"
+)
+
+func init() {
+	var _ notifier.Notifier = &Email{}
+}
+
+type SmtpConfig struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	From     string
+}
+
+func (sC *SmtpConfig) IsNil() bool {
+	if sC == nil {
+		return true
+	}
+	return sC.Host == ""
+}
+
+// Email 通过smtp发送通知邮件，target为收件地址
+type Email struct {
+	conf *SmtpConfig
+}
+
+func New(conf *SmtpConfig) *Email {
+	return &Email{conf: conf}
+}
+
+func (e *Email) Notify(
+	_ context.Context, target, _ string, msg notifier.Message,
+) error {
+	if e.conf.IsNil() {
+		return errors.New("smtp not configured")
+	}
+	from := e.conf.From
+	if from == "" {
+		from = e.conf.User
+	}
+
+	var content strings.Builder
+	fmt.Fprintf(&content, "From: %s\r\n", from)
+	fmt.Fprintf(&content, "To: %s\r\n", target)
+	fmt.Fprintf(&content, "Subject: %s\r\n", msg.Title)
+	content.WriteString("MIME-Version: 1.0\r\n")
+	content.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	content.WriteString(msg.Text)
+
+	var auth smtp.Auth
+	if e.conf.User != "" {
+		auth = smtp.PlainAuth("", e.conf.User, e.conf.Password, e.conf.Host)
+	}
+	return smtp.SendMail(
+		fmt.Sprintf("%s:%d", e.conf.Host, e.conf.Port),
+		auth, from, []string{target}, []byte(content.String()))
+}
@@ -0,0 +1,15 @@
+package notifier
+
+import "context"
+
+// Message 一条通知的内容
+type Message struct {
+	Title string
+	Text  string // 供人阅读的内容，email/slack/dingtalk发送此内容
+	Data  []byte // 结构化的json内容，webhook发送此内容
+}
+
+// Notifier 某个渠道的通知发送实现，target/secret来自通知规则
+type Notifier interface {
+	Notify(ctx context.Context, target, secret string, msg Message) error
+}
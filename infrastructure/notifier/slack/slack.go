@@ -0,0 +1,51 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fBloc/bloc-server/infrastructure/notifier"
+)
+
+func init() {
+	var _ notifier.Notifier = &Slack{}
+}
+
+// Slack 通过slack的incoming webhook发送通知，target为webhook地址
+type Slack struct {
+	client *http.Client
+}
+
+func New(timeout time.Duration) *Slack {
+	return &Slack{client: &http.Client{Timeout: timeout}}
+}
+
+func (s *Slack) Notify(
+	ctx context.Context, target, _ string, msg notifier.Message,
+) error {
+	body, err := json.Marshal(map[string]string{
+		"text": fmt.Sprintf("*%s*\n%s", msg.Title, msg.Text)})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack resp status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fBloc/bloc-server/infrastructure/notifier"
+)
+
+func init() {
+	var _ notifier.Notifier = &Webhook{}
+}
+
+const (
+	TimestampHeader = "X-Bloc-Timestamp"
+	SignatureHeader = "X-Bloc-Signature"
+)
+
+// Webhook 以POST json的方式发送通知，设置了secret时对请求签名
+type Webhook struct {
+	client *http.Client
+}
+
+func New(timeout time.Duration) *Webhook {
+	return &Webhook{client: &http.Client{Timeout: timeout}}
+}
+
+// Sign 签名为 hex(hmac_sha256(secret, timestamp + "." + body))，接收方以同样的方式计算后比较
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (wh *Webhook) Notify(
+	ctx context.Context, target, secret string, msg notifier.Message,
+) error {
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, target, bytes.NewReader(msg.Data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Sign(secret, timestamp, msg.Data))
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook resp status code: %d, body: %s", resp.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/infrastructure/notifier"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWebhook(t *testing.T) {
+	var receivedSignature, receivedTimestamp string
+	var receivedBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedSignature = r.Header.Get(SignatureHeader)
+		receivedTimestamp = r.Header.Get(TimestampHeader)
+		receivedBody, _ = ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	wh := New(time.Second)
+	msg := notifier.Message{Data: []byte(`{"status":7}`)}
+
+	Convey("signed", t, func() {
+		err := wh.Notify(context.TODO(), server.URL, "secret", msg)
+		So(err, ShouldBeNil)
+		So(string(receivedBody), ShouldEqual, string(msg.Data))
+		So(receivedTimestamp, ShouldNotBeBlank)
+		So(receivedSignature, ShouldEqual, Sign("secret", receivedTimestamp, msg.Data))
+		So(receivedSignature, ShouldNotEqual, Sign("other", receivedTimestamp, msg.Data))
+	})
+
+	Convey("without secret not signed", t, func() {
+		err := wh.Notify(context.TODO(), server.URL, "", msg)
+		So(err, ShouldBeNil)
+		So(receivedSignature, ShouldBeBlank)
+	})
+
+	Convey("non 2xx status is error", t, func() {
+		err := wh.Notify(context.TODO(), server.URL+"/fail", "", msg)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,37 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/fBloc/bloc-server/infrastructure/object_storage"
+)
+
+func init() {
+	var _ object_storage.ObjectStorage = &ObjectStorageMemoryRepository{}
+}
+
+type ObjectStorageMemoryRepository struct {
+	keyMapData map[string][]byte
+	sync.RWMutex
+}
+
+func New() *ObjectStorageMemoryRepository {
+	return &ObjectStorageMemoryRepository{keyMapData: make(map[string][]byte)}
+}
+
+func (oSMR *ObjectStorageMemoryRepository) Set(key string, byteData []byte) error {
+	data := make([]byte, len(byteData))
+	copy(data, byteData)
+
+	oSMR.Lock()
+	defer oSMR.Unlock()
+	oSMR.keyMapData[key] = data
+	return nil
+}
+
+func (oSMR *ObjectStorageMemoryRepository) Get(key string) (bool, []byte, error) {
+	oSMR.RLock()
+	defer oSMR.RUnlock()
+	data, ok := oSMR.keyMapData[key]
+	return ok, data, nil
+}
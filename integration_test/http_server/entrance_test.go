@@ -24,7 +24,12 @@ import (
 	"github.com/ory/dockertest/v3/docker"
 )
 
-func TestMain(m *testing.M) {
+// withDockerEnvKey 设置此环境变量后，使用docker启动真实的中间件进行测试，
+// 否则使用进程内实现
+const withDockerEnvKey = "BLOC_TEST_WITH_DOCKER"
+
+// startDockerDependencies 启动依赖的各中间件容器，返回清理容器的函数
+func startDockerDependencies() (purge func()) {
 	pool, err := dockertest.NewPool("")
 	if err != nil {
 		log.Fatalf("Could not connect to docker: %s", err)
@@ -165,22 +170,55 @@ func TestMain(m *testing.M) {
 
 	waitContainerAllReady.Wait()
 
+	return func() {
+		if err = pool.Purge(influxdbResource); err != nil {
+			log.Fatalf("Could not purge influxdbResource: %s", err)
+		}
+
+		if err = pool.Purge(minioResource); err != nil {
+			log.Fatalf("Could not purge minioResource: %s", err)
+		}
+
+		if err = pool.Purge(mongoResource); err != nil {
+			log.Fatalf("Could not purge mongoResource: %s", err)
+		}
+
+		if err = pool.Purge(rabbitResource); err != nil {
+			log.Fatalf("Could not purge rabbitResource: %s", err)
+		}
+	}
+}
+
+func TestMain(m *testing.M) {
+	var err error
+	withDocker := os.Getenv(withDockerEnvKey) != ""
+	purge := func() {}
+	if withDocker {
+		purge = startDockerDependencies()
+	}
+
 	// start bloc server
 	go func() {
 		appName := "test"
 		blocApp := &bloc.BlocApp{Name: appName}
 
-		blocApp.GetConfigBuilder().
-			SetRabbitConfig(
-				rabbitConf.User, rabbitConf.Password, rabbitConf.Host, "").
-			SetMongoConfig(
-				mongoConf.User, mongoConf.Password, mongoConf.Addresses,
-				appName, "", "").
-			SetMinioConfig(
-				appName, minioConf.Addresses, minioConf.AccessKey, minioConf.AccessPassword).
-			SetInfluxDBConfig(
-				influxDBConf.UserName, influxDBConf.Password, influxDBConf.Address,
-				influxDBConf.Organization, influxDBConf.Token).
+		confBuilder := blocApp.GetConfigBuilder()
+		if withDocker {
+			confBuilder.
+				SetRabbitConfig(
+					rabbitConf.User, rabbitConf.Password, rabbitConf.Host, "").
+				SetMongoConfig(
+					mongoConf.User, mongoConf.Password, mongoConf.Addresses,
+					appName, "", "").
+				SetMinioConfig(
+					appName, minioConf.Addresses, minioConf.AccessKey, minioConf.AccessPassword).
+				SetInfluxDBConfig(
+					influxDBConf.UserName, influxDBConf.Password, influxDBConf.Address,
+					influxDBConf.Organization, influxDBConf.Token)
+		} else {
+			confBuilder.SetInMemory()
+		}
+		confBuilder.
 			SetHttpServer(
 				serverHost, serverPort).
 			BuildUp()
@@ -214,12 +252,12 @@ func TestMain(m *testing.M) {
 		web.RespMsg
 		Data user.User `json:"data"`
 	}{}
-	http_util.Post(
+	_, err = http_util.Post(
 		http_util.BlankHeader,
 		serverAddress+"/api/v1/login",
 		http_util.BlankGetParam, superUserPostBody, &superUserLoginResp)
 	if superUserLoginResp.Data.Token.IsNil() {
-		log.Fatalf("login to get token error:" + err.Error())
+		log.Fatalf("login to get token error: %v", err)
 	}
 	superUserToken = superUserLoginResp.Data.Token.String()
 
@@ -242,12 +280,12 @@ func TestMain(m *testing.M) {
 		web.RespMsg
 		Data user.User `json:"data"`
 	}{}
-	http_util.Post(
+	_, err = http_util.Post(
 		http_util.BlankHeader,
 		serverAddress+"/api/v1/login",
 		http_util.BlankGetParam, nobodyPostBody, &nobodyLoginResp)
 	if nobodyLoginResp.Data.Token.IsNil() {
-		log.Fatalf("login to get nobody's token error:" + err.Error())
+		log.Fatalf("login to get nobody's token error: %v", err)
 	}
 	nobodyToken = nobodyLoginResp.Data.Token.String()
 	nobodyID = nobodyLoginResp.Data.ID
@@ -335,22 +373,7 @@ func TestMain(m *testing.M) {
 	// run tests
 	code := m.Run()
 
-	// remove container
-	if err = pool.Purge(influxdbResource); err != nil {
-		log.Fatalf("Could not purge influxdbResource: %s", err)
-	}
-
-	if err = pool.Purge(minioResource); err != nil {
-		log.Fatalf("Could not purge minioResource: %s", err)
-	}
-
-	if err = pool.Purge(mongoResource); err != nil {
-		log.Fatalf("Could not purge mongoResource: %s", err)
-	}
-
-	if err = pool.Purge(rabbitResource); err != nil {
-		log.Fatalf("Could not purge rabbitResource: %s", err)
-	}
+	purge()
 
 	os.Exit(code)
 }
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/fBloc/bloc-server/aggregate"
@@ -455,6 +456,262 @@ func TestOnlineFlow(t *testing.T) {
 				So(getFlowResp.Flow.AllowTriggerByKey, ShouldBeFalse)
 			})
 
+			Convey("SetExecuteControlAttribute run_conflict_strategy", func() {
+				req := flow.Flow{
+					ID:                  pubResp.OnlineFlow.ID,
+					RunConflictStrategy: value_object.QueueNewRun,
+				}
+				reqBody, _ := json.Marshal(req)
+				var resp *web.RespMsg
+				_, err := http_util.Patch(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/set_execute_control_attributes",
+					http_util.BlankGetParam, reqBody, &resp)
+				So(err, ShouldBeNil)
+				So(resp.Code, ShouldEqual, http.StatusOK)
+
+				getFlowResp := struct {
+					web.RespMsg
+					Flow *flow.Flow `json:"data"`
+				}{}
+				http_util.Get(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/get_by_id/"+pubResp.OnlineFlow.ID.String(),
+					http_util.BlankGetParam, &getFlowResp)
+				So(getFlowResp.Flow.RunConflictStrategy, ShouldEqual, value_object.QueueNewRun)
+
+				req.RunConflictStrategy = "unknown"
+				reqBody, _ = json.Marshal(req)
+				_, err = http_util.Patch(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/set_execute_control_attributes",
+					http_util.BlankGetParam, reqBody, &resp)
+				So(err, ShouldBeNil)
+				So(resp.Code, ShouldEqual, http.StatusBadRequest)
+			})
+
+			Convey("SetExecuteControlAttribute max_concurrent_runs & run queue", func() {
+				req := flow.Flow{
+					ID:                  pubResp.OnlineFlow.ID,
+					AllowParallelRun:    true,
+					MaxConcurrentRuns:   3,
+					RunConflictStrategy: value_object.KeepLatestPending,
+				}
+				reqBody, _ := json.Marshal(req)
+				var resp *web.RespMsg
+				_, err := http_util.Patch(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/set_execute_control_attributes",
+					http_util.BlankGetParam, reqBody, &resp)
+				So(err, ShouldBeNil)
+				So(resp.Code, ShouldEqual, http.StatusOK)
+
+				getFlowResp := struct {
+					web.RespMsg
+					Flow *flow.Flow `json:"data"`
+				}{}
+				http_util.Get(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/get_by_id/"+pubResp.OnlineFlow.ID.String(),
+					http_util.BlankGetParam, &getFlowResp)
+				So(getFlowResp.Flow.MaxConcurrentRuns, ShouldEqual, 3)
+				So(getFlowResp.Flow.RunConflictStrategy, ShouldEqual, value_object.KeepLatestPending)
+
+				runQueueResp := struct {
+					web.RespMsg
+					Data struct {
+						MaxConcurrentRuns int `json:"max_concurrent_runs"`
+						QueueDepth        int `json:"queue_depth"`
+					} `json:"data"`
+				}{}
+				_, err = http_util.Get(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/run_queue/by_origin_id/"+pubResp.OnlineFlow.OriginID.String(),
+					http_util.BlankGetParam, &runQueueResp)
+				So(err, ShouldBeNil)
+				So(runQueueResp.Code, ShouldEqual, http.StatusOK)
+				So(runQueueResp.Data.MaxConcurrentRuns, ShouldEqual, 3)
+				So(runQueueResp.Data.QueueDepth, ShouldEqual, 0)
+			})
+
+			Convey("SetExecuteControlAttribute paused & blackout windows", func() {
+				req := flow.Flow{
+					ID:     pubResp.OnlineFlow.ID,
+					Paused: true,
+					BlackoutWindows: []flow.BlackoutWindow{
+						{Weekdays: []time.Weekday{time.Saturday}, Start: "22:00", End: "06:00"}},
+				}
+				reqBody, _ := json.Marshal(req)
+				var resp *web.RespMsg
+				_, err := http_util.Patch(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/set_execute_control_attributes",
+					http_util.BlankGetParam, reqBody, &resp)
+				So(err, ShouldBeNil)
+				So(resp.Code, ShouldEqual, http.StatusOK)
+
+				getFlowResp := struct {
+					web.RespMsg
+					Flow *flow.Flow `json:"data"`
+				}{}
+				http_util.Get(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/get_by_id/"+pubResp.OnlineFlow.ID.String(),
+					http_util.BlankGetParam, &getFlowResp)
+				So(getFlowResp.Flow.Paused, ShouldBeTrue)
+				So(len(getFlowResp.Flow.BlackoutWindows), ShouldEqual, 1)
+				So(getFlowResp.Flow.BlackoutWindows[0].End, ShouldEqual, "06:00")
+
+				// 不合法的时段
+				req.BlackoutWindows = []flow.BlackoutWindow{{Start: "25:00", End: "06:00"}}
+				reqBody, _ = json.Marshal(req)
+				_, err = http_util.Patch(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/set_execute_control_attributes",
+					http_util.BlankGetParam, reqBody, &resp)
+				So(err, ShouldBeNil)
+				So(resp.Code, ShouldEqual, http.StatusBadRequest)
+
+				// 恢复
+				req = flow.Flow{ID: pubResp.OnlineFlow.ID, BlackoutWindows: []flow.BlackoutWindow{}}
+				reqBody, _ = json.Marshal(req)
+				_, err = http_util.Patch(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/set_execute_control_attributes",
+					http_util.BlankGetParam, reqBody, &resp)
+				So(err, ShouldBeNil)
+				So(resp.Code, ShouldEqual, http.StatusOK)
+				http_util.Get(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/get_by_id/"+pubResp.OnlineFlow.ID.String(),
+					http_util.BlankGetParam, &getFlowResp)
+				So(getFlowResp.Flow.Paused, ShouldBeFalse)
+				So(len(getFlowResp.Flow.BlackoutWindows), ShouldEqual, 0)
+			})
+
+			Convey("SetExecuteControlAttribute dependencies", func() {
+				// 另一个作为上游的在线flow
+				upstreamReqBody, _ := json.Marshal(aggFlowToWebFlow(getFakeAggFlow()))
+				upstreamDraftResp := struct {
+					web.RespMsg
+					DraftFlow *flow.Flow `json:"data"`
+				}{}
+				http_util.Post(
+					superuserHeader(),
+					serverAddress+"/api/v1/draft_flow",
+					http_util.BlankGetParam,
+					upstreamReqBody, &upstreamDraftResp)
+				So(upstreamDraftResp.DraftFlow.IsZero(), ShouldBeFalse)
+				upstreamPubResp := struct {
+					web.RespMsg
+					OnlineFlow *flow.Flow `json:"data"`
+				}{}
+				_, err := http_util.Get(
+					superuserHeader(),
+					serverAddress+"/api/v1/draft_flow/commit_by_id/"+upstreamDraftResp.DraftFlow.ID.String(),
+					http_util.BlankGetParam,
+					&upstreamPubResp)
+				So(err, ShouldBeNil)
+				So(upstreamPubResp.OnlineFlow.IsZero(), ShouldBeFalse)
+				upstreamFlow := upstreamPubResp.OnlineFlow
+
+				setDependencies := func(flowID value_object.UUID, dependencies []flow.FlowDependency) int {
+					reqBody, _ := json.Marshal(flow.Flow{ID: flowID, Dependencies: dependencies})
+					var resp *web.RespMsg
+					_, err := http_util.Patch(
+						superuserHeader(),
+						serverAddress+"/api/v1/flow/set_execute_control_attributes",
+						http_util.BlankGetParam, reqBody, &resp)
+					So(err, ShouldBeNil)
+					return resp.Code
+				}
+
+				code := setDependencies(pubResp.OnlineFlow.ID, []flow.FlowDependency{{
+					UpstreamFlowOriginID: upstreamFlow.OriginID,
+					On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnSuc},
+				}})
+				So(code, ShouldEqual, http.StatusOK)
+
+				getFlowResp := struct {
+					web.RespMsg
+					Flow *flow.Flow `json:"data"`
+				}{}
+				http_util.Get(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/get_by_id/"+pubResp.OnlineFlow.ID.String(),
+					http_util.BlankGetParam, &getFlowResp)
+				So(len(getFlowResp.Flow.Dependencies), ShouldEqual, 1)
+				So(getFlowResp.Flow.Dependencies[0].UpstreamFlowOriginID, ShouldEqual, upstreamFlow.OriginID)
+
+				// 上游反过来依赖下游会成环
+				code = setDependencies(upstreamFlow.ID, []flow.FlowDependency{{
+					UpstreamFlowOriginID: pubResp.OnlineFlow.OriginID,
+					On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnFail},
+				}})
+				So(code, ShouldEqual, http.StatusBadRequest)
+
+				// 依赖自身
+				code = setDependencies(pubResp.OnlineFlow.ID, []flow.FlowDependency{{
+					UpstreamFlowOriginID: pubResp.OnlineFlow.OriginID,
+					On:                   []value_object.DependencyTriggerOn{value_object.DependencyOnSuc},
+				}})
+				So(code, ShouldEqual, http.StatusBadRequest)
+
+				// 恢复
+				code = setDependencies(pubResp.OnlineFlow.ID, []flow.FlowDependency{})
+				So(code, ShouldEqual, http.StatusOK)
+				http_util.Get(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/get_by_id/"+pubResp.OnlineFlow.ID.String(),
+					http_util.BlankGetParam, &getFlowResp)
+				So(len(getFlowResp.Flow.Dependencies), ShouldEqual, 0)
+
+				var deleteResp web.RespMsg
+				_, err = http_util.Delete(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/delete_by_origin_id/"+upstreamFlow.OriginID.String(),
+					http_util.BlankGetParam, http_util.BlankBody,
+					&deleteResp)
+				So(err, ShouldBeNil)
+				So(deleteResp.Code, ShouldEqual, http.StatusOK)
+			})
+
+			Convey("SetExecuteControlAttribute crontab misfire policy", func() {
+				req := flow.Flow{
+					ID:                    pubResp.OnlineFlow.ID,
+					CrontabMisfirePolicy:  value_object.MisfireFireAll,
+					CrontabMisfireMaxRuns: 5,
+				}
+				reqBody, _ := json.Marshal(req)
+				var resp *web.RespMsg
+				_, err := http_util.Patch(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/set_execute_control_attributes",
+					http_util.BlankGetParam, reqBody, &resp)
+				So(err, ShouldBeNil)
+				So(resp.Code, ShouldEqual, http.StatusOK)
+
+				getFlowResp := struct {
+					web.RespMsg
+					Flow *flow.Flow `json:"data"`
+				}{}
+				http_util.Get(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/get_by_id/"+pubResp.OnlineFlow.ID.String(),
+					http_util.BlankGetParam, &getFlowResp)
+				So(getFlowResp.Flow.CrontabMisfirePolicy, ShouldEqual, value_object.MisfireFireAll)
+				So(getFlowResp.Flow.CrontabMisfireMaxRuns, ShouldEqual, 5)
+
+				req.CrontabMisfirePolicy = "unknown"
+				reqBody, _ = json.Marshal(req)
+				_, err = http_util.Patch(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/set_execute_control_attributes",
+					http_util.BlankGetParam, reqBody, &resp)
+				So(err, ShouldBeNil)
+				So(resp.Code, ShouldEqual, http.StatusBadRequest)
+			})
+
 			Convey("SetExecuteControlAttribute crontab string", func() {
 				Convey("valid set", func() {
 					crontabStr := "* * * * *"
@@ -487,6 +744,36 @@ func TestOnlineFlow(t *testing.T) {
 					So(getFlowResp.Flow.Crontab, ShouldEqual, crontabStr)
 				})
 
+				Convey("valid set with timezone & seconds", func() {
+					for _, crontabStr := range []string{
+						"CRON_TZ=Asia/Shanghai */30 * * * * *", "@every 30s", "@hourly"} {
+						req := flow.Flow{
+							ID:      pubResp.OnlineFlow.ID,
+							Crontab: crontabStr,
+						}
+						reqBody, _ := json.Marshal(req)
+						var resp *web.RespMsg
+						_, err := http_util.Patch(
+							superuserHeader(),
+							serverAddress+"/api/v1/flow/set_execute_control_attributes",
+							http_util.BlankGetParam,
+							reqBody,
+							&resp)
+						So(err, ShouldBeNil)
+						So(resp.Code, ShouldEqual, http.StatusOK)
+
+						getFlowResp := struct {
+							web.RespMsg
+							Flow *flow.Flow `json:"data"`
+						}{}
+						http_util.Get(
+							superuserHeader(),
+							serverAddress+"/api/v1/flow/get_by_id/"+pubResp.OnlineFlow.ID.String(),
+							http_util.BlankGetParam, &getFlowResp)
+						So(getFlowResp.Flow.Crontab, ShouldEqual, crontabStr)
+					}
+				})
+
 				Convey("not valid set", func() {
 					crontabStr := "* * * *"
 					req := flow.Flow{
@@ -505,6 +792,79 @@ func TestOnlineFlow(t *testing.T) {
 					So(resp.Code, ShouldEqual, http.StatusBadRequest)
 				})
 			})
+
+			Convey("crontab schedule preview & calendar", func() {
+				crontabStr := "@every 1h"
+				req := flow.Flow{
+					ID:      pubResp.OnlineFlow.ID,
+					Crontab: crontabStr,
+				}
+				reqBody, _ := json.Marshal(req)
+				var resp *web.RespMsg
+				_, err := http_util.Patch(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/set_execute_control_attributes",
+					http_util.BlankGetParam, reqBody, &resp)
+				So(err, ShouldBeNil)
+				So(resp.Code, ShouldEqual, http.StatusOK)
+
+				nextFireTimesResp := struct {
+					web.RespMsg
+					Data struct {
+						Crontab       string  `json:"crontab"`
+						NextFireTimes []int64 `json:"next_fire_times"`
+					} `json:"data"`
+				}{}
+				_, err = http_util.Get(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/schedule/next_fire_times",
+					map[string]string{
+						"origin_id": pubResp.OnlineFlow.OriginID.String(),
+						"amount":    "3"},
+					&nextFireTimesResp)
+				So(err, ShouldBeNil)
+				So(nextFireTimesResp.Code, ShouldEqual, http.StatusOK)
+				So(nextFireTimesResp.Data.Crontab, ShouldEqual, crontabStr)
+				So(len(nextFireTimesResp.Data.NextFireTimes), ShouldEqual, 3)
+				So(nextFireTimesResp.Data.NextFireTimes[1]-nextFireTimesResp.Data.NextFireTimes[0],
+					ShouldEqual, 3600)
+
+				_, err = http_util.Get(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/schedule/next_fire_times",
+					map[string]string{"crontab": "* * * *"},
+					&nextFireTimesResp)
+				So(err, ShouldBeNil)
+				So(nextFireTimesResp.Code, ShouldEqual, http.StatusBadRequest)
+
+				calendarResp := struct {
+					web.RespMsg
+					Data struct {
+						Flows []struct {
+							FlowOriginID value_object.UUID `json:"flow_origin_id"`
+							FireAmount   int               `json:"fire_amount"`
+						} `json:"flows"`
+						Hourly []struct {
+							FireAmount int `json:"fire_amount"`
+						} `json:"hourly"`
+					} `json:"data"`
+				}{}
+				_, err = http_util.Get(
+					superuserHeader(),
+					serverAddress+"/api/v1/flow/schedule/calendar",
+					http_util.BlankGetParam, &calendarResp)
+				So(err, ShouldBeNil)
+				So(calendarResp.Code, ShouldEqual, http.StatusOK)
+				matched := false
+				for _, f := range calendarResp.Data.Flows {
+					if f.FlowOriginID == pubResp.OnlineFlow.OriginID {
+						matched = true
+						So(f.FireAmount, ShouldEqual, 24)
+					}
+				}
+				So(matched, ShouldBeTrue)
+				So(len(calendarResp.Data.Hourly), ShouldBeGreaterThanOrEqualTo, 24)
+			})
 		})
 
 		Convey("permission", func() {
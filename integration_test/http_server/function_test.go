@@ -7,6 +7,7 @@ import (
 	"github.com/fBloc/bloc-server/interfaces/web"
 	"github.com/fBloc/bloc-server/interfaces/web/function"
 	"github.com/fBloc/bloc-server/internal/http_util"
+	"github.com/fBloc/bloc-server/pkg/builtin_function"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -23,10 +24,23 @@ func TestFilterFunction(t *testing.T) {
 			&functionResp)
 		So(err, ShouldBeNil)
 		So(functionResp.Code, ShouldEqual, http.StatusOK)
-		So(len(functionResp.Data), ShouldEqual, 1)
-		So(functionResp.Data[0].GroupName, ShouldEqual, fakeAggFunction.GroupName)
-		So(functionResp.Data[0].Functions[0].ID, ShouldEqual, fakeAggFunction.ID)
-		So(functionResp.Data[0].Functions[0].Name, ShouldEqual, fakeAggFunction.Name)
+		// 注册的function + 内置function
+		So(len(functionResp.Data), ShouldEqual, 2)
+		groupNameMapGroup := make(map[string]function.GroupFunctions, len(functionResp.Data))
+		for _, group := range functionResp.Data {
+			groupNameMapGroup[group.GroupName] = group
+		}
+
+		registered := groupNameMapGroup[fakeAggFunction.GroupName]
+		So(len(registered.Functions), ShouldBeGreaterThan, 0)
+		So(registered.Functions[0].ID, ShouldEqual, fakeAggFunction.ID)
+		So(registered.Functions[0].Name, ShouldEqual, fakeAggFunction.Name)
+
+		builtin := groupNameMapGroup[builtin_function.GroupName]
+		So(len(builtin.Functions), ShouldEqual, len(builtin_function.All()))
+		for _, f := range builtin.Functions {
+			So(f.ProviderName, ShouldEqual, builtin_function.ProviderName)
+		}
 	})
 }
 
@@ -326,4 +326,58 @@ func TestRunFlow(t *testing.T) {
 			So(theFlowRunRecord.EndTime.IsZero(), ShouldBeFalse)
 		})
 	})
+
+	Convey("paused flow's run should be skipped", t, func() {
+		setPaused := func(paused bool) {
+			reqBody, _ := json.Marshal(flow.Flow{ID: onlineFlow.ID, Paused: paused})
+			var resp *web.RespMsg
+			_, err := http_util.Patch(
+				superuserHeader(),
+				serverAddress+"/api/v1/flow/set_execute_control_attributes",
+				http_util.BlankGetParam, reqBody, &resp)
+			So(err, ShouldBeNil)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+		}
+		setPaused(true)
+
+		runResp := struct {
+			web.RespMsg
+			Data struct {
+				Msg             string            `json:"msg"`
+				FlowRunRecordID value_object.UUID `json:"flow_run_record_id"`
+			} `json:"data"`
+		}{}
+		_, err := http_util.Get(
+			superuserHeader(),
+			serverAddress+"/api/v1/flow/run/by_origin_id/"+onlineFlow.OriginID.String(),
+			http_util.BlankGetParam, &runResp)
+		So(err, ShouldBeNil)
+		So(runResp.Code, ShouldEqual, http.StatusOK)
+		So(runResp.Data.Msg, ShouldStartWith, "skipped")
+
+		// 跳过的运行保留在运行历史中
+		flowRunRecordResp := struct {
+			web.RespMsg
+			Data struct {
+				Items []*flow_run_record.FlowFunctionRecord `json:"items"`
+			} `json:"data"`
+		}{}
+		_, err = http_util.Get(
+			superuserHeader(),
+			serverAddress+"/api/v1/flow_run_record/",
+			map[string]string{"flow_origin_id": onlineFlow.OriginID.String()},
+			&flowRunRecordResp)
+		So(err, ShouldBeNil)
+		var skippedRecord *flow_run_record.FlowFunctionRecord
+		for _, item := range flowRunRecordResp.Data.Items {
+			if item.ID == runResp.Data.FlowRunRecordID {
+				skippedRecord = item
+			}
+		}
+		So(skippedRecord, ShouldNotBeNil)
+		So(skippedRecord.Status, ShouldEqual, value_object.ScheduleSkipped)
+		So(skippedRecord.ErrorMsg, ShouldContainSubstring, "paused")
+
+		setPaused(false)
+	})
 }
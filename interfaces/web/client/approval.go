@@ -0,0 +1,40 @@
+package client
+
+import (
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// DecideApprovalHttpReq 审批人对等待审批的节点做出审批
+type DecideApprovalHttpReq struct {
+	FunctionRunRecordID string `json:"function_run_record_id"`
+	Approved            bool   `json:"approved"`
+	Comment             string `json:"comment"`
+}
+
+// approvalResultReq 将审批节点的审批结果（通过/拒绝/超时）转换为节点运行完成的上报
+// 拒绝和超时按照节点配置使flow运行失败或拦截其下游节点
+func approvalResultReq(
+	funcRunRecordID value_object.UUID,
+	approval *aggregate.ApprovalSetting,
+	approved, timeout bool, description string,
+) FuncRunFinishedHttpReq {
+	req := FuncRunFinishedHttpReq{
+		FunctionRunRecordID: funcRunRecordID.String(),
+		Description:         description,
+		NonRetryable:        true, // 审批的结果不需要重试
+		byTimeoutWatcher:    timeout,
+	}
+	if approved {
+		req.Suc = true
+		return req
+	}
+	if approval.Fallback(timeout) == value_object.ApprovalInterceptRun {
+		req.Suc = true
+		req.InterceptBelowFunctionRun = true
+		return req
+	}
+	req.TimeoutCanceled = timeout
+	req.ErrorMsg = description
+	return req
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/fBloc/bloc-server/interfaces/web"
+	"github.com/fBloc/bloc-server/value_object"
+	"github.com/julienschmidt/httprouter"
+)
+
+// DecideApproval 审批人通过或拒绝等待审批的人工审批节点，审批人需要有flow的执行权限
+func DecideApproval(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	logTags := web.GetTraceAboutFields(r.Context())
+	logTags["business"] = "decide approval"
+	scheduleLogger.Infof(logTags, "start")
+
+	reqUser, suc := web.GetReqUserFromContext(r.Context())
+	if !suc {
+		scheduleLogger.Errorf(logTags, "failed to get user from context which should be setted by middleware!")
+		web.WriteInternalServerErrorResp(&w, r, nil, "get requser from context failed")
+		return
+	}
+	logTags["user_name"] = reqUser.Name
+
+	var req DecideApprovalHttpReq
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		scheduleLogger.Warningf(logTags, "unmarshal body failed: %v", err)
+		web.WriteBadRequestDataResp(&w, r, err.Error())
+		return
+	}
+	logTags["function_run_record_id"] = req.FunctionRunRecordID
+
+	funcRunRecordUUID, err := value_object.ParseToUUID(req.FunctionRunRecordID)
+	if err != nil {
+		web.WriteBadRequestDataResp(&w, r, "parse function_run_record_id to uuid failed: %v", err)
+		return
+	}
+	fRRIns, err := fRRService.FunctionRunRecords.GetByID(funcRunRecordUUID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "get function_run_record by id failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "get function_run_record by id failed")
+		return
+	}
+	if fRRIns.IsZero() {
+		web.WriteBadRequestDataResp(&w, r, "function_run_record_id find no record")
+		return
+	}
+	logTags[string(value_object.TraceID)] = fRRIns.TraceID
+
+	flowIns, err := flowService.Flow.GetByID(fRRIns.FlowID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "get flow by id failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "get flow by id failed")
+		return
+	}
+	flowFunction, ok := flowIns.FlowFunctionIDMapFlowFunction[fRRIns.FlowFunctionID]
+	if !ok || flowFunction.Approval == nil {
+		web.WriteBadRequestDataResp(&w, r, "function_run_record is not of an approval node")
+		return
+	}
+	if !flowFunction.Approval.IsApprover(reqUser.ID) {
+		scheduleLogger.Warningf(logTags, "user is not approver")
+		web.WritePermissionNotEnough(&w, r, "not approver of this node")
+		return
+	}
+	if !flowIns.UserCanExecute(reqUser) {
+		scheduleLogger.Warningf(logTags, "user lack execute permission")
+		web.WritePermissionNotEnough(&w, r, "need execute permission")
+		return
+	}
+
+	flowRunRecordIns, err := flowRunRecordService.FlowRunRecord.GetByID(fRRIns.FlowRunRecordID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "get flow_run_record by id failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "get flow_run_record by id failed")
+		return
+	}
+	if flowRunRecordIns.Finished() {
+		web.WriteBadRequestDataResp(&w, r, "flow run already finished")
+		return
+	}
+
+	// 利用条件更新的原子性保证只有一个审批（或超时）生效
+	saved, err := fRRService.FunctionRunRecords.SaveApprovalDecision(fRRIns.ID, reqUser.ID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "save approval decision failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "save approval decision failed")
+		return
+	}
+	if !saved {
+		web.WriteBadRequestDataResp(&w, r, "node is not waiting for approval")
+		return
+	}
+	err = flowRunRecordService.FlowRunRecord.ApprovalResolved(fRRIns.FlowRunRecordID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "save flow_run_record approval resolved failed: %v", err)
+	}
+
+	decision := "approved"
+	if !req.Approved {
+		decision = "rejected"
+	}
+	description := fmt.Sprintf("%s by %s", decision, reqUser.Name)
+	if req.Comment != "" {
+		description += ": " + req.Comment
+	}
+	scheduleLogger.Infof(logTags, "approval %s", decision)
+	finishedErr := functionRunFinished(
+		logTags,
+		approvalResultReq(fRRIns.ID, flowFunction.Approval, req.Approved, false, description))
+	if finishedErr != nil {
+		if finishedErr.badRequest {
+			web.WriteBadRequestDataResp(&w, r, finishedErr.msg)
+		} else {
+			web.WriteInternalServerErrorResp(&w, r, finishedErr.err, finishedErr.msg)
+		}
+		return
+	}
+
+	scheduleLogger.Infof(logTags, "finished")
+	web.WritePlainSucOkResp(&w, r)
+}
@@ -0,0 +1,263 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/pkg/builtin_function"
+	"github.com/fBloc/bloc-server/pkg/function_developer_implement"
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/pkg/opt"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// builtinFunctionIDMapImplement 内置function的id对应其实现，注册内置function后才有值
+var builtinFunctionIDMapImplement = make(
+	map[value_object.UUID]function_developer_implement.FunctionDeveloperImplementInterface)
+
+// BuiltinFunctionConsumer 注册内置function并持续汇报其存活，
+// 之后监听发布给内置function provider的运行任务，由bloc-server自身运行
+// 依赖注入的各项service，需在注入完成后运行
+func BuiltinFunctionConsumer() {
+	logTags := map[string]string{
+		string(value_object.SpanID): value_object.NewSpanID(),
+		"business":                  "builtin function consumer"}
+	err := registerBuiltinFunctions(logTags)
+	if err != nil {
+		panic(err)
+	}
+	go reportBuiltinFunctionsAlive()
+
+	clientRunFunctionEventChan := make(chan event.DomainEvent)
+	err = event.ListenEvent(
+		&event.ClientRunFunction{ClientName: builtin_function.ProviderName},
+		"builtin_function_consumer", clientRunFunctionEventChan)
+	if err != nil {
+		panic(err)
+	}
+
+	for clientRunFunctionEvent := range clientRunFunctionEventChan {
+		funcRunRecordIDStr := clientRunFunctionEvent.Identity()
+		logTags := map[string]string{
+			string(value_object.SpanID): value_object.NewSpanID(),
+			"business":                  "builtin function consumer",
+			"function_run_record_id":    funcRunRecordIDStr}
+
+		funcRunRecordUUID, err := value_object.ParseToUUID(funcRunRecordIDStr)
+		if err != nil {
+			scheduleLogger.Errorf(logTags, "parse identity to uuid failed: %v", err)
+			continue
+		}
+		go runBuiltinFunction(logTags, funcRunRecordUUID)
+	}
+}
+
+// registerBuiltinFunctions 同function provider的注册：持久化内置function并加入到本地汇报缓存
+func registerBuiltinFunctions(logTags map[string]string) error {
+	for _, builtin := range builtin_function.All() {
+		ipts := builtin.Implement.IptConfig()
+		opts := builtin.Implement.OptConfig()
+		aggFunction := aggregate.Function{
+			ID:                 value_object.NewUUID(),
+			Name:               builtin.Name,
+			GroupName:          builtin_function.GroupName,
+			ProviderName:       builtin_function.ProviderName,
+			Description:        builtin.Description,
+			Ipts:               ipts,
+			IptDigest:          ipt.GenIptDigest(ipts),
+			Opts:               opts,
+			OptDigest:          opt.GenOptDigest(opts),
+			ProgressMilestones: builtin.Implement.AllProgressMilestones()}
+		alreadyExistFunc, err := fService.Function.FindOrCreate(&aggFunction)
+		if err != nil {
+			return fmt.Errorf("create builtin function %s failed: %v", builtin.Name, err)
+		}
+		aggFunc := &aggFunction
+		if !alreadyExistFunc.IsZero() {
+			aggFunc = alreadyExistFunc
+			if aggFunc.ProviderName != builtin_function.ProviderName {
+				err = fService.Function.PatchProviderName(aggFunc.ID, builtin_function.ProviderName)
+				if err != nil {
+					return fmt.Errorf("patch builtin function %s's provider_name failed: %v", builtin.Name, err)
+				}
+				aggFunc.ProviderName = builtin_function.ProviderName
+			}
+		}
+
+		reported.Lock()
+		if _, ok := reported.groupNameMapFuncNameMapFunc[builtin_function.GroupName]; !ok {
+			reported.groupNameMapFuncNameMapFunc[builtin_function.GroupName] = make(map[string]*reportFunction)
+		}
+		reported.groupNameMapFuncNameMapFunc[builtin_function.GroupName][builtin.Name] = &reportFunction{
+			ProviderName:       builtin_function.ProviderName,
+			GroupName:          builtin_function.GroupName,
+			ProgressMilestones: aggFunc.ProgressMilestones,
+			Name:               builtin.Name,
+			ID:                 aggFunc.ID,
+			LastReportTime:     time.Now()}
+		reported.idMapFunc[aggFunc.ID] = *aggFunc
+		builtinFunctionIDMapImplement[aggFunc.ID] = builtin.Implement
+		reported.Unlock()
+
+		err = fService.Function.AliveReport(aggFunc.ID)
+		if err != nil {
+			return fmt.Errorf("builtin function %s alive report failed: %v", builtin.Name, err)
+		}
+		scheduleLogger.Infof(logTags,
+			"registered builtin func: %s - %s", builtin_function.GroupName, builtin.Name)
+	}
+	return nil
+}
+
+// reportBuiltinFunctionsAlive 内置function随bloc-server存活，按照function provider的注册间隔汇报存活
+func reportBuiltinFunctionsAlive() {
+	ticker := time.NewTicker(config.FunctionReportInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for functionID := range builtinFunctionIDMapImplement {
+			err := fService.Function.AliveReport(functionID)
+			if err != nil {
+				scheduleLogger.Errorf(
+					map[string]string{"business": "builtin function alive report"},
+					"function(id: %s) alive report failed: %v", functionID.String(), err)
+			}
+		}
+	}
+}
+
+// runBuiltinFunction 同function provider运行function：上报开始、运行、保存opt后上报运行完成
+func runBuiltinFunction(logTags map[string]string, funcRunRecordID value_object.UUID) {
+	fRRIns, err := fRRService.FunctionRunRecords.GetByID(funcRunRecordID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "get function_run_record by id failed: %v", err)
+		return
+	}
+	if fRRIns.IsZero() {
+		scheduleLogger.Warningf(logTags, "get function_run_record by id match no record")
+		return
+	}
+	logTags[string(value_object.TraceID)] = fRRIns.TraceID
+	if fRRIns.Finished() {
+		scheduleLogger.Warningf(logTags, "function_run_record already finished")
+		return
+	}
+
+	req := FuncRunFinishedHttpReq{FunctionRunRecordID: funcRunRecordID.String()}
+	implement, ok := builtinFunctionIDMapImplement[fRRIns.FunctionID]
+	if !ok {
+		scheduleLogger.Errorf(logTags, "function(id: %s) is not builtin function", fRRIns.FunctionID.String())
+		req.ErrorMsg = "builtin function not exist"
+		req.NonRetryable = true
+		finishBuiltinFunctionRun(logTags, req)
+		return
+	}
+
+	err = fRRService.FunctionRunRecords.SaveStart(funcRunRecordID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "save function_run_record start failed: %v", err)
+	}
+
+	ipts, err := builtinFunctionIpts(implement.IptConfig(), fRRIns)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "assemble ipt failed: %v", err)
+		req.ErrorMsg = "assemble ipt failed: " + err.Error()
+		finishBuiltinFunctionRun(logTags, req)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if !fRRIns.ShouldBeCanceledAt.IsZero() {
+		var cancelByDeadline context.CancelFunc
+		ctx, cancelByDeadline = context.WithDeadline(ctx, fRRIns.ShouldBeCanceledAt)
+		defer cancelByDeadline()
+	}
+	progressReportChan := make(chan value_object.FunctionRunStatus)
+	go func() {
+		for status := range progressReportChan {
+			if status.Progress > 0 {
+				fRRService.FunctionRunRecords.PatchProgress(funcRunRecordID, status.Progress)
+			}
+			if status.Msg != "" {
+				fRRService.FunctionRunRecords.PatchProgressMsg(funcRunRecordID, status.Msg)
+			}
+		}
+	}()
+	blocOptChan := make(chan *value_object.FunctionRunOpt, 1)
+	go implement.Run(ctx, ipts, progressReportChan, blocOptChan, scheduleLogger)
+	runOpt := <-blocOptChan
+	close(progressReportChan)
+	if runOpt.Canceled && ctx.Err() == context.DeadlineExceeded {
+		// 运行超时由超时检测按照重试策略重试或失败
+		scheduleLogger.Warningf(logTags, "builtin function run timeout")
+		return
+	}
+
+	req.Suc = runOpt.Suc
+	req.Canceled = runOpt.Canceled
+	req.InterceptBelowFunctionRun = runOpt.InterceptBelowFunctionRun
+	req.ErrorMsg = runOpt.ErrorMsg
+	req.Description = runOpt.Description
+	if runOpt.Suc {
+		req.OptKeyMapObjectStorageKey = make(map[string]string, len(runOpt.Detail))
+		req.OptKeyMapBriefData = make(map[string]string, len(runOpt.Detail))
+		for optKey, data := range runOpt.Detail {
+			uploadByte, _ := json.Marshal(data)
+			ossKey := funcRunRecordID.String() + "_" + optKey
+			err = objectStorage.Set(ossKey, uploadByte)
+			if err != nil {
+				scheduleLogger.Errorf(logTags, "save opt %s to object storage failed: %v", optKey, err)
+				req.Suc = false
+				req.ErrorMsg = "save opt to object storage failed"
+				break
+			}
+			req.OptKeyMapObjectStorageKey[optKey] = ossKey
+			req.OptKeyMapBriefData[optKey] = optBrief(uploadByte, 0)
+		}
+	}
+	finishBuiltinFunctionRun(logTags, req)
+}
+
+func finishBuiltinFunctionRun(logTags map[string]string, req FuncRunFinishedHttpReq) {
+	scheduleLogger.Infof(logTags, "builtin function run finished. suc: %t", req.Suc)
+	finishedErr := functionRunFinished(logTags, req)
+	if finishedErr != nil {
+		scheduleLogger.Errorf(logTags,
+			"handle builtin function run finished failed: %s. %v", finishedErr.msg, finishedErr.err)
+	}
+}
+
+// builtinFunctionIpts 从对象存储中取出运行记录的输入参数值，装配到内置function的ipt定义中
+func builtinFunctionIpts(
+	iptConfig ipt.IptSlice, fRRIns *aggregate.FunctionRunRecord,
+) (ipt.IptSlice, error) {
+	for paramIndex, param := range fRRIns.IptBriefAndObskey {
+		if paramIndex >= len(iptConfig) {
+			break
+		}
+		for componentIndex, component := range param {
+			if componentIndex >= len(iptConfig[paramIndex].Components) || component.FullKey == "" {
+				continue
+			}
+			isKeyExist, raw, err := objectStorage.Get(component.FullKey)
+			if err != nil {
+				return nil, err
+			}
+			if !isKeyExist {
+				return nil, fmt.Errorf("ipt value of key %s not exist", component.FullKey)
+			}
+			var value interface{}
+			err = json.Unmarshal(raw, &value)
+			if err != nil {
+				return nil, err
+			}
+			iptConfig[paramIndex].Components[componentIndex].Value = value
+		}
+	}
+	return iptConfig, nil
+}
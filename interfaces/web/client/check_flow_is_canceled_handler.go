@@ -38,7 +38,33 @@ func FlowRunRecordIsCanceled(w http.ResponseWriter, r *http.Request, ps httprout
 		return
 	}
 
-	fRRService.Logger.Errorf(logTags,
-		"finished with whether canceld: %t", flowRunRecordIns.Canceled)
-	web.WriteSucResp(&w, r, map[string]bool{"canceled": flowRunRecordIns.Canceled})
+	// 可选的function_run_record_id，用于得知此节点是否已运行超时
+	canceled, timeoutCanceled := flowRunRecordIns.Canceled, false
+	if funcRunRecordIDStr := r.URL.Query().Get("function_run_record_id"); funcRunRecordIDStr != "" {
+		logTags["function_run_record_id"] = funcRunRecordIDStr
+		funcRunRecordUUID, err := value_object.ParseToUUID(funcRunRecordIDStr)
+		if err != nil {
+			fRRService.Logger.Warningf(
+				logTags, "parse function_run_record_id to uuid failed: %v", err)
+			web.WriteBadRequestDataResp(
+				&w, r, "function_run_record_id parse to uuid failed: %s",
+				err.Error())
+			return
+		}
+		fRRIns, err := fRRService.FunctionRunRecords.GetByID(funcRunRecordUUID)
+		if err != nil {
+			fRRService.Logger.Errorf(
+				logTags, "get function_run_record by id failed: %v", err)
+			web.WriteInternalServerErrorResp(&w, r, err, "visit function_run_record_ins by id failed")
+			return
+		}
+		timeoutCanceled = fRRIns.TimeoutCanceled
+		canceled = canceled || timeoutCanceled
+	}
+
+	fRRService.Logger.Infof(logTags,
+		"finished with whether canceld: %t, timeout canceled: %t", canceled, timeoutCanceled)
+	web.WriteSucResp(&w, r, map[string]bool{
+		"canceled":         canceled,
+		"timeout_canceled": timeoutCanceled})
 }
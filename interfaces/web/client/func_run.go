@@ -2,6 +2,7 @@ package client
 
 import (
 	"github.com/fBloc/bloc-server/infrastructure/log"
+	"github.com/fBloc/bloc-server/pkg/value_type"
 
 	"github.com/fBloc/bloc-server/services/flow"
 	"github.com/fBloc/bloc-server/services/flow_run_record"
@@ -47,9 +48,16 @@ type FuncRunFinishedHttpReq struct {
 	TimeoutCanceled           bool              `json:"timeout_canceled"`
 	InterceptBelowFunctionRun bool              `json:"intercept_below_function_run"`
 	ErrorMsg                  string            `json:"error_msg"`
+	NonRetryable              bool              `json:"non_retryable"` // 失败且不需要重试（如参数错误）
 	Description               string            `json:"description"`
 	OptKeyMapBriefData        map[string]string `json:"optKey_map_briefData"`
 	OptKeyMapObjectStorageKey map[string]string `json:"optKey_map_objectStorageKey"`
+
+	// 不为nil时替代function中opt的定义（子flow节点没有对应的function）
+	optKeyMapValueType map[string]value_type.ValueType
+	optKeyMapIsArray   map[string]bool
+	// 由超时检测发起而非客户端上报，超时取消后只接受此来源的结果
+	byTimeoutWatcher bool
 }
 
 type FuncRunStartHttpReq struct {
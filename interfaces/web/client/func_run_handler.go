@@ -62,11 +62,37 @@ func FunctionRunFinished(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 	logTags["function_run_record_id"] = req.FunctionRunRecordID
 	scheduleLogger.Infof(logTags, `status of whether suc: %t`, req.Suc)
 
+	finishedErr := functionRunFinished(logTags, req)
+	if finishedErr != nil {
+		if finishedErr.badRequest {
+			web.WriteBadRequestDataResp(&w, r, finishedErr.msg)
+		} else {
+			web.WriteInternalServerErrorResp(&w, r, finishedErr.err, finishedErr.msg)
+		}
+		return
+	}
+
+	scheduleLogger.Infof(logTags, "finished")
+	web.WritePlainSucOkResp(&w, r)
+}
+
+// funcRunFinishedError 处理function运行完成上报时的错误，badRequest表示上报的数据有误
+type funcRunFinishedError struct {
+	badRequest bool
+	msg        string
+	err        error
+}
+
+// functionRunFinished 保存function的运行结果并驱动flow继续运行（发布下游/重试/完成）
+func functionRunFinished(
+	logTags map[string]string, req FuncRunFinishedHttpReq,
+) *funcRunFinishedError {
 	funcRunRecordUUID, err := value_object.ParseToUUID(req.FunctionRunRecordID)
 	if err != nil {
 		scheduleLogger.Warningf(logTags, "parse to uuid failed: %v", err)
-		web.WriteBadRequestDataResp(&w, r, "parse function_id to uuid failed: %v", err)
-		return
+		return &funcRunFinishedError{
+			badRequest: true,
+			msg:        fmt.Sprintf("parse function_id to uuid failed: %v", err)}
 	}
 
 	// 兜底逻辑、删除此function_run_record_id对应的heartbeat。理论上应该通过明确的删除接口来完成
@@ -81,48 +107,129 @@ func FunctionRunFinished(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 	fRRIns, err := fRRService.FunctionRunRecords.GetByID(funcRunRecordUUID)
 	if err != nil {
 		scheduleLogger.Errorf(logTags, "get functionRunRecord by id failed: %v", err)
-		web.WriteInternalServerErrorResp(&w, r, err, "find function_run_record_ins by it's id failed")
-		return
+		return &funcRunFinishedError{err: err, msg: "find function_run_record_ins by it's id failed"}
 	}
 	if fRRIns.IsZero() {
 		scheduleLogger.Warningf(logTags, "get functionRunRecord by id match no record")
-		web.WriteBadRequestDataResp(&w, r, "find no function_run_record_ins by this function_id")
-		return
+		return &funcRunFinishedError{badRequest: true, msg: "find no function_run_record_ins by this function_id"}
+	}
+	if fRRIns.TimeoutCanceled && !req.byTimeoutWatcher {
+		// 已被标记为超时取消，由超时处理按照重试策略重试或失败，不再接受此次运行的上报
+		scheduleLogger.Warningf(logTags, "function_run_record already timeout canceled. ignore report")
+		return nil
 	}
 
 	flowIns, err := flowService.Flow.GetByID(fRRIns.FlowID)
 	if err != nil {
 		scheduleLogger.Errorf(logTags, "get flowIns by id failed: %v", err)
-		web.WriteInternalServerErrorResp(&w, r, err, "find flow_ins failed")
-		return
+		return &funcRunFinishedError{err: err, msg: "find flow_ins failed"}
 	}
 	if flowIns.IsZero() {
 		scheduleLogger.Warningf(logTags, "get flowIns by id match no record")
-		web.WriteBadRequestDataResp(&w, r, "find no flow_ins")
-		return
+		return &funcRunFinishedError{badRequest: true, msg: "find no flow_ins"}
 	}
 	logTags["flow_id"] = fRRIns.FlowID.String()
 
 	flowRunRecordIns, err := flowRunRecordService.FlowRunRecord.GetByID(fRRIns.FlowRunRecordID)
 	if err != nil {
 		scheduleLogger.Errorf(logTags, "get flowRunRecordIns by id failed: %v", err)
-		web.WriteInternalServerErrorResp(&w, r, err, "find flow_run_record_ins failed")
-		return
+		return &funcRunFinishedError{err: err, msg: "find flow_run_record_ins failed"}
 	}
 	if flowRunRecordIns.IsZero() {
 		scheduleLogger.Warningf(logTags, "get flowRunRecordIns by id match no record")
-		web.WriteBadRequestDataResp(&w, r, "find no flow_run_record_ins")
-		return
+		return &funcRunFinishedError{badRequest: true, msg: "find no flow_run_record_ins"}
 	}
 	traceCtx := value_object.SetTraceIDToContext(flowRunRecordIns.TraceID)
 	logTags["flow_run_record_id"] = fRRIns.FlowRunRecordID.String()
 
+	// 已失去flow槽位锁(被取代或锁已过期)的运行不再推进，此次上报只结束此function运行
+	holdsFlowLock, err := flowRunRecordService.HoldsFlowLock(flowRunRecordIns)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "check flow lock failed: %v", err)
+		return &funcRunFinishedError{err: err, msg: "check flow lock failed"}
+	}
+	if !holdsFlowLock {
+		scheduleLogger.Warningf(logTags, "flow_run_record lost flow lock. ignore report")
+		err = fRRService.FunctionRunRecords.SaveCancel(funcRunRecordUUID)
+		if err != nil {
+			scheduleLogger.Errorf(logTags, "save function_run_record cancel failed: %v", err)
+		}
+		if !flowRunRecordIns.Finished() {
+			err = flowRunRecordService.FlowRunRecord.Fail(flowRunRecordIns.ID, "lost flow lock")
+			if err != nil {
+				scheduleLogger.Errorf(logTags, "save flow_run_record fail failed: %v", err)
+			} else {
+				event.PubFlowRunFinished(scheduleLogger, logTags, flowRunRecordIns.ID)
+			}
+		}
+		return nil
+	}
+
+	// 运行失败时按照重试策略判断是否需要重试，需要的重置后稍后重新运行
+	if !req.Suc && !req.Canceled && !req.NonRetryable && !flowRunRecordIns.Finished() {
+		retry, delay := flowIns.RetryDelay(fRRIns.FlowFunctionID, fRRIns, flowRunRecordIns)
+		if retry {
+			err = retryFunctionRun(logTags, flowIns, flowRunRecordIns, fRRIns, req.ErrorMsg, delay)
+			if err != nil {
+				scheduleLogger.Errorf(logTags, "retry function run failed: %v", err)
+				return &funcRunFinishedError{err: err, msg: "retry function run failed"}
+			}
+			return nil
+		}
+	}
+	// 每次运行的结果单独记录，不会被后续的运行覆盖
+	err = fRRService.FunctionRunRecords.AddAttempt(
+		funcRunRecordUUID, fRRIns.FinishAttempt(req.Suc, req.ErrorMsg, !req.NonRetryable))
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "save function_run_record attempt failed: %v", err)
+	}
+
 	functionIns := reported.idMapFunc[fRRIns.FunctionID]
+	optKeyMapValueType := functionIns.OptKeyMapValueType()
+	optKeyMapIsArray := functionIns.OptKeyMapIsArray()
+	if req.optKeyMapValueType != nil { // 子flow节点没有对应的function，由上报方给出opt的定义
+		optKeyMapValueType = req.optKeyMapValueType
+		optKeyMapIsArray = req.optKeyMapIsArray
+	}
+	if fRRIns.IsMapChild() {
+		logTags["map_parent_id"] = fRRIns.MapParentID.String()
+		parent, parentReq, err := mapChildRunFinished(
+			fRRIns, &req,
+			flowIns.FlowFunctionIDMapFlowFunction[fRRIns.FlowFunctionID], &functionIns)
+		if err != nil {
+			scheduleLogger.Errorf(logTags, "handle map child run finished failed: %v", err)
+			err = flowRunRecordService.FlowRunRecord.Fail(
+				flowRunRecordIns.ID, "handle map child run finished failed")
+			if err != nil {
+				scheduleLogger.Errorf(logTags, "save flow_run_record run fail failed: %v", err)
+			} else {
+				event.PubFlowRunFinished(scheduleLogger, logTags, flowRunRecordIns.ID)
+			}
+			return &funcRunFinishedError{err: err, msg: "handle map child run finished failed"}
+		}
+		if parentReq == nil { // 还有子记录未完成
+			scheduleLogger.Infof(logTags, "map child finished")
+			return nil
+		}
+
+		// 父记录的结果已确定，以父记录继续后续的流程
+		scheduleLogger.Infof(logTags, "all map child finished, continue with parent. suc: %t", parentReq.Suc)
+		fRRIns = parent
+		funcRunRecordUUID = parent.ID
+		req = *parentReq
+		logTags["function_run_record_id"] = parent.ID.String()
+	}
+	if flowFunction, ok := flowIns.FlowFunctionIDMapFlowFunction[fRRIns.FlowFunctionID]; ok &&
+		flowFunction.Map != nil {
+		for optKey := range optKeyMapIsArray { // map模式父记录汇总后的opt都是数组
+			optKeyMapIsArray[optKey] = true
+		}
+	}
 	if req.Suc {
 		err := fRRService.FunctionRunRecords.SaveSuc(
 			funcRunRecordUUID, req.Description,
-			functionIns.OptKeyMapValueType(),
-			functionIns.OptKeyMapIsArray(),
+			optKeyMapValueType,
+			optKeyMapIsArray,
 			req.OptKeyMapObjectStorageKey,
 			req.OptKeyMapBriefData,
 			req.InterceptBelowFunctionRun,
@@ -138,11 +245,12 @@ func FunctionRunFinished(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 			if err != nil {
 				scheduleLogger.Errorf(logTags,
 					"save flow_run_record run fail failed: %v", err)
+			} else {
+				event.PubFlowRunFinished(scheduleLogger, logTags, flowRunRecordIns.ID)
 			}
 
 			// 直接返回
-			web.WriteInternalServerErrorResp(&w, r, err, "function_run_record save suc failed")
-			return
+			return &funcRunFinishedError{err: err, msg: "function_run_record save suc failed"}
 		}
 
 		// 检测其下的所有下游function是否活跃、如果有不活跃的直接停止flow继续运行
@@ -187,6 +295,8 @@ func FunctionRunFinished(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 			err = flowService.FlowRunRecord.FunctionDead(fRRIns.FlowRunRecordID, errorMsg)
 			if err != nil {
 				scheduleLogger.Errorf(logTags, "save flowRunRepo.FunctionDead failed: %v", err)
+			} else {
+				event.PubFlowRunFinished(scheduleLogger, logTags, fRRIns.FlowRunRecordID)
 			}
 			goto Final
 		}
@@ -195,8 +305,35 @@ func FunctionRunFinished(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 		flowFunction := flowIns.FlowFunctionIDMapFlowFunction[fRRIns.FlowFunctionID]
 		if !req.InterceptBelowFunctionRun { // 成功运行完成且不拦截
 			if len(flowFunction.DownstreamFlowFunctionIDs) > 0 { // 若有下游待运行的function节点
+				// 根据分支条件筛选出需要运行的下游节点
+				toRunDownstreamIDs, skippedDownstreamIDs, err := splitDownstreamsByCondition(
+					flowFunction, &functionIns, req.OptKeyMapObjectStorageKey)
+				if err != nil {
+					scheduleLogger.Errorf(logTags, "evaluate branch condition failed: %v", err)
+					err = flowRunRecordService.FlowRunRecord.Fail(
+						flowRunRecordIns.ID, "evaluate branch condition failed: "+err.Error())
+					if err != nil {
+						scheduleLogger.Errorf(logTags, "save flow_run_record run fail failed: %v", err)
+					} else {
+						event.PubFlowRunFinished(scheduleLogger, logTags, flowRunRecordIns.ID)
+					}
+					goto Final
+				}
+				if len(skippedDownstreamIDs) > 0 {
+					scheduleLogger.Infof(logTags,
+						"branch condition not matched, skipped downstreams: %v", skippedDownstreamIDs)
+					err = fRRService.FunctionRunRecords.SaveSkippedDownstreams(
+						funcRunRecordUUID, skippedDownstreamIDs)
+					if err != nil {
+						scheduleLogger.Errorf(logTags, "save skipped downstreams failed: %v", err)
+					}
+				}
+				if len(toRunDownstreamIDs) == 0 {
+					goto CheckWhetherFlowRunFinished
+				}
+
 				// 创建并发布下游function节点
-				for _, downStreamFlowFunctionID := range flowFunction.DownstreamFlowFunctionIDs {
+				for _, downStreamFlowFunctionID := range toRunDownstreamIDs {
 					downStreamFlowFunction := flowIns.FlowFunctionIDMapFlowFunction[downStreamFlowFunctionID]
 					downStreamFunctionIns := reported.idMapFunc[downStreamFlowFunction.FunctionID]
 
@@ -234,6 +371,8 @@ func FunctionRunFinished(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 							flowRunRecordIns.ID, "pub downstream run event failed")
 						if err != nil {
 							scheduleLogger.Errorf(logTags, "save flow_run_record run fail failed: %v", err)
+						} else {
+							event.PubFlowRunFinished(scheduleLogger, logTags, flowRunRecordIns.ID)
 						}
 						goto Final
 					}
@@ -251,6 +390,23 @@ func FunctionRunFinished(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 				从而检查是不是都有效完成了
 		*/
 
+		flowFuncIDMapRunRecord := make(map[string]*aggregate.FunctionRunRecord)
+		getRunRecord := func(flowFunctionID string) (*aggregate.FunctionRunRecord, error) {
+			if record, ok := flowFuncIDMapRunRecord[flowFunctionID]; ok {
+				return record, nil
+			}
+			funcRunRecordID, ok := flowRunRecordIns.FlowFuncIDMapFuncRunRecordID[flowFunctionID]
+			if !ok { // 表示此flow_function还没有运行记录
+				return nil, nil
+			}
+			record, err := fRRService.FunctionRunRecords.GetByID(funcRunRecordID)
+			if err != nil {
+				return nil, err
+			}
+			flowFuncIDMapRunRecord[flowFunctionID] = record
+			return record, nil
+		}
+
 		var checkFlowRunWhetherFinished func(flowRunRecordID string, finished *bool, flag string)
 		checkFlowRunWhetherFinished = func(flowFunctionID string, finished *bool, flag string) {
 			if !*finished {
@@ -258,26 +414,35 @@ func FunctionRunFinished(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 			}
 			interceptBelow := false
 			if flowFunctionID != config.FlowFunctionStartID {
-				funcRunRecordID, ok := flowRunRecordIns.FlowFuncIDMapFuncRunRecordID[flowFunctionID]
-				if !ok { // 表示此flow_function还没有运行记录
-					*finished = false
-					return
-				}
-				functionRunRecordIns, err := fRRService.FunctionRunRecords.GetByID(funcRunRecordID)
+				functionRunRecordIns, err := getRunRecord(flowFunctionID)
 				if err != nil {
 					scheduleLogger.Errorf(logTags,
-						"get function_run_record by function_run_record_id(%s) failed: %s",
-						funcRunRecordID.String(), err.Error())
+						"get function_run_record of flow_function(%s) failed: %s",
+						flowFunctionID, err.Error())
 					// 先保守处理为未完成运行
 					*finished = false
 					return
 				}
-				if functionRunRecordIns.InterceptBelowFunctionRun {
-					interceptBelow = true
-				}
-				if !functionRunRecordIns.Finished() {
-					*finished = false
-					return
+				if functionRunRecordIns.IsZero() {
+					// 没有运行记录的节点，若是因为分支条件被跳过的，视为已完成，继续检查其下游
+					skipped := flowIns.FlowFunctionSkipped(
+						flowFunctionID,
+						func(flowFunctionID string) *aggregate.FunctionRunRecord {
+							record, _ := getRunRecord(flowFunctionID)
+							return record
+						})
+					if !skipped {
+						*finished = false
+						return
+					}
+				} else {
+					if !functionRunRecordIns.Finished() {
+						*finished = false
+						return
+					}
+					if functionRunRecordIns.InterceptBelowFunctionRun {
+						interceptBelow = true
+					}
 				}
 			}
 			if !interceptBelow {
@@ -293,50 +458,285 @@ func FunctionRunFinished(w http.ResponseWriter, r *http.Request, _ httprouter.Pa
 			err = flowRunRecordService.FlowRunRecord.Suc(flowRunRecordIns.ID)
 			if err != nil {
 				scheduleLogger.Errorf(logTags, "save flow_run_record suc failed: %v", err)
+			} else {
+				event.PubFlowRunFinished(scheduleLogger, logTags, flowRunRecordIns.ID)
 			}
 		}
 		goto Final
-	} else { // function节点运行失败, 处理有重试的情况
-		// 无重试策略
-		if !flowIns.HaveRetryStrategy() || flowRunRecordIns.RetriedAmount >= flowIns.RetryAmount {
-			scheduleLogger.Infof(logTags,
-				"no retry set in flow. just save flow_run_record as failed")
+	} else { // function节点运行失败，能重试的在前面已经处理了，到这里的都是不再重试的
+		scheduleLogger.Infof(logTags,
+			"no retry left. just save flow_run_record as failed")
 
-			err = fRRService.FunctionRunRecords.SaveFail(funcRunRecordUUID, req.ErrorMsg)
-			if err != nil {
-				scheduleLogger.Errorf(logTags,
-					"save function_run_record run fail failed: %v", err)
-			}
+		err = fRRService.FunctionRunRecords.SaveFail(funcRunRecordUUID, req.ErrorMsg)
+		if err != nil {
+			scheduleLogger.Errorf(logTags,
+				"save function_run_record run fail failed: %v", err)
+		}
 
+		if req.TimeoutCanceled {
+			err = flowRunRecordService.FlowRunRecord.TimeoutCancel(flowRunRecordIns.ID)
+		} else {
 			err = flowRunRecordService.FlowRunRecord.Fail(flowRunRecordIns.ID, "have function failed")
+		}
+		if err != nil {
+			scheduleLogger.Errorf(logTags,
+				"save flow_run_record run fail failed: %v", err)
+		} else {
+			event.PubFlowRunFinished(scheduleLogger, logTags, flowRunRecordIns.ID)
+		}
+	}
+
+Final:
+	return nil
+}
+
+// retryFunctionRun 记录失败的此次运行并重置function_run_record，在delay之后重新发布运行
+func retryFunctionRun(
+	logTags map[string]string,
+	flowIns *aggregate.Flow,
+	flowRunRecordIns *aggregate.FlowRunRecord,
+	fRRIns *aggregate.FunctionRunRecord,
+	errorMsg string,
+	delay time.Duration,
+) error {
+	flowFunction := flowIns.FlowFunctionIDMapFlowFunction[fRRIns.FlowFunctionID]
+	if flowFunction == nil || flowFunction.RetryPolicy == nil {
+		// 使用的是flow整体的重试配置，重试次数记录在flow_run_record上
+		err := flowRunRecordService.FlowRunRecord.PatchDataForRetry(
+			flowRunRecordIns.ID, flowRunRecordIns.RetriedAmount)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := fRRService.FunctionRunRecords.SaveRetry(
+		fRRIns.ID, fRRIns.FinishAttempt(false, errorMsg, true))
+	if err != nil {
+		return err
+	}
+
+	futureTime := time.Now().Add(delay)
+	scheduleLogger.Infof(logTags,
+		"attempt %d failed. the retry event will be executed after: %s",
+		fRRIns.AttemptedAmount()+1, futureTime.Format(time.RFC3339))
+	return event.PubEventAtCertainTime(
+		&event.FunctionToRun{FunctionRunRecordID: fRRIns.ID},
+		futureTime)
+}
+
+// splitDownstreamsByCondition 根据边上的分支条件将下游节点划分为需要运行的和被跳过的
+// 条件的比较值为上游function此次运行的opt值，从对象存储中读取
+func splitDownstreamsByCondition(
+	flowFunction *aggregate.FlowFunction,
+	functionIns *aggregate.Function,
+	optKeyMapObjectStorageKey map[string]string,
+) (toRun, skipped []string, err error) {
+	optKeyMapValueType := functionIns.OptKeyMapValueType()
+	optKeyMapValue := make(map[string]interface{})
+	for _, downstreamID := range flowFunction.DownstreamFlowFunctionIDs {
+		condition, ok := flowFunction.DownstreamConditions[downstreamID]
+		if !ok || condition == nil {
+			toRun = append(toRun, downstreamID)
+			continue
+		}
+
+		optValue, loaded := optKeyMapValue[condition.OptKey]
+		if !loaded {
+			ossKey, ok := optKeyMapObjectStorageKey[condition.OptKey]
+			if !ok {
+				return nil, nil, fmt.Errorf(
+					"opt「%s」required by condition of downstream %s not reported",
+					condition.OptKey, downstreamID)
+			}
+			exist, optByte, err := objectStorage.Get(ossKey)
 			if err != nil {
-				scheduleLogger.Errorf(logTags,
-					"save flow_run_record run fail failed: %v", err)
+				return nil, nil, fmt.Errorf(
+					"get opt「%s」from object storage failed: %v", condition.OptKey, err)
 			}
-		} else { // 有重试策略
-			scheduleLogger.Infof(logTags, "retry")
+			if !exist {
+				return nil, nil, fmt.Errorf(
+					"opt「%s」not exist in object storage", condition.OptKey)
+			}
+			err = json.Unmarshal(optByte, &optValue)
+			if err != nil {
+				return nil, nil, fmt.Errorf(
+					"unmarshal opt「%s」failed: %v", condition.OptKey, err)
+			}
+			optKeyMapValue[condition.OptKey] = optValue
+		}
 
-			flowRunRecordService.FlowRunRecord.PatchDataForRetry(
-				flowRunRecordIns.ID, flowRunRecordIns.RetriedAmount)
+		matched, err := condition.Match(optKeyMapValueType[condition.OptKey], optValue)
+		if err != nil {
+			return nil, nil, fmt.Errorf(
+				"match condition of downstream %s failed: %v", downstreamID, err)
+		}
+		if matched {
+			toRun = append(toRun, downstreamID)
+		} else {
+			skipped = append(skipped, downstreamID)
+		}
+	}
+	return toRun, skipped, nil
+}
 
-			retryGapSeconds := 3 // default set as 3 second
-			if flowIns.RetryIntervalInSecond > 0 {
-				retryGapSeconds = int(flowIns.RetryIntervalInSecond)
-			}
-			futureTime := time.Now().Add(time.Duration(retryGapSeconds) * time.Second)
-			scheduleLogger.Infof(logTags,
-				"the retry event will be executed after: %s", futureTime.Format(time.RFC3339))
+// mapChildRunFinished 处理map模式下子记录的运行完成上报：
+// 保存子记录的结果并发布下一个等待运行的子记录；有子记录失败时父记录失败，全部成功时按元素顺序汇总opt为数组
+// 返回的parentReq不为nil时表示父记录的结果已确定，需以父记录继续后续的流程
+// 子记录可能在不同的副本上同时完成，父记录的完成由仓库的条件更新保证只有一个调用方能处理
+func mapChildRunFinished(
+	child *aggregate.FunctionRunRecord,
+	req *FuncRunFinishedHttpReq,
+	flowFunction *aggregate.FlowFunction,
+	functionIns *aggregate.Function,
+) (parent *aggregate.FunctionRunRecord, parentReq *FuncRunFinishedHttpReq, err error) {
+	if req.Suc {
+		err = fRRService.FunctionRunRecords.SaveSuc(
+			child.ID, req.Description,
+			functionIns.OptKeyMapValueType(),
+			functionIns.OptKeyMapIsArray(),
+			req.OptKeyMapObjectStorageKey,
+			req.OptKeyMapBriefData,
+			false)
+	} else {
+		err = fRRService.FunctionRunRecords.SaveFail(child.ID, req.ErrorMsg)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
 
-			err = event.PubEventAtCertainTime(
-				&event.FunctionToRun{FunctionRunRecordID: funcRunRecordUUID},
-				futureTime)
+	if !req.Suc {
+		// 只有第一个失败的子记录能使父记录失败
+		errorMsg := fmt.Sprintf("map item %d run failed: %s", child.MapIndex, req.ErrorMsg)
+		failed, err := fRRService.FunctionRunRecords.SaveFailIfNotFinished(child.MapParentID, errorMsg)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !failed { // 父记录已经结束了
+			return nil, nil, nil
+		}
+		parent, err = getMapParent(child)
+		if err != nil {
+			return nil, nil, err
+		}
+		return parent, &FuncRunFinishedHttpReq{
+			FunctionRunRecordID: parent.ID.String(),
+			Suc:                 false,
+			ErrorMsg:            errorMsg,
+		}, nil
+	}
+
+	finishedAmount, added, err := fRRService.FunctionRunRecords.AddMapFinishedIndex(
+		child.MapParentID, child.MapIndex)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !added { // 父记录已经结束了（有其他子记录失败）或此子记录重复上报
+		return nil, nil, nil
+	}
+	parent, err = getMapParent(child)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	children, err := fRRService.FunctionRunRecords.FilterByMapParentID(parent.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if flowFunction != nil && flowFunction.Map != nil {
+		next := child.MapIndex + flowFunction.Map.Concurrency(len(children))
+		if next < len(children) {
+			err = event.PubEvent(&event.FunctionToRun{FunctionRunRecordID: children[next].ID})
 			if err != nil {
-				scheduleLogger.Errorf(logTags, "pub event at certain time failed: %v", err)
+				return nil, nil, err
 			}
 		}
 	}
+	// 只有使完成数达到子记录总数的调用方汇总父记录
+	if finishedAmount < len(children) {
+		return nil, nil, nil
+	}
 
-Final:
-	scheduleLogger.Infof(logTags, "finished")
-	web.WritePlainSucOkResp(&w, r)
+	parentReq, err = mapParentSucReq(parent, children, functionIns)
+	if err != nil {
+		return nil, nil, err
+	}
+	optKeyMapIsArray := functionIns.OptKeyMapIsArray()
+	for optKey := range optKeyMapIsArray {
+		optKeyMapIsArray[optKey] = true
+	}
+	err = fRRService.FunctionRunRecords.SaveSuc(
+		parent.ID, parentReq.Description,
+		functionIns.OptKeyMapValueType(),
+		optKeyMapIsArray,
+		parentReq.OptKeyMapObjectStorageKey,
+		parentReq.OptKeyMapBriefData,
+		false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parent, parentReq, nil
+}
+
+func getMapParent(child *aggregate.FunctionRunRecord) (*aggregate.FunctionRunRecord, error) {
+	parent, err := fRRService.FunctionRunRecords.GetByID(child.MapParentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent.IsZero() {
+		return nil, fmt.Errorf("map parent %s not found", child.MapParentID)
+	}
+	return parent, nil
+}
+
+// mapParentSucReq 按元素顺序汇总全部子记录的各opt为数组，作为map模式父记录的运行成功结果
+// 没有子记录（被展开的数组为空）时各opt为空数组
+func mapParentSucReq(
+	parent *aggregate.FunctionRunRecord,
+	children []*aggregate.FunctionRunRecord,
+	functionIns *aggregate.Function,
+) (*FuncRunFinishedHttpReq, error) {
+	optKeyMapObjectStorageKey := make(map[string]string, len(functionIns.Opts))
+	optKeyMapBriefData := make(map[string]string, len(functionIns.Opts))
+	for _, optItem := range functionIns.Opts {
+		values := make([]interface{}, len(children))
+		for index, i := range children {
+			ossKey, ok := i.Opt[optItem.Key].(string)
+			if !ok {
+				continue
+			}
+			exist, optByte, err := objectStorage.Get(ossKey)
+			if err != nil {
+				return nil, err
+			}
+			if !exist {
+				continue
+			}
+			err = json.Unmarshal(optByte, &values[index])
+			if err != nil {
+				return nil, err
+			}
+		}
+		uploadByte, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		ossKey := parent.ID.String() + "_" + optItem.Key
+		err = objectStorage.Set(ossKey, uploadByte)
+		if err != nil {
+			return nil, err
+		}
+		brief := []rune(string(uploadByte))
+		if len(brief) > 51 {
+			brief = brief[:51]
+		}
+		optKeyMapObjectStorageKey[optItem.Key] = ossKey
+		optKeyMapBriefData[optItem.Key] = string(brief)
+	}
+	return &FuncRunFinishedHttpReq{
+		FunctionRunRecordID:       parent.ID.String(),
+		Suc:                       true,
+		Description:               fmt.Sprintf("map run %d items", len(children)),
+		OptKeyMapBriefData:        optKeyMapBriefData,
+		OptKeyMapObjectStorageKey: optKeyMapObjectStorageKey,
+	}, nil
 }
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/event"
+	mq_memory "github.com/fBloc/bloc-server/infrastructure/mq/memory"
+	object_storage_memory "github.com/fBloc/bloc-server/infrastructure/object_storage/memory"
+	"github.com/fBloc/bloc-server/pkg/opt"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+	memory_funcRunRecord "github.com/fBloc/bloc-server/repository/function_run_record/memory"
+	"github.com/fBloc/bloc-server/services/function_run_record"
+	"github.com/fBloc/bloc-server/value_object"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var mapFunction = aggregate.Function{
+	ID:   value_object.NewUUID(),
+	Name: "double",
+	Opts: []*opt.Opt{{Key: "result", ValueType: value_type.IntValueType}},
+}
+
+// createMapRun 创建map模式的父记录及其amount个子记录
+func createMapRun(amount int) (*aggregate.FunctionRunRecord, []*aggregate.FunctionRunRecord) {
+	parent := &aggregate.FunctionRunRecord{ID: value_object.NewUUID(), FunctionID: mapFunction.ID}
+	fRRService.FunctionRunRecords.Create(parent)
+	children := make([]*aggregate.FunctionRunRecord, amount)
+	for index := range children {
+		children[index] = aggregate.NewMapChildFunctionRunRecord(parent, index, nil)
+		fRRService.FunctionRunRecords.Create(children[index])
+	}
+	return parent, children
+}
+
+func childSucReq(child *aggregate.FunctionRunRecord) *FuncRunFinishedHttpReq {
+	ossKey := child.ID.String() + "_result"
+	objectStorage.Set(ossKey, []byte(`2`))
+	return &FuncRunFinishedHttpReq{
+		FunctionRunRecordID:       child.ID.String(),
+		Suc:                       true,
+		OptKeyMapObjectStorageKey: map[string]string{"result": ossKey},
+		OptKeyMapBriefData:        map[string]string{"result": "2"},
+	}
+}
+
+// finishConcurrently 并发上报各子记录的运行结果，返回确定了父记录结果的上报及出现的错误
+func finishConcurrently(
+	children []*aggregate.FunctionRunRecord,
+	flowFunction *aggregate.FlowFunction,
+	childReq func(child *aggregate.FunctionRunRecord) *FuncRunFinishedHttpReq,
+) ([]*FuncRunFinishedHttpReq, []error) {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	parentReqs := make([]*FuncRunFinishedHttpReq, 0, 1)
+	errs := make([]error, 0)
+	for _, child := range children {
+		wg.Add(1)
+		go func(child *aggregate.FunctionRunRecord) {
+			defer wg.Done()
+			_, parentReq, err := mapChildRunFinished(
+				child, childReq(child), flowFunction, &mapFunction)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if parentReq != nil {
+				parentReqs = append(parentReqs, parentReq)
+			}
+		}(child)
+	}
+	wg.Wait()
+	return parentReqs, errs
+}
+
+func TestMapChildRunFinished(t *testing.T) {
+	event.InjectMq(mq_memory.New())
+	InjectObjectStorageImplement(object_storage_memory.New())
+	fRRS, _ := function_run_record.NewService(
+		function_run_record.WithFunctionRunRecordRepository(memory_funcRunRecord.New()))
+	InjectFunctionRunRecordService(fRRS)
+	flowFunction := &aggregate.FlowFunction{Map: &aggregate.MapSetting{}}
+
+	Convey("children finished concurrently, only one finishes the parent", t, func() {
+		parent, children := createMapRun(20)
+
+		parentReqs, errs := finishConcurrently(children, flowFunction, childSucReq)
+		So(errs, ShouldBeEmpty)
+		So(len(parentReqs), ShouldEqual, 1)
+		So(parentReqs[0].Suc, ShouldBeTrue)
+
+		savedParent, _ := fRRService.FunctionRunRecords.GetByID(parent.ID)
+		So(savedParent.Suc, ShouldBeTrue)
+		So(len(savedParent.MapFinishedIndexes), ShouldEqual, len(children))
+		_, optByte, _ := objectStorage.Get(parentReqs[0].OptKeyMapObjectStorageKey["result"])
+		So(len(string(optByte)), ShouldEqual, len(children)*2+1)
+
+		// 重复上报不会再次完成父记录
+		_, parentReq, err := mapChildRunFinished(
+			children[0], childSucReq(children[0]), flowFunction, &mapFunction)
+		So(err, ShouldBeNil)
+		So(parentReq, ShouldBeNil)
+	})
+
+	Convey("children failed concurrently, only one fails the parent", t, func() {
+		parent, children := createMapRun(10)
+
+		parentReqs, errs := finishConcurrently(children, flowFunction,
+			func(child *aggregate.FunctionRunRecord) *FuncRunFinishedHttpReq {
+				return &FuncRunFinishedHttpReq{FunctionRunRecordID: child.ID.String(), ErrorMsg: "failed"}
+			})
+		So(errs, ShouldBeEmpty)
+		So(len(parentReqs), ShouldEqual, 1)
+		So(parentReqs[0].Suc, ShouldBeFalse)
+
+		savedParent, _ := fRRService.FunctionRunRecords.GetByID(parent.ID)
+		So(savedParent.Failed(), ShouldBeTrue)
+	})
+
+	Convey("empty array finishes the parent with empty array opts", t, func() {
+		parent, _ := createMapRun(0)
+		req, err := mapParentSucReq(parent, nil, &mapFunction)
+		So(err, ShouldBeNil)
+		So(req.Suc, ShouldBeTrue)
+		So(req.FunctionRunRecordID, ShouldEqual, parent.ID.String())
+		So(req.OptKeyMapBriefData["result"], ShouldEqual, "[]")
+
+		exist, optByte, err := objectStorage.Get(req.OptKeyMapObjectStorageKey["result"])
+		So(err, ShouldBeNil)
+		So(exist, ShouldBeTrue)
+		So(string(optByte), ShouldEqual, "[]")
+	})
+}
+
+func TestTimeoutCancelMapChildren(t *testing.T) {
+	fRRS, _ := function_run_record.NewService(
+		function_run_record.WithFunctionRunRecordRepository(memory_funcRunRecord.New()))
+	InjectFunctionRunRecordService(fRRS)
+
+	Convey("not finished children are timeout canceled", t, func() {
+		parent, children := createMapRun(3)
+		fRRService.FunctionRunRecords.SaveSuc(
+			children[0].ID, "", nil, nil, nil, nil, false)
+		fRRService.FunctionRunRecords.SaveStart(children[1].ID)
+
+		So(timeoutCancelMapChildren(parent.ID), ShouldBeNil)
+
+		finished, _ := fRRService.FunctionRunRecords.GetByID(children[0].ID)
+		So(finished.Suc, ShouldBeTrue)
+		So(finished.TimeoutCanceled, ShouldBeFalse)
+		for _, child := range children[1:] {
+			canceled, _ := fRRService.FunctionRunRecords.GetByID(child.ID)
+			So(canceled.Finished(), ShouldBeTrue)
+			So(canceled.Canceled, ShouldBeTrue)
+			So(canceled.TimeoutCanceled, ShouldBeTrue)
+		}
+	})
+}
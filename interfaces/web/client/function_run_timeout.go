@@ -0,0 +1,173 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// FunctionRunTimeoutConsumer 监听function运行超时事件，按照重试策略重试或使运行失败
+// 依赖注入的各项service，需在注入完成后运行
+func FunctionRunTimeoutConsumer() {
+	functionRunTimeoutEventChan := make(chan event.DomainEvent)
+	err := event.ListenEvent(
+		&event.FunctionRunTimeout{}, "function_run_timeout_consumer",
+		functionRunTimeoutEventChan)
+	if err != nil {
+		panic(err)
+	}
+
+	for functionRunTimeoutEvent := range functionRunTimeoutEventChan {
+		funcRunRecordIDStr := functionRunTimeoutEvent.Identity()
+		logTags := map[string]string{
+			string(value_object.SpanID): value_object.NewSpanID(),
+			"business":                  "function run timeout consumer",
+			"function_run_record_id":    funcRunRecordIDStr}
+
+		funcRunRecordUUID, err := value_object.ParseToUUID(funcRunRecordIDStr)
+		if err != nil {
+			scheduleLogger.Errorf(logTags, "parse identity to uuid failed: %v", err)
+			continue
+		}
+		functionRunTimeout(logTags, funcRunRecordUUID)
+	}
+}
+
+func functionRunTimeout(logTags map[string]string, funcRunRecordID value_object.UUID) {
+	fRRIns, err := fRRService.FunctionRunRecords.GetByID(funcRunRecordID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "get function_run_record by id failed: %v", err)
+		return
+	}
+	if fRRIns.IsZero() {
+		scheduleLogger.Warningf(logTags, "get function_run_record by id match no record")
+		return
+	}
+	logTags[string(value_object.TraceID)] = fRRIns.TraceID
+	if fRRIns.Finished() { // 在被标记超时前客户端已经上报了完成
+		scheduleLogger.Infof(logTags, "function_run_record already finished")
+		return
+	}
+
+	flowRunRecordIns, err := flowRunRecordService.FlowRunRecord.GetByID(fRRIns.FlowRunRecordID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "get flow_run_record by id failed: %v", err)
+		return
+	}
+	logTags["flow_run_record_id"] = fRRIns.FlowRunRecordID.String()
+	if flowRunRecordIns.Finished() { // flow已经结束了，此节点直接取消
+		err = fRRService.FunctionRunRecords.SaveCancel(fRRIns.ID)
+		if err != nil {
+			scheduleLogger.Errorf(logTags, "save function_run_record cancel failed: %v", err)
+		}
+		return
+	}
+
+	flowIns, err := flowService.Flow.GetByID(fRRIns.FlowID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "get flow by id failed: %v", err)
+		return
+	}
+	req := FuncRunFinishedHttpReq{
+		FunctionRunRecordID: fRRIns.ID.String(),
+		TimeoutCanceled:     true,
+		ErrorMsg: fmt.Sprintf(
+			"run timeout. deadline: %s", fRRIns.ShouldBeCanceledAt.Format(time.RFC3339)),
+		byTimeoutWatcher: true,
+	}
+	if flowFunction, ok := flowIns.FlowFunctionIDMapFlowFunction[fRRIns.FlowFunctionID]; ok {
+		if flowFunction.Map != nil { // map节点整体超时不重试，避免重复展开子记录
+			req.NonRetryable = true
+			if !fRRIns.IsMapChild() { // 父记录超时，还未结束的子记录一并取消
+				err = timeoutCancelMapChildren(fRRIns.ID)
+				if err != nil {
+					scheduleLogger.Errorf(logTags, "timeout cancel map children failed: %v", err)
+				}
+			}
+		}
+		if flowFunction.Approval != nil { // 等待审批超时，按照节点配置使运行失败或拦截
+			if !fRRIns.WaitingApproval { // 超时前已经被审批了
+				scheduleLogger.Infof(logTags, "approval already decided")
+				return
+			}
+			err = flowRunRecordService.FlowRunRecord.ApprovalResolved(flowRunRecordIns.ID)
+			if err != nil {
+				scheduleLogger.Errorf(logTags, "save flow_run_record approval resolved failed: %v", err)
+			}
+			req = approvalResultReq(fRRIns.ID, flowFunction.Approval, false, true, req.ErrorMsg)
+		}
+		if flowFunction.SubFlow != nil { // 子flow节点超时，其触发的子flow运行一并取消
+			err = timeoutCancelSubFlowRuns(logTags, flowRunRecordIns.ID, fRRIns.FlowFunctionID)
+			if err != nil {
+				scheduleLogger.Errorf(logTags, "timeout cancel sub flow runs failed: %v", err)
+			}
+		}
+	}
+
+	scheduleLogger.Infof(logTags, "function run timeout")
+	finishedErr := functionRunFinished(logTags, req)
+	if finishedErr != nil {
+		scheduleLogger.Errorf(logTags,
+			"handle function run timeout failed: %s. %v", finishedErr.msg, finishedErr.err)
+	}
+}
+
+// timeoutCancelSubFlowRuns 递归取消由某个子flow节点触发的、还未结束的子flow运行
+// arrangementFlowID为空时取消此运行记录触发的全部子flow运行
+func timeoutCancelSubFlowRuns(
+	logTags map[string]string,
+	parentFlowRunRecordID value_object.UUID, arrangementFlowID string,
+) error {
+	notFinishedStatus := make([]interface{}, 0, len(value_object.NotFinishedRunStatus()))
+	for _, i := range value_object.NotFinishedRunStatus() {
+		notFinishedStatus = append(notFinishedStatus, i)
+	}
+	filter := value_object.NewRepositoryFilter().
+		AddEqual("arrangement_task_id", parentFlowRunRecordID.String()).
+		AddIn("status", notFinishedStatus)
+	if arrangementFlowID != "" {
+		filter.AddEqual("arrangement_flow_id", arrangementFlowID)
+	}
+	subFlowRuns, err := flowRunRecordService.FlowRunRecord.Filter(
+		*filter, *value_object.NewRepositoryFilterOption())
+	if err != nil {
+		return err
+	}
+	for _, i := range subFlowRuns {
+		err := flowRunRecordService.FlowRunRecord.TimeoutCancel(i.ID)
+		if err != nil {
+			return err
+		}
+		event.PubFlowRunFinished(scheduleLogger, logTags, i.ID)
+		err = timeoutCancelSubFlowRuns(logTags, i.ID, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timeoutCancelMapChildren 取消map模式父记录下还未结束的子记录
+// 运行中的子记录被标记为超时取消以通知客户端停止，未发布的子记录结束后不会再被运行
+func timeoutCancelMapChildren(mapParentID value_object.UUID) error {
+	children, err := fRRService.FunctionRunRecords.FilterByMapParentID(mapParentID)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if child.Finished() {
+			continue
+		}
+		_, err = fRRService.FunctionRunRecords.SaveTimeoutCancel(child.ID)
+		if err != nil {
+			return err
+		}
+		err = fRRService.FunctionRunRecords.SaveCancel(child.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// MapFunctionRunEmptyConsumer 监听map模式节点被展开的数组为空的事件，
+// 以空数组作为opt使节点运行成功并驱动flow继续运行
+// 依赖注入的各项service，需在注入完成后运行
+func MapFunctionRunEmptyConsumer() {
+	mapFunctionRunEmptyEventChan := make(chan event.DomainEvent)
+	err := event.ListenEvent(
+		&event.MapFunctionRunEmpty{}, "map_function_run_empty_consumer",
+		mapFunctionRunEmptyEventChan)
+	if err != nil {
+		panic(err)
+	}
+
+	for mapFunctionRunEmptyEvent := range mapFunctionRunEmptyEventChan {
+		funcRunRecordIDStr := mapFunctionRunEmptyEvent.Identity()
+		logTags := map[string]string{
+			string(value_object.SpanID): value_object.NewSpanID(),
+			"business":                  "map function run empty consumer",
+			"function_run_record_id":    funcRunRecordIDStr}
+
+		funcRunRecordUUID, err := value_object.ParseToUUID(funcRunRecordIDStr)
+		if err != nil {
+			scheduleLogger.Errorf(logTags, "parse identity to uuid failed: %v", err)
+			continue
+		}
+		mapFunctionRunEmpty(logTags, funcRunRecordUUID)
+	}
+}
+
+func mapFunctionRunEmpty(logTags map[string]string, funcRunRecordID value_object.UUID) {
+	fRRIns, err := fRRService.FunctionRunRecords.GetByID(funcRunRecordID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "get function_run_record by id failed: %v", err)
+		return
+	}
+	if fRRIns.IsZero() {
+		scheduleLogger.Warningf(logTags, "get function_run_record by id match no record")
+		return
+	}
+	logTags[string(value_object.TraceID)] = fRRIns.TraceID
+	if fRRIns.Finished() {
+		scheduleLogger.Warningf(logTags, "function_run_record already finished")
+		return
+	}
+
+	functionIns := reported.idMapFunc[fRRIns.FunctionID]
+	req, err := mapParentSucReq(fRRIns, nil, &functionIns)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "save empty opts failed: %v", err)
+		req = &FuncRunFinishedHttpReq{
+			FunctionRunRecordID: fRRIns.ID.String(),
+			ErrorMsg:            "save empty opts failed: " + err.Error(),
+			NonRetryable:        true,
+		}
+	}
+
+	scheduleLogger.Infof(logTags, "map function run empty. suc: %t", req.Suc)
+	finishedErr := functionRunFinished(logTags, *req)
+	if finishedErr != nil {
+		scheduleLogger.Errorf(logTags,
+			"handle map function run empty failed: %s. %v", finishedErr.msg, finishedErr.err)
+	}
+}
@@ -22,3 +22,17 @@ type PersistFuncRunOptFieldHttpResp struct {
 	ObjectStorageKey string `json:"object_storage_key"`
 	Brief            string `json:"brief"`
 }
+
+// optBrief 截取opt序列化后的前面部分作为简要展示
+func optBrief(uploadByte []byte, cutLength int) string {
+	optInRune := []rune(string(uploadByte))
+	minLength := cutLength
+	if minLength <= 0 {
+		minLength = 51
+	}
+
+	if len(optInRune) < minLength {
+		minLength = len(optInRune)
+	}
+	return string(optInRune[:minLength-1])
+}
@@ -54,16 +54,7 @@ func PersistFuncRunOptField(w http.ResponseWriter, r *http.Request, _ httprouter
 		ObjectStorageKey: ossKey,
 	}
 
-	optInRune := []rune(string(uploadByte))
-	minLength := req.BriefCutLength
-	if minLength <= 0 {
-		minLength = 51
-	}
-
-	if len(optInRune) < minLength {
-		minLength = len(optInRune)
-	}
-	resp.Brief = string(optInRune[:minLength-1])
+	resp.Brief = optBrief(uploadByte, req.BriefCutLength)
 	logTags["brief"] = resp.Brief
 
 	scheduleLogger.Infof(logTags, "finished")
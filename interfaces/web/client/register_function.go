@@ -1,12 +1,15 @@
 package client
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/fBloc/bloc-server/aggregate"
 	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/pkg/json_schema"
 	"github.com/fBloc/bloc-server/pkg/opt"
+	"github.com/fBloc/bloc-server/pkg/value_type"
 	"github.com/fBloc/bloc-server/services/function"
 	"github.com/fBloc/bloc-server/value_object"
 )
@@ -57,3 +60,80 @@ type HttpFunction struct {
 	ProgressMilestones []string          `json:"progress_milestones"`
 	ErrorMsg           string            `json:"error_msg"`
 }
+
+// checkValueTypes ipt component/opt的值类型需要有效；
+// enum类型的component需要声明可选值，其他类型的不能声明可选值
+func (hF *HttpFunction) checkValueTypes() error {
+	for iptIndex, iptIns := range hF.Ipts {
+		for componentIndex, component := range iptIns.Components {
+			if !component.ValueType.IsValid() {
+				return fmt.Errorf(
+					"function %s's %dth ipt's %dth component value type「%s」not valid",
+					hF.Name, iptIndex, componentIndex, component.ValueType)
+			}
+			if component.ValueType != value_type.EnumValueType {
+				if len(component.AllowedValues) > 0 {
+					return fmt.Errorf(
+						"function %s's %dth ipt's %dth component is %s type, only enum type can have allowed values",
+						hF.Name, iptIndex, componentIndex, component.ValueType)
+				}
+				continue
+			}
+			if len(component.AllowedValues) == 0 {
+				return fmt.Errorf(
+					"function %s's %dth ipt's %dth component is enum type, must have allowed values",
+					hF.Name, iptIndex, componentIndex)
+			}
+			for _, allowedValue := range component.AllowedValues {
+				if !value_type.IsEnumScalar(allowedValue) {
+					return fmt.Errorf(
+						"function %s's %dth ipt's %dth component allowed value %v not valid, must be string/number/bool",
+						hF.Name, iptIndex, componentIndex, allowedValue)
+				}
+			}
+		}
+	}
+	for _, optIns := range hF.Opts {
+		if !optIns.ValueType.IsValid() {
+			return fmt.Errorf(
+				"function %s's opt %s value type「%s」not valid", hF.Name, optIns.Key, optIns.ValueType)
+		}
+	}
+	return nil
+}
+
+// checkJsonSchemas 附带的json schema需要有效，且只能用于json类型的ipt component/opt
+func (hF *HttpFunction) checkJsonSchemas() error {
+	for iptIndex, iptIns := range hF.Ipts {
+		for componentIndex, component := range iptIns.Components {
+			if len(component.JsonSchema) == 0 {
+				continue
+			}
+			if component.ValueType != value_type.JsonValueType {
+				return fmt.Errorf(
+					"function %s's %dth ipt's %dth component is %s type, only json type can have json schema",
+					hF.Name, iptIndex, componentIndex, component.ValueType)
+			}
+			if err := json_schema.CheckSchemaValid(component.JsonSchema); err != nil {
+				return fmt.Errorf(
+					"function %s's %dth ipt's %dth component json schema not valid: %v",
+					hF.Name, iptIndex, componentIndex, err)
+			}
+		}
+	}
+	for _, optIns := range hF.Opts {
+		if len(optIns.JsonSchema) == 0 {
+			continue
+		}
+		if optIns.ValueType != value_type.JsonValueType {
+			return fmt.Errorf(
+				"function %s's opt %s is %s type, only json type can have json schema",
+				hF.Name, optIns.Key, optIns.ValueType)
+		}
+		if err := json_schema.CheckSchemaValid(optIns.JsonSchema); err != nil {
+			return fmt.Errorf(
+				"function %s's opt %s json schema not valid: %v", hF.Name, optIns.Key, err)
+		}
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/fBloc/bloc-server/aggregate"
 	"github.com/fBloc/bloc-server/interfaces/web"
+	"github.com/fBloc/bloc-server/pkg/builtin_function"
 	"github.com/fBloc/bloc-server/pkg/ipt"
 	"github.com/fBloc/bloc-server/pkg/opt"
 	"github.com/fBloc/bloc-server/value_object"
@@ -28,6 +29,26 @@ func RegisterFunctions(w http.ResponseWriter, r *http.Request, _ httprouter.Para
 		return
 	}
 	logTags["provider"] = req.Who
+	if req.Who == builtin_function.ProviderName {
+		msg := fmt.Sprintf("provider name %s is reserved for builtin functions", req.Who)
+		fService.Logger.Warningf(logTags, msg)
+		web.WriteBadRequestDataResp(&w, r, msg)
+		return
+	}
+	for _, funcs := range req.GroupNameMapFunctions {
+		for _, f := range funcs {
+			if err := f.checkValueTypes(); err != nil {
+				fService.Logger.Warningf(logTags, "value type check failed: %v", err)
+				web.WriteBadRequestDataResp(&w, r, err.Error())
+				return
+			}
+			if err := f.checkJsonSchemas(); err != nil {
+				fService.Logger.Warningf(logTags, "json schema check failed: %v", err)
+				web.WriteBadRequestDataResp(&w, r, err.Error())
+				return
+			}
+		}
+	}
 
 	var wg sync.WaitGroup
 	toReportAliveFuncIDs := make(chan value_object.UUID, 40) // 控制下并发在40（别太高）
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/pkg/opt"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newComponentFunction(component *ipt.IptComponent) *HttpFunction {
+	return &HttpFunction{
+		Name: "f",
+		Ipts: []*ipt.Ipt{{Key: "k", Components: []*ipt.IptComponent{component}}},
+		Opts: []*opt.Opt{{Key: "o", ValueType: value_type.IntValueType}},
+	}
+}
+
+func TestHttpFunctionCheckValueTypes(t *testing.T) {
+	Convey("valid", t, func() {
+		So(newComponentFunction(&ipt.IptComponent{
+			ValueType: value_type.StringValueType}).checkValueTypes(), ShouldBeNil)
+		So(newComponentFunction(&ipt.IptComponent{
+			ValueType:     value_type.EnumValueType,
+			AllowedValues: []interface{}{"kg", 1, true}}).checkValueTypes(), ShouldBeNil)
+	})
+
+	Convey("value type not valid", t, func() {
+		So(newComponentFunction(&ipt.IptComponent{
+			ValueType: "decimal"}).checkValueTypes(), ShouldNotBeNil)
+
+		f := newComponentFunction(&ipt.IptComponent{ValueType: value_type.IntValueType})
+		f.Opts[0].ValueType = "decimal"
+		So(f.checkValueTypes(), ShouldNotBeNil)
+	})
+
+	Convey("enum without allowed values", t, func() {
+		So(newComponentFunction(&ipt.IptComponent{
+			ValueType: value_type.EnumValueType}).checkValueTypes(), ShouldNotBeNil)
+		So(newComponentFunction(&ipt.IptComponent{
+			ValueType:     value_type.EnumValueType,
+			AllowedValues: []interface{}{[]interface{}{"kg"}}}).checkValueTypes(), ShouldNotBeNil)
+	})
+
+	Convey("allowed values on not enum", t, func() {
+		So(newComponentFunction(&ipt.IptComponent{
+			ValueType:     value_type.StringValueType,
+			AllowedValues: []interface{}{"kg"}}).checkValueTypes(), ShouldNotBeNil)
+	})
+}
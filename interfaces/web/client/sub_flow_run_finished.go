@@ -0,0 +1,154 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// SubFlowRunFinishedConsumer 监听flow运行完成事件，
+// 由子flow节点触发的flow运行完成后，以其结果作为父flow中对应子flow节点的运行结果
+// 依赖注入的各项service，需在注入完成后运行
+func SubFlowRunFinishedConsumer() {
+	flowRunFinishedEventChan := make(chan event.DomainEvent)
+	err := event.ListenEvent(
+		&event.FlowRunFinished{}, "sub_flow_run_finished_consumer",
+		flowRunFinishedEventChan)
+	if err != nil {
+		panic(err)
+	}
+
+	for flowRunFinishedEvent := range flowRunFinishedEventChan {
+		flowRunRecordIDStr := flowRunFinishedEvent.Identity()
+		logTags := map[string]string{
+			string(value_object.SpanID): value_object.NewSpanID(),
+			"business":                  "sub flow run finished consumer",
+			"sub_flow_run_record_id":    flowRunRecordIDStr}
+
+		flowRunRecordUUID, err := value_object.ParseToUUID(flowRunRecordIDStr)
+		if err != nil {
+			scheduleLogger.Errorf(logTags, "parse identity to uuid failed: %v", err)
+			continue
+		}
+		subFlowRunFinished(logTags, flowRunRecordUUID)
+	}
+}
+
+func subFlowRunFinished(logTags map[string]string, subFlowRunRecordID value_object.UUID) {
+	subFlowRunRecord, err := flowRunRecordService.FlowRunRecord.GetByID(subFlowRunRecordID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "get flow_run_record by id failed: %v", err)
+		return
+	}
+	if !subFlowRunRecord.IsArrangementTriggered() { // 不是由子flow节点触发的运行
+		return
+	}
+	logTags[string(value_object.TraceID)] = subFlowRunRecord.TraceID
+	if !subFlowRunRecord.Finished() {
+		scheduleLogger.Warningf(logTags, "sub flow run not finished")
+		return
+	}
+
+	parentFlowRunRecordID, err := value_object.ParseToUUID(subFlowRunRecord.ArrangementRunRecordID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "parse arrangement_run_record_id to uuid failed: %v", err)
+		return
+	}
+	logTags["flow_run_record_id"] = subFlowRunRecord.ArrangementRunRecordID
+	parentFlowRunRecord, err := flowRunRecordService.FlowRunRecord.GetByID(parentFlowRunRecordID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "get parent flow_run_record failed: %v", err)
+		return
+	}
+	if parentFlowRunRecord.IsZero() {
+		scheduleLogger.Errorf(logTags, "get parent flow_run_record match no record")
+		return
+	}
+	funcRunRecordID, ok := parentFlowRunRecord.FlowFuncIDMapFuncRunRecordID[subFlowRunRecord.ArrangementFlowID]
+	if !ok {
+		scheduleLogger.Errorf(logTags,
+			"parent flow_run_record have no function_run_record of flow_function: %s",
+			subFlowRunRecord.ArrangementFlowID)
+		return
+	}
+	logTags["function_run_record_id"] = funcRunRecordID.String()
+	funcRunRecordIns, err := fRRService.FunctionRunRecords.GetByID(funcRunRecordID)
+	if err != nil {
+		scheduleLogger.Errorf(logTags, "get function_run_record failed: %v", err)
+		return
+	}
+	if funcRunRecordIns.Finished() {
+		scheduleLogger.Warningf(logTags, "sub flow node already finished")
+		return
+	}
+	if parentFlowRunRecord.Finished() { // 父flow已经结束了（比如被取消），此节点不再继续
+		err = fRRService.FunctionRunRecords.SaveCancel(funcRunRecordID)
+		if err != nil {
+			scheduleLogger.Errorf(logTags, "save function_run_record cancel failed: %v", err)
+		}
+		return
+	}
+
+	req := FuncRunFinishedHttpReq{
+		FunctionRunRecordID: funcRunRecordID.String(),
+		Description:         fmt.Sprintf("sub flow_run_record: %s", subFlowRunRecord.ID.String()),
+	}
+	switch subFlowRunRecord.Status {
+	case value_object.Suc, value_object.InterceptedCancel:
+		req.Suc = true
+		req.InterceptBelowFunctionRun = subFlowRunRecord.Status == value_object.InterceptedCancel
+		err = fillSubFlowOpts(subFlowRunRecord, &req)
+		if err != nil {
+			scheduleLogger.Errorf(logTags, "gather sub flow's opt failed: %v", err)
+			req.Suc = false
+			req.InterceptBelowFunctionRun = false
+			req.ErrorMsg = "gather sub flow's opt failed: " + err.Error()
+		}
+	default:
+		req.Canceled = subFlowRunRecord.Canceled
+		req.TimeoutCanceled = subFlowRunRecord.TimeoutCanceled
+		req.ErrorMsg = fmt.Sprintf(
+			"sub flow run not suc. status: %d, error: %s",
+			subFlowRunRecord.Status, subFlowRunRecord.ErrorMsg)
+	}
+
+	scheduleLogger.Infof(logTags, "sub flow run finished. suc: %t", req.Suc)
+	finishedErr := functionRunFinished(logTags, req)
+	if finishedErr != nil {
+		scheduleLogger.Errorf(logTags,
+			"handle sub flow node finished failed: %s. %v", finishedErr.msg, finishedErr.err)
+	}
+}
+
+// fillSubFlowOpts 汇总子flow末端节点的opt作为子flow节点的opt，同名的以排序靠后的节点为准
+func fillSubFlowOpts(
+	subFlowRunRecord *aggregate.FlowRunRecord, req *FuncRunFinishedHttpReq,
+) error {
+	subFlow, err := flowService.Flow.GetByID(subFlowRunRecord.FlowID)
+	if err != nil {
+		return err
+	}
+	if subFlow.IsZero() {
+		return fmt.Errorf("sub flow(%s) not exist", subFlowRunRecord.FlowID.String())
+	}
+
+	leafOpts, err := subFlow.LeafOpts(subFlowRunRecord, fRRService.FunctionRunRecords.GetByID)
+	if err != nil {
+		return err
+	}
+	req.OptKeyMapObjectStorageKey = make(map[string]string, len(leafOpts))
+	req.OptKeyMapBriefData = make(map[string]string, len(leafOpts))
+	req.optKeyMapValueType = make(map[string]value_type.ValueType, len(leafOpts))
+	req.optKeyMapIsArray = make(map[string]bool, len(leafOpts))
+	for optKey, leafOpt := range leafOpts {
+		leafRecord := leafOpt.FunctionRunRecord
+		req.OptKeyMapObjectStorageKey[optKey] = leafOpt.ObjectStorageKey
+		req.OptKeyMapBriefData[optKey] = leafRecord.OptBrief[optKey]
+		req.optKeyMapValueType[optKey] = leafRecord.OptKeyMapValueType[optKey]
+		req.optKeyMapIsArray[optKey] = leafRecord.OptKeyMapIsArray[optKey]
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/fBloc/bloc-server/aggregate"
 	"github.com/fBloc/bloc-server/config"
 	"github.com/fBloc/bloc-server/interfaces/web"
 	"github.com/fBloc/bloc-server/value_object"
@@ -129,6 +130,15 @@ func CreateBrandNewDraftFromFlowByOriginID(w http.ResponseWriter, r *http.Reques
 		web.WriteInternalServerErrorResp(&w, r, err, "create draft flow error")
 		return
 	}
+	if len(flowIns.Params) > 0 {
+		err = fService.Flow.PatchParams(newDraftIns.ID, flowIns.Params)
+		if err != nil {
+			fService.Logger.Errorf(logTags, "copy params to draft flow failed: %v", err)
+			web.WriteInternalServerErrorResp(&w, r, err, "create draft flow error")
+			return
+		}
+		newDraftIns.Params = flowIns.Params
+	}
 
 	web.WriteSucResp(&w, r, fromAggWithoutUserPermission(newDraftIns))
 }
@@ -281,6 +291,9 @@ func CreateDraft(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 			web.WriteInternalServerErrorResp(&w, r, err, "create draft flow error")
 			return
 		}
+		if !patchDraftParams(&w, r, logTags, flowIns, reqFlow.Params) {
+			return
+		}
 
 		web.WriteSucResp(&w, r, fromAggWithoutUserPermission(flowIns))
 		return
@@ -295,6 +308,9 @@ func CreateDraft(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		web.WriteInternalServerErrorResp(&w, r, err, "create flow error")
 		return
 	}
+	if !patchDraftParams(&w, r, logTags, flowIns, reqFlow.Params) {
+		return
+	}
 
 	fService.Logger.Infof(logTags, "finished create draft flow. id: %s", flowIns.ID.String())
 	web.WriteSucResp(&w, r, fromAggWithoutUserPermission(flowIns))
@@ -353,63 +369,20 @@ func PubDraft(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 	draftFlowIns.CreateUserID = reqUser.ID
 
-	// 正式提交的需要做有效性检测
-	startFlowBloc, ok := draftFlowIns.FlowFunctionIDMapFlowFunction[config.FlowFunctionStartID]
-	if !ok {
-		msg := "failed flow valid check: miss start function"
-		fService.Logger.Warningf(logTags, msg)
-		web.WriteBadRequestDataResp(&w, r, msg)
-		return
-	}
-	if len(startFlowBloc.DownstreamFlowFunctionIDs) <= 0 {
-		msg := "failed flow valid check: not allowed create flow without function"
-		fService.Logger.Warningf(logTags, msg)
-		web.WriteBadRequestDataResp(&w, r, msg)
-		return
-	}
-
-	funcIDMapFunction, err := fService.Function.IDMapFunctionAll()
+	// 正式提交的需要做有效性检测，存在error级别的问题时不允许发布
+	// 只检查连入运行流程的节点. 支持拖入节点但是不连入运行流程（比如临时下线某些node等场景）
+	issues, err := validateDraft(draftFlowIns)
 	if err != nil {
 		msg := "failed flow valid check: visit function failed(used to complete reference)"
-		fService.Logger.Errorf(logTags, msg)
+		fService.Logger.Errorf(logTags, "%s: %v", msg, err)
 		web.WriteBadRequestDataResp(&w, r, msg)
 		return
 	}
-
-	// 需要检查的节点只需要是在运行节点内的. 支持拖入节点但是不连入运行流程（比如临时下线某些node等场景）
-	neededToCheckFlowIDs := draftFlowIns.LinedFlowFunctionIDs()
-
-	// 将查到的function赋予到对应的值，方便后续的连接类型有效性检查
-	for _, flowFuncID := range neededToCheckFlowIDs {
-		if flowFuncID == config.FlowFunctionStartID {
-			continue
-		}
-		flowFunc := draftFlowIns.FlowFunctionIDMapFlowFunction[flowFuncID]
-		function, ok := funcIDMapFunction[flowFunc.FunctionID]
-		if !ok {
-			msg := fmt.Sprintf(
-				"function:%s's function_id: %s cannot find corresponding function",
-				flowFunc.Name(), flowFunc.FunctionID)
-			fService.Logger.Errorf(logTags, msg)
-			web.WriteBadRequestDataResp(&w, r, msg)
-			return
-		}
-		flowFunc.Function = function
-	}
-
-	// 具体开始检查每个节点的各项配置是否正确/有效
-	for _, flowFuncID := range neededToCheckFlowIDs {
-		flowFunc := draftFlowIns.FlowFunctionIDMapFlowFunction[flowFuncID]
-		valid, err := flowFunc.CheckValid(
-			flowFuncID,
-			draftFlowIns.FlowFunctionIDMapFlowFunction,
-		)
-		if !valid {
-			msg := fmt.Sprintf("function:「%s」failed valid check: %v", flowFunc.Name(), err)
-			fService.Logger.Errorf(logTags, msg)
-			web.WriteBadRequestDataResp(&w, r, msg)
-			return
-		}
+	if firstErr := issues.FirstError(); firstErr != nil {
+		msg := fmt.Sprintf("failed flow valid check: %s", firstErr.Message)
+		fService.Logger.Errorf(logTags, msg)
+		web.WriteBadRequestDataWithDetailResp(&w, r, newValidationIssuesFromAgg(issues), msg)
+		return
 	}
 
 	// 通过有效性测试，开始创建
@@ -427,6 +400,58 @@ func PubDraft(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	web.WriteSucResp(&w, r, fromAggWithoutUserPermission(aggF))
 }
 
+// ValidateDraft 静态校验草稿并返回发现的全部问题，供前端编辑时调用
+func ValidateDraft(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	logTags := web.GetTraceAboutFields(r.Context())
+	logTags["business"] = "validate draft flow"
+
+	reqUser, suc := web.GetReqUserFromContext(r.Context())
+	if !suc {
+		fService.Logger.Errorf(
+			logTags, "failed to get user from context which should be setted by middleware!")
+		web.WriteInternalServerErrorResp(&w, r, nil, "get requser from context failed")
+		return
+	}
+	logTags["user_name"] = reqUser.Name
+
+	draftFlowID := ps.ByName("id")
+	draftFlowUUID, err := web.ParseStrValueToUUID("id", draftFlowID)
+	if err != nil {
+		fService.Logger.Errorf(
+			logTags,
+			"parse draft_flow_id in query param:%s to uuid failed: %v", draftFlowID, err)
+		web.WriteBadRequestDataResp(&w, r, err.Error())
+		return
+	}
+	logTags["draft_flow_id"] = draftFlowID
+
+	draftFlowIns, err := fService.Flow.GetByID(draftFlowUUID)
+	if err != nil {
+		fService.Logger.Errorf(logTags, "find draft flow by id failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "find draft flow by id failed")
+		return
+	}
+	if draftFlowIns.IsZero() || !draftFlowIns.IsDraft {
+		fService.Logger.Warningf(logTags, "find draft flow by id find no record")
+		web.WriteBadRequestDataResp(&w, r, "id find no draft flow")
+		return
+	}
+
+	if !draftFlowIns.UserCanRead(reqUser) {
+		fService.Logger.Errorf(logTags, "need read permission")
+		web.WritePermissionNotEnough(&w, r, "need read permission to validate draft flow")
+		return
+	}
+
+	issues, err := validateDraft(draftFlowIns)
+	if err != nil {
+		fService.Logger.Errorf(logTags, "validate draft flow failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "visit function failed")
+		return
+	}
+	web.WriteSucResp(&w, r, newValidationIssuesFromAgg(issues))
+}
+
 // Update 用户前端更新的draft_flow,此时id不是origin_id
 func UpdateDraft(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	logTags := web.GetTraceAboutFields(r.Context())
@@ -513,6 +538,17 @@ func UpdateDraft(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		fService.Logger.Infof(logTags, baseLogMsg)
 	}
 
+	if reqFlow.Params != nil {
+		err := fService.Flow.PatchParams(reqFlow.ID, formatToAggFlowParams(reqFlow.Params))
+		baseLogMsg := "change draft flow's params"
+		if err != nil {
+			fService.Logger.Errorf(logTags, "%s. error: %v", baseLogMsg, err)
+			web.WriteInternalServerErrorResp(&w, r, err, "update params failed")
+			return
+		}
+		fService.Logger.Infof(logTags, baseLogMsg)
+	}
+
 	// 若是修改节点构成，需要再次进行**粗略的**有效性检测（草稿不需要太严格的检验）
 	if len(reqFlow.FlowFunctionIDMapFlowFunction) != 0 {
 		_, ok := reqFlow.FlowFunctionIDMapFlowFunction[config.FlowFunctionStartID]
@@ -598,3 +634,23 @@ func DeleteDraftByOriginID(w http.ResponseWriter, r *http.Request, ps httprouter
 	fService.Logger.Infof(logTags, "finished with delete amount: %d", deleteCount)
 	web.WriteDeleteSucResp(&w, r, deleteCount)
 }
+
+// patchDraftParams 保存创建草稿时请求中带的flow参数定义，没有带时保持不变
+// 返回false表示失败、已写了响应
+func patchDraftParams(
+	w *http.ResponseWriter, r *http.Request, logTags map[string]string,
+	draftIns *aggregate.Flow, params []FlowParam,
+) bool {
+	if params == nil {
+		return true
+	}
+	aggParams := formatToAggFlowParams(params)
+	err := fService.Flow.PatchParams(draftIns.ID, aggParams)
+	if err != nil {
+		fService.Logger.Errorf(logTags, "save draft flow params failed: %v", err)
+		web.WriteInternalServerErrorResp(w, r, err, "save params error")
+		return false
+	}
+	draftIns.Params = aggParams
+	return true
+}
@@ -1,11 +1,15 @@
 package flow
 
 import (
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/config"
 	"github.com/fBloc/bloc-server/internal/timestamp"
+	"github.com/fBloc/bloc-server/pkg/json_schema"
 	"github.com/fBloc/bloc-server/pkg/value_type"
 	"github.com/fBloc/bloc-server/services/flow"
 	"github.com/fBloc/bloc-server/value_object"
@@ -30,6 +34,187 @@ type FlowExecuteAttribute struct {
 	RetryAmount           *uint16 `json:"retry_amount"`
 	RetryIntervalInSecond *uint16 `json:"retry_interval_in_second"`
 	AllowParallelRun      *bool   `json:"allow_parallel_run"`
+	// 允许并行运行时最多同时运行的数量，0表示不限制
+	MaxConcurrentRuns *uint16 `json:"max_concurrent_runs"`
+	// 运行数达到上限时，新运行的处理方式：drop/queue/replace/keep_latest
+	RunConflictStrategy *value_object.RunConflictStrategy `json:"run_conflict_strategy"`
+	// crontab计划时间被错过时的处理方式：skip/fire_once/fire_all，
+	// 及fire_all时最多补发的次数
+	CrontabMisfirePolicy  *value_object.CrontabMisfirePolicy `json:"crontab_misfire_policy"`
+	CrontabMisfireMaxRuns *uint16                            `json:"crontab_misfire_max_runs"`
+	// 运行结束后的通知
+	NotificationRules *[]NotificationRule `json:"notification_rules"`
+	// 暂停后各种方式触发的运行都会被跳过
+	Paused *bool `json:"paused"`
+	// 禁止运行的时段，其间触发的运行会被跳过
+	BlackoutWindows *[]BlackoutWindow `json:"blackout_windows"`
+	// 依赖的上游flow，上游运行结束且满足条件时触发此flow运行
+	Dependencies *[]FlowDependency `json:"dependencies"`
+}
+
+// FlowDependency 依赖的上游flow。on取值suc/fail，
+// opt_mappings将上游flow末端节点的opt作为此flow某个节点参数的覆盖值，为空时不传递参数
+type FlowDependency struct {
+	UpstreamFlowOriginID value_object.UUID                  `json:"upstream_flow_origin_id"`
+	On                   []value_object.DependencyTriggerOn `json:"on"`
+	OptMappings          []DependencyOptMapping             `json:"opt_mappings"`
+}
+
+type DependencyOptMapping struct {
+	OptKey         string `json:"opt_key"`
+	FlowFunctionID string `json:"flow_function_id"`
+	IptIndex       int    `json:"ipt_index"`
+	ComponentIndex int    `json:"component_index"`
+}
+
+func (fD FlowDependency) formatToAggFlowDependency() *aggregate.FlowDependency {
+	aggDependency := &aggregate.FlowDependency{
+		UpstreamFlowOriginID: fD.UpstreamFlowOriginID,
+		On:                   fD.On,
+	}
+	for _, mapping := range fD.OptMappings {
+		aggDependency.OptMappings = append(aggDependency.OptMappings, aggregate.DependencyOptMapping{
+			OptKey:         mapping.OptKey,
+			FlowFunctionID: mapping.FlowFunctionID,
+			IptIndex:       mapping.IptIndex,
+			ComponentIndex: mapping.ComponentIndex,
+		})
+	}
+	return aggDependency
+}
+
+func newFlowDependenciesFromAgg(aggDependencies []*aggregate.FlowDependency) []FlowDependency {
+	resp := make([]FlowDependency, 0, len(aggDependencies))
+	for _, dependency := range aggDependencies {
+		webDependency := FlowDependency{
+			UpstreamFlowOriginID: dependency.UpstreamFlowOriginID,
+			On:                   dependency.On,
+			OptMappings:          make([]DependencyOptMapping, 0, len(dependency.OptMappings)),
+		}
+		for _, mapping := range dependency.OptMappings {
+			webDependency.OptMappings = append(webDependency.OptMappings, DependencyOptMapping{
+				OptKey:         mapping.OptKey,
+				FlowFunctionID: mapping.FlowFunctionID,
+				IptIndex:       mapping.IptIndex,
+				ComponentIndex: mapping.ComponentIndex,
+			})
+		}
+		resp = append(resp, webDependency)
+	}
+	return resp
+}
+
+// BlackoutWindow 禁止运行的周期性时段。
+// weekdays取值0(周日)~6(周六)，为空表示每天；end早于start表示跨越零点；timezone为空表示服务器本地时区
+type BlackoutWindow struct {
+	Weekdays []time.Weekday `json:"weekdays"`
+	Start    string         `json:"start"`
+	End      string         `json:"end"`
+	Timezone string         `json:"timezone"`
+}
+
+func (bW BlackoutWindow) formatToAggBlackoutWindow() *aggregate.BlackoutWindow {
+	return &aggregate.BlackoutWindow{
+		Weekdays: bW.Weekdays,
+		Start:    bW.Start,
+		End:      bW.End,
+		Timezone: bW.Timezone,
+	}
+}
+
+func newBlackoutWindowsFromAgg(aggWindows []*aggregate.BlackoutWindow) []BlackoutWindow {
+	resp := make([]BlackoutWindow, 0, len(aggWindows))
+	for _, window := range aggWindows {
+		resp = append(resp, BlackoutWindow{
+			Weekdays: window.Weekdays,
+			Start:    window.Start,
+			End:      window.End,
+			Timezone: window.Timezone,
+		})
+	}
+	return resp
+}
+
+// FlowParam flow级别的输入参数，节点的component以ipt_way=flow_param、key=参数名绑定。
+// default_value为空表示没有默认值
+type FlowParam struct {
+	Name         string               `json:"name"`
+	Description  string               `json:"description"`
+	ValueType    value_type.ValueType `json:"value_type"`
+	Required     bool                 `json:"required"`
+	DefaultValue interface{}          `json:"default_value"`
+}
+
+func (fP FlowParam) formatToAggFlowParam() *aggregate.FlowParam {
+	return &aggregate.FlowParam{
+		Name:         fP.Name,
+		Description:  fP.Description,
+		ValueType:    fP.ValueType,
+		Required:     fP.Required,
+		DefaultValue: fP.DefaultValue,
+	}
+}
+
+func newFlowParamsFromAgg(aggParams []*aggregate.FlowParam) []FlowParam {
+	resp := make([]FlowParam, 0, len(aggParams))
+	for _, param := range aggParams {
+		resp = append(resp, FlowParam{
+			Name:         param.Name,
+			Description:  param.Description,
+			ValueType:    param.ValueType,
+			Required:     param.Required,
+			DefaultValue: param.DefaultValue,
+		})
+	}
+	return resp
+}
+
+// NotificationRule flow运行结束后的通知规则。
+// 展示时不返回secret，仅通过have_secret表明是否设置了
+type NotificationRule struct {
+	Triggers         []value_object.NotifyTrigger `json:"triggers"`
+	LongRunInMinutes uint32                       `json:"long_run_in_minutes"`
+	Channel          value_object.NotifyChannel   `json:"channel"`
+	Target           string                       `json:"target"`
+	Secret           string                       `json:"secret,omitempty"`
+	HaveSecret       bool                         `json:"have_secret"`
+}
+
+// formatToAggNotificationRule 未传入secret但have_secret为true的，沿用原有同渠道同目标规则的secret
+func (nR NotificationRule) formatToAggNotificationRule(
+	oldRules []*aggregate.NotificationRule,
+) *aggregate.NotificationRule {
+	aggRule := &aggregate.NotificationRule{
+		Triggers:         nR.Triggers,
+		LongRunInMinutes: nR.LongRunInMinutes,
+		Channel:          nR.Channel,
+		Target:           nR.Target,
+		Secret:           nR.Secret,
+	}
+	if aggRule.Secret != "" || !nR.HaveSecret {
+		return aggRule
+	}
+	for _, oldRule := range oldRules {
+		if oldRule.Channel == nR.Channel && oldRule.Target == nR.Target {
+			aggRule.Secret = oldRule.Secret
+			break
+		}
+	}
+	return aggRule
+}
+
+func newNotificationRulesFromAgg(aggRules []*aggregate.NotificationRule) []NotificationRule {
+	resp := make([]NotificationRule, 0, len(aggRules))
+	for _, rule := range aggRules {
+		resp = append(resp, NotificationRule{
+			Triggers:         rule.Triggers,
+			LongRunInMinutes: rule.LongRunInMinutes,
+			Channel:          rule.Channel,
+			Target:           rule.Target,
+			HaveSecret:       rule.Secret != "",
+		})
+	}
+	return resp
 }
 
 type LatestRun struct {
@@ -103,16 +288,111 @@ type IptComponentConfig struct {
 	Value interface{} `json:"value"`
 	// 当且仅当为connection时才会有此
 	FlowFunctionID string `json:"flow_function_id"`
-	Key            string `json:"key"`
+	// connection时为上游opt的key；flow_param时为绑定的flow参数名
+	Key string `json:"key"`
+	// 仅connection时可配置，对上游opt的值执行的转换表达式
+	Transform string `json:"transform,omitempty"`
+}
+
+// BranchCondition 连向下游节点的边上的条件，如 opt.status == "ok"
+type BranchCondition struct {
+	OptKey   string                         `json:"opt_key"`
+	Operator value_object.ConditionOperator `json:"operator"`
+	Value    interface{}                    `json:"value"`
+}
+
+// MapSetting 对数组ipt逐元素运行的配置
+type MapSetting struct {
+	IptIndex       int `json:"ipt_index"`
+	MaxConcurrency int `json:"max_concurrency"`
+}
+
+// SubFlowIptTarget 子flow节点的ipt传入到子flow中的哪个节点的哪个参数
+type SubFlowIptTarget struct {
+	FlowFunctionID string `json:"flow_function_id"`
+	IptIndex       int    `json:"ipt_index"`
+	ComponentIndex int    `json:"component_index"`
+}
+
+// SubFlowSetting 运行另一个已上线flow的节点配置
+type SubFlowSetting struct {
+	FlowOriginID value_object.UUID  `json:"flow_origin_id"`
+	IptTargets   []SubFlowIptTarget `json:"ipt_targets"`
+}
+
+// Approver 审批人及其接收审批通知的渠道
+type Approver struct {
+	UserID  value_object.UUID          `json:"user_id"`
+	Channel value_object.NotifyChannel `json:"channel"`
+	Target  string                     `json:"target"`
+}
+
+// ApprovalSetting 人工审批节点配置
+type ApprovalSetting struct {
+	Approvers []Approver                    `json:"approvers"`
+	OnReject  value_object.ApprovalFallback `json:"on_reject"`
+	OnTimeout value_object.ApprovalFallback `json:"on_timeout"`
+}
+
+func (aS *ApprovalSetting) formatToAggApprovalSetting() *aggregate.ApprovalSetting {
+	if aS == nil {
+		return nil
+	}
+	resp := &aggregate.ApprovalSetting{
+		Approvers: make([]*aggregate.Approver, 0, len(aS.Approvers)),
+		OnReject:  aS.OnReject,
+		OnTimeout: aS.OnTimeout,
+	}
+	for _, approver := range aS.Approvers {
+		resp.Approvers = append(resp.Approvers, &aggregate.Approver{
+			UserID:  approver.UserID,
+			Channel: approver.Channel,
+			Target:  approver.Target,
+		})
+	}
+	return resp
+}
+
+func newApprovalSettingFromAgg(aggSetting *aggregate.ApprovalSetting) *ApprovalSetting {
+	if aggSetting == nil {
+		return nil
+	}
+	resp := &ApprovalSetting{
+		Approvers: make([]Approver, 0, len(aggSetting.Approvers)),
+		OnReject:  aggSetting.OnReject,
+		OnTimeout: aggSetting.OnTimeout,
+	}
+	for _, approver := range aggSetting.Approvers {
+		resp.Approvers = append(resp.Approvers, Approver{
+			UserID:  approver.UserID,
+			Channel: approver.Channel,
+			Target:  approver.Target,
+		})
+	}
+	return resp
+}
+
+// RetryPolicy 节点的重试策略
+type RetryPolicy struct {
+	MaxAttempts      uint16                    `json:"max_attempts"`
+	Backoff          value_object.RetryBackoff `json:"backoff"`
+	IntervalInSecond uint16                    `json:"interval_in_second"`
+	MaxDelayInSecond uint16                    `json:"max_delay_in_second"`
 }
 
 type FlowFunction struct {
-	FunctionID                value_object.UUID      `json:"function_id"`
-	Note                      string                 `json:"note"`
-	Position                  interface{}            `json:"position"`
-	UpstreamFlowFunctionIDs   []string               `json:"upstream_flowfunction_ids"`
-	DownstreamFlowFunctionIDs []string               `json:"downstream_flowfunction_ids"`
-	ParamIpts                 [][]IptComponentConfig `json:"param_ipts"`
+	FunctionID                value_object.UUID           `json:"function_id"`
+	Note                      string                      `json:"note"`
+	Position                  interface{}                 `json:"position"`
+	UpstreamFlowFunctionIDs   []string                    `json:"upstream_flowfunction_ids"`
+	DownstreamFlowFunctionIDs []string                    `json:"downstream_flowfunction_ids"`
+	DownstreamConditions      map[string]*BranchCondition `json:"downstream_conditions,omitempty"`
+	Map                       *MapSetting                 `json:"map,omitempty"`
+	SubFlow                   *SubFlowSetting             `json:"sub_flow,omitempty"`
+	Approval                  *ApprovalSetting            `json:"approval,omitempty"`
+	RetryPolicy               *RetryPolicy                `json:"retry_policy,omitempty"`
+	TimeoutInSeconds          uint32                      `json:"timeout_in_seconds"`
+	ParamIpts                 [][]IptComponentConfig      `json:"param_ipts"`
 }
 
 func (flowFunc FlowFunction) formatToAggFlowFunction() *aggregate.FlowFunction {
@@ -127,15 +407,63 @@ func (flowFunc FlowFunction) formatToAggFlowFunction() *aggregate.FlowFunction {
 				Value:          k.Value,
 				FlowFunctionID: k.FlowFunctionID,
 				Key:            k.Key,
+				Transform:      k.Transform,
 			}
 		}
 	}
+	var conditions map[string]*aggregate.BranchCondition
+	if len(flowFunc.DownstreamConditions) > 0 {
+		conditions = make(map[string]*aggregate.BranchCondition, len(flowFunc.DownstreamConditions))
+		for downFlowFuncID, condition := range flowFunc.DownstreamConditions {
+			conditions[downFlowFuncID] = &aggregate.BranchCondition{
+				OptKey:   condition.OptKey,
+				Operator: condition.Operator,
+				Value:    condition.Value,
+			}
+		}
+	}
+	var mapSetting *aggregate.MapSetting
+	if flowFunc.Map != nil {
+		mapSetting = &aggregate.MapSetting{
+			IptIndex:       flowFunc.Map.IptIndex,
+			MaxConcurrency: flowFunc.Map.MaxConcurrency,
+		}
+	}
+	var subFlowSetting *aggregate.SubFlowSetting
+	if flowFunc.SubFlow != nil {
+		subFlowSetting = &aggregate.SubFlowSetting{
+			FlowOriginID: flowFunc.SubFlow.FlowOriginID,
+			IptTargets:   make([]aggregate.SubFlowIptTarget, 0, len(flowFunc.SubFlow.IptTargets)),
+		}
+		for _, target := range flowFunc.SubFlow.IptTargets {
+			subFlowSetting.IptTargets = append(subFlowSetting.IptTargets, aggregate.SubFlowIptTarget{
+				FlowFunctionID: target.FlowFunctionID,
+				IptIndex:       target.IptIndex,
+				ComponentIndex: target.ComponentIndex,
+			})
+		}
+	}
+	var retryPolicy *aggregate.RetryPolicy
+	if flowFunc.RetryPolicy != nil {
+		retryPolicy = &aggregate.RetryPolicy{
+			MaxAttempts:      flowFunc.RetryPolicy.MaxAttempts,
+			Backoff:          flowFunc.RetryPolicy.Backoff,
+			IntervalInSecond: flowFunc.RetryPolicy.IntervalInSecond,
+			MaxDelayInSecond: flowFunc.RetryPolicy.MaxDelayInSecond,
+		}
+	}
 	return &aggregate.FlowFunction{
 		FunctionID:                flowFunc.FunctionID,
 		Note:                      flowFunc.Note,
 		Position:                  flowFunc.Position,
 		UpstreamFlowFunctionIDs:   flowFunc.UpstreamFlowFunctionIDs,
 		DownstreamFlowFunctionIDs: flowFunc.DownstreamFlowFunctionIDs,
+		DownstreamConditions:      conditions,
+		Map:                       mapSetting,
+		SubFlow:                   subFlowSetting,
+		Approval:                  flowFunc.Approval.formatToAggApprovalSetting(),
+		RetryPolicy:               retryPolicy,
+		TimeoutInSeconds:          flowFunc.TimeoutInSeconds,
 		ParamIpts:                 paramIpts,
 	}
 }
@@ -160,6 +488,8 @@ type Flow struct {
 	CreateTime                    *timestamp.Timestamp     `json:"create_time"`
 	Position                      interface{}              `json:"position"`
 	FlowFunctionIDMapFlowFunction map[string]*FlowFunction `json:"flowFunctionID_map_flowFunction"`
+	// flow级别的输入参数
+	Params []FlowParam `json:"params"`
 	// 运行控制相关
 	// Crontab               *crontab.CrontabRepresent `json:"crontab"`
 	Crontab               string `json:"crontab"`
@@ -169,6 +499,21 @@ type Flow struct {
 	RetryAmount           uint16 `json:"retry_amount"`
 	RetryIntervalInSecond uint16 `json:"retry_interval_in_second"`
 	AllowParallelRun      bool   `json:"allow_parallel_run"`
+	// 允许并行运行时最多同时运行的数量，0表示不限制
+	MaxConcurrentRuns uint16 `json:"max_concurrent_runs"`
+	// 运行数达到上限时，新运行的处理方式
+	RunConflictStrategy value_object.RunConflictStrategy `json:"run_conflict_strategy"`
+	// crontab计划时间被错过时的处理方式
+	CrontabMisfirePolicy  value_object.CrontabMisfirePolicy `json:"crontab_misfire_policy"`
+	CrontabMisfireMaxRuns uint16                            `json:"crontab_misfire_max_runs"`
+	CrontabLastFiredTime  *timestamp.Timestamp              `json:"crontab_last_fired_time"`
+	// 运行结束后的通知
+	NotificationRules []NotificationRule `json:"notification_rules"`
+	// 暂停及禁止运行的时段
+	Paused          bool             `json:"paused"`
+	BlackoutWindows []BlackoutWindow `json:"blackout_windows"`
+	// 依赖的上游flow
+	Dependencies []FlowDependency `json:"dependencies"`
 	// permission
 	Read             bool `json:"read"`
 	Write            bool `json:"write"`
@@ -188,6 +533,14 @@ func (f *Flow) getAggregateFlowFunctionIDMapFlowFunction() map[string]*aggregate
 	return resp
 }
 
+func formatToAggFlowParams(params []FlowParam) []*aggregate.FlowParam {
+	resp := make([]*aggregate.FlowParam, 0, len(params))
+	for _, param := range params {
+		resp = append(resp, param.formatToAggFlowParam())
+	}
+	return resp
+}
+
 func (f *Flow) IsZero() bool {
 	return f == nil
 }
@@ -209,16 +562,68 @@ func fromAggWithoutUserPermission(aggF *aggregate.Flow) *Flow {
 					Value:          k.Value,
 					FlowFunctionID: k.FlowFunctionID,
 					Key:            k.Key,
+					Transform:      k.Transform,
 				}
 			}
 		}
 
+		var conditions map[string]*BranchCondition
+		if len(v.DownstreamConditions) > 0 {
+			conditions = make(map[string]*BranchCondition, len(v.DownstreamConditions))
+			for downFlowFuncID, condition := range v.DownstreamConditions {
+				conditions[downFlowFuncID] = &BranchCondition{
+					OptKey:   condition.OptKey,
+					Operator: condition.Operator,
+					Value:    condition.Value,
+				}
+			}
+		}
+
+		var mapSetting *MapSetting
+		if v.Map != nil {
+			mapSetting = &MapSetting{
+				IptIndex:       v.Map.IptIndex,
+				MaxConcurrency: v.Map.MaxConcurrency,
+			}
+		}
+
+		var subFlowSetting *SubFlowSetting
+		if v.SubFlow != nil {
+			subFlowSetting = &SubFlowSetting{
+				FlowOriginID: v.SubFlow.FlowOriginID,
+				IptTargets:   make([]SubFlowIptTarget, 0, len(v.SubFlow.IptTargets)),
+			}
+			for _, target := range v.SubFlow.IptTargets {
+				subFlowSetting.IptTargets = append(subFlowSetting.IptTargets, SubFlowIptTarget{
+					FlowFunctionID: target.FlowFunctionID,
+					IptIndex:       target.IptIndex,
+					ComponentIndex: target.ComponentIndex,
+				})
+			}
+		}
+
+		var retryPolicy *RetryPolicy
+		if v.RetryPolicy != nil {
+			retryPolicy = &RetryPolicy{
+				MaxAttempts:      v.RetryPolicy.MaxAttempts,
+				Backoff:          v.RetryPolicy.Backoff,
+				IntervalInSecond: v.RetryPolicy.IntervalInSecond,
+				MaxDelayInSecond: v.RetryPolicy.MaxDelayInSecond,
+			}
+		}
+
 		httpFuncs[k] = &FlowFunction{
 			FunctionID:                v.FunctionID,
 			Note:                      v.Note,
 			Position:                  v.Position,
 			UpstreamFlowFunctionIDs:   v.UpstreamFlowFunctionIDs,
 			DownstreamFlowFunctionIDs: v.DownstreamFlowFunctionIDs,
+			DownstreamConditions:      conditions,
+			Map:                       mapSetting,
+			SubFlow:                   subFlowSetting,
+			Approval:                  newApprovalSettingFromAgg(v.Approval),
+			RetryPolicy:               retryPolicy,
+			TimeoutInSeconds:          v.TimeoutInSeconds,
 			ParamIpts:                 paramIpts,
 		}
 	}
@@ -233,12 +638,22 @@ func fromAggWithoutUserPermission(aggF *aggregate.Flow) *Flow {
 		Position:                      aggF.Position,
 		FlowFunctionIDMapFlowFunction: httpFuncs,
 		Crontab:                       aggF.Crontab.String(),
+		CrontabMisfirePolicy:          aggF.MisfirePolicy(),
+		CrontabMisfireMaxRuns:         aggF.CrontabMisfireMaxRuns,
+		CrontabLastFiredTime:          timestamp.NewTimeStampFromTime(aggF.CrontabLastFiredTime),
 		TriggerKey:                    aggF.TriggerKey,
 		AllowTriggerByKey:             aggF.AllowTriggerByKey,
 		TimeoutInSeconds:              aggF.TimeoutInSeconds,
 		RetryAmount:                   aggF.RetryAmount,
 		RetryIntervalInSecond:         aggF.RetryIntervalInSecond,
 		AllowParallelRun:              aggF.AllowParallelRun,
+		MaxConcurrentRuns:             aggF.MaxConcurrentRuns,
+		RunConflictStrategy:           aggF.ConflictStrategy(),
+		NotificationRules:             newNotificationRulesFromAgg(aggF.NotificationRules),
+		Paused:                        aggF.Paused,
+		BlackoutWindows:               newBlackoutWindowsFromAgg(aggF.BlackoutWindows),
+		Dependencies:                  newFlowDependenciesFromAgg(aggF.Dependencies),
+		Params:                        newFlowParamsFromAgg(aggF.Params),
 	}
 	creator, err := fService.UserCacheService.GetUserByID(aggF.CreateUserID)
 	if err == nil && !creator.IsZero() {
@@ -339,6 +754,8 @@ func fromAggWithCertainRunFunctionView(
 			} else {
 				if funcRecord.Start.IsZero() {
 					thisFuncRunState = value_object.InQueue
+				} else if funcRecord.IsWaitingApproval() {
+					thisFuncRunState = value_object.WaitingApproval
 				} else {
 					thisFuncRunState = value_object.Running
 				}
@@ -454,6 +871,8 @@ func fromAggWithLatestRunFunctionView(
 				} else {
 					if funcRecord.Start.IsZero() {
 						thisFuncRunState = value_object.InQueue
+					} else if funcRecord.IsWaitingApproval() {
+						thisFuncRunState = value_object.WaitingApproval
 					} else {
 						thisFuncRunState = value_object.Running
 					}
@@ -561,3 +980,149 @@ func fromAggSlice(aggFs []aggregate.Flow, reqUser *aggregate.User) []*Flow {
 
 	return ret
 }
+
+// assembleSubFlowFunction 为子flow节点生成其虚拟function，用于后续的连接类型有效性检查
+func assembleSubFlowFunction(
+	flowIns *aggregate.Flow, flowFunc *aggregate.FlowFunction,
+	funcIDMapFunction map[value_object.UUID]*aggregate.Function,
+) (*aggregate.Function, error) {
+	return flowFunc.SubFlow.AssembleFunction(
+		flowIns.OriginID,
+		func(functionID value_object.UUID) *aggregate.Function {
+			return funcIDMapFunction[functionID]
+		},
+		fService.Flow.GetOnlineByOriginID)
+}
+
+// ValidationIssue 静态校验草稿发现的一个问题
+// 不针对某个节点时没有flow_function_id，不针对某个component时没有ipt_index、component_index
+type ValidationIssue struct {
+	Code             aggregate.ValidationIssueCode `json:"code"`
+	Severity         aggregate.ValidationSeverity  `json:"severity"`
+	FlowFunctionID   string                        `json:"flow_function_id,omitempty"`
+	IptIndex         *int                          `json:"ipt_index,omitempty"`
+	ComponentIndex   *int                          `json:"component_index,omitempty"`
+	Message          string                        `json:"message"`
+	JsonSchemaErrors json_schema.ValidationErrors  `json:"json_schema_errors,omitempty"`
+}
+
+func newValidationIssuesFromAgg(issues aggregate.ValidationIssues) []*ValidationIssue {
+	ret := make([]*ValidationIssue, len(issues))
+	for index, issue := range issues {
+		ret[index] = &ValidationIssue{
+			Code:           issue.Code,
+			Severity:       issue.Severity,
+			FlowFunctionID: issue.FlowFunctionID,
+			Message:        issue.Message,
+		}
+		if issue.IptIndex >= 0 {
+			iptIndex, componentIndex := issue.IptIndex, issue.ComponentIndex
+			ret[index].IptIndex, ret[index].ComponentIndex = &iptIndex, &componentIndex
+		}
+		var schemaErrs json_schema.ValidationErrors
+		if errors.As(issue.Err, &schemaErrs) {
+			ret[index].JsonSchemaErrors = schemaErrs
+		}
+	}
+	return ret
+}
+
+// validateDraft 将节点对应的function赋值到FlowFunction.Function后静态校验整个草稿
+func validateDraft(draftFlowIns *aggregate.Flow) (aggregate.ValidationIssues, error) {
+	funcIDMapFunction, err := fService.Function.IDMapFunctionAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// 子flow节点生成虚拟function失败的，以失败原因作为其missing_function问题的描述
+	assembleErrs := make(map[string]error)
+	for flowFuncID, flowFunc := range draftFlowIns.FlowFunctionIDMapFlowFunction {
+		if flowFuncID == config.FlowFunctionStartID {
+			continue
+		}
+		if flowFunc.Approval != nil {
+			flowFunc.Function = flowFunc.Approval.VirtualFunction()
+			continue
+		}
+		if flowFunc.SubFlow != nil {
+			function, err := assembleSubFlowFunction(draftFlowIns, flowFunc, funcIDMapFunction)
+			if err != nil {
+				assembleErrs[flowFuncID] = err
+				continue
+			}
+			flowFunc.Function = function
+			continue
+		}
+		flowFunc.Function = funcIDMapFunction[flowFunc.FunctionID]
+	}
+
+	issues := draftFlowIns.Validate(time.Now())
+	for _, issue := range issues {
+		if err, ok := assembleErrs[issue.FlowFunctionID]; ok && issue.Code == aggregate.MissingFunctionIssue {
+			issue.Message = fmt.Sprintf(
+				"sub flow node:%s not valid: %v",
+				draftFlowIns.FlowFunctionIDMapFlowFunction[issue.FlowFunctionID].Name(), err)
+			issue.Err = err
+		}
+	}
+
+	// 上线时沿用线上版本的依赖，其opt_mappings指向的节点需仍存在于草稿中
+	onlineFlow, err := fService.Flow.GetOnlineByOriginID(draftFlowIns.OriginID)
+	if err != nil {
+		return nil, err
+	}
+	if !onlineFlow.IsZero() {
+		issues = append(issues, draftFlowIns.ValidateDependencies(onlineFlow.Dependencies)...)
+	}
+	return issues, nil
+}
+
+// criticalPathSampleAmount 计算关键路径时取最近多少条function运行记录来统计节点的平均耗时
+const criticalPathSampleAmount = 500
+
+// FlowGraph flow的图结构：拓扑序、按深度的分层及以历史平均耗时计算的关键路径
+type FlowGraph struct {
+	TopologicalOrder       []string           `json:"topological_order"`
+	Depths                 map[string]int     `json:"depths"`
+	Levels                 [][]string         `json:"levels"`
+	AverageDurationSeconds map[string]float64 `json:"average_duration_seconds"`
+	CriticalPath           []string           `json:"critical_path"`
+	CriticalPathSeconds    float64            `json:"critical_path_seconds"`
+}
+
+func newFlowGraphFromAgg(
+	aggF *aggregate.Flow, durations map[string]time.Duration,
+) (*FlowGraph, error) {
+	graph := aggF.Graph()
+	order, err := graph.TopologicalOrder()
+	if err != nil {
+		return nil, err
+	}
+	depths, err := graph.Depths()
+	if err != nil {
+		return nil, err
+	}
+	levels, err := graph.Levels()
+	if err != nil {
+		return nil, err
+	}
+	criticalPath, criticalPathDuration, err := graph.CriticalPath(durations)
+	if err != nil {
+		return nil, err
+	}
+
+	averageDurationSeconds := make(map[string]float64, len(durations))
+	for flowFuncID, duration := range durations {
+		if _, ok := aggF.FlowFunctionIDMapFlowFunction[flowFuncID]; ok {
+			averageDurationSeconds[flowFuncID] = duration.Seconds()
+		}
+	}
+	return &FlowGraph{
+		TopologicalOrder:       order,
+		Depths:                 depths,
+		Levels:                 levels,
+		AverageDurationSeconds: averageDurationSeconds,
+		CriticalPath:           criticalPath,
+		CriticalPathSeconds:    criticalPathDuration.Seconds(),
+	}, nil
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/fBloc/bloc-server/aggregate"
 	"github.com/fBloc/bloc-server/interfaces/web"
 	"github.com/fBloc/bloc-server/internal/crontab"
 	"github.com/fBloc/bloc-server/value_object"
@@ -64,6 +65,64 @@ func GetFlowByID(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	web.WriteSucResp(&w, r, retFlow)
 }
 
+// GetFlowGraphByID flow的图结构，关键路径以此flow最近的运行记录中各节点的平均耗时计算
+func GetFlowGraphByID(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	logTags := web.GetTraceAboutFields(r.Context())
+	logTags["business"] = "get flow graph by id"
+
+	reqUser, suc := web.GetReqUserFromContext(r.Context())
+	if !suc {
+		fService.Logger.Errorf(logTags, "failed to get user from context which should be setted by middleware!")
+		web.WriteInternalServerErrorResp(&w, r, nil, "get requser from context failed")
+		return
+	}
+	logTags["user_name"] = reqUser.Name
+
+	flowID := ps.ByName("id")
+	if flowID == "" {
+		fService.Logger.Infof(logTags, "lack id in url path")
+		web.WriteBadRequestDataResp(&w, r, "id cannot be nil")
+		return
+	}
+	logTags["flow_id"] = flowID
+
+	flowIns, err := fService.Flow.GetByIDStr(flowID)
+	if err != nil {
+		fService.Logger.Errorf(logTags, "get flow by id error: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "")
+		return
+	}
+	if flowIns.IsZero() {
+		fService.Logger.Warningf(logTags, "get flow by id match no record")
+		web.WriteSucResp(&w, r, nil)
+		return
+	}
+	if !flowIns.UserCanRead(reqUser) {
+		fService.Logger.Warningf(logTags, "need read permission")
+		web.WritePermissionNotEnough(&w, r, "need read permission")
+		return
+	}
+
+	filter := value_object.NewRepositoryFilter().AddEqual("flow_origin_id", flowIns.OriginID)
+	filterOption := value_object.NewRepositoryFilterOption()
+	filterOption.SetDesc()
+	filterOption.SetLimit(criticalPathSampleAmount)
+	records, err := fService.FunctionRunRecord.Filter(*filter, *filterOption)
+	if err != nil {
+		fService.Logger.Errorf(logTags, "filter function_run_records of flow error: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "filter function_run_records failed")
+		return
+	}
+
+	graph, err := newFlowGraphFromAgg(flowIns, aggregate.FlowFunctionAverageDurations(records))
+	if err != nil {
+		fService.Logger.Warningf(logTags, "flow graph not valid: %v", err)
+		web.WriteBadRequestDataResp(&w, r, err.Error())
+		return
+	}
+	web.WriteSucResp(&w, r, graph)
+}
+
 func GetFlowByCertainFlowRunRecord(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	logTags := web.GetTraceAboutFields(r.Context())
 	logTags["business"] = "get flow by flow_run_record id"
@@ -278,6 +337,82 @@ func SetExecuteControlAttributes(w http.ResponseWriter, r *http.Request, _ httpr
 		return
 	}
 
+	// > crontab错过策略需要有效，空字符串视为未设置
+	if reqFlowExecuteAttribute.CrontabMisfirePolicy != nil &&
+		*reqFlowExecuteAttribute.CrontabMisfirePolicy == "" {
+		reqFlowExecuteAttribute.CrontabMisfirePolicy = nil
+	}
+	if reqFlowExecuteAttribute.CrontabMisfirePolicy != nil &&
+		!reqFlowExecuteAttribute.CrontabMisfirePolicy.IsValid() {
+		fService.Logger.Warningf(logTags,
+			"crontab_misfire_policy not valid: %s", *reqFlowExecuteAttribute.CrontabMisfirePolicy)
+		web.WriteBadRequestDataResp(&w, r,
+			"crontab_misfire_policy not valid: %s", *reqFlowExecuteAttribute.CrontabMisfirePolicy)
+		return
+	}
+
+	// > 冲突处理方式需要有效，空字符串视为未设置
+	if reqFlowExecuteAttribute.RunConflictStrategy != nil &&
+		*reqFlowExecuteAttribute.RunConflictStrategy == "" {
+		reqFlowExecuteAttribute.RunConflictStrategy = nil
+	}
+	if reqFlowExecuteAttribute.RunConflictStrategy != nil &&
+		!reqFlowExecuteAttribute.RunConflictStrategy.IsValid() {
+		fService.Logger.Warningf(logTags,
+			"run_conflict_strategy not valid: %s", *reqFlowExecuteAttribute.RunConflictStrategy)
+		web.WriteBadRequestDataResp(&w, r,
+			"run_conflict_strategy not valid: %s", *reqFlowExecuteAttribute.RunConflictStrategy)
+		return
+	}
+
+	// > 通知规则需要有效
+	var notificationRules []*aggregate.NotificationRule
+	if reqFlowExecuteAttribute.NotificationRules != nil {
+		notificationRules = make(
+			[]*aggregate.NotificationRule, 0, len(*reqFlowExecuteAttribute.NotificationRules))
+		for _, rule := range *reqFlowExecuteAttribute.NotificationRules {
+			aggRule := rule.formatToAggNotificationRule(flowIns.NotificationRules)
+			if err := aggRule.CheckValid(); err != nil {
+				fService.Logger.Warningf(logTags, "notification rule not valid: %v", err)
+				web.WriteBadRequestDataResp(&w, r, "notification rule not valid: %v", err)
+				return
+			}
+			notificationRules = append(notificationRules, aggRule)
+		}
+	}
+
+	// > 禁止运行的时段需要有效
+	var blackoutWindows []*aggregate.BlackoutWindow
+	if reqFlowExecuteAttribute.BlackoutWindows != nil {
+		blackoutWindows = make(
+			[]*aggregate.BlackoutWindow, 0, len(*reqFlowExecuteAttribute.BlackoutWindows))
+		for _, window := range *reqFlowExecuteAttribute.BlackoutWindows {
+			aggWindow := window.formatToAggBlackoutWindow()
+			if err := aggWindow.CheckValid(); err != nil {
+				fService.Logger.Warningf(logTags, "blackout window not valid: %v", err)
+				web.WriteBadRequestDataResp(&w, r, "blackout window not valid: %v", err)
+				return
+			}
+			blackoutWindows = append(blackoutWindows, aggWindow)
+		}
+	}
+
+	// > 依赖需要有效，且flow之间的依赖不能成环
+	var dependencies []*aggregate.FlowDependency
+	if reqFlowExecuteAttribute.Dependencies != nil {
+		dependencies = make(
+			[]*aggregate.FlowDependency, 0, len(*reqFlowExecuteAttribute.Dependencies))
+		for _, dependency := range *reqFlowExecuteAttribute.Dependencies {
+			dependencies = append(dependencies, dependency.formatToAggFlowDependency())
+		}
+		err := flowIns.CheckDependencies(dependencies, fService.Flow.GetOnlineByOriginID)
+		if err != nil {
+			fService.Logger.Warningf(logTags, "dependencies not valid: %v", err)
+			web.WriteBadRequestDataResp(&w, r, "dependencies not valid: %v", err)
+			return
+		}
+	}
+
 	// > 检测当前用户是否有update此flow的权限
 	if !flowIns.UserCanExecute(reqUser) {
 		fService.Logger.Warningf(logTags, "user lack execute permission")
@@ -302,6 +437,34 @@ func SetExecuteControlAttributes(w http.ResponseWriter, r *http.Request, _ httpr
 		}
 	}
 
+	// >> 更新crontab错过策略
+	if reqFlowExecuteAttribute.CrontabMisfirePolicy != nil ||
+		reqFlowExecuteAttribute.CrontabMisfireMaxRuns != nil {
+		misfirePolicy := flowIns.MisfirePolicy()
+		if reqFlowExecuteAttribute.CrontabMisfirePolicy != nil {
+			misfirePolicy = *reqFlowExecuteAttribute.CrontabMisfirePolicy
+		}
+		misfireMaxRuns := flowIns.CrontabMisfireMaxRuns
+		if reqFlowExecuteAttribute.CrontabMisfireMaxRuns != nil {
+			misfireMaxRuns = *reqFlowExecuteAttribute.CrontabMisfireMaxRuns
+		}
+		if misfirePolicy != flowIns.MisfirePolicy() ||
+			misfireMaxRuns != flowIns.CrontabMisfireMaxRuns {
+			err := fService.Flow.PatchCrontabMisfirePolicy(
+				reqFlowExecuteAttribute.ID, misfirePolicy, misfireMaxRuns)
+			baseLogMsg := fmt.Sprintf(
+				"change flow's crontab misfire policy from:%s(%d) to:%s(%d)",
+				flowIns.MisfirePolicy(), flowIns.CrontabMisfireMaxRuns,
+				misfirePolicy, misfireMaxRuns)
+			if err != nil {
+				fService.Logger.Errorf(logTags, "%s. error: %v", baseLogMsg, err)
+				web.WriteInternalServerErrorResp(&w, r, err, "update crontab misfire policy failed")
+				return
+			}
+			fService.Logger.Infof(logTags, baseLogMsg)
+		}
+	}
+
 	// >> 更新allow_trigger_by_key
 	if reqFlowExecuteAttribute.AllowTriggerByKey != nil &&
 		*reqFlowExecuteAttribute.AllowTriggerByKey != flowIns.AllowTriggerByKey {
@@ -378,6 +541,97 @@ func SetExecuteControlAttributes(w http.ResponseWriter, r *http.Request, _ httpr
 		fService.Logger.Infof(logTags, baseLogMsg)
 	}
 
+	// >> 更新最多同时运行的数量
+	if reqFlowExecuteAttribute.MaxConcurrentRuns != nil &&
+		*reqFlowExecuteAttribute.MaxConcurrentRuns != flowIns.MaxConcurrentRuns {
+		err := fService.Flow.PatchMaxConcurrentRuns(
+			reqFlowExecuteAttribute.ID, *reqFlowExecuteAttribute.MaxConcurrentRuns)
+		baseLogMsg := fmt.Sprintf(
+			"change flow's max_concurrent_runs from:%d to:%d",
+			flowIns.MaxConcurrentRuns, *reqFlowExecuteAttribute.MaxConcurrentRuns)
+		if err != nil {
+			fService.Logger.Errorf(logTags, "%s. error: %v", baseLogMsg, err)
+			web.WriteInternalServerErrorResp(&w, r, err, "update max_concurrent_runs failed")
+			return
+		}
+		fService.Logger.Infof(logTags, baseLogMsg)
+	}
+
+	// >> 更新运行数达到上限时的冲突处理方式
+	if reqFlowExecuteAttribute.RunConflictStrategy != nil &&
+		*reqFlowExecuteAttribute.RunConflictStrategy != flowIns.ConflictStrategy() {
+		err := fService.Flow.PatchRunConflictStrategy(
+			reqFlowExecuteAttribute.ID, *reqFlowExecuteAttribute.RunConflictStrategy)
+		baseLogMsg := fmt.Sprintf(
+			"change flow's run_conflict_strategy from:%s to:%s",
+			flowIns.ConflictStrategy(), *reqFlowExecuteAttribute.RunConflictStrategy)
+		if err != nil {
+			fService.Logger.Errorf(logTags, "%s. error: %v", baseLogMsg, err)
+			web.WriteInternalServerErrorResp(&w, r, err, "update run_conflict_strategy failed")
+			return
+		}
+		fService.Logger.Infof(logTags, baseLogMsg)
+	}
+
+	// >> 更新通知规则
+	if reqFlowExecuteAttribute.NotificationRules != nil {
+		err := fService.Flow.PatchNotificationRules(reqFlowExecuteAttribute.ID, notificationRules)
+		baseLogMsg := fmt.Sprintf(
+			"change flow's notification_rules amount from:%d to:%d",
+			len(flowIns.NotificationRules), len(notificationRules))
+		if err != nil {
+			fService.Logger.Errorf(logTags, "%s. error: %v", baseLogMsg, err)
+			web.WriteInternalServerErrorResp(&w, r, err, "update notification_rules failed")
+			return
+		}
+		fService.Logger.Infof(logTags, baseLogMsg)
+	}
+
+	// >> 更新是否暂停
+	if reqFlowExecuteAttribute.Paused != nil &&
+		*reqFlowExecuteAttribute.Paused != flowIns.Paused {
+		err := fService.Flow.PatchPaused(reqFlowExecuteAttribute.ID, *reqFlowExecuteAttribute.Paused)
+		baseLogMsg := fmt.Sprintf(
+			"change flow's paused from:%t to:%t",
+			flowIns.Paused, *reqFlowExecuteAttribute.Paused)
+		if err != nil {
+			fService.Logger.Errorf(logTags, "%s. error: %v", baseLogMsg, err)
+			web.WriteInternalServerErrorResp(&w, r, err, "update paused failed")
+			return
+		}
+		fService.Logger.Infof(logTags, baseLogMsg)
+	}
+
+	// >> 更新禁止运行的时段
+	if reqFlowExecuteAttribute.BlackoutWindows != nil &&
+		!(len(blackoutWindows) == 0 && len(flowIns.BlackoutWindows) == 0) {
+		err := fService.Flow.PatchBlackoutWindows(reqFlowExecuteAttribute.ID, blackoutWindows)
+		baseLogMsg := fmt.Sprintf(
+			"change flow's blackout_windows amount from:%d to:%d",
+			len(flowIns.BlackoutWindows), len(blackoutWindows))
+		if err != nil {
+			fService.Logger.Errorf(logTags, "%s. error: %v", baseLogMsg, err)
+			web.WriteInternalServerErrorResp(&w, r, err, "update blackout_windows failed")
+			return
+		}
+		fService.Logger.Infof(logTags, baseLogMsg)
+	}
+
+	// >> 更新依赖的上游flow
+	if reqFlowExecuteAttribute.Dependencies != nil &&
+		!(len(dependencies) == 0 && len(flowIns.Dependencies) == 0) {
+		err := fService.Flow.PatchDependencies(reqFlowExecuteAttribute.ID, dependencies)
+		baseLogMsg := fmt.Sprintf(
+			"change flow's dependencies amount from:%d to:%d",
+			len(flowIns.Dependencies), len(dependencies))
+		if err != nil {
+			fService.Logger.Errorf(logTags, "%s. error: %v", baseLogMsg, err)
+			web.WriteInternalServerErrorResp(&w, r, err, "update dependencies failed")
+			return
+		}
+		fService.Logger.Infof(logTags, baseLogMsg)
+	}
+
 	fService.Logger.Infof(logTags, "finished")
 	web.WritePlainSucOkResp(&w, r)
 }
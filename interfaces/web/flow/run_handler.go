@@ -3,7 +3,9 @@ package flow
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/fBloc/bloc-server/aggregate"
 	"github.com/fBloc/bloc-server/config"
@@ -19,6 +21,59 @@ type triggerRunRespStruct struct {
 	FlowRunRecordID value_object.UUID `json:"flow_run_record_id"`
 }
 
+// resolveRunParams 从POST请求体中读取{name: value}形式的flow参数值，检测并补充默认值
+// GET请求或请求体为空时视为没有提供参数值
+func resolveRunParams(r *http.Request, flowIns *aggregate.Flow) (map[string]interface{}, error) {
+	var values map[string]interface{}
+	if r.Method == http.MethodPost {
+		err := json.NewDecoder(r.Body).Decode(&values)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("json unmarshal req body to params failed: %v", err)
+		}
+	}
+	// 参数值需满足绑定的component的可选值及json schema
+	if len(flowIns.Params) > 0 {
+		if err := assembleFlowFunctions(flowIns); err != nil {
+			return nil, err
+		}
+	}
+	return flowIns.ResolveParams(values)
+}
+
+// assembleFlowFunctions 检查各节点配置的function_id是否正确，并将对应的function赋值到FlowFunction.Function
+func assembleFlowFunctions(flowIns *aggregate.Flow) error {
+	funcIDMapFunction, err := fService.Function.IDMapFunctionAll()
+	if err != nil {
+		return fmt.Errorf(
+			"failed flow valid check: visit function failed(used to complete reference): %v", err)
+	}
+	for flowFuncID, flowFunc := range flowIns.FlowFunctionIDMapFlowFunction {
+		if flowFuncID == config.FlowFunctionStartID {
+			continue
+		}
+		if flowFunc.Approval != nil {
+			flowFunc.Function = flowFunc.Approval.VirtualFunction()
+			continue
+		}
+		if flowFunc.SubFlow != nil {
+			function, err := assembleSubFlowFunction(flowIns, flowFunc, funcIDMapFunction)
+			if err != nil {
+				return fmt.Errorf("sub flow node:%s not valid: %v", flowFunc.Note, err)
+			}
+			flowFunc.Function = function
+			continue
+		}
+		function, ok := funcIDMapFunction[flowFunc.FunctionID]
+		if !ok {
+			return fmt.Errorf(
+				"function:%s's function_id: %s cannot find corresponding function",
+				flowFunc.Note, flowFunc.FunctionID)
+		}
+		flowFunc.Function = function
+	}
+	return nil
+}
+
 func RunByTriggerKey(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	logTags := web.GetTraceAboutFields(r.Context())
 	logTags["business"] = "trigger_key flow to run"
@@ -63,6 +118,13 @@ func RunByTriggerKey(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		return
 	}
 
+	params, err := resolveRunParams(r, &flowIns)
+	if err != nil {
+		fService.Logger.Warningf(logTags, "params not valid: %v", err)
+		web.WriteBadRequestDataResp(&w, r, err.Error())
+		return
+	}
+
 	// create new run record
 	aggFlowRunRecord, err := aggregate.NewKeyTriggeredFlowRunRecord(
 		r.Context(), &flowIns, triggerKey)
@@ -72,6 +134,7 @@ func RunByTriggerKey(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		web.WriteInternalServerErrorResp(&w, r, err, "build aggregate flow failed")
 		return
 	}
+	aggFlowRunRecord.Params = params
 
 	err = fService.FlowRunRecord.Create(aggFlowRunRecord)
 	if err != nil {
@@ -83,7 +146,7 @@ func RunByTriggerKey(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	}
 	logTags["flow_run_record_id"] = aggFlowRunRecord.ID.String()
 
-	err = event.PubEvent(&event.FlowToRun{FlowRunRecordID: aggFlowRunRecord.ID})
+	skippedReason, err := pubFlowToRunOrSkip(logTags, &flowIns, aggFlowRunRecord.ID)
 	if err != nil {
 		fService.Logger.Errorf(logTags, "pub event failed: %v", err)
 		web.WriteInternalServerErrorResp(&w, r, err, "pub event failed")
@@ -94,6 +157,9 @@ func RunByTriggerKey(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 	resp := triggerRunRespStruct{
 		FlowRunRecordID: aggFlowRunRecord.ID,
 	}
+	if skippedReason != "" {
+		resp.Msg = "skipped: " + skippedReason
+	}
 	web.WriteSucResp(&w, r, resp)
 }
 
@@ -141,30 +207,11 @@ func RunByTriggerKeyWithParamOverride(w http.ResponseWriter, r *http.Request, ps
 		return
 	}
 
-	funcIDMapFunction, err := fService.Function.IDMapFunctionAll()
-	if err != nil {
-		msg := "failed flow valid check: visit function failed(used to complete reference)"
-		fService.Logger.Errorf(logTags, msg)
-		web.WriteBadRequestDataResp(&w, r, msg)
+	if err := assembleFlowFunctions(&flowIns); err != nil {
+		fService.Logger.Errorf(logTags, err.Error())
+		web.WriteBadRequestDataResp(&w, r, err.Error())
 		return
 	}
-	// 检查FlowFunctionIDMapFlowFunction下面配置的每个function_id是否正确
-	// 同时也将查到的function赋予到对应的值，方便后续的连接类型有效性检查
-	for flowFuncID, flowFunc := range flowIns.FlowFunctionIDMapFlowFunction {
-		if flowFuncID == config.FlowFunctionStartID {
-			continue
-		}
-		function, ok := funcIDMapFunction[flowFunc.FunctionID]
-		if !ok {
-			msg := fmt.Sprintf(
-				"function:%s's function_id: %s cannot find corresponding function",
-				flowFunc.Note, flowFunc.FunctionID)
-			fService.Logger.Errorf(logTags, msg)
-			web.WriteBadRequestDataResp(&w, r, msg)
-			return
-		}
-		flowFunc.Function = function
-	}
 
 	flowFuncIDMapCustomParam := make(map[string][][]interface{})
 	err = json.NewDecoder(r.Body).Decode(&flowFuncIDMapCustomParam)
@@ -194,6 +241,14 @@ func RunByTriggerKeyWithParamOverride(w http.ResponseWriter, r *http.Request, ps
 		}
 	}
 
+	// 覆盖参数的请求体已被占用，flow参数全部使用默认值
+	params, err := flowIns.ResolveParams(nil)
+	if err != nil {
+		fService.Logger.Warningf(logTags, "params not valid: %v", err)
+		web.WriteBadRequestDataResp(&w, r, err.Error())
+		return
+	}
+
 	// create new run record
 	aggFlowRunRecord, err := aggregate.NewKeyTriggeredFlowRunRecordWithCustomParam(
 		r.Context(), &flowIns, triggerKey, flowFuncIDMapCustomParam)
@@ -203,6 +258,7 @@ func RunByTriggerKeyWithParamOverride(w http.ResponseWriter, r *http.Request, ps
 		web.WriteInternalServerErrorResp(&w, r, err, "build aggregate flow failed")
 		return
 	}
+	aggFlowRunRecord.Params = params
 
 	err = fService.FlowRunRecord.Create(aggFlowRunRecord)
 	if err != nil {
@@ -214,7 +270,7 @@ func RunByTriggerKeyWithParamOverride(w http.ResponseWriter, r *http.Request, ps
 	}
 	logTags["flow_run_record_id"] = aggFlowRunRecord.ID.String()
 
-	err = event.PubEvent(&event.FlowToRun{FlowRunRecordID: aggFlowRunRecord.ID})
+	skippedReason, err := pubFlowToRunOrSkip(logTags, &flowIns, aggFlowRunRecord.ID)
 	if err != nil {
 		fService.Logger.Errorf(logTags, "pub event failed: %v", err)
 		web.WriteInternalServerErrorResp(&w, r, err, "pub event failed")
@@ -225,6 +281,9 @@ func RunByTriggerKeyWithParamOverride(w http.ResponseWriter, r *http.Request, ps
 	resp := triggerRunRespStruct{
 		FlowRunRecordID: aggFlowRunRecord.ID,
 	}
+	if skippedReason != "" {
+		resp.Msg = "skipped: " + skippedReason
+	}
 	web.WriteSucResp(&w, r, resp)
 }
 
@@ -269,6 +328,13 @@ func Run(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		return
 	}
 
+	params, err := resolveRunParams(r, flowIns)
+	if err != nil {
+		fService.Logger.Warningf(logTags, "params not valid: %v", err)
+		web.WriteBadRequestDataResp(&w, r, err.Error())
+		return
+	}
+
 	// create new run record
 	aggFlowRunRecord, err := aggregate.NewUserTriggeredFlowRunRecord(r.Context(), flowIns, reqUser)
 	if err != nil {
@@ -277,6 +343,108 @@ func Run(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		web.WriteInternalServerErrorResp(&w, r, err, "build aggregate flow failed")
 		return
 	}
+	aggFlowRunRecord.Params = params
+
+	err = fService.FlowRunRecord.Create(aggFlowRunRecord)
+	if err != nil {
+		fService.Logger.Errorf(
+			logTags, "persist flow_run_record failed: %v", err)
+		web.WriteInternalServerErrorResp(
+			&w, r, err, "create flow run record to repository failed")
+		return
+	}
+	logTags["flow_run_record_id"] = aggFlowRunRecord.ID.String()
+
+	skippedReason, err := pubFlowToRunOrSkip(logTags, flowIns, aggFlowRunRecord.ID)
+	if err != nil {
+		fService.Logger.Errorf(logTags, "pub event failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "pub event failed")
+		return
+	}
+
+	fService.Logger.Infof(logTags, "finished")
+	resp := triggerRunRespStruct{
+		FlowRunRecordID: aggFlowRunRecord.ID,
+	}
+	if skippedReason != "" {
+		resp.Msg = "skipped: " + skippedReason
+	}
+	web.WriteSucResp(&w, r, resp)
+}
+
+// RerunFromFailure 从失败处重新运行某次失败的运行记录
+// 新的运行记录沿用原运行中成功节点的结果，只运行失败的及未运行的节点
+func RerunFromFailure(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	logTags := web.GetTraceAboutFields(r.Context())
+	logTags["business"] = "rerun flow from failure"
+	fService.Logger.Infof(logTags, "start")
+
+	reqUser, suc := web.GetReqUserFromContext(r.Context())
+	if !suc {
+		fService.Logger.Errorf(logTags, "failed to get user from context which should be setted by middleware!")
+		web.WriteInternalServerErrorResp(&w, r, nil, "get requser from context failed")
+		return
+	}
+	logTags["user_name"] = reqUser.Name
+
+	flowRunRecordIDStr := ps.ByName("flow_run_record_id")
+	if flowRunRecordIDStr == "" {
+		fService.Logger.Infof(logTags, "lack flow_run_record_id in url path")
+		web.WriteBadRequestDataResp(&w, r, "flow_run_record_id cannot be nil")
+		return
+	}
+	logTags["rerun_from_record_id"] = flowRunRecordIDStr
+	flowRunRecordID, err := value_object.ParseToUUID(flowRunRecordIDStr)
+	if err != nil {
+		fService.Logger.Infof(logTags, "parse flow_run_record_id to uuid failed: %v", err)
+		web.WriteBadRequestDataResp(&w, r, "flow_run_record_id not valid uuid")
+		return
+	}
+
+	failedRecord, err := fService.FlowRunRecord.GetByID(flowRunRecordID)
+	if err != nil {
+		fService.Logger.Errorf(logTags, "get flow_run_record by id error: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "visit flow_run_record by id failed")
+		return
+	}
+	if failedRecord.IsZero() {
+		fService.Logger.Warningf(logTags, "get flow_run_record by id match no record")
+		web.WriteBadRequestDataResp(&w, r, "flow_run_record_id find no record")
+		return
+	}
+	if !failedRecord.CanRerunFromFailure() {
+		fService.Logger.Warningf(logTags, "flow_run_record is not finished with failure")
+		web.WriteBadRequestDataResp(&w, r, "only finished and not suc flow_run_record can rerun from failure")
+		return
+	}
+
+	// 需使用原运行记录对应版本的flow，以保证节点能够对应上
+	flowIns, err := fService.Flow.GetByID(failedRecord.FlowID)
+	if err != nil {
+		fService.Logger.Errorf(logTags, "get flow by id error: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "visit flow by id failed")
+		return
+	}
+	if flowIns.IsZero() {
+		fService.Logger.Warningf(logTags, "get flow by id match no record")
+		web.WriteBadRequestDataResp(&w, r, "flow of the flow_run_record not exist")
+		return
+	}
+
+	// 检查用户是否有执行权限
+	if !flowIns.UserCanExecute(reqUser) {
+		fService.Logger.Warningf(logTags, "user lack execute permission")
+		web.WritePermissionNotEnough(&w, r, "need execute permission")
+		return
+	}
+
+	aggFlowRunRecord, err := aggregate.NewRerunFlowRunRecord(r.Context(), flowIns, failedRecord, reqUser)
+	if err != nil {
+		fService.Logger.Errorf(
+			logTags, "create aggregate flow_run_record failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "build aggregate flow_run_record failed")
+		return
+	}
 
 	err = fService.FlowRunRecord.Create(aggFlowRunRecord)
 	if err != nil {
@@ -358,8 +526,148 @@ func CancelRun(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 			web.WriteInternalServerErrorResp(&w, r, err, "cancel record failed")
 			return
 		}
+		event.PubFlowRunFinished(fService.Logger, logTags, i.ID)
+
+		// 由此运行记录中的子flow节点触发的子flow也一并取消
+		err = cancelSubFlowRuns(logTags, i.ID, reqUser.ID)
+		if err != nil {
+			fService.Logger.Errorf(logTags,
+				"cancel sub flow runs of flow_run_record(id:%s) failed: %v", i.ID.String(), err)
+			web.WriteInternalServerErrorResp(&w, r, err, "cancel sub flow record failed")
+			return
+		}
 	}
 
 	fService.Logger.Infof(logTags, "finished cancel %d task", len(aggFRRs))
 	web.WritePlainSucOkResp(&w, r)
 }
+
+// cancelSubFlowRuns 递归取消由某次运行中的子flow节点触发的、还未结束的子flow运行
+func cancelSubFlowRuns(
+	logTags map[string]string,
+	parentFlowRunRecordID, userID value_object.UUID,
+) error {
+	notFinishedStatus := make([]interface{}, 0, len(value_object.NotFinishedRunStatus()))
+	for _, i := range value_object.NotFinishedRunStatus() {
+		notFinishedStatus = append(notFinishedStatus, i)
+	}
+	subFlowRuns, err := fService.FlowRunRecord.Filter(
+		*value_object.NewRepositoryFilter().
+			AddEqual("arrangement_task_id", parentFlowRunRecordID.String()).
+			AddIn("status", notFinishedStatus),
+		*value_object.NewRepositoryFilterOption())
+	if err != nil {
+		return err
+	}
+	for _, i := range subFlowRuns {
+		err := fService.FlowRunRecord.UserCancel(i.ID, userID)
+		if err != nil {
+			return err
+		}
+		event.PubFlowRunFinished(fService.Logger, logTags, i.ID)
+		err = cancelSubFlowRuns(logTags, i.ID, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pubFlowToRunOrSkip 发布flow运行记录去运行；flow暂停或处于禁止运行时段时，
+// 将运行记录标记为跳过(保留在运行历史中)并返回跳过的原因
+func pubFlowToRunOrSkip(
+	logTags map[string]string,
+	flowIns *aggregate.Flow,
+	flowRunRecordID value_object.UUID,
+) (skippedReason string, err error) {
+	skippedReason = flowIns.RunBlockedReason(time.Now(), fService.GlobalBlackoutWindows)
+	if skippedReason == "" {
+		return "", event.PubEvent(&event.FlowToRun{FlowRunRecordID: flowRunRecordID})
+	}
+
+	fService.Logger.Infof(logTags, "skip run: %s", skippedReason)
+	err = fService.FlowRunRecord.ScheduleSkipped(flowRunRecordID, skippedReason)
+	if err != nil {
+		return "", err
+	}
+	event.PubFlowRunFinished(fService.Logger, logTags, flowRunRecordID)
+	return skippedReason, nil
+}
+
+type runQueueRespStruct struct {
+	MaxConcurrentRuns   int                              `json:"max_concurrent_runs"` // 0表示不限制
+	RunConflictStrategy value_object.RunConflictStrategy `json:"run_conflict_strategy"`
+	RunningAmount       int64                            `json:"running_amount"`
+	QueueDepth          int                              `json:"queue_depth"`
+	QueuedRecordIDs     []value_object.UUID              `json:"queued_flow_run_record_ids"` // 按排队先后排序
+}
+
+// RunQueue 查看flow当前的运行数与排队情况
+func RunQueue(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	logTags := web.GetTraceAboutFields(r.Context())
+	logTags["business"] = "get flow run queue"
+
+	reqUser, suc := web.GetReqUserFromContext(r.Context())
+	if !suc {
+		fService.Logger.Errorf(logTags, "failed to get user from context which should be setted by middleware!")
+		web.WriteInternalServerErrorResp(&w, r, nil, "get requser from context failed")
+		return
+	}
+
+	flowOriginID := ps.ByName("origin_id")
+	if flowOriginID == "" {
+		web.WriteBadRequestDataResp(&w, r, "origin_id cannot be nil")
+		return
+	}
+	logTags["origin_id"] = flowOriginID
+
+	flowIns, err := fService.Flow.GetOnlineByOriginIDStr(flowOriginID)
+	if err != nil {
+		fService.Logger.Errorf(logTags, "get flow by origin_id error: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "visit flow by origin_id failed")
+		return
+	}
+	if flowIns.IsZero() {
+		web.WriteBadRequestDataResp(&w, r, "origin_id find no flow")
+		return
+	}
+	if !flowIns.UserCanRead(reqUser) {
+		web.WritePermissionNotEnough(&w, r, "need read permission")
+		return
+	}
+
+	runningAmount, err := fService.FlowRunRecord.Count(
+		*value_object.NewRepositoryFilter().
+			AddEqual("flow_origin_id", flowIns.OriginID).
+			AddEqual("status", value_object.Running))
+	if err != nil {
+		fService.Logger.Errorf(logTags, "count running flow_run_record failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "count running flow_run_record failed")
+		return
+	}
+
+	filterOption := value_object.NewRepositoryFilterOption()
+	filterOption.SetAsc()
+	queued, err := fService.FlowRunRecord.Filter(
+		*value_object.NewRepositoryFilter().
+			AddEqual("flow_origin_id", flowIns.OriginID).
+			AddEqual("status", value_object.InQueue),
+		*filterOption)
+	if err != nil {
+		fService.Logger.Errorf(logTags, "filter in queue flow_run_record failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "filter in queue flow_run_record failed")
+		return
+	}
+
+	resp := runQueueRespStruct{
+		MaxConcurrentRuns:   flowIns.ConcurrencyLimit(),
+		RunConflictStrategy: flowIns.ConflictStrategy(),
+		RunningAmount:       runningAmount,
+		QueueDepth:          len(queued),
+		QueuedRecordIDs:     make([]value_object.UUID, 0, len(queued)),
+	}
+	for _, i := range queued {
+		resp.QueuedRecordIDs = append(resp.QueuedRecordIDs, i.ID)
+	}
+	web.WriteSucResp(&w, r, resp)
+}
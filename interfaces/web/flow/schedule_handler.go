@@ -0,0 +1,199 @@
+package flow
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/interfaces/web"
+	"github.com/fBloc/bloc-server/internal/crontab"
+	"github.com/fBloc/bloc-server/internal/timestamp"
+	"github.com/fBloc/bloc-server/value_object"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type nextFireTimesRespStruct struct {
+	Crontab       string                 `json:"crontab"`
+	NextFireTimes []*timestamp.Timestamp `json:"next_fire_times"`
+}
+
+// NextFireTimes 预览crontab接下来的计划时间。
+// 通过query参数crontab指定表达式，或通过origin_id使用某个flow当前的crontab配置
+func NextFireTimes(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	logTags := web.GetTraceAboutFields(r.Context())
+	logTags["business"] = "preview crontab next fire times"
+
+	reqUser, suc := web.GetReqUserFromContext(r.Context())
+	if !suc {
+		fService.Logger.Errorf(logTags, "failed to get user from context which should be setted by middleware!")
+		web.WriteInternalServerErrorResp(&w, r, nil, "get requser from context failed")
+		return
+	}
+
+	amount := config.CrontabPreviewDefaultAmount
+	if amountStr := r.URL.Query().Get("amount"); amountStr != "" {
+		var err error
+		amount, err = strconv.Atoi(amountStr)
+		if err != nil || amount <= 0 || amount > config.CrontabPreviewMaxAmount {
+			web.WriteBadRequestDataResp(&w, r,
+				"amount must be int between 1 and %d", config.CrontabPreviewMaxAmount)
+			return
+		}
+	}
+
+	var cr *crontab.CrontabRepresent
+	if crontabStr := r.URL.Query().Get("crontab"); crontabStr != "" {
+		cr = crontab.BuildCrontab(crontabStr)
+		if cr == nil {
+			web.WriteBadRequestDataResp(&w, r, "crontab str not valid: %s", crontabStr)
+			return
+		}
+	} else if flowOriginID := r.URL.Query().Get("origin_id"); flowOriginID != "" {
+		logTags["origin_id"] = flowOriginID
+		flowIns, err := fService.Flow.GetOnlineByOriginIDStr(flowOriginID)
+		if err != nil {
+			fService.Logger.Errorf(logTags, "get flow by origin_id error: %v", err)
+			web.WriteInternalServerErrorResp(&w, r, err, "visit flow by origin_id failed")
+			return
+		}
+		if flowIns.IsZero() {
+			web.WriteBadRequestDataResp(&w, r, "origin_id find no flow")
+			return
+		}
+		if !flowIns.UserCanRead(reqUser) {
+			web.WritePermissionNotEnough(&w, r, "need read permission")
+			return
+		}
+		if !flowIns.Crontab.IsValid() {
+			web.WriteBadRequestDataResp(&w, r, "flow have no valid crontab")
+			return
+		}
+		cr = flowIns.Crontab
+	} else {
+		web.WriteBadRequestDataResp(&w, r, "must have query param crontab or origin_id")
+		return
+	}
+
+	resp := nextFireTimesRespStruct{
+		Crontab:       cr.String(),
+		NextFireTimes: make([]*timestamp.Timestamp, 0, amount)}
+	for _, fireTime := range cr.NextN(time.Now(), amount) {
+		resp.NextFireTimes = append(resp.NextFireTimes, timestamp.NewTimeStampFromTime(fireTime))
+	}
+	web.WriteSucResp(&w, r, resp)
+}
+
+type calendarFlow struct {
+	FlowID       value_object.UUID      `json:"flow_id"`
+	FlowOriginID value_object.UUID      `json:"flow_origin_id"`
+	Name         string                 `json:"name"`
+	Crontab      string                 `json:"crontab"`
+	FireAmount   int                    `json:"fire_amount"`
+	FireTimes    []*timestamp.Timestamp `json:"fire_times"` // 最多列出CrontabCalendarMaxTimesPerFlow个
+}
+
+type calendarHour struct {
+	Hour       *timestamp.Timestamp `json:"hour"`
+	FireAmount int                  `json:"fire_amount"`
+}
+
+type calendarRespStruct struct {
+	Start  *timestamp.Timestamp `json:"start"`
+	End    *timestamp.Timestamp `json:"end"`
+	Flows  []calendarFlow       `json:"flows"`
+	Hourly []calendarHour       `json:"hourly"` // 按小时统计的计划运行数，用于发现运行过于集中的时段
+}
+
+// ScheduleCalendar 列出[start, end)时间窗内全部配置了crontab的flow的计划时间。
+// start、end为RFC3339格式，start默认为当前时间，end默认为start之后的CrontabCalendarDefaultWindow
+func ScheduleCalendar(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	logTags := web.GetTraceAboutFields(r.Context())
+	logTags["business"] = "crontab schedule calendar"
+
+	reqUser, suc := web.GetReqUserFromContext(r.Context())
+	if !suc {
+		fService.Logger.Errorf(logTags, "failed to get user from context which should be setted by middleware!")
+		web.WriteInternalServerErrorResp(&w, r, nil, "get requser from context failed")
+		return
+	}
+
+	start := time.Now()
+	if startStr := r.URL.Query().Get("start"); startStr != "" {
+		var err error
+		start, err = time.Parse(time.RFC3339, startStr)
+		if err != nil {
+			web.WriteBadRequestDataResp(&w, r, "start must be RFC3339 format: %s", startStr)
+			return
+		}
+	}
+	end := start.Add(config.CrontabCalendarDefaultWindow)
+	if endStr := r.URL.Query().Get("end"); endStr != "" {
+		var err error
+		end, err = time.Parse(time.RFC3339, endStr)
+		if err != nil {
+			web.WriteBadRequestDataResp(&w, r, "end must be RFC3339 format: %s", endStr)
+			return
+		}
+	}
+	if !end.After(start) || end.Sub(start) > config.CrontabCalendarMaxWindow {
+		web.WriteBadRequestDataResp(&w, r,
+			"end must after start and the window cannot exceed %s", config.CrontabCalendarMaxWindow)
+		return
+	}
+
+	crontabFlows, err := fService.Flow.FilterCrontabFlows()
+	if err != nil {
+		fService.Logger.Errorf(logTags, "filter crontab flows failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "filter crontab flows failed")
+		return
+	}
+
+	resp := calendarRespStruct{
+		Start: timestamp.NewTimeStampFromTime(start),
+		End:   timestamp.NewTimeStampFromTime(end),
+		Flows: make([]calendarFlow, 0, len(crontabFlows)),
+	}
+	hourMapAmount := make(map[time.Time]int)
+	for _, flowIns := range crontabFlows {
+		if !flowIns.UserCanRead(reqUser) {
+			continue
+		}
+		cFlow := calendarFlow{
+			FlowID:       flowIns.ID,
+			FlowOriginID: flowIns.OriginID,
+			Name:         flowIns.Name,
+			Crontab:      flowIns.Crontab.String(),
+			FireTimes:    make([]*timestamp.Timestamp, 0),
+		}
+		// 从start前一刻开始计算，使恰好在start的计划时间也被包含
+		next := flowIns.Crontab.Next(start.Add(-time.Nanosecond))
+		for !next.IsZero() && next.Before(end) {
+			cFlow.FireAmount++
+			if len(cFlow.FireTimes) < config.CrontabCalendarMaxTimesPerFlow {
+				cFlow.FireTimes = append(cFlow.FireTimes, timestamp.NewTimeStampFromTime(next))
+			}
+			// 按服务器本地时区的整点统计
+			localNext := next.Local()
+			hourMapAmount[time.Date(
+				localNext.Year(), localNext.Month(), localNext.Day(),
+				localNext.Hour(), 0, 0, 0, time.Local)]++
+			next = flowIns.Crontab.Next(next)
+		}
+		if cFlow.FireAmount > 0 {
+			resp.Flows = append(resp.Flows, cFlow)
+		}
+	}
+
+	resp.Hourly = make([]calendarHour, 0, len(hourMapAmount))
+	for hour, amount := range hourMapAmount {
+		resp.Hourly = append(resp.Hourly, calendarHour{
+			Hour: timestamp.NewTimeStampFromTime(hour), FireAmount: amount})
+	}
+	sort.Slice(resp.Hourly, func(i, j int) bool {
+		return resp.Hourly[i].Hour.ToTime().Before(resp.Hourly[j].Hour.ToTime())
+	})
+	web.WriteSucResp(&w, r, resp)
+}
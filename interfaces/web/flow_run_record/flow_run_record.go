@@ -20,6 +20,8 @@ type FlowFunctionRecord struct {
 	ArrangementID                value_object.UUID                    `json:"arrangement_id,omitempty"`
 	ArrangementFlowID            string                               `json:"arrangement_flow_id,omitempty"`
 	ArrangementRunRecordID       string                               `json:"arrangement_run_record_id,omitempty"`
+	RerunFromRecordID            value_object.UUID                    `json:"rerun_from_record_id,omitempty"`
+	UpstreamFlowRunRecordID      value_object.UUID                    `json:"upstream_flow_run_record_id,omitempty"`
 	FlowID                       value_object.UUID                    `json:"flow_id"`
 	FlowOriginID                 value_object.UUID                    `json:"flow_origin_id"`
 	FlowVersion                  uint                                 `json:"flow_version"`
@@ -38,6 +40,7 @@ type FlowFunctionRecord struct {
 	Canceled                     bool                                 `json:"canceled"`
 	CancelUserName               string                               `json:"cancel_user_name"`
 	TraceID                      string                               `json:"trace_id"`
+	Params                       map[string]interface{}               `json:"params,omitempty"`
 }
 
 func fromAgg(
@@ -51,6 +54,8 @@ func fromAgg(
 		ArrangementID:                value_object.UUID(aggFRR.ArrangementID),
 		ArrangementFlowID:            aggFRR.ArrangementFlowID,
 		ArrangementRunRecordID:       aggFRR.ArrangementRunRecordID,
+		RerunFromRecordID:            aggFRR.RerunFromRecordID,
+		UpstreamFlowRunRecordID:      aggFRR.UpstreamFlowRunRecordID,
 		FlowID:                       aggFRR.FlowID,
 		FlowOriginID:                 aggFRR.FlowOriginID,
 		FlowVersion:                  aggFRR.FlowVersion,
@@ -64,6 +69,7 @@ func fromAgg(
 		TimeoutCanceled:              aggFRR.TimeoutCanceled,
 		Canceled:                     aggFRR.Canceled,
 		TraceID:                      aggFRR.TraceID,
+		Params:                       aggFRR.Params,
 		TriggerTime:                  timestamp.NewTimeStampFromTime(aggFRR.TriggerTime),
 		StartTime:                    timestamp.NewTimeStampFromTime(aggFRR.StartTime),
 		EndTime:                      timestamp.NewTimeStampFromTime(aggFRR.EndTime),
@@ -24,11 +24,15 @@ import (
 1. flow_origin_id: 以flow的origin_id作为查找依据，返回的就是此flow的[无论此记录是直接运行/flow配置的运行/arrangement的运行都会出现]（不过可能包含老版本flow的运行历史）
 2. arrangement_flow_id： 此返回的是特定arrangement下的此flow的运行记录，应该只在arrangement作为入口查看历史的时候才会用得到
 3. flow_id： 以flow的id作为参数，表示获取特定版本的flow的运行历史
+4. rerun_from_record_id: 获取从某次失败的运行记录处重新运行产生的运行记录
+5. upstream_flow_run_record_id: 获取某次运行结束后依赖触发的下游flow的运行记录
 */
 
 type FlowFunctionRecordFilter struct {
 	FlowIDStr       string                `mapstructure:"flow_id"`
 	FlowOriginIDStr string                `mapstructure:"flow_origin_id"`
+	RerunFromIDStr  string                `mapstructure:"rerun_from_record_id"`
+	UpstreamIDStr   string                `mapstructure:"upstream_flow_run_record_id"`
 	TriggerTime     time.Time             `mapstructure:"trigger_time"`
 	StartTime       time.Time             `mapstructure:"start_time"`
 	EndTime         time.Time             `mapstructure:"end_time"`
@@ -116,6 +120,30 @@ func BuildFromWebRequestParams(
 		filterInGetPath.AddToRepositoryFilter(filter, "flow_origin_id", originUUID)
 	}
 
+	if fFRR.RerunFromIDStr != "" {
+		filterInGetPath := filterKeyMapFilterInGetPath["rerun_from_record_id"]
+		if filterInGetPath != web.FilterInGetPathEq {
+			return nil, nil, errors.New("rerun_from_record_id only suport equal search")
+		}
+		rerunFromUUID, err := value_object.ParseToUUID(fFRR.RerunFromIDStr)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse rerun_from_record_id to uuid failed")
+		}
+		filterInGetPath.AddToRepositoryFilter(filter, "rerun_from_record_id", rerunFromUUID)
+	}
+
+	if fFRR.UpstreamIDStr != "" {
+		filterInGetPath := filterKeyMapFilterInGetPath["upstream_flow_run_record_id"]
+		if filterInGetPath != web.FilterInGetPathEq {
+			return nil, nil, errors.New("upstream_flow_run_record_id only suport equal search")
+		}
+		upstreamUUID, err := value_object.ParseToUUID(fFRR.UpstreamIDStr)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse upstream_flow_run_record_id to uuid failed")
+		}
+		filterInGetPath.AddToRepositoryFilter(filter, "upstream_flow_run_record_id", upstreamUUID)
+	}
+
 	if !fFRR.TriggerTime.IsZero() {
 		filterInGetPath := filterKeyMapFilterInGetPath["trigger_time"]
 		filterInGetPath.AddToRepositoryFilter(filter, "trigger_time", fFRR.TriggerTime)
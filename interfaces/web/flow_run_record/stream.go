@@ -0,0 +1,181 @@
+package flow_run_record
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/interfaces/web"
+	"github.com/fBloc/bloc-server/internal/event_bus"
+	"github.com/fBloc/bloc-server/value_object"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+var runStatusBus *event_bus.Bus
+
+func InjectRunStatusBus(b *event_bus.Bus) {
+	runStatusBus = b
+}
+
+// RunStatusChangedConsumer 监听运行状态变化事件，经由事件总线分发给本进程内的各个推送连接
+// 每个http服务进程都需要收到全部的事件，故以只属于本进程的广播方式监听
+func RunStatusChangedConsumer() {
+	runStatusChangedEventChan := make(chan event.DomainEvent)
+	err := event.ListenBroadcastEvent(
+		&event.RunStatusChanged{}, runStatusChangedEventChan)
+	if err != nil {
+		panic(err)
+	}
+
+	for runStatusChangedEvent := range runStatusChangedEventChan {
+		evt, ok := runStatusChangedEvent.(*event.RunStatusChanged)
+		if !ok {
+			continue
+		}
+		runStatusBus.Publish(evt)
+	}
+}
+
+func writeSSEEvent(w http.ResponseWriter, evt *event.RunStatusChanged) error {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", evt.Kind, data)
+	return err
+}
+
+// streamRunStatus 以SSE推送订阅到的运行状态变化，直到客户端断开/until返回true
+func streamRunStatus(
+	w http.ResponseWriter, r *http.Request,
+	logTags map[string]string,
+	events <-chan *event.RunStatusChanged,
+	snapshot *event.RunStatusChanged,
+	until func(*event.RunStatusChanged) bool,
+) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		fFRService.Logger.Errorf(logTags, "response writer not support flush")
+		web.WriteInternalServerErrorResp(&w, r, nil, "streaming not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	write := func(evt *event.RunStatusChanged) bool {
+		err := writeSSEEvent(w, evt)
+		if err != nil {
+			fFRService.Logger.Warningf(logTags, "write event failed: %v", err)
+			return false
+		}
+		flusher.Flush()
+		return !until(evt)
+	}
+	if snapshot != nil && !write(snapshot) {
+		return
+	}
+
+	heartbeat := time.NewTicker(config.RunStatusStreamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			fFRService.Logger.Infof(logTags, "client closed")
+			return
+		case <-heartbeat.C:
+			_, err := fmt.Fprint(w, ": heartbeat\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case evt, ok := <-events:
+			if !ok { // 消费过慢被移除，由客户端重新连接
+				fFRService.Logger.Warningf(logTags, "removed from run status bus")
+				return
+			}
+			if !write(evt) {
+				fFRService.Logger.Infof(logTags, "finished")
+				return
+			}
+		}
+	}
+}
+
+// StreamByID 推送某次flow运行及其中各节点的状态变化，flow运行结束后断开
+func StreamByID(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	logTags := web.GetTraceAboutFields(r.Context())
+	logTags["business"] = "stream flow_run_record's run status"
+
+	flowRunRecordIDStr := ps.ByName("id")
+	flowRunRecordUUID, err := value_object.ParseToUUID(flowRunRecordIDStr)
+	if err != nil {
+		fFRService.Logger.Warningf(logTags,
+			"parse flow_run_record_id to uuid failed: %v", err)
+		web.WriteBadRequestDataResp(&w, r, "parse id to uuid failed: %s", err.Error())
+		return
+	}
+	logTags["flow_run_record_id"] = flowRunRecordIDStr
+
+	// 先订阅再获取当前状态，避免两者之间的变化被遗漏
+	events, cancel := runStatusBus.Subscribe(func(evt *event.RunStatusChanged) bool {
+		return evt.FlowRunRecordID == flowRunRecordUUID
+	})
+	defer cancel()
+
+	flowRunRecordIns, err := fFRService.FlowRunRecord.GetByID(flowRunRecordUUID)
+	if err != nil {
+		fFRService.Logger.Errorf(logTags, "get flow_run_record by id failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "visit repository failed")
+		return
+	}
+	if flowRunRecordIns.IsZero() {
+		fFRService.Logger.Warningf(logTags, "find no flow_run_record by this id")
+		web.WriteBadRequestDataResp(&w, r, "find no flow_run_record by this id")
+		return
+	}
+
+	snapshot := &event.RunStatusChanged{
+		Kind:            event.FlowRunStatusChange,
+		FlowID:          flowRunRecordIns.FlowID,
+		FlowOriginID:    flowRunRecordIns.FlowOriginID,
+		FlowRunRecordID: flowRunRecordIns.ID,
+		Status:          flowRunRecordIns.Status,
+		ErrorMsg:        flowRunRecordIns.ErrorMsg,
+		Time:            time.Now(),
+	}
+	fFRService.Logger.Infof(logTags, "start streaming")
+	streamRunStatus(w, r, logTags, events, snapshot,
+		func(evt *event.RunStatusChanged) bool { return evt.IsFlowRunFinished() })
+}
+
+// StreamByFlowOriginID 推送某个flow（含其各个版本）下全部运行的状态变化，直到客户端断开
+func StreamByFlowOriginID(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	logTags := web.GetTraceAboutFields(r.Context())
+	logTags["business"] = "stream flow's run status"
+
+	flowOriginIDStr := ps.ByName("flow_origin_id")
+	flowOriginUUID, err := value_object.ParseToUUID(flowOriginIDStr)
+	if err != nil {
+		fFRService.Logger.Warningf(logTags,
+			"parse flow_origin_id to uuid failed: %v", err)
+		web.WriteBadRequestDataResp(&w, r, "parse flow_origin_id to uuid failed: %s", err.Error())
+		return
+	}
+	logTags["flow_origin_id"] = flowOriginIDStr
+
+	events, cancel := runStatusBus.Subscribe(func(evt *event.RunStatusChanged) bool {
+		return evt.FlowOriginID == flowOriginUUID
+	})
+	defer cancel()
+
+	fFRService.Logger.Infof(logTags, "start streaming")
+	streamRunStatus(w, r, logTags, events, nil,
+		func(*event.RunStatusChanged) bool { return false })
+}
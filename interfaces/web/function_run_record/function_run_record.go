@@ -38,6 +38,15 @@ type Progress struct {
 	IsFinished             bool              `json:"is_finished"`
 }
 
+// Attempt 节点的一次运行
+type Attempt struct {
+	Start     *timestamp.Timestamp `json:"start"`
+	End       *timestamp.Timestamp `json:"end"`
+	Suc       bool                 `json:"suc"`
+	ErrorMsg  string               `json:"error_msg"`
+	Retryable bool                 `json:"retryable"`
+}
+
 type FunctionRunRecord struct {
 	ID                          value_object.UUID      `json:"id"`
 	FlowID                      value_object.UUID      `json:"flow_id"`
@@ -51,7 +60,9 @@ type FunctionRunRecord struct {
 	End                         *timestamp.Timestamp   `json:"end"`
 	Suc                         bool                   `json:"suc"`
 	InterceptBelowFunctionRun   bool                   `json:"intercept_below_function_run"`
+	SkippedDownstreams          []string               `json:"skipped_downstream_flowfunction_ids"`
 	Canceled                    bool                   `json:"canceled"`
+	TimeoutCanceled             bool                   `json:"timeout_canceled"`
 	Description                 string                 `json:"description"`
 	ErrorMsg                    string                 `json:"error_msg"`
 	IptBriefAndObjectStoragekey [][]briefAndKey        `json:"ipt"`
@@ -63,6 +74,12 @@ type FunctionRunRecord struct {
 	ProgressMsg                 []string               `json:"progress_msg"`
 	ProgressMilestones          []string               `json:"progress_milestones"`
 	ProgressMilestoneIndex      *int                   `json:"progress_milestone_index"`
+	MapParentID                 *value_object.UUID     `json:"map_parent_id,omitempty"`
+	MapIndex                    *int                   `json:"map_index,omitempty"`
+	MapChildren                 []*FunctionRunRecord   `json:"map_children,omitempty"`
+	Attempts                    []Attempt              `json:"attempts"`
+	WaitingApproval             bool                   `json:"waiting_approval"`
+	ApprovalUserID              *value_object.UUID     `json:"approval_user_id,omitempty"`
 }
 
 func fromAggToProgress(
@@ -118,7 +135,9 @@ func fromAgg(
 		FlowRunRecordID:             aggFRR.FlowRunRecordID,
 		Suc:                         aggFRR.Suc,
 		InterceptBelowFunctionRun:   aggFRR.InterceptBelowFunctionRun,
+		SkippedDownstreams:          aggFRR.SkippedDownstreamFlowFunctionIDs,
 		Canceled:                    aggFRR.Canceled,
+		TimeoutCanceled:             aggFRR.TimeoutCanceled,
 		Description:                 aggFRR.Description,
 		ErrorMsg:                    aggFRR.ErrorMsg,
 		IptBriefAndObjectStoragekey: ipt,
@@ -133,10 +152,47 @@ func fromAgg(
 		Start:                       timestamp.NewTimeStampFromTime(aggFRR.Start),
 		ShouldBeCanceledAt:          timestamp.NewTimeStampFromTime(aggFRR.ShouldBeCanceledAt),
 		End:                         timestamp.NewTimeStampFromTime(aggFRR.End),
+		WaitingApproval:             aggFRR.IsWaitingApproval(),
+	}
+	if !aggFRR.ApprovalUserID.IsNil() {
+		approvalUserID := aggFRR.ApprovalUserID
+		retFlow.ApprovalUserID = &approvalUserID
+	}
+	retFlow.Attempts = make([]Attempt, 0, len(aggFRR.Attempts))
+	for _, attempt := range aggFRR.Attempts {
+		retFlow.Attempts = append(retFlow.Attempts, Attempt{
+			Start:     timestamp.NewTimeStampFromTime(attempt.Start),
+			End:       timestamp.NewTimeStampFromTime(attempt.End),
+			Suc:       attempt.Suc,
+			ErrorMsg:  attempt.ErrorMsg,
+			Retryable: attempt.Retryable,
+		})
+	}
+	if aggFRR.IsMapChild() {
+		mapParentID, mapIndex := aggFRR.MapParentID, aggFRR.MapIndex
+		retFlow.MapParentID = &mapParentID
+		retFlow.MapIndex = &mapIndex
 	}
 	return retFlow
 }
 
+// groupMapChildren 将map模式的子记录归到对应的父记录下
+func groupMapChildren(
+	parents []*FunctionRunRecord, aggChildren []*aggregate.FunctionRunRecord,
+) {
+	idMapParent := make(map[value_object.UUID]*FunctionRunRecord, len(parents))
+	for _, i := range parents {
+		idMapParent[i.ID] = i
+	}
+	for _, i := range aggChildren {
+		parent, ok := idMapParent[i.MapParentID]
+		if !ok {
+			continue
+		}
+		parent.MapChildren = append(parent.MapChildren, fromAgg(i))
+	}
+}
+
 func fromAggSlice(
 	aggFRRSlice []*aggregate.FunctionRunRecord,
 ) []*FunctionRunRecord {
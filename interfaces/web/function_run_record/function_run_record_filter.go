@@ -23,6 +23,7 @@ type FunctionRunRecordFilter struct {
 	Suc          bool      `mapstructure:"suc"`
 	Pass         bool      `mapstructure:"pass"`
 	Canceled     bool      `mapstructure:"canceled"`
+	MapParentID  string    `mapstructure:"map_parent_id"`
 }
 
 func BuildFromWebRequestParams(
@@ -141,5 +142,20 @@ func BuildFromWebRequestParams(
 		filterInGetPath.AddToRepositoryFilter(filter, "canceled", fRRF.Canceled)
 	}
 
+	// map模式的子记录默认不单独列出，而是归到其父记录下
+	if fRRF.MapParentID != "" {
+		filterInGetPath := filterKeyMapFilterInGetPath["map_parent_id"]
+		if filterInGetPath != web.FilterInGetPathEq {
+			return nil, nil, errors.New("map_parent_id only suport equal search")
+		}
+		mapParentUUID, err := value_object.ParseToUUID(fRRF.MapParentID)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse map_parent_id to uuid failed")
+		}
+		filterInGetPath.AddToRepositoryFilter(filter, "map_parent_id", mapParentUUID)
+	} else {
+		filter.AddNotExist("map_parent_id")
+	}
+
 	return filter, filterOp, nil
 }
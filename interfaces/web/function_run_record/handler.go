@@ -96,9 +96,26 @@ func Filter(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
+	items := fromAggSlice(aggFunctionRunRecords)
+	if _, ok := filter.GetEqual()["map_parent_id"]; !ok && len(items) > 0 { // 未指定map_parent_id时，把子记录归到父记录下
+		parentIDs := make([]interface{}, 0, len(items))
+		for _, i := range items {
+			parentIDs = append(parentIDs, i.ID)
+		}
+		aggChildren, err := fRRService.FunctionRunRecords.Filter(
+			*value_object.NewRepositoryFilter().AddIn("map_parent_id", parentIDs),
+			value_object.RepositoryFilterOption{Asc: true})
+		if err != nil {
+			fRRService.Logger.Errorf(logTags, "filter map children failed: %v", err)
+			web.WriteInternalServerErrorResp(&w, r, err, "visit repository failed")
+			return
+		}
+		groupMapChildren(items, aggChildren)
+	}
+
 	resp := FunctionRunRecordFilterResp{
 		Total: count,
-		Items: fromAggSlice(aggFunctionRunRecords),
+		Items: items,
 	}
 
 	fRRService.Logger.Infof(logTags, "finished with amount: %d", count)
@@ -0,0 +1,75 @@
+package notification_delivery
+
+import (
+	"net/http"
+
+	"github.com/fBloc/bloc-server/interfaces/web"
+	"github.com/fBloc/bloc-server/value_object"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func Get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	logTags := web.GetTraceAboutFields(r.Context())
+	logTags["business"] = "get notification_delivery"
+
+	id := ps.ByName("id")
+	if id == "" {
+		nService.Logger.Warningf(logTags, "miss id in url path")
+		web.WriteBadRequestDataResp(&w, r, "id cannot be null")
+		return
+	}
+	logTags["id"] = id
+
+	uuID, err := value_object.ParseToUUID(id)
+	if err != nil {
+		nService.Logger.Warningf(logTags, "parse id to uuid failed: %v", err)
+		web.WriteBadRequestDataResp(&w, r, "parse id to uuid failed")
+		return
+	}
+
+	aggND, err := nService.NotificationDeliveries.GetByID(uuID)
+	if err != nil {
+		nService.Logger.Errorf(logTags, "get by id failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "visit repository failed")
+		return
+	}
+
+	nService.Logger.Infof(logTags, "finished")
+	web.WriteSucResp(&w, r, fromAgg(aggND))
+}
+
+func Filter(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	logTags := web.GetTraceAboutFields(r.Context())
+	logTags["business"] = "filter notification_delivery"
+
+	filter, filterOption, err := BuildFromWebRequestParams(r.URL.Query())
+	if err != nil {
+		nService.Logger.Warningf(
+			logTags, "parse filter options from get param failed: %v", err)
+		web.WriteBadRequestDataResp(&w, r, err.Error())
+		return
+	}
+
+	deliveries, err := nService.NotificationDeliveries.Filter(*filter, *filterOption)
+	if err != nil {
+		nService.Logger.Errorf(logTags, "filter failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "visit repository failed")
+		return
+	}
+
+	count, err := nService.NotificationDeliveries.Count(*filter)
+	if err != nil {
+		nService.Logger.Errorf(logTags, "get count failed: %v", err)
+		web.WriteInternalServerErrorResp(&w, r, err, "visit total failed")
+		return
+	}
+
+	resp := NotificationDeliveryFilterResp{
+		Total: count,
+		Items: fromAggSlice(deliveries),
+	}
+
+	nService.Logger.Infof(logTags, "finished with amount: %d", count)
+	web.WriteSucResp(&w, r, resp)
+}
@@ -0,0 +1,86 @@
+package notification_delivery
+
+import (
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/internal/timestamp"
+	"github.com/fBloc/bloc-server/services/notification"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+var nService *notification.NotificationService
+
+func InjectNotificationService(
+	n *notification.NotificationService,
+) {
+	nService = n
+}
+
+type Attempt struct {
+	Time     *timestamp.Timestamp `json:"time"`
+	Suc      bool                 `json:"suc"`
+	ErrorMsg string               `json:"error_msg"`
+}
+
+// NotificationDelivery 不返回签名用的secret
+type NotificationDelivery struct {
+	ID              value_object.UUID            `json:"id"`
+	FlowID          value_object.UUID            `json:"flow_id"`
+	FlowOriginID    value_object.UUID            `json:"flow_origin_id"`
+	FlowRunRecordID value_object.UUID            `json:"flow_run_record_id"`
+	Triggers        []value_object.NotifyTrigger `json:"triggers"`
+	Channel         value_object.NotifyChannel   `json:"channel"`
+	Target          string                       `json:"target"`
+	CreateTime      *timestamp.Timestamp         `json:"create_time"`
+	FinishTime      *timestamp.Timestamp         `json:"finish_time"`
+	Finished        bool                         `json:"finished"`
+	Suc             bool                         `json:"suc"`
+	Attempts        []Attempt                    `json:"attempts"`
+}
+
+func fromAgg(
+	aggND *aggregate.NotificationDelivery,
+) *NotificationDelivery {
+	if aggND.IsZero() {
+		return nil
+	}
+	ret := &NotificationDelivery{
+		ID:              aggND.ID,
+		FlowID:          aggND.FlowID,
+		FlowOriginID:    aggND.FlowOriginID,
+		FlowRunRecordID: aggND.FlowRunRecordID,
+		Triggers:        aggND.Triggers,
+		Channel:         aggND.Channel,
+		Target:          aggND.Target,
+		CreateTime:      timestamp.NewTimeStampFromTime(aggND.CreateTime),
+		FinishTime:      timestamp.NewTimeStampFromTime(aggND.FinishTime),
+		Finished:        aggND.Finished(),
+		Suc:             aggND.Suc,
+		Attempts:        make([]Attempt, 0, len(aggND.Attempts)),
+	}
+	for _, attempt := range aggND.Attempts {
+		ret.Attempts = append(ret.Attempts, Attempt{
+			Time:     timestamp.NewTimeStampFromTime(attempt.Time),
+			Suc:      attempt.Suc,
+			ErrorMsg: attempt.ErrorMsg,
+		})
+	}
+	return ret
+}
+
+func fromAggSlice(
+	aggNDSlice []*aggregate.NotificationDelivery,
+) []*NotificationDelivery {
+	if len(aggNDSlice) <= 0 {
+		return []*NotificationDelivery{}
+	}
+	ret := make([]*NotificationDelivery, len(aggNDSlice))
+	for i, j := range aggNDSlice {
+		ret[i] = fromAgg(j)
+	}
+	return ret
+}
+
+type NotificationDeliveryFilterResp struct {
+	Total int64                   `json:"total"`
+	Items []*NotificationDelivery `json:"items"`
+}
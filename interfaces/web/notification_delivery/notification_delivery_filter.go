@@ -0,0 +1,126 @@
+package notification_delivery
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fBloc/bloc-server/interfaces/web"
+	"github.com/fBloc/bloc-server/internal/util"
+	"github.com/fBloc/bloc-server/value_object"
+
+	"github.com/pkg/errors"
+)
+
+/*
+常见使用场景：
+1. flow_run_record_id: 查看某次运行发出的通知
+2. flow_origin_id: 查看某个flow发出的通知（包含老版本flow的）
+3. suc=false & channel: 查看某个渠道投递失败的通知
+*/
+
+type NotificationDeliveryFilter struct {
+	FlowIDStr          string                     `mapstructure:"flow_id"`
+	FlowOriginIDStr    string                     `mapstructure:"flow_origin_id"`
+	FlowRunRecordIDStr string                     `mapstructure:"flow_run_record_id"`
+	Channel            value_object.NotifyChannel `mapstructure:"channel"`
+	CreateTime         time.Time                  `mapstructure:"create_time"`
+	Suc                bool                       `mapstructure:"suc"`
+}
+
+func BuildFromWebRequestParams(
+	query url.Values,
+) (*value_object.RepositoryFilter, *value_object.RepositoryFilterOption, error) {
+	filterInGetPathMapReqKeys, err := web.ParseReqQueryToGroupedFilters(query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filter := value_object.NewRepositoryFilter()
+	filterOp := value_object.NewRepositoryFilterOption()
+	filterKeyMapVal := make(map[string]interface{})
+	filterKeyMapFilterInGetPath := make(map[string]web.FilterInGetPath)
+	for filterInGetPath, reqKeys := range filterInGetPathMapReqKeys {
+		for _, key := range reqKeys {
+			var completeKey string
+			if strings.HasPrefix(filterInGetPath.String(), "__") {
+				completeKey = fmt.Sprintf("%s%s", key, filterInGetPath.String())
+			} else {
+				completeKey = key
+			}
+			val := query.Get(completeKey)
+			if filterInGetPath == web.FilterInGetPathLimit {
+				intVal, err := strconv.Atoi(val)
+				if err != nil {
+					return nil, nil, errors.New(
+						web.FilterInGetPathLimit.String() + " field value must be int")
+				}
+				filterOp.SetLimit(intVal)
+			} else if filterInGetPath == web.FilterInGetPathOffset {
+				intVal, err := strconv.Atoi(val)
+				if err != nil {
+					return nil, nil, errors.New(
+						web.FilterInGetPathOffset.String() + " field value must be int")
+				}
+				filterOp.SetOffset(intVal)
+			} else if filterInGetPath == web.FilterInGetPathSort {
+				if strings.EqualFold(val, value_object.Asc.String()) {
+					filterOp.SetAsc()
+				} else if strings.EqualFold(val, value_object.Desc.String()) {
+					filterOp.SetDesc()
+				}
+			} else {
+				filterKeyMapVal[key] = val
+				filterKeyMapFilterInGetPath[key] = filterInGetPath
+			}
+		}
+	}
+
+	var nDF NotificationDeliveryFilter
+	err = util.DecodeMapToStructP(filterKeyMapVal, &nDF)
+	if err != nil {
+		return nil, nil, errors.Wrap(err,
+			"decode param to struct failed, maybe some filed's spell is wrong")
+	}
+
+	for key, idStr := range map[string]string{
+		"flow_id":            nDF.FlowIDStr,
+		"flow_origin_id":     nDF.FlowOriginIDStr,
+		"flow_run_record_id": nDF.FlowRunRecordIDStr,
+	} {
+		if idStr == "" {
+			continue
+		}
+		filterInGetPath := filterKeyMapFilterInGetPath[key]
+		if filterInGetPath != web.FilterInGetPathEq {
+			return nil, nil, errors.New(key + " only suport equal search")
+		}
+		uuID, err := value_object.ParseToUUID(idStr)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parse "+key+" to uuid failed")
+		}
+		filterInGetPath.AddToRepositoryFilter(filter, key, uuID)
+	}
+
+	if nDF.Channel != "" {
+		if !nDF.Channel.IsValid() {
+			return nil, nil, errors.New("channel not valid")
+		}
+		filterInGetPath := filterKeyMapFilterInGetPath["channel"]
+		filterInGetPath.AddToRepositoryFilter(filter, "channel", nDF.Channel)
+	}
+
+	if !nDF.CreateTime.IsZero() {
+		filterInGetPath := filterKeyMapFilterInGetPath["create_time"]
+		filterInGetPath.AddToRepositoryFilter(filter, "create_time", nDF.CreateTime)
+	}
+
+	if _, ok := filterKeyMapVal["suc"]; ok {
+		filterInGetPath := filterKeyMapFilterInGetPath["suc"]
+		filterInGetPath.AddToRepositoryFilter(filter, "suc", nDF.Suc)
+	}
+
+	return filter, filterOp, nil
+}
@@ -36,6 +36,14 @@ func WriteBadRequestDataResp(w *http.ResponseWriter, r *http.Request, msg string
 	resp.writeResp(w, r)
 }
 
+// WriteBadRequestDataWithDetailResp 带有结构化的错误详情(如json schema不满足的位置)
+func WriteBadRequestDataWithDetailResp(
+	w *http.ResponseWriter, r *http.Request, detail interface{}, msg string, v ...interface{},
+) {
+	resp := RespMsg{Code: http.StatusBadRequest, Msg: fmt.Sprintf(msg, v...), Data: detail}
+	resp.writeResp(w, r)
+}
+
 func WriteInternalServerErrorResp(
 	w *http.ResponseWriter, r *http.Request, err error, msg string, v ...interface{},
 ) {
@@ -304,6 +304,46 @@ func (c *Collection) FindOneOrInsert(
 	return
 }
 
+// FindOneAndUpsert 更新匹配的文档，无匹配时插入，resultPointer为更新后的文档。
+// 无匹配但因唯一索引冲突而无法插入时，duplicated为true
+func (c *Collection) FindOneAndUpsert(
+	mFilter *MongoFilter,
+	mSetter *MongoUpdater,
+	resultPointer interface{},
+) (duplicated bool, err error) {
+	err = c.collection.FindOneAndUpdate(
+		context.TODO(),
+		mFilter.filter,
+		mSetter.finalStatement(),
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(resultPointer)
+	if err != nil && mongo.IsDuplicateKeyError(err) {
+		return true, nil
+	}
+	return false, err
+}
+
+// FindOneAndUpdate 更新一个匹配的文档，resultPointer为更新后的文档。无匹配时matched为false
+func (c *Collection) FindOneAndUpdate(
+	mFilter *MongoFilter,
+	mSetter *MongoUpdater,
+	resultPointer interface{},
+) (matched bool, err error) {
+	err = c.collection.FindOneAndUpdate(
+		context.TODO(),
+		mFilter.filter,
+		mSetter.finalStatement(),
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(resultPointer)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (c *Collection) UpdateOneOrInsert(
 	mFilter *MongoFilter,
 	mSetter *MongoUpdater,
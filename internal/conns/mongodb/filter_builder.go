@@ -125,3 +125,19 @@ func (mf *MongoFilter) AddLte(key string, val interface{}) *MongoFilter {
 	mf.filter[key] = bson.M{"$lte": val}
 	return mf
 }
+
+// AddGtAndLt 同一字段需同时满足大于gtVal、小于ltVal（分别调用AddGt、AddLt会互相覆盖）
+func (mf *MongoFilter) AddGtAndLt(key string, gtVal, ltVal interface{}) *MongoFilter {
+	mf.filter[key] = bson.M{"$gt": gtVal, "$lt": ltVal}
+	return mf
+}
+
+// AddOr 满足任意一个子过滤条件即可
+func (mf *MongoFilter) AddOr(filters ...*MongoFilter) *MongoFilter {
+	or := make([]bson.M, 0, len(filters))
+	for _, f := range filters {
+		or = append(or, f.filter)
+	}
+	mf.filter["$or"] = or
+	return mf
+}
@@ -8,10 +8,12 @@ type MongoUpdater struct {
 	setter bson.M
 	pusher bson.M
 	puller bson.M
+	incer  bson.M
 }
 
 func NewUpdater() *MongoUpdater {
 	return &MongoUpdater{
+		bson.M{},
 		bson.M{},
 		bson.M{},
 		bson.M{}}
@@ -32,8 +34,14 @@ func (ms *MongoUpdater) AddPull(key string, val interface{}) *MongoUpdater {
 	return ms
 }
 
+func (ms *MongoUpdater) AddInc(key string, val interface{}) *MongoUpdater {
+	ms.incer[key] = val
+	return ms
+}
+
 func (ms *MongoUpdater) IsZero() bool {
-	return len(ms.setter) == 0 && len(ms.puller) == 0 && len(ms.pusher) == 0
+	return len(ms.setter) == 0 && len(ms.puller) == 0 &&
+		len(ms.pusher) == 0 && len(ms.incer) == 0
 }
 
 func (ms *MongoUpdater) finalStatement() bson.M {
@@ -48,5 +56,8 @@ func (ms *MongoUpdater) finalStatement() bson.M {
 	if len(ms.pusher) > 0 {
 		resp["$push"] = ms.pusher
 	}
+	if len(ms.incer) > 0 {
+		resp["$inc"] = ms.incer
+	}
 	return resp
 }
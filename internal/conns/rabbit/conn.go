@@ -72,6 +72,29 @@ func (rC *RabbitChannel) initQueAndBindToExchange(queue, exchange, routingKey st
 	return err
 }
 
+// initExclusiveQueAndBindToExchange 声明由服务端命名、只属于当前连接的队列，连接断开后队列自动删除
+func (rC *RabbitChannel) initExclusiveQueAndBindToExchange(exchange, routingKey string) (string, error) {
+	q, err := rC.channel.QueueDeclare(
+		"",    // name
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return "", err
+	}
+
+	err = rC.channel.QueueBind(
+		q.Name,     // queue name
+		routingKey, // routing key
+		exchange,   // exchange
+		false,
+		nil)
+	return q.Name, err
+}
+
 func (rC *RabbitChannel) Pub(
 	exchange, routingKey string, value []byte,
 ) (err error) {
@@ -128,3 +151,40 @@ func (rC *RabbitChannel) Pull(
 	}()
 	return
 }
+
+// PullExclusive 以只属于当前连接的临时队列拉取消息，用于每个进程都需要收到全部消息的场景
+// 进程退出后队列随之删除，不会在broker上残留持续堆积消息的队列
+func (rC *RabbitChannel) PullExclusive(
+	exchange, routingKey string,
+	respMsgByteChan chan []byte,
+) (err error) {
+	err = rC.IniExchange(exchange, "topic")
+	if err != nil {
+		return
+	}
+
+	queue, err := rC.initExclusiveQueAndBindToExchange(exchange, routingKey)
+	if err != nil {
+		return
+	}
+
+	msgs, err := rC.channel.Consume(
+		queue, // queue
+		"",    // consumer
+		true,  // auto-ack
+		true,  // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,   // args
+	)
+	if err != nil {
+		return
+	}
+
+	go func() {
+		for d := range msgs {
+			respMsgByteChan <- d.Body
+		}
+	}()
+	return
+}
@@ -1,18 +1,25 @@
 package crontab
 
 import (
-	"strings"
 	"time"
+	_ "time/tzdata" // 部署环境可能没有时区数据，内置以保证CRON_TZ可用
 
 	"github.com/robfig/cron/v3"
 )
 
+// specParser 支持：
+// 1. 5位(分 时 日 月 周)或带秒的6位(秒 分 时 日 月 周)表达式
+// 2. @hourly、@daily、@every 30s 等描述符
+// 3. CRON_TZ=Asia/Shanghai 或 TZ=Asia/Shanghai 前缀指定时区，未指定时为服务器本地时区
+var specParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour |
+		cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
 // TriggeredTimeFlag theTime是一个具体的时间，返回的是当前精度支持下的词时间的表达
 // 目前被crontab watcher那边用来做并发安全控制的标识
-// 目前支持的是分钟级别，所以返回表达式也是到分钟
-// 如果后续改到秒，此地修改就行。避免还要到对应使用者去修改
+// 支持秒级的crontab，所以返回表达式到秒；统一转为本地时区，同一时刻不因crontab时区不同而不同
 func TriggeredTimeFlag(theTime time.Time) string {
-	return theTime.Format("20060102.150405")
+	return theTime.Local().Format("20060102.150405")
 }
 
 type CrontabRepresent struct {
@@ -55,7 +62,6 @@ func IsCrontabStringValid(crontabStr string) bool {
 	if crontabStr == "" {
 		return true
 	}
-	specParser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
 	_, err := specParser.Parse(crontabStr)
 	return err == nil
 }
@@ -64,12 +70,6 @@ func BuildCrontab(iptString string) *CrontabRepresent {
 	if iptString == "" {
 		return nil
 	}
-	iptSlice := strings.Split(iptString, " ")
-	if len(iptSlice) != 5 {
-		return nil
-	}
-	specParser := cron.NewParser(
-		cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
 	schedule, err := specParser.Parse(iptString)
 	if err != nil {
 		return nil
@@ -80,23 +80,49 @@ func BuildCrontab(iptString string) *CrontabRepresent {
 	return cr
 }
 
-// 分钟  小时    dayofmonth   month    dayofweek
-func (cr *CrontabRepresent) TimeMatched(theTime time.Time) bool {
+// getSchedule 从存储中恢复的没有schedule，需要重新解析
+func (cr *CrontabRepresent) getSchedule() cron.Schedule {
 	if cr.IsZero() {
-		return false
+		return nil
 	}
 	if cr.schedule == nil {
-		cr.schedule = BuildCrontab(cr.CrontabStr).schedule
+		built := BuildCrontab(cr.CrontabStr)
+		if built == nil {
+			return nil
+		}
+		cr.schedule = built.schedule
 	}
+	return cr.schedule
+}
 
-	// 当前此crontab配置是否应该立即运行
-	m, _ := time.ParseDuration("-1m")
-	nextRunTime := cr.schedule.Next(time.Now().Add(m))
+// Next 返回theTime之后的下一个计划时间，无效的crontab返回零值
+func (cr *CrontabRepresent) Next(theTime time.Time) time.Time {
+	schedule := cr.getSchedule()
+	if schedule == nil {
+		return time.Time{}
+	}
+	if every, ok := schedule.(cron.ConstantDelaySchedule); ok {
+		// @every的计划时间按固定间隔对齐，而不是从传入的时间开始算，
+		// 这样多个调度、每次重新计算得到的都是相同的计划时间
+		return theTime.Truncate(every.Delay).Add(every.Delay)
+	}
+	return schedule.Next(theTime)
+}
 
-	if nextRunTime.Minute() == theTime.Minute() && nextRunTime.Hour() == theTime.Hour() &&
-		nextRunTime.Day() == theTime.Day() && nextRunTime.Month() == theTime.Month() &&
-		nextRunTime.Year() == theTime.Year() {
-		return true
+// NextN 返回after之后的n个计划时间，升序
+func (cr *CrontabRepresent) NextN(after time.Time, n int) []time.Time {
+	resp := make([]time.Time, 0, n)
+	for next := cr.Next(after); !next.IsZero() && len(resp) < n; next = cr.Next(next) {
+		resp = append(resp, next)
+	}
+	return resp
+}
+
+// FireTimesBetween 返回(after, until]之间的全部计划时间，升序
+func (cr *CrontabRepresent) FireTimesBetween(after, until time.Time) []time.Time {
+	var resp []time.Time
+	for next := cr.Next(after); !next.IsZero() && !next.After(until); next = cr.Next(next) {
+		resp = append(resp, next)
 	}
-	return false
+	return resp
 }
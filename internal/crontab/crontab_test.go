@@ -1,7 +1,6 @@
 package crontab
 
 import (
-	"fmt"
 	"testing"
 	"time"
 
@@ -10,15 +9,22 @@ import (
 
 func TestCrontabStringValidCheck(t *testing.T) {
 	crontabstrMapvalid := map[string]bool{
-		"* * * * *":            true,
-		"*/1 * * * *":          true,
-		"47 08-19 * * *":       true,
-		"02 08-19/2 * * *":     true,
-		"02 08,12,14-16 * * *": true,
-		"* * * * * *":          false,
-		"69 * * * *":           false,
-		"* 34 * * *":           false,
-		"* 14-26 * * *":        false,
+		"* * * * *":                       true,
+		"*/1 * * * *":                     true,
+		"47 08-19 * * *":                  true,
+		"02 08-19/2 * * *":                true,
+		"02 08,12,14-16 * * *":            true,
+		"*/30 * * * * *":                  true,
+		"@hourly":                         true,
+		"@every 30s":                      true,
+		"CRON_TZ=Asia/Shanghai 0 9 * * *": true,
+		"TZ=UTC */10 * * * * *":           true,
+		"* * * * * * *":                   false,
+		"@every 30x":                      false,
+		"CRON_TZ=Mars/Olympus 0 9 * * *":  false,
+		"69 * * * *":                      false,
+		"* 34 * * *":                      false,
+		"* 14-26 * * *":                   false,
 	}
 
 	Convey("crontab string valid check", t, func() {
@@ -59,39 +65,76 @@ func TestIsZero(t *testing.T) {
 	blankCr := BuildCrontab("")
 	Convey("should be nil", t, func() {
 		So(blankCr.IsZero(), ShouldBeTrue)
-		So(blankCr.TimeMatched(time.Now()), ShouldBeFalse)
+		So(blankCr.Next(time.Now()).IsZero(), ShouldBeTrue)
 	})
 }
 
-func TestCrontabRunMatch(t *testing.T) {
-	crontabstrMapNowShouldRun := map[string]bool{
-		"* * * * *":   true,
-		"*/1 * * * *": true,
-	}
-	now := time.Now()
-	notMatchMinute := now.Minute() - 1
-	if notMatchMinute < 0 {
-		notMatchMinute = 20
-	}
-	notMatchHour := now.Hour() - 1
-	if notMatchHour < 0 {
-		notMatchHour = 20
-	}
-	notMatchDay := now.Day() - 1
-	if notMatchDay < 0 {
-		notMatchDay = 20
-	}
-	crontabstrMapNowShouldRun[fmt.Sprintf("%d * * * *", notMatchMinute)] = false
-	crontabstrMapNowShouldRun[fmt.Sprintf("* %d * * *", notMatchHour)] = false
-	crontabstrMapNowShouldRun[fmt.Sprintf("* * %d * *", notMatchDay)] = false
-
-	Convey("crontab run now check", t, func() {
-		for crontabStr, expect := range crontabstrMapNowShouldRun {
-			cr := BuildCrontab(crontabStr)
-			if cr != nil {
-				actual := cr.TimeMatched(now)
-				So(actual, ShouldEqual, expect)
-			}
-		}
+func TestFireTimesBetween(t *testing.T) {
+	after := time.Date(2022, 1, 1, 10, 0, 0, 0, time.Local)
+
+	Convey("fire times between", t, func() {
+		cr := BuildCrontab("*/15 * * * *")
+		times := cr.FireTimesBetween(after, after.Add(time.Hour))
+		So(len(times), ShouldEqual, 4)
+		So(times[0], ShouldEqual, after.Add(15*time.Minute))
+		So(times[3], ShouldEqual, after.Add(time.Hour))
+
+		So(cr.FireTimesBetween(after, after.Add(10*time.Minute)), ShouldBeEmpty)
+
+		var blankCr *CrontabRepresent
+		So(blankCr.FireTimesBetween(after, after.Add(time.Hour)), ShouldBeEmpty)
+	})
+}
+
+func TestCrontabNext(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	theTime := time.Date(2022, 1, 1, 10, 0, 10, 0, time.UTC)
+
+	Convey("second level", t, func() {
+		cr := BuildCrontab("*/30 * * * * *")
+		So(cr.Next(theTime), ShouldEqual, theTime.Add(20*time.Second))
+	})
+
+	Convey("every aligned", t, func() {
+		cr := BuildCrontab("@every 30s")
+		So(cr.Next(theTime), ShouldEqual, theTime.Add(20*time.Second))
+		So(cr.Next(theTime.Add(time.Second)), ShouldEqual, theTime.Add(20*time.Second))
+	})
+
+	Convey("timezone", t, func() {
+		cr := BuildCrontab("CRON_TZ=Asia/Shanghai 0 9 * * *")
+		next := cr.Next(theTime)
+		So(next.Equal(time.Date(2022, 1, 2, 9, 0, 0, 0, shanghai)), ShouldBeTrue)
+	})
+
+	Convey("restored from storage", t, func() {
+		cr := &CrontabRepresent{CrontabStr: "@hourly"}
+		next := cr.Next(theTime)
+		So(next.After(theTime), ShouldBeTrue)
+		So(next.Sub(theTime), ShouldBeLessThanOrEqualTo, time.Hour)
+		So(next.Minute(), ShouldEqual, 0)
+		So(next.Second(), ShouldEqual, 0)
+
+		invalidCr := &CrontabRepresent{CrontabStr: "invalid"}
+		So(invalidCr.Next(theTime).IsZero(), ShouldBeTrue)
+	})
+
+	Convey("triggered time flag ignore timezone", t, func() {
+		So(TriggeredTimeFlag(theTime), ShouldEqual, TriggeredTimeFlag(theTime.In(shanghai)))
+	})
+}
+
+func TestCrontabNextN(t *testing.T) {
+	theTime := time.Date(2022, 1, 1, 10, 0, 10, 0, time.UTC)
+
+	Convey("next n", t, func() {
+		cr := BuildCrontab("@every 1m")
+		times := cr.NextN(theTime, 3)
+		So(len(times), ShouldEqual, 3)
+		So(times[0], ShouldEqual, theTime.Add(50*time.Second))
+		So(times[2], ShouldEqual, theTime.Add(170*time.Second))
+
+		var blankCr *CrontabRepresent
+		So(blankCr.NextN(theTime, 3), ShouldBeEmpty)
 	})
 }
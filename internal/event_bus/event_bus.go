@@ -0,0 +1,82 @@
+// Package event_bus 进程内的运行状态变化事件总线，将从消息队列收到的事件分发给本进程内的各个订阅者（如推送连接）
+package event_bus
+
+import (
+	"sync"
+
+	"github.com/fBloc/bloc-server/event"
+)
+
+// DefaultSubscriberBufferSize 每个订阅者可积压的事件数
+const DefaultSubscriberBufferSize = 256
+
+type subscriber struct {
+	match  func(*event.RunStatusChanged) bool
+	events chan *event.RunStatusChanged
+}
+
+type Bus struct {
+	bufferSize  int
+	subscribers map[*subscriber]struct{}
+	sync.Mutex
+}
+
+func New(bufferSize int) *Bus {
+	if bufferSize <= 0 {
+		bufferSize = DefaultSubscriberBufferSize
+	}
+	return &Bus{
+		bufferSize:  bufferSize,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// Subscribe 订阅满足match的事件，返回接收事件的channel及取消订阅的函数
+// 消费过慢导致积压满了的订阅者会被移除并关闭其channel，订阅方需要重新订阅
+func (b *Bus) Subscribe(
+	match func(*event.RunStatusChanged) bool,
+) (<-chan *event.RunStatusChanged, func()) {
+	sub := &subscriber{
+		match:  match,
+		events: make(chan *event.RunStatusChanged, b.bufferSize),
+	}
+	b.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.Unlock()
+
+	return sub.events, func() { b.remove(sub) }
+}
+
+func (b *Bus) remove(sub *subscriber) {
+	b.Lock()
+	defer b.Unlock()
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.events)
+}
+
+// Publish 分发给所有匹配的订阅者，不会阻塞
+func (b *Bus) Publish(evt *event.RunStatusChanged) {
+	b.Lock()
+	defer b.Unlock()
+	for sub := range b.subscribers {
+		if sub.match != nil && !sub.match(evt) {
+			continue
+		}
+		select {
+		case sub.events <- evt:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// SubscriberAmount 当前的订阅者数目
+func (b *Bus) SubscriberAmount() int {
+	b.Lock()
+	defer b.Unlock()
+	return len(b.subscribers)
+}
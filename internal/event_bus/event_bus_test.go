@@ -0,0 +1,56 @@
+package event_bus
+
+import (
+	"testing"
+
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/value_object"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBus(t *testing.T) {
+	flowRunRecordID := value_object.NewUUID()
+	matchFlowRun := func(e *event.RunStatusChanged) bool {
+		return e.FlowRunRecordID == flowRunRecordID
+	}
+
+	Convey("fan out to matched subscribers", t, func() {
+		bus := New(0)
+		matched, cancelMatched := bus.Subscribe(matchFlowRun)
+		defer cancelMatched()
+		all, cancelAll := bus.Subscribe(nil)
+		defer cancelAll()
+
+		bus.Publish(&event.RunStatusChanged{FlowRunRecordID: value_object.NewUUID()})
+		bus.Publish(&event.RunStatusChanged{FlowRunRecordID: flowRunRecordID})
+
+		So(len(matched), ShouldEqual, 1)
+		So((<-matched).FlowRunRecordID, ShouldEqual, flowRunRecordID)
+		So(len(all), ShouldEqual, 2)
+	})
+
+	Convey("cancel subscribe", t, func() {
+		bus := New(0)
+		events, cancel := bus.Subscribe(nil)
+		So(bus.SubscriberAmount(), ShouldEqual, 1)
+		cancel()
+		cancel()
+		So(bus.SubscriberAmount(), ShouldEqual, 0)
+		_, ok := <-events
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("slow subscriber removed", t, func() {
+		bus := New(1)
+		events, cancel := bus.Subscribe(nil)
+		defer cancel()
+		bus.Publish(&event.RunStatusChanged{})
+		bus.Publish(&event.RunStatusChanged{})
+		So(bus.SubscriberAmount(), ShouldEqual, 0)
+
+		_, ok := <-events
+		So(ok, ShouldBeTrue)
+		_, ok = <-events
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,295 @@
+// Package memory_filter 在内存中对文档执行通用过滤条件（value_object.RepositoryFilter）
+// 文档的key为持久化时使用的字段名（bson tag），与mongo实现的过滤语义保持一致
+package memory_filter
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/fBloc/bloc-server/value_object"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Document bson.M
+
+// ToDocument 将带bson tag的结构体转换为可供过滤的文档
+func ToDocument(v interface{}) (Document, error) {
+	byteData, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	err = bson.Unmarshal(byteData, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return Document(doc), nil
+}
+
+// normalize 将过滤条件中的值按照写入文档时相同的方式进行编码，以便于比较
+func normalize(v interface{}) interface{} {
+	byteData, err := bson.Marshal(bson.M{"v": v})
+	if err != nil {
+		return v
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(byteData, &doc); err != nil {
+		return v
+	}
+	return doc["v"]
+}
+
+// lookup 支持"a.b"形式的嵌套字段
+func (d Document) lookup(key string) (interface{}, bool) {
+	var current interface{} = bson.M(d)
+	for _, part := range strings.Split(key, ".") {
+		switch typed := current.(type) {
+		case bson.M:
+			val, ok := typed[part]
+			if !ok {
+				return nil, false
+			}
+			current = val
+		case primitive.D:
+			found := false
+			for _, e := range typed {
+				if e.Key == part {
+					current = e.Value
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch typed := v.(type) {
+	case int32:
+		return float64(typed), true
+	case int64:
+		return float64(typed), true
+	case float64:
+		return typed, true
+	}
+	return 0, false
+}
+
+// compare 返回 -1/0/1，comparable为false表示两者类型不能比较
+func compare(a, b interface{}) (result int, comparable bool) {
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case af < bf:
+			return -1, true
+		case af > bf:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	switch typedA := a.(type) {
+	case string:
+		typedB, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(typedA, typedB), true
+	case primitive.DateTime:
+		typedB, ok := b.(primitive.DateTime)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case typedA < typedB:
+			return -1, true
+		case typedA > typedB:
+			return 1, true
+		}
+		return 0, true
+	case primitive.Binary:
+		typedB, ok := b.(primitive.Binary)
+		if !ok {
+			return 0, false
+		}
+		return bytes.Compare(typedA.Data, typedB.Data), true
+	case bool:
+		typedB, ok := b.(bool)
+		if !ok || typedA != typedB {
+			return 0, false
+		}
+		return 0, true
+	case nil:
+		return 0, b == nil
+	}
+	return 0, false
+}
+
+func equal(a, b interface{}) bool {
+	result, comparable := compare(a, b)
+	return comparable && result == 0
+}
+
+// anyElement 数组字段只要有一个元素满足即算满足（同mongo的语义）
+func anyElement(docVal interface{}, check func(interface{}) bool) bool {
+	if arr, ok := docVal.(primitive.A); ok {
+		for _, i := range arr {
+			if check(i) {
+				return true
+			}
+		}
+		return false
+	}
+	return check(docVal)
+}
+
+func (d Document) matchEqual(key string, val interface{}) bool {
+	docVal, exist := d.lookup(key)
+	val = normalize(val)
+	if !exist {
+		return val == nil
+	}
+	return anyElement(docVal, func(i interface{}) bool { return equal(i, val) })
+}
+
+func (d Document) matchIn(key string, vals []interface{}) bool {
+	for _, val := range vals {
+		if d.matchEqual(key, val) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d Document) matchCompare(key string, val interface{}, expect func(int) bool) bool {
+	docVal, exist := d.lookup(key)
+	if !exist {
+		return false
+	}
+	val = normalize(val)
+	return anyElement(docVal, func(i interface{}) bool {
+		result, comparable := compare(i, val)
+		return comparable && expect(result)
+	})
+}
+
+func (d Document) matchContains(key, subStr string) bool {
+	docVal, exist := d.lookup(key)
+	if !exist {
+		return false
+	}
+	reg, err := regexp.Compile(".*" + subStr + ".*")
+	if err != nil {
+		return false
+	}
+	return anyElement(docVal, func(i interface{}) bool {
+		str, ok := i.(string)
+		return ok && reg.MatchString(str)
+	})
+}
+
+func (d Document) matchExist(key string) bool {
+	docVal, exist := d.lookup(key)
+	if !exist {
+		return false
+	}
+	if str, ok := docVal.(string); ok && str == "" {
+		return false
+	}
+	return true
+}
+
+// Match 判断文档是否满足过滤条件
+func (d Document) Match(filter value_object.RepositoryFilter) bool {
+	for k, v := range filter.GetEqual() {
+		if !d.matchEqual(k, v) {
+			return false
+		}
+	}
+	for k, v := range filter.GetNotEqual() {
+		if d.matchEqual(k, v) {
+			return false
+		}
+	}
+	for k, v := range filter.GetStrContains() {
+		if !d.matchContains(k, v) {
+			return false
+		}
+	}
+	for k, v := range filter.GetIn() {
+		if !d.matchIn(k, v) {
+			return false
+		}
+	}
+	for _, k := range filter.GetFiledExist() {
+		if !d.matchExist(k) {
+			return false
+		}
+	}
+	for _, k := range filter.GetFiledNotExist() {
+		if _, exist := d.lookup(k); exist {
+			return false
+		}
+	}
+	for k, v := range filter.GetGt() {
+		if !d.matchCompare(k, v, func(r int) bool { return r > 0 }) {
+			return false
+		}
+	}
+	for k, v := range filter.GetGte() {
+		if !d.matchCompare(k, v, func(r int) bool { return r >= 0 }) {
+			return false
+		}
+	}
+	for k, v := range filter.GetLt() {
+		if !d.matchCompare(k, v, func(r int) bool { return r < 0 }) {
+			return false
+		}
+	}
+	for k, v := range filter.GetLte() {
+		if !d.matchCompare(k, v, func(r int) bool { return r <= 0 }) {
+			return false
+		}
+	}
+	return true
+}
+
+// PageIndexes 对按插入顺序排列的total条数据，按照filterOption（排序、offset、limit）返回应取的下标
+// 与mongo实现一致，默认使用倒序
+func PageIndexes(
+	total int, filterOption value_object.RepositoryFilterOption,
+) []int {
+	indexes := make([]int, 0, total)
+	if filterOption.Asc {
+		for i := 0; i < total; i++ {
+			indexes = append(indexes, i)
+		}
+	} else {
+		for i := total - 1; i >= 0; i-- {
+			indexes = append(indexes, i)
+		}
+	}
+
+	if filterOption.OffSet > 0 {
+		if int(filterOption.OffSet) >= len(indexes) {
+			return []int{}
+		}
+		indexes = indexes[filterOption.OffSet:]
+	}
+	if filterOption.Limit > 0 && int(filterOption.Limit) < len(indexes) {
+		indexes = indexes[:filterOption.Limit]
+	}
+	return indexes
+}
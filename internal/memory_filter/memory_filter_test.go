@@ -0,0 +1,81 @@
+package memory_filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/value_object"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type fakeDoc struct {
+	ID       value_object.UUID     `bson:"id"`
+	Name     string                `bson:"name"`
+	Status   value_object.RunState `bson:"status"`
+	Time     time.Time             `bson:"time"`
+	UserIDs  []value_object.UUID   `bson:"user_ids"`
+	Optional string                `bson:"optional,omitempty"`
+}
+
+func TestMatch(t *testing.T) {
+	userID := value_object.NewUUID()
+	now := time.Now()
+	fake := fakeDoc{
+		ID:      value_object.NewUUID(),
+		Name:    "add-function",
+		Status:  value_object.Running,
+		Time:    now,
+		UserIDs: []value_object.UUID{value_object.NewUUID(), userID},
+	}
+	doc, err := ToDocument(fake)
+
+	Convey("to document", t, func() {
+		So(err, ShouldBeNil)
+		So(doc, ShouldContainKey, "name")
+		So(doc, ShouldNotContainKey, "optional")
+	})
+
+	Convey("equal & not equal", t, func() {
+		So(doc.Match(*value_object.NewRepositoryFilter().AddEqual("id", fake.ID)), ShouldBeTrue)
+		So(doc.Match(*value_object.NewRepositoryFilter().AddEqual("id", value_object.NewUUID())), ShouldBeFalse)
+		So(doc.Match(*value_object.NewRepositoryFilter().AddEqual("status", value_object.Running)), ShouldBeTrue)
+		So(doc.Match(*value_object.NewRepositoryFilter().AddNotEqual("status", value_object.Running)), ShouldBeFalse)
+	})
+
+	Convey("array field matches any element", t, func() {
+		So(doc.Match(*value_object.NewRepositoryFilter().AddEqual("user_ids", userID)), ShouldBeTrue)
+		So(doc.Match(*value_object.NewRepositoryFilter().AddEqual("user_ids", value_object.NewUUID())), ShouldBeFalse)
+	})
+
+	Convey("in & contains", t, func() {
+		So(doc.Match(*value_object.NewRepositoryFilter().AddIn(
+			"status", []interface{}{value_object.Created, value_object.Running})), ShouldBeTrue)
+		So(doc.Match(*value_object.NewRepositoryFilter().AddIn(
+			"status", []interface{}{value_object.Suc})), ShouldBeFalse)
+		So(doc.Match(*value_object.NewRepositoryFilter().AddContains("name", "func")), ShouldBeTrue)
+		So(doc.Match(*value_object.NewRepositoryFilter().AddContains("name", "multiply")), ShouldBeFalse)
+	})
+
+	Convey("compare", t, func() {
+		So(doc.Match(*value_object.NewRepositoryFilter().AddGt("time", now.Add(-time.Minute))), ShouldBeTrue)
+		So(doc.Match(*value_object.NewRepositoryFilter().AddLt("time", now.Add(-time.Minute))), ShouldBeFalse)
+		So(doc.Match(*value_object.NewRepositoryFilter().AddGte("status", value_object.Running)), ShouldBeTrue)
+	})
+
+	Convey("exist", t, func() {
+		So(doc.Match(*value_object.NewRepositoryFilter().AddExist("name")), ShouldBeTrue)
+		So(doc.Match(*value_object.NewRepositoryFilter().AddExist("optional")), ShouldBeFalse)
+		So(doc.Match(*value_object.NewRepositoryFilter().AddNotExist("optional")), ShouldBeTrue)
+	})
+}
+
+func TestPageIndexes(t *testing.T) {
+	Convey("default desc", t, func() {
+		So(PageIndexes(3, value_object.RepositoryFilterOption{}), ShouldResemble, []int{2, 1, 0})
+	})
+
+	Convey("asc with offset & limit", t, func() {
+		So(PageIndexes(5, value_object.RepositoryFilterOption{Asc: true, OffSet: 1, Limit: 2}), ShouldResemble, []int{1, 2})
+		So(PageIndexes(2, value_object.RepositoryFilterOption{OffSet: 3}), ShouldResemble, []int{})
+	})
+}
@@ -0,0 +1,108 @@
+package bloc
+
+import (
+	"time"
+
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/infrastructure/notifier"
+	"github.com/fBloc/bloc-server/services/notification"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// NotificationDeliverConsumer 投递flow运行结束的通知，失败时按退避间隔发布未来事件进行重试
+func (blocApp *BlocApp) NotificationDeliverConsumer() {
+	event.InjectMq(blocApp.GetOrCreateEventMQ())
+	event.InjectFutureEventStorageImplement(blocApp.GetOrCreateFutureEventStorage())
+	logger := blocApp.GetOrCreateScheduleLogger()
+	flowRepo := blocApp.GetOrCreateFlowRepository()
+	flowRunRepo := blocApp.GetOrCreateFlowRunRecordRepository()
+	funcRunRecordRepo := blocApp.GetOrCreateFunctionRunRecordRepository()
+	notificationService, err := notification.NewService(
+		notification.WithLogger(logger),
+		notification.WithNotificationDeliveryRepository(
+			blocApp.GetOrCreateNotificationDeliveryRepository()),
+		notification.WithNotifiers(blocApp.GetOrCreateNotifiers()))
+	if err != nil {
+		panic(err)
+	}
+
+	toDeliverEventChan := make(chan event.DomainEvent)
+	err = event.ListenEvent(
+		&event.NotificationToDeliver{}, "notification_deliver_consumer",
+		toDeliverEventChan)
+	if err != nil {
+		panic(err)
+	}
+
+	for toDeliverEvent := range toDeliverEventChan {
+		deliveryIDStr := toDeliverEvent.Identity()
+		logTag := map[string]string{
+			string(value_object.SpanID): value_object.NewSpanID(),
+			"business":                  "notification deliver consumer",
+			"notification_delivery_id":  deliveryIDStr}
+
+		deliveryID, err := value_object.ParseToUUID(deliveryIDStr)
+		if err != nil {
+			logger.Errorf(logTag,
+				"cannot parse identity:%s to uuid! error:%v", deliveryIDStr, err)
+			continue
+		}
+		delivery, err := notificationService.NotificationDeliveries.GetByID(deliveryID)
+		if err != nil || delivery.IsZero() {
+			logger.Errorf(logTag, "notification_delivery_id find no record!")
+			continue
+		}
+		if delivery.Finished() {
+			logger.Infof(logTag, "already finished. breakout")
+			continue
+		}
+		logTag["flow_run_record_id"] = delivery.FlowRunRecordID.String()
+
+		flowRunIns, err := flowRunRepo.GetByID(delivery.FlowRunRecordID)
+		if err != nil || flowRunIns.IsZero() {
+			logger.Errorf(logTag, "find flow_run_record by id failed: %v", err)
+			continue
+		}
+		logTag[string(value_object.TraceID)] = flowRunIns.TraceID
+		flowIns, err := flowRepo.GetByID(delivery.FlowID)
+		if err != nil || flowIns.IsZero() {
+			logger.Errorf(logTag, "find flow by id failed: %v", err)
+			continue
+		}
+
+		var msg notifier.Message
+		if delivery.FunctionRunRecordID.IsNil() {
+			msg, err = notification.NewRunFinishedMessage(flowIns, flowRunIns, delivery)
+		} else { // 审批通知
+			funcRunRecordIns, getErr := funcRunRecordRepo.GetByID(delivery.FunctionRunRecordID)
+			if getErr != nil || funcRunRecordIns.IsZero() {
+				logger.Errorf(logTag, "find function_run_record by id failed: %v", getErr)
+				continue
+			}
+			if !funcRunRecordIns.IsWaitingApproval() {
+				logger.Infof(logTag, "not waiting approval anymore. breakout")
+				continue
+			}
+			msg, err = notification.NewWaitingApprovalMessage(flowIns, funcRunRecordIns, delivery)
+		}
+		if err != nil {
+			logger.Errorf(logTag, "build notification message failed: %v", err)
+			continue
+		}
+		retry, delay, err := notificationService.Deliver(delivery, msg)
+		if err != nil {
+			logger.Errorf(logTag, "save notification delivery attempt failed: %v", err)
+			continue
+		}
+		if !retry {
+			logger.Infof(logTag, "delivery finished")
+			continue
+		}
+
+		logger.Warningf(logTag, "delivery failed, will retry after %s", delay)
+		err = event.PubEventAtCertainTime(toDeliverEvent, time.Now().Add(delay))
+		if err != nil {
+			logger.Errorf(logTag, "pub retry notification to deliver event failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// @Title  builtin_function
+// @Description 由bloc-server自身运行的内置function，不需要外部的function provider注册
+package builtin_function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/fBloc/bloc-server/infrastructure/log"
+	"github.com/fBloc/bloc-server/pkg/function_developer_implement"
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+const (
+	// ProviderName 内置function保留的provider名，不允许外部的function provider以此名注册
+	ProviderName = "bloc_builtin"
+	GroupName    = "builtin"
+)
+
+type BuiltinFunction struct {
+	Name        string
+	Description string
+	Implement   function_developer_implement.FunctionDeveloperImplementInterface
+}
+
+// All 全部的内置function
+func All() []*BuiltinFunction {
+	return []*BuiltinFunction{
+		{Name: "delay", Description: "sleep for certain seconds", Implement: &Delay{}},
+		{Name: "http_request", Description: "send http request with templated body", Implement: &HttpRequest{}},
+		{Name: "pass_through", Description: "output the input json as it is", Implement: &PassThrough{}},
+		{Name: "json_path_extract", Description: "extract value from json by path", Implement: &JsonPathExtract{}},
+		{Name: "merge_json", Description: "merge several json objects into one", Implement: &MergeJson{}},
+	}
+}
+
+// baseImplement 各内置function共用的实现部分，内置function都没有进度里程碑
+type baseImplement struct{}
+
+func (b *baseImplement) AllProgressMilestones() []string {
+	return nil
+}
+
+// runFunc 内置function的具体逻辑，返回各个opt key对应的值
+type runFunc func(ctx context.Context, ipts ipt.IptSlice) (map[string]interface{}, error)
+
+// run 执行run并将结果发送到optChan，run中的panic视为运行失败
+func run(
+	ctx context.Context,
+	ipts ipt.IptSlice,
+	optChan chan *value_object.FunctionRunOpt,
+	logger *log.Logger,
+	f runFunc,
+) {
+	defer func() {
+		if r := recover(); r != nil {
+			optChan <- &value_object.FunctionRunOpt{ErrorMsg: fmt.Sprintf("panic: %v", r)}
+		}
+	}()
+
+	detail, err := f(ctx, ipts)
+	if ctx.Err() != nil {
+		optChan <- value_object.CanceldBlocOpt()
+		return
+	}
+	if err != nil {
+		if !logger.IsZero() {
+			logger.Warningf(map[string]string{}, "builtin function run failed: %v", err)
+		}
+		optChan <- &value_object.FunctionRunOpt{ErrorMsg: err.Error()}
+		return
+	}
+	optChan <- &value_object.FunctionRunOpt{Suc: true, Detail: detail}
+}
+
+// iptValue 获取第iptIndex个ipt的第一个component的值
+func iptValue(ipts ipt.IptSlice, iptIndex int) interface{} {
+	if iptIndex >= len(ipts) || len(ipts[iptIndex].Components) == 0 {
+		return nil
+	}
+	return ipts[iptIndex].Components[0].Value
+}
+
+// jsonObject 将json类型的值转为map，json类型的值可能是json字符串或已经解析过的map
+func jsonObject(value interface{}) (map[string]interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return v, nil
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		var resp map[string]interface{}
+		err := json.Unmarshal([]byte(v), &resp)
+		if err != nil {
+			return nil, fmt.Errorf("value is not a valid json object: %v", err)
+		}
+		return resp, nil
+	}
+
+	// 其他的类型（如bson解析出的文档）先序列化再反序列化
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("value is not a valid json object: %v", err)
+	}
+	var resp map[string]interface{}
+	err = json.Unmarshal(raw, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("value is not a valid json object: %v", err)
+	}
+	return resp, nil
+}
+
+// jsonString json类型的opt以json字符串输出，与json类型ipt的值保持一致
+func jsonString(value map[string]interface{}) (string, error) {
+	if value == nil {
+		value = map[string]interface{}{}
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,280 @@
+package builtin_function
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/pkg/function_developer_implement"
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/value_object"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func runWithValues(
+	ctx context.Context,
+	implement function_developer_implement.FunctionDeveloperImplementInterface,
+	values ...[]interface{},
+) *value_object.FunctionRunOpt {
+	ipts := implement.IptConfig()
+	for paramIndex, param := range values {
+		for componentIndex, value := range param {
+			ipts[paramIndex].Components[componentIndex].Value = value
+		}
+	}
+	optChan := make(chan *value_object.FunctionRunOpt, 1)
+	go implement.Run(ctx, ipts, make(chan value_object.FunctionRunStatus), optChan, nil)
+	return <-optChan
+}
+
+func TestAll(t *testing.T) {
+	Convey("builtin functions should have unique name & core", t, func() {
+		names := make(map[string]bool)
+		cores := make(map[string]bool)
+		for _, builtin := range All() {
+			So(names[builtin.Name], ShouldBeFalse)
+			names[builtin.Name] = true
+
+			core := ipt.GenIptDigest(builtin.Implement.IptConfig())
+			So(cores[core], ShouldBeFalse)
+			cores[core] = true
+		}
+	})
+}
+
+func TestDelay(t *testing.T) {
+	Convey("delay", t, func() {
+		runOpt := runWithValues(context.Background(), &Delay{}, []interface{}{0})
+		So(runOpt.Suc, ShouldBeTrue)
+		So(runOpt.Detail["delayed_seconds"], ShouldEqual, 0)
+	})
+
+	Convey("negative seconds should fail", t, func() {
+		runOpt := runWithValues(context.Background(), &Delay{}, []interface{}{-1})
+		So(runOpt.Suc, ShouldBeFalse)
+		So(runOpt.ErrorMsg, ShouldNotBeBlank)
+	})
+
+	Convey("canceled by context", t, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		runOpt := runWithValues(ctx, &Delay{}, []interface{}{60})
+		So(runOpt.Suc, ShouldBeFalse)
+		So(runOpt.Canceled, ShouldBeTrue)
+	})
+}
+
+func TestHttpRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Path == "/large" {
+			w.Write([]byte(strings.Repeat("a", config.BuiltinHttpRequestMaxBodyBytes+1)))
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"method": r.Method,
+			"token":  r.Header.Get("X-Token"),
+			"body":   string(body)})
+	}))
+	defer server.Close()
+	// 测试server监听在回环地址上，需显式允许访问
+	InjectHttpRequestAccessPolicy(&HttpRequestAccessPolicy{AllowHosts: []string{"127.0.0.1"}})
+	defer InjectHttpRequestAccessPolicy(nil)
+
+	Convey("render body template & parse json response", t, func() {
+		runOpt := runWithValues(
+			context.Background(), &HttpRequest{},
+			[]interface{}{"post"},
+			[]interface{}{server.URL},
+			[]interface{}{`{"X-Token": "abc"}`},
+			[]interface{}{`{"name": "{{.name}}"}`},
+			[]interface{}{`{"name": "bloc"}`})
+		So(runOpt.Suc, ShouldBeTrue)
+		So(runOpt.Detail["status_code"], ShouldEqual, http.StatusOK)
+
+		var respJson map[string]interface{}
+		err := json.Unmarshal([]byte(runOpt.Detail["json"].(string)), &respJson)
+		So(err, ShouldBeNil)
+		So(respJson["method"], ShouldEqual, http.MethodPost)
+		So(respJson["token"], ShouldEqual, "abc")
+		So(respJson["body"], ShouldEqual, `{"name": "bloc"}`)
+	})
+
+	Convey("missing template key should fail", t, func() {
+		runOpt := runWithValues(
+			context.Background(), &HttpRequest{},
+			[]interface{}{"post"},
+			[]interface{}{server.URL},
+			[]interface{}{nil},
+			[]interface{}{`{"name": "{{.name}}"}`},
+			[]interface{}{`{"age": 1}`})
+		So(runOpt.Suc, ShouldBeFalse)
+	})
+
+	Convey("not 2xx response should fail", t, func() {
+		runOpt := runWithValues(
+			context.Background(), &HttpRequest{},
+			[]interface{}{"get"},
+			[]interface{}{server.URL + "/fail"})
+		So(runOpt.Suc, ShouldBeFalse)
+		So(runOpt.ErrorMsg, ShouldContainSubstring, "500")
+	})
+
+	Convey("too large response body should fail", t, func() {
+		runOpt := runWithValues(
+			context.Background(), &HttpRequest{},
+			[]interface{}{"get"},
+			[]interface{}{server.URL + "/large"})
+		So(runOpt.Suc, ShouldBeFalse)
+		So(runOpt.ErrorMsg, ShouldContainSubstring, "exceeds")
+	})
+
+	Convey("internal address is not allowed by default", t, func() {
+		InjectHttpRequestAccessPolicy(nil)
+		defer InjectHttpRequestAccessPolicy(
+			&HttpRequestAccessPolicy{AllowHosts: []string{"127.0.0.1"}})
+
+		for _, url := range []string{server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)} {
+			runOpt := runWithValues(
+				context.Background(), &HttpRequest{},
+				[]interface{}{"get"},
+				[]interface{}{url})
+			So(runOpt.Suc, ShouldBeFalse)
+			So(runOpt.ErrorMsg, ShouldContainSubstring, "not allowed")
+		}
+	})
+
+	Convey("deny hosts take precedence over allow hosts", t, func() {
+		InjectHttpRequestAccessPolicy(&HttpRequestAccessPolicy{
+			AllowHosts: []string{"127.0.0.1"}, DenyHosts: []string{"127.0.0.0/8"}})
+		defer InjectHttpRequestAccessPolicy(
+			&HttpRequestAccessPolicy{AllowHosts: []string{"127.0.0.1"}})
+
+		runOpt := runWithValues(
+			context.Background(), &HttpRequest{},
+			[]interface{}{"get"},
+			[]interface{}{server.URL})
+		So(runOpt.Suc, ShouldBeFalse)
+		So(runOpt.ErrorMsg, ShouldContainSubstring, "denied")
+	})
+}
+
+func TestHttpRequestAccessPolicyCheckDial(t *testing.T) {
+	Convey("public address", t, func() {
+		So((&HttpRequestAccessPolicy{}).CheckDial("example.com", net.ParseIP("93.184.216.34")), ShouldBeNil)
+	})
+
+	Convey("internal addresses", t, func() {
+		for _, ip := range []string{"127.0.0.1", "10.0.0.1", "192.168.1.1", "169.254.169.254", "::1", "fe80::1", "0.0.0.0"} {
+			So((&HttpRequestAccessPolicy{}).CheckDial("example.com", net.ParseIP(ip)), ShouldNotBeNil)
+		}
+	})
+
+	Convey("allow by host name or CIDR", t, func() {
+		policy := &HttpRequestAccessPolicy{AllowHosts: []string{"Internal.Example.com", "10.0.0.0/8"}}
+		So(policy.CheckDial("internal.example.com", net.ParseIP("192.168.1.1")), ShouldBeNil)
+		So(policy.CheckDial("other.example.com", net.ParseIP("10.1.2.3")), ShouldBeNil)
+		So(policy.CheckDial("other.example.com", net.ParseIP("192.168.1.1")), ShouldNotBeNil)
+	})
+
+	Convey("deny by host name", t, func() {
+		policy := &HttpRequestAccessPolicy{DenyHosts: []string{"example.com"}}
+		So(policy.CheckDial("example.com", net.ParseIP("93.184.216.34")), ShouldNotBeNil)
+	})
+
+	Convey("invalid CIDR", t, func() {
+		So((&HttpRequestAccessPolicy{AllowHosts: []string{"10.0.0.0/33"}}).CheckValid(), ShouldNotBeNil)
+	})
+}
+
+func TestPassThrough(t *testing.T) {
+	Convey("pass through", t, func() {
+		runOpt := runWithValues(
+			context.Background(), &PassThrough{},
+			[]interface{}{map[string]interface{}{"a": 1}})
+		So(runOpt.Suc, ShouldBeTrue)
+		So(runOpt.Detail["value"], ShouldEqual, `{"a":1}`)
+	})
+
+	Convey("not json object should fail", t, func() {
+		runOpt := runWithValues(context.Background(), &PassThrough{}, []interface{}{"[1, 2]"})
+		So(runOpt.Suc, ShouldBeFalse)
+	})
+}
+
+func TestJsonPathExtract(t *testing.T) {
+	data := map[string]interface{}{
+		"data": map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"name": "bloc", "tags": []interface{}{"a", "b"}},
+			},
+			"total": 1.0,
+		},
+	}
+
+	Convey("ExtractJsonPath", t, func() {
+		value, found, err := ExtractJsonPath(data, "$.data.items[0].name")
+		So(err, ShouldBeNil)
+		So(found, ShouldBeTrue)
+		So(value, ShouldEqual, "bloc")
+
+		value, found, err = ExtractJsonPath(data, "data.items.0.tags.1")
+		So(err, ShouldBeNil)
+		So(found, ShouldBeTrue)
+		So(value, ShouldEqual, "b")
+
+		_, found, err = ExtractJsonPath(data, "$.data.items[1].name")
+		So(err, ShouldBeNil)
+		So(found, ShouldBeFalse)
+
+		_, found, err = ExtractJsonPath(data, "$.data.total.x")
+		So(err, ShouldBeNil)
+		So(found, ShouldBeFalse)
+
+		_, _, err = ExtractJsonPath(data, "$.data.items[0")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("run", t, func() {
+		raw, _ := json.Marshal(data)
+		runOpt := runWithValues(
+			context.Background(), &JsonPathExtract{},
+			[]interface{}{string(raw)}, []interface{}{"$.data.items[0].tags"})
+		So(runOpt.Suc, ShouldBeTrue)
+		So(runOpt.Detail["found"], ShouldBeTrue)
+		So(runOpt.Detail["value"], ShouldEqual, `["a","b"]`)
+
+		runOpt = runWithValues(
+			context.Background(), &JsonPathExtract{},
+			[]interface{}{string(raw)}, []interface{}{"$.data.total"})
+		So(runOpt.Suc, ShouldBeTrue)
+		So(runOpt.Detail["value"], ShouldEqual, "1")
+	})
+}
+
+func TestMergeJson(t *testing.T) {
+	Convey("later json should override former", t, func() {
+		runOpt := runWithValues(
+			context.Background(), &MergeJson{},
+			[]interface{}{`{"a": 1, "b": 1}`, nil, map[string]interface{}{"b": 2, "c": 3}})
+		So(runOpt.Suc, ShouldBeTrue)
+		So(runOpt.Detail["merged"], ShouldEqual, `{"a":1,"b":2,"c":3}`)
+	})
+
+	Convey("not json object should fail", t, func() {
+		runOpt := runWithValues(context.Background(), &MergeJson{}, []interface{}{"not json"})
+		So(runOpt.Suc, ShouldBeFalse)
+		So(runOpt.ErrorMsg, ShouldContainSubstring, "json 1")
+	})
+}
@@ -0,0 +1,76 @@
+package builtin_function
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fBloc/bloc-server/infrastructure/log"
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/pkg/opt"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+	"github.com/fBloc/bloc-server/value_object"
+
+	"github.com/spf13/cast"
+)
+
+// Delay 等待一定的秒数后再继续运行下游
+type Delay struct {
+	baseImplement
+}
+
+func (d *Delay) IptConfig() ipt.IptSlice {
+	return ipt.IptSlice{
+		{
+			Key:     "delay_seconds",
+			Display: "seconds to delay",
+			Must:    true,
+			Components: []*ipt.IptComponent{
+				{
+					ValueType:       value_type.IntValueType,
+					FormControlType: value_object.InputFormControl,
+					Hint:            "seconds",
+				},
+			},
+		},
+	}
+}
+
+func (d *Delay) OptConfig() []*opt.Opt {
+	return []*opt.Opt{
+		{
+			Key:         "delayed_seconds",
+			Description: "actually delayed seconds",
+			ValueType:   value_type.IntValueType,
+		},
+	}
+}
+
+func (d *Delay) Run(
+	ctx context.Context,
+	ipts ipt.IptSlice,
+	progressReportChan chan value_object.FunctionRunStatus,
+	blocOptChan chan *value_object.FunctionRunOpt,
+	logger *log.Logger,
+) {
+	run(ctx, ipts, blocOptChan, logger, d.run)
+}
+
+func (d *Delay) run(ctx context.Context, ipts ipt.IptSlice) (map[string]interface{}, error) {
+	seconds, err := cast.ToIntE(iptValue(ipts, 0))
+	if err != nil {
+		return nil, err
+	}
+	if seconds < 0 {
+		return nil, errors.New("delay_seconds should not be negative")
+	}
+
+	timer := time.NewTimer(time.Duration(seconds) * time.Second)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+	}
+	return map[string]interface{}{"delayed_seconds": seconds}, nil
+}
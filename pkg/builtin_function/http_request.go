@@ -0,0 +1,221 @@
+package builtin_function
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/infrastructure/log"
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/pkg/opt"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+	"github.com/fBloc/bloc-server/value_object"
+
+	"github.com/spf13/cast"
+)
+
+var httpMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// httpRequestClient 不使用http.DefaultClient，避免无响应的地址一直占用运行、以及访问到内网地址
+var httpRequestClient = &http.Client{
+	Timeout:   config.BuiltinHttpRequestTimeout,
+	Transport: newHttpRequestTransport()}
+
+// HttpRequest 发送http请求，请求体为text/template模版，以template_data作为模版的数据渲染
+// 响应的状态码不是2xx时视为运行失败。可以访问的地址范围见HttpRequestAccessPolicy
+type HttpRequest struct {
+	baseImplement
+}
+
+func (h *HttpRequest) IptConfig() ipt.IptSlice {
+	methodOptions := make([]ipt.SelectOption, 0, len(httpMethods))
+	for _, method := range httpMethods {
+		methodOptions = append(methodOptions, ipt.SelectOption{Label: method, Value: method})
+	}
+	return ipt.IptSlice{
+		{
+			Key:     "method",
+			Display: "request method",
+			Must:    true,
+			Components: []*ipt.IptComponent{
+				{
+					ValueType:       value_type.StringValueType,
+					FormControlType: value_object.SelectFormControl,
+					Hint:            "method",
+					DefaultValue:    http.MethodGet,
+					SelectOptions:   methodOptions,
+				},
+			},
+		},
+		{
+			Key:     "url",
+			Display: "request url",
+			Must:    true,
+			Components: []*ipt.IptComponent{
+				{
+					ValueType:       value_type.StringValueType,
+					FormControlType: value_object.InputFormControl,
+					Hint:            "url",
+				},
+			},
+		},
+		{
+			Key:     "headers",
+			Display: "request headers",
+			Must:    false,
+			Components: []*ipt.IptComponent{
+				{
+					ValueType:       value_type.JsonValueType,
+					FormControlType: value_object.JsonFormControl,
+					Hint:            `like {"Content-Type": "application/json"}`,
+				},
+			},
+		},
+		{
+			Key:     "body_template",
+			Display: "request body template",
+			Must:    false,
+			Components: []*ipt.IptComponent{
+				{
+					ValueType:       value_type.StringValueType,
+					FormControlType: value_object.TextAreaFormControl,
+					Hint:            `go text/template, like {"name": "{{.name}}"}`,
+				},
+			},
+		},
+		{
+			Key:     "template_data",
+			Display: "data to render body template",
+			Must:    false,
+			Components: []*ipt.IptComponent{
+				{
+					ValueType:       value_type.JsonValueType,
+					FormControlType: value_object.JsonFormControl,
+					Hint:            "template data",
+				},
+			},
+		},
+	}
+}
+
+func (h *HttpRequest) OptConfig() []*opt.Opt {
+	return []*opt.Opt{
+		{
+			Key:         "status_code",
+			Description: "response status code",
+			ValueType:   value_type.IntValueType,
+		},
+		{
+			Key:         "body",
+			Description: "response body",
+			ValueType:   value_type.StringValueType,
+		},
+		{
+			Key:         "json",
+			Description: "response body as json object, empty if body is not json object",
+			ValueType:   value_type.JsonValueType,
+		},
+	}
+}
+
+func (h *HttpRequest) Run(
+	ctx context.Context,
+	ipts ipt.IptSlice,
+	progressReportChan chan value_object.FunctionRunStatus,
+	blocOptChan chan *value_object.FunctionRunOpt,
+	logger *log.Logger,
+) {
+	run(ctx, ipts, blocOptChan, logger, h.run)
+}
+
+func (h *HttpRequest) run(ctx context.Context, ipts ipt.IptSlice) (map[string]interface{}, error) {
+	method := strings.ToUpper(cast.ToString(iptValue(ipts, 0)))
+	if method == "" {
+		method = http.MethodGet
+	}
+	url := cast.ToString(iptValue(ipts, 1))
+	if url == "" {
+		return nil, errors.New("url is required")
+	}
+	headers, err := jsonObject(iptValue(ipts, 2))
+	if err != nil {
+		return nil, fmt.Errorf("headers: %v", err)
+	}
+	body, err := renderBody(cast.ToString(iptValue(ipts, 3)), iptValue(ipts, 4))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, cast.ToString(value))
+	}
+	resp, err := httpRequestClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	// 多读一个字节以判断响应体是否超过了上限
+	respBody, err := ioutil.ReadAll(
+		io.LimitReader(resp.Body, config.BuiltinHttpRequestMaxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(respBody) > config.BuiltinHttpRequestMaxBodyBytes {
+		return nil, fmt.Errorf(
+			"response body exceeds %d bytes", config.BuiltinHttpRequestMaxBodyBytes)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("response status code: %d, body: %s", resp.StatusCode, respBody)
+	}
+
+	var respJson map[string]interface{}
+	if json.Unmarshal(respBody, &respJson) != nil {
+		respJson = nil
+	}
+	respJsonStr, err := jsonString(respJson)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"status_code": resp.StatusCode,
+		"body":        string(respBody),
+		"json":        respJsonStr,
+	}, nil
+}
+
+// renderBody 以data渲染请求体模版，没有模版数据时直接使用模版原文
+func renderBody(bodyTemplate string, data interface{}) (string, error) {
+	if bodyTemplate == "" {
+		return "", nil
+	}
+	templateData, err := jsonObject(data)
+	if err != nil {
+		return "", fmt.Errorf("template_data: %v", err)
+	}
+	if templateData == nil {
+		return bodyTemplate, nil
+	}
+	tpl, err := template.New("body").Option("missingkey=error").Parse(bodyTemplate)
+	if err != nil {
+		return "", fmt.Errorf("parse body template failed: %v", err)
+	}
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, templateData)
+	if err != nil {
+		return "", fmt.Errorf("render body template failed: %v", err)
+	}
+	return buf.String(), nil
+}
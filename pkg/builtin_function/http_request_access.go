@@ -0,0 +1,119 @@
+package builtin_function
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// HttpRequestAccessPolicy 内置http_request function可以访问的地址范围，
+// 检查的是实际连接的ip（而非url中的host），避免通过域名解析到内网地址绕过。
+// 默认不允许访问回环、链路本地及内网地址，AllowHosts中的除外；DenyHosts中的一律不允许访问，优先于AllowHosts。
+// 两者的元素都可以是host名、ip或CIDR
+type HttpRequestAccessPolicy struct {
+	AllowHosts []string
+	DenyHosts  []string
+}
+
+var httpRequestAccessPolicy = &HttpRequestAccessPolicy{}
+
+// InjectHttpRequestAccessPolicy 设置内置http_request function可以访问的地址范围，传入nil时使用默认的范围
+func InjectHttpRequestAccessPolicy(policy *HttpRequestAccessPolicy) {
+	if policy == nil {
+		policy = &HttpRequestAccessPolicy{}
+	}
+	httpRequestAccessPolicy = policy
+	// 已建立的连接是按之前的范围检查的，不再复用
+	httpRequestClient.CloseIdleConnections()
+}
+
+func (p *HttpRequestAccessPolicy) CheckValid() error {
+	for _, hosts := range [][]string{p.AllowHosts, p.DenyHosts} {
+		for _, host := range hosts {
+			if strings.TrimSpace(host) == "" {
+				return fmt.Errorf("host cannot be blank")
+			}
+			if strings.Contains(host, "/") {
+				if _, _, err := net.ParseCIDR(host); err != nil {
+					return fmt.Errorf("host「%s」not valid CIDR: %v", host, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// CheckDial 检查连接到url中的host解析出的ip是否被允许
+func (p *HttpRequestAccessPolicy) CheckDial(host string, ip net.IP) error {
+	if hostsMatch(p.DenyHosts, host, ip) {
+		return fmt.Errorf("access to %s(%s) is denied", host, ip)
+	}
+	if isInternalIP(ip) && !hostsMatch(p.AllowHosts, host, ip) {
+		return fmt.Errorf(
+			"access to internal address %s(%s) is not allowed unless configured in allow hosts", host, ip)
+	}
+	return nil
+}
+
+// hostsMatch host或ip是否命中hosts中的某一项
+func hostsMatch(hosts []string, host string, ip net.IP) bool {
+	for _, item := range hosts {
+		if strings.Contains(item, "/") {
+			_, ipNet, err := net.ParseCIDR(item)
+			if err == nil && ipNet.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if itemIP := net.ParseIP(item); itemIP != nil {
+			if itemIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(strings.TrimSuffix(item, "."), strings.TrimSuffix(host, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// dialContext 域名解析后、建立连接前检查实际要连接的ip，重定向后的请求同样经过此检查
+func dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	policy := httpRequestAccessPolicy
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			ipStr, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(ipStr)
+			if ip == nil {
+				return fmt.Errorf("dialed address %s is not an ip", address)
+			}
+			return policy.CheckDial(host, ip)
+		}}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// newHttpRequestTransport 不走代理（否则检查的是代理的ip），所有连接都经过访问范围的检查
+func newHttpRequestTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialContext
+	return transport
+}
@@ -0,0 +1,109 @@
+package builtin_function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/fBloc/bloc-server/infrastructure/log"
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/pkg/json_path"
+	"github.com/fBloc/bloc-server/pkg/opt"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// JsonPathExtract 按照路径从json中取值，路径如 $.data.items[0].name 或 data.items.0.name
+type JsonPathExtract struct {
+	baseImplement
+}
+
+func (j *JsonPathExtract) IptConfig() ipt.IptSlice {
+	return ipt.IptSlice{
+		{
+			Key:     "extract_from",
+			Display: "json to extract from",
+			Must:    true,
+			Components: []*ipt.IptComponent{
+				{
+					ValueType:       value_type.JsonValueType,
+					FormControlType: value_object.JsonFormControl,
+					Hint:            "json",
+				},
+			},
+		},
+		{
+			Key:     "json_path",
+			Display: "json path",
+			Must:    true,
+			Components: []*ipt.IptComponent{
+				{
+					ValueType:       value_type.StringValueType,
+					FormControlType: value_object.InputFormControl,
+					Hint:            "like $.data.items[0].name",
+				},
+			},
+		},
+	}
+}
+
+func (j *JsonPathExtract) OptConfig() []*opt.Opt {
+	return []*opt.Opt{
+		{
+			Key:         "value",
+			Description: "extracted value, object & array are in json text",
+			ValueType:   value_type.StringValueType,
+		},
+		{
+			Key:         "found",
+			Description: "whether the path exist",
+			ValueType:   value_type.BoolValueType,
+		},
+	}
+}
+
+func (j *JsonPathExtract) Run(
+	ctx context.Context,
+	ipts ipt.IptSlice,
+	progressReportChan chan value_object.FunctionRunStatus,
+	blocOptChan chan *value_object.FunctionRunOpt,
+	logger *log.Logger,
+) {
+	run(ctx, ipts, blocOptChan, logger, j.run)
+}
+
+func (j *JsonPathExtract) run(ctx context.Context, ipts ipt.IptSlice) (map[string]interface{}, error) {
+	data, err := jsonObject(iptValue(ipts, 0))
+	if err != nil {
+		return nil, err
+	}
+	path, ok := iptValue(ipts, 1).(string)
+	if !ok {
+		return nil, fmt.Errorf("json_path should be string")
+	}
+
+	value, found, err := ExtractJsonPath(data, path)
+	if err != nil {
+		return nil, err
+	}
+	valueStr := ""
+	if found {
+		if str, ok := value.(string); ok {
+			valueStr = str
+		} else {
+			raw, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			valueStr = string(raw)
+		}
+	}
+	return map[string]interface{}{"value": valueStr, "found": found}, nil
+}
+
+// ExtractJsonPath 按照路径从data中取值，路径不存在时found为false
+func ExtractJsonPath(
+	data interface{}, path string,
+) (value interface{}, found bool, err error) {
+	return json_path.Extract(data, path)
+}
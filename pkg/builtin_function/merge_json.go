@@ -0,0 +1,80 @@
+package builtin_function
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fBloc/bloc-server/infrastructure/log"
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/pkg/opt"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// MergeJsonMaxAmount 最多可以合并的json数目
+const MergeJsonMaxAmount = 5
+
+// MergeJson 将多个json对象（一般来自多个上游节点的opt）合并为一个，
+// 合并只在第一层进行，同名的key以排序靠后的为准，没有提供值的json会被忽略
+type MergeJson struct {
+	baseImplement
+}
+
+func (m *MergeJson) IptConfig() ipt.IptSlice {
+	components := make([]*ipt.IptComponent, 0, MergeJsonMaxAmount)
+	for i := 1; i <= MergeJsonMaxAmount; i++ {
+		components = append(components, &ipt.IptComponent{
+			ValueType:       value_type.JsonValueType,
+			FormControlType: value_object.JsonFormControl,
+			Hint:            fmt.Sprintf("json %d", i),
+		})
+	}
+	return ipt.IptSlice{
+		{
+			Key:        "to_merge_jsons",
+			Display:    "json objects to merge",
+			Must:       true,
+			Components: components,
+		},
+	}
+}
+
+func (m *MergeJson) OptConfig() []*opt.Opt {
+	return []*opt.Opt{
+		{
+			Key:         "merged",
+			Description: "merged json object",
+			ValueType:   value_type.JsonValueType,
+		},
+	}
+}
+
+func (m *MergeJson) Run(
+	ctx context.Context,
+	ipts ipt.IptSlice,
+	progressReportChan chan value_object.FunctionRunStatus,
+	blocOptChan chan *value_object.FunctionRunOpt,
+	logger *log.Logger,
+) {
+	run(ctx, ipts, blocOptChan, logger, m.run)
+}
+
+func (m *MergeJson) run(ctx context.Context, ipts ipt.IptSlice) (map[string]interface{}, error) {
+	merged := make(map[string]interface{})
+	if len(ipts) > 0 {
+		for index, component := range ipts[0].Components {
+			value, err := jsonObject(component.Value)
+			if err != nil {
+				return nil, fmt.Errorf("json %d: %v", index+1, err)
+			}
+			for key, val := range value {
+				merged[key] = val
+			}
+		}
+	}
+	mergedStr, err := jsonString(merged)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"merged": mergedStr}, nil
+}
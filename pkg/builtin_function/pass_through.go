@@ -0,0 +1,65 @@
+package builtin_function
+
+import (
+	"context"
+
+	"github.com/fBloc/bloc-server/infrastructure/log"
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/pkg/opt"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// PassThrough 原样输出输入的json，输入可以是用户填写的常量，也可以来自上游节点的opt
+type PassThrough struct {
+	baseImplement
+}
+
+func (p *PassThrough) IptConfig() ipt.IptSlice {
+	return ipt.IptSlice{
+		{
+			Key:     "pass_value",
+			Display: "value to pass through",
+			Must:    true,
+			Components: []*ipt.IptComponent{
+				{
+					ValueType:       value_type.JsonValueType,
+					FormControlType: value_object.JsonFormControl,
+					Hint:            "constant or upstream json",
+				},
+			},
+		},
+	}
+}
+
+func (p *PassThrough) OptConfig() []*opt.Opt {
+	return []*opt.Opt{
+		{
+			Key:         "value",
+			Description: "the same as input",
+			ValueType:   value_type.JsonValueType,
+		},
+	}
+}
+
+func (p *PassThrough) Run(
+	ctx context.Context,
+	ipts ipt.IptSlice,
+	progressReportChan chan value_object.FunctionRunStatus,
+	blocOptChan chan *value_object.FunctionRunOpt,
+	logger *log.Logger,
+) {
+	run(ctx, ipts, blocOptChan, logger, p.run)
+}
+
+func (p *PassThrough) run(ctx context.Context, ipts ipt.IptSlice) (map[string]interface{}, error) {
+	value, err := jsonObject(iptValue(ipts, 0))
+	if err != nil {
+		return nil, err
+	}
+	valueStr, err := jsonString(value)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"value": valueStr}, nil
+}
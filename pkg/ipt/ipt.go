@@ -1,7 +1,10 @@
 package ipt
 
 import (
+	"encoding/json"
+	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/fBloc/bloc-server/pkg/value_type"
 
@@ -91,6 +94,62 @@ func (iS *IptSlice) GetJsonStrMapValue(iptIndex int, componentIndex int) (map[st
 	return (*iS)[iptIndex].GetJsonStrMapValue(componentIndex)
 }
 
+func (iS *IptSlice) GetJsonArrayValue(iptIndex int, componentIndex int) ([]interface{}, error) {
+	err := iS.iptIndexValid(iptIndex)
+	if err != nil {
+		return []interface{}{}, err
+	}
+	return (*iS)[iptIndex].GetJsonArrayValue(componentIndex)
+}
+
+func (iS *IptSlice) GetJsonValue(iptIndex int, componentIndex int) (interface{}, error) {
+	err := iS.iptIndexValid(iptIndex)
+	if err != nil {
+		return nil, err
+	}
+	return (*iS)[iptIndex].GetJsonValue(componentIndex)
+}
+
+func (iS *IptSlice) GetDatetimeValue(iptIndex int, componentIndex int) (time.Time, error) {
+	err := iS.iptIndexValid(iptIndex)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return (*iS)[iptIndex].GetDatetimeValue(componentIndex)
+}
+
+func (iS *IptSlice) GetDatetimeSliceValue(iptIndex int, componentIndex int) ([]time.Time, error) {
+	err := iS.iptIndexValid(iptIndex)
+	if err != nil {
+		return []time.Time{}, err
+	}
+	return (*iS)[iptIndex].GetDatetimeSliceValue(componentIndex)
+}
+
+func (iS *IptSlice) GetObjectRefValue(iptIndex int, componentIndex int) (value_type.ObjectRef, error) {
+	err := iS.iptIndexValid(iptIndex)
+	if err != nil {
+		return value_type.ObjectRef{}, err
+	}
+	return (*iS)[iptIndex].GetObjectRefValue(componentIndex)
+}
+
+func (iS *IptSlice) GetObjectRefSliceValue(iptIndex int, componentIndex int) ([]value_type.ObjectRef, error) {
+	err := iS.iptIndexValid(iptIndex)
+	if err != nil {
+		return []value_type.ObjectRef{}, err
+	}
+	return (*iS)[iptIndex].GetObjectRefSliceValue(componentIndex)
+}
+
+func (iS *IptSlice) GetEnumValue(iptIndex int, componentIndex int) (interface{}, error) {
+	err := iS.iptIndexValid(iptIndex)
+	if err != nil {
+		return nil, err
+	}
+	return (*iS)[iptIndex].GetEnumValue(componentIndex)
+}
+
 type Ipt struct {
 	Key        string          `json:"key"`
 	Display    string          `json:"display"`
@@ -254,8 +313,177 @@ func (ipt *Ipt) GetJsonStrMapValue(componentIndex int) (map[string]interface{},
 	if component.ValueType != value_type.JsonValueType {
 		return map[string]interface{}{}, errors.Errorf("valueType should be json but get: %s", component.ValueType)
 	}
+	value, err := decodeJsonValue(component.Value)
+	if err != nil {
+		return map[string]interface{}{}, err
+	}
+	resp, ok := value.(map[string]interface{})
+	if !ok {
+		return map[string]interface{}{}, errors.Errorf("value should be a json object but get: %T", value)
+	}
+	return resp, nil
+}
+
+func (ipt *Ipt) GetJsonArrayValue(componentIndex int) ([]interface{}, error) {
+	component, err := ipt.component(componentIndex, value_type.JsonValueType)
+	if err != nil {
+		return []interface{}{}, err
+	}
+	value, err := decodeJsonValue(component.Value)
+	if err != nil {
+		return []interface{}{}, err
+	}
+	resp, ok := value.([]interface{})
+	if !ok {
+		return []interface{}{}, errors.Errorf("value should be a json array but get: %T", value)
+	}
+	return resp, nil
+}
+
+// GetJsonValue 返回json object(map[string]interface{})或array([]interface{})
+func (ipt *Ipt) GetJsonValue(componentIndex int) (interface{}, error) {
+	component, err := ipt.component(componentIndex, value_type.JsonValueType)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJsonValue(component.Value)
+}
+
+func (ipt *Ipt) GetDatetimeValue(componentIndex int) (time.Time, error) {
+	component, err := ipt.component(componentIndex, value_type.DatetimeValueType)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if component.AllowMulti {
+		return time.Time{}, errors.New("value should be a datetimeSlice")
+	}
+	return value_type.ParseDatetime(component.Value)
+}
+
+func (ipt *Ipt) GetDatetimeSliceValue(componentIndex int) ([]time.Time, error) {
+	component, err := ipt.component(componentIndex, value_type.DatetimeValueType)
+	if err != nil {
+		return []time.Time{}, err
+	}
+	if !component.AllowMulti {
+		t, err := value_type.ParseDatetime(component.Value)
+		if err != nil {
+			return []time.Time{}, err
+		}
+		return []time.Time{t}, nil
+	}
+	values := toInterfaceSlice(component.Value)
+	resp := make([]time.Time, 0, len(values))
+	for _, value := range values {
+		t, err := value_type.ParseDatetime(value)
+		if err != nil {
+			return []time.Time{}, err
+		}
+		resp = append(resp, t)
+	}
+	return resp, nil
+}
+
+func (ipt *Ipt) GetObjectRefValue(componentIndex int) (value_type.ObjectRef, error) {
+	component, err := ipt.component(
+		componentIndex, value_type.FileValueType, value_type.ObjectRefValueType)
+	if err != nil {
+		return value_type.ObjectRef{}, err
+	}
+	if component.AllowMulti {
+		return value_type.ObjectRef{}, errors.New("value should be a objectRefSlice")
+	}
+	return value_type.ParseObjectRef(component.Value)
+}
+
+func (ipt *Ipt) GetObjectRefSliceValue(componentIndex int) ([]value_type.ObjectRef, error) {
+	component, err := ipt.component(
+		componentIndex, value_type.FileValueType, value_type.ObjectRefValueType)
+	if err != nil {
+		return []value_type.ObjectRef{}, err
+	}
 	if !component.AllowMulti {
-		return map[string]interface{}{}, nil
+		ref, err := value_type.ParseObjectRef(component.Value)
+		if err != nil {
+			return []value_type.ObjectRef{}, err
+		}
+		return []value_type.ObjectRef{ref}, nil
+	}
+	values := toInterfaceSlice(component.Value)
+	resp := make([]value_type.ObjectRef, 0, len(values))
+	for _, value := range values {
+		ref, err := value_type.ParseObjectRef(value)
+		if err != nil {
+			return []value_type.ObjectRef{}, err
+		}
+		resp = append(resp, ref)
 	}
-	return cast.ToStringMap(component.Value), nil
+	return resp, nil
+}
+
+// GetEnumValue 返回值需要是AllowedValues之一，AllowMulti时返回的是[]interface{}
+func (ipt *Ipt) GetEnumValue(componentIndex int) (interface{}, error) {
+	component, err := ipt.component(componentIndex, value_type.EnumValueType)
+	if err != nil {
+		return nil, err
+	}
+	value := component.Value
+	if component.AllowMulti {
+		value = toInterfaceSlice(value)
+	}
+	if !component.ValueAllowed(value) {
+		return nil, errors.Errorf("value %v not in allowed values %v", value, component.AllowedValues)
+	}
+	return value, nil
+}
+
+// component 取出第componentIndex个component，并检测其类型是valueTypes之一
+func (ipt *Ipt) component(
+	componentIndex int, valueTypes ...value_type.ValueType,
+) (*IptComponent, error) {
+	if componentIndex < 0 || componentIndex >= len(ipt.Components) {
+		return nil, errors.New("index out of range")
+	}
+	component := ipt.Components[componentIndex]
+	for _, valueType := range valueTypes {
+		if component.ValueType == valueType {
+			return component, nil
+		}
+	}
+	return nil, errors.Errorf("valueType should be %v but get: %s", valueTypes, component.ValueType)
+}
+
+// decodeJsonValue json字符串反序列化，map/slice(如bson反序列化得到的)经json转换为map[string]interface{}/[]interface{}
+func decodeJsonValue(value interface{}) (interface{}, error) {
+	var raw []byte
+	if valueStr, ok := value.(string); ok {
+		raw = []byte(valueStr)
+	} else {
+		var err error
+		raw, err = json.Marshal(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal json value failed")
+		}
+	}
+	var resp interface{}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, errors.Wrap(err, "unmarshal json value failed")
+	}
+	switch resp.(type) {
+	case map[string]interface{}, []interface{}:
+		return resp, nil
+	}
+	return nil, errors.Errorf("value should be json object or array but get: %T", resp)
+}
+
+func toInterfaceSlice(value interface{}) []interface{} {
+	if value == nil || reflect.TypeOf(value).Kind() != reflect.Slice {
+		return []interface{}{value}
+	}
+	s := reflect.ValueOf(value)
+	resp := make([]interface{}, 0, s.Len())
+	for i := 0; i < s.Len(); i++ {
+		resp = append(resp, s.Index(i).Interface())
+	}
+	return resp
 }
@@ -1,9 +1,11 @@
 package ipt
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 
+	"github.com/fBloc/bloc-server/pkg/json_schema"
 	"github.com/fBloc/bloc-server/pkg/value_type"
 	"github.com/fBloc/bloc-server/value_object"
 )
@@ -20,7 +22,9 @@ type IptComponent struct {
 	Hint            string                       `json:"hint"`
 	DefaultValue    interface{}                  `json:"default_value"`
 	AllowMulti      bool                         `json:"allow_multi"`
-	SelectOptions   []SelectOption               `json:"select_options"` // only exist when FormControlType is selection
+	SelectOptions   []SelectOption               `json:"select_options"`        // only exist when FormControlType is selection
+	AllowedValues   []interface{}                `json:"allowed_values"`        // only exist when ValueType is enum
+	JsonSchema      json.RawMessage              `json:"json_schema,omitempty"` // only exist when ValueType is json
 	Value           interface{}                  `json:"-"`
 }
 
@@ -29,9 +33,57 @@ func (ipt *IptComponent) String() string {
 	for _, option := range ipt.SelectOptions {
 		resp = resp + fmt.Sprintf("%v", option.Value)
 	}
+	for _, allowedValue := range ipt.AllowedValues {
+		resp = resp + fmt.Sprintf("%v", allowedValue)
+	}
+	if len(ipt.JsonSchema) > 0 {
+		schema, err := json_schema.Canonical(ipt.JsonSchema)
+		if err != nil {
+			schema = string(ipt.JsonSchema)
+		}
+		resp = resp + schema
+	}
 	return resp
 }
 
+// ValidateJsonSchema 值是否满足JsonSchema，没有schema时不做检测
+// AllowMulti时值的每个元素都需要满足，返回的JSON Pointer以元素的序号开头
+func (ipt *IptComponent) ValidateJsonSchema(value interface{}) error {
+	if len(ipt.JsonSchema) == 0 || ipt.ValueType != value_type.JsonValueType {
+		return nil
+	}
+	if !ipt.AllowMulti {
+		return json_schema.Validate(ipt.JsonSchema, value)
+	}
+	var errs json_schema.ValidationErrors
+	for index, item := range toInterfaceSlice(value) {
+		err := json_schema.Validate(ipt.JsonSchema, item)
+		if err == nil {
+			continue
+		}
+		itemErrs, ok := err.(json_schema.ValidationErrors)
+		if !ok {
+			return err
+		}
+		for _, itemErr := range itemErrs {
+			itemErr.Pointer = json_schema.Pointer(strconv.Itoa(index)) + itemErr.Pointer
+			errs = append(errs, itemErr)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValueAllowed enum类型的值需要是AllowedValues之一，其他类型不做限制
+func (ipt *IptComponent) ValueAllowed(value interface{}) bool {
+	if ipt.ValueType != value_type.EnumValueType {
+		return true
+	}
+	return value_type.CheckEnumValueValid(ipt.AllowedValues, value)
+}
+
 func (ipt *IptComponent) Config() map[string]interface{} {
 	config := make(map[string]interface{}, 6)
 	config["value_type"] = ipt.ValueType
@@ -40,5 +92,11 @@ func (ipt *IptComponent) Config() map[string]interface{} {
 	config["value"] = ipt.DefaultValue
 	config["allow_multi"] = ipt.AllowMulti
 	config["options"] = ipt.SelectOptions
+	if len(ipt.AllowedValues) > 0 {
+		config["allowed_values"] = ipt.AllowedValues
+	}
+	if len(ipt.JsonSchema) > 0 {
+		config["json_schema"] = ipt.JsonSchema
+	}
 	return config
 }
@@ -0,0 +1,102 @@
+package ipt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/pkg/json_schema"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIptGetter(t *testing.T) {
+	ipt := &Ipt{
+		Key: "ipt",
+		Components: []*IptComponent{
+			{ValueType: value_type.JsonValueType, Value: `{"a": 1}`},
+			{ValueType: value_type.JsonValueType, Value: primitive.A{"x", "y"}},
+			{ValueType: value_type.DatetimeValueType, Value: "2022-01-02T15:04:05Z"},
+			{ValueType: value_type.DatetimeValueType, AllowMulti: true,
+				Value: []interface{}{"2022-01-02T15:04:05Z", "2022-01-03T15:04:05Z"}},
+			{ValueType: value_type.FileValueType,
+				Value: map[string]interface{}{"key": "k", "size": 3, "content_type": "text/plain"}},
+			{ValueType: value_type.EnumValueType,
+				AllowedValues: []interface{}{"small", "large"}, Value: "small"},
+			{ValueType: value_type.EnumValueType,
+				AllowedValues: []interface{}{"small", "large"}, Value: "medium"},
+		},
+	}
+
+	Convey("json", t, func() {
+		obj, err := ipt.GetJsonStrMapValue(0)
+		So(err, ShouldBeNil)
+		So(obj["a"], ShouldEqual, 1)
+		arr, err := ipt.GetJsonArrayValue(1)
+		So(err, ShouldBeNil)
+		So(arr, ShouldResemble, []interface{}{"x", "y"})
+		_, err = ipt.GetJsonArrayValue(0)
+		So(err, ShouldNotBeNil)
+		_, err = ipt.GetJsonValue(2)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("datetime", t, func() {
+		dt, err := ipt.GetDatetimeValue(2)
+		So(err, ShouldBeNil)
+		So(dt.Equal(time.Date(2022, 1, 2, 15, 4, 5, 0, time.UTC)), ShouldBeTrue)
+		dts, err := ipt.GetDatetimeSliceValue(3)
+		So(err, ShouldBeNil)
+		So(len(dts), ShouldEqual, 2)
+		_, err = ipt.GetDatetimeValue(3)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("object ref", t, func() {
+		ref, err := ipt.GetObjectRefValue(4)
+		So(err, ShouldBeNil)
+		So(ref, ShouldResemble, value_type.ObjectRef{Key: "k", Size: 3, ContentType: "text/plain"})
+		refs, err := ipt.GetObjectRefSliceValue(4)
+		So(err, ShouldBeNil)
+		So(len(refs), ShouldEqual, 1)
+	})
+
+	Convey("enum", t, func() {
+		value, err := ipt.GetEnumValue(5)
+		So(err, ShouldBeNil)
+		So(value, ShouldEqual, "small")
+		_, err = ipt.GetEnumValue(6)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("index out of range", t, func() {
+		_, err := ipt.GetEnumValue(7)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestIptComponentValidateJsonSchema(t *testing.T) {
+	schema := []byte(`{"type": "object", "required": ["name"]}`)
+
+	Convey("single value", t, func() {
+		component := &IptComponent{ValueType: value_type.JsonValueType, JsonSchema: schema}
+		So(component.ValidateJsonSchema(`{"name": "bloc"}`), ShouldBeNil)
+		So(component.ValidateJsonSchema(`{}`), ShouldNotBeNil)
+	})
+
+	Convey("allow multi prefix the item index", t, func() {
+		component := &IptComponent{
+			ValueType: value_type.JsonValueType, AllowMulti: true, JsonSchema: schema}
+		So(component.ValidateJsonSchema([]interface{}{`{"name": "a"}`, `{"name": "b"}`}), ShouldBeNil)
+		err := component.ValidateJsonSchema([]interface{}{`{"name": "a"}`, `{}`})
+		So(err, ShouldNotBeNil)
+		errs, ok := err.(json_schema.ValidationErrors)
+		So(ok, ShouldBeTrue)
+		So(errs[0].Pointer, ShouldEqual, "/1/name")
+	})
+
+	Convey("no schema", t, func() {
+		component := &IptComponent{ValueType: value_type.JsonValueType}
+		So(component.ValidateJsonSchema(`{}`), ShouldBeNil)
+	})
+}
@@ -0,0 +1,58 @@
+// @Title  json_path
+// @Description 简单的json路径，如 $.data.items[0].name 或 data.items.0.name
+package json_path
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Extract 按照路径从data中取值，路径不存在时found为false
+func Extract(
+	data interface{}, path string,
+) (value interface{}, found bool, err error) {
+	segments, err := Parse(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	value = data
+	for _, segment := range segments {
+		switch current := value.(type) {
+		case map[string]interface{}:
+			value, found = current[segment]
+			if !found {
+				return nil, false, nil
+			}
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(current) {
+				return nil, false, nil
+			}
+			value = current[index]
+		default:
+			return nil, false, nil
+		}
+	}
+	return value, true, nil
+}
+
+// Parse 将路径拆分为逐层的key，数组下标也作为一层
+func Parse(path string) ([]string, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+	if strings.Count(path, "[") != strings.Count(path, "]") {
+		return nil, fmt.Errorf("invalid json path: %s", path)
+	}
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+
+	segments := make([]string, 0, strings.Count(path, ".")+1)
+	for _, segment := range strings.Split(path, ".") {
+		if segment == "" {
+			continue
+		}
+		segments = append(segments, strings.Trim(segment, `"'`))
+	}
+	return segments, nil
+}
@@ -0,0 +1,142 @@
+package json_schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+const incompatibleErrorType = "incompatible"
+
+// CheckCompatible 检测满足optSchema的值是否都满足iptSchema，用于connection连线的检测
+// 只做保守的结构检测：type、enum、required、properties、additionalProperties及items
+// 任一方没有schema时视为兼容(运行时仍会按ipt的schema检测值)
+// 不兼容时返回ValidationErrors，Pointer指向iptSchema中不兼容的位置
+func CheckCompatible(optSchema, iptSchema json.RawMessage) error {
+	if len(optSchema) == 0 || len(iptSchema) == 0 {
+		return nil
+	}
+	var opt, ipt interface{}
+	if err := json.Unmarshal(optSchema, &opt); err != nil {
+		return fmt.Errorf("opt schema is not valid json: %v", err)
+	}
+	if err := json.Unmarshal(iptSchema, &ipt); err != nil {
+		return fmt.Errorf("ipt schema is not valid json: %v", err)
+	}
+	optMap, optOk := opt.(map[string]interface{})
+	iptMap, iptOk := ipt.(map[string]interface{})
+	if !optOk || !iptOk { // boolean schema
+		return nil
+	}
+	var errs ValidationErrors
+	checkCompatible(optMap, iptMap, nil, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func checkCompatible(
+	opt, ipt map[string]interface{}, path []string, errs *ValidationErrors,
+) {
+	addErr := func(msg string, tokens ...string) {
+		*errs = append(*errs, ValidationError{
+			Pointer: Pointer(append(append([]string{}, path...), tokens...)...),
+			Type:    incompatibleErrorType,
+			Message: msg,
+		})
+	}
+
+	if iptTypes := schemaTypes(ipt); len(iptTypes) > 0 {
+		optTypes := schemaTypes(opt)
+		if len(optTypes) == 0 {
+			addErr(fmt.Sprintf("need type %v but upstream opt schema declares no type", iptTypes), "type")
+		}
+		for _, optType := range optTypes {
+			if !typeAccepted(iptTypes, optType) {
+				addErr(fmt.Sprintf("need type %v but upstream opt may be %s", iptTypes, optType), "type")
+			}
+		}
+	}
+
+	if iptEnum, ok := ipt["enum"].([]interface{}); ok {
+		optEnum, ok := opt["enum"].([]interface{})
+		if !ok {
+			addErr("need enum value but upstream opt schema declares no enum", "enum")
+		}
+		for _, optValue := range optEnum {
+			if !containsValue(iptEnum, optValue) {
+				addErr(fmt.Sprintf("upstream opt enum value %v not allowed", optValue), "enum")
+			}
+		}
+	}
+
+	if iptRequired, ok := ipt["required"].([]interface{}); ok {
+		optRequired, _ := opt["required"].([]interface{})
+		for _, property := range iptRequired {
+			if !containsValue(optRequired, property) {
+				addErr(fmt.Sprintf("property %v is required but upstream opt may lack it", property), "required")
+			}
+		}
+	}
+
+	iptProperties, _ := ipt["properties"].(map[string]interface{})
+	optProperties, _ := opt["properties"].(map[string]interface{})
+	for name, iptProperty := range iptProperties {
+		iptPropertyMap, iptOk := iptProperty.(map[string]interface{})
+		optPropertyMap, optOk := optProperties[name].(map[string]interface{})
+		if iptOk && optOk {
+			checkCompatible(
+				optPropertyMap, iptPropertyMap,
+				append(append([]string{}, path...), "properties", name), errs)
+		}
+	}
+	if additional, ok := ipt["additionalProperties"].(bool); ok && !additional {
+		for name := range optProperties {
+			if _, ok := iptProperties[name]; !ok {
+				addErr(fmt.Sprintf("upstream opt property %s not allowed", name), "additionalProperties")
+			}
+		}
+	}
+
+	iptItems, iptOk := ipt["items"].(map[string]interface{})
+	optItems, optOk := opt["items"].(map[string]interface{})
+	if iptOk && optOk {
+		checkCompatible(optItems, iptItems, append(append([]string{}, path...), "items"), errs)
+	}
+}
+
+func schemaTypes(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		resp := make([]string, 0, len(t))
+		for _, i := range t {
+			if s, ok := i.(string); ok {
+				resp = append(resp, s)
+			}
+		}
+		return resp
+	}
+	return nil
+}
+
+// typeAccepted integer是number的子集
+func typeAccepted(accepted []string, t string) bool {
+	for _, a := range accepted {
+		if a == t || (a == "number" && t == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+// @Title  json_schema
+// @Description json类型的ipt component/opt可以附带JSON Schema，用于约束值的结构
+package json_schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ValidationError 一处不满足schema的位置，Pointer为RFC6901格式的JSON Pointer
+type ValidationError struct {
+	Pointer string `json:"pointer"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors 实现了error，可以通过errors.As取出结构化的错误
+type ValidationErrors []ValidationError
+
+func (vEs ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(vEs))
+	for _, vE := range vEs {
+		pointer := vE.Pointer
+		if pointer == "" {
+			pointer = "/"
+		}
+		msgs = append(msgs, pointer+": "+vE.Message)
+	}
+	return "json schema not match: " + strings.Join(msgs, "; ")
+}
+
+var compiled sync.Map // canonical schema -> *gojsonschema.Schema
+
+// Canonical 将schema格式化为key有序且无空白的形式，用于digest及缓存
+func Canonical(schema json.RawMessage) (string, error) {
+	var decoded interface{}
+	if err := json.Unmarshal(schema, &decoded); err != nil {
+		return "", fmt.Errorf("schema is not valid json: %v", err)
+	}
+	resp, err := json.Marshal(decoded)
+	if err != nil {
+		return "", err
+	}
+	return string(resp), nil
+}
+
+func compile(schema json.RawMessage) (*gojsonschema.Schema, error) {
+	canonical, err := Canonical(schema)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := compiled.Load(canonical); ok {
+		return s.(*gojsonschema.Schema), nil
+	}
+	s, err := gojsonschema.NewSchema(gojsonschema.NewStringLoader(canonical))
+	if err != nil {
+		return nil, fmt.Errorf("schema not valid: %v", err)
+	}
+	compiled.Store(canonical, s)
+	return s, nil
+}
+
+// CheckSchemaValid schema是否是有效的JSON Schema
+func CheckSchemaValid(schema json.RawMessage) error {
+	_, err := compile(schema)
+	return err
+}
+
+// Validate 检测值是否满足schema，值可以是json字符串或者能序列化为json的值
+// 值满足时返回nil，不满足时返回ValidationErrors
+func Validate(schema json.RawMessage, value interface{}) error {
+	s, err := compile(schema)
+	if err != nil {
+		return err
+	}
+	var loader gojsonschema.JSONLoader
+	if valueStr, ok := value.(string); ok {
+		loader = gojsonschema.NewStringLoader(valueStr)
+	} else {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("value cannot marshal to json: %v", err)
+		}
+		loader = gojsonschema.NewBytesLoader(raw)
+	}
+	result, err := s.Validate(loader)
+	if err != nil {
+		return fmt.Errorf("validate failed: %v", err)
+	}
+	if result.Valid() {
+		return nil
+	}
+	resp := make(ValidationErrors, 0, len(result.Errors()))
+	for _, resultErr := range result.Errors() {
+		tokens := contextTokens(resultErr.Context())
+		// required错误的位置是缺少字段的对象，指向缺少的字段更直观
+		if resultErr.Type() == "required" {
+			if property, ok := resultErr.Details()["property"].(string); ok {
+				tokens = append(tokens, property)
+			}
+		}
+		resp = append(resp, ValidationError{
+			Pointer: Pointer(tokens...),
+			Type:    resultErr.Type(),
+			Message: resultErr.Description(),
+		})
+	}
+	return resp
+}
+
+// contextTokens gojsonschema的context形如(root).a.0，转为路径的各段
+func contextTokens(context *gojsonschema.JsonContext) []string {
+	if context == nil {
+		return nil
+	}
+	const delimiter = "\x00"
+	tokens := strings.Split(context.String(delimiter), delimiter)
+	if len(tokens) > 0 && tokens[0] == gojsonschema.STRING_CONTEXT_ROOT {
+		tokens = tokens[1:]
+	}
+	return tokens
+}
+
+// Pointer 由路径的各段生成JSON Pointer
+func Pointer(tokens ...string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		token = strings.ReplaceAll(token, "~", "~0")
+		token = strings.ReplaceAll(token, "/", "~1")
+		b.WriteString("/" + token)
+	}
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package json_schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var personSchema = json.RawMessage(`{
+	"type": "object",
+	"required": ["name"],
+	"properties": {
+		"name": {"type": "string"},
+		"tags": {"type": "array", "items": {"type": "string"}}
+	}
+}`)
+
+func TestCheckSchemaValid(t *testing.T) {
+	Convey("CheckSchemaValid", t, func() {
+		So(CheckSchemaValid(personSchema), ShouldBeNil)
+		So(CheckSchemaValid(json.RawMessage(`{"type": "not_exist_type"}`)), ShouldNotBeNil)
+		So(CheckSchemaValid(json.RawMessage(`{"type": `)), ShouldNotBeNil)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	Convey("valid value", t, func() {
+		So(Validate(personSchema, `{"name": "bloc", "tags": ["a"]}`), ShouldBeNil)
+		So(Validate(personSchema, map[string]interface{}{"name": "bloc"}), ShouldBeNil)
+	})
+
+	Convey("errors with json pointer", t, func() {
+		err := Validate(personSchema, `{"tags": ["a", 1]}`)
+		So(err, ShouldNotBeNil)
+		errs, ok := err.(ValidationErrors)
+		So(ok, ShouldBeTrue)
+		pointers := make([]string, 0, len(errs))
+		for _, e := range errs {
+			pointers = append(pointers, e.Pointer)
+		}
+		So(pointers, ShouldContain, "/name")
+		So(pointers, ShouldContain, "/tags/1")
+	})
+
+	Convey("Pointer escape", t, func() {
+		So(Pointer("a/b", "c~d", "0"), ShouldEqual, "/a~1b/c~0d/0")
+		So(Pointer(), ShouldEqual, "")
+	})
+}
+
+func TestCheckCompatible(t *testing.T) {
+	Convey("no schema is compatible", t, func() {
+		So(CheckCompatible(nil, personSchema), ShouldBeNil)
+		So(CheckCompatible(personSchema, nil), ShouldBeNil)
+	})
+
+	Convey("compatible", t, func() {
+		opt := json.RawMessage(`{
+			"type": "object",
+			"required": ["name", "age"],
+			"properties": {"name": {"type": "string"}, "age": {"type": "integer"}}
+		}`)
+		So(CheckCompatible(opt, personSchema), ShouldBeNil)
+		So(CheckCompatible(
+			json.RawMessage(`{"type": "integer"}`), json.RawMessage(`{"type": "number"}`)), ShouldBeNil)
+	})
+
+	Convey("incompatible", t, func() {
+		opt := json.RawMessage(`{
+			"type": "object",
+			"properties": {"name": {"type": "integer"}}
+		}`)
+		err := CheckCompatible(opt, personSchema)
+		So(err, ShouldNotBeNil)
+		errs, ok := err.(ValidationErrors)
+		So(ok, ShouldBeTrue)
+		pointers := make([]string, 0, len(errs))
+		for _, e := range errs {
+			pointers = append(pointers, e.Pointer)
+		}
+		So(pointers, ShouldContain, "/required")
+		So(pointers, ShouldContain, "/properties/name/type")
+
+		So(CheckCompatible(
+			json.RawMessage(`{"type": "array"}`), json.RawMessage(`{"type": "object"}`)), ShouldNotBeNil)
+		So(CheckCompatible(
+			json.RawMessage(`{"enum": ["a", "b"]}`), json.RawMessage(`{"enum": ["a"]}`)), ShouldNotBeNil)
+		So(CheckCompatible(
+			json.RawMessage(`{"properties": {"extra": {}}}`),
+			json.RawMessage(`{"additionalProperties": false}`)), ShouldNotBeNil)
+	})
+}
@@ -3,8 +3,10 @@
 package opt
 
 import (
+	"encoding/json"
 	"strconv"
 
+	"github.com/fBloc/bloc-server/pkg/json_schema"
 	"github.com/fBloc/bloc-server/pkg/value_type"
 )
 
@@ -13,10 +15,20 @@ type Opt struct {
 	Description string               `json:"description"`
 	ValueType   value_type.ValueType `json:"value_type"`
 	IsArray     bool                 `json:"is_array"`
+	// 仅json类型的opt可以有，用于检测连接到的ipt的schema是否兼容
+	JsonSchema json.RawMessage `json:"json_schema,omitempty"`
 }
 
 func (opt *Opt) String() string {
-	return opt.Key + opt.Description + string(opt.ValueType) + strconv.FormatBool(opt.IsArray)
+	resp := opt.Key + opt.Description + string(opt.ValueType) + strconv.FormatBool(opt.IsArray)
+	if len(opt.JsonSchema) > 0 {
+		schema, err := json_schema.Canonical(opt.JsonSchema)
+		if err != nil {
+			schema = string(opt.JsonSchema)
+		}
+		resp += schema
+	}
+	return resp
 }
 
 func (opt *Opt) Config() map[string]interface{} {
@@ -25,5 +37,8 @@ func (opt *Opt) Config() map[string]interface{} {
 	config["value_type"] = opt.ValueType
 	config["description"] = opt.Description
 	config["is_array"] = opt.IsArray
+	if len(opt.JsonSchema) > 0 {
+		config["json_schema"] = opt.JsonSchema
+	}
 	return config
 }
@@ -0,0 +1,298 @@
+// @Title  transform
+// @Description connection边上的转换表达式，由以 | 分隔的若干步骤组成
+// 如 `$.data.items | first | to_int`：
+//   - 以 $ 开头的步骤为json路径，从json值中取出对应的部分
+//   - 其余步骤为内置的转换函数，见 functions
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fBloc/bloc-server/pkg/json_path"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+
+	"github.com/spf13/cast"
+)
+
+// Type 表达式输入/输出的类型，ValueType为空表示静态无法推断、运行时才可知
+type Type struct {
+	ValueType  value_type.ValueType
+	IsArray    bool
+	JsonSchema json.RawMessage
+}
+
+func (t Type) Known() bool {
+	return t.ValueType != ""
+}
+
+func (t Type) String() string {
+	if !t.Known() {
+		return "unknown"
+	}
+	if t.IsArray {
+		return "[]" + string(t.ValueType)
+	}
+	return string(t.ValueType)
+}
+
+type function struct {
+	check func(Type) (Type, error)
+	apply func(interface{}) (interface{}, error)
+}
+
+var functions = map[string]function{
+	"to_int":    castFunction(value_type.IntValueType, func(v interface{}) (interface{}, error) { return cast.ToIntE(v) }),
+	"to_float":  castFunction(value_type.FloatValueType, func(v interface{}) (interface{}, error) { return cast.ToFloat64E(v) }),
+	"to_string": castFunction(value_type.StringValueType, func(v interface{}) (interface{}, error) { return cast.ToStringE(v) }),
+	"to_bool":   castFunction(value_type.BoolValueType, func(v interface{}) (interface{}, error) { return cast.ToBoolE(v) }),
+	"to_json":   castFunction(value_type.JsonValueType, toJson),
+	"to_array": {
+		check: func(in Type) (Type, error) {
+			if in.IsArray {
+				return Type{}, errors.New("to_array: input is already an array")
+			}
+			in.IsArray = true
+			return in, nil
+		},
+		apply: func(v interface{}) (interface{}, error) {
+			if arr, ok := v.([]interface{}); ok {
+				return arr, nil
+			}
+			return []interface{}{v}, nil
+		},
+	},
+	"first": {
+		check: func(in Type) (Type, error) {
+			if in.Known() && !in.IsArray {
+				return Type{}, fmt.Errorf("first: input type %s is not an array", in)
+			}
+			in.IsArray = false
+			return in, nil
+		},
+		apply: func(v interface{}) (interface{}, error) {
+			arr, ok := v.([]interface{})
+			if !ok {
+				return nil, errors.New("first: input is not an array")
+			}
+			if len(arr) == 0 {
+				return nil, errors.New("first: input is an empty array")
+			}
+			return arr[0], nil
+		},
+	},
+	"len": {
+		check: func(in Type) (Type, error) {
+			if in.Known() && !in.IsArray &&
+				in.ValueType != value_type.StringValueType && in.ValueType != value_type.JsonValueType {
+				return Type{}, fmt.Errorf("len: input type %s has no length", in)
+			}
+			return Type{ValueType: value_type.IntValueType}, nil
+		},
+		apply: func(v interface{}) (interface{}, error) {
+			switch val := v.(type) {
+			case []interface{}:
+				return len(val), nil
+			case map[string]interface{}:
+				return len(val), nil
+			case string:
+				return len(val), nil
+			}
+			return nil, fmt.Errorf("len: input %v has no length", v)
+		},
+	},
+}
+
+// castFunction 类型转换函数，输入为数组时逐个元素转换(to_json除外，json本身可以是数组)
+func castFunction(
+	to value_type.ValueType, caster func(interface{}) (interface{}, error),
+) function {
+	return function{
+		check: func(in Type) (Type, error) {
+			if to == value_type.JsonValueType {
+				return Type{ValueType: to}, nil
+			}
+			return Type{ValueType: to, IsArray: in.IsArray}, nil
+		},
+		apply: func(v interface{}) (interface{}, error) {
+			arr, ok := v.([]interface{})
+			if !ok || to == value_type.JsonValueType {
+				return caster(v)
+			}
+			ret := make([]interface{}, len(arr))
+			for i, item := range arr {
+				tmp, err := caster(item)
+				if err != nil {
+					return nil, err
+				}
+				ret[i] = tmp
+			}
+			return ret, nil
+		},
+	}
+}
+
+func toJson(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case map[string]interface{}, []interface{}:
+		return val, nil
+	case string:
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(val), &decoded); err != nil {
+			return nil, fmt.Errorf("to_json: %w", err)
+		}
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("to_json: cannot convert %v to json", v)
+}
+
+func steps(expr string) ([]string, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, errors.New("empty transform expression")
+	}
+	ret := strings.Split(expr, "|")
+	for i, step := range ret {
+		ret[i] = strings.TrimSpace(step)
+		if ret[i] == "" {
+			return nil, fmt.Errorf("transform expression %q has empty step", expr)
+		}
+	}
+	return ret, nil
+}
+
+func isPathStep(step string) bool {
+	return strings.HasPrefix(step, "$")
+}
+
+// Check 静态检查表达式，返回根据输入类型推断出的输出类型
+func Check(expr string, input Type) (Type, error) {
+	stepItems, err := steps(expr)
+	if err != nil {
+		return Type{}, err
+	}
+
+	current := input
+	for _, step := range stepItems {
+		if isPathStep(step) {
+			if current.Known() &&
+				(current.IsArray || current.ValueType != value_type.JsonValueType) {
+				return Type{}, fmt.Errorf(
+					"json path %s requires json input, got %s", step, current)
+			}
+			segments, err := json_path.Parse(step)
+			if err != nil {
+				return Type{}, err
+			}
+			current = typeOfSchemaPath(current.JsonSchema, segments)
+			continue
+		}
+
+		f, ok := functions[step]
+		if !ok {
+			return Type{}, fmt.Errorf("unknown transform function: %s", step)
+		}
+		current, err = f.check(current)
+		if err != nil {
+			return Type{}, err
+		}
+	}
+	return current, nil
+}
+
+// typeOfSchemaPath 沿着路径在JSON Schema中找到对应的子schema并推断类型，无法推断时返回unknown
+func typeOfSchemaPath(schema json.RawMessage, segments []string) Type {
+	if len(schema) == 0 {
+		return Type{}
+	}
+	var node map[string]interface{}
+	if err := json.Unmarshal(schema, &node); err != nil {
+		return Type{}
+	}
+	for _, segment := range segments {
+		switch node["type"] {
+		case "object":
+			properties, _ := node["properties"].(map[string]interface{})
+			node, _ = properties[segment].(map[string]interface{})
+		case "array":
+			if _, err := cast.ToIntE(segment); err != nil {
+				return Type{}
+			}
+			node, _ = node["items"].(map[string]interface{})
+		default:
+			return Type{}
+		}
+		if node == nil {
+			return Type{}
+		}
+	}
+	return typeOfSchema(node)
+}
+
+func typeOfSchema(node map[string]interface{}) Type {
+	switch node["type"] {
+	case "string":
+		return Type{ValueType: value_type.StringValueType}
+	case "integer":
+		return Type{ValueType: value_type.IntValueType}
+	case "number":
+		return Type{ValueType: value_type.FloatValueType}
+	case "boolean":
+		return Type{ValueType: value_type.BoolValueType}
+	case "object":
+		schema, _ := json.Marshal(node)
+		return Type{ValueType: value_type.JsonValueType, JsonSchema: schema}
+	case "array":
+		items, _ := node["items"].(map[string]interface{})
+		if items == nil {
+			return Type{}
+		}
+		ret := typeOfSchema(items)
+		if !ret.Known() || ret.IsArray {
+			return Type{}
+		}
+		ret.IsArray = true
+		return ret
+	}
+	return Type{}
+}
+
+// Apply 在运行时对值执行表达式
+func Apply(expr string, value interface{}) (interface{}, error) {
+	stepItems, err := steps(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	current := value
+	for _, step := range stepItems {
+		if isPathStep(step) {
+			if str, ok := current.(string); ok {
+				var decoded interface{}
+				if err := json.Unmarshal([]byte(str), &decoded); err == nil {
+					current = decoded
+				}
+			}
+			tmp, found, err := json_path.Extract(current, step)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				return nil, fmt.Errorf("json path %s not found", step)
+			}
+			current = tmp
+			continue
+		}
+
+		f, ok := functions[step]
+		if !ok {
+			return nil, fmt.Errorf("unknown transform function: %s", step)
+		}
+		current, err = f.apply(current)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
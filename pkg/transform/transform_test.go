@@ -0,0 +1,133 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fBloc/bloc-server/pkg/value_type"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var resultSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"total": {"type": "integer"},
+		"items": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {"name": {"type": "string"}, "score": {"type": "number"}}
+			}
+		}
+	}
+}`)
+
+func TestCheck(t *testing.T) {
+	jsonIpt := Type{ValueType: value_type.JsonValueType, JsonSchema: resultSchema}
+
+	Convey("infer type from json schema", t, func() {
+		out, err := Check("$.total", jsonIpt)
+		So(err, ShouldBeNil)
+		So(out.ValueType, ShouldEqual, value_type.IntValueType)
+		So(out.IsArray, ShouldBeFalse)
+
+		out, err = Check("$.items[0].name", jsonIpt)
+		So(err, ShouldBeNil)
+		So(out.ValueType, ShouldEqual, value_type.StringValueType)
+
+		out, err = Check("$.items", jsonIpt)
+		So(err, ShouldBeNil)
+		So(out.ValueType, ShouldEqual, value_type.JsonValueType)
+		So(out.IsArray, ShouldBeTrue)
+
+		out, err = Check("$.items | first | $.score", jsonIpt)
+		So(err, ShouldBeNil)
+		So(out.ValueType, ShouldEqual, value_type.FloatValueType)
+	})
+
+	Convey("unknown path or missing schema", t, func() {
+		out, err := Check("$.not_exist", jsonIpt)
+		So(err, ShouldBeNil)
+		So(out.Known(), ShouldBeFalse)
+
+		out, err = Check("$.a.b", Type{ValueType: value_type.JsonValueType})
+		So(err, ShouldBeNil)
+		So(out.Known(), ShouldBeFalse)
+	})
+
+	Convey("casts", t, func() {
+		out, err := Check("$.total | to_string", jsonIpt)
+		So(err, ShouldBeNil)
+		So(out.ValueType, ShouldEqual, value_type.StringValueType)
+
+		out, err = Check("to_int", Type{ValueType: value_type.StringValueType, IsArray: true})
+		So(err, ShouldBeNil)
+		So(out.ValueType, ShouldEqual, value_type.IntValueType)
+		So(out.IsArray, ShouldBeTrue)
+
+		out, err = Check("len", Type{ValueType: value_type.StringValueType, IsArray: true})
+		So(err, ShouldBeNil)
+		So(out.ValueType, ShouldEqual, value_type.IntValueType)
+		So(out.IsArray, ShouldBeFalse)
+	})
+
+	Convey("invalid", t, func() {
+		_, err := Check("", jsonIpt)
+		So(err, ShouldNotBeNil)
+		_, err = Check("$.total |", jsonIpt)
+		So(err, ShouldNotBeNil)
+		_, err = Check("not_exist_func", jsonIpt)
+		So(err, ShouldNotBeNil)
+		_, err = Check("$.a", Type{ValueType: value_type.IntValueType})
+		So(err, ShouldNotBeNil)
+		_, err = Check("first", Type{ValueType: value_type.IntValueType})
+		So(err, ShouldNotBeNil)
+		_, err = Check("to_array", Type{ValueType: value_type.IntValueType, IsArray: true})
+		So(err, ShouldNotBeNil)
+		_, err = Check("len", Type{ValueType: value_type.BoolValueType})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestApply(t *testing.T) {
+	data := `{"total": 2, "items": [{"name": "a", "score": "1.5"}, {"name": "b"}]}`
+
+	Convey("json path", t, func() {
+		val, err := Apply("$.items[1].name", data)
+		So(err, ShouldBeNil)
+		So(val, ShouldEqual, "b")
+
+		_, err = Apply("$.items[5].name", data)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("pipeline", t, func() {
+		val, err := Apply("$.items | first | $.score | to_float", data)
+		So(err, ShouldBeNil)
+		So(val, ShouldEqual, 1.5)
+
+		val, err = Apply("$.total | to_string", data)
+		So(err, ShouldBeNil)
+		So(val, ShouldEqual, "2")
+
+		val, err = Apply("$.items | len", data)
+		So(err, ShouldBeNil)
+		So(val, ShouldEqual, 2)
+
+		val, err = Apply("to_int", []interface{}{"1", 2.0})
+		So(err, ShouldBeNil)
+		So(val, ShouldResemble, []interface{}{1, 2})
+
+		val, err = Apply("to_array", "a")
+		So(err, ShouldBeNil)
+		So(val, ShouldResemble, []interface{}{"a"})
+	})
+
+	Convey("runtime error", t, func() {
+		_, err := Apply("to_int", "not int")
+		So(err, ShouldNotBeNil)
+		_, err = Apply("first", []interface{}{})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,55 @@
+package value_type
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ObjectRef file/object_ref类型的值，指向对象存储中的一个对象
+type ObjectRef struct {
+	Key         string `json:"key"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+func (oR ObjectRef) check() error {
+	if oR.Key == "" {
+		return errors.New("object ref key cannot be blank")
+	}
+	if oR.Size < 0 {
+		return fmt.Errorf("object ref size %d cannot be negative", oR.Size)
+	}
+	return nil
+}
+
+// ParseObjectRef 从ObjectRef、json字符串或map(如经过json/bson反序列化得到的值)解析出ObjectRef
+func ParseObjectRef(val interface{}) (ObjectRef, error) {
+	var ref ObjectRef
+	switch v := val.(type) {
+	case ObjectRef:
+		ref = v
+	case *ObjectRef:
+		if v == nil {
+			return ref, errors.New("nil object ref")
+		}
+		ref = *v
+	case string:
+		if err := json.Unmarshal([]byte(v), &ref); err != nil {
+			return ref, fmt.Errorf("unmarshal object ref failed: %v", err)
+		}
+	default:
+		if val == nil || reflect.TypeOf(val).Kind() != reflect.Map {
+			return ref, fmt.Errorf("need object ref get %T", val)
+		}
+		b, err := json.Marshal(val)
+		if err != nil {
+			return ref, fmt.Errorf("marshal object ref failed: %v", err)
+		}
+		if err := json.Unmarshal(b, &ref); err != nil {
+			return ref, fmt.Errorf("unmarshal object ref failed: %v", err)
+		}
+	}
+	return ref, ref.check()
+}
@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
+	"time"
 
 	"github.com/spf13/cast"
 )
@@ -17,9 +19,47 @@ const (
 	FloatValueType  ValueType = "float"
 	StringValueType ValueType = "string"
 	BoolValueType   ValueType = "bool"
-	JsonValueType   ValueType = "json"
+	JsonValueType   ValueType = "json" // json object或array
+	// RFC3339格式的时间字符串
+	DatetimeValueType ValueType = "datetime"
+	// 对象存储中的文件/对象的引用，值为ObjectRef
+	FileValueType      ValueType = "file"
+	ObjectRefValueType ValueType = "object_ref"
+	// 可选值由IptComponent.AllowedValues声明，值为string/数字/bool
+	EnumValueType ValueType = "enum"
 )
 
+// IsValid 是否是支持的类型
+func (vt ValueType) IsValid() bool {
+	switch vt {
+	case IntValueType, FloatValueType, StringValueType, BoolValueType, JsonValueType,
+		DatetimeValueType, FileValueType, ObjectRefValueType, EnumValueType:
+		return true
+	}
+	return false
+}
+
+// IsObjectRef 值是否是对象存储的引用
+func (vt ValueType) IsObjectRef() bool {
+	return vt == FileValueType || vt == ObjectRefValueType
+}
+
+// Connectable 上游valueType类型的opt能否连接到iptValueType类型的ipt上
+// file与object_ref可以互相连接；enum类型的ipt可以接收string/int/float，值是否在可选范围内在运行时检测
+func Connectable(optValueType, iptValueType ValueType) bool {
+	if optValueType == iptValueType {
+		return true
+	}
+	if optValueType.IsObjectRef() && iptValueType.IsObjectRef() {
+		return true
+	}
+	if iptValueType == EnumValueType {
+		return optValueType == StringValueType ||
+			optValueType == IntValueType || optValueType == FloatValueType
+	}
+	return false
+}
+
 func CheckValueTypeValueValid(valueType ValueType, value interface{}) bool {
 	defer func() {
 		if r := recover(); r != nil {
@@ -37,6 +77,12 @@ func CheckValueTypeValueValid(valueType ValueType, value interface{}) bool {
 		return validBoolValueType(value)
 	} else if valueType == JsonValueType {
 		return validJsonValueType(value)
+	} else if valueType == DatetimeValueType {
+		return validDatetimeValueType(value)
+	} else if valueType.IsObjectRef() {
+		return validObjectRefValueType(value)
+	} else if valueType == EnumValueType {
+		return validEnumValueType(value)
 	}
 	return false
 }
@@ -124,11 +170,227 @@ func validBoolValueType(val interface{}) bool {
 	return err == nil
 }
 
+// validJsonValueType json字符串(object或array)，或者可以序列化为json的map/slice
 func validJsonValueType(val interface{}) bool {
-	valStr, ok := val.(string)
-	if !ok {
+	if val == nil {
+		return false
+	}
+	if valStr, ok := val.(string); ok {
+		var js interface{}
+		if json.Unmarshal([]byte(valStr), &js) != nil {
+			return false
+		}
+		switch js.(type) {
+		case map[string]interface{}, []interface{}:
+			return true
+		}
+		return false
+	}
+	switch reflect.TypeOf(val).Kind() {
+	case reflect.Map, reflect.Slice:
+		_, err := json.Marshal(val)
+		return err == nil
+	}
+	return false
+}
+
+func validDatetimeValueType(val interface{}) bool {
+	if val == nil {
+		return false
+	}
+	if _, ok := val.(time.Time); ok {
+		return true
+	}
+	if reflect.TypeOf(val).Kind() == reflect.Slice {
+		s := reflect.ValueOf(val)
+		for i := 0; i < s.Len(); i++ {
+			if _, err := ParseDatetime(s.Index(i).Interface()); err != nil {
+				return false
+			}
+		}
+		return true
+	}
+	_, err := ParseDatetime(val)
+	return err == nil
+}
+
+func validObjectRefValueType(val interface{}) bool {
+	if val == nil {
+		return false
+	}
+	if _, err := ParseObjectRef(val); err == nil {
+		return true
+	}
+	if reflect.TypeOf(val).Kind() != reflect.Slice {
+		return false
+	}
+	s := reflect.ValueOf(val)
+	for i := 0; i < s.Len(); i++ {
+		if _, err := ParseObjectRef(s.Index(i).Interface()); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func validEnumValueType(val interface{}) bool {
+	if val == nil {
+		return false
+	}
+	rt := reflect.TypeOf(val)
+	if rt.Kind() == reflect.Slice {
+		s := reflect.ValueOf(val)
+		for i := 0; i < s.Len(); i++ {
+			if !IsEnumScalar(s.Index(i).Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+	return IsEnumScalar(val)
+}
+
+// IsEnumScalar 能否作为enum的一个值：string/数字/bool
+func IsEnumScalar(val interface{}) bool {
+	if val == nil {
+		return false
+	}
+	switch reflect.TypeOf(val).Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// ParseDatetime 解析RFC3339格式的时间
+func ParseDatetime(val interface{}) (time.Time, error) {
+	switch v := val.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		return time.Parse(time.RFC3339, v)
+	}
+	return time.Time{}, fmt.Errorf("need RFC3339 datetime string get %T", val)
+}
+
+// CheckEnumValueValid 检测值是否在allowedValues内，值为slice时检测每一个元素
+// 数字之间按数值比较(json反序列化得到的数字都是float64)
+func CheckEnumValueValid(allowedValues []interface{}, value interface{}) bool {
+	if !validEnumValueType(value) {
+		return false
+	}
+	if reflect.TypeOf(value).Kind() == reflect.Slice {
+		s := reflect.ValueOf(value)
+		for i := 0; i < s.Len(); i++ {
+			if !enumAllowed(allowedValues, s.Index(i).Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+	return enumAllowed(allowedValues, value)
+}
+
+func enumAllowed(allowedValues []interface{}, value interface{}) bool {
+	for _, allowed := range allowedValues {
+		if enumEqual(allowed, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumEqual(a, b interface{}) bool {
+	if a == b {
+		return true
+	}
+	if !IsEnumScalar(a) || !IsEnumScalar(b) {
 		return false
 	}
-	var js map[string]interface{}
-	return json.Unmarshal([]byte(valStr), &js) == nil
+	aKind, bKind := reflect.TypeOf(a).Kind(), reflect.TypeOf(b).Kind()
+	if aKind == reflect.String || bKind == reflect.String || aKind == reflect.Bool || bKind == reflect.Bool {
+		return false
+	}
+	aFloat, aErr := cast.ToFloat64E(a)
+	bFloat, bErr := cast.ToFloat64E(b)
+	return aErr == nil && bErr == nil && aFloat == bFloat
+}
+
+// Comparable 此类型的值之间是否可以比较大小
+func (vt ValueType) Comparable() bool {
+	return vt == IntValueType || vt == FloatValueType
+}
+
+// toIntegralInt64 转为int64，带小数部分的值（如10.5）不会被截断而是返回错误
+func toIntegralInt64(val interface{}) (int64, error) {
+	if f, err := cast.ToFloat64E(val); err == nil && f != math.Trunc(f) {
+		return 0, fmt.Errorf("%v is not an integer", val)
+	}
+	return cast.ToInt64E(val)
+}
+
+// Compare 按照valueType比较a、b两个值，a<b 返回-1，a==b 返回0，a>b 返回1
+// 对于不能比较大小的类型，不相等时返回1
+func Compare(valueType ValueType, a, b interface{}) (int, error) {
+	switch valueType {
+	case IntValueType:
+		aInt, err := toIntegralInt64(a)
+		if err != nil {
+			return 0, err
+		}
+		bInt, err := toIntegralInt64(b)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case aInt < bInt:
+			return -1, nil
+		case aInt > bInt:
+			return 1, nil
+		}
+		return 0, nil
+	case FloatValueType:
+		aFloat, err := cast.ToFloat64E(a)
+		if err != nil {
+			return 0, err
+		}
+		bFloat, err := cast.ToFloat64E(b)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case aFloat < bFloat:
+			return -1, nil
+		case aFloat > bFloat:
+			return 1, nil
+		}
+		return 0, nil
+	case StringValueType:
+		aStr, err := cast.ToStringE(a)
+		if err != nil {
+			return 0, err
+		}
+		bStr, err := cast.ToStringE(b)
+		if err != nil {
+			return 0, err
+		}
+		if aStr == bStr {
+			return 0, nil
+		}
+		return 1, nil
+	case BoolValueType:
+		aBool, aOk := a.(bool)
+		bBool, bOk := b.(bool)
+		if !aOk || !bOk {
+			return 0, fmt.Errorf("%v or %v not bool", a, b)
+		}
+		if aBool == bBool {
+			return 0, nil
+		}
+		return 1, nil
+	}
+	return 0, fmt.Errorf("value type %s not support compare", valueType)
 }
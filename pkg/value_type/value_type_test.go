@@ -2,6 +2,7 @@ package value_type
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -42,4 +43,115 @@ func TestCheckValueTypeValueValid(t *testing.T) {
 		So(CheckValueTypeValueValid(BoolValueType, true), ShouldBeTrue)
 		So(CheckValueTypeValueValid(BoolValueType, false), ShouldBeTrue)
 	})
+
+	Convey("json check", t, func() {
+		So(CheckValueTypeValueValid(JsonValueType, `{"a": 1}`), ShouldBeTrue)
+		So(CheckValueTypeValueValid(JsonValueType, `[{"a": 1}, 2]`), ShouldBeTrue)
+		So(CheckValueTypeValueValid(JsonValueType, map[string]interface{}{"a": 1}), ShouldBeTrue)
+		So(CheckValueTypeValueValid(JsonValueType, []interface{}{1, "a"}), ShouldBeTrue)
+		So(CheckValueTypeValueValid(JsonValueType, `1`), ShouldBeFalse)
+		So(CheckValueTypeValueValid(JsonValueType, `{"a": `), ShouldBeFalse)
+		So(CheckValueTypeValueValid(JsonValueType, 1), ShouldBeFalse)
+		So(CheckValueTypeValueValid(JsonValueType, nil), ShouldBeFalse)
+	})
+
+	Convey("datetime check", t, func() {
+		So(CheckValueTypeValueValid(DatetimeValueType, "2022-01-02T15:04:05+08:00"), ShouldBeTrue)
+		So(CheckValueTypeValueValid(DatetimeValueType, "2022-01-02T15:04:05.123Z"), ShouldBeTrue)
+		So(CheckValueTypeValueValid(DatetimeValueType, time.Now()), ShouldBeTrue)
+		So(CheckValueTypeValueValid(DatetimeValueType,
+			[]string{"2022-01-02T15:04:05Z", "2022-01-03T15:04:05Z"}), ShouldBeTrue)
+		So(CheckValueTypeValueValid(DatetimeValueType, "2022-01-02 15:04:05"), ShouldBeFalse)
+		So(CheckValueTypeValueValid(DatetimeValueType, []string{"2022-01-02T15:04:05Z", "xxx"}), ShouldBeFalse)
+		So(CheckValueTypeValueValid(DatetimeValueType, 1641111845), ShouldBeFalse)
+	})
+
+	Convey("object ref check", t, func() {
+		ref := map[string]interface{}{"key": "abc", "size": 10, "content_type": "text/plain"}
+		So(CheckValueTypeValueValid(FileValueType, ref), ShouldBeTrue)
+		So(CheckValueTypeValueValid(ObjectRefValueType, ObjectRef{Key: "abc"}), ShouldBeTrue)
+		So(CheckValueTypeValueValid(ObjectRefValueType, `{"key": "abc", "size": 10}`), ShouldBeTrue)
+		So(CheckValueTypeValueValid(FileValueType, []interface{}{ref, ref}), ShouldBeTrue)
+		So(CheckValueTypeValueValid(FileValueType, map[string]interface{}{"size": 10}), ShouldBeFalse)
+		So(CheckValueTypeValueValid(FileValueType, ObjectRef{Key: "abc", Size: -1}), ShouldBeFalse)
+		So(CheckValueTypeValueValid(FileValueType, "abc"), ShouldBeFalse)
+	})
+
+	Convey("enum check", t, func() {
+		So(CheckValueTypeValueValid(EnumValueType, "a"), ShouldBeTrue)
+		So(CheckValueTypeValueValid(EnumValueType, 1), ShouldBeTrue)
+		So(CheckValueTypeValueValid(EnumValueType, []interface{}{"a", 1}), ShouldBeTrue)
+		So(CheckValueTypeValueValid(EnumValueType, map[string]interface{}{"a": 1}), ShouldBeFalse)
+		So(CheckValueTypeValueValid(EnumValueType, nil), ShouldBeFalse)
+	})
+
+	Convey("unknown value type", t, func() {
+		So(CheckValueTypeValueValid("decimal", 1), ShouldBeFalse)
+	})
+}
+
+func TestCheckEnumValueValid(t *testing.T) {
+	allowed := []interface{}{"small", "large", float64(3)}
+
+	Convey("CheckEnumValueValid", t, func() {
+		So(CheckEnumValueValid(allowed, "small"), ShouldBeTrue)
+		So(CheckEnumValueValid(allowed, 3), ShouldBeTrue)
+		So(CheckEnumValueValid(allowed, []string{"small", "large"}), ShouldBeTrue)
+		So(CheckEnumValueValid(allowed, "medium"), ShouldBeFalse)
+		So(CheckEnumValueValid(allowed, "3"), ShouldBeFalse)
+		So(CheckEnumValueValid(allowed, []string{"small", "medium"}), ShouldBeFalse)
+		So(CheckEnumValueValid(nil, "small"), ShouldBeFalse)
+	})
+}
+
+func TestConnectable(t *testing.T) {
+	Convey("Connectable", t, func() {
+		So(Connectable(IntValueType, IntValueType), ShouldBeTrue)
+		So(Connectable(FileValueType, ObjectRefValueType), ShouldBeTrue)
+		So(Connectable(ObjectRefValueType, FileValueType), ShouldBeTrue)
+		So(Connectable(StringValueType, EnumValueType), ShouldBeTrue)
+		So(Connectable(EnumValueType, StringValueType), ShouldBeFalse)
+		So(Connectable(StringValueType, DatetimeValueType), ShouldBeFalse)
+		So(Connectable(JsonValueType, StringValueType), ShouldBeFalse)
+	})
+}
+
+func TestCompare(t *testing.T) {
+	Convey("number compare", t, func() {
+		result, err := Compare(IntValueType, 1, 2)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, -1)
+		result, err = Compare(IntValueType, float64(2), 2)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 0)
+		result, err = Compare(FloatValueType, 2.5, "1.5")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 1)
+		_, err = Compare(IntValueType, 1, "xxx")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("int compare rejects not integral value", t, func() {
+		_, err := Compare(IntValueType, 10.5, 10)
+		So(err, ShouldNotBeNil)
+		_, err = Compare(IntValueType, 10, "10.5")
+		So(err, ShouldNotBeNil)
+		result, err := Compare(IntValueType, float64(10), "10")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 0)
+	})
+
+	Convey("string & bool compare", t, func() {
+		result, err := Compare(StringValueType, "ok", "ok")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 0)
+		result, err = Compare(StringValueType, "ok", "fail")
+		So(err, ShouldBeNil)
+		So(result, ShouldNotEqual, 0)
+		result, err = Compare(BoolValueType, true, true)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, 0)
+		_, err = Compare(BoolValueType, true, "true")
+		So(err, ShouldNotBeNil)
+	})
 }
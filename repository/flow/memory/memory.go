@@ -0,0 +1,582 @@
+package memory
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/internal/crontab"
+	"github.com/fBloc/bloc-server/internal/memory_filter"
+	"github.com/fBloc/bloc-server/pkg/add_or_del"
+	"github.com/fBloc/bloc-server/repository/flow"
+	mongo_flow "github.com/fBloc/bloc-server/repository/flow/mongo"
+	"github.com/fBloc/bloc-server/value_object"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	var _ flow.FlowRepository = &MemoryRepository{}
+}
+
+type MemoryRepository struct {
+	flows []*aggregate.Flow // 按插入顺序
+	sync.RWMutex
+}
+
+// Create a new in-memory repository
+func New() *MemoryRepository {
+	return &MemoryRepository{}
+}
+
+// copyFlow 借用mongo实现的结构转换做深拷贝，保证存取的数据与持久化后的一致
+func copyFlow(f *aggregate.Flow) *aggregate.Flow {
+	if f == nil {
+		return nil
+	}
+	c := mongo_flow.NewFromFlow(f).ToAggregate()
+	c.Deleted = f.Deleted
+	return c
+}
+
+// toDocument 通用过滤条件中的key为持久化字段名，故转为与mongo一致的文档后再做匹配
+func toDocument(f *aggregate.Flow) memory_filter.Document {
+	doc, err := memory_filter.ToDocument(mongo_flow.NewFromFlow(f))
+	if err != nil {
+		return memory_filter.Document{}
+	}
+	doc["deleted"] = f.Deleted
+	return doc
+}
+
+func (mr *MemoryRepository) getLatest(match func(*aggregate.Flow) bool) *aggregate.Flow {
+	mr.RLock()
+	defer mr.RUnlock()
+	for i := len(mr.flows) - 1; i >= 0; i-- {
+		if match(mr.flows[i]) {
+			return copyFlow(mr.flows[i])
+		}
+	}
+	return &aggregate.Flow{} // 同mongo实现，未找到时返回空值而非nil
+}
+
+// filterDesc 同mongo默认的倒序
+func (mr *MemoryRepository) filterDesc(match func(*aggregate.Flow) bool) []aggregate.Flow {
+	mr.RLock()
+	defer mr.RUnlock()
+	ret := make([]aggregate.Flow, 0)
+	for i := len(mr.flows) - 1; i >= 0; i-- {
+		if match(mr.flows[i]) {
+			ret = append(ret, *copyFlow(mr.flows[i]))
+		}
+	}
+	return ret
+}
+
+// patchWhere 对满足条件的flow做修改，返回修改的数目
+func (mr *MemoryRepository) patchWhere(
+	match func(*aggregate.Flow) bool, modify func(*aggregate.Flow),
+) int64 {
+	mr.Lock()
+	defer mr.Unlock()
+	var amount int64
+	for i, f := range mr.flows {
+		if !match(f) {
+			continue
+		}
+		c := copyFlow(f)
+		modify(c)
+		mr.flows[i] = c
+		amount++
+	}
+	return amount
+}
+
+func (mr *MemoryRepository) patch(id value_object.UUID, modify func(*aggregate.Flow)) error {
+	mr.patchWhere(func(f *aggregate.Flow) bool { return f.ID == id }, modify)
+	return nil
+}
+
+func (mr *MemoryRepository) create(f *aggregate.Flow) error {
+	mr.Lock()
+	defer mr.Unlock()
+	mr.flows = append(mr.flows, copyFlow(f))
+	return nil
+}
+
+func containsUser(userIDs []value_object.UUID, userID value_object.UUID) bool {
+	for _, i := range userIDs {
+		if i == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (mr *MemoryRepository) GetByID(id value_object.UUID) (*aggregate.Flow, error) {
+	if id.IsNil() {
+		return nil, errors.New("must have id")
+	}
+	return mr.getLatest(func(f *aggregate.Flow) bool { return f.ID == id }), nil
+}
+
+func (mr *MemoryRepository) GetByIDStr(id string) (*aggregate.Flow, error) {
+	if id == "" {
+		return nil, errors.New("id cannot be blank")
+	}
+	uuidFromStr, err := value_object.ParseToUUID(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "trans id to uuid failed")
+	}
+	return mr.GetByID(uuidFromStr)
+}
+
+func (mr *MemoryRepository) GetOnlineByOriginID(originID value_object.UUID) (*aggregate.Flow, error) {
+	if originID.IsNil() {
+		return nil, errors.New("must have origin_id")
+	}
+	return mr.getLatest(func(f *aggregate.Flow) bool {
+		return f.OriginID == originID && !f.IsDraft && !f.Deleted
+	}), nil
+}
+
+func (mr *MemoryRepository) GetOnlineByOriginIDStr(originID string) (*aggregate.Flow, error) {
+	if originID == "" {
+		return nil, errors.New("origin_id cannot be blank")
+	}
+	uuidFromStr, err := value_object.ParseToUUID(originID)
+	if err != nil {
+		return nil, errors.Wrap(err, "trans origin_id to uuid failed")
+	}
+	return mr.GetOnlineByOriginID(uuidFromStr)
+}
+
+func (mr *MemoryRepository) GetDraftByOriginID(originID value_object.UUID) (*aggregate.Flow, error) {
+	if originID.IsNil() {
+		return nil, errors.New("must have origin_id")
+	}
+	return mr.getLatest(func(f *aggregate.Flow) bool {
+		return f.OriginID == originID && f.IsDraft && !f.Deleted
+	}), nil
+}
+
+func (mr *MemoryRepository) FilterOnline(
+	user *aggregate.User, nameContains string, withoutFields []string,
+) ([]aggregate.Flow, error) {
+	return mr.filterDesc(func(f *aggregate.Flow) bool {
+		if f.IsDraft || !f.Newest || f.Deleted {
+			return false
+		}
+		if !user.IsZero() && !user.IsSuper && !containsUser(f.ReadUserIDs, user.ID) {
+			return false
+		}
+		return strings.Contains(f.Name, nameContains)
+	}), nil
+}
+
+func (mr *MemoryRepository) FilterCrontabFlows() ([]aggregate.Flow, error) {
+	return mr.filterDesc(func(f *aggregate.Flow) bool {
+		return !f.IsDraft && f.Newest && !f.Deleted && f.Crontab.IsValid()
+	}), nil
+}
+
+func (mr *MemoryRepository) FilterDependentFlows(
+	upstreamFlowOriginID value_object.UUID,
+) ([]aggregate.Flow, error) {
+	return mr.filterDesc(func(f *aggregate.Flow) bool {
+		if f.IsDraft || !f.Newest || f.Deleted {
+			return false
+		}
+		for _, dependency := range f.Dependencies {
+			if dependency.UpstreamFlowOriginID == upstreamFlowOriginID {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (mr *MemoryRepository) Filter(
+	filter *value_object.RepositoryFilter,
+) ([]aggregate.Flow, error) {
+	filter.AddEqual("is_draft", false).AddEqual("deleted", false)
+	return mr.filterDesc(func(f *aggregate.Flow) bool {
+		return toDocument(f).Match(*filter)
+	}), nil
+}
+
+func (mr *MemoryRepository) FilterDraft(
+	userID value_object.UUID, nameContains string, withoutFields []string,
+) ([]aggregate.Flow, error) {
+	return mr.filterDesc(func(f *aggregate.Flow) bool {
+		if !f.IsDraft || f.Deleted {
+			return false
+		}
+		if !userID.IsNil() && !containsUser(f.ReadUserIDs, userID) {
+			return false
+		}
+		return strings.Contains(f.Name, nameContains)
+	}), nil
+}
+
+func (mr *MemoryRepository) PatchName(id value_object.UUID, name string) error {
+	return mr.patch(id, func(f *aggregate.Flow) { f.Name = name })
+}
+
+func (mr *MemoryRepository) PatchPosition(id value_object.UUID, position interface{}) error {
+	return mr.patch(id, func(f *aggregate.Flow) { f.Position = position })
+}
+
+func (mr *MemoryRepository) PatchRetryStrategy(id value_object.UUID, amount, intervalInSecond uint16) error {
+	return mr.patch(id, func(f *aggregate.Flow) {
+		f.RetryAmount = amount
+		f.RetryIntervalInSecond = intervalInSecond
+	})
+}
+
+func (mr *MemoryRepository) PatchCrontab(id value_object.UUID, c *crontab.CrontabRepresent) error {
+	// 对于非空的crontab设置，需要检查格式是否正确
+	if !c.IsZero() && !c.IsValid() {
+		return errors.New("crontab expression not valid")
+	}
+	return mr.patch(id, func(f *aggregate.Flow) {
+		f.Crontab = c
+		f.CrontabLastFiredTime = time.Now()
+	})
+}
+
+func (mr *MemoryRepository) PatchCrontabMisfirePolicy(
+	id value_object.UUID, policy value_object.CrontabMisfirePolicy, maxRuns uint16,
+) error {
+	return mr.patch(id, func(f *aggregate.Flow) {
+		f.CrontabMisfirePolicy = policy
+		f.CrontabMisfireMaxRuns = maxRuns
+	})
+}
+
+func (mr *MemoryRepository) PatchCrontabLastFiredTime(
+	id value_object.UUID, lastFiredTime time.Time,
+) error {
+	mr.patchWhere(
+		func(f *aggregate.Flow) bool {
+			return f.ID == id && f.CrontabLastFiredTime.Before(lastFiredTime)
+		},
+		func(f *aggregate.Flow) { f.CrontabLastFiredTime = lastFiredTime })
+	return nil
+}
+
+func (mr *MemoryRepository) PatchNotificationRules(
+	id value_object.UUID, rules []*aggregate.NotificationRule,
+) error {
+	return mr.patch(id, func(f *aggregate.Flow) {
+		f.NotificationRules = make([]*aggregate.NotificationRule, 0, len(rules))
+		for _, rule := range rules {
+			c := *rule
+			f.NotificationRules = append(f.NotificationRules, &c)
+		}
+	})
+}
+
+func (mr *MemoryRepository) PatchPaused(id value_object.UUID, paused bool) error {
+	return mr.patch(id, func(f *aggregate.Flow) { f.Paused = paused })
+}
+
+func (mr *MemoryRepository) PatchBlackoutWindows(
+	id value_object.UUID, windows []*aggregate.BlackoutWindow,
+) error {
+	return mr.patch(id, func(f *aggregate.Flow) {
+		f.BlackoutWindows = make([]*aggregate.BlackoutWindow, 0, len(windows))
+		for _, window := range windows {
+			c := *window
+			f.BlackoutWindows = append(f.BlackoutWindows, &c)
+		}
+	})
+}
+
+func (mr *MemoryRepository) PatchParams(
+	id value_object.UUID, params []*aggregate.FlowParam,
+) error {
+	return mr.patch(id, func(f *aggregate.Flow) {
+		f.Params = make([]*aggregate.FlowParam, 0, len(params))
+		for _, param := range params {
+			c := *param
+			f.Params = append(f.Params, &c)
+		}
+	})
+}
+
+func (mr *MemoryRepository) PatchDependencies(
+	id value_object.UUID, dependencies []*aggregate.FlowDependency,
+) error {
+	return mr.patch(id, func(f *aggregate.Flow) {
+		f.Dependencies = make([]*aggregate.FlowDependency, 0, len(dependencies))
+		for _, dependency := range dependencies {
+			c := *dependency
+			f.Dependencies = append(f.Dependencies, &c)
+		}
+	})
+}
+
+func (mr *MemoryRepository) PatchAllowParallelRun(id value_object.UUID, allowParallel bool) error {
+	return mr.patch(id, func(f *aggregate.Flow) { f.AllowParallelRun = allowParallel })
+}
+
+func (mr *MemoryRepository) PatchMaxConcurrentRuns(
+	id value_object.UUID, maxConcurrentRuns uint16,
+) error {
+	return mr.patch(id, func(f *aggregate.Flow) { f.MaxConcurrentRuns = maxConcurrentRuns })
+}
+
+func (mr *MemoryRepository) PatchRunConflictStrategy(
+	id value_object.UUID, strategy value_object.RunConflictStrategy,
+) error {
+	return mr.patch(id, func(f *aggregate.Flow) { f.RunConflictStrategy = strategy })
+}
+
+func (mr *MemoryRepository) PatchWhetherAllowTriggerByKey(id value_object.UUID, allowed bool) error {
+	return mr.patch(id, func(f *aggregate.Flow) { f.AllowTriggerByKey = allowed })
+}
+
+func (mr *MemoryRepository) PatchFlowFunctionIDMapFlowFunction(
+	id value_object.UUID,
+	flowFunctionIDMapFlowFunction map[string]*aggregate.FlowFunction,
+) error {
+	return mr.patch(id, func(f *aggregate.Flow) {
+		f.FlowFunctionIDMapFlowFunction = flowFunctionIDMapFlowFunction
+	})
+}
+
+func (mr *MemoryRepository) PatchTimeout(id value_object.UUID, tOS uint32) error {
+	return mr.patch(id, func(f *aggregate.Flow) { f.TimeoutInSeconds = tOS })
+}
+
+func (mr *MemoryRepository) ReplaceByID(id value_object.UUID, aggFlow *aggregate.Flow) error {
+	if id.IsNil() {
+		return errors.New("id cannot be nil")
+	}
+	mr.Lock()
+	defer mr.Unlock()
+	for i, f := range mr.flows {
+		if f.ID == id {
+			mr.flows[i] = copyFlow(aggFlow)
+			return nil
+		}
+	}
+	return errors.New("id find no flow")
+}
+
+// pushOrPull 同mongo的$push/$pull，总是返回新的slice
+func pushOrPull(
+	userIDs []value_object.UUID, userID value_object.UUID, aod add_or_del.AddOrDel,
+) []value_object.UUID {
+	ret := make([]value_object.UUID, 0, len(userIDs)+1)
+	for _, i := range userIDs {
+		if aod == add_or_del.Remove && i == userID {
+			continue
+		}
+		ret = append(ret, i)
+	}
+	if aod != add_or_del.Remove {
+		ret = append(ret, userID)
+	}
+	return ret
+}
+
+func (mr *MemoryRepository) userOperation(
+	id, userID value_object.UUID,
+	permType value_object.PermissionType, aod add_or_del.AddOrDel,
+) error {
+	switch permType {
+	case value_object.Read:
+		return mr.patch(id, func(f *aggregate.Flow) {
+			f.ReadUserIDs = pushOrPull(f.ReadUserIDs, userID, aod)
+		})
+	case value_object.Write:
+		return mr.patch(id, func(f *aggregate.Flow) {
+			f.WriteUserIDs = pushOrPull(f.WriteUserIDs, userID, aod)
+		})
+	case value_object.Execute:
+		return mr.patch(id, func(f *aggregate.Flow) {
+			f.ExecuteUserIDs = pushOrPull(f.ExecuteUserIDs, userID, aod)
+		})
+	case value_object.Delete:
+		return mr.patch(id, func(f *aggregate.Flow) {
+			f.DeleteUserIDs = pushOrPull(f.DeleteUserIDs, userID, aod)
+		})
+	case value_object.AssignPermission:
+		return mr.patch(id, func(f *aggregate.Flow) {
+			f.AssignPermissionUserIDs = pushOrPull(f.AssignPermissionUserIDs, userID, aod)
+		})
+	}
+	return errors.New("permission type wrong")
+}
+
+func (mr *MemoryRepository) AddReader(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.Read, add_or_del.Add)
+}
+func (mr *MemoryRepository) RemoveReader(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.Read, add_or_del.Remove)
+}
+
+func (mr *MemoryRepository) AddWriter(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.Write, add_or_del.Add)
+}
+
+func (mr *MemoryRepository) RemoveWriter(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.Write, add_or_del.Remove)
+}
+
+func (mr *MemoryRepository) AddExecuter(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.Execute, add_or_del.Add)
+}
+
+func (mr *MemoryRepository) RemoveExecuter(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.Execute, add_or_del.Remove)
+}
+
+func (mr *MemoryRepository) AddDeleter(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.Delete, add_or_del.Add)
+}
+
+func (mr *MemoryRepository) RemoveDeleter(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.Delete, add_or_del.Remove)
+}
+
+func (mr *MemoryRepository) AddAssigner(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.AssignPermission, add_or_del.Add)
+}
+
+func (mr *MemoryRepository) RemoveAssigner(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.AssignPermission, add_or_del.Remove)
+}
+
+func (mr *MemoryRepository) CreateDraftFromScratch(
+	name string,
+	createUserID value_object.UUID,
+	position interface{},
+	funcs map[string]*aggregate.FlowFunction,
+) (*aggregate.Flow, error) {
+	if createUserID.IsNil() {
+		return nil, errors.New("must have create_user_id")
+	}
+	aggFlow := aggregate.Flow{
+		ID:                            value_object.NewUUID(),
+		Name:                          name,
+		IsDraft:                       true,
+		OriginID:                      value_object.NewUUID(),
+		CreateUserID:                  createUserID,
+		CreateTime:                    time.Now(),
+		Position:                      position,
+		FlowFunctionIDMapFlowFunction: funcs,
+		TriggerKey:                    value_object.NewUUID().String(),
+		ReadUserIDs:                   []value_object.UUID{createUserID},
+		WriteUserIDs:                  []value_object.UUID{createUserID},
+		ExecuteUserIDs:                []value_object.UUID{createUserID},
+		DeleteUserIDs:                 []value_object.UUID{createUserID},
+		AssignPermissionUserIDs:       []value_object.UUID{createUserID},
+	}
+
+	return &aggFlow, mr.create(&aggFlow)
+}
+
+func (mr *MemoryRepository) CreateDraftForExistFlow(
+	name string,
+	createUserID, originID value_object.UUID,
+	position interface{},
+	funcs map[string]*aggregate.FlowFunction,
+) (*aggregate.Flow, error) {
+	if createUserID.IsNil() {
+		return nil, errors.New("create_user_id cannot be blank")
+	}
+	if originID.IsNil() {
+		return nil, errors.New("origin_id cannot be blank")
+	}
+	existFlow, _ := mr.GetOnlineByOriginID(originID)
+	if existFlow.IsZero() {
+		return nil, errors.New("origin_id find no exist flow")
+	}
+
+	aggFlow := aggregate.Flow{
+		ID:                            value_object.NewUUID(),
+		Name:                          name,
+		IsDraft:                       true,
+		OriginID:                      originID,
+		CreateUserID:                  createUserID,
+		CreateTime:                    time.Now(),
+		TriggerKey:                    existFlow.TriggerKey,
+		Position:                      position,
+		FlowFunctionIDMapFlowFunction: funcs,
+		Params:                        existFlow.Params,
+		ReadUserIDs:                   existFlow.ReadUserIDs,
+		WriteUserIDs:                  existFlow.WriteUserIDs,
+		ExecuteUserIDs:                existFlow.ExecuteUserIDs,
+		DeleteUserIDs:                 existFlow.DeleteUserIDs,
+		AssignPermissionUserIDs:       existFlow.AssignPermissionUserIDs,
+	}
+
+	return &aggFlow, mr.create(&aggFlow)
+}
+
+func (mr *MemoryRepository) CreateOnlineFromDraft(
+	draftF *aggregate.Flow,
+) (*aggregate.Flow, error) {
+	latestFlow, _ := mr.GetOnlineByOriginID(draftF.OriginID)
+
+	aggF := draftF
+	aggF.IsDraft = false
+	aggF.Newest = true
+	aggF.CreateTime = time.Now()
+	if latestFlow.IsZero() { // 完全新建的draft提交的情况
+		return aggF, mr.create(aggF)
+	}
+	// 已有flow，继承权限及运行配置
+	aggF.Version = latestFlow.Version + 1
+	aggF.ReadUserIDs = latestFlow.ReadUserIDs
+	aggF.WriteUserIDs = latestFlow.WriteUserIDs
+	aggF.ExecuteUserIDs = latestFlow.ExecuteUserIDs
+	aggF.DeleteUserIDs = latestFlow.DeleteUserIDs
+	aggF.AssignPermissionUserIDs = latestFlow.AssignPermissionUserIDs
+	aggF.AllowParallelRun = latestFlow.AllowParallelRun
+	aggF.MaxConcurrentRuns = latestFlow.MaxConcurrentRuns
+	aggF.RunConflictStrategy = latestFlow.RunConflictStrategy
+	aggF.Crontab = latestFlow.Crontab
+	aggF.CrontabMisfirePolicy = latestFlow.CrontabMisfirePolicy
+	aggF.CrontabMisfireMaxRuns = latestFlow.CrontabMisfireMaxRuns
+	aggF.CrontabLastFiredTime = latestFlow.CrontabLastFiredTime
+	aggF.TriggerKey = latestFlow.TriggerKey
+	aggF.AllowTriggerByKey = latestFlow.AllowTriggerByKey
+	aggF.TimeoutInSeconds = latestFlow.TimeoutInSeconds
+	aggF.RetryAmount = latestFlow.RetryAmount
+	aggF.RetryIntervalInSecond = latestFlow.RetryIntervalInSecond
+	aggF.NotificationRules = latestFlow.NotificationRules
+	aggF.Paused = latestFlow.Paused
+	aggF.BlackoutWindows = latestFlow.BlackoutWindows
+	aggF.Dependencies = latestFlow.Dependencies
+	// 老的在线版本下线
+	if latestFlow.Newest {
+		mr.patch(latestFlow.ID, func(f *aggregate.Flow) {
+			f.Newest = false
+			f.Deleted = true
+		})
+	}
+	return aggF, mr.create(aggF)
+}
+
+func (mr *MemoryRepository) DeleteByID(id value_object.UUID) (int64, error) {
+	return mr.patchWhere(
+		func(f *aggregate.Flow) bool { return f.ID == id && !f.Deleted },
+		func(f *aggregate.Flow) { f.Deleted = true }), nil
+}
+
+func (mr *MemoryRepository) DeleteByOriginID(originID value_object.UUID) (int64, error) {
+	return mr.patchWhere(
+		func(f *aggregate.Flow) bool { return f.OriginID == originID && !f.Deleted },
+		func(f *aggregate.Flow) { f.Deleted = true }), nil
+}
+
+func (mr *MemoryRepository) DeleteDraftByOriginID(originID value_object.UUID) (int64, error) {
+	return mr.patchWhere(
+		func(f *aggregate.Flow) bool { return f.OriginID == originID && f.IsDraft && !f.Deleted },
+		func(f *aggregate.Flow) { f.Deleted = true }), nil
+}
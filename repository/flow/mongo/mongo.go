@@ -52,15 +52,286 @@ type mongoIptComponentConfig struct {
 	Value          interface{}                       `bson:"value,omitempty"`
 	FlowFunctionID string                            `bson:"flow_function_id,omitempty"`
 	Key            string                            `bson:"key,omitempty"`
+	Transform      string                            `bson:"transform,omitempty"`
+}
+
+type mongoBranchCondition struct {
+	OptKey   string                         `bson:"opt_key"`
+	Operator value_object.ConditionOperator `bson:"operator"`
+	Value    interface{}                    `bson:"value"`
+}
+
+type mongoMapSetting struct {
+	IptIndex       int `bson:"ipt_index"`
+	MaxConcurrency int `bson:"max_concurrency"`
+}
+
+type mongoSubFlowIptTarget struct {
+	FlowFunctionID string `bson:"flow_function_id"`
+	IptIndex       int    `bson:"ipt_index"`
+	ComponentIndex int    `bson:"component_index"`
+}
+
+type mongoSubFlowSetting struct {
+	FlowOriginID value_object.UUID       `bson:"flow_origin_id"`
+	IptTargets   []mongoSubFlowIptTarget `bson:"ipt_targets"`
+}
+
+type mongoApprover struct {
+	UserID  value_object.UUID          `bson:"user_id"`
+	Channel value_object.NotifyChannel `bson:"channel,omitempty"`
+	Target  string                     `bson:"target,omitempty"`
+}
+
+type mongoApprovalSetting struct {
+	Approvers []mongoApprover               `bson:"approvers"`
+	OnReject  value_object.ApprovalFallback `bson:"on_reject,omitempty"`
+	OnTimeout value_object.ApprovalFallback `bson:"on_timeout,omitempty"`
+}
+
+func fromAggApprovalSetting(aggSetting *aggregate.ApprovalSetting) *mongoApprovalSetting {
+	if aggSetting == nil {
+		return nil
+	}
+	resp := &mongoApprovalSetting{
+		Approvers: make([]mongoApprover, 0, len(aggSetting.Approvers)),
+		OnReject:  aggSetting.OnReject,
+		OnTimeout: aggSetting.OnTimeout,
+	}
+	for _, approver := range aggSetting.Approvers {
+		resp.Approvers = append(resp.Approvers, mongoApprover{
+			UserID:  approver.UserID,
+			Channel: approver.Channel,
+			Target:  approver.Target,
+		})
+	}
+	return resp
+}
+
+func (m *mongoApprovalSetting) toAgg() *aggregate.ApprovalSetting {
+	if m == nil {
+		return nil
+	}
+	resp := &aggregate.ApprovalSetting{
+		Approvers: make([]*aggregate.Approver, 0, len(m.Approvers)),
+		OnReject:  m.OnReject,
+		OnTimeout: m.OnTimeout,
+	}
+	for _, approver := range m.Approvers {
+		resp.Approvers = append(resp.Approvers, &aggregate.Approver{
+			UserID:  approver.UserID,
+			Channel: approver.Channel,
+			Target:  approver.Target,
+		})
+	}
+	return resp
+}
+
+type mongoRetryPolicy struct {
+	MaxAttempts      uint16                    `bson:"max_attempts"`
+	Backoff          value_object.RetryBackoff `bson:"backoff"`
+	IntervalInSecond uint16                    `bson:"interval_in_second"`
+	MaxDelayInSecond uint16                    `bson:"max_delay_in_second"`
+}
+
+type mongoNotificationRule struct {
+	Triggers         []value_object.NotifyTrigger `bson:"triggers"`
+	LongRunInMinutes uint32                       `bson:"long_run_in_minutes,omitempty"`
+	Channel          value_object.NotifyChannel   `bson:"channel"`
+	Target           string                       `bson:"target"`
+	Secret           string                       `bson:"secret,omitempty"`
+}
+
+func fromAggNotificationRules(rules []*aggregate.NotificationRule) []mongoNotificationRule {
+	if len(rules) == 0 {
+		return nil
+	}
+	resp := make([]mongoNotificationRule, 0, len(rules))
+	for _, rule := range rules {
+		resp = append(resp, mongoNotificationRule{
+			Triggers:         rule.Triggers,
+			LongRunInMinutes: rule.LongRunInMinutes,
+			Channel:          rule.Channel,
+			Target:           rule.Target,
+			Secret:           rule.Secret,
+		})
+	}
+	return resp
+}
+
+func toAggNotificationRules(rules []mongoNotificationRule) []*aggregate.NotificationRule {
+	if len(rules) == 0 {
+		return nil
+	}
+	resp := make([]*aggregate.NotificationRule, 0, len(rules))
+	for _, rule := range rules {
+		resp = append(resp, &aggregate.NotificationRule{
+			Triggers:         rule.Triggers,
+			LongRunInMinutes: rule.LongRunInMinutes,
+			Channel:          rule.Channel,
+			Target:           rule.Target,
+			Secret:           rule.Secret,
+		})
+	}
+	return resp
+}
+
+type mongoBlackoutWindow struct {
+	Weekdays []time.Weekday `bson:"weekdays,omitempty"`
+	Start    string         `bson:"start"`
+	End      string         `bson:"end"`
+	Timezone string         `bson:"timezone,omitempty"`
+}
+
+func fromAggBlackoutWindows(windows []*aggregate.BlackoutWindow) []mongoBlackoutWindow {
+	if len(windows) == 0 {
+		return nil
+	}
+	resp := make([]mongoBlackoutWindow, 0, len(windows))
+	for _, window := range windows {
+		resp = append(resp, mongoBlackoutWindow{
+			Weekdays: window.Weekdays,
+			Start:    window.Start,
+			End:      window.End,
+			Timezone: window.Timezone,
+		})
+	}
+	return resp
+}
+
+func toAggBlackoutWindows(windows []mongoBlackoutWindow) []*aggregate.BlackoutWindow {
+	if len(windows) == 0 {
+		return nil
+	}
+	resp := make([]*aggregate.BlackoutWindow, 0, len(windows))
+	for _, window := range windows {
+		aggWindow := &aggregate.BlackoutWindow{
+			Weekdays: window.Weekdays,
+			Start:    window.Start,
+			End:      window.End,
+			Timezone: window.Timezone,
+		}
+		// 保存前已经校验过，此处只为缓存解析结果
+		_ = aggWindow.CheckValid()
+		resp = append(resp, aggWindow)
+	}
+	return resp
+}
+
+type mongoFlowParam struct {
+	Name         string               `bson:"name"`
+	Description  string               `bson:"description,omitempty"`
+	ValueType    value_type.ValueType `bson:"value_type"`
+	Required     bool                 `bson:"required,omitempty"`
+	DefaultValue interface{}          `bson:"default_value,omitempty"`
+}
+
+func fromAggParams(params []*aggregate.FlowParam) []mongoFlowParam {
+	if len(params) == 0 {
+		return nil
+	}
+	resp := make([]mongoFlowParam, 0, len(params))
+	for _, param := range params {
+		resp = append(resp, mongoFlowParam{
+			Name:         param.Name,
+			Description:  param.Description,
+			ValueType:    param.ValueType,
+			Required:     param.Required,
+			DefaultValue: param.DefaultValue,
+		})
+	}
+	return resp
+}
+
+func toAggParams(params []mongoFlowParam) []*aggregate.FlowParam {
+	if len(params) == 0 {
+		return nil
+	}
+	resp := make([]*aggregate.FlowParam, 0, len(params))
+	for _, param := range params {
+		resp = append(resp, &aggregate.FlowParam{
+			Name:         param.Name,
+			Description:  param.Description,
+			ValueType:    param.ValueType,
+			Required:     param.Required,
+			DefaultValue: param.DefaultValue,
+		})
+	}
+	return resp
+}
+
+type mongoDependencyOptMapping struct {
+	OptKey         string `bson:"opt_key"`
+	FlowFunctionID string `bson:"flow_function_id"`
+	IptIndex       int    `bson:"ipt_index"`
+	ComponentIndex int    `bson:"component_index"`
+}
+
+type mongoFlowDependency struct {
+	UpstreamFlowOriginID value_object.UUID                  `bson:"upstream_flow_origin_id"`
+	On                   []value_object.DependencyTriggerOn `bson:"on"`
+	OptMappings          []mongoDependencyOptMapping        `bson:"opt_mappings,omitempty"`
+}
+
+func fromAggDependencies(dependencies []*aggregate.FlowDependency) []mongoFlowDependency {
+	if len(dependencies) == 0 {
+		return nil
+	}
+	resp := make([]mongoFlowDependency, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		mDependency := mongoFlowDependency{
+			UpstreamFlowOriginID: dependency.UpstreamFlowOriginID,
+			On:                   dependency.On,
+		}
+		for _, mapping := range dependency.OptMappings {
+			mDependency.OptMappings = append(mDependency.OptMappings, mongoDependencyOptMapping{
+				OptKey:         mapping.OptKey,
+				FlowFunctionID: mapping.FlowFunctionID,
+				IptIndex:       mapping.IptIndex,
+				ComponentIndex: mapping.ComponentIndex,
+			})
+		}
+		resp = append(resp, mDependency)
+	}
+	return resp
+}
+
+func toAggDependencies(dependencies []mongoFlowDependency) []*aggregate.FlowDependency {
+	if len(dependencies) == 0 {
+		return nil
+	}
+	resp := make([]*aggregate.FlowDependency, 0, len(dependencies))
+	for _, dependency := range dependencies {
+		aggDependency := &aggregate.FlowDependency{
+			UpstreamFlowOriginID: dependency.UpstreamFlowOriginID,
+			On:                   dependency.On,
+		}
+		for _, mapping := range dependency.OptMappings {
+			aggDependency.OptMappings = append(aggDependency.OptMappings, aggregate.DependencyOptMapping{
+				OptKey:         mapping.OptKey,
+				FlowFunctionID: mapping.FlowFunctionID,
+				IptIndex:       mapping.IptIndex,
+				ComponentIndex: mapping.ComponentIndex,
+			})
+		}
+		resp = append(resp, aggDependency)
+	}
+	return resp
 }
 
 type mongoFlowFunction struct {
-	FunctionID                value_object.UUID           `bson:"function_id"`
-	Note                      string                      `bson:"note"`
-	Position                  interface{}                 `bson:"position"`
-	UpstreamFlowFunctionIDs   []string                    `bson:"upstream_flowfunction_ids"`
-	DownstreamFlowFunctionIDs []string                    `bson:"downstream_flowfunction_ids"`
-	ParamIpts                 [][]mongoIptComponentConfig `bson:"param_ipts"` // 第一层对应一个ipt，第二层对应ipt内的component
+	FunctionID                value_object.UUID                `bson:"function_id"`
+	Note                      string                           `bson:"note"`
+	Position                  interface{}                      `bson:"position"`
+	UpstreamFlowFunctionIDs   []string                         `bson:"upstream_flowfunction_ids"`
+	DownstreamFlowFunctionIDs []string                         `bson:"downstream_flowfunction_ids"`
+	DownstreamConditions      map[string]*mongoBranchCondition `bson:"downstream_conditions,omitempty"`
+	Map                       *mongoMapSetting                 `bson:"map,omitempty"`
+	SubFlow                   *mongoSubFlowSetting             `bson:"sub_flow,omitempty"`
+	Approval                  *mongoApprovalSetting            `bson:"approval,omitempty"`
+	RetryPolicy               *mongoRetryPolicy                `bson:"retry_policy,omitempty"`
+	TimeoutInSeconds          uint32                           `bson:"timeout_in_seconds,omitempty"`
+	ParamIpts                 [][]mongoIptComponentConfig      `bson:"param_ipts"` // 第一层对应一个ipt，第二层对应ipt内的component
 }
 
 type mongoFlowFunctionIDMapFlowFunction map[string]*mongoFlowFunction
@@ -77,6 +348,46 @@ func fromAggFlowFunctionIDMapFlowFunction(
 			Position:                  flowFunc.Position,
 			UpstreamFlowFunctionIDs:   flowFunc.UpstreamFlowFunctionIDs,
 			DownstreamFlowFunctionIDs: flowFunc.DownstreamFlowFunctionIDs,
+			TimeoutInSeconds:          flowFunc.TimeoutInSeconds,
+		}
+		if len(flowFunc.DownstreamConditions) > 0 {
+			tmp.DownstreamConditions = make(
+				map[string]*mongoBranchCondition, len(flowFunc.DownstreamConditions))
+			for downFlowFuncID, condition := range flowFunc.DownstreamConditions {
+				tmp.DownstreamConditions[downFlowFuncID] = &mongoBranchCondition{
+					OptKey:   condition.OptKey,
+					Operator: condition.Operator,
+					Value:    condition.Value,
+				}
+			}
+		}
+		if flowFunc.Map != nil {
+			tmp.Map = &mongoMapSetting{
+				IptIndex:       flowFunc.Map.IptIndex,
+				MaxConcurrency: flowFunc.Map.MaxConcurrency,
+			}
+		}
+		if flowFunc.SubFlow != nil {
+			tmp.SubFlow = &mongoSubFlowSetting{
+				FlowOriginID: flowFunc.SubFlow.FlowOriginID,
+				IptTargets:   make([]mongoSubFlowIptTarget, 0, len(flowFunc.SubFlow.IptTargets)),
+			}
+			for _, target := range flowFunc.SubFlow.IptTargets {
+				tmp.SubFlow.IptTargets = append(tmp.SubFlow.IptTargets, mongoSubFlowIptTarget{
+					FlowFunctionID: target.FlowFunctionID,
+					IptIndex:       target.IptIndex,
+					ComponentIndex: target.ComponentIndex,
+				})
+			}
+		}
+		tmp.Approval = fromAggApprovalSetting(flowFunc.Approval)
+		if flowFunc.RetryPolicy != nil {
+			tmp.RetryPolicy = &mongoRetryPolicy{
+				MaxAttempts:      flowFunc.RetryPolicy.MaxAttempts,
+				Backoff:          flowFunc.RetryPolicy.Backoff,
+				IntervalInSecond: flowFunc.RetryPolicy.IntervalInSecond,
+				MaxDelayInSecond: flowFunc.RetryPolicy.MaxDelayInSecond,
+			}
 		}
 		tmp.ParamIpts = make([][]mongoIptComponentConfig, len(flowFunc.ParamIpts))
 		for i, ipt := range flowFunc.ParamIpts {
@@ -89,6 +400,7 @@ func fromAggFlowFunctionIDMapFlowFunction(
 					Value:          component.Value,
 					FlowFunctionID: component.FlowFunctionID,
 					Key:            component.Key,
+					Transform:      component.Transform,
 				}
 			}
 		}
@@ -106,6 +418,46 @@ func (mF mongoFlowFunctionIDMapFlowFunction) toAggFlowFunctionIDMapFlowFunction(
 			Position:                  flowFunc.Position,
 			UpstreamFlowFunctionIDs:   flowFunc.UpstreamFlowFunctionIDs,
 			DownstreamFlowFunctionIDs: flowFunc.DownstreamFlowFunctionIDs,
+			TimeoutInSeconds:          flowFunc.TimeoutInSeconds,
+		}
+		if len(flowFunc.DownstreamConditions) > 0 {
+			tmp.DownstreamConditions = make(
+				map[string]*aggregate.BranchCondition, len(flowFunc.DownstreamConditions))
+			for downFlowFuncID, condition := range flowFunc.DownstreamConditions {
+				tmp.DownstreamConditions[downFlowFuncID] = &aggregate.BranchCondition{
+					OptKey:   condition.OptKey,
+					Operator: condition.Operator,
+					Value:    condition.Value,
+				}
+			}
+		}
+		if flowFunc.Map != nil {
+			tmp.Map = &aggregate.MapSetting{
+				IptIndex:       flowFunc.Map.IptIndex,
+				MaxConcurrency: flowFunc.Map.MaxConcurrency,
+			}
+		}
+		if flowFunc.SubFlow != nil {
+			tmp.SubFlow = &aggregate.SubFlowSetting{
+				FlowOriginID: flowFunc.SubFlow.FlowOriginID,
+				IptTargets:   make([]aggregate.SubFlowIptTarget, 0, len(flowFunc.SubFlow.IptTargets)),
+			}
+			for _, target := range flowFunc.SubFlow.IptTargets {
+				tmp.SubFlow.IptTargets = append(tmp.SubFlow.IptTargets, aggregate.SubFlowIptTarget{
+					FlowFunctionID: target.FlowFunctionID,
+					IptIndex:       target.IptIndex,
+					ComponentIndex: target.ComponentIndex,
+				})
+			}
+		}
+		tmp.Approval = flowFunc.Approval.toAgg()
+		if flowFunc.RetryPolicy != nil {
+			tmp.RetryPolicy = &aggregate.RetryPolicy{
+				MaxAttempts:      flowFunc.RetryPolicy.MaxAttempts,
+				Backoff:          flowFunc.RetryPolicy.Backoff,
+				IntervalInSecond: flowFunc.RetryPolicy.IntervalInSecond,
+				MaxDelayInSecond: flowFunc.RetryPolicy.MaxDelayInSecond,
+			}
 		}
 		tmp.ParamIpts = make([][]aggregate.IptComponentConfig, len(flowFunc.ParamIpts))
 		for i, ipt := range flowFunc.ParamIpts {
@@ -117,6 +469,7 @@ func (mF mongoFlowFunctionIDMapFlowFunction) toAggFlowFunctionIDMapFlowFunction(
 					ValueType:      component.ValueType,
 					FlowFunctionID: component.FlowFunctionID,
 					Key:            component.Key,
+					Transform:      component.Transform,
 				}
 				// for the specific mongo data type primitive.A not influence outside world.
 				// do trans it here
@@ -146,12 +499,22 @@ type mongoFlow struct {
 	Position                      interface{}                        `bson:"position"`
 	FlowFunctionIDMapFlowFunction mongoFlowFunctionIDMapFlowFunction `bson:"flowFunctionID_map_flowFunction"`
 	Crontab                       *crontab.CrontabRepresent          `bson:"crontab,omitempty"`
+	CrontabMisfirePolicy          value_object.CrontabMisfirePolicy  `bson:"crontab_misfire_policy,omitempty"`
+	CrontabMisfireMaxRuns         uint16                             `bson:"crontab_misfire_max_runs,omitempty"`
+	CrontabLastFiredTime          time.Time                          `bson:"crontab_last_fired_time,omitempty"`
 	TriggerKey                    string                             `bson:"trigger_key"`
 	AllowTriggerByKey             bool                               `bson:"allow_trigger_by_key"`
 	TimeoutInSeconds              uint32                             `bson:"timeout_in_seconds,omitempty"`
 	RetryAmount                   uint16                             `bson:"retry_amount,omitempty"`
 	RetryIntervalInSecond         uint16                             `bson:"retry_interval_in_second,omitempty"`
 	AllowParallelRun              bool                               `bson:"allow_parallel_run,omitempty"`
+	MaxConcurrentRuns             uint16                             `bson:"max_concurrent_runs,omitempty"`
+	RunConflictStrategy           value_object.RunConflictStrategy   `bson:"run_conflict_strategy,omitempty"`
+	NotificationRules             []mongoNotificationRule            `bson:"notification_rules,omitempty"`
+	Paused                        bool                               `bson:"paused,omitempty"`
+	BlackoutWindows               []mongoBlackoutWindow              `bson:"blackout_windows,omitempty"`
+	Dependencies                  []mongoFlowDependency              `bson:"dependencies,omitempty"`
+	Params                        []mongoFlowParam                   `bson:"params,omitempty"`
 	ReadUserIDs                   []value_object.UUID                `bson:"read_user_ids"`
 	WriteUserIDs                  []value_object.UUID                `bson:"write_user_ids"`
 	ExecuteUserIDs                []value_object.UUID                `bson:"execute_user_ids"`
@@ -172,12 +535,22 @@ func (m mongoFlow) ToAggregate() *aggregate.Flow {
 		CreateTime:                    m.CreateTime,
 		Position:                      m.Position,
 		Crontab:                       m.Crontab,
+		CrontabMisfirePolicy:          m.CrontabMisfirePolicy,
+		CrontabMisfireMaxRuns:         m.CrontabMisfireMaxRuns,
+		CrontabLastFiredTime:          m.CrontabLastFiredTime,
 		TriggerKey:                    m.TriggerKey,
 		AllowTriggerByKey:             m.AllowTriggerByKey,
 		TimeoutInSeconds:              m.TimeoutInSeconds,
 		RetryAmount:                   m.RetryAmount,
 		RetryIntervalInSecond:         m.RetryIntervalInSecond,
 		AllowParallelRun:              m.AllowParallelRun,
+		MaxConcurrentRuns:             m.MaxConcurrentRuns,
+		RunConflictStrategy:           m.RunConflictStrategy,
+		NotificationRules:             toAggNotificationRules(m.NotificationRules),
+		Paused:                        m.Paused,
+		BlackoutWindows:               toAggBlackoutWindows(m.BlackoutWindows),
+		Dependencies:                  toAggDependencies(m.Dependencies),
+		Params:                        toAggParams(m.Params),
 		ReadUserIDs:                   m.ReadUserIDs,
 		WriteUserIDs:                  m.WriteUserIDs,
 		ExecuteUserIDs:                m.ExecuteUserIDs,
@@ -199,6 +572,9 @@ func NewFromFlow(f *aggregate.Flow) *mongoFlow {
 		CreateUserID:                  f.CreateUserID,
 		CreateTime:                    f.CreateTime,
 		Crontab:                       f.Crontab,
+		CrontabMisfirePolicy:          f.CrontabMisfirePolicy,
+		CrontabMisfireMaxRuns:         f.CrontabMisfireMaxRuns,
+		CrontabLastFiredTime:          f.CrontabLastFiredTime,
 		Position:                      f.Position,
 		TriggerKey:                    f.TriggerKey,
 		AllowTriggerByKey:             f.AllowTriggerByKey,
@@ -206,6 +582,13 @@ func NewFromFlow(f *aggregate.Flow) *mongoFlow {
 		RetryAmount:                   f.RetryAmount,
 		RetryIntervalInSecond:         f.RetryIntervalInSecond,
 		AllowParallelRun:              f.AllowParallelRun,
+		MaxConcurrentRuns:             f.MaxConcurrentRuns,
+		RunConflictStrategy:           f.RunConflictStrategy,
+		NotificationRules:             fromAggNotificationRules(f.NotificationRules),
+		Paused:                        f.Paused,
+		BlackoutWindows:               fromAggBlackoutWindows(f.BlackoutWindows),
+		Dependencies:                  fromAggDependencies(f.Dependencies),
+		Params:                        fromAggParams(f.Params),
 		ReadUserIDs:                   f.ReadUserIDs,
 		WriteUserIDs:                  f.WriteUserIDs,
 		ExecuteUserIDs:                f.ExecuteUserIDs,
@@ -318,6 +701,27 @@ func (mr *MongoRepository) FilterCrontabFlows() ([]aggregate.Flow, error) {
 	return ret, err
 }
 
+func (mr *MongoRepository) FilterDependentFlows(
+	upstreamFlowOriginID value_object.UUID,
+) ([]aggregate.Flow, error) {
+	filter := mongodb.NewFilter().
+		AddEqual("is_draft", false).
+		AddEqual("newest", true).
+		AddEqual("deleted", false).
+		AddEqual("dependencies.upstream_flow_origin_id", upstreamFlowOriginID)
+
+	var flows []mongoFlow
+	err := mr.mongoCollection.Filter(filter, &filter_options.FilterOption{}, &flows)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]aggregate.Flow, 0, len(flows))
+	for _, i := range flows {
+		ret = append(ret, *i.ToAggregate())
+	}
+	return ret, nil
+}
+
 func (mr *MongoRepository) Filter(
 	filter *value_object.RepositoryFilter,
 ) ([]aggregate.Flow, error) {
@@ -367,6 +771,24 @@ func (mr *MongoRepository) PatchName(id value_object.UUID, name string) error {
 	return mr.mongoCollection.PatchByID(id, updater)
 }
 
+// PatchMaxConcurrentRuns 更新允许并行运行时最多同时运行的数量
+func (mr *MongoRepository) PatchMaxConcurrentRuns(
+	id value_object.UUID, maxConcurrentRuns uint16,
+) error {
+	updater := mongodb.NewUpdater().
+		AddSet("max_concurrent_runs", maxConcurrentRuns)
+	return mr.mongoCollection.PatchByID(id, updater)
+}
+
+// PatchRunConflictStrategy 更新运行数达到上限时新运行的处理方式
+func (mr *MongoRepository) PatchRunConflictStrategy(
+	id value_object.UUID, strategy value_object.RunConflictStrategy,
+) error {
+	updater := mongodb.NewUpdater().
+		AddSet("run_conflict_strategy", strategy)
+	return mr.mongoCollection.PatchByID(id, updater)
+}
+
 // PatchWhetherAllowTriggerByKey 更新crontab配置
 func (mr *MongoRepository) PatchPosition(id value_object.UUID, position interface{}) error {
 	updater := mongodb.NewUpdater().AddSet("position", position)
@@ -397,7 +819,76 @@ func (mr *MongoRepository) PatchCrontab(id value_object.UUID, c *crontab.Crontab
 	if !c.IsZero() && !c.IsValid() {
 		return errors.New("crontab expression not valid")
 	}
-	updater := mongodb.NewUpdater().AddSet("crontab", c)
+	// 修改了crontab的，从修改时开始计算错过的计划时间
+	updater := mongodb.NewUpdater().
+		AddSet("crontab", c).
+		AddSet("crontab_last_fired_time", time.Now())
+	return mr.mongoCollection.PatchByID(id, updater)
+}
+
+// PatchCrontabMisfirePolicy 更新crontab计划时间被错过时的处理方式
+func (mr *MongoRepository) PatchCrontabMisfirePolicy(
+	id value_object.UUID, policy value_object.CrontabMisfirePolicy, maxRuns uint16,
+) error {
+	updater := mongodb.NewUpdater().
+		AddSet("crontab_misfire_policy", policy).
+		AddSet("crontab_misfire_max_runs", maxRuns)
+	return mr.mongoCollection.PatchByID(id, updater)
+}
+
+// PatchCrontabLastFiredTime 记录最近一次处理的crontab计划时间，只会往后更新
+func (mr *MongoRepository) PatchCrontabLastFiredTime(
+	id value_object.UUID, lastFiredTime time.Time,
+) error {
+	_, err := mr.mongoCollection.Patch(
+		mongodb.NewFilter().
+			AddEqual("id", id).
+			AddOr(
+				mongodb.NewFilter().AddNotExist("crontab_last_fired_time"),
+				mongodb.NewFilter().AddLt("crontab_last_fired_time", lastFiredTime)),
+		mongodb.NewUpdater().AddSet("crontab_last_fired_time", lastFiredTime))
+	return err
+}
+
+// PatchNotificationRules 更新运行结束后的通知规则
+func (mr *MongoRepository) PatchNotificationRules(
+	id value_object.UUID, rules []*aggregate.NotificationRule,
+) error {
+	updater := mongodb.NewUpdater().
+		AddSet("notification_rules", fromAggNotificationRules(rules))
+	return mr.mongoCollection.PatchByID(id, updater)
+}
+
+// PatchPaused 更新是否暂停运行
+func (mr *MongoRepository) PatchPaused(id value_object.UUID, paused bool) error {
+	updater := mongodb.NewUpdater().AddSet("paused", paused)
+	return mr.mongoCollection.PatchByID(id, updater)
+}
+
+// PatchBlackoutWindows 更新禁止运行的时段
+func (mr *MongoRepository) PatchBlackoutWindows(
+	id value_object.UUID, windows []*aggregate.BlackoutWindow,
+) error {
+	updater := mongodb.NewUpdater().
+		AddSet("blackout_windows", fromAggBlackoutWindows(windows))
+	return mr.mongoCollection.PatchByID(id, updater)
+}
+
+// PatchParams 更新flow参数的定义
+func (mr *MongoRepository) PatchParams(
+	id value_object.UUID, params []*aggregate.FlowParam,
+) error {
+	updater := mongodb.NewUpdater().
+		AddSet("params", fromAggParams(params))
+	return mr.mongoCollection.PatchByID(id, updater)
+}
+
+// PatchDependencies 更新依赖的上游flow
+func (mr *MongoRepository) PatchDependencies(
+	id value_object.UUID, dependencies []*aggregate.FlowDependency,
+) error {
+	updater := mongodb.NewUpdater().
+		AddSet("dependencies", fromAggDependencies(dependencies))
 	return mr.mongoCollection.PatchByID(id, updater)
 }
 
@@ -584,6 +1075,7 @@ func (mr *MongoRepository) CreateDraftForExistFlow(
 		TriggerKey:                    existFlow.TriggerKey,
 		Position:                      position,
 		FlowFunctionIDMapFlowFunction: funcs,
+		Params:                        existFlow.Params,
 		ReadUserIDs:                   existFlow.ReadUserIDs,
 		WriteUserIDs:                  existFlow.WriteUserIDs,
 		ExecuteUserIDs:                existFlow.ExecuteUserIDs,
@@ -626,12 +1118,21 @@ func (mr *MongoRepository) CreateOnlineFromDraft(
 	aggF.AssignPermissionUserIDs = latestFlow.AssignPermissionUserIDs
 	// 运行配置
 	aggF.AllowParallelRun = latestFlow.AllowParallelRun
+	aggF.MaxConcurrentRuns = latestFlow.MaxConcurrentRuns
+	aggF.RunConflictStrategy = latestFlow.RunConflictStrategy
 	aggF.Crontab = latestFlow.Crontab
+	aggF.CrontabMisfirePolicy = latestFlow.CrontabMisfirePolicy
+	aggF.CrontabMisfireMaxRuns = latestFlow.CrontabMisfireMaxRuns
+	aggF.CrontabLastFiredTime = latestFlow.CrontabLastFiredTime
 	aggF.TriggerKey = latestFlow.TriggerKey
 	aggF.AllowTriggerByKey = latestFlow.AllowTriggerByKey
 	aggF.TimeoutInSeconds = latestFlow.TimeoutInSeconds
 	aggF.RetryAmount = latestFlow.RetryAmount
 	aggF.RetryIntervalInSecond = latestFlow.RetryIntervalInSecond
+	aggF.NotificationRules = latestFlow.NotificationRules
+	aggF.Paused = latestFlow.Paused
+	aggF.BlackoutWindows = latestFlow.BlackoutWindows
+	aggF.Dependencies = latestFlow.Dependencies
 	// 2. 如果老的在线，需要进行下线
 	if latestFlow.Newest {
 		err = mr.OfflineByID(latestFlow.ID)
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/fBloc/bloc-server/aggregate"
@@ -413,6 +414,24 @@ func TestOnline(t *testing.T) {
 			So(f.TimeoutInSeconds, ShouldEqual, 1000)
 		})
 
+		Convey("PatchPaused & PatchBlackoutWindows", func() {
+			f, _ := epo.GetByID(onlineFlow.ID)
+			So(f.Paused, ShouldBeFalse)
+			So(len(f.BlackoutWindows), ShouldEqual, 0)
+
+			err := epo.PatchPaused(onlineFlow.ID, true)
+			So(err, ShouldBeNil)
+			err = epo.PatchBlackoutWindows(onlineFlow.ID, []*aggregate.BlackoutWindow{
+				{Weekdays: []time.Weekday{time.Saturday}, Start: "00:00", End: "06:00"}})
+			So(err, ShouldBeNil)
+
+			f, _ = epo.GetByID(onlineFlow.ID)
+			So(f.Paused, ShouldBeTrue)
+			So(len(f.BlackoutWindows), ShouldEqual, 1)
+			So(f.BlackoutWindows[0].Weekdays, ShouldResemble, []time.Weekday{time.Saturday})
+			So(f.BlackoutWindows[0].End, ShouldEqual, "06:00")
+		})
+
 		Convey("PatchName", func() {
 			f, _ := epo.GetByID(onlineFlow.ID)
 			So(f.Name, ShouldEqual, fakeName)
@@ -1,6 +1,8 @@
 package flow
 
 import (
+	"time"
+
 	"github.com/fBloc/bloc-server/aggregate"
 	"github.com/fBloc/bloc-server/internal/crontab"
 	"github.com/fBloc/bloc-server/value_object"
@@ -34,6 +36,8 @@ type FlowRepository interface {
 
 	FilterOnline(user *aggregate.User, nameContains string, withoutFields []string) (flows []aggregate.Flow, err error)
 	FilterCrontabFlows() (flows []aggregate.Flow, err error)
+	// FilterDependentFlows 依赖了某个上游flow的在线flow
+	FilterDependentFlows(upstreamFlowOriginID value_object.UUID) (flows []aggregate.Flow, err error)
 	FilterDraft(userID value_object.UUID, nameContains string, withoutFields []string) (flows []aggregate.Flow, err error)
 	Filter(filter *value_object.RepositoryFilter) (flows []aggregate.Flow, err error)
 
@@ -42,10 +46,19 @@ type FlowRepository interface {
 	PatchPosition(id value_object.UUID, position interface{}) error
 	// PatchFuncs(id value_object.UUID, funcs map[string]*flow_bloc.) error
 	PatchCrontab(id value_object.UUID, c *crontab.CrontabRepresent) error
+	PatchCrontabMisfirePolicy(id value_object.UUID, policy value_object.CrontabMisfirePolicy, maxRuns uint16) error
+	PatchCrontabLastFiredTime(id value_object.UUID, lastFiredTime time.Time) error
 	PatchAllowParallelRun(id value_object.UUID, pub bool) error
+	PatchMaxConcurrentRuns(id value_object.UUID, maxConcurrentRuns uint16) error
+	PatchRunConflictStrategy(id value_object.UUID, strategy value_object.RunConflictStrategy) error
 	PatchRetryStrategy(id value_object.UUID, amount, intervalInSecond uint16) error
 	PatchWhetherAllowTriggerByKey(id value_object.UUID, allowed bool) error
 	PatchTimeout(id value_object.UUID, tOS uint32) error
+	PatchNotificationRules(id value_object.UUID, rules []*aggregate.NotificationRule) error
+	PatchPaused(id value_object.UUID, paused bool) error
+	PatchBlackoutWindows(id value_object.UUID, windows []*aggregate.BlackoutWindow) error
+	PatchDependencies(id value_object.UUID, dependencies []*aggregate.FlowDependency) error
+	PatchParams(id value_object.UUID, params []*aggregate.FlowParam) error
 	PatchFlowFunctionIDMapFlowFunction(
 		id value_object.UUID,
 		flowFunctionIDMapFlowFunction map[string]*aggregate.FlowFunction,
@@ -0,0 +1,114 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/repository/flow_lock"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+func init() {
+	var _ flow_lock.FlowLockRepository = &MemoryRepository{}
+}
+
+type lockKey struct {
+	flowOriginID value_object.UUID
+	slot         int
+}
+
+type MemoryRepository struct {
+	locks map[lockKey]aggregate.FlowLock
+	sync.Mutex
+}
+
+// Create a new in-memory repository
+func New() *MemoryRepository {
+	return &MemoryRepository{locks: make(map[lockKey]aggregate.FlowLock)}
+}
+
+func (mr *MemoryRepository) Acquire(
+	flowOriginID value_object.UUID, slot int,
+	holderID value_object.UUID, ttl time.Duration,
+) (*aggregate.FlowLock, bool, error) {
+	mr.Lock()
+	defer mr.Unlock()
+
+	now := time.Now()
+	key := lockKey{flowOriginID: flowOriginID, slot: slot}
+	lock, ok := mr.locks[key]
+	if ok && lock.IsHeldAt(now) && lock.HolderID != holderID {
+		return &lock, false, nil
+	}
+	lock.FlowOriginID = flowOriginID
+	lock.Slot = slot
+	lock.HolderID = holderID
+	lock.Version++
+	lock.ExpireTime = now.Add(ttl)
+	mr.locks[key] = lock
+	return &lock, true, nil
+}
+
+func (mr *MemoryRepository) filter(match func(aggregate.FlowLock) bool) []*aggregate.FlowLock {
+	mr.Lock()
+	defer mr.Unlock()
+
+	resp := make([]*aggregate.FlowLock, 0, len(mr.locks))
+	for _, lock := range mr.locks {
+		if !match(lock) {
+			continue
+		}
+		c := lock
+		resp = append(resp, &c)
+	}
+	sort.Slice(resp, func(i, j int) bool { return resp[i].Slot < resp[j].Slot })
+	return resp
+}
+
+func (mr *MemoryRepository) FilterByFlowOriginID(
+	flowOriginID value_object.UUID,
+) ([]*aggregate.FlowLock, error) {
+	return mr.filter(func(lock aggregate.FlowLock) bool {
+		return lock.FlowOriginID == flowOriginID
+	}), nil
+}
+
+func (mr *MemoryRepository) FilterHeld() ([]*aggregate.FlowLock, error) {
+	return mr.filter(func(lock aggregate.FlowLock) bool {
+		return !lock.HolderID.IsNil()
+	}), nil
+}
+
+// patchHeld 仅当锁仍由holder以此版本持有时修改
+func (mr *MemoryRepository) patchHeld(
+	heldLock *aggregate.FlowLock, modify func(*aggregate.FlowLock),
+) bool {
+	mr.Lock()
+	defer mr.Unlock()
+
+	key := lockKey{flowOriginID: heldLock.FlowOriginID, slot: heldLock.Slot}
+	lock, ok := mr.locks[key]
+	if !ok || lock.HolderID != heldLock.HolderID || lock.Version != heldLock.Version {
+		return false
+	}
+	modify(&lock)
+	mr.locks[key] = lock
+	return true
+}
+
+func (mr *MemoryRepository) Renew(
+	lock *aggregate.FlowLock, ttl time.Duration,
+) (bool, error) {
+	return mr.patchHeld(lock, func(l *aggregate.FlowLock) {
+		l.ExpireTime = time.Now().Add(ttl)
+	}), nil
+}
+
+func (mr *MemoryRepository) Release(lock *aggregate.FlowLock) (bool, error) {
+	return mr.patchHeld(lock, func(l *aggregate.FlowLock) {
+		l.HolderID = value_object.NillUUID
+		l.ExpireTime = time.Time{}
+	}), nil
+}
@@ -0,0 +1,23 @@
+package mongo
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func mongoDBIndexes() []mongo.IndexModel {
+	truePoint := true
+	return []mongo.IndexModel{
+		{
+			// 唯一索引保证同一flow的同一槽位只有一个锁文档，并发获取时只有一方能够插入成功
+			Keys: bson.D{
+				{Key: "flow_origin_id", Value: 1},
+				{Key: "slot", Value: 1},
+			},
+			Options: &options.IndexOptions{
+				Unique: &truePoint,
+			},
+		},
+	}
+}
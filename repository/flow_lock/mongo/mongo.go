@@ -0,0 +1,160 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/internal/conns/mongodb"
+	"github.com/fBloc/bloc-server/internal/filter_options"
+	"github.com/fBloc/bloc-server/repository/flow_lock"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+const (
+	DefaultCollectionName = "flow_lock"
+)
+
+func init() {
+	var _ flow_lock.FlowLockRepository = &MongoRepository{}
+}
+
+type MongoRepository struct {
+	mongoCollection *mongodb.Collection
+}
+
+// Create a new mongodb repository
+func New(
+	ctx context.Context,
+	mC *mongodb.MongoConfig, collectionName string,
+) (*MongoRepository, error) {
+	collection, err := mongodb.NewCollection(mC, collectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	// 唯一索引是锁互斥的保证，创建失败不能继续
+	indexes := mongoDBIndexes()
+	err = collection.CreateIndex(indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MongoRepository{mongoCollection: collection}, nil
+}
+
+type mongoFlowLock struct {
+	FlowOriginID value_object.UUID `bson:"flow_origin_id"`
+	Slot         int               `bson:"slot"`
+	HolderID     value_object.UUID `bson:"holder_id"`
+	Version      uint64            `bson:"version"`
+	ExpireTime   time.Time         `bson:"expire_time"`
+}
+
+func (m *mongoFlowLock) ToAggregate() *aggregate.FlowLock {
+	return &aggregate.FlowLock{
+		FlowOriginID: m.FlowOriginID,
+		Slot:         m.Slot,
+		HolderID:     m.HolderID,
+		Version:      m.Version,
+		ExpireTime:   m.ExpireTime,
+	}
+}
+
+func (mr *MongoRepository) Acquire(
+	flowOriginID value_object.UUID, slot int,
+	holderID value_object.UUID, ttl time.Duration,
+) (*aggregate.FlowLock, bool, error) {
+	now := time.Now()
+	var mFL mongoFlowLock
+	duplicated, err := mr.mongoCollection.FindOneAndUpsert(
+		mongodb.NewFilter().
+			AddEqual("flow_origin_id", flowOriginID).
+			AddEqual("slot", slot).
+			AddOr(
+				mongodb.NewFilter().AddLte("expire_time", now),
+				mongodb.NewFilter().AddEqual("holder_id", holderID)),
+		mongodb.NewUpdater().
+			AddSet("holder_id", holderID).
+			AddSet("expire_time", now.Add(ttl)).
+			AddInc("version", 1),
+		&mFL)
+	if err != nil {
+		return nil, false, err
+	}
+	if duplicated { // 锁被其他运行持有中
+		var current mongoFlowLock
+		err = mr.mongoCollection.Get(
+			mongodb.NewFilter().
+				AddEqual("flow_origin_id", flowOriginID).
+				AddEqual("slot", slot),
+			filter_options.NewFilterOption(), &current)
+		if err != nil {
+			return nil, false, err
+		}
+		return current.ToAggregate(), false, nil
+	}
+	return mFL.ToAggregate(), true, nil
+}
+
+func (mr *MongoRepository) filter(
+	filter value_object.RepositoryFilter,
+) ([]*aggregate.FlowLock, error) {
+	var mFLs []mongoFlowLock
+	err := mr.mongoCollection.CommonFilter(
+		filter, *value_object.NewRepositoryFilterOption(), &mFLs)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]*aggregate.FlowLock, 0, len(mFLs))
+	for _, i := range mFLs {
+		resp = append(resp, i.ToAggregate())
+	}
+	return resp, nil
+}
+
+func (mr *MongoRepository) FilterByFlowOriginID(
+	flowOriginID value_object.UUID,
+) ([]*aggregate.FlowLock, error) {
+	return mr.filter(
+		*value_object.NewRepositoryFilter().AddEqual("flow_origin_id", flowOriginID))
+}
+
+func (mr *MongoRepository) FilterHeld() ([]*aggregate.FlowLock, error) {
+	return mr.filter(
+		*value_object.NewRepositoryFilter().AddNotEqual("holder_id", value_object.NillUUID))
+}
+
+func heldByFilter(lock *aggregate.FlowLock) *mongodb.MongoFilter {
+	return mongodb.NewFilter().
+		AddEqual("flow_origin_id", lock.FlowOriginID).
+		AddEqual("slot", lock.Slot).
+		AddEqual("holder_id", lock.HolderID).
+		AddEqual("version", lock.Version)
+}
+
+func (mr *MongoRepository) Renew(
+	lock *aggregate.FlowLock, ttl time.Duration,
+) (bool, error) {
+	patchedAmount, err := mr.mongoCollection.Patch(
+		heldByFilter(lock),
+		mongodb.NewUpdater().AddSet("expire_time", time.Now().Add(ttl)))
+	if err != nil {
+		return false, err
+	}
+	return patchedAmount > 0, nil
+}
+
+// Release 不删除文档，版本需一直保持递增
+func (mr *MongoRepository) Release(lock *aggregate.FlowLock) (bool, error) {
+	patchedAmount, err := mr.mongoCollection.Patch(
+		heldByFilter(lock),
+		mongodb.NewUpdater().
+			AddSet("holder_id", value_object.NillUUID).
+			AddSet("expire_time", time.Time{}))
+	if err != nil {
+		return false, err
+	}
+	return patchedAmount > 0, nil
+}
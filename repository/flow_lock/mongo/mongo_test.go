@@ -0,0 +1,165 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/internal/conns/mongodb"
+	"github.com/fBloc/bloc-server/value_object"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	epo  *MongoRepository
+	conf = &mongodb.MongoConfig{
+		Db:       "bloc-test-mongo",
+		User:     "root",
+		Password: "password",
+	}
+)
+
+func TestFlowLock(t *testing.T) {
+	flowOriginID := value_object.NewUUID()
+	holderID := value_object.NewUUID()
+	anotherHolderID := value_object.NewUUID()
+
+	Convey("acquire & mutual exclusion", t, func() {
+		lock, acquired, err := epo.Acquire(flowOriginID, 0, holderID, time.Minute)
+		So(err, ShouldBeNil)
+		So(acquired, ShouldBeTrue)
+		So(lock.HolderID, ShouldEqual, holderID)
+		firstVersion := lock.Version
+
+		lock, acquired, err = epo.Acquire(flowOriginID, 0, anotherHolderID, time.Minute)
+		So(err, ShouldBeNil)
+		So(acquired, ShouldBeFalse)
+		So(lock.HolderID, ShouldEqual, holderID)
+
+		// 同一持有者可以重复获取
+		lock, acquired, err = epo.Acquire(flowOriginID, 0, holderID, time.Minute)
+		So(err, ShouldBeNil)
+		So(acquired, ShouldBeTrue)
+		So(lock.Version, ShouldBeGreaterThan, firstVersion)
+
+		held, err := epo.FilterHeld()
+		So(err, ShouldBeNil)
+		So(len(held), ShouldBeGreaterThanOrEqualTo, 1)
+
+		// 旧版本无法释放
+		staleLock := *lock
+		staleLock.Version = firstVersion
+		released, err := epo.Release(&staleLock)
+		So(err, ShouldBeNil)
+		So(released, ShouldBeFalse)
+
+		renewed, err := epo.Renew(lock, time.Minute)
+		So(err, ShouldBeNil)
+		So(renewed, ShouldBeTrue)
+
+		released, err = epo.Release(lock)
+		So(err, ShouldBeNil)
+		So(released, ShouldBeTrue)
+
+		lock, acquired, err = epo.Acquire(flowOriginID, 0, anotherHolderID, time.Minute)
+		So(err, ShouldBeNil)
+		So(acquired, ShouldBeTrue)
+		So(lock.HolderID, ShouldEqual, anotherHolderID)
+	})
+
+	Convey("slots are independent", t, func() {
+		slotFlowOriginID := value_object.NewUUID()
+		_, acquired, err := epo.Acquire(slotFlowOriginID, 0, holderID, time.Minute)
+		So(err, ShouldBeNil)
+		So(acquired, ShouldBeTrue)
+
+		lock, acquired, err := epo.Acquire(slotFlowOriginID, 1, anotherHolderID, time.Minute)
+		So(err, ShouldBeNil)
+		So(acquired, ShouldBeTrue)
+		So(lock.Slot, ShouldEqual, 1)
+
+		locks, err := epo.FilterByFlowOriginID(slotFlowOriginID)
+		So(err, ShouldBeNil)
+		So(len(locks), ShouldEqual, 2)
+	})
+
+	Convey("expired lock can be acquired by others", t, func() {
+		expireFlowOriginID := value_object.NewUUID()
+		_, acquired, err := epo.Acquire(expireFlowOriginID, 0, holderID, time.Millisecond)
+		So(err, ShouldBeNil)
+		So(acquired, ShouldBeTrue)
+		time.Sleep(5 * time.Millisecond)
+
+		lock, acquired, err := epo.Acquire(expireFlowOriginID, 0, anotherHolderID, time.Minute)
+		So(err, ShouldBeNil)
+		So(acquired, ShouldBeTrue)
+		So(lock.HolderID, ShouldEqual, anotherHolderID)
+	})
+}
+
+func TestMain(m *testing.M) {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		log.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	// pull mongodb docker image for version 5.0
+	resource, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository: "mongo",
+		Tag:        "5.0.5",
+		Env: []string{
+			// username and password for mongodb superuser
+			"MONGO_INITDB_ROOT_USERNAME=" + conf.User,
+			"MONGO_INITDB_ROOT_PASSWORD=" + conf.Password,
+		},
+	}, func(config *docker.HostConfig) {
+		// set AutoRemove to true so that stopped container goes away by itself
+		config.AutoRemove = true
+		config.RestartPolicy = docker.RestartPolicy{
+			Name: "no",
+		}
+	})
+	if err != nil {
+		log.Fatalf("Could not start resource: %s", err)
+	}
+
+	conf.Addresses = []string{
+		fmt.Sprintf("localhost:%s", resource.GetPort("27017/tcp"))}
+
+	// exponential backoff-retry, because the application in the container might not be ready to accept connections yet
+	err = pool.Retry(func() error {
+		var err error
+		epo, err = New(context.TODO(), conf, DefaultCollectionName)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	// run tests
+	code := m.Run()
+
+	// When you're done, kill and remove the container
+	if err = pool.Purge(resource); err != nil {
+		log.Fatalf("Could not purge resource: %s", err)
+	}
+
+	os.Exit(code)
+}
+
+func TestCreateIndexes(t *testing.T) {
+	Convey("create index", t, func() {
+		indexes := mongoDBIndexes()
+		err := epo.mongoCollection.CreateIndex(indexes)
+		So(err, ShouldBeNil)
+	})
+}
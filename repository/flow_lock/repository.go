@@ -0,0 +1,28 @@
+package flow_lock
+
+import (
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+type FlowLockRepository interface {
+	// Acquire 槽位锁未被持有(不存在、已释放、已过期)或已被此holder持有时获取成功，
+	// 获取成功时版本递增并返回获取后的锁；失败时返回当前的锁
+	Acquire(
+		flowOriginID value_object.UUID, slot int,
+		holderID value_object.UUID, ttl time.Duration,
+	) (lock *aggregate.FlowLock, acquired bool, err error)
+
+	// read
+	// FilterByFlowOriginID 某个flow所有槽位的锁(包含未被持有的)
+	FilterByFlowOriginID(flowOriginID value_object.UUID) ([]*aggregate.FlowLock, error)
+	// FilterHeld 所有有持有者的锁（包含已过期但未释放的）
+	FilterHeld() ([]*aggregate.FlowLock, error)
+
+	// Renew 仅当锁仍由lock中的holder以其版本持有时续期
+	Renew(lock *aggregate.FlowLock, ttl time.Duration) (bool, error)
+	// Release 仅当锁仍由lock中的holder以其版本持有时释放
+	Release(lock *aggregate.FlowLock) (bool, error)
+}
@@ -0,0 +1,351 @@
+package memory
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/internal/crontab"
+	"github.com/fBloc/bloc-server/internal/memory_filter"
+	"github.com/fBloc/bloc-server/repository/flow_run_record"
+	mongo_flowRunRecord "github.com/fBloc/bloc-server/repository/flow_run_record/mongo"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+func init() {
+	var _ flow_run_record.FlowRunRecordRepository = &MemoryRepository{}
+}
+
+type MemoryRepository struct {
+	records      []*aggregate.FlowRunRecord // 按插入顺序
+	crontabFlags map[string]struct{}        // same crontab not repub
+	sync.RWMutex
+}
+
+// Create a new in-memory repository
+func New() *MemoryRepository {
+	return &MemoryRepository{crontabFlags: make(map[string]struct{})}
+}
+
+func copyRecord(fRR *aggregate.FlowRunRecord) *aggregate.FlowRunRecord {
+	if fRR == nil {
+		return nil
+	}
+	c := *fRR
+	return &c
+}
+
+// toDocument 通用过滤条件中的key为持久化字段名，故转为与mongo一致的文档后再做匹配
+func toDocument(fRR *aggregate.FlowRunRecord) memory_filter.Document {
+	doc, err := memory_filter.ToDocument(mongo_flowRunRecord.NewFromAggregate(fRR))
+	if err != nil {
+		return memory_filter.Document{}
+	}
+	return doc
+}
+
+func (mr *MemoryRepository) getLatest(match func(*aggregate.FlowRunRecord) bool) *aggregate.FlowRunRecord {
+	mr.RLock()
+	defer mr.RUnlock()
+	for i := len(mr.records) - 1; i >= 0; i-- {
+		if match(mr.records[i]) {
+			return copyRecord(mr.records[i])
+		}
+	}
+	return &aggregate.FlowRunRecord{} // 同mongo实现，未找到时返回空值而非nil
+}
+
+// patch 修改时整体替换，避免已返回给调用方的数据被并发修改
+func (mr *MemoryRepository) patch(id value_object.UUID, modify func(*aggregate.FlowRunRecord)) error {
+	mr.Lock()
+	defer mr.Unlock()
+	for i, fRR := range mr.records {
+		if fRR.ID == id {
+			c := copyRecord(fRR)
+			modify(c)
+			mr.records[i] = c
+			return nil
+		}
+	}
+	return nil
+}
+
+func (mr *MemoryRepository) Create(fRR *aggregate.FlowRunRecord) error {
+	mr.Lock()
+	defer mr.Unlock()
+	mr.records = append(mr.records, copyRecord(fRR))
+	return nil
+}
+
+func (mr *MemoryRepository) CrontabFindOrCreate(
+	fRR *aggregate.FlowRunRecord,
+	crontabTime time.Time,
+) (created bool, err error) {
+	crontabRep := fmt.Sprintf("%s_%s",
+		fRR.FlowID.String(), crontab.TriggeredTimeFlag(crontabTime))
+
+	mr.Lock()
+	defer mr.Unlock()
+	if _, ok := mr.crontabFlags[crontabRep]; ok {
+		return false, nil
+	}
+	mr.crontabFlags[crontabRep] = struct{}{}
+	mr.records = append(mr.records, copyRecord(fRR))
+	return true, nil
+}
+
+func (mr *MemoryRepository) DependencyFindOrCreate(
+	fRR *aggregate.FlowRunRecord,
+) (created bool, err error) {
+	mr.Lock()
+	defer mr.Unlock()
+	for _, record := range mr.records {
+		if record.FlowID == fRR.FlowID &&
+			record.UpstreamFlowRunRecordID == fRR.UpstreamFlowRunRecordID {
+			return false, nil
+		}
+	}
+	mr.records = append(mr.records, copyRecord(fRR))
+	return true, nil
+}
+
+func (mr *MemoryRepository) GetByID(id value_object.UUID) (*aggregate.FlowRunRecord, error) {
+	return mr.getLatest(func(fRR *aggregate.FlowRunRecord) bool { return fRR.ID == id }), nil
+}
+
+func (mr *MemoryRepository) ReGetToCheckIsCanceled(id value_object.UUID) bool {
+	aggFRR, _ := mr.GetByID(id)
+	if aggFRR.IsZero() {
+		return false
+	}
+	return aggFRR.Canceled
+}
+
+func (mr *MemoryRepository) GetLatestByFlowOriginID(
+	flowOriginID value_object.UUID,
+) (*aggregate.FlowRunRecord, error) {
+	return mr.getLatest(func(fRR *aggregate.FlowRunRecord) bool {
+		return fRR.FlowOriginID == flowOriginID
+	}), nil
+}
+
+func (mr *MemoryRepository) GetLatestByFlowID(
+	flowID value_object.UUID,
+) (*aggregate.FlowRunRecord, error) {
+	return mr.getLatest(func(fRR *aggregate.FlowRunRecord) bool {
+		return fRR.FlowID == flowID
+	}), nil
+}
+
+func (mr *MemoryRepository) IsHaveRunningTask(
+	flowID, thisFlowRunRecordID value_object.UUID,
+) (bool, error) {
+	notFinishedStatus := make(map[value_object.RunState]struct{})
+	for _, i := range value_object.NotFinishedRunStatus() {
+		notFinishedStatus[i] = struct{}{}
+	}
+
+	latest := mr.getLatest(func(fRR *aggregate.FlowRunRecord) bool {
+		if fRR.FlowID != flowID || fRR.ID == thisFlowRunRecordID {
+			return false
+		}
+		_, notFinished := notFinishedStatus[fRR.Status]
+		return notFinished
+	})
+	if latest.IsZero() {
+		return false, nil
+	}
+	return latest.EndTime.IsZero(), nil
+}
+
+func (mr *MemoryRepository) filter(
+	filter value_object.RepositoryFilter,
+) []*aggregate.FlowRunRecord {
+	mr.RLock()
+	defer mr.RUnlock()
+	matched := make([]*aggregate.FlowRunRecord, 0)
+	for _, fRR := range mr.records {
+		if toDocument(fRR).Match(filter) {
+			matched = append(matched, fRR)
+		}
+	}
+	return matched
+}
+
+func (mr *MemoryRepository) Filter(
+	filter value_object.RepositoryFilter,
+	filterOption value_object.RepositoryFilterOption,
+) ([]*aggregate.FlowRunRecord, error) {
+	matched := mr.filter(filter)
+	indexes := memory_filter.PageIndexes(len(matched), filterOption)
+	resp := make([]*aggregate.FlowRunRecord, 0, len(indexes))
+	for _, i := range indexes {
+		resp = append(resp, copyRecord(matched[i]))
+	}
+	return resp, nil
+}
+
+func (mr *MemoryRepository) Count(filter value_object.RepositoryFilter) (int64, error) {
+	return int64(len(mr.filter(filter))), nil
+}
+
+func (mr *MemoryRepository) AllRunRecordOfFlowTriggeredByFlowID(
+	flowID value_object.UUID,
+) ([]*aggregate.FlowRunRecord, error) {
+	return mr.Filter(
+		*value_object.NewRepositoryFilter().AddEqual("flow_id", flowID),
+		*value_object.NewRepositoryFilterOption())
+}
+
+func (mr *MemoryRepository) PatchDataForRetry(id value_object.UUID, retriedAmount uint16) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		fRR.RetriedAmount = retriedAmount + 1
+	})
+}
+
+func (mr *MemoryRepository) PatchFlowFuncIDMapFuncRunRecordID(
+	id value_object.UUID,
+	FlowFuncIDMapFuncRunRecordID map[string]value_object.UUID,
+) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		fRR.FlowFuncIDMapFuncRunRecordID = make(
+			map[string]value_object.UUID, len(FlowFuncIDMapFuncRunRecordID))
+		for k, v := range FlowFuncIDMapFuncRunRecordID {
+			fRR.FlowFuncIDMapFuncRunRecordID[k] = v
+		}
+		fRR.Status = value_object.Running
+	})
+}
+
+func (mr *MemoryRepository) AddFlowFuncIDMapFuncRunRecordID(
+	id value_object.UUID,
+	flowFuncID string,
+	funcRunRecordID value_object.UUID,
+) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		newMap := make(map[string]value_object.UUID, len(fRR.FlowFuncIDMapFuncRunRecordID)+1)
+		for k, v := range fRR.FlowFuncIDMapFuncRunRecordID {
+			newMap[k] = v
+		}
+		newMap[flowFuncID] = funcRunRecordID
+		fRR.FlowFuncIDMapFuncRunRecordID = newMap
+	})
+}
+
+func (mr *MemoryRepository) Start(id value_object.UUID) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		fRR.Status = value_object.Running
+		fRR.StartTime = time.Now()
+	})
+}
+
+func (mr *MemoryRepository) Suc(id value_object.UUID) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		fRR.Status = value_object.Suc
+		fRR.EndTime = time.Now()
+	})
+}
+
+func (mr *MemoryRepository) NotAllowedParallelRun(id value_object.UUID) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		fRR.Status = value_object.NotAllowedParallelCancel
+		fRR.EndTime = time.Now()
+	})
+}
+
+func (mr *MemoryRepository) ScheduleSkipped(id value_object.UUID, reason string) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		fRR.Status = value_object.ScheduleSkipped
+		fRR.ErrorMsg = reason
+		fRR.EndTime = time.Now()
+	})
+}
+
+func (mr *MemoryRepository) InQueue(id value_object.UUID) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		fRR.Status = value_object.InQueue
+	})
+}
+
+func (mr *MemoryRepository) Dequeue(id value_object.UUID) (bool, error) {
+	dequeued := false
+	err := mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		if fRR.Status != value_object.InQueue {
+			return
+		}
+		fRR.Status = value_object.Created
+		dequeued = true
+	})
+	return dequeued, err
+}
+
+func (mr *MemoryRepository) WaitingApproval(id value_object.UUID) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		if fRR.Status.IsRunFinished() {
+			return
+		}
+		fRR.Status = value_object.WaitingApproval
+	})
+}
+
+func (mr *MemoryRepository) ApprovalResolved(id value_object.UUID) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		if fRR.Status != value_object.WaitingApproval {
+			return
+		}
+		fRR.Status = value_object.Running
+	})
+}
+
+func (mr *MemoryRepository) SaveFlowLockVersion(id value_object.UUID, version uint64) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		fRR.FlowLockVersion = version
+	})
+}
+
+func (mr *MemoryRepository) ReplacedCancel(id, byFlowRunRecordID value_object.UUID) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		fRR.Status = value_object.ReplacedCancel
+		fRR.Canceled = true
+		fRR.ErrorMsg = "replaced by flow_run_record " + byFlowRunRecordID.String()
+		fRR.EndTime = time.Now()
+	})
+}
+
+func (mr *MemoryRepository) Fail(id value_object.UUID, errorMsg string) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		fRR.Status = value_object.Fail
+		fRR.ErrorMsg = errorMsg
+		fRR.EndTime = time.Now()
+	})
+}
+
+func (mr *MemoryRepository) FunctionDead(id value_object.UUID, errorMsg string) error {
+	return mr.Fail(id, errorMsg)
+}
+
+func (mr *MemoryRepository) Intercepted(id value_object.UUID, msg string) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		fRR.Status = value_object.InterceptedCancel
+		fRR.InterceptMsg = msg
+		fRR.EndTime = time.Now()
+	})
+}
+
+func (mr *MemoryRepository) TimeoutCancel(id value_object.UUID) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		fRR.Status = value_object.TimeoutCanceled
+		fRR.Canceled = true
+		fRR.EndTime = time.Now()
+	})
+}
+
+func (mr *MemoryRepository) UserCancel(id, userID value_object.UUID) error {
+	return mr.patch(id, func(fRR *aggregate.FlowRunRecord) {
+		fRR.Status = value_object.UserCanceled
+		fRR.Canceled = true
+		fRR.CancelUserID = userID
+		fRR.EndTime = time.Now()
+	})
+}
@@ -66,6 +66,10 @@ type mongoFlowRunRecord struct {
 	CancelUserID                 value_object.UUID                    `bson:"cancel_user_id"`
 	TraceID                      string                               `bson:"trace_id"`
 	OverideIptParams             map[string][][]interface{}           `bson:"overide_ipt_params,omitempty"`
+	RerunFromRecordID            value_object.UUID                    `bson:"rerun_from_record_id,omitempty"`
+	UpstreamFlowRunRecordID      value_object.UUID                    `bson:"upstream_flow_run_record_id,omitempty"`
+	Params                       map[string]interface{}               `bson:"params,omitempty"`
+	FlowLockVersion              uint64                               `bson:"flow_lock_version,omitempty"`
 }
 
 func (m *mongoFlowRunRecord) IsZero() bool {
@@ -106,6 +110,10 @@ func NewFromAggregate(
 		CancelUserID:                 fRR.CancelUserID,
 		TraceID:                      fRR.TraceID,
 		OverideIptParams:             fRR.OverideIptParams,
+		RerunFromRecordID:            fRR.RerunFromRecordID,
+		UpstreamFlowRunRecordID:      fRR.UpstreamFlowRunRecordID,
+		Params:                       fRR.Params,
+		FlowLockVersion:              fRR.FlowLockVersion,
 	}
 	return &resp
 }
@@ -136,6 +144,10 @@ func (m mongoFlowRunRecord) ToAggregate() *aggregate.FlowRunRecord {
 		CancelUserID:                 m.CancelUserID,
 		TraceID:                      m.TraceID,
 		OverideIptParams:             m.OverideIptParams,
+		RerunFromRecordID:            m.RerunFromRecordID,
+		UpstreamFlowRunRecordID:      m.UpstreamFlowRunRecordID,
+		Params:                       m.Params,
+		FlowLockVersion:              m.FlowLockVersion,
 	}
 	return &resp
 }
@@ -170,6 +182,28 @@ func (mr *MongoRepository) CrontabFindOrCreate(
 	return
 }
 
+// DependencyFindOrCreate 创建来源是依赖触发的
+func (mr *MongoRepository) DependencyFindOrCreate(
+	fRR *aggregate.FlowRunRecord,
+) (created bool, err error) {
+	m := NewFromAggregate(fRR)
+	var old mongoFlowRunRecord
+
+	_, err = mr.mongoCollection.FindOneOrInsert(
+		mongodb.NewFilter().
+			AddEqual("flow_id", fRR.FlowID).
+			AddEqual("upstream_flow_run_record_id", fRR.UpstreamFlowRunRecordID),
+		*m,
+		&old)
+	if err != nil {
+		return
+	}
+	if old.IsZero() { // 老文档不存在，表示此次为新建
+		created = true
+	}
+	return
+}
+
 // Read
 func (mr *MongoRepository) get(
 	filter *mongodb.MongoFilter,
@@ -352,6 +386,74 @@ func (mr *MongoRepository) NotAllowedParallelRun(
 			AddSet("end_time", time.Now()))
 }
 
+func (mr *MongoRepository) ScheduleSkipped(
+	id value_object.UUID, reason string,
+) error {
+	return mr.mongoCollection.PatchByID(
+		id,
+		mongodb.NewUpdater().
+			AddSet("status", value_object.ScheduleSkipped).
+			AddSet("error_msg", reason).
+			AddSet("end_time", time.Now()))
+}
+
+func (mr *MongoRepository) InQueue(id value_object.UUID) error {
+	return mr.mongoCollection.PatchByID(
+		id,
+		mongodb.NewUpdater().AddSet("status", value_object.InQueue))
+}
+
+func (mr *MongoRepository) Dequeue(id value_object.UUID) (bool, error) {
+	patchedAmount, err := mr.mongoCollection.Patch(
+		mongodb.NewFilter().
+			AddEqual("id", id).
+			AddEqual("status", value_object.InQueue),
+		mongodb.NewUpdater().AddSet("status", value_object.Created))
+	if err != nil {
+		return false, err
+	}
+	return patchedAmount > 0, nil
+}
+
+func (mr *MongoRepository) WaitingApproval(id value_object.UUID) error {
+	nFRS := value_object.NotFinishedRunStatus()
+	notFinishedStatus := make([]interface{}, 0, len(nFRS))
+	for _, i := range nFRS {
+		notFinishedStatus = append(notFinishedStatus, i)
+	}
+	_, err := mr.mongoCollection.Patch(
+		mongodb.NewFilter().
+			AddEqual("id", id).
+			AddIn("status", notFinishedStatus),
+		mongodb.NewUpdater().AddSet("status", value_object.WaitingApproval))
+	return err
+}
+
+func (mr *MongoRepository) ApprovalResolved(id value_object.UUID) error {
+	_, err := mr.mongoCollection.Patch(
+		mongodb.NewFilter().
+			AddEqual("id", id).
+			AddEqual("status", value_object.WaitingApproval),
+		mongodb.NewUpdater().AddSet("status", value_object.Running))
+	return err
+}
+
+func (mr *MongoRepository) SaveFlowLockVersion(id value_object.UUID, version uint64) error {
+	return mr.mongoCollection.PatchByID(
+		id,
+		mongodb.NewUpdater().AddSet("flow_lock_version", version))
+}
+
+func (mr *MongoRepository) ReplacedCancel(id, byFlowRunRecordID value_object.UUID) error {
+	return mr.mongoCollection.PatchByID(
+		id,
+		mongodb.NewUpdater().
+			AddSet("status", value_object.ReplacedCancel).
+			AddSet("canceled", true).
+			AddSet("error_msg", "replaced by flow_run_record "+byFlowRunRecordID.String()).
+			AddSet("end_time", time.Now()))
+}
+
 func (mr *MongoRepository) Fail(id value_object.UUID, errorMsg string) error {
 	return mr.mongoCollection.PatchByID(
 		id,
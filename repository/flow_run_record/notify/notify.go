@@ -0,0 +1,152 @@
+// Package notify 包装FlowRunRecordRepository，状态变化持久化成功后发布运行状态变化事件
+package notify
+
+import (
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/repository/flow_run_record"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+func init() {
+	var _ flow_run_record.FlowRunRecordRepository = &Repository{}
+}
+
+type Repository struct {
+	flow_run_record.FlowRunRecordRepository
+}
+
+func New(repo flow_run_record.FlowRunRecordRepository) *Repository {
+	return &Repository{FlowRunRecordRepository: repo}
+}
+
+func newStatusChangedEvent(fRR *aggregate.FlowRunRecord) *event.RunStatusChanged {
+	errorMsg := fRR.ErrorMsg
+	if errorMsg == "" {
+		errorMsg = fRR.InterceptMsg
+	}
+	return &event.RunStatusChanged{
+		Kind:            event.FlowRunStatusChange,
+		FlowID:          fRR.FlowID,
+		FlowOriginID:    fRR.FlowOriginID,
+		FlowRunRecordID: fRR.ID,
+		Status:          fRR.Status,
+		ErrorMsg:        errorMsg,
+		Time:            time.Now(),
+	}
+}
+
+// pub 推送只是附带的通知，失败不影响状态的变更
+func (r *Repository) pub(fRR *aggregate.FlowRunRecord) {
+	if fRR.IsZero() {
+		return
+	}
+	_ = event.PubEvent(newStatusChangedEvent(fRR))
+}
+
+// pubByID 状态变更的方法只有id，需重新获取记录
+func (r *Repository) pubByID(id value_object.UUID, err error) error {
+	if err != nil {
+		return err
+	}
+	fRR, getErr := r.FlowRunRecordRepository.GetByID(id)
+	if getErr == nil {
+		r.pub(fRR)
+	}
+	return nil
+}
+
+func (r *Repository) Create(fRR *aggregate.FlowRunRecord) error {
+	err := r.FlowRunRecordRepository.Create(fRR)
+	if err != nil {
+		return err
+	}
+	r.pub(fRR)
+	return nil
+}
+
+func (r *Repository) CrontabFindOrCreate(
+	fRR *aggregate.FlowRunRecord, crontabTime time.Time,
+) (bool, error) {
+	created, err := r.FlowRunRecordRepository.CrontabFindOrCreate(fRR, crontabTime)
+	if err != nil || !created {
+		return created, err
+	}
+	r.pub(fRR)
+	return created, nil
+}
+
+func (r *Repository) DependencyFindOrCreate(fRR *aggregate.FlowRunRecord) (bool, error) {
+	created, err := r.FlowRunRecordRepository.DependencyFindOrCreate(fRR)
+	if err != nil || !created {
+		return created, err
+	}
+	r.pub(fRR)
+	return created, nil
+}
+
+func (r *Repository) Start(id value_object.UUID) error {
+	return r.pubByID(id, r.FlowRunRecordRepository.Start(id))
+}
+
+func (r *Repository) Suc(id value_object.UUID) error {
+	return r.pubByID(id, r.FlowRunRecordRepository.Suc(id))
+}
+
+func (r *Repository) Fail(id value_object.UUID, errorMsg string) error {
+	return r.pubByID(id, r.FlowRunRecordRepository.Fail(id, errorMsg))
+}
+
+func (r *Repository) Intercepted(id value_object.UUID, msg string) error {
+	return r.pubByID(id, r.FlowRunRecordRepository.Intercepted(id, msg))
+}
+
+func (r *Repository) TimeoutCancel(id value_object.UUID) error {
+	return r.pubByID(id, r.FlowRunRecordRepository.TimeoutCancel(id))
+}
+
+func (r *Repository) UserCancel(id, userID value_object.UUID) error {
+	return r.pubByID(id, r.FlowRunRecordRepository.UserCancel(id, userID))
+}
+
+func (r *Repository) NotAllowedParallelRun(id value_object.UUID) error {
+	return r.pubByID(id, r.FlowRunRecordRepository.NotAllowedParallelRun(id))
+}
+
+func (r *Repository) ScheduleSkipped(id value_object.UUID, reason string) error {
+	return r.pubByID(id, r.FlowRunRecordRepository.ScheduleSkipped(id, reason))
+}
+
+func (r *Repository) WaitingApproval(id value_object.UUID) error {
+	return r.pubByID(id, r.FlowRunRecordRepository.WaitingApproval(id))
+}
+
+func (r *Repository) ApprovalResolved(id value_object.UUID) error {
+	return r.pubByID(id, r.FlowRunRecordRepository.ApprovalResolved(id))
+}
+
+func (r *Repository) InQueue(id value_object.UUID) error {
+	return r.pubByID(id, r.FlowRunRecordRepository.InQueue(id))
+}
+
+func (r *Repository) Dequeue(id value_object.UUID) (bool, error) {
+	dequeued, err := r.FlowRunRecordRepository.Dequeue(id)
+	if err != nil || !dequeued {
+		return dequeued, err
+	}
+	return dequeued, r.pubByID(id, nil)
+}
+
+func (r *Repository) ReplacedCancel(id, byFlowRunRecordID value_object.UUID) error {
+	return r.pubByID(id, r.FlowRunRecordRepository.ReplacedCancel(id, byFlowRunRecordID))
+}
+
+func (r *Repository) FunctionDead(id value_object.UUID, msg string) error {
+	return r.pubByID(id, r.FlowRunRecordRepository.FunctionDead(id, msg))
+}
+
+func (r *Repository) PatchDataForRetry(id value_object.UUID, retriedAmount uint16) error {
+	return r.pubByID(id, r.FlowRunRecordRepository.PatchDataForRetry(id, retriedAmount))
+}
@@ -13,6 +13,8 @@ type FlowRunRecordRepository interface {
 	CrontabFindOrCreate(
 		fRR *aggregate.FlowRunRecord, crontabTime time.Time,
 	) (created bool, err error)
+	// DependencyFindOrCreate 同一上游运行记录对同一flow只会依赖触发一次
+	DependencyFindOrCreate(fRR *aggregate.FlowRunRecord) (created bool, err error)
 
 	// Read
 	GetByID(id value_object.UUID) (*aggregate.FlowRunRecord, error)
@@ -54,7 +56,20 @@ type FlowRunRecordRepository interface {
 	TimeoutCancel(id value_object.UUID) error
 	UserCancel(id, userID value_object.UUID) error
 	NotAllowedParallelRun(id value_object.UUID) error
+	// InQueue 不允许并行运行时排队等待正在运行的结束
+	InQueue(id value_object.UUID) error
+	// Dequeue 排队中的记录出队，返回false表示已不在排队中(被其他方出队了)
+	Dequeue(id value_object.UUID) (bool, error)
+	ReplacedCancel(id, byFlowRunRecordID value_object.UUID) error
+	// SaveFlowLockVersion 记录运行获取到的flow槽位锁的版本，运行中的状态变更以此校验是否仍持有锁
+	SaveFlowLockVersion(id value_object.UUID, version uint64) error
+	// ScheduleSkipped flow暂停或处于禁止运行时段而跳过运行
+	ScheduleSkipped(id value_object.UUID, reason string) error
 	FunctionDead(id value_object.UUID, msg string) error
+	// WaitingApproval 运行到人工审批节点等待审批，已结束的运行不受影响
+	WaitingApproval(id value_object.UUID) error
+	// ApprovalResolved 审批节点有了结果，等待审批中的运行恢复为运行中
+	ApprovalResolved(id value_object.UUID) error
 
 	// Delete
 }
@@ -0,0 +1,245 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/pkg/add_or_del"
+	"github.com/fBloc/bloc-server/repository/function"
+	"github.com/fBloc/bloc-server/value_object"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	var _ function.FunctionRepository = &MemoryRepository{}
+}
+
+type MemoryRepository struct {
+	functions []*aggregate.Function // 按插入顺序
+	sync.RWMutex
+}
+
+// Create a new in-memory repository
+func New() *MemoryRepository {
+	return &MemoryRepository{}
+}
+
+func copyFunction(f *aggregate.Function) *aggregate.Function {
+	if f == nil {
+		return nil
+	}
+	c := *f
+	return &c
+}
+
+func (mr *MemoryRepository) getLatest(match func(*aggregate.Function) bool) *aggregate.Function {
+	mr.RLock()
+	defer mr.RUnlock()
+	for i := len(mr.functions) - 1; i >= 0; i-- {
+		if match(mr.functions[i]) {
+			return copyFunction(mr.functions[i])
+		}
+	}
+	return &aggregate.Function{} // 同mongo实现，未找到时返回空值而非nil
+}
+
+func (mr *MemoryRepository) filter(match func(*aggregate.Function) bool) []*aggregate.Function {
+	mr.RLock()
+	defer mr.RUnlock()
+	ret := make([]*aggregate.Function, 0, len(mr.functions))
+	for _, f := range mr.functions {
+		if match(f) {
+			ret = append(ret, copyFunction(f))
+		}
+	}
+	return ret
+}
+
+// patch 修改时整体替换，避免已返回给调用方的数据被并发修改
+func (mr *MemoryRepository) patch(id value_object.UUID, modify func(*aggregate.Function)) error {
+	mr.Lock()
+	defer mr.Unlock()
+	for i, f := range mr.functions {
+		if f.ID == id {
+			c := copyFunction(f)
+			modify(c)
+			mr.functions[i] = c
+			return nil
+		}
+	}
+	return nil
+}
+
+func (mr *MemoryRepository) insert(f *aggregate.Function) {
+	c := copyFunction(f)
+	c.ExeFunc = nil
+	if c.RegisterTime.IsZero() {
+		c.RegisterTime = time.Now()
+	}
+	if c.ReadUserIDs == nil {
+		c.ReadUserIDs = []value_object.UUID{}
+	}
+	if c.ExecuteUserIDs == nil {
+		c.ExecuteUserIDs = []value_object.UUID{}
+	}
+	if c.AssignPermissionUserIDs == nil {
+		c.AssignPermissionUserIDs = []value_object.UUID{}
+	}
+	mr.functions = append(mr.functions, c)
+}
+
+func (mr *MemoryRepository) FindOrCreate(
+	f *aggregate.Function,
+) (*aggregate.Function, error) {
+	mr.Lock()
+	defer mr.Unlock()
+	for _, old := range mr.functions {
+		if old.IptDigest == f.IptDigest && old.OptDigest == f.OptDigest {
+			return copyFunction(old), nil
+		}
+	}
+	mr.insert(f)
+	return nil, nil
+}
+
+func (mr *MemoryRepository) Create(f *aggregate.Function) error {
+	mr.Lock()
+	defer mr.Unlock()
+	mr.insert(f)
+	return nil
+}
+
+func (mr *MemoryRepository) All(withoutFields []string) ([]*aggregate.Function, error) {
+	return mr.filter(func(*aggregate.Function) bool { return true }), nil
+}
+
+func (mr *MemoryRepository) UserReadAbleAll(
+	user *aggregate.User, withoutFields []string,
+) ([]*aggregate.Function, error) {
+	if user.IsZero() {
+		return nil, errors.New("ipt user is nil")
+	}
+	return mr.filter(func(f *aggregate.Function) bool {
+		for _, uID := range f.ReadUserIDs {
+			if uID == user.ID {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (mr *MemoryRepository) IDMapFunctionAll() (map[value_object.UUID]*aggregate.Function, error) {
+	all := mr.filter(func(*aggregate.Function) bool { return true })
+	ret := make(map[value_object.UUID]*aggregate.Function, len(all))
+	for _, f := range all {
+		ret[f.ID] = f
+	}
+	return ret, nil
+}
+
+func (mr *MemoryRepository) GetByIDForCheckAliveTime(
+	id value_object.UUID,
+) (*aggregate.Function, error) {
+	return mr.GetByID(id)
+}
+
+func (mr *MemoryRepository) GetByID(id value_object.UUID) (*aggregate.Function, error) {
+	return mr.getLatest(func(f *aggregate.Function) bool { return f.ID == id }), nil
+}
+
+func (mr *MemoryRepository) GetSameIptOptFunction(
+	iptDigest, optDigest string,
+) (*aggregate.Function, error) {
+	return mr.getLatest(func(f *aggregate.Function) bool {
+		return f.IptDigest == iptDigest && f.OptDigest == optDigest
+	}), nil
+}
+
+func (mr *MemoryRepository) PatchProgressMilestones(
+	id value_object.UUID, progressMilestones []string,
+) error {
+	return mr.patch(id, func(f *aggregate.Function) { f.ProgressMilestones = progressMilestones })
+}
+
+func (mr *MemoryRepository) PatchName(id value_object.UUID, name string) error {
+	return mr.patch(id, func(f *aggregate.Function) { f.Name = name })
+}
+
+func (mr *MemoryRepository) PatchDescription(id value_object.UUID, desc string) error {
+	return mr.patch(id, func(f *aggregate.Function) { f.Description = desc })
+}
+
+func (mr *MemoryRepository) PatchGroupName(id value_object.UUID, groupName string) error {
+	return mr.patch(id, func(f *aggregate.Function) { f.GroupName = groupName })
+}
+
+func (mr *MemoryRepository) PatchProviderName(id value_object.UUID, providerName string) error {
+	return mr.patch(id, func(f *aggregate.Function) { f.ProviderName = providerName })
+}
+
+func (mr *MemoryRepository) AliveReport(id value_object.UUID) error {
+	return mr.patch(id, func(f *aggregate.Function) { f.LastAliveTime = time.Now() })
+}
+
+// pushOrPull 同mongo的$push/$pull，总是返回新的slice
+func pushOrPull(
+	userIDs []value_object.UUID, userID value_object.UUID, aod add_or_del.AddOrDel,
+) []value_object.UUID {
+	ret := make([]value_object.UUID, 0, len(userIDs)+1)
+	for _, i := range userIDs {
+		if aod == add_or_del.Remove && i == userID {
+			continue
+		}
+		ret = append(ret, i)
+	}
+	if aod != add_or_del.Remove {
+		ret = append(ret, userID)
+	}
+	return ret
+}
+
+func (mr *MemoryRepository) userOperation(
+	id, userID value_object.UUID, permType value_object.PermissionType, aod add_or_del.AddOrDel,
+) error {
+	switch permType {
+	case value_object.Read:
+		return mr.patch(id, func(f *aggregate.Function) {
+			f.ReadUserIDs = pushOrPull(f.ReadUserIDs, userID, aod)
+		})
+	case value_object.Execute:
+		return mr.patch(id, func(f *aggregate.Function) {
+			f.ExecuteUserIDs = pushOrPull(f.ExecuteUserIDs, userID, aod)
+		})
+	case value_object.AssignPermission:
+		return mr.patch(id, func(f *aggregate.Function) {
+			f.AssignPermissionUserIDs = pushOrPull(f.AssignPermissionUserIDs, userID, aod)
+		})
+	}
+	return errors.New("permission type wrong")
+}
+
+func (mr *MemoryRepository) AddReader(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.Read, add_or_del.Add)
+}
+func (mr *MemoryRepository) RemoveReader(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.Read, add_or_del.Remove)
+}
+
+func (mr *MemoryRepository) AddExecuter(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.Execute, add_or_del.Add)
+}
+
+func (mr *MemoryRepository) RemoveExecuter(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.Execute, add_or_del.Remove)
+}
+
+func (mr *MemoryRepository) AddAssigner(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.AssignPermission, add_or_del.Add)
+}
+
+func (mr *MemoryRepository) RemoveAssigner(id, userID value_object.UUID) error {
+	return mr.userOperation(id, userID, value_object.AssignPermission, add_or_del.Remove)
+}
@@ -0,0 +1,89 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/repository/function_execute_heartbeat"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+func init() {
+	var _ function_execute_heartbeat.FunctionExecuteHeartbeatRepository = &MemoryRepository{}
+}
+
+type MemoryRepository struct {
+	funcRunRecordIDMapHeartBeat map[value_object.UUID]*aggregate.FunctionExecuteHeartBeat
+	sync.Mutex
+}
+
+// Create a new in-memory repository
+func New() *MemoryRepository {
+	return &MemoryRepository{
+		funcRunRecordIDMapHeartBeat: make(map[value_object.UUID]*aggregate.FunctionExecuteHeartBeat),
+	}
+}
+
+func (mr *MemoryRepository) Create(f *aggregate.FunctionExecuteHeartBeat) error {
+	mr.Lock()
+	defer mr.Unlock()
+	mr.funcRunRecordIDMapHeartBeat[f.FunctionRunRecordID] = &aggregate.FunctionExecuteHeartBeat{
+		FunctionRunRecordID: f.FunctionRunRecordID,
+		LatestHeartbeatTime: time.Now(),
+	}
+	return nil
+}
+
+func (mr *MemoryRepository) GetByFunctionRunRecordID(
+	funcRunRecordID value_object.UUID,
+) (*aggregate.FunctionExecuteHeartBeat, error) {
+	mr.Lock()
+	defer mr.Unlock()
+	hB, ok := mr.funcRunRecordIDMapHeartBeat[funcRunRecordID]
+	if !ok {
+		return &aggregate.FunctionExecuteHeartBeat{}, nil
+	}
+	c := *hB
+	return &c, nil
+}
+
+func (mr *MemoryRepository) AllDeads(
+	timeoutThreshold time.Duration,
+) ([]*aggregate.FunctionExecuteHeartBeat, error) {
+	mr.Lock()
+	defer mr.Unlock()
+	deadline := time.Now().Add(-timeoutThreshold)
+	ret := make([]*aggregate.FunctionExecuteHeartBeat, 0)
+	for _, hB := range mr.funcRunRecordIDMapHeartBeat {
+		if hB.LatestHeartbeatTime.Before(deadline) {
+			c := *hB
+			ret = append(ret, &c)
+		}
+	}
+	return ret, nil
+}
+
+func (mr *MemoryRepository) AliveReportByFuncRunRecordID(
+	funcRunRecordID value_object.UUID,
+) error {
+	mr.Lock()
+	defer mr.Unlock()
+	mr.funcRunRecordIDMapHeartBeat[funcRunRecordID] = &aggregate.FunctionExecuteHeartBeat{
+		FunctionRunRecordID: funcRunRecordID,
+		LatestHeartbeatTime: time.Now(),
+	}
+	return nil
+}
+
+func (mr *MemoryRepository) DeleteByFunctionRunRecordID(
+	functionRunRecordID value_object.UUID,
+) (int64, error) {
+	mr.Lock()
+	defer mr.Unlock()
+	if _, ok := mr.funcRunRecordIDMapHeartBeat[functionRunRecordID]; !ok {
+		return 0, nil
+	}
+	delete(mr.funcRunRecordIDMapHeartBeat, functionRunRecordID)
+	return 1, nil
+}
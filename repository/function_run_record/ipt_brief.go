@@ -0,0 +1,47 @@
+package function_run_record
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/infrastructure/object_storage"
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+// BuildIptBriefAndObskey 将ipt的完整值保存到对象存储，并返回用于展示的截断值及对象存储的key
+func BuildIptBriefAndObskey(
+	id value_object.UUID,
+	iptConfig ipt.IptSlice,
+	ipts [][]interface{},
+	objectStorageImplement object_storage.ObjectStorage,
+) ([][]aggregate.IptBriefAndKey, error) {
+	iptBAOk := make([][]aggregate.IptBriefAndKey, len(ipts))
+	for paramIndex, param := range ipts {
+		iptBAOk[paramIndex] = make([]aggregate.IptBriefAndKey, 0, len(param))
+		for componentIndex, componentVal := range param {
+			uploadByte, _ := json.Marshal(componentVal)
+			byteInrune := []rune(string(uploadByte))
+			if string(byteInrune[len(byteInrune)-1]) == "\"" {
+				byteInrune = byteInrune[:len(byteInrune)-1]
+			}
+			minLength := 51
+			if len(byteInrune) < minLength {
+				minLength = len(byteInrune)
+			}
+
+			key := fmt.Sprintf("%s_%d_%d", id, paramIndex, componentIndex)
+			iptBAOk[paramIndex] = append(iptBAOk[paramIndex], aggregate.IptBriefAndKey{
+				IsArray:   iptConfig[paramIndex].Components[componentIndex].AllowMulti,
+				ValueType: iptConfig[paramIndex].Components[componentIndex].ValueType,
+				Brief:     string(byteInrune[:minLength]),
+				FullKey:   key})
+			err := objectStorageImplement.Set(key, uploadByte)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return iptBAOk, nil
+}
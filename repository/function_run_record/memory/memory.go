@@ -0,0 +1,365 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/infrastructure/object_storage"
+	"github.com/fBloc/bloc-server/internal/memory_filter"
+	"github.com/fBloc/bloc-server/pkg/ipt"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+	"github.com/fBloc/bloc-server/repository/function_run_record"
+	mongo_funcRunRecord "github.com/fBloc/bloc-server/repository/function_run_record/mongo"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+func init() {
+	var _ function_run_record.FunctionRunRecordRepository = &MemoryRepository{}
+}
+
+type MemoryRepository struct {
+	records []*aggregate.FunctionRunRecord // 按插入顺序
+	sync.RWMutex
+}
+
+// Create a new in-memory repository
+func New() *MemoryRepository {
+	return &MemoryRepository{}
+}
+
+func copyRecord(fRR *aggregate.FunctionRunRecord) *aggregate.FunctionRunRecord {
+	if fRR == nil {
+		return nil
+	}
+	c := *fRR
+	return &c
+}
+
+// toDocument 通用过滤条件中的key为持久化字段名，故转为与mongo一致的文档后再做匹配
+func toDocument(fRR *aggregate.FunctionRunRecord) memory_filter.Document {
+	doc, err := memory_filter.ToDocument(mongo_funcRunRecord.NewFromAggregate(fRR))
+	if err != nil {
+		return memory_filter.Document{}
+	}
+	return doc
+}
+
+func (mr *MemoryRepository) getByID(id value_object.UUID) *aggregate.FunctionRunRecord {
+	mr.RLock()
+	defer mr.RUnlock()
+	for i := len(mr.records) - 1; i >= 0; i-- {
+		if mr.records[i].ID == id {
+			return copyRecord(mr.records[i])
+		}
+	}
+	return &aggregate.FunctionRunRecord{} // 同mongo实现，未找到时返回空值而非nil
+}
+
+// patch 修改时整体替换，避免已返回给调用方的数据被并发修改
+func (mr *MemoryRepository) patch(id value_object.UUID, modify func(*aggregate.FunctionRunRecord)) error {
+	mr.Lock()
+	defer mr.Unlock()
+	for i, fRR := range mr.records {
+		if fRR.ID == id {
+			c := copyRecord(fRR)
+			modify(c)
+			mr.records[i] = c
+			return nil
+		}
+	}
+	return nil
+}
+
+func (mr *MemoryRepository) Create(fRR *aggregate.FunctionRunRecord) error {
+	c := copyRecord(fRR)
+	c.Ipts = nil // 同mongo实现，实际值不做持久化
+	if c.ProgressMsg == nil {
+		c.ProgressMsg = []string{}
+	}
+
+	mr.Lock()
+	defer mr.Unlock()
+	mr.records = append(mr.records, c)
+	return nil
+}
+
+func (mr *MemoryRepository) GetOnlyProgressInfoByID(
+	id value_object.UUID,
+) (*aggregate.FunctionRunRecord, error) {
+	fRR := mr.getByID(id)
+	if fRR.IsZero() {
+		return fRR, nil
+	}
+	return &aggregate.FunctionRunRecord{
+		ID:                     fRR.ID,
+		End:                    fRR.End,
+		Progress:               fRR.Progress,
+		ProgressMsg:            fRR.ProgressMsg,
+		ProgressMilestones:     fRR.ProgressMilestones,
+		ProgressMilestoneIndex: fRR.ProgressMilestoneIndex,
+	}, nil
+}
+
+func (mr *MemoryRepository) GetByID(id value_object.UUID) (*aggregate.FunctionRunRecord, error) {
+	return mr.getByID(id), nil
+}
+
+func (mr *MemoryRepository) filter(
+	filter value_object.RepositoryFilter,
+) []*aggregate.FunctionRunRecord {
+	mr.RLock()
+	defer mr.RUnlock()
+	matched := make([]*aggregate.FunctionRunRecord, 0)
+	for _, fRR := range mr.records {
+		if toDocument(fRR).Match(filter) {
+			matched = append(matched, fRR)
+		}
+	}
+	return matched
+}
+
+func (mr *MemoryRepository) Filter(
+	filter value_object.RepositoryFilter,
+	filterOption value_object.RepositoryFilterOption,
+) ([]*aggregate.FunctionRunRecord, error) {
+	matched := mr.filter(filter)
+	indexes := memory_filter.PageIndexes(len(matched), filterOption)
+	resp := make([]*aggregate.FunctionRunRecord, 0, len(indexes))
+	for _, i := range indexes {
+		resp = append(resp, copyRecord(matched[i]))
+	}
+	return resp, nil
+}
+
+func (mr *MemoryRepository) Count(filter value_object.RepositoryFilter) (int64, error) {
+	return int64(len(mr.filter(filter))), nil
+}
+
+func (mr *MemoryRepository) FilterByFlowRunRecordID(
+	flowRunRecordID value_object.UUID,
+) ([]*aggregate.FunctionRunRecord, error) {
+	return mr.Filter(
+		*value_object.NewRepositoryFilter().AddEqual("flow_run_record_id", flowRunRecordID),
+		value_object.RepositoryFilterOption{})
+}
+
+func (mr *MemoryRepository) FilterDeadlineExceeded(
+	now time.Time,
+) ([]*aggregate.FunctionRunRecord, error) {
+	mr.RLock()
+	defer mr.RUnlock()
+	resp := make([]*aggregate.FunctionRunRecord, 0)
+	for _, fRR := range mr.records {
+		if fRR.DeadlineExceeded(now) && !fRR.TimeoutCanceled {
+			resp = append(resp, copyRecord(fRR))
+		}
+	}
+	return resp, nil
+}
+
+func (mr *MemoryRepository) FilterByMapParentID(
+	mapParentID value_object.UUID,
+) ([]*aggregate.FunctionRunRecord, error) {
+	return mr.Filter(
+		*value_object.NewRepositoryFilter().AddEqual("map_parent_id", mapParentID),
+		value_object.RepositoryFilterOption{Asc: true})
+}
+
+func (mr *MemoryRepository) PatchProgress(id value_object.UUID, progress float32) error {
+	return mr.patch(id, func(fRR *aggregate.FunctionRunRecord) { fRR.Progress = progress })
+}
+
+func (mr *MemoryRepository) PatchProgressMsg(id value_object.UUID, progressMsg string) error {
+	return mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		msgs := make([]string, 0, len(fRR.ProgressMsg)+1)
+		msgs = append(msgs, fRR.ProgressMsg...)
+		fRR.ProgressMsg = append(msgs, progressMsg)
+	})
+}
+
+func (mr *MemoryRepository) PatchMilestoneIndex(id value_object.UUID, ProgressMilestoneIndex *int) error {
+	return mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		fRR.ProgressMilestoneIndex = ProgressMilestoneIndex
+	})
+}
+
+func (mr *MemoryRepository) SetTimeout(id value_object.UUID, timeoutTime time.Time) error {
+	return mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		fRR.ShouldBeCanceledAt = timeoutTime
+		fRR.TimeoutCanceled = false
+	})
+}
+
+func (mr *MemoryRepository) SaveIptBrief(
+	id value_object.UUID,
+	iptConfig ipt.IptSlice,
+	ipts [][]interface{},
+	objectStorageImplement object_storage.ObjectStorage,
+) error {
+	iptBAOk, err := function_run_record.BuildIptBriefAndObskey(
+		id, iptConfig, ipts, objectStorageImplement)
+	if err != nil {
+		return err
+	}
+	return mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		fRR.IptBriefAndObskey = iptBAOk
+	})
+}
+
+// ClearProgress 清空进度相关的字段
+func (mr *MemoryRepository) ClearProgress(id value_object.UUID) error {
+	return mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		fRR.Start = time.Time{}
+		fRR.Progress = 0
+		fRR.ProgressMsg = []string{}
+		fRR.ProgressMilestoneIndex = nil
+	})
+}
+
+func (mr *MemoryRepository) SaveSuc(
+	id value_object.UUID, desc string,
+	keyMapValueType map[string]value_type.ValueType,
+	keyMapValueIsArray map[string]bool,
+	keyMapObjectStorageKey, keyMapBriefData map[string]string,
+	intercepted bool,
+) error {
+	opt := make(map[string]interface{}, len(keyMapObjectStorageKey))
+	for k, v := range keyMapObjectStorageKey {
+		opt[k] = v
+	}
+	return mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		fRR.End = time.Now()
+		fRR.Suc = true
+		fRR.InterceptBelowFunctionRun = intercepted
+		fRR.OptKeyMapValueType = keyMapValueType
+		fRR.OptKeyMapIsArray = keyMapValueIsArray
+		fRR.Opt = opt
+		fRR.OptBrief = keyMapBriefData
+		fRR.Description = desc
+	})
+}
+
+func (mr *MemoryRepository) SaveFail(id value_object.UUID, errMsg string) error {
+	return mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		fRR.End = time.Now()
+		fRR.ErrorMsg = errMsg
+	})
+}
+
+func (mr *MemoryRepository) SaveFailIfNotFinished(
+	id value_object.UUID, errMsg string,
+) (bool, error) {
+	failed := false
+	err := mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		if fRR.Finished() {
+			return
+		}
+		fRR.End = time.Now()
+		fRR.ErrorMsg = errMsg
+		failed = true
+	})
+	return failed, err
+}
+
+func (mr *MemoryRepository) AddMapFinishedIndex(
+	id value_object.UUID, index int,
+) (int, bool, error) {
+	finishedAmount, added := 0, false
+	err := mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		if fRR.Finished() {
+			return
+		}
+		for _, i := range fRR.MapFinishedIndexes {
+			if i == index {
+				return
+			}
+		}
+		fRR.MapFinishedIndexes = append(append([]int{}, fRR.MapFinishedIndexes...), index)
+		finishedAmount, added = len(fRR.MapFinishedIndexes), true
+	})
+	return finishedAmount, added, err
+}
+
+func (mr *MemoryRepository) SaveStart(id value_object.UUID) error {
+	return mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		fRR.Start = time.Now()
+		fRR.TimeoutCanceled = false
+	})
+}
+
+func (mr *MemoryRepository) SaveSkippedDownstreams(
+	id value_object.UUID, flowFunctionIDs []string,
+) error {
+	ids := make([]string, len(flowFunctionIDs))
+	copy(ids, flowFunctionIDs)
+	return mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		fRR.SkippedDownstreamFlowFunctionIDs = ids
+	})
+}
+
+func (mr *MemoryRepository) SaveCancel(id value_object.UUID) error {
+	return mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		fRR.End = time.Now()
+		fRR.Canceled = true
+	})
+}
+
+func (mr *MemoryRepository) SaveTimeoutCancel(id value_object.UUID) (bool, error) {
+	marked := false
+	err := mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		if fRR.TimeoutCanceled {
+			return
+		}
+		fRR.TimeoutCanceled = true
+		marked = true
+	})
+	return marked, err
+}
+
+func (mr *MemoryRepository) SaveWaitingApproval(id value_object.UUID) error {
+	return mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		fRR.Start = time.Now()
+		fRR.TimeoutCanceled = false
+		fRR.WaitingApproval = true
+	})
+}
+
+func (mr *MemoryRepository) SaveApprovalDecision(
+	id, userID value_object.UUID,
+) (bool, error) {
+	saved := false
+	err := mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		if !fRR.IsWaitingApproval() {
+			return
+		}
+		fRR.WaitingApproval = false
+		fRR.ApprovalUserID = userID
+		fRR.ShouldBeCanceledAt = time.Time{}
+		saved = true
+	})
+	return saved, err
+}
+
+func (mr *MemoryRepository) AddAttempt(
+	id value_object.UUID, attempt aggregate.FunctionRunAttempt,
+) error {
+	return mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		fRR.Attempts = append(append([]aggregate.FunctionRunAttempt{}, fRR.Attempts...), attempt)
+	})
+}
+
+func (mr *MemoryRepository) SaveRetry(
+	id value_object.UUID, failedAttempt aggregate.FunctionRunAttempt,
+) error {
+	return mr.patch(id, func(fRR *aggregate.FunctionRunRecord) {
+		fRR.Attempts = append(append([]aggregate.FunctionRunAttempt{}, fRR.Attempts...), failedAttempt)
+		fRR.Start = time.Time{}
+		fRR.End = time.Time{}
+		fRR.Suc = false
+		fRR.ErrorMsg = failedAttempt.ErrorMsg
+		fRR.Progress = 0
+		fRR.ProgressMsg = []string{}
+		fRR.ProgressMilestoneIndex = nil
+	})
+}
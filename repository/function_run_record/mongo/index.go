@@ -57,5 +57,20 @@ func mongoDBIndexes() []mongo.IndexModel {
 				Sparse: &truePoint,
 			},
 		},
+		{
+			Keys: bson.M{
+				"map_parent_id": "hashed",
+			},
+			Options: &options.IndexOptions{
+				Sparse: &truePoint,
+			},
+		},
+		{
+			// 超时检查按截止时间扫描还未结束的记录
+			Keys: bson.D{
+				{Key: "sb_canceled_at", Value: 1},
+				{Key: "end", Value: 1},
+			},
+		},
 	}
 }
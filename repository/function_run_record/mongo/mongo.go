@@ -2,8 +2,7 @@ package mongo
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"sort"
 	"time"
 
 	"github.com/fBloc/bloc-server/aggregate"
@@ -65,6 +64,7 @@ type mongoFunctionRunRecord struct {
 	Suc                       bool                            `bson:"suc"`
 	InterceptBelowFunctionRun bool                            `bson:"intercept_below_function_run"`
 	Canceled                  bool                            `bson:"canceled,omitempty"`
+	TimeoutCanceled           bool                            `bson:"timeout_canceled,omitempty"`
 	Description               string                          `bson:"description,omitempty"`
 	ErrorMsg                  string                          `bson:"error_msg,omitempty"`
 	IptBriefAndObskey         [][]mongoIptBriefAndKey         `bson:"ipt,omitempty"`
@@ -79,6 +79,42 @@ type mongoFunctionRunRecord struct {
 	FunctionProviderName      string                          `bson:"provider_name"`
 	ShouldBeCanceledAt        time.Time                       `bson:"sb_canceled_at"`
 	TraceID                   string                          `bson:"trace_id"`
+
+	SkippedDownstreamFlowFunctionIDs []string           `bson:"skipped_downstream_flowfunction_ids,omitempty"`
+	MapParentID                      *value_object.UUID `bson:"map_parent_id,omitempty"`
+	MapIndex                         int                `bson:"map_index,omitempty"`
+	MapFinishedIndexes               []int              `bson:"map_finished_indexes,omitempty"`
+	Attempts                         []mongoAttempt     `bson:"attempts,omitempty"`
+	WaitingApproval                  bool               `bson:"waiting_approval,omitempty"`
+	ApprovalUserID                   value_object.UUID  `bson:"approval_user_id"`
+}
+
+type mongoAttempt struct {
+	Start     time.Time `bson:"start"`
+	End       time.Time `bson:"end"`
+	Suc       bool      `bson:"suc"`
+	ErrorMsg  string    `bson:"error_msg,omitempty"`
+	Retryable bool      `bson:"retryable,omitempty"`
+}
+
+func newMongoAttempt(attempt aggregate.FunctionRunAttempt) mongoAttempt {
+	return mongoAttempt{
+		Start:     attempt.Start,
+		End:       attempt.End,
+		Suc:       attempt.Suc,
+		ErrorMsg:  attempt.ErrorMsg,
+		Retryable: attempt.Retryable,
+	}
+}
+
+func (m mongoAttempt) toAggregate() aggregate.FunctionRunAttempt {
+	return aggregate.FunctionRunAttempt{
+		Start:     m.Start,
+		End:       m.End,
+		Suc:       m.Suc,
+		ErrorMsg:  m.ErrorMsg,
+		Retryable: m.Retryable,
+	}
 }
 
 func NewFromAggregate(fRR *aggregate.FunctionRunRecord) *mongoFunctionRunRecord {
@@ -96,6 +132,7 @@ func NewFromAggregate(fRR *aggregate.FunctionRunRecord) *mongoFunctionRunRecord
 		Suc:                       fRR.Suc,
 		InterceptBelowFunctionRun: fRR.InterceptBelowFunctionRun,
 		Canceled:                  fRR.Canceled,
+		TimeoutCanceled:           fRR.TimeoutCanceled,
 		Description:               fRR.Description,
 		ErrorMsg:                  fRR.ErrorMsg,
 		Opt:                       fRR.Opt,
@@ -108,6 +145,19 @@ func NewFromAggregate(fRR *aggregate.FunctionRunRecord) *mongoFunctionRunRecord
 		FunctionProviderName:      fRR.FunctionProviderName,
 		ShouldBeCanceledAt:        fRR.ShouldBeCanceledAt,
 		TraceID:                   fRR.TraceID,
+
+		SkippedDownstreamFlowFunctionIDs: fRR.SkippedDownstreamFlowFunctionIDs,
+		MapIndex:                         fRR.MapIndex,
+		MapFinishedIndexes:               fRR.MapFinishedIndexes,
+		WaitingApproval:                  fRR.WaitingApproval,
+		ApprovalUserID:                   fRR.ApprovalUserID,
+	}
+	if fRR.IsMapChild() { // 非子记录不存此字段，以便于过滤出非子记录
+		mapParentID := fRR.MapParentID
+		ret.MapParentID = &mapParentID
+	}
+	for _, attempt := range fRR.Attempts {
+		ret.Attempts = append(ret.Attempts, newMongoAttempt(attempt))
 	}
 	if fRR.ProgressMsg == nil {
 		// mongo's $push not support push to nil! so this must be initial as []string{}
@@ -143,6 +193,7 @@ func (m mongoFunctionRunRecord) ToAggregate() *aggregate.FunctionRunRecord {
 		Suc:                       m.Suc,
 		InterceptBelowFunctionRun: m.InterceptBelowFunctionRun,
 		Canceled:                  m.Canceled,
+		TimeoutCanceled:           m.TimeoutCanceled,
 		Description:               m.Description,
 		ErrorMsg:                  m.ErrorMsg,
 		Opt:                       m.Opt,
@@ -156,6 +207,18 @@ func (m mongoFunctionRunRecord) ToAggregate() *aggregate.FunctionRunRecord {
 		FunctionProviderName:      m.FunctionProviderName,
 		ShouldBeCanceledAt:        m.ShouldBeCanceledAt,
 		TraceID:                   m.TraceID,
+
+		SkippedDownstreamFlowFunctionIDs: m.SkippedDownstreamFlowFunctionIDs,
+		MapIndex:                         m.MapIndex,
+		MapFinishedIndexes:               m.MapFinishedIndexes,
+		WaitingApproval:                  m.WaitingApproval,
+		ApprovalUserID:                   m.ApprovalUserID,
+	}
+	if m.MapParentID != nil {
+		resp.MapParentID = *m.MapParentID
+	}
+	for _, attempt := range m.Attempts {
+		resp.Attempts = append(resp.Attempts, attempt.toAggregate())
 	}
 	resp.IptBriefAndObskey = make([][]aggregate.IptBriefAndKey, len(m.IptBriefAndObskey))
 	for i, param := range m.IptBriefAndObskey {
@@ -257,6 +320,52 @@ func (mr *MongoRepository) FilterByFlowRunRecordID(
 	return resp, nil
 }
 
+func (mr *MongoRepository) FilterDeadlineExceeded(
+	now time.Time,
+) ([]*aggregate.FunctionRunRecord, error) {
+	var mRRRs []mongoFunctionRunRecord
+	err := mr.mongoCollection.Filter(
+		mongodb.NewFilter().
+			AddGtAndLt("sb_canceled_at", time.Time{}, now). // 排除未设置截止时间的
+			AddIn("end", []interface{}{nil, time.Time{}}).
+			AddNotEqual("timeout_canceled", true),
+		&filter_options.FilterOption{}, &mRRRs)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]*aggregate.FunctionRunRecord, 0, len(mRRRs))
+	for _, i := range mRRRs {
+		aggFRR := i.ToAggregate()
+		if !aggFRR.DeadlineExceeded(now) {
+			continue
+		}
+		resp = append(resp, aggFRR)
+	}
+
+	return resp, nil
+}
+
+func (mr *MongoRepository) FilterByMapParentID(
+	mapParentID value_object.UUID,
+) ([]*aggregate.FunctionRunRecord, error) {
+	var mRRRs []mongoFunctionRunRecord
+	err := mr.mongoCollection.Filter(
+		mongodb.NewFilter().AddEqual("map_parent_id", mapParentID),
+		&filter_options.FilterOption{}, &mRRRs)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(mRRRs, func(i, j int) bool { return mRRRs[i].MapIndex < mRRRs[j].MapIndex })
+	resp := make([]*aggregate.FunctionRunRecord, 0, len(mRRRs))
+	for _, i := range mRRRs {
+		resp = append(resp, i.ToAggregate())
+	}
+
+	return resp, nil
+}
+
 // Update
 func (mr *MongoRepository) PatchProgress(id value_object.UUID, progress float32) error {
 	return mr.mongoCollection.PatchByID(
@@ -280,7 +389,8 @@ func (mr *MongoRepository) SetTimeout(
 	return mr.mongoCollection.PatchByID(
 		id,
 		mongodb.NewUpdater().
-			AddSet("sb_canceled_at", timeoutTime))
+			AddSet("sb_canceled_at", timeoutTime).
+			AddSet("timeout_canceled", false))
 }
 
 func (mr *MongoRepository) SaveIptBrief(
@@ -289,29 +399,21 @@ func (mr *MongoRepository) SaveIptBrief(
 	ipts [][]interface{},
 	objectStorageImplement object_storage.ObjectStorage,
 ) error {
-	iptBAOk := make([][]mongoIptBriefAndKey, len(ipts))
-	for paramIndex, param := range ipts {
-		iptBAOk[paramIndex] = make([]mongoIptBriefAndKey, 0, len(param))
-		for componentIndex, componentVal := range param {
-			uploadByte, _ := json.Marshal(componentVal)
-			byteInrune := []rune(string(uploadByte))
-			if string(byteInrune[len(byteInrune)-1]) == "\"" {
-				byteInrune = byteInrune[:len(byteInrune)-1]
-			}
-			minLength := 51
-			if len(byteInrune) < minLength {
-				minLength = len(byteInrune)
-			}
+	aggIptBAOk, err := function_run_record.BuildIptBriefAndObskey(
+		id, iptConfig, ipts, objectStorageImplement)
+	if err != nil {
+		return err
+	}
 
-			key := fmt.Sprintf("%s_%d_%d", id, paramIndex, componentIndex)
-			iptBAOk[paramIndex] = append(iptBAOk[paramIndex], mongoIptBriefAndKey{
-				IsArray:   iptConfig[paramIndex].Components[componentIndex].AllowMulti,
-				ValueType: iptConfig[paramIndex].Components[componentIndex].ValueType,
-				Brief:     string(byteInrune[:minLength]),
-				FullKey:   key})
-			err := objectStorageImplement.Set(key, uploadByte)
-			if err != nil {
-				return err
+	iptBAOk := make([][]mongoIptBriefAndKey, len(aggIptBAOk))
+	for paramIndex, param := range aggIptBAOk {
+		iptBAOk[paramIndex] = make([]mongoIptBriefAndKey, len(param))
+		for componentIndex, component := range param {
+			iptBAOk[paramIndex][componentIndex] = mongoIptBriefAndKey{
+				IsArray:   component.IsArray,
+				ValueType: component.ValueType,
+				Brief:     component.Brief,
+				FullKey:   component.FullKey,
 			}
 		}
 	}
@@ -362,15 +464,59 @@ func (mr *MongoRepository) SaveFail(
 			AddSet("error_msg", errMsg))
 }
 
+func (mr *MongoRepository) SaveFailIfNotFinished(
+	id value_object.UUID, errMsg string,
+) (bool, error) {
+	patchedAmount, err := mr.mongoCollection.Patch(
+		mongodb.NewFilter().
+			AddEqual("id", id).
+			AddIn("end", []interface{}{nil, time.Time{}}),
+		mongodb.NewUpdater().
+			AddSet("end", time.Now()).
+			AddSet("error_msg", errMsg))
+	if err != nil {
+		return false, err
+	}
+	return patchedAmount > 0, nil
+}
+
+func (mr *MongoRepository) AddMapFinishedIndex(
+	id value_object.UUID, index int,
+) (int, bool, error) {
+	var mFRR mongoFunctionRunRecord
+	matched, err := mr.mongoCollection.FindOneAndUpdate(
+		mongodb.NewFilter().
+			AddEqual("id", id).
+			AddNotEqual("map_finished_indexes", index).
+			AddIn("end", []interface{}{nil, time.Time{}}),
+		mongodb.NewUpdater().AddPush("map_finished_indexes", index),
+		&mFRR)
+	if err != nil || !matched {
+		return 0, false, err
+	}
+	return len(mFRR.MapFinishedIndexes), true, nil
+}
+
 func (mr *MongoRepository) SaveStart(
 	id value_object.UUID,
 ) error {
 	return mr.mongoCollection.PatchByID(
 		id,
-		mongodb.NewUpdater().AddSet("start", time.Now()),
+		mongodb.NewUpdater().
+			AddSet("start", time.Now()).
+			AddSet("timeout_canceled", false),
 	)
 }
 
+func (mr *MongoRepository) SaveSkippedDownstreams(
+	id value_object.UUID, flowFunctionIDs []string,
+) error {
+	return mr.mongoCollection.PatchByID(
+		id,
+		mongodb.NewUpdater().
+			AddSet("skipped_downstream_flowfunction_ids", flowFunctionIDs))
+}
+
 func (mr *MongoRepository) SaveCancel(
 	id value_object.UUID,
 ) error {
@@ -380,3 +526,71 @@ func (mr *MongoRepository) SaveCancel(
 			AddSet("end", time.Now()).
 			AddSet("canceled", true))
 }
+
+func (mr *MongoRepository) SaveTimeoutCancel(
+	id value_object.UUID,
+) (bool, error) {
+	patchedAmount, err := mr.mongoCollection.Patch(
+		mongodb.NewFilter().
+			AddEqual("id", id).
+			AddNotEqual("timeout_canceled", true),
+		mongodb.NewUpdater().AddSet("timeout_canceled", true))
+	if err != nil {
+		return false, err
+	}
+	return patchedAmount > 0, nil
+}
+
+func (mr *MongoRepository) SaveWaitingApproval(
+	id value_object.UUID,
+) error {
+	return mr.mongoCollection.PatchByID(
+		id,
+		mongodb.NewUpdater().
+			AddSet("start", time.Now()).
+			AddSet("timeout_canceled", false).
+			AddSet("waiting_approval", true))
+}
+
+func (mr *MongoRepository) SaveApprovalDecision(
+	id, userID value_object.UUID,
+) (bool, error) {
+	patchedAmount, err := mr.mongoCollection.Patch(
+		mongodb.NewFilter().
+			AddEqual("id", id).
+			AddEqual("waiting_approval", true).
+			AddNotEqual("timeout_canceled", true).
+			AddIn("end", []interface{}{nil, time.Time{}}),
+		mongodb.NewUpdater().
+			AddSet("waiting_approval", false).
+			AddSet("approval_user_id", userID).
+			AddSet("sb_canceled_at", time.Time{}))
+	if err != nil {
+		return false, err
+	}
+	return patchedAmount > 0, nil
+}
+
+func (mr *MongoRepository) AddAttempt(
+	id value_object.UUID, attempt aggregate.FunctionRunAttempt,
+) error {
+	return mr.mongoCollection.PatchByID(
+		id,
+		mongodb.NewUpdater().AddPush("attempts", newMongoAttempt(attempt)))
+}
+
+func (mr *MongoRepository) SaveRetry(
+	id value_object.UUID, failedAttempt aggregate.FunctionRunAttempt,
+) error {
+	return mr.mongoCollection.PatchByID(
+		id,
+		mongodb.NewUpdater().
+			AddPush("attempts", newMongoAttempt(failedAttempt)).
+			AddSet("start", time.Time{}).
+			AddSet("end", time.Time{}).
+			AddSet("suc", false).
+			AddSet("error_msg", failedAttempt.ErrorMsg).
+			AddSet("progress", 0).
+			AddSet("progress_msg", []string{}).
+			AddSet("progress_milestone_index", nil))
+}
@@ -243,6 +243,22 @@ func TestFunctionRunRecord(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(len(fRR), ShouldEqual, 1)
 		})
+
+		Convey("FilterByMapParentID", func() {
+			for _, index := range []int{1, 0} {
+				child := aggregate.NewMapChildFunctionRunRecord(aggFunctionRunRecord, index, nil)
+				So(epo.Create(child), ShouldBeNil)
+			}
+			children, err := epo.FilterByMapParentID(aggFunctionRunRecord.ID)
+			So(err, ShouldBeNil)
+			So(len(children), ShouldEqual, 2)
+			So(children[0].MapIndex, ShouldEqual, 0)
+			So(children[1].IsMapChild(), ShouldBeTrue)
+
+			fRR, err := epo.FilterByMapParentID(value_object.NewUUID())
+			So(err, ShouldBeNil)
+			So(len(fRR), ShouldEqual, 0)
+		})
 	})
 
 	Convey("Count", t, func() {
@@ -357,6 +373,41 @@ func TestFunctionRunRecord(t *testing.T) {
 			fRR, _ := epo.GetByID(aggFunctionRunRecord.ID)
 			So(fRR.Canceled, ShouldBeTrue)
 		})
+
+		Convey("AddMapFinishedIndex", func() {
+			parent := &aggregate.FunctionRunRecord{ID: value_object.NewUUID()}
+			So(epo.Create(parent), ShouldBeNil)
+
+			finishedAmount, added, err := epo.AddMapFinishedIndex(parent.ID, 0)
+			So(err, ShouldBeNil)
+			So(added, ShouldBeTrue)
+			So(finishedAmount, ShouldEqual, 1)
+
+			// 同一个子记录重复上报
+			_, added, err = epo.AddMapFinishedIndex(parent.ID, 0)
+			So(err, ShouldBeNil)
+			So(added, ShouldBeFalse)
+
+			finishedAmount, added, err = epo.AddMapFinishedIndex(parent.ID, 1)
+			So(err, ShouldBeNil)
+			So(added, ShouldBeTrue)
+			So(finishedAmount, ShouldEqual, 2)
+
+			Convey("SaveFailIfNotFinished", func() {
+				failed, err := epo.SaveFailIfNotFinished(parent.ID, "map item failed")
+				So(err, ShouldBeNil)
+				So(failed, ShouldBeTrue)
+
+				failed, err = epo.SaveFailIfNotFinished(parent.ID, "map item failed")
+				So(err, ShouldBeNil)
+				So(failed, ShouldBeFalse)
+
+				// 父记录结束后不再记录
+				_, added, err = epo.AddMapFinishedIndex(parent.ID, 2)
+				So(err, ShouldBeNil)
+				So(added, ShouldBeFalse)
+			})
+		})
 	})
 }
 
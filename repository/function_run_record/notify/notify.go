@@ -0,0 +1,175 @@
+// Package notify 包装FunctionRunRecordRepository，节点开始/结束/进度变化持久化成功后发布运行状态变化事件
+package notify
+
+import (
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/event"
+	"github.com/fBloc/bloc-server/pkg/value_type"
+	"github.com/fBloc/bloc-server/repository/function_run_record"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+func init() {
+	var _ function_run_record.FunctionRunRecordRepository = &Repository{}
+}
+
+type Repository struct {
+	function_run_record.FunctionRunRecordRepository
+}
+
+func New(repo function_run_record.FunctionRunRecordRepository) *Repository {
+	return &Repository{FunctionRunRecordRepository: repo}
+}
+
+// runStatus function运行记录对应的运行状态
+func runStatus(fRR *aggregate.FunctionRunRecord) value_object.RunState {
+	switch {
+	case !fRR.Finished():
+		if fRR.Start.IsZero() {
+			return value_object.Created
+		}
+		if fRR.IsWaitingApproval() {
+			return value_object.WaitingApproval
+		}
+		return value_object.Running
+	case fRR.Suc:
+		return value_object.Suc
+	case fRR.TimeoutCanceled:
+		return value_object.TimeoutCanceled
+	case fRR.Canceled:
+		return value_object.UserCanceled
+	}
+	return value_object.Fail
+}
+
+func newStatusChangedEvent(
+	kind event.RunStatusChangeKind, fRR *aggregate.FunctionRunRecord,
+) *event.RunStatusChanged {
+	var progressMsg string
+	if len(fRR.ProgressMsg) > 0 {
+		progressMsg = fRR.ProgressMsg[len(fRR.ProgressMsg)-1]
+	}
+	return &event.RunStatusChanged{
+		Kind:                kind,
+		FlowID:              fRR.FlowID,
+		FlowOriginID:        fRR.FlowOriginID,
+		FlowRunRecordID:     fRR.FlowRunRecordID,
+		FunctionRunRecordID: fRR.ID,
+		FlowFunctionID:      fRR.FlowFunctionID,
+		Status:              runStatus(fRR),
+		ErrorMsg:            fRR.ErrorMsg,
+		Progress:            fRR.Progress,
+		ProgressMsg:         progressMsg,
+		Time:                time.Now(),
+	}
+}
+
+// pubByID 推送只是附带的通知，失败不影响状态的变更
+func (r *Repository) pubByID(
+	kind event.RunStatusChangeKind, id value_object.UUID, err error,
+) error {
+	if err != nil {
+		return err
+	}
+	fRR, getErr := r.FunctionRunRecordRepository.GetByID(id)
+	if getErr != nil || fRR.IsZero() {
+		return nil
+	}
+	_ = event.PubEvent(newStatusChangedEvent(kind, fRR))
+	return nil
+}
+
+func (r *Repository) PatchProgress(id value_object.UUID, progress float32) error {
+	return r.pubByID(
+		event.FunctionRunProgressChange, id,
+		r.FunctionRunRecordRepository.PatchProgress(id, progress))
+}
+
+func (r *Repository) PatchProgressMsg(id value_object.UUID, progressMsg string) error {
+	return r.pubByID(
+		event.FunctionRunProgressChange, id,
+		r.FunctionRunRecordRepository.PatchProgressMsg(id, progressMsg))
+}
+
+func (r *Repository) PatchMilestoneIndex(
+	id value_object.UUID, progressMilestoneIndex *int,
+) error {
+	return r.pubByID(
+		event.FunctionRunProgressChange, id,
+		r.FunctionRunRecordRepository.PatchMilestoneIndex(id, progressMilestoneIndex))
+}
+
+func (r *Repository) SaveStart(id value_object.UUID) error {
+	return r.pubByID(
+		event.FunctionRunStartChange, id,
+		r.FunctionRunRecordRepository.SaveStart(id))
+}
+
+func (r *Repository) SaveSuc(
+	id value_object.UUID, desc string,
+	keyMapValueType map[string]value_type.ValueType,
+	keyMapValueIsArray map[string]bool,
+	keyMapObjectStorageKey, keyMapBriefData map[string]string,
+	intercepted bool,
+) error {
+	return r.pubByID(
+		event.FunctionRunFinishChange, id,
+		r.FunctionRunRecordRepository.SaveSuc(
+			id, desc, keyMapValueType, keyMapValueIsArray,
+			keyMapObjectStorageKey, keyMapBriefData, intercepted))
+}
+
+func (r *Repository) SaveCancel(id value_object.UUID) error {
+	return r.pubByID(
+		event.FunctionRunFinishChange, id,
+		r.FunctionRunRecordRepository.SaveCancel(id))
+}
+
+func (r *Repository) SaveTimeoutCancel(id value_object.UUID) (bool, error) {
+	marked, err := r.FunctionRunRecordRepository.SaveTimeoutCancel(id)
+	if err != nil || !marked {
+		return marked, err
+	}
+	// 超时取消后还未结束（等待重试或失败），以超时的状态推送
+	fRR, getErr := r.FunctionRunRecordRepository.GetByID(id)
+	if getErr != nil || fRR.IsZero() {
+		return marked, nil
+	}
+	evt := newStatusChangedEvent(event.FunctionRunFinishChange, fRR)
+	evt.Status = value_object.TimeoutCanceled
+	_ = event.PubEvent(evt)
+	return marked, nil
+}
+
+func (r *Repository) SaveFail(id value_object.UUID, errMsg string) error {
+	return r.pubByID(
+		event.FunctionRunFinishChange, id,
+		r.FunctionRunRecordRepository.SaveFail(id, errMsg))
+}
+
+func (r *Repository) SaveWaitingApproval(id value_object.UUID) error {
+	return r.pubByID(
+		event.FunctionRunStartChange, id,
+		r.FunctionRunRecordRepository.SaveWaitingApproval(id))
+}
+
+func (r *Repository) SaveRetry(
+	id value_object.UUID, failedAttempt aggregate.FunctionRunAttempt,
+) error {
+	err := r.FunctionRunRecordRepository.SaveRetry(id, failedAttempt)
+	if err != nil {
+		return err
+	}
+	// 重置后的记录已不包含此次失败的信息，以失败的此次运行推送
+	fRR, getErr := r.FunctionRunRecordRepository.GetByID(id)
+	if getErr != nil || fRR.IsZero() {
+		return nil
+	}
+	evt := newStatusChangedEvent(event.FunctionRunFinishChange, fRR)
+	evt.Status = value_object.Fail
+	evt.ErrorMsg = failedAttempt.ErrorMsg
+	_ = event.PubEvent(evt)
+	return nil
+}
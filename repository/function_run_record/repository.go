@@ -25,6 +25,12 @@ type FunctionRunRecordRepository interface {
 	FilterByFlowRunRecordID(
 		FlowRunRecordID value_object.UUID,
 	) ([]*aggregate.FunctionRunRecord, error)
+	// FilterDeadlineExceeded 还未完成、已超过截止时间且还未被标记为超时的记录
+	FilterDeadlineExceeded(now time.Time) ([]*aggregate.FunctionRunRecord, error)
+	// FilterByMapParentID map模式父记录下的所有子记录，按元素下标排序
+	FilterByMapParentID(
+		mapParentID value_object.UUID,
+	) ([]*aggregate.FunctionRunRecord, error)
 
 	// Update
 	PatchProgress(id value_object.UUID, progress float32) error
@@ -49,8 +55,25 @@ type FunctionRunRecordRepository interface {
 		keyMapObjectStorageKey, keyMapBriefData map[string]string,
 		intercepted bool,
 	) error
+	// SaveSkippedDownstreams 记录由于分支条件不满足而不运行的下游节点
+	SaveSkippedDownstreams(id value_object.UUID, flowFunctionIDs []string) error
 	SaveCancel(id value_object.UUID) error
+	// SaveTimeoutCancel 标记为超时取消，返回false表示已经被标记过了（防止并发的watcher重复处理）
+	SaveTimeoutCancel(id value_object.UUID) (bool, error)
 	SaveFail(id value_object.UUID, errMsg string) error
+	// SaveFailIfNotFinished 记录运行失败，返回false表示已经结束了（防止并发的上报重复处理）
+	SaveFailIfNotFinished(id value_object.UUID, errMsg string) (bool, error)
+	// AddMapFinishedIndex 原子地记录map模式父记录下第index个子记录已成功完成，返回已完成的子记录数
+	// 父记录已结束、或此子记录已记录过（重复上报）时added为false
+	AddMapFinishedIndex(id value_object.UUID, index int) (finishedAmount int, added bool, err error)
+	// SaveWaitingApproval 人工审批节点开始等待审批
+	SaveWaitingApproval(id value_object.UUID) error
+	// SaveApprovalDecision 记录做出审批的用户并清除截止时间，返回false表示已不在等待审批（已被审批/超时/结束）
+	SaveApprovalDecision(id, userID value_object.UUID) (bool, error)
+	// AddAttempt 记录一次运行的结果
+	AddAttempt(id value_object.UUID, attempt aggregate.FunctionRunAttempt) error
+	// SaveRetry 记录失败的此次运行，并重置运行状态以便重新运行
+	SaveRetry(id value_object.UUID, failedAttempt aggregate.FunctionRunAttempt) error
 
 	// Delete
 }
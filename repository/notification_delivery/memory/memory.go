@@ -0,0 +1,130 @@
+package memory
+
+import (
+	"sync"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/internal/memory_filter"
+	"github.com/fBloc/bloc-server/repository/notification_delivery"
+	mongo_notificationDelivery "github.com/fBloc/bloc-server/repository/notification_delivery/mongo"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+func init() {
+	var _ notification_delivery.NotificationDeliveryRepository = &MemoryRepository{}
+}
+
+type MemoryRepository struct {
+	deliveries []*aggregate.NotificationDelivery // 按插入顺序
+	sync.RWMutex
+}
+
+// Create a new in-memory repository
+func New() *MemoryRepository {
+	return &MemoryRepository{}
+}
+
+func copyDelivery(nD *aggregate.NotificationDelivery) *aggregate.NotificationDelivery {
+	c := *nD
+	c.Triggers = append([]value_object.NotifyTrigger(nil), nD.Triggers...)
+	c.Attempts = append([]aggregate.NotificationDeliveryAttempt(nil), nD.Attempts...)
+	return &c
+}
+
+// toDocument 通用过滤条件中的key为持久化字段名，故转为与mongo一致的文档后再做匹配
+func toDocument(nD *aggregate.NotificationDelivery) memory_filter.Document {
+	doc, err := memory_filter.ToDocument(mongo_notificationDelivery.NewFromAggregate(nD))
+	if err != nil {
+		return memory_filter.Document{}
+	}
+	return doc
+}
+
+func (mr *MemoryRepository) Create(nD *aggregate.NotificationDelivery) error {
+	mr.Lock()
+	defer mr.Unlock()
+	mr.deliveries = append(mr.deliveries, copyDelivery(nD))
+	return nil
+}
+
+func (mr *MemoryRepository) CreateIfNotExist(
+	nD *aggregate.NotificationDelivery,
+) (bool, error) {
+	mr.Lock()
+	defer mr.Unlock()
+	for _, exist := range mr.deliveries {
+		if exist.FunctionRunRecordID.IsNil() &&
+			exist.FlowRunRecordID == nD.FlowRunRecordID &&
+			exist.RuleIndex == nD.RuleIndex {
+			return false, nil
+		}
+	}
+	mr.deliveries = append(mr.deliveries, copyDelivery(nD))
+	return true, nil
+}
+
+func (mr *MemoryRepository) GetByID(
+	id value_object.UUID,
+) (*aggregate.NotificationDelivery, error) {
+	mr.RLock()
+	defer mr.RUnlock()
+	for _, nD := range mr.deliveries {
+		if nD.ID == id {
+			return copyDelivery(nD), nil
+		}
+	}
+	return &aggregate.NotificationDelivery{}, nil // 同mongo实现，未找到时返回空值而非nil
+}
+
+func (mr *MemoryRepository) filter(
+	filter value_object.RepositoryFilter,
+) []*aggregate.NotificationDelivery {
+	mr.RLock()
+	defer mr.RUnlock()
+	matched := make([]*aggregate.NotificationDelivery, 0)
+	for _, nD := range mr.deliveries {
+		if toDocument(nD).Match(filter) {
+			matched = append(matched, nD)
+		}
+	}
+	return matched
+}
+
+func (mr *MemoryRepository) Filter(
+	filter value_object.RepositoryFilter,
+	filterOption value_object.RepositoryFilterOption,
+) ([]*aggregate.NotificationDelivery, error) {
+	matched := mr.filter(filter)
+	indexes := memory_filter.PageIndexes(len(matched), filterOption)
+	resp := make([]*aggregate.NotificationDelivery, 0, len(indexes))
+	for _, i := range indexes {
+		resp = append(resp, copyDelivery(matched[i]))
+	}
+	return resp, nil
+}
+
+func (mr *MemoryRepository) Count(filter value_object.RepositoryFilter) (int64, error) {
+	return int64(len(mr.filter(filter))), nil
+}
+
+func (mr *MemoryRepository) AddAttempt(
+	id value_object.UUID,
+	attempt aggregate.NotificationDeliveryAttempt,
+	finished bool,
+) error {
+	mr.Lock()
+	defer mr.Unlock()
+	for i, nD := range mr.deliveries {
+		if nD.ID != id {
+			continue
+		}
+		c := copyDelivery(nD)
+		c.Attempts = append(c.Attempts, attempt)
+		c.Suc = attempt.Suc
+		if finished {
+			c.FinishTime = attempt.Time
+		}
+		mr.deliveries[i] = c
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package mongo
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func mongoDBIndexes() []mongo.IndexModel {
+	truePoint := true
+	return []mongo.IndexModel{
+		{
+			Keys: bson.M{
+				"id": "hashed",
+			},
+			Options: &options.IndexOptions{
+				Sparse: &truePoint,
+			},
+		},
+		{
+			Keys: bson.M{
+				"flow_run_record_id": "hashed",
+			},
+			Options: &options.IndexOptions{
+				Sparse: &truePoint,
+			},
+		},
+		{
+			Keys: bson.M{
+				"flow_origin_id": "hashed",
+			},
+			Options: &options.IndexOptions{
+				Sparse: &truePoint,
+			},
+		},
+		{
+			// 唯一索引保证重复的运行结束事件不会为同一条通知规则创建多条通知
+			Keys: bson.D{
+				{Key: "flow_run_record_id", Value: 1},
+				{Key: "rule_index", Value: 1},
+			},
+			Options: &options.IndexOptions{
+				Unique: &truePoint,
+				PartialFilterExpression: bson.M{
+					"rule_index": bson.M{"$exists": true}},
+			},
+		},
+	}
+}
@@ -0,0 +1,206 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/internal/conns/mongodb"
+	"github.com/fBloc/bloc-server/repository/notification_delivery"
+	"github.com/fBloc/bloc-server/value_object"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	DefaultCollectionName = "notification_delivery"
+)
+
+func init() {
+	var _ notification_delivery.NotificationDeliveryRepository = &MongoRepository{}
+}
+
+type MongoRepository struct {
+	mongoCollection *mongodb.Collection
+}
+
+// Create a new mongodb repository
+func New(
+	ctx context.Context,
+	mC *mongodb.MongoConfig, collectionName string,
+) (*MongoRepository, error) {
+	collection, err := mongodb.NewCollection(mC, collectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := mongoDBIndexes()
+	err = collection.CreateIndex(indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MongoRepository{mongoCollection: collection}, nil
+}
+
+type mongoAttempt struct {
+	Time     time.Time `bson:"time"`
+	Suc      bool      `bson:"suc"`
+	ErrorMsg string    `bson:"error_msg,omitempty"`
+}
+
+type mongoNotificationDelivery struct {
+	ID              value_object.UUID            `bson:"id"`
+	FlowID          value_object.UUID            `bson:"flow_id"`
+	FlowOriginID    value_object.UUID            `bson:"flow_origin_id"`
+	FlowRunRecordID value_object.UUID            `bson:"flow_run_record_id"`
+	Triggers        []value_object.NotifyTrigger `bson:"triggers"`
+	Channel         value_object.NotifyChannel   `bson:"channel"`
+	Target          string                       `bson:"target"`
+	Secret          string                       `bson:"secret,omitempty"`
+	CreateTime      time.Time                    `bson:"create_time"`
+	FinishTime      time.Time                    `bson:"finish_time,omitempty"`
+	Suc             bool                         `bson:"suc"`
+	Attempts        []mongoAttempt               `bson:"attempts,omitempty"`
+
+	// 只有审批通知才有此字段，以便于过滤出flow运行结束的通知
+	FunctionRunRecordID *value_object.UUID `bson:"function_run_record_id,omitempty"`
+	// 只有flow运行结束的通知才有此字段，审批通知不受唯一索引约束
+	RuleIndex *int `bson:"rule_index,omitempty"`
+}
+
+func NewFromAggregate(nD *aggregate.NotificationDelivery) *mongoNotificationDelivery {
+	resp := mongoNotificationDelivery{
+		ID:              nD.ID,
+		FlowID:          nD.FlowID,
+		FlowOriginID:    nD.FlowOriginID,
+		FlowRunRecordID: nD.FlowRunRecordID,
+		Triggers:        nD.Triggers,
+		Channel:         nD.Channel,
+		Target:          nD.Target,
+		Secret:          nD.Secret,
+		CreateTime:      nD.CreateTime,
+		FinishTime:      nD.FinishTime,
+		Suc:             nD.Suc,
+	}
+	if !nD.FunctionRunRecordID.IsNil() {
+		funcRunRecordID := nD.FunctionRunRecordID
+		resp.FunctionRunRecordID = &funcRunRecordID
+	} else {
+		ruleIndex := nD.RuleIndex
+		resp.RuleIndex = &ruleIndex
+	}
+	for _, attempt := range nD.Attempts {
+		resp.Attempts = append(resp.Attempts, newMongoAttempt(attempt))
+	}
+	return &resp
+}
+
+func newMongoAttempt(attempt aggregate.NotificationDeliveryAttempt) mongoAttempt {
+	return mongoAttempt{
+		Time:     attempt.Time,
+		Suc:      attempt.Suc,
+		ErrorMsg: attempt.ErrorMsg,
+	}
+}
+
+func (m *mongoNotificationDelivery) ToAggregate() *aggregate.NotificationDelivery {
+	resp := aggregate.NotificationDelivery{
+		ID:              m.ID,
+		FlowID:          m.FlowID,
+		FlowOriginID:    m.FlowOriginID,
+		FlowRunRecordID: m.FlowRunRecordID,
+		Triggers:        m.Triggers,
+		Channel:         m.Channel,
+		Target:          m.Target,
+		Secret:          m.Secret,
+		CreateTime:      m.CreateTime,
+		FinishTime:      m.FinishTime,
+		Suc:             m.Suc,
+	}
+	if m.FunctionRunRecordID != nil {
+		resp.FunctionRunRecordID = *m.FunctionRunRecordID
+	}
+	if m.RuleIndex != nil {
+		resp.RuleIndex = *m.RuleIndex
+	}
+	for _, attempt := range m.Attempts {
+		resp.Attempts = append(resp.Attempts, aggregate.NotificationDeliveryAttempt{
+			Time:     attempt.Time,
+			Suc:      attempt.Suc,
+			ErrorMsg: attempt.ErrorMsg,
+		})
+	}
+	return &resp
+}
+
+func (mr *MongoRepository) Create(nD *aggregate.NotificationDelivery) error {
+	_, err := mr.mongoCollection.InsertOne(*NewFromAggregate(nD))
+	return err
+}
+
+func (mr *MongoRepository) CreateIfNotExist(
+	nD *aggregate.NotificationDelivery,
+) (bool, error) {
+	var oldND mongoNotificationDelivery
+	exist, err := mr.mongoCollection.FindOneOrInsert(
+		mongodb.NewFilter().
+			AddEqual("flow_run_record_id", nD.FlowRunRecordID).
+			AddEqual("rule_index", nD.RuleIndex),
+		*NewFromAggregate(nD), &oldND)
+	if err != nil && mongo.IsDuplicateKeyError(err) {
+		// 并发创建时被唯一索引拦截，说明已被其他消费者创建
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !exist, nil
+}
+
+func (mr *MongoRepository) GetByID(
+	id value_object.UUID,
+) (*aggregate.NotificationDelivery, error) {
+	var mND mongoNotificationDelivery
+	err := mr.mongoCollection.Get(mongodb.NewFilter().AddEqual("id", id), nil, &mND)
+	if err != nil {
+		return nil, err
+	}
+	return mND.ToAggregate(), nil
+}
+
+func (mr *MongoRepository) Filter(
+	filter value_object.RepositoryFilter,
+	filterOption value_object.RepositoryFilterOption,
+) ([]*aggregate.NotificationDelivery, error) {
+	var mNDs []mongoNotificationDelivery
+	err := mr.mongoCollection.CommonFilter(filter, filterOption, &mNDs)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]*aggregate.NotificationDelivery, 0, len(mNDs))
+	for _, i := range mNDs {
+		resp = append(resp, i.ToAggregate())
+	}
+	return resp, nil
+}
+
+func (mr *MongoRepository) Count(
+	filter value_object.RepositoryFilter,
+) (int64, error) {
+	return mr.mongoCollection.CommonCount(filter)
+}
+
+func (mr *MongoRepository) AddAttempt(
+	id value_object.UUID,
+	attempt aggregate.NotificationDeliveryAttempt,
+	finished bool,
+) error {
+	updater := mongodb.NewUpdater().
+		AddPush("attempts", newMongoAttempt(attempt)).
+		AddSet("suc", attempt.Suc)
+	if finished {
+		updater.AddSet("finish_time", attempt.Time)
+	}
+	return mr.mongoCollection.PatchByID(id, updater)
+}
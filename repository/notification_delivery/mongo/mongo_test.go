@@ -0,0 +1,162 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/internal/conns/mongodb"
+	"github.com/fBloc/bloc-server/value_object"
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	epo  *MongoRepository
+	conf = &mongodb.MongoConfig{
+		Db:       "bloc-test-mongo",
+		User:     "root",
+		Password: "password",
+	}
+)
+
+func TestNotificationDelivery(t *testing.T) {
+	flowRunRecord := &aggregate.FlowRunRecord{
+		ID:           value_object.NewUUID(),
+		FlowID:       value_object.NewUUID(),
+		FlowOriginID: value_object.NewUUID(),
+	}
+	rule := &aggregate.NotificationRule{
+		Triggers: []value_object.NotifyTrigger{value_object.NotifyOnFail},
+		Channel:  value_object.WebhookChannel,
+		Target:   "http://localhost/hook",
+	}
+	delivery := aggregate.NewNotificationDelivery(flowRunRecord, 0, rule, rule.Triggers)
+
+	Convey("create & get", t, func() {
+		So(epo.Create(delivery), ShouldBeNil)
+
+		aggND, err := epo.GetByID(delivery.ID)
+		So(err, ShouldBeNil)
+		So(aggND.IsZero(), ShouldBeFalse)
+		So(aggND.FlowRunRecordID, ShouldEqual, flowRunRecord.ID)
+		So(aggND.Triggers, ShouldResemble, rule.Triggers)
+		So(aggND.Finished(), ShouldBeFalse)
+	})
+
+	Convey("create if not exist", t, func() {
+		otherRunRecord := &aggregate.FlowRunRecord{ID: value_object.NewUUID()}
+		created, err := epo.CreateIfNotExist(
+			aggregate.NewNotificationDelivery(otherRunRecord, 0, rule, rule.Triggers))
+		So(err, ShouldBeNil)
+		So(created, ShouldBeTrue)
+		created, err = epo.CreateIfNotExist(
+			aggregate.NewNotificationDelivery(otherRunRecord, 0, rule, rule.Triggers))
+		So(err, ShouldBeNil)
+		So(created, ShouldBeFalse)
+
+		other := aggregate.NewNotificationDelivery(otherRunRecord, 1, rule, rule.Triggers)
+		created, err = epo.CreateIfNotExist(other)
+		So(err, ShouldBeNil)
+		So(created, ShouldBeTrue)
+		aggND, err := epo.GetByID(other.ID)
+		So(err, ShouldBeNil)
+		So(aggND.RuleIndex, ShouldEqual, 1)
+	})
+
+	Convey("add attempt", t, func() {
+		So(epo.AddAttempt(
+			delivery.ID,
+			aggregate.NotificationDeliveryAttempt{Time: time.Now(), ErrorMsg: "503"},
+			false), ShouldBeNil)
+		So(epo.AddAttempt(
+			delivery.ID,
+			aggregate.NotificationDeliveryAttempt{Time: time.Now(), Suc: true},
+			true), ShouldBeNil)
+
+		aggND, err := epo.GetByID(delivery.ID)
+		So(err, ShouldBeNil)
+		So(aggND.AttemptedAmount(), ShouldEqual, 2)
+		So(aggND.Suc, ShouldBeTrue)
+		So(aggND.Finished(), ShouldBeTrue)
+	})
+
+	Convey("filter", t, func() {
+		filter := value_object.NewRepositoryFilter().
+			AddEqual("flow_run_record_id", flowRunRecord.ID)
+		aggNDs, err := epo.Filter(*filter, *value_object.NewRepositoryFilterOption())
+		So(err, ShouldBeNil)
+		So(len(aggNDs), ShouldEqual, 1)
+
+		count, err := epo.Count(*filter)
+		So(err, ShouldBeNil)
+		So(count, ShouldEqual, 1)
+	})
+}
+
+func TestMain(m *testing.M) {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		log.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	// pull mongodb docker image for version 5.0
+	resource, err := pool.RunWithOptions(&dockertest.RunOptions{
+		Repository: "mongo",
+		Tag:        "5.0.5",
+		Env: []string{
+			// username and password for mongodb superuser
+			"MONGO_INITDB_ROOT_USERNAME=" + conf.User,
+			"MONGO_INITDB_ROOT_PASSWORD=" + conf.Password,
+		},
+	}, func(config *docker.HostConfig) {
+		// set AutoRemove to true so that stopped container goes away by itself
+		config.AutoRemove = true
+		config.RestartPolicy = docker.RestartPolicy{
+			Name: "no",
+		}
+	})
+	if err != nil {
+		log.Fatalf("Could not start resource: %s", err)
+	}
+
+	conf.Addresses = []string{
+		fmt.Sprintf("localhost:%s", resource.GetPort("27017/tcp"))}
+
+	// exponential backoff-retry, because the application in the container might not be ready to accept connections yet
+	err = pool.Retry(func() error {
+		var err error
+		epo, err = New(context.TODO(), conf, DefaultCollectionName)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+
+	if err != nil {
+		log.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	// run tests
+	code := m.Run()
+
+	// When you're done, kill and remove the container
+	if err = pool.Purge(resource); err != nil {
+		log.Fatalf("Could not purge resource: %s", err)
+	}
+
+	os.Exit(code)
+}
+
+func TestCreateIndexes(t *testing.T) {
+	Convey("create index", t, func() {
+		indexes := mongoDBIndexes()
+		err := epo.mongoCollection.CreateIndex(indexes)
+		So(err, ShouldBeNil)
+	})
+}
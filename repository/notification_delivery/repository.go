@@ -0,0 +1,31 @@
+package notification_delivery
+
+import (
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+type NotificationDeliveryRepository interface {
+	// Create
+	Create(*aggregate.NotificationDelivery) error
+	// CreateIfNotExist 同一flow运行记录的同一通知规则只创建一次，已存在时created为false
+	CreateIfNotExist(*aggregate.NotificationDelivery) (created bool, err error)
+
+	// Read
+	GetByID(id value_object.UUID) (*aggregate.NotificationDelivery, error)
+	Filter(
+		filter value_object.RepositoryFilter,
+		filterOption value_object.RepositoryFilterOption,
+	) ([]*aggregate.NotificationDelivery, error)
+	Count(filter value_object.RepositoryFilter) (int64, error)
+
+	// Update
+	// AddAttempt 记录一次投递的结果，finished表示不再重试（成功或放弃）
+	AddAttempt(
+		id value_object.UUID,
+		attempt aggregate.NotificationDeliveryAttempt,
+		finished bool,
+	) error
+
+	// Delete
+}
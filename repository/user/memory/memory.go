@@ -0,0 +1,122 @@
+package memory
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/repository/user"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+func init() {
+	var _ user.UserRepository = &MemoryRepository{}
+}
+
+type MemoryRepository struct {
+	users []*aggregate.User // 按插入顺序
+	sync.RWMutex
+}
+
+// Create a new in-memory repository
+func New() *MemoryRepository {
+	return &MemoryRepository{}
+}
+
+func copyUser(u *aggregate.User) *aggregate.User {
+	if u == nil {
+		return nil
+	}
+	c := *u
+	return &c
+}
+
+// getLatest 同mongo的Get，多条匹配时返回最后插入的
+func (mr *MemoryRepository) getLatest(match func(*aggregate.User) bool) *aggregate.User {
+	mr.RLock()
+	defer mr.RUnlock()
+	for i := len(mr.users) - 1; i >= 0; i-- {
+		if match(mr.users[i]) {
+			return copyUser(mr.users[i])
+		}
+	}
+	return nil
+}
+
+func (mr *MemoryRepository) Create(u *aggregate.User) error {
+	c := copyUser(u)
+	c.RawPassword = "" // 同mongo实现，只持久化加密后的密码
+	if c.CreateTime.IsZero() {
+		c.CreateTime = time.Now()
+	}
+
+	mr.Lock()
+	defer mr.Unlock()
+	mr.users = append(mr.users, c)
+	return nil
+}
+
+func (mr *MemoryRepository) All() ([]aggregate.User, error) {
+	mr.RLock()
+	defer mr.RUnlock()
+	resp := make([]aggregate.User, 0, len(mr.users))
+	for i := len(mr.users) - 1; i >= 0; i-- {
+		resp = append(resp, *mr.users[i])
+	}
+	return resp, nil
+}
+
+func (mr *MemoryRepository) FilterByNameContains(
+	nameContains string,
+) ([]aggregate.User, error) {
+	mr.RLock()
+	defer mr.RUnlock()
+	resp := make([]aggregate.User, 0)
+	for i := len(mr.users) - 1; i >= 0; i-- {
+		if strings.Contains(mr.users[i].Name, nameContains) {
+			resp = append(resp, *mr.users[i])
+		}
+	}
+	return resp, nil
+}
+
+func (mr *MemoryRepository) GetByName(name string) (*aggregate.User, error) {
+	return mr.getLatest(func(u *aggregate.User) bool { return u.Name == name }), nil
+}
+
+func (mr *MemoryRepository) GetByID(id value_object.UUID) (*aggregate.User, error) {
+	return mr.getLatest(func(u *aggregate.User) bool { return u.ID == id }), nil
+}
+
+func (mr *MemoryRepository) GetByToken(token value_object.UUID) (*aggregate.User, error) {
+	return mr.getLatest(func(u *aggregate.User) bool { return u.Token == token }), nil
+}
+
+func (mr *MemoryRepository) PatchName(id value_object.UUID, name string) error {
+	mr.Lock()
+	defer mr.Unlock()
+	for _, u := range mr.users {
+		if u.ID == id {
+			u.Name = name
+			return nil
+		}
+	}
+	return nil
+}
+
+func (mr *MemoryRepository) DeleteByID(id value_object.UUID) (int64, error) {
+	mr.Lock()
+	defer mr.Unlock()
+	var deleted int64
+	remain := make([]*aggregate.User, 0, len(mr.users))
+	for _, u := range mr.users {
+		if u.ID == id {
+			deleted++
+			continue
+		}
+		remain = append(remain, u)
+	}
+	mr.users = remain
+	return deleted, nil
+}
@@ -26,6 +26,8 @@ type FlowService struct {
 	Function          function.FunctionRepository
 	FunctionRunRecord function_run_record.FunctionRunRecordRepository
 	UserCacheService  *user_cache.UserCacheService
+	// 对全部flow生效的禁止运行时段
+	GlobalBlackoutWindows []*aggregate.BlackoutWindow
 }
 
 func NewFlowService(cfgs ...FlowConfiguration) (*FlowService, error) {
@@ -139,6 +141,15 @@ func WithUserCacheService(
 	}
 }
 
+func WithGlobalBlackoutWindows(
+	windows []*aggregate.BlackoutWindow,
+) FlowConfiguration {
+	return func(fs *FlowService) error {
+		fs.GlobalBlackoutWindows = windows
+		return nil
+	}
+}
+
 func (u *FlowService) GetLatestRunRecordByFlowID(
 	flowID value_object.UUID,
 ) (*aggregate.FlowRunRecord, error) {
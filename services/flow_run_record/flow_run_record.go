@@ -2,9 +2,12 @@ package flow_run_record
 
 import (
 	"context"
+	"time"
 
+	"github.com/fBloc/bloc-server/aggregate"
 	"github.com/fBloc/bloc-server/infrastructure/log"
 	"github.com/fBloc/bloc-server/internal/conns/mongodb"
+	"github.com/fBloc/bloc-server/repository/flow_lock"
 	"github.com/fBloc/bloc-server/repository/flow_run_record"
 	mongoFRRC "github.com/fBloc/bloc-server/repository/flow_run_record/mongo"
 	user_cache "github.com/fBloc/bloc-server/services/user_cache"
@@ -16,6 +19,7 @@ type FlowRunRecordService struct {
 	Logger           *log.Logger
 	UserCacheService *user_cache.UserCacheService
 	FlowRunRecord    flow_run_record.FlowRunRecordRepository
+	FlowLock         flow_lock.FlowLockRepository
 }
 
 func NewService(
@@ -71,3 +75,26 @@ func WithFlowRunRecordRepository(
 		return nil
 	}
 }
+
+func WithFlowLockRepository(
+	flowLockRepository flow_lock.FlowLockRepository,
+) FlowRunRecordConfiguration {
+	return func(fts *FlowRunRecordService) error {
+		fts.FlowLock = flowLockRepository
+		return nil
+	}
+}
+
+// HoldsFlowLock 运行是否仍以获取时的版本持有flow的槽位锁，没有获取过锁的运行视为持有
+func (fRRS *FlowRunRecordService) HoldsFlowLock(
+	flowRunIns *aggregate.FlowRunRecord,
+) (bool, error) {
+	if flowRunIns.FlowLockVersion == 0 || fRRS.FlowLock == nil {
+		return true, nil
+	}
+	locks, err := fRRS.FlowLock.FilterByFlowOriginID(flowRunIns.FlowOriginID)
+	if err != nil {
+		return false, err
+	}
+	return aggregate.FlowRunHoldsLock(locks, flowRunIns, time.Now()), nil
+}
@@ -0,0 +1,241 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/infrastructure/log"
+	"github.com/fBloc/bloc-server/infrastructure/notifier"
+	"github.com/fBloc/bloc-server/repository/notification_delivery"
+	"github.com/fBloc/bloc-server/value_object"
+)
+
+type NotificationConfiguration func(nS *NotificationService) error
+
+type NotificationService struct {
+	Logger                 *log.Logger
+	NotificationDeliveries notification_delivery.NotificationDeliveryRepository
+	Notifiers              map[value_object.NotifyChannel]notifier.Notifier
+}
+
+func NewService(
+	cfgs ...NotificationConfiguration,
+) (*NotificationService, error) {
+	nS := &NotificationService{
+		Notifiers: make(map[value_object.NotifyChannel]notifier.Notifier)}
+	for _, cfg := range cfgs {
+		err := cfg(nS)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nS, nil
+}
+
+func WithLogger(logger *log.Logger) NotificationConfiguration {
+	return func(nS *NotificationService) error {
+		nS.Logger = logger
+		return nil
+	}
+}
+
+func WithNotificationDeliveryRepository(
+	repo notification_delivery.NotificationDeliveryRepository,
+) NotificationConfiguration {
+	return func(nS *NotificationService) error {
+		nS.NotificationDeliveries = repo
+		return nil
+	}
+}
+
+func WithNotifiers(
+	notifiers map[value_object.NotifyChannel]notifier.Notifier,
+) NotificationConfiguration {
+	return func(nS *NotificationService) error {
+		for channel, n := range notifiers {
+			nS.Notifiers[channel] = n
+		}
+		return nil
+	}
+}
+
+// CreateDeliveries 按照flow的通知规则为已结束的运行记录创建需要投递的通知
+// 重复调用时只创建之前还未创建的，返回本次新创建的通知
+func (nS *NotificationService) CreateDeliveries(
+	flowIns *aggregate.Flow, flowRunRecord *aggregate.FlowRunRecord,
+) ([]*aggregate.NotificationDelivery, error) {
+	deliveries := make([]*aggregate.NotificationDelivery, 0, len(flowIns.NotificationRules))
+	for ruleIndex, rule := range flowIns.NotificationRules {
+		triggers := rule.MatchedTriggers(flowRunRecord)
+		if len(triggers) == 0 {
+			continue
+		}
+		delivery := aggregate.NewNotificationDelivery(flowRunRecord, ruleIndex, rule, triggers)
+		created, err := nS.NotificationDeliveries.CreateIfNotExist(delivery)
+		if err != nil {
+			return deliveries, err
+		}
+		if created {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+// RetryDelay 第attempted次投递失败后到下一次重试需等待的时长
+func RetryDelay(attempted int) time.Duration {
+	delay := config.NotificationDeliverRetryInterval
+	for i := 1; i < attempted; i++ {
+		delay *= 2
+	}
+	return delay
+}
+
+// Deliver 投递一次通知并记录结果，retry为true表示失败了且需要在delay后重试
+func (nS *NotificationService) Deliver(
+	delivery *aggregate.NotificationDelivery, msg notifier.Message,
+) (retry bool, delay time.Duration, err error) {
+	attempt := aggregate.NotificationDeliveryAttempt{Suc: true}
+	n, ok := nS.Notifiers[delivery.Channel]
+	if !ok {
+		attempt.Suc = false
+		attempt.ErrorMsg = fmt.Sprintf("no notifier for channel「%s」", delivery.Channel)
+	} else {
+		ctx, cancel := context.WithTimeout(
+			context.Background(), config.NotificationDeliverTimeout)
+		notifyErr := n.Notify(ctx, delivery.Target, delivery.Secret, msg)
+		cancel()
+		if notifyErr != nil {
+			attempt.Suc = false
+			attempt.ErrorMsg = notifyErr.Error()
+		}
+	}
+	attempt.Time = time.Now()
+
+	attempted := delivery.AttemptedAmount() + 1
+	retry = !attempt.Suc && ok && attempted < config.NotificationDeliverMaxAttempts
+	err = nS.NotificationDeliveries.AddAttempt(delivery.ID, attempt, !retry)
+	if err != nil {
+		return false, 0, err
+	}
+	if retry {
+		delay = RetryDelay(attempted)
+	}
+	return retry, delay, nil
+}
+
+// RunFinishedData webhook发送的json内容
+type RunFinishedData struct {
+	DeliveryID        value_object.UUID            `json:"delivery_id"`
+	FlowID            value_object.UUID            `json:"flow_id"`
+	FlowOriginID      value_object.UUID            `json:"flow_origin_id"`
+	FlowName          string                       `json:"flow_name"`
+	FlowRunRecordID   value_object.UUID            `json:"flow_run_record_id"`
+	Status            value_object.RunState        `json:"status"`
+	Triggers          []value_object.NotifyTrigger `json:"triggers"`
+	ErrorMsg          string                       `json:"error_msg"`
+	TriggerTime       time.Time                    `json:"trigger_time"`
+	StartTime         time.Time                    `json:"start_time"`
+	EndTime           time.Time                    `json:"end_time"`
+	DurationInSeconds float64                      `json:"duration_in_seconds"`
+}
+
+// NewRunFinishedMessage 构建flow运行结束的通知内容
+func NewRunFinishedMessage(
+	flowIns *aggregate.Flow,
+	flowRunRecord *aggregate.FlowRunRecord,
+	delivery *aggregate.NotificationDelivery,
+) (notifier.Message, error) {
+	data := RunFinishedData{
+		DeliveryID:      delivery.ID,
+		FlowID:          flowRunRecord.FlowID,
+		FlowOriginID:    flowRunRecord.FlowOriginID,
+		FlowName:        flowIns.Name,
+		FlowRunRecordID: flowRunRecord.ID,
+		Status:          flowRunRecord.Status,
+		Triggers:        delivery.Triggers,
+		ErrorMsg:        flowRunRecord.ErrorMsg,
+		TriggerTime:     flowRunRecord.TriggerTime,
+		StartTime:       flowRunRecord.StartTime,
+		EndTime:         flowRunRecord.EndTime,
+	}
+	if !flowRunRecord.StartTime.IsZero() {
+		data.DurationInSeconds = flowRunRecord.EndTime.Sub(flowRunRecord.StartTime).Seconds()
+	}
+	byteData, err := json.Marshal(data)
+	if err != nil {
+		return notifier.Message{}, err
+	}
+
+	triggers := make([]string, 0, len(delivery.Triggers))
+	for _, trigger := range delivery.Triggers {
+		triggers = append(triggers, string(trigger))
+	}
+	text := fmt.Sprintf(
+		"flow: %s\nflow_run_record_id: %s\nstatus: %d\nduration: %.0fs",
+		flowIns.Name, flowRunRecord.ID.String(), flowRunRecord.Status, data.DurationInSeconds)
+	if flowRunRecord.ErrorMsg != "" {
+		text += "\nerror: " + flowRunRecord.ErrorMsg
+	}
+	return notifier.Message{
+		Title: fmt.Sprintf("[bloc] flow「%s」run finished: %s",
+			flowIns.Name, strings.Join(triggers, ",")),
+		Text: text,
+		Data: byteData,
+	}, nil
+}
+
+// WaitingApprovalData 审批通知webhook发送的json内容
+type WaitingApprovalData struct {
+	DeliveryID          value_object.UUID `json:"delivery_id"`
+	FlowID              value_object.UUID `json:"flow_id"`
+	FlowOriginID        value_object.UUID `json:"flow_origin_id"`
+	FlowName            string            `json:"flow_name"`
+	FlowRunRecordID     value_object.UUID `json:"flow_run_record_id"`
+	FunctionRunRecordID value_object.UUID `json:"function_run_record_id"`
+	FlowFunctionID      string            `json:"flow_function_id"`
+	NodeName            string            `json:"node_name"`
+	Deadline            time.Time         `json:"deadline"` // 为空表示不限制审批时长
+}
+
+// NewWaitingApprovalMessage 构建通知审批人有等待审批的节点的通知内容
+func NewWaitingApprovalMessage(
+	flowIns *aggregate.Flow,
+	funcRunRecord *aggregate.FunctionRunRecord,
+	delivery *aggregate.NotificationDelivery,
+) (notifier.Message, error) {
+	data := WaitingApprovalData{
+		DeliveryID:          delivery.ID,
+		FlowID:              funcRunRecord.FlowID,
+		FlowOriginID:        funcRunRecord.FlowOriginID,
+		FlowName:            flowIns.Name,
+		FlowRunRecordID:     funcRunRecord.FlowRunRecordID,
+		FunctionRunRecordID: funcRunRecord.ID,
+		FlowFunctionID:      funcRunRecord.FlowFunctionID,
+		Deadline:            funcRunRecord.ShouldBeCanceledAt,
+	}
+	if flowFunction, ok := flowIns.FlowFunctionIDMapFlowFunction[funcRunRecord.FlowFunctionID]; ok {
+		data.NodeName = flowFunction.Name()
+	}
+	byteData, err := json.Marshal(data)
+	if err != nil {
+		return notifier.Message{}, err
+	}
+
+	text := fmt.Sprintf(
+		"flow: %s\nnode: %s\nflow_run_record_id: %s\nfunction_run_record_id: %s",
+		flowIns.Name, data.NodeName, funcRunRecord.FlowRunRecordID.String(), funcRunRecord.ID.String())
+	if !data.Deadline.IsZero() {
+		text += "\ndeadline: " + data.Deadline.Format(time.RFC3339)
+	}
+	return notifier.Message{
+		Title: fmt.Sprintf("[bloc] flow「%s」is waiting for your approval", flowIns.Name),
+		Text:  text,
+		Data:  byteData,
+	}, nil
+}
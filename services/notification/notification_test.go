@@ -0,0 +1,144 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fBloc/bloc-server/aggregate"
+	"github.com/fBloc/bloc-server/config"
+	"github.com/fBloc/bloc-server/infrastructure/notifier"
+	memory_notificationDelivery "github.com/fBloc/bloc-server/repository/notification_delivery/memory"
+	"github.com/fBloc/bloc-server/value_object"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeNotifier 前failTimes次投递失败，记录收到的通知
+type fakeNotifier struct {
+	failTimes int
+	received  []notifier.Message
+}
+
+func (fN *fakeNotifier) Notify(
+	_ context.Context, _, _ string, msg notifier.Message,
+) error {
+	fN.received = append(fN.received, msg)
+	if len(fN.received) <= fN.failTimes {
+		return errors.New("fake failed")
+	}
+	return nil
+}
+
+func TestNotificationService(t *testing.T) {
+	flowIns := &aggregate.Flow{
+		ID:   value_object.NewUUID(),
+		Name: "notify",
+		NotificationRules: []*aggregate.NotificationRule{
+			{
+				Triggers: []value_object.NotifyTrigger{value_object.NotifyOnFail},
+				Channel:  value_object.WebhookChannel,
+				Target:   "http://localhost/hook",
+			},
+			{
+				Triggers: []value_object.NotifyTrigger{value_object.NotifyOnSuc},
+				Channel:  value_object.SlackChannel,
+				Target:   "http://localhost/slack",
+			},
+		},
+	}
+	now := time.Now()
+	flowRunRecord := &aggregate.FlowRunRecord{
+		ID:        value_object.NewUUID(),
+		FlowID:    flowIns.ID,
+		StartTime: now.Add(-time.Minute),
+		EndTime:   now,
+		Status:    value_object.Fail,
+		ErrorMsg:  "have function failed",
+	}
+	fake := &fakeNotifier{failTimes: 1}
+	nS, err := NewService(
+		WithNotificationDeliveryRepository(memory_notificationDelivery.New()),
+		WithNotifiers(map[value_object.NotifyChannel]notifier.Notifier{
+			value_object.WebhookChannel: fake}))
+
+	Convey("create deliveries of matched rules", t, func() {
+		So(err, ShouldBeNil)
+		deliveries, err := nS.CreateDeliveries(flowIns, flowRunRecord)
+		So(err, ShouldBeNil)
+		So(len(deliveries), ShouldEqual, 1)
+		So(deliveries[0].Channel, ShouldEqual, value_object.WebhookChannel)
+		So(deliveries[0].Triggers, ShouldResemble, []value_object.NotifyTrigger{value_object.NotifyOnFail})
+	})
+
+	Convey("create deliveries only once per rule", t, func() {
+		deliveries, err := nS.CreateDeliveries(flowIns, flowRunRecord)
+		So(err, ShouldBeNil)
+		So(deliveries, ShouldBeEmpty)
+
+		// 上次只创建了部分规则的通知时，再次创建会补上缺少的
+		bothFailFlow := &aggregate.Flow{
+			ID: value_object.NewUUID(),
+			NotificationRules: []*aggregate.NotificationRule{
+				flowIns.NotificationRules[0], flowIns.NotificationRules[0]},
+		}
+		partialRunRecord := *flowRunRecord
+		partialRunRecord.ID = value_object.NewUUID()
+		_, err = nS.NotificationDeliveries.CreateIfNotExist(aggregate.NewNotificationDelivery(
+			&partialRunRecord, 0, bothFailFlow.NotificationRules[0], flowIns.NotificationRules[0].Triggers))
+		So(err, ShouldBeNil)
+		deliveries, err = nS.CreateDeliveries(bothFailFlow, &partialRunRecord)
+		So(err, ShouldBeNil)
+		So(len(deliveries), ShouldEqual, 1)
+		So(deliveries[0].RuleIndex, ShouldEqual, 1)
+	})
+
+	Convey("deliver with retry", t, func() {
+		delivery := aggregate.NewNotificationDelivery(
+			flowRunRecord, 0, flowIns.NotificationRules[0], flowIns.NotificationRules[0].Triggers)
+		So(nS.NotificationDeliveries.Create(delivery), ShouldBeNil)
+		msg, err := NewRunFinishedMessage(flowIns, flowRunRecord, delivery)
+		So(err, ShouldBeNil)
+
+		var data RunFinishedData
+		So(json.Unmarshal(msg.Data, &data), ShouldBeNil)
+		So(data.FlowRunRecordID, ShouldEqual, flowRunRecord.ID)
+		So(data.DurationInSeconds, ShouldEqual, 60)
+
+		retry, delay, err := nS.Deliver(delivery, msg)
+		So(err, ShouldBeNil)
+		So(retry, ShouldBeTrue)
+		So(delay, ShouldEqual, config.NotificationDeliverRetryInterval)
+
+		delivery, _ = nS.NotificationDeliveries.GetByID(delivery.ID)
+		retry, _, err = nS.Deliver(delivery, msg)
+		So(err, ShouldBeNil)
+		So(retry, ShouldBeFalse)
+
+		delivery, _ = nS.NotificationDeliveries.GetByID(delivery.ID)
+		So(delivery.AttemptedAmount(), ShouldEqual, 2)
+		So(delivery.Attempts[0].ErrorMsg, ShouldEqual, "fake failed")
+		So(delivery.Suc, ShouldBeTrue)
+		So(delivery.Finished(), ShouldBeTrue)
+		So(len(fake.received), ShouldEqual, 2)
+	})
+
+	Convey("no notifier of channel not retry", t, func() {
+		delivery := aggregate.NewNotificationDelivery(
+			flowRunRecord, 1, flowIns.NotificationRules[1], flowIns.NotificationRules[1].Triggers)
+		So(nS.NotificationDeliveries.Create(delivery), ShouldBeNil)
+
+		retry, _, err := nS.Deliver(delivery, notifier.Message{})
+		So(err, ShouldBeNil)
+		So(retry, ShouldBeFalse)
+		delivery, _ = nS.NotificationDeliveries.GetByID(delivery.ID)
+		So(delivery.Finished(), ShouldBeTrue)
+		So(delivery.Suc, ShouldBeFalse)
+	})
+
+	Convey("retry delay doubles", t, func() {
+		So(RetryDelay(1), ShouldEqual, config.NotificationDeliverRetryInterval)
+		So(RetryDelay(3), ShouldEqual, 4*config.NotificationDeliverRetryInterval)
+	})
+}
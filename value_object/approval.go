@@ -0,0 +1,17 @@
+package value_object
+
+// ApprovalFallback 人工审批节点被拒绝或等待审批超时后对flow运行的处理
+type ApprovalFallback string
+
+const (
+	ApprovalFailRun      ApprovalFallback = "fail"      // 使flow运行失败
+	ApprovalInterceptRun ApprovalFallback = "intercept" // 拦截此节点的下游，flow视为被拦截而结束
+)
+
+func (aF ApprovalFallback) IsValid() bool {
+	switch aF {
+	case ApprovalFailRun, ApprovalInterceptRun:
+		return true
+	}
+	return false
+}
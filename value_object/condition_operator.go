@@ -0,0 +1,46 @@
+package value_object
+
+// ConditionOperator 分支条件中的比较操作符
+type ConditionOperator string
+
+const (
+	EqualOperator    ConditionOperator = "=="
+	NotEqualOperator ConditionOperator = "!="
+	GtOperator       ConditionOperator = ">"
+	GteOperator      ConditionOperator = ">="
+	LtOperator       ConditionOperator = "<"
+	LteOperator      ConditionOperator = "<="
+)
+
+func (cO ConditionOperator) IsValid() bool {
+	switch cO {
+	case EqualOperator, NotEqualOperator,
+		GtOperator, GteOperator, LtOperator, LteOperator:
+		return true
+	}
+	return false
+}
+
+// NeedOrdering 是否是需要比较大小的操作符
+func (cO ConditionOperator) NeedOrdering() bool {
+	return cO != EqualOperator && cO != NotEqualOperator
+}
+
+// Satisfied 根据比较结果(-1/0/1)判断是否满足此操作符
+func (cO ConditionOperator) Satisfied(compareResult int) bool {
+	switch cO {
+	case EqualOperator:
+		return compareResult == 0
+	case NotEqualOperator:
+		return compareResult != 0
+	case GtOperator:
+		return compareResult > 0
+	case GteOperator:
+		return compareResult >= 0
+	case LtOperator:
+		return compareResult < 0
+	case LteOperator:
+		return compareResult <= 0
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package value_object
+
+// CrontabMisfirePolicy crontab的计划时间因调度停机、tick过慢等原因被错过时的处理方式
+type CrontabMisfirePolicy string
+
+const (
+	MisfireSkip     CrontabMisfirePolicy = "skip"      // 放弃错过的（默认）
+	MisfireFireOnce CrontabMisfirePolicy = "fire_once" // 无论错过多少次，只补发一次
+	MisfireFireAll  CrontabMisfirePolicy = "fire_all"  // 补发错过的，最多补发最近的N次
+)
+
+func (cMP CrontabMisfirePolicy) IsValid() bool {
+	switch cMP {
+	case MisfireSkip, MisfireFireOnce, MisfireFireAll:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package value_object
+
+// DependencyTriggerOn 上游flow运行结束后在何种情况下触发下游flow
+type DependencyTriggerOn string
+
+const (
+	DependencyOnSuc  DependencyTriggerOn = "suc"  // 上游运行成功（含被拦截）
+	DependencyOnFail DependencyTriggerOn = "fail" // 上游运行失败（含超时被取消）
+)
+
+func (dTO DependencyTriggerOn) IsValid() bool {
+	switch dTO {
+	case DependencyOnSuc, DependencyOnFail:
+		return true
+	}
+	return false
+}
+
+// Matched 上游flow运行结束的状态是否满足此触发条件
+func (dTO DependencyTriggerOn) Matched(upstreamStatus RunState) bool {
+	switch dTO {
+	case DependencyOnSuc:
+		return upstreamStatus == Suc || upstreamStatus == InterceptedCancel
+	case DependencyOnFail:
+		return upstreamStatus == Fail || upstreamStatus == TimeoutCanceled
+	}
+	return false
+}
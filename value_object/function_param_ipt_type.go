@@ -5,4 +5,5 @@ type FunctionParamIptType string
 const (
 	UserIpt    FunctionParamIptType = "user_ipt"
 	Connection FunctionParamIptType = "connection"
+	FlowParam  FunctionParamIptType = "flow_param" // 绑定到flow级别的输入参数
 )
@@ -0,0 +1,40 @@
+package value_object
+
+// NotifyTrigger flow运行结束后在何种情况下发送通知
+type NotifyTrigger string
+
+const (
+	NotifyOnSuc           NotifyTrigger = "suc"            // 运行成功
+	NotifyOnFail          NotifyTrigger = "fail"           // 运行失败
+	NotifyOnTimeoutCancel NotifyTrigger = "timeout_cancel" // 运行超时被取消
+	NotifyOnLongRun       NotifyTrigger = "long_run"       // 运行时长超过了设置的值
+
+	// NotifyOnWaitingApproval 运行到人工审批节点时通知审批人，不能配置在通知规则中
+	NotifyOnWaitingApproval NotifyTrigger = "waiting_approval"
+)
+
+func (nT NotifyTrigger) IsValid() bool {
+	switch nT {
+	case NotifyOnSuc, NotifyOnFail, NotifyOnTimeoutCancel, NotifyOnLongRun:
+		return true
+	}
+	return false
+}
+
+// NotifyChannel 发送通知的渠道
+type NotifyChannel string
+
+const (
+	WebhookChannel  NotifyChannel = "webhook"
+	EmailChannel    NotifyChannel = "email"
+	SlackChannel    NotifyChannel = "slack"
+	DingTalkChannel NotifyChannel = "dingtalk"
+)
+
+func (nC NotifyChannel) IsValid() bool {
+	switch nC {
+	case WebhookChannel, EmailChannel, SlackChannel, DingTalkChannel:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package value_object
+
+// RetryBackoff 节点重试等待时长的计算方式
+type RetryBackoff string
+
+const (
+	FixedBackoff       RetryBackoff = "fixed"       // 每次都等待相同的时长
+	ExponentialBackoff RetryBackoff = "exponential" // 每次等待的时长翻倍
+	JitterBackoff      RetryBackoff = "jitter"      // 在指数增长的时长内随机取值，避免同时重试
+)
+
+func (rB RetryBackoff) IsValid() bool {
+	switch rB {
+	case FixedBackoff, ExponentialBackoff, JitterBackoff:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,20 @@
+package value_object
+
+// RunConflictStrategy flow的运行数已达到上限时又被触发，新运行的处理方式
+type RunConflictStrategy string
+
+const (
+	DropNewRun    RunConflictStrategy = "drop"    // 放弃新的运行（默认）
+	QueueNewRun   RunConflictStrategy = "queue"   // 排队，等正在运行的结束后再运行
+	ReplaceOldRun RunConflictStrategy = "replace" // 取消最早开始运行的，运行新的
+	// 排队，但只保留最新的一个排队运行，之前排队的都放弃
+	KeepLatestPending RunConflictStrategy = "keep_latest"
+)
+
+func (rCS RunConflictStrategy) IsValid() bool {
+	switch rCS {
+	case DropNewRun, QueueNewRun, ReplaceOldRun, KeepLatestPending:
+		return true
+	}
+	return false
+}
@@ -13,12 +13,15 @@ const (
 	Fail
 	InterceptedCancel
 	NotAllowedParallelCancel
-	ToSchedule // upper functions not finished. Waiting to schedule
+	ToSchedule      // upper functions not finished. Waiting to schedule
+	ReplacedCancel  // 不允许并行运行时被新的运行取代而取消
+	ScheduleSkipped // flow暂停或处于禁止运行时段而跳过
+	WaitingApproval // 运行到人工审批节点，等待审批
 	maxRunStatus
 )
 
 func (tS RunState) IsRunFinished() bool {
-	return tS > Running && tS < ToSchedule
+	return (tS > Running && tS < ToSchedule) || tS == ReplacedCancel || tS == ScheduleSkipped
 }
 
 func (tS RunState) IsRunStateValid() bool {
@@ -26,5 +29,5 @@ func (tS RunState) IsRunStateValid() bool {
 }
 
 func NotFinishedRunStatus() []RunState {
-	return []RunState{ToSchedule, Created, InQueue, Running}
+	return []RunState{ToSchedule, Created, InQueue, Running, WaitingApproval}
 }
@@ -7,4 +7,5 @@ const (
 	Manual
 	Crontab
 	Key
+	Dependency // 上游flow运行结束后触发
 )
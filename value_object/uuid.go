@@ -14,6 +14,11 @@ func NewUUID() UUID {
 	return UUID(uuid.New())
 }
 
+// NewNameBasedUUID 同一name总是得到相同的UUID
+func NewNameBasedUUID(name string) UUID {
+	return UUID(uuid.NewSHA1(uuid.NameSpaceOID, []byte(name)))
+}
+
 func ParseToUUID(s string) (UUID, error) {
 	gUUID, err := uuid.Parse(s)
 	tUUID := UUID(gUUID)